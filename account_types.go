@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AccountType is one of the kinds of account a user can create. Icon names
+// a glyph in the Lucide icon set for the UI's picker.
+type AccountType struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Icon  string `json:"icon"`
+	// AllowsNegative is set for accounts whose balance normally runs below
+	// zero, such as a credit card carrying a debt.
+	AllowsNegative bool `json:"allows_negative"`
+}
+
+const (
+	accountTypeCash       = "cash"
+	accountTypeBank       = "bank"
+	accountTypeEWallet    = "e-wallet"
+	accountTypeCreditCard = "credit_card"
+	accountTypeInvestment = "investment"
+	accountTypeOther      = "other"
+)
+
+var accountTypes = []AccountType{
+	{Value: accountTypeCash, Label: "Cash", Icon: "banknote"},
+	{Value: accountTypeBank, Label: "Bank", Icon: "landmark"},
+	{Value: accountTypeEWallet, Label: "E-wallet", Icon: "smartphone"},
+	{Value: accountTypeCreditCard, Label: "Credit card", Icon: "credit-card", AllowsNegative: true},
+	{Value: accountTypeInvestment, Label: "Investment", Icon: "trending-up"},
+	{Value: accountTypeOther, Label: "Other", Icon: "wallet"},
+}
+
+// accountTypeKey folds the spellings clients use for a type, such as
+// "E-Wallet", "ewallet", and "Credit Card", to one key.
+func accountTypeKey(s string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(s)))
+}
+
+// lookupAccountType returns the allowed type raw names, if any.
+func lookupAccountType(raw string) (AccountType, bool) {
+	key := accountTypeKey(raw)
+	for _, t := range accountTypes {
+		if accountTypeKey(t.Value) == key {
+			return t, true
+		}
+	}
+	return AccountType{}, false
+}
+
+var errInvalidAccountType = errors.New("type must be one of cash, bank, e-wallet, credit_card, investment, or other")
+
+// normalizeAccountType replaces a's type with the allowed value it names.
+func normalizeAccountType(a *Account) error {
+	t, ok := lookupAccountType(a.Type)
+	if !ok {
+		return errInvalidAccountType
+	}
+	a.Type = t.Value
+	return nil
+}
+
+// legacyAccountTypes maps the free-text types accounts were created with
+// before types were validated to the allowed value closest in meaning.
+// Anything else not already an allowed type becomes other.
+var legacyAccountTypes = map[string]string{
+	"checking":   accountTypeBank,
+	"current":    accountTypeBank,
+	"savings":    accountTypeBank,
+	"debit":      accountTypeBank,
+	"wallet":     accountTypeEWallet,
+	"credit":     accountTypeCreditCard,
+	"card":       accountTypeCreditCard,
+	"creditcard": accountTypeCreditCard,
+	"brokerage":  accountTypeInvestment,
+	"stocks":     accountTypeInvestment,
+}
+
+func migratedAccountType(raw string) string {
+	if t, ok := lookupAccountType(raw); ok {
+		return t.Value
+	}
+	if value, ok := legacyAccountTypes[accountTypeKey(raw)]; ok {
+		return value
+	}
+	return accountTypeOther
+}
+
+// migrateAccountTypes rewrites stored types to their allowed value. Rows
+// already normalized are left alone, so it is cheap to run on every start.
+func (app *App) migrateAccountTypes() error {
+	rows, err := app.db.Query("SELECT DISTINCT type FROM accounts")
+	if err != nil {
+		return fmt.Errorf("read account types: %w", err)
+	}
+	var stored []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return fmt.Errorf("read account types: %w", err)
+		}
+		stored = append(stored, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read account types: %w", err)
+	}
+
+	for _, t := range stored {
+		if value := migratedAccountType(t); value != t {
+			if _, err := app.db.Exec("UPDATE accounts SET type = ? WHERE type = ?", value, t); err != nil {
+				return fmt.Errorf("normalize account type %q: %w", t, err)
+			}
+		}
+	}
+	return nil
+}
+
+// accountTypesHandler lists the allowed account types, for building a
+// picker.
+func accountTypesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accountTypes)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAccountTypes(t *testing.T) {
+	useTestDB(t)
+
+	types := decodeBody[[]AccountType](t, callAuthed(http.MethodGet, "/accounts/types", nil))
+	if len(types) != 6 || types[3].Value != accountTypeCreditCard || !types[3].AllowsNegative || types[3].Icon == "" {
+		t.Fatalf("unexpected account types: %+v", types)
+	}
+
+	for input, want := range map[string]string{
+		"bank": "bank", "BANK": "bank", " Bank ": "bank",
+		"E-Wallet": "e-wallet", "ewallet": "e-wallet", "e_wallet": "e-wallet",
+		"Credit Card": "credit_card", "credit-card": "credit_card",
+		"Investment": "investment", "other": "other", "Cash": "cash",
+	} {
+		rr := callAuthed(http.MethodPost, "/accounts", Account{Name: input, Type: input})
+		expectStatus(t, rr, http.StatusCreated)
+		if got := decodeBody[Account](t, rr).Type; got != want {
+			t.Errorf("type %q: stored %q, want %q", input, got, want)
+		}
+	}
+
+	for _, input := range []string{"", "checking", "piggy bank"} {
+		rr := callAuthed(http.MethodPost, "/accounts", Account{Name: "Bad", Type: input})
+		expectStatus(t, rr, http.StatusBadRequest)
+	}
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/accounts/%d", testAccountID), Account{Name: "Wallet", Type: "crypto"}), http.StatusBadRequest)
+}
+
+func TestMigrateAccountTypes(t *testing.T) {
+	useTestDB(t)
+
+	want := map[string]string{
+		"Bank": "bank", "BANK": "bank", "Checking": "bank", "Savings": "bank",
+		"E-Wallet": "e-wallet", "Credit": "credit_card", "credit card": "credit_card",
+		"Piggy bank": "other", "cash": "cash",
+	}
+	ids := map[string]int{}
+	for raw := range want {
+		id, err := insertReturningID(testApp.db, "INSERT INTO accounts(name, type, balance, user_id) VALUES(?, ?, ?, ?)", raw, raw, 0, testUserID)
+		if err != nil {
+			t.Fatalf("seed %q: %v", raw, err)
+		}
+		ids[raw] = id
+	}
+
+	// A second run finds nothing to change.
+	for run := 0; run < 2; run++ {
+		if err := testApp.migrateAccountTypes(); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+	}
+	for raw, id := range ids {
+		var got string
+		if err := testApp.db.QueryRow("SELECT type FROM accounts WHERE id = ?", id).Scan(&got); err != nil {
+			t.Fatalf("read %q: %v", raw, err)
+		}
+		if got != want[raw] {
+			t.Errorf("type %q migrated to %q, want %q", raw, got, want[raw])
+		}
+	}
+}
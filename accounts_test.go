@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAccountFilterOnTransactionLists(t *testing.T) {
+	useTestDB(t)
+
+	bank := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Bank", Type: "bank"}))
+	closing := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Old Card", Type: "credit_card"}))
+
+	now := time.Now().UTC()
+	for _, accountID := range []int{bank.ID, bank.ID, testAccountID, closing.ID} {
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 1, Category: "Misc", Date: now, AccountID: intPtr(accountID)}), http.StatusCreated)
+		expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 1, Source: "Misc", Date: now, AccountID: intPtr(accountID)}), http.StatusCreated)
+	}
+	// Deleting an account leaves its transactions unlinked.
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/accounts/%d", closing.ID), nil), http.StatusNoContent)
+
+	all := decodeBody[[]Expense](t, callAuthed(http.MethodGet, "/expenses", nil))
+	linked := 0
+	for _, e := range all {
+		if e.AccountID != nil {
+			linked++
+		}
+	}
+	if len(all) != 4 || linked != 3 {
+		t.Fatalf("expected list items to carry account_id, got %d of %d linked", linked, len(all))
+	}
+
+	onBank := decodeBody[[]Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses?account_id=%d", bank.ID), nil))
+	if len(onBank) != 2 || *onBank[0].AccountID != bank.ID || *onBank[1].AccountID != bank.ID {
+		t.Fatalf("expected the two Bank expenses, got %+v", onBank)
+	}
+	paged := decodeBody[[]Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses?account_id=%d&limit=1&offset=1", bank.ID), nil))
+	if len(paged) != 1 || paged[0].ID != onBank[1].ID {
+		t.Fatalf("expected pagination within the filtered set, got %+v", paged)
+	}
+	unlinked := decodeBody[[]Expense](t, callAuthed(http.MethodGet, "/expenses?account_id=null", nil))
+	if len(unlinked) != 1 || unlinked[0].AccountID != nil {
+		t.Fatalf("expected one unlinked expense, got %+v", unlinked)
+	}
+
+	incomesOnBank := decodeBody[[]Income](t, callAuthed(http.MethodGet, fmt.Sprintf("/incomes?account_id=%d", bank.ID), nil))
+	if len(incomesOnBank) != 2 || *incomesOnBank[0].AccountID != bank.ID {
+		t.Fatalf("expected the two Bank incomes, got %+v", incomesOnBank)
+	}
+	unlinkedIncomes := decodeBody[[]Income](t, callAuthed(http.MethodGet, "/incomes?account_id=null", nil))
+	if len(unlinkedIncomes) != 1 || unlinkedIncomes[0].AccountID != nil {
+		t.Fatalf("expected one unlinked income, got %+v", unlinkedIncomes)
+	}
+
+	for _, path := range []string{"/expenses", "/incomes"} {
+		expectStatus(t, callAuthed(http.MethodGet, path+"?account_id=bank", nil), http.StatusBadRequest)
+		expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("%s?account_id=%d", path, closing.ID), nil), http.StatusNotFound)
+	}
+}
+
+func TestAccountIDRoundTripsThroughUpdates(t *testing.T) {
+	useTestDB(t)
+
+	balance := func(id int) float64 {
+		t.Helper()
+		return decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", id), nil)).Balance
+	}
+
+	savings := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Savings", Type: "bank", Balance: 500}))
+	startMain := balance(testAccountID)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	expense := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 40, Category: "Food", Date: now, AccountID: testAccount()}))
+	income := decodeBody[Income](t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 100, Source: "Gift", Date: now, AccountID: testAccount()}))
+
+	fetchedExpense := decodeBody[Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", expense.ID), nil))
+	fetchedIncome := decodeBody[Income](t, callAuthed(http.MethodGet, fmt.Sprintf("/incomes/%d", income.ID), nil))
+	if fetchedExpense.AccountID == nil || *fetchedExpense.AccountID != testAccountID || fetchedIncome.AccountID == nil || *fetchedIncome.AccountID != testAccountID {
+		t.Fatalf("expected GET to return account_id %d, got expense %v income %v", testAccountID, fetchedExpense.AccountID, fetchedIncome.AccountID)
+	}
+
+	// Echoing the object back keeps the link; omitting account_id does too.
+	fetchedExpense.Note = "Edited"
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", expense.ID), fetchedExpense), http.StatusOK)
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/incomes/%d", income.ID), Income{Amount: 100, Source: "Gift", Date: now}), http.StatusOK)
+	if got := balance(testAccountID); got != startMain+60 {
+		t.Fatalf("expected unchanged amounts to leave the balance at %.2f, got %.2f", startMain+60, got)
+	}
+	if e := decodeBody[Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", expense.ID), nil)); e.AccountID == nil || *e.AccountID != testAccountID {
+		t.Fatalf("expected the expense to stay linked, got %v", e.AccountID)
+	}
+	if i := decodeBody[Income](t, callAuthed(http.MethodGet, fmt.Sprintf("/incomes/%d", income.ID), nil)); i.AccountID == nil || *i.AccountID != testAccountID {
+		t.Fatalf("expected the income to stay linked, got %v", i.AccountID)
+	}
+
+	// Moving to another account with a new amount shifts the balances.
+	fetchedExpense.AccountID = &savings.ID
+	fetchedExpense.Amount = 25
+	moved := decodeBody[Expense](t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", expense.ID), fetchedExpense))
+	if moved.AccountID == nil || *moved.AccountID != savings.ID {
+		t.Fatalf("expected the expense to move to savings, got %v", moved.AccountID)
+	}
+	fetchedIncome.AccountID = &savings.ID
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/incomes/%d", income.ID), fetchedIncome), http.StatusOK)
+
+	if got := balance(testAccountID); got != startMain {
+		t.Fatalf("expected the original account back at %.2f, got %.2f", startMain, got)
+	}
+	if got := balance(savings.ID); got != 575 {
+		t.Fatalf("expected savings at 575, got %.2f", got)
+	}
+
+	listed := decodeBody[[]Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses?account_id=%d", savings.ID), nil))
+	if len(listed) != 1 || listed[0].ID != expense.ID {
+		t.Fatalf("expected the moved expense under savings, got %+v", listed)
+	}
+
+	fetchedExpense.AccountID = intPtr(savings.ID + 1000)
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", expense.ID), fetchedExpense), http.StatusBadRequest)
+	fetchedIncome.AccountID = intPtr(savings.ID + 1000)
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/incomes/%d", income.ID), fetchedIncome), http.StatusBadRequest)
+}
+
+func TestAccountListPaging(t *testing.T) {
+	useTestDB(t)
+
+	for _, name := range []string{"delta", "Alpha", "charlie"} {
+		expectStatus(t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: name, Type: "cash", Balance: float64(len(name))}), http.StatusCreated)
+	}
+	names := func(query string) ([]string, string) {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, "/accounts"+query, nil)
+		expectStatus(t, rr, http.StatusOK)
+		var out []string
+		for _, a := range decodeBody[[]Account](t, rr) {
+			out = append(out, a.Name)
+		}
+		return out, rr.Header().Get("X-Total-Count")
+	}
+
+	// The seeded test account is there too; names sort case-insensitively.
+	all, total := names("")
+	if len(all) != 4 || total != "4" || all[0] != "Alpha" || all[1] != "charlie" {
+		t.Fatalf("expected all accounts by name with a total, got %v (total %s)", all, total)
+	}
+	page, total := names("?limit=2&offset=2")
+	if len(page) != 2 || total != "4" || page[0] != all[2] {
+		t.Fatalf("expected the second page of two, got %v (total %s)", page, total)
+	}
+	if byBalance, _ := names("?sort=-balance&limit=1"); len(byBalance) != 1 || byBalance[0] != "charlie" {
+		t.Fatalf("expected the largest balance first, got %v", byBalance)
+	}
+	expectStatus(t, callAuthed(http.MethodGet, "/accounts?sort=colour", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/recurring-expenses?limit=0", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	activityTypeExpense    = "expense"
+	activityTypeIncome     = "income"
+	activityTypeAdjustment = "adjustment"
+)
+
+// transactionTypes are the types that move money in or out, which the
+// dashboard and transaction export list. The activity feed adds adjustments.
+var (
+	transactionTypes = []string{activityTypeExpense, activityTypeIncome}
+	activityTypes    = append(transactionTypes[:len(transactionTypes):len(transactionTypes)], activityTypeAdjustment)
+)
+
+// activitySources selects each activity type's rows in the shape of
+// ActivityItem, for a UNION ALL.
+var activitySources = map[string]string{
+	activityTypeExpense: "SELECT 'expense' AS type, id, amount, category, '' AS source, COALESCE(note, '') AS note, date, account_id FROM expenses WHERE " + householdScope,
+	activityTypeIncome:  "SELECT 'income' AS type, id, amount, '' AS category, source, COALESCE(note, '') AS note, date, account_id FROM incomes WHERE " + householdScope,
+	// Adjustments are scoped by the account they were made to.
+	activityTypeAdjustment: `SELECT 'adjustment' AS type, id, amount, '' AS category, '' AS source, note, date, account_id FROM (
+        SELECT h.id AS id, h.delta AS amount, COALESCE(h.note, '') AS note, h.recorded_at AS date, h.account_id AS account_id,
+            a.user_id AS user_id, a.household_id AS household_id
+        FROM balance_history h JOIN accounts a ON a.id = h.account_id
+        WHERE h.reason = 'adjustment'
+    ) AS adjustments WHERE ` + householdScope,
+}
+
+// ActivityItem is an expense, an income, or a balance adjustment, told
+// apart by Type. Category is set for expenses and Source for incomes; the
+// Amount of an adjustment is the change, negative when the balance went
+// down.
+type ActivityItem struct {
+	Type      string    `json:"type"` // "expense", "income", or "adjustment"
+	ID        int       `json:"id"`
+	Amount    float64   `json:"amount"`
+	Category  string    `json:"category,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Note      string    `json:"note"`
+	Date      time.Time `json:"date"`
+	AccountID *int      `json:"account_id"`
+}
+
+// loadActivity pages through the user's rows of the given types, newest
+// first. filter is a clause on the shared columns appended to each type's
+// query, with filterArgs its arguments. Ties on date are broken by type and
+// then id, so pages do not overlap. after, when set, starts the page after
+// that position instead of at offset.
+func loadActivity(q rowsQuerier, userID int, types []string, filter string, filterArgs []interface{}, limit, offset int, after *pageCursor) ([]ActivityItem, error) {
+	var selects []string
+	var args []interface{}
+	for _, t := range types {
+		clause, clauseArgs := activityAfter(t, after)
+		selects = append(selects, activitySources[t]+filter+clause)
+		args = append(append(append(args, userID, userID), filterArgs...), clauseArgs...)
+	}
+	query := "SELECT * FROM (" + strings.Join(selects, " UNION ALL ") + ") AS activity ORDER BY date DESC, type, id DESC LIMIT ? OFFSET ?"
+	rows, err := q.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ActivityItem{}
+	for rows.Next() {
+		item, err := scanActivityItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// activityAfter limits the rows of type t to those ordered after the
+// position after. Within a date, types sort by name and ids descend, so
+// only t's own rows are compared by id.
+func activityAfter(t string, after *pageCursor) (string, []interface{}) {
+	switch {
+	case after == nil:
+		return "", nil
+	case t < after.Type:
+		return " AND date < ?", []interface{}{after.Date}
+	case t > after.Type:
+		return " AND date <= ?", []interface{}{after.Date}
+	default:
+		return " AND (date < ? OR (date = ? AND id < ?))", []interface{}{after.Date, after.Date, after.ID}
+	}
+}
+
+// scanActivityItem reads a row selected by one of activitySources.
+func scanActivityItem(rows *sql.Rows) (ActivityItem, error) {
+	var item ActivityItem
+	var dateStr string
+	var accountID sql.NullInt64
+	if err := rows.Scan(&item.Type, &item.ID, &item.Amount, &item.Category, &item.Source, &item.Note, &dateStr, &accountID); err != nil {
+		return ActivityItem{}, err
+	}
+	var err error
+	if item.Date, err = parseTimestamp(dateStr); err != nil {
+		return ActivityItem{}, err
+	}
+	item.AccountID = nullIntPtr(accountID)
+	return item, nil
+}
+
+// activityHandler serves GET /activity: expenses, incomes, and balance
+// adjustments in one list, newest first. type limits it to one of them; date_from, date_to, and
+// account_id filter them all as on the expense and income lists.
+func (app *App) activityHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+
+	types := activityTypes
+	if raw := strings.TrimSpace(params.Get("type")); raw != "" {
+		if _, ok := activitySources[raw]; !ok {
+			http.Error(w, "Invalid type; use expense, income, or adjustment", http.StatusBadRequest)
+			return
+		}
+		types = []string{raw}
+	}
+
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	filter, args, ok := dateRangeFilter(w, params, loc)
+	if !ok {
+		return
+	}
+	accountClause, accountArgs, ok := app.parseAccountFilter(w, userID, params)
+	if !ok {
+		return
+	}
+	filter += accountClause
+	args = append(args, accountArgs...)
+
+	page, ok := parseCursorPage(w, params, "activity")
+	if !ok {
+		return
+	}
+	var items []ActivityItem
+	var err error
+	if page.On {
+		items, err = loadActivity(app.requestDB(r), userID, types, filter, args, page.Limit+1, 0, page.After)
+	} else {
+		limit, offset, ok := parsePagination(w, params)
+		if !ok {
+			return
+		}
+		items, err = loadActivity(app.requestDB(r), userID, types, filter, args, limit, offset, nil)
+	}
+	if err != nil {
+		log.Printf("activity query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if page.On {
+		items = trimPage(w, page, items, func(item ActivityItem) pageCursor {
+			return pageCursor{List: "activity", Date: item.Date.Format(timeFormat), Type: item.Type, ID: item.ID}
+		})
+	}
+	writeJSONList(w, items)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestActivityFeed(t *testing.T) {
+	useTestDB(t)
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	wallet := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: "Wallet", Type: "cash"}))
+	for day := 0; day < 6; day++ {
+		date := base.AddDate(0, 0, day)
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: float64(10 + day), Category: "Food", Date: date, AccountID: testAccount()}), http.StatusCreated)
+		if day%2 == 0 {
+			expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: float64(100 + day), Source: "Gig", Date: date, AccountID: &wallet.ID}), http.StatusCreated)
+		}
+	}
+
+	feed := func(query string) []ActivityItem {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, "/activity"+query, nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[[]ActivityItem](t, rr)
+	}
+
+	// Paging through the union sees every row once, newest first, with the
+	// expense ahead of the income on the same date.
+	var all []ActivityItem
+	for offset := 0; ; offset += 4 {
+		page := feed(fmt.Sprintf("?limit=4&offset=%d", offset))
+		all = append(all, page...)
+		if len(page) < 4 {
+			break
+		}
+	}
+	if len(all) != 9 {
+		t.Fatalf("expected 9 rows across pages, got %d", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Date.After(all[i-1].Date) {
+			t.Fatalf("rows out of order at %d: %+v", i, all)
+		}
+	}
+	if all[0].Type != "expense" || all[0].Amount != 15 || all[1].Type != "expense" || all[2].Type != "income" || all[2].Source != "Gig" || all[2].Category != "" {
+		t.Fatalf("unexpected first rows: %+v", all[:3])
+	}
+
+	if incomes := feed("?type=income"); len(incomes) != 3 || incomes[0].Amount != 104 {
+		t.Fatalf("expected only incomes, got %+v", incomes)
+	}
+	if onWallet := feed(fmt.Sprintf("?account_id=%d", wallet.ID)); len(onWallet) != 3 || onWallet[0].Type != "income" {
+		t.Fatalf("expected the account filter on both types, got %+v", onWallet)
+	}
+	if ranged := feed("?date_from=2024-05-02&date_to=2024-05-03"); len(ranged) != 3 {
+		t.Fatalf("expected the date filter on both types, got %+v", ranged)
+	}
+	expectStatus(t, callAuthed(http.MethodGet, "/activity?type=transfer", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Balances change through transactions, or by hand through POST
+// /accounts/{id}/adjust, which records the change as an adjustment with a
+// note. Setting balance with PUT /accounts/{id} still works, as an
+// adjustment without a note, until Config.BalanceEditSunset; after that it
+// is refused with 422.
+
+// routeErrorBalanceReadOnly is the code of the 422 for a PUT that changes
+// an account's balance once the sunset has passed.
+const routeErrorBalanceReadOnly = "balance_read_only"
+
+// AccountAdjustment is the body of POST /accounts/{id}/adjust: either the
+// balance the account should now hold or the change to make, not both.
+type AccountAdjustment struct {
+	NewBalance *float64 `json:"new_balance"`
+	Delta      *float64 `json:"delta"`
+	Note       string   `json:"note"`
+}
+
+func (a *AccountAdjustment) UnmarshalJSON(data []byte) error {
+	type plain AccountAdjustment
+	aux := struct {
+		*plain
+		NewBalance json.RawMessage `json:"new_balance"`
+		Delta      json.RawMessage `json:"delta"`
+	}{plain: (*plain)(a)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	var err error
+	if a.NewBalance, err = parseOptionalAmount("new_balance", aux.NewBalance); err != nil {
+		return err
+	}
+	a.Delta, err = parseOptionalAmount("delta", aux.Delta)
+	return err
+}
+
+// BalanceAdjustment is a recorded adjustment: the change, the balance it
+// left, and when it was made.
+type BalanceAdjustment struct {
+	ID        int       `json:"id"`
+	AccountID int       `json:"account_id"`
+	Delta     float64   `json:"delta"`
+	Balance   float64   `json:"balance"`
+	Note      string    `json:"note"`
+	Date      time.Time `json:"date"`
+}
+
+// adjustAccountHandler serves POST /accounts/{id}/adjust. new_balance is
+// checked against the balance the adjustment started from, so a
+// transaction landing in between is answered with 409 rather than
+// overwritten.
+func (app *App) adjustAccountHandler(w http.ResponseWriter, r *http.Request, userID, id int) {
+	var adj AccountAdjustment
+	if !decodeJSONBody(w, r, &adj) {
+		return
+	}
+	if (adj.NewBalance == nil) == (adj.Delta == nil) {
+		http.Error(w, "Send either new_balance or delta", http.StatusBadRequest)
+		return
+	}
+	if err := cleanText(noteField("note", &adj.Note)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := app.dbtx.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	old, err := fetchAccount(tx, userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("account fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var delta float64
+	guard := ""
+	args := []interface{}{}
+	if adj.Delta != nil {
+		delta = *adj.Delta
+	} else {
+		delta = roundCents(*adj.NewBalance - old.Balance)
+		guard = " AND balance = ?"
+		args = append(args, old.Balance)
+	}
+	if delta == 0 {
+		http.Error(w, "The adjustment does not change the balance", http.StatusBadRequest)
+		return
+	}
+
+	updated := old
+	updated.Timestamps = old.Timestamps.touched(time.Now())
+	now := updated.UpdatedAt.Format(timeFormat)
+	res, err := tx.Exec("UPDATE accounts SET balance = balance + ?, updated_at = ? WHERE id = ?"+guard+" AND "+householdScope,
+		append(append([]interface{}{delta, now, id}, args...), userID, userID)...)
+	if err != nil {
+		log.Printf("account adjust error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		log.Printf("account adjust error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "The balance changed while adjusting it; try again", http.StatusConflict)
+		return
+	}
+	if err := tx.QueryRow("SELECT balance FROM accounts WHERE id = ?", id).Scan(&updated.Balance); err != nil {
+		log.Printf("account balance fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	entry := BalanceAdjustment{AccountID: id, Delta: delta, Balance: updated.Balance, Note: adj.Note, Date: updated.UpdatedAt}
+	entry.ID, err = insertReturningID(tx, "INSERT INTO balance_history(account_id, balance, delta, reason, note, recorded_at) VALUES(?, ?, ?, ?, ?, ?)",
+		id, entry.Balance, delta, balanceReasonAdjustment, adj.Note, now)
+	if err != nil {
+		log.Printf("balance history error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(tx, userID, auditEntityAccount, id, auditActionUpdate, old, updated); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// checkBalanceEdit handles a PUT /accounts/{id} whose balance differs from
+// the stored one. Before the sunset the edit goes through, marked
+// deprecated with a link to the adjust endpoint; after it, it is refused
+// with 422 and false is returned.
+func (app *App) checkBalanceEdit(w http.ResponseWriter, id int, now time.Time) bool {
+	adjust := fmt.Sprintf("%s/accounts/%d/adjust", apiPrefix, id)
+	if !now.Before(app.cfg.BalanceEditSunset) {
+		writeAPIError(w, http.StatusUnprocessableEntity, routeErrorBalanceReadOnly,
+			"balance cannot be set with PUT; use POST "+adjust)
+		return false
+	}
+	h := w.Header()
+	h.Set("Deprecation", "@"+strconv.FormatInt(app.cfg.BalanceEditDeprecatedAt.Unix(), 10))
+	h.Set("Sunset", app.cfg.BalanceEditSunset.Format(http.TimeFormat))
+	h.Set("Link", "<"+adjust+`>; rel="alternate"`)
+	return true
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAdjustAccount(t *testing.T) {
+	useTestDB(t)
+	account := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Wallet", Type: "cash", Balance: 100}))
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 30, Category: "Food", AccountID: &account.ID}), http.StatusCreated)
+	adjust := fmt.Sprintf("/accounts/%d/adjust", account.ID)
+
+	report := func() []MonthlyReport {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, "/reports/income-vs-expense", nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[[]MonthlyReport](t, rr)
+	}
+	before := report()
+
+	rr := callAuthed(http.MethodPost, adjust, map[string]interface{}{"delta": -25.5, "note": " Cash count "})
+	expectStatus(t, rr, http.StatusCreated)
+	if got := decodeBody[BalanceAdjustment](t, rr); got.Delta != -25.5 || got.Balance != 44.5 || got.Note != "Cash count" {
+		t.Fatalf("unexpected adjustment: %+v", got)
+	}
+	rr = callAuthed(http.MethodPost, adjust, map[string]interface{}{"new_balance": 50})
+	expectStatus(t, rr, http.StatusCreated)
+	if got := decodeBody[BalanceAdjustment](t, rr); got.Delta != 5.5 || got.Balance != 50 {
+		t.Fatalf("unexpected adjustment: %+v", got)
+	}
+
+	for _, body := range []map[string]interface{}{
+		{"delta": 5, "new_balance": 10},
+		{"note": "nothing"},
+		{"delta": 0},
+		{"new_balance": 50},
+	} {
+		expectStatus(t, callAuthed(http.MethodPost, adjust, body), http.StatusBadRequest)
+	}
+	expectStatus(t, callAuthed(http.MethodPost, fmt.Sprintf("/accounts/%d/adjust", account.ID+1000), map[string]interface{}{"delta": 1}), http.StatusNotFound)
+
+	if got := decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID), nil)); got.Balance != 50 {
+		t.Fatalf("expected a balance of 50, got %v", got.Balance)
+	}
+
+	// Both show in activity and history, and reports leave them out.
+	rr = callAuthed(http.MethodGet, "/activity?type=adjustment", nil)
+	expectStatus(t, rr, http.StatusOK)
+	if items := decodeBody[[]ActivityItem](t, rr); len(items) != 2 || items[0].Amount != 5.5 || items[1].Amount != -25.5 || items[1].Note != "Cash count" {
+		t.Fatalf("expected both adjustments in activity, got %+v", items)
+	}
+	rr = callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d/history", account.ID), nil)
+	expectStatus(t, rr, http.StatusOK)
+	if h := decodeBody[BalanceHistory](t, rr); len(h.Points) == 0 || h.Points[len(h.Points)-1].Balance != 50 {
+		t.Fatalf("expected history to end at 50, got %+v", h.Points)
+	}
+	if after := report(); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("expected adjustments to leave reports alone, got %+v then %+v", before, after)
+	}
+}
+
+func TestPutAccountBalance(t *testing.T) {
+	cfg := testConfig()
+	cfg.BalanceEditDeprecatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.BalanceEditSunset = time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	useTestDBConfig(t, cfg)
+	now := cfg.BalanceEditSunset
+	testApp.now = func() time.Time { return now }
+	account := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Wallet", Type: "cash", Balance: 100}))
+	// Versioned, since unversioned paths carry a Deprecation header of their own.
+	path := fmt.Sprintf("%s/accounts/%d", apiPrefix, account.ID)
+
+	// Echoing the balance back, or leaving it out, is not an edit.
+	account.Name = "Purse"
+	rr := callAuthed(http.MethodPut, path, account)
+	expectStatus(t, rr, http.StatusOK)
+	if rr.Header().Get("Deprecation") != "" {
+		t.Fatal("expected no Deprecation header for an unchanged balance")
+	}
+	rr = callAuthed(http.MethodPut, path, map[string]interface{}{"name": "Pocket", "type": "cash"})
+	expectStatus(t, rr, http.StatusOK)
+	if got := decodeBody[Account](t, rr); got.Balance != 100 || got.Name != "Pocket" {
+		t.Fatalf("expected the balance kept, got %+v", got)
+	}
+
+	account.Balance = 120
+	rr = callAuthed(http.MethodPut, path, account)
+	expectStatus(t, rr, http.StatusUnprocessableEntity)
+	if got := decodeBody[apiError](t, rr); got.Code != routeErrorBalanceReadOnly {
+		t.Fatalf("expected code %q, got %+v", routeErrorBalanceReadOnly, got)
+	}
+
+	// Until the sunset it still works, flagged as deprecated.
+	now = cfg.BalanceEditSunset.Add(-time.Second)
+	rr = callAuthed(http.MethodPut, path, account)
+	expectStatus(t, rr, http.StatusOK)
+	if got, want := rr.Header().Get("Deprecation"), "@1704067200"; got != want {
+		t.Fatalf("expected Deprecation %q, got %q", want, got)
+	}
+	if got, want := rr.Header().Get("Sunset"), "Mon, 01 Apr 2024 00:00:00 GMT"; got != want {
+		t.Fatalf("expected Sunset %q, got %q", want, got)
+	}
+	if got := decodeBody[Account](t, rr); got.Balance != 120 {
+		t.Fatalf("expected a balance of 120, got %v", got.Balance)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// maxAmountDecimals is how many decimal places a money field may have.
+const maxAmountDecimals = 2
+
+var centsPerUnit = big.NewRat(100, 1)
+
+// parseAmount reads the raw JSON of the money field named field. It must be
+// a finite JSON number with at most two decimal places; exponent notation
+// is fine as long as the value it spells is. Strings and null are refused
+// rather than read as zero, and amounts finer than a cent rather than
+// rounded.
+func parseAmount(field string, raw json.RawMessage) (float64, error) {
+	invalid := fmt.Errorf("%s must be a number with at most %d decimal places, got %s", field, maxAmountDecimals, raw)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return 0, invalid
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, invalid
+	}
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, invalid
+	}
+	exact, ok := new(big.Rat).SetString(n.String())
+	if !ok || !exact.Mul(exact, centsPerUnit).IsInt() {
+		return 0, invalid
+	}
+	return f, nil
+}
+
+// parseOptionalAmount is parseAmount for a money field that may be left
+// unset, where null means the same as leaving it out.
+func parseOptionalAmount(field string, raw json.RawMessage) (*float64, error) {
+	if raw == nil || string(raw) == "null" {
+		return nil, nil
+	}
+	f, err := parseAmount(field, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// The money fields of request bodies are decoded through parseAmount the
+// same way the date fields go through inputTime: the methods here and in
+// dates.go swap them for a json.RawMessage and check it once the rest of
+// the body has decoded.
+
+func (s *ExpenseSplit) UnmarshalJSON(data []byte) error {
+	type plain ExpenseSplit
+	aux := struct {
+		*plain
+		Amount json.RawMessage `json:"amount"`
+	}{plain: (*plain)(s)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	if aux.Amount != nil {
+		amount, err := parseAmount("split amount", aux.Amount)
+		if err != nil {
+			return err
+		}
+		s.Amount = amount
+	}
+	return nil
+}
+
+func (a *Account) UnmarshalJSON(data []byte) error {
+	type plain Account
+	aux := struct {
+		*plain
+		Balance        json.RawMessage `json:"balance"`
+		MinimumBalance json.RawMessage `json:"minimum_balance"`
+	}{plain: (*plain)(a)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	if aux.Balance != nil {
+		balance, err := parseAmount("balance", aux.Balance)
+		if err != nil {
+			return err
+		}
+		a.Balance = balance
+		a.balanceSet = true
+	}
+	var err error
+	a.MinimumBalance, err = parseOptionalAmount("minimum_balance", aux.MinimumBalance)
+	return err
+}
+
+func (s *UserSettings) UnmarshalJSON(data []byte) error {
+	type plain UserSettings
+	aux := struct {
+		*plain
+		ThresholdAmount json.RawMessage `json:"threshold_amount"`
+	}{plain: (*plain)(s)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	var err error
+	s.ThresholdAmount, err = parseOptionalAmount("threshold_amount", aux.ThresholdAmount)
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	for _, c := range []struct {
+		raw  string
+		want float64
+		ok   bool
+	}{
+		{`50`, 50, true},
+		{`12.34`, 12.34, true},
+		{`-0.5`, -0.5, true},
+		{`1.10`, 1.1, true},
+		{`5e1`, 50, true},
+		{`1.25E2`, 125, true},
+		{`1234e-2`, 12.34, true},
+		{`"50"`, 0, false},
+		{`null`, 0, false},
+		{`true`, 0, false},
+		{`12.345`, 0, false},
+		{`0.001`, 0, false},
+		{`1e-3`, 0, false},
+		{`1e400`, 0, false},
+	} {
+		got, err := parseAmount("amount", json.RawMessage(c.raw))
+		if c.ok && (err != nil || got != c.want) {
+			t.Errorf("parseAmount(%s) = %v, %v; want %v", c.raw, got, err, c.want)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("parseAmount(%s) = %v; want an error", c.raw, got)
+		}
+	}
+}
+
+func TestAmountFieldsAreStrict(t *testing.T) {
+	useTestDB(t)
+
+	post := func(path, body string) (int, string) {
+		t.Helper()
+		rr := callAuthed(http.MethodPost, path, json.RawMessage(body))
+		return rr.Code, rr.Body.String()
+	}
+	expense := func(amount string) string {
+		return fmt.Sprintf(`{"amount": %s, "category": "Food", "date": "2024-06-01", "account_id": %d}`, amount, testAccountID)
+	}
+
+	for _, amount := range []string{`"50"`, `null`, `12.345`, `1e-3`, `1e400`} {
+		code, body := post("/expenses", expense(amount))
+		if code != http.StatusBadRequest || !strings.Contains(body, "amount must be a number") {
+			t.Errorf("amount %s: expected a 400 naming the field, got %d %s", amount, code, body)
+		}
+	}
+	code, body := post("/expenses", expense(`5e1`))
+	if code != http.StatusCreated || !strings.Contains(body, `"amount":50`) {
+		t.Fatalf("expected exponent notation accepted, got %d %s", code, body)
+	}
+
+	// A NaN literal is not JSON at all, so it never reaches parseAmount.
+	req := httptest.NewRequest(http.MethodPost, "/expenses", strings.NewReader(expense("NaN")))
+	req.AddCookie(testSessionCookie)
+	req.Header.Set("Content-Type", "application/json")
+	expectStatus(t, serve(req), http.StatusBadRequest)
+
+	for _, c := range []struct{ path, body, field string }{
+		{"/incomes", fmt.Sprintf(`{"amount": "100", "source": "Salary", "date": "2024-06-01", "account_id": %d}`, testAccountID), "amount"},
+		{"/budgets", `{"category": "Food", "amount": 10.001, "start_date": "2024-06-01", "end_date": "2024-06-30"}`, "amount"},
+		{"/recurring-expenses", `{"amount": null, "category": "Rent", "frequency": "monthly", "next_due_date": "2024-06-01"}`, "amount"},
+		{"/accounts", `{"name": "Savings", "type": "bank", "balance": "10"}`, "balance"},
+		{"/accounts", `{"name": "Savings", "type": "bank", "minimum_balance": 1.005}`, "minimum_balance"},
+		{"/expenses", fmt.Sprintf(`{"amount": 10, "category": "Food", "date": "2024-06-01", "account_id": %d, "splits": [{"category": "Food", "amount": "10"}]}`, testAccountID), "split amount"},
+	} {
+		code, body := post(c.path, c.body)
+		if code != http.StatusBadRequest || !strings.Contains(body, c.field+" must be a number") {
+			t.Errorf("%s %s: expected a 400 naming %s, got %d %s", c.path, c.body, c.field, code, body)
+		}
+	}
+
+	// null still clears optional amounts.
+	code, body = post("/accounts", `{"name": "Savings", "type": "bank", "balance": 0, "minimum_balance": null}`)
+	if code != http.StatusCreated {
+		t.Fatalf("expected a null minimum_balance accepted, got %d %s", code, body)
+	}
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", json.RawMessage(`{"threshold_amount": "5"}`)), http.StatusBadRequest)
+}
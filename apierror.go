@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// apiError is the JSON body of every error response that has one: a
+// message for people and a code for programs to switch on. Errors that
+// carry more, such as how long to wait or how far an account is short,
+// embed it so the two fields are always there and always spelled alike.
+type apiError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// writeJSONError writes status with body, an apiError or a type embedding
+// one. Headers such as Retry-After must be set before it is called.
+func writeJSONError(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeAPIError writes status with an apiError carrying code and message.
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSONError(w, status, apiError{Error: message, Code: code})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// App is one instance of the server: its database and configuration, the
+// state kept per user of that database, and the routes serving it. Apps
+// share nothing, so tests or an embedding program can run several side by
+// side, each on its own database and Config. Only bcryptCost, which tunes
+// the process as a whole, is still a package variable set by main.
+type App struct {
+	db  *sql.DB
+	cfg Config
+	// dbtx is db as handlers reach it through DBTX; tests swap in one that
+	// fails on demand.
+	dbtx    DBTX
+	dialect sqlDialect
+	// trustedProxies is cfg.TrustedProxies parsed.
+	trustedProxies []netip.Prefix
+
+	// User IDs are only unique within one database, so rate limit buckets
+	// and cached reports are kept per App.
+	rateLimiter *rateLimiter
+	reportCache *reportCacheStore
+	// recurringLocks holds a *sync.Mutex per user so the background job
+	// and manual triggers never process the same user's items concurrently.
+	recurringLocks sync.Map
+	// webhookWake has room for one wake-up, which is all a busy dispatcher
+	// needs: it drains everything due each time it runs.
+	webhookWake chan struct{}
+	// now is the clock cfg.BalanceEditSunset is checked against; tests
+	// set it.
+	now func() time.Time
+	// store returns where the expense and account handlers keep their
+	// rows, running its statements through q, usually the handler's
+	// transaction.
+	store func(q txQuerier) Store
+
+	handler http.Handler
+}
+
+// NewApp returns an App serving db, which must have been opened with
+// openDatabase(cfg) so its queries keep cfg's timeouts. Run migrate before
+// serving a new database.
+func NewApp(db *sql.DB, cfg Config) *App {
+	app := &App{
+		db:          db,
+		cfg:         cfg,
+		dbtx:        sqlDB{db},
+		dialect:     sqliteDialect{},
+		rateLimiter: newRateLimiter(),
+		reportCache: newReportCache(),
+		webhookWake: make(chan struct{}, 1),
+		now:         time.Now,
+		store:       newSQLStore,
+	}
+	if cfg.DBDriver == dbDriverPostgres {
+		app.dialect = postgresDialect{}
+	}
+	// Config.validate rejects a list that does not parse.
+	app.trustedProxies, _ = parseTrustedProxies(cfg.TrustedProxies)
+	app.handler = app.routes()
+	return app
+}
+
+func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.handler.ServeHTTP(w, r)
+}
+
+// migrate creates the tables and brings older databases up to date.
+func (app *App) migrate() error {
+	if err := app.createTables(); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	if err := app.ensureAccountColumns(); err != nil {
+		return fmt.Errorf("failed to migrate database (accounts): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAppsAreIsolated(t *testing.T) {
+	useTestDB(t)
+	first, firstCookie, firstUser := testApp, testSessionCookie, testUserID
+	useTestDB(t)
+	second := testApp
+	if testUserID != firstUser {
+		t.Fatalf("expected both databases to number their users alike, got %d and %d", firstUser, testUserID)
+	}
+
+	call := func(app *App, cookie *http.Cookie, method, target string, payload interface{}) *httptest.ResponseRecorder {
+		req := authedRequest(method, target, payload)
+		req.Header.Del("Cookie")
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, req)
+		return rr
+	}
+	stats := func(app *App, cookie *http.Cookie) ExpenseStats {
+		t.Helper()
+		rr := call(app, cookie, http.MethodGet, "/expenses/stats", nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[ExpenseStats](t, rr)
+	}
+
+	// The first App caches its user's empty stats; the same user ID in
+	// the second gets its own.
+	if s := stats(first, firstCookie); s.Count != 0 {
+		t.Fatalf("expected no expenses yet, got %+v", s)
+	}
+	expectStatus(t, call(second, testSessionCookie, http.MethodPost, "/expenses", Expense{Amount: 25, Category: "Food", AccountID: testAccount()}), http.StatusCreated)
+	if s := stats(second, testSessionCookie); s.Count != 1 || s.Total != 25 {
+		t.Fatalf("expected the second App's expense, got %+v", s)
+	}
+	if s := stats(first, firstCookie); s.Count != 0 {
+		t.Fatalf("expected the first App not to see the second's expense, got %+v", s)
+	}
+
+	// Sessions belong to the database that issued them.
+	expectStatus(t, call(second, firstCookie, http.MethodGet, "/expenses", nil), http.StatusUnauthorized)
+}
+
+func TestAppsKeepTheirOwnConfig(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxExpensesPerUser, cfg.AdminToken = 1, "first-secret"
+	useTestDBConfig(t, cfg)
+	first, firstCookie := testApp, testSessionCookie
+	cfg.MaxExpensesPerUser, cfg.AdminToken = 0, "second-secret"
+	useTestDBConfig(t, cfg)
+	second := testApp
+
+	call := func(app *App, cookie *http.Cookie, method, target string, payload interface{}) *httptest.ResponseRecorder {
+		req := authedRequest(method, target, payload)
+		req.Header.Del("Cookie")
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, req)
+		return rr
+	}
+	expense := Expense{Amount: 5, Category: "Food", AccountID: testAccount()}
+	for i := 0; i < 2; i++ {
+		expectStatus(t, call(second, testSessionCookie, http.MethodPost, "/expenses", expense), http.StatusCreated)
+	}
+	expectStatus(t, call(first, firstCookie, http.MethodPost, "/expenses", expense), http.StatusCreated)
+	expectStatus(t, call(first, firstCookie, http.MethodPost, "/expenses", expense), http.StatusForbidden)
+
+	admin := func(app *App, token string) int {
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/admin/users/%d/quota-exemption", testUserID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if got := admin(first, "second-secret"); got != http.StatusUnauthorized {
+		t.Fatalf("expected the second App's token to be refused by the first, got %d", got)
+	}
+	if got := admin(first, "first-secret"); got != http.StatusNoContent {
+		t.Fatalf("expected the first App's own token to work, got %d", got)
+	}
+	expectStatus(t, call(first, firstCookie, http.MethodPost, "/expenses", expense), http.StatusCreated)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	auditEntityExpense          = "expense"
+	auditEntityIncome           = "income"
+	auditEntityBudget           = "budget"
+	auditEntityAccount          = "account"
+	auditEntityRecurringExpense = "recurring_expense"
+
+	auditActionCreate = "create"
+	auditActionUpdate = "update"
+	auditActionDelete = "delete"
+
+	maxAuditNoteLength = 200
+)
+
+type AuditEntry struct {
+	ID         int             `json:"id"`
+	EntityType string          `json:"entity_type"`
+	EntityID   int             `json:"entity_id"`
+	Action     string          `json:"action"`
+	Old        json.RawMessage `json:"old"`
+	New        json.RawMessage `json:"new"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UserID     int             `json:"-"`
+}
+
+// recordAudit writes a single audit_log row inside tx. oldValue is nil for
+// creates and newValue is nil for deletes.
+func recordAudit(tx txQuerier, userID int, entityType string, entityID int, action string, oldValue, newValue interface{}) error {
+	oldData, err := auditPayload(oldValue)
+	if err != nil {
+		return fmt.Errorf("encode old %s: %w", entityType, err)
+	}
+	newData, err := auditPayload(newValue)
+	if err != nil {
+		return fmt.Errorf("encode new %s: %w", entityType, err)
+	}
+
+	_, err = tx.Exec("INSERT INTO audit_log(user_id, entity_type, entity_id, action, old_data, new_data, created_at) VALUES(?, ?, ?, ?, ?, ?, ?)",
+		userID, entityType, entityID, action, oldData, newData, time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// auditPayload encodes v as JSON with any "note" field truncated so a single
+// oversized note can't bloat the log.
+func auditPayload(v interface{}) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return sql.NullString{}, err
+	}
+	if note, ok := fields["note"].(string); ok {
+		fields["note"] = truncateRunes(note, maxAuditNoteLength)
+	}
+
+	raw, err = json.Marshal(fields)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(raw), Valid: true}, nil
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max]) + "…"
+}
+
+func isValidAuditEntityType(entityType string) bool {
+	switch entityType {
+	case auditEntityExpense, auditEntityIncome, auditEntityBudget, auditEntityAccount, auditEntityRecurringExpense:
+		return true
+	default:
+		return false
+	}
+}
+
+func (app *App) auditLogHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	query := "SELECT id, entity_type, entity_id, action, old_data, new_data, created_at FROM audit_log WHERE user_id = ?"
+	args := []interface{}{userID}
+
+	params := r.URL.Query()
+
+	if entityType := strings.TrimSpace(params.Get("entity_type")); entityType != "" {
+		if !isValidAuditEntityType(entityType) {
+			http.Error(w, "Invalid entity type", http.StatusBadRequest)
+			return
+		}
+		query += " AND entity_type = ?"
+		args = append(args, entityType)
+	}
+	if entityIDStr := strings.TrimSpace(params.Get("entity_id")); entityIDStr != "" {
+		entityID, err := strconv.Atoi(entityIDStr)
+		if err != nil || entityID <= 0 {
+			http.Error(w, "Invalid entity ID", http.StatusBadRequest)
+			return
+		}
+		query += " AND entity_id = ?"
+		args = append(args, entityID)
+	}
+	if action := strings.TrimSpace(params.Get("action")); action != "" {
+		switch action {
+		case auditActionCreate, auditActionUpdate, auditActionDelete:
+		default:
+			http.Error(w, "Invalid action", http.StatusBadRequest)
+			return
+		}
+		query += " AND action = ?"
+		args = append(args, action)
+	}
+
+	limit, offset, ok := parsePagination(w, params)
+	if !ok {
+		return
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := app.requestDB(r).Query(query, args...)
+	if err != nil {
+		log.Printf("audit log query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var oldData, newData sql.NullString
+		var createdAtStr string
+		if err := rows.Scan(&entry.ID, &entry.EntityType, &entry.EntityID, &entry.Action, &oldData, &newData, &createdAtStr); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		createdAt, err := parseTimestamp(createdAtStr)
+		if err != nil {
+			log.Printf("audit log timestamp parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if oldData.Valid {
+			entry.Old = json.RawMessage(oldData.String)
+		}
+		if newData.Valid {
+			entry.New = json.RawMessage(newData.String)
+		}
+		entry.CreatedAt = createdAt
+		entry.UserID = userID
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONList(w, entries)
+}
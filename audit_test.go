@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLogRecordsChanges(t *testing.T) {
+	useTestDB(t)
+
+	expense := Expense{
+		Amount:    20,
+		Category:  "Food",
+		Note:      strings.Repeat("n", maxAuditNoteLength+50),
+		Date:      time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		AccountID: testAccount(),
+	}
+	createRR := callAuthed(http.MethodPost, "/expenses", expense)
+	expectStatus(t, createRR, http.StatusCreated)
+	created := decodeBody[Expense](t, createRR)
+
+	expense.Amount = 25
+	updateRR := callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", created.ID), expense)
+	expectStatus(t, updateRR, http.StatusOK)
+
+	deleteRR := callAuthed(http.MethodDelete, fmt.Sprintf("/expenses/%d", created.ID), nil)
+	expectStatus(t, deleteRR, http.StatusNoContent)
+
+	logRR := callAuthed(http.MethodGet, fmt.Sprintf("/audit-log?entity_type=expense&entity_id=%d", created.ID), nil)
+	expectStatus(t, logRR, http.StatusOK)
+	entries := decodeBody[[]AuditEntry](t, logRR)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d", len(entries))
+	}
+
+	wantActions := []string{auditActionDelete, auditActionUpdate, auditActionCreate}
+	for i, want := range wantActions {
+		if entries[i].Action != want {
+			t.Fatalf("entry %d: expected action %s got %s", i, want, entries[i].Action)
+		}
+	}
+
+	if string(entries[2].Old) != "null" {
+		t.Fatalf("expected no old payload on create, got %s", entries[2].Old)
+	}
+	if string(entries[0].New) != "null" {
+		t.Fatalf("expected no new payload on delete, got %s", entries[0].New)
+	}
+
+	var updatedPayload Expense
+	if err := json.Unmarshal(entries[1].New, &updatedPayload); err != nil {
+		t.Fatalf("decode audit payload: %v", err)
+	}
+	if updatedPayload.Amount != 25 {
+		t.Fatalf("expected audited amount 25 got %.2f", updatedPayload.Amount)
+	}
+	if got := len([]rune(updatedPayload.Note)); got != maxAuditNoteLength+1 {
+		t.Fatalf("expected note truncated to %d runes, got %d", maxAuditNoteLength+1, got)
+	}
+}
+
+func TestAuditLogRejectsUnknownEntityType(t *testing.T) {
+	useTestDB(t)
+
+	rr := callAuthed(http.MethodGet, "/audit-log?entity_type=users", nil)
+	expectStatus(t, rr, http.StatusBadRequest)
+}
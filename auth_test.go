@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnauthorizedResponses(t *testing.T) {
+	useTestDB(t)
+
+	expired, _, err := generateSessionToken()
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if _, err := testApp.db.Exec("INSERT INTO sessions(token_hash, user_id, expires_at) VALUES(?, ?, ?)", hashSessionToken(expired), testUserID, time.Now().UTC().Add(-time.Hour).Format(timeFormat)); err != nil {
+		t.Fatalf("seed expired session: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		cookie *http.Cookie
+		code   string
+	}{
+		{"no cookie", nil, authErrorMissingSession},
+		{"unknown token", &http.Cookie{Name: sessionCookieName, Value: "not-a-session"}, authErrorInvalidSession},
+		{"expired session", &http.Cookie{Name: sessionCookieName, Value: expired}, authErrorSessionExpired},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/expenses", nil)
+		if tc.cookie != nil {
+			req.AddCookie(tc.cookie)
+		}
+		rr := serve(req)
+
+		expectStatus(t, rr, http.StatusUnauthorized)
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected JSON content type, got %q", tc.name, ct)
+		}
+		if hint := rr.Header().Get("WWW-Authenticate"); !strings.Contains(hint, tc.code) {
+			t.Errorf("%s: expected WWW-Authenticate to mention %s, got %q", tc.name, tc.code, hint)
+		}
+		if body := decodeBody[apiError](t, rr); body.Code != tc.code {
+			t.Errorf("%s: expected code %s, got %+v", tc.name, tc.code, body)
+		}
+		if tc.cookie != nil && !strings.Contains(rr.Header().Get("Set-Cookie"), "Max-Age=0") {
+			t.Errorf("%s: expected session cookie to be cleared", tc.name)
+		}
+	}
+}
+
+func TestPurgeExpiredSessions(t *testing.T) {
+	useTestDB(t)
+
+	now := time.Now().UTC()
+	for i, expiresAt := range []time.Time{now.Add(-48 * time.Hour), now.Add(-time.Minute)} {
+		if _, err := testApp.db.Exec("INSERT INTO sessions(token_hash, user_id, expires_at) VALUES(?, ?, ?)", fmt.Sprintf("expired-%d", i), testUserID, expiresAt.Format(timeFormat)); err != nil {
+			t.Fatalf("seed expired session: %v", err)
+		}
+	}
+
+	testApp.purgeExpiredSessions()
+
+	var expired, live int
+	testApp.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE token_hash LIKE 'expired-%'").Scan(&expired)
+	testApp.db.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&live)
+	if expired != 0 || live != 1 {
+		t.Fatalf("expected only the live test session to remain, got %d expired and %d total", expired, live)
+	}
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses", nil), http.StatusOK)
+}
+
+func TestSessionCapEvictsOldest(t *testing.T) {
+	useTestDB(t)
+	const email, password = "devices@example.com", "ManyDevicesPass123!"
+	first, userID := registerUser(t, email, password)
+
+	// Fill up to the cap with sessions that expire sooner than a new login's,
+	// the earliest one being the eviction candidate.
+	now := time.Now().UTC()
+	for i := 1; i < maxSessionsPerUser; i++ {
+		if _, err := testApp.db.Exec("INSERT INTO sessions(token_hash, user_id, expires_at) VALUES(?, ?, ?)", fmt.Sprintf("device-%d", i), userID, now.Add(time.Duration(i)*time.Hour).Format(timeFormat)); err != nil {
+			t.Fatalf("seed session: %v", err)
+		}
+	}
+
+	body, _ := json.Marshal(credentials{Email: email, Password: password})
+	expectStatus(t, serve(httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body))), http.StatusOK)
+
+	var total, oldest int
+	testApp.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = ?", userID).Scan(&total)
+	testApp.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE token_hash = 'device-1'").Scan(&oldest)
+	if total != maxSessionsPerUser || oldest != 0 {
+		t.Fatalf("expected %d sessions without the oldest, got %d (oldest present: %d)", maxSessionsPerUser, total, oldest)
+	}
+	// Logging in elsewhere no longer signs out the other devices.
+	expectStatus(t, callAuthedAs(first, http.MethodGet, "/expenses", nil), http.StatusOK)
+}
+
+// TestLoginComparesHashForUnknownEmail checks that an unknown email costs a
+// bcrypt comparison just like a wrong password, so timing does not reveal
+// which emails are registered.
+func TestLoginComparesHashForUnknownEmail(t *testing.T) {
+	useTestDB(t)
+	registerUser(t, "known@example.com", "KnownUserPass123!")
+
+	compared := 0
+	prev := comparePassword
+	comparePassword = func(hash, password []byte) error {
+		compared++
+		return prev(hash, password)
+	}
+	t.Cleanup(func() { comparePassword = prev })
+
+	for _, email := range []string{"known@example.com", "unknown@example.com"} {
+		compared = 0
+		body, _ := json.Marshal(credentials{Email: email, Password: "WrongPassword123!"})
+		rr := serve(httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body)))
+		expectStatus(t, rr, http.StatusUnauthorized)
+		if got := strings.TrimSpace(rr.Body.String()); got != "Invalid credentials" {
+			t.Fatalf("%s: expected the generic error, got %q", email, got)
+		}
+		if compared != 1 {
+			t.Fatalf("%s: expected one hash comparison, got %d", email, compared)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotPrefix     = "expenses-"
+	snapshotSuffix     = ".db"
+	snapshotTimeFormat = "20060102-150405"
+)
+
+var errBackupUnsupported = errors.New("backups are only supported for SQLite; use pg_dump for Postgres")
+
+// withAdminToken lets a request through only when it carries
+// "Authorization: Bearer <ADMIN_TOKEN>". The /admin routes answer 404 while
+// cfg.AdminToken is empty.
+func (app *App) withAdminToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.cfg.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(app.cfg.AdminToken)) != 1 {
+			log.Printf("rejected admin request for %s from %s", r.URL.Path, app.clientIP(r))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// snapshotDatabase writes a consistent copy of the database to path, which
+// must not exist yet. VACUUM INTO reads within a single transaction, so
+// writes that land while it runs are either wholly in the copy or not at
+// all, unlike copying the file.
+func (app *App) snapshotDatabase(path string) error {
+	if _, ok := app.dialect.(sqliteDialect); !ok {
+		return errBackupUnsupported
+	}
+	_, err := app.db.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// backupHandler streams a fresh snapshot of the whole database as a
+// download.
+func (app *App) backupHandler(w http.ResponseWriter, r *http.Request) {
+	dir, err := os.MkdirTemp("", "expense-tracker-backup")
+	if err != nil {
+		log.Printf("backup temp dir error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "snapshot.db")
+	if err := app.snapshotDatabase(path); errors.Is(err, errBackupUnsupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		log.Printf("backup snapshot error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("backup open error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("backup stat error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Backup downloaded by %s", app.clientIP(r))
+	name := snapshotPrefix + time.Now().UTC().Format(snapshotTimeFormat) + snapshotSuffix
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("backup stream error: %v", err)
+	}
+}
+
+// writeSnapshot saves a timestamped snapshot into dir and then deletes all
+// but the newest keep snapshots there. The snapshot is written under a
+// temporary name first so a crash never leaves a partial file that looks
+// like a backup.
+func (app *App) writeSnapshot(dir string, keep int, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, snapshotPrefix+now.UTC().Format(snapshotTimeFormat)+snapshotSuffix)
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := app.snapshotDatabase(tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, pruneSnapshots(dir, keep)
+}
+
+// pruneSnapshots deletes all but the newest keep snapshots in dir. The
+// timestamp in the name sorts chronologically, so no file times are used.
+func pruneSnapshots(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// runScheduledBackup is the body of the backup job.
+func (app *App) runScheduledBackup(dir string, keep int) {
+	path, err := app.writeSnapshot(dir, keep, time.Now())
+	if err != nil {
+		log.Printf("scheduled backup error: %v", err)
+		return
+	}
+	log.Printf("Wrote backup %s", path)
+}
+
+// restoreSnapshot replaces the SQLite database at dbPath with the snapshot
+// at snapshotPath. Stop the server first: open connections would keep using
+// the old file. The snapshot is checked with PRAGMA integrity_check before
+// anything is touched, copied next to dbPath and renamed over it, so a
+// failure part-way leaves the old database in place. The old database's
+// -wal and -shm files are removed so SQLite does not replay them onto the
+// restored copy.
+func restoreSnapshot(snapshotPath, dbPath string) error {
+	if err := checkSnapshot(snapshotPath); err != nil {
+		return fmt.Errorf("snapshot %s: %w", snapshotPath, err)
+	}
+
+	src, err := os.Open(snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := dbPath + ".restore"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, dbPath)
+}
+
+func checkSnapshot(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// snapshotTotals reads the test account's balance and the sum of its
+// expenses from a snapshot file.
+func snapshotTotals(t *testing.T, path string) (balance, spent float64) {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatalf("open snapshot: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.QueryRow("SELECT balance FROM accounts WHERE id = ?", testAccountID).Scan(&balance); err != nil {
+		t.Fatalf("read snapshot balance: %v", err)
+	}
+	if err := conn.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM expenses WHERE account_id = ?", testAccountID).Scan(&spent); err != nil {
+		t.Fatalf("read snapshot expenses: %v", err)
+	}
+	return balance, spent
+}
+
+func TestBackupEndpoint(t *testing.T) {
+	useTestDB(t)
+	backup := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/backup", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return serve(req)
+	}
+
+	testApp.cfg.AdminToken = ""
+	expectStatus(t, backup("anything"), http.StatusNotFound)
+
+	testApp.cfg.AdminToken = "backup-secret"
+	expectStatus(t, backup(""), http.StatusUnauthorized)
+	expectStatus(t, backup("wrong"), http.StatusUnauthorized)
+	// A user session is not enough.
+	expectStatus(t, callAuthed(http.MethodGet, "/admin/backup", nil), http.StatusUnauthorized)
+
+	start := decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", testAccountID), nil)).Balance
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 12.5, Category: "Food", Date: time.Now().UTC(), AccountID: testAccount()}), http.StatusCreated)
+
+	rr := backup("backup-secret")
+	expectStatus(t, rr, http.StatusOK)
+	if disposition := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, `attachment; filename="expenses-`) {
+		t.Fatalf("expected a download, got Content-Disposition %q", disposition)
+	}
+	path := filepath.Join(t.TempDir(), "download.db")
+	if err := os.WriteFile(path, rr.Body.Bytes(), 0o600); err != nil {
+		t.Fatalf("save download: %v", err)
+	}
+	if balance, spent := snapshotTotals(t, path); spent != 12.5 || balance != start-12.5 {
+		t.Fatalf("expected the expense and balance in the backup, got balance %.2f spent %.2f", balance, spent)
+	}
+}
+
+// TestSnapshotConsistentDuringWrites takes snapshots while expenses are being
+// added; every snapshot must show a balance that matches its expenses.
+func TestSnapshotConsistentDuringWrites(t *testing.T) {
+	useTestDB(t)
+
+	start := decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", testAccountID), nil)).Balance
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			callAuthed(http.MethodPost, "/expenses", Expense{Amount: 1, Category: "Food", Date: time.Now().UTC(), AccountID: testAccount()})
+		}
+	}()
+
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("snapshot-%d.db", i))
+		if err := testApp.snapshotDatabase(path); err != nil {
+			close(done)
+			wg.Wait()
+			t.Fatalf("snapshot: %v", err)
+		}
+		if balance, spent := snapshotTotals(t, path); balance != start-spent {
+			close(done)
+			wg.Wait()
+			t.Fatalf("snapshot %d is inconsistent: balance %.2f, start %.2f, spent %.2f", i, balance, start, spent)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestScheduledSnapshotsAndRestore(t *testing.T) {
+	useTestDB(t)
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	base := time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC)
+	var paths []string
+	for i := 0; i < 4; i++ {
+		path, err := testApp.writeSnapshot(dir, 2, base.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("write snapshot %d: %v", i, err)
+		}
+		paths = append(paths, path)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read backup dir: %v", err)
+	}
+	var kept []string
+	for _, e := range entries {
+		kept = append(kept, e.Name())
+	}
+	if want := []string{"expenses-20240301-040000.db", "expenses-20240301-050000.db"}; strings.Join(kept, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected the newest two snapshots %v, got %v", want, kept)
+	}
+
+	// Restoring over a database replaces its contents with the snapshot's.
+	target := filepath.Join(t.TempDir(), "restored.db")
+	if err := os.WriteFile(target, []byte("old contents"), 0o600); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+	if err := restoreSnapshot(paths[3], target); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	wantBalance, wantSpent := snapshotTotals(t, paths[3])
+	if balance, spent := snapshotTotals(t, target); balance != wantBalance || spent != wantSpent {
+		t.Fatalf("expected the restored database to match the snapshot, got balance %.2f spent %.2f", balance, spent)
+	}
+
+	garbage := filepath.Join(t.TempDir(), "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database"), 0o600); err != nil {
+		t.Fatalf("write garbage: %v", err)
+	}
+	if err := restoreSnapshot(garbage, target); err == nil {
+		t.Fatal("expected a corrupt snapshot to be rejected")
+	}
+	if err := restoreSnapshot(filepath.Join(dir, "missing.db"), target); err == nil {
+		t.Fatal("expected a missing snapshot to be rejected")
+	}
+	if err := checkSnapshot(target); err != nil {
+		t.Fatalf("expected a failed restore to leave the database alone: %v", err)
+	}
+}
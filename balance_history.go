@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Every change to an account's balance is recorded in balance_history with
+// the balance it left, so the balance can be charted over time. History
+// starts when an account is created, or for older accounts with their first
+// change after the table was added.
+
+// Reasons a balance changed.
+const (
+	balanceReasonOpening    = "opening"    // the account was created
+	balanceReasonExpense    = "expense"    // an expense was added, changed, moved, or removed
+	balanceReasonIncome     = "income"     // likewise for an income
+	balanceReasonAdjustment = "adjustment" // the balance was adjusted or set by hand
+)
+
+const (
+	// autoDayHistoryDays is the longest range served day by day when
+	// granularity is left out; longer ones are served by month.
+	autoDayHistoryDays = 92
+	// maxDayHistoryDays is the longest range granularity=day may cover.
+	maxDayHistoryDays = 366
+)
+
+// BalanceHistory is an account's balance at the end of each day or month of
+// a range, oldest first. Periods before the first recorded balance are left
+// out; after it, a period without changes repeats the balance before it.
+type BalanceHistory struct {
+	AccountID   int            `json:"account_id"`
+	Granularity string         `json:"granularity"`
+	Points      []BalancePoint `json:"points"`
+}
+
+// BalancePoint is the balance at the end of one period. Date is the day
+// (YYYY-MM-DD) or month (YYYY-MM).
+type BalancePoint struct {
+	Date    string  `json:"date"`
+	Balance float64 `json:"balance"`
+}
+
+var balanceHistoryPeriods = map[string]reportPeriod{
+	"day": {
+		start: truncateToDay,
+		next:  func(start time.Time) time.Time { return start.AddDate(0, 0, 1) },
+		label: func(start time.Time) string { return start.Format(statsDateFormat) },
+	},
+	"month": reportPeriods["month"],
+}
+
+func (app *App) createBalanceHistoryTables() error {
+	historyTableStmt := `
+    CREATE TABLE IF NOT EXISTS balance_history (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        account_id INTEGER NOT NULL,
+        balance REAL NOT NULL,
+        delta REAL NOT NULL,
+        reason TEXT NOT NULL,
+        recorded_at DATETIME NOT NULL,
+        FOREIGN KEY(account_id) REFERENCES accounts(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(historyTableStmt)); err != nil {
+		return fmt.Errorf("create balance_history table: %w", err)
+	}
+	// Adjustments made through POST /accounts/{id}/adjust carry a note.
+	if err := app.ensureColumn("balance_history", "note", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_balance_history_account ON balance_history(account_id, recorded_at)"); err != nil {
+		return fmt.Errorf("create balance_history index: %w", err)
+	}
+	return nil
+}
+
+// recordBalance adds an entry for accountID with the balance it now holds,
+// after a change of delta for reason. Callers make the change first, in the
+// same transaction.
+func recordBalance(tx txQuerier, userID, accountID int, delta float64, reason, now string) error {
+	_, err := tx.Exec("INSERT INTO balance_history(account_id, balance, delta, reason, recorded_at) SELECT id, balance, ?, ?, ? FROM accounts WHERE id = ? AND "+householdScope,
+		delta, reason, now, accountID, userID, userID)
+	if err != nil {
+		return fmt.Errorf("record balance history: %w", err)
+	}
+	return nil
+}
+
+// balanceHistoryHandler serves GET /accounts/{id}/history. date_from and
+// date_to are inclusive days in the user's timezone, defaulting to the
+// first recorded balance and today. granularity is day or month; left out,
+// it is day for ranges up to autoDayHistoryDays and month beyond.
+func (app *App) balanceHistoryHandler(w http.ResponseWriter, r *http.Request, userID, id int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "granularity", "date_from", "date_to") {
+		return
+	}
+	granularity, ok := parseEnumParam(w, params, "granularity", "day", "month")
+	if !ok {
+		return
+	}
+
+	q := app.requestDB(r)
+	if _, err := fetchAccount(q, userID, id); err == sql.ErrNoRows {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("account fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	to, ok := parseDayParam(w, params.Get("date_to"), "date_to", localDay(time.Now(), loc), loc)
+	if !ok {
+		return
+	}
+	from, ok := parseDayParam(w, params.Get("date_from"), "date_from", time.Time{}, loc)
+	if !ok {
+		return
+	}
+	if from.IsZero() {
+		// With nothing recorded yet the range is just to, which has no
+		// points.
+		from = to
+		var first sql.NullString
+		if err := q.QueryRow("SELECT MIN(recorded_at) FROM balance_history WHERE account_id = ?", id).Scan(&first); err != nil {
+			log.Printf("balance history query error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if first.Valid {
+			t, err := parseTimestamp(first.String)
+			if err != nil {
+				log.Printf("balance history date parse error: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			from = localDay(t, loc)
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "date_to must not be before date_from", http.StatusBadRequest)
+		return
+	}
+
+	days := int(to.Sub(from).Hours()/24) + 1
+	switch {
+	case granularity == "":
+		granularity = "day"
+		if days > autoDayHistoryDays {
+			granularity = "month"
+		}
+	case granularity == "day" && days > maxDayHistoryDays:
+		http.Error(w, "Invalid granularity; day covers at most "+strconv.Itoa(maxDayHistoryDays)+" days, use month", http.StatusBadRequest)
+		return
+	}
+
+	points, err := balancePoints(q, id, balanceHistoryPeriods[granularity], from, to, loc)
+	if err != nil {
+		log.Printf("balance history query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BalanceHistory{AccountID: id, Granularity: granularity, Points: points})
+}
+
+// balancePoints reads accountID's balance at the end of each period from
+// the one holding from to the one holding to, days in loc.
+func balancePoints(q querier, accountID int, period reportPeriod, from, to time.Time, loc *time.Location) ([]BalancePoint, error) {
+	start := period.start(from)
+	end := period.next(period.start(to))
+
+	// The balance carried into the range is the last one recorded before it.
+	var balance float64
+	known := true
+	err := q.QueryRow("SELECT balance FROM balance_history WHERE account_id = ? AND recorded_at < ? ORDER BY recorded_at DESC, id DESC LIMIT 1",
+		accountID, dayStart(start, loc)).Scan(&balance)
+	if err == sql.ErrNoRows {
+		known = false
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query("SELECT balance, recorded_at FROM balance_history WHERE account_id = ? AND recorded_at >= ? AND recorded_at < ? ORDER BY recorded_at, id",
+		accountID, dayStart(start, loc), dayStart(end, loc))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type entry struct {
+		day     time.Time
+		balance float64
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		var recordedAt string
+		if err := rows.Scan(&e.balance, &recordedAt); err != nil {
+			return nil, err
+		}
+		t, err := parseTimestamp(recordedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.day = localDay(t, loc)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	points := []BalancePoint{}
+	for t := start; t.Before(end); t = period.next(t) {
+		next := period.next(t)
+		for len(entries) > 0 && entries[0].day.Before(next) {
+			balance, known = entries[0].balance, true
+			entries = entries[1:]
+		}
+		if known {
+			points = append(points, BalancePoint{Date: period.label(t), Balance: roundCents(balance)})
+		}
+	}
+	return points, nil
+}
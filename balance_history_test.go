@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBalanceHistory(t *testing.T) {
+	useTestDB(t)
+	// The balance is set with PUT below, which needs the sunset still ahead.
+	now := time.Now()
+	testApp.now = func() time.Time { return now }
+	testApp.cfg.BalanceEditSunset = now.AddDate(0, 0, 1)
+	account := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Wallet", Type: "cash", Balance: 100}))
+	expense := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 30, Category: "Food", AccountID: &account.ID}))
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 50, Source: "Gift", AccountID: &account.ID}), http.StatusCreated)
+	expense.Amount = 40
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", expense.ID), expense), http.StatusOK)
+	account.Balance = 200
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/accounts/%d", account.ID), account), http.StatusOK)
+
+	// Each change is one entry, an amount edited in place included.
+	type entry struct {
+		reason         string
+		delta, balance float64
+	}
+	want := []entry{
+		{balanceReasonOpening, 100, 100},
+		{balanceReasonExpense, -30, 70},
+		{balanceReasonIncome, 50, 120},
+		{balanceReasonExpense, -10, 110},
+		{balanceReasonAdjustment, 90, 200},
+	}
+	rows, err := testApp.db.Query("SELECT id, reason, delta, balance FROM balance_history WHERE account_id = ? ORDER BY id", account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	var got []entry
+	for rows.Next() {
+		var id int
+		var e entry
+		if err := rows.Scan(&id, &e.reason, &e.delta, &e.balance); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		got = append(got, e)
+	}
+	rows.Close()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected entries %v, got %v", want, got)
+	}
+
+	history := func(query string) BalanceHistory {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d/history%s", account.ID, query), nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[BalanceHistory](t, rr)
+	}
+	today := time.Now().UTC()
+	day := func(offset int) string { return today.AddDate(0, 0, offset).Format(statsDateFormat) }
+	if h := history(""); h.Granularity != "day" || len(h.Points) != 1 || h.Points[0] != (BalancePoint{day(0), 200}) {
+		t.Fatalf("expected today's balance alone, got %+v", h)
+	}
+
+	// Spread the entries out: opening 100 days ago, the expense 3 days ago,
+	// and the rest today.
+	backdate := func(id, days int) {
+		t.Helper()
+		if _, err := testApp.db.Exec("UPDATE balance_history SET recorded_at = ? WHERE id = ?", today.AddDate(0, 0, -days).Format(timeFormat), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backdate(ids[0], 100)
+	backdate(ids[1], 3)
+
+	h := history("?date_from=" + day(-4))
+	wantPoints := []BalancePoint{{day(-4), 100}, {day(-3), 70}, {day(-2), 70}, {day(-1), 70}, {day(0), 200}}
+	if h.Granularity != "day" || fmt.Sprint(h.Points) != fmt.Sprint(wantPoints) {
+		t.Fatalf("expected %v by day, got %+v", wantPoints, h)
+	}
+
+	// From the first entry, 100 days is served by month.
+	h = history("")
+	if h.Granularity != "month" || len(h.Points) < 4 {
+		t.Fatalf("expected a monthly series, got %+v", h)
+	}
+	if first, last := h.Points[0], h.Points[len(h.Points)-1]; first.Date != today.AddDate(0, 0, -100).Format("2006-01") || first.Balance != 100 || last.Balance != 200 {
+		t.Fatalf("expected months from 100 at the opening to 200 now, got %+v", h.Points)
+	}
+	if h := history("?granularity=day"); len(h.Points) != 101 {
+		t.Fatalf("expected 101 days when asked for, got %d", len(h.Points))
+	}
+
+	// Before the first entry there is nothing to show.
+	if h := history(fmt.Sprintf("?date_from=%s&date_to=%s", day(-120), day(-110))); len(h.Points) != 0 {
+		t.Fatalf("expected no points before the account existed, got %+v", h.Points)
+	}
+
+	for _, query := range []string{"?granularity=week", "?granularity=day&date_from=2020-01-01", "?date_from=" + day(1) + "&date_to=" + day(0)} {
+		expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d/history%s", account.ID, query), nil), http.StatusBadRequest)
+	}
+	expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d/history", account.ID+1000), nil), http.StatusNotFound)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// A budget's period_type says how its window is measured. A one_off budget
+// is one allowance for the whole window. A weekly or monthly one repeats its
+// amount each week or calendar month inside the window, so a year-long
+// weekly grocery budget is checked against this week's spending only. Weeks
+// and months are laid out in the user's timezone, with weeks starting on
+// their week_start setting; the first and last instances are cut short by
+// the window's own start and end.
+const (
+	budgetPeriodTypeOneOff  = "one_off"
+	budgetPeriodTypeWeekly  = "weekly"
+	budgetPeriodTypeMonthly = "monthly"
+)
+
+// normalizeBudgetPeriodType lower-cases the period type, defaulting it to
+// one_off, and checks it against the supported values.
+func normalizeBudgetPeriodType(b *Budget) error {
+	b.PeriodType = strings.ToLower(strings.TrimSpace(b.PeriodType))
+	switch b.PeriodType {
+	case "":
+		b.PeriodType = budgetPeriodTypeOneOff
+	case budgetPeriodTypeOneOff, budgetPeriodTypeWeekly, budgetPeriodTypeMonthly:
+	default:
+		return errors.New("Invalid period_type; use one of one_off, weekly, monthly")
+	}
+	return nil
+}
+
+// budgetCalendar is how a user's budget instances are laid out: the zone
+// days are read in and the day weeks start on.
+type budgetCalendar struct {
+	loc       *time.Location
+	weekStart time.Weekday
+}
+
+// loadBudgetCalendar reads userID's calendar from their settings.
+func loadBudgetCalendar(q rowQuerier, userID int) (budgetCalendar, error) {
+	settings, err := loadUserSettings(q, userID)
+	if err != nil {
+		return budgetCalendar{}, err
+	}
+	loc, err := loadLocation(settings.Timezone)
+	if err != nil {
+		return budgetCalendar{}, err
+	}
+	return budgetCalendar{loc: loc, weekStart: weekStarts[settings.WeekStart]}, nil
+}
+
+// budgetInstance returns the first and last instants of the instance of b
+// holding at, both inclusive. Before the window it is the first instance
+// and after it the last; a one_off budget's only instance is its window.
+func budgetInstance(b Budget, at time.Time, cal budgetCalendar) (time.Time, time.Time) {
+	if b.PeriodType != budgetPeriodTypeWeekly && b.PeriodType != budgetPeriodTypeMonthly {
+		return b.StartDate, b.EndDate
+	}
+	if at.Before(b.StartDate) {
+		at = b.StartDate
+	} else if at.After(b.EndDate) {
+		at = b.EndDate
+	}
+
+	day := localDay(at, cal.loc)
+	var start, next time.Time
+	if b.PeriodType == budgetPeriodTypeWeekly {
+		start = day.AddDate(0, 0, -(int(day.Weekday())-int(cal.weekStart)+7)%7)
+		next = start.AddDate(0, 0, 7)
+	} else {
+		start = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		next = start.AddDate(0, 1, 0)
+	}
+
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, cal.loc).UTC()
+	last := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, cal.loc).UTC().Add(-time.Second)
+	if first.Before(b.StartDate) {
+		first = b.StartDate
+	}
+	if last.After(b.EndDate) {
+		last = b.EndDate
+	}
+	return first, last
+}
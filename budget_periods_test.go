@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBudgetInstance(t *testing.T) {
+	jakarta, err := loadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2025, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	year := Budget{StartDate: utc(time.January, 1, 0), EndDate: utc(time.December, 31, 23).Add(59*time.Minute + 59*time.Second)}
+	fromWednesday := year
+	fromWednesday.StartDate = utc(time.March, 5, 0)
+	endOfDay := time.Hour*24 - time.Second
+
+	cases := []struct {
+		name        string
+		b           Budget
+		periodType  string
+		at          time.Time
+		cal         budgetCalendar
+		first, last time.Time
+	}{
+		{"one_off is the whole window", year, budgetPeriodTypeOneOff, utc(time.March, 9, 18), budgetCalendar{time.UTC, time.Monday}, year.StartDate, year.EndDate},
+		// Sunday 9 March 2025 late in the day in UTC.
+		{"Monday weeks end on Sunday", year, budgetPeriodTypeWeekly, utc(time.March, 9, 18), budgetCalendar{time.UTC, time.Monday}, utc(time.March, 3, 0), utc(time.March, 9, 0).Add(endOfDay)},
+		{"Sunday weeks start on it", year, budgetPeriodTypeWeekly, utc(time.March, 9, 18), budgetCalendar{time.UTC, time.Sunday}, utc(time.March, 9, 0), utc(time.March, 15, 0).Add(endOfDay)},
+		// In Jakarta that instant is already Monday, a new Monday week.
+		{"the user's zone decides the day", year, budgetPeriodTypeWeekly, utc(time.March, 9, 18), budgetCalendar{jakarta, time.Monday}, utc(time.March, 9, 17), utc(time.March, 16, 17).Add(-time.Second)},
+		{"Sunday weeks in the user's zone", year, budgetPeriodTypeWeekly, utc(time.March, 9, 18), budgetCalendar{jakarta, time.Sunday}, utc(time.March, 8, 17), utc(time.March, 15, 17).Add(-time.Second)},
+		{"the window cuts the first week short", fromWednesday, budgetPeriodTypeWeekly, utc(time.March, 6, 12), budgetCalendar{time.UTC, time.Monday}, fromWednesday.StartDate, utc(time.March, 9, 0).Add(endOfDay)},
+		{"before the window is its first week", fromWednesday, budgetPeriodTypeWeekly, utc(time.February, 1, 0), budgetCalendar{time.UTC, time.Monday}, fromWednesday.StartDate, utc(time.March, 9, 0).Add(endOfDay)},
+		{"after the window is its last week", year, budgetPeriodTypeWeekly, utc(time.December, 31, 23).AddDate(0, 1, 0), budgetCalendar{time.UTC, time.Monday}, utc(time.December, 29, 0), year.EndDate},
+		{"months are calendar months", year, budgetPeriodTypeMonthly, utc(time.March, 31, 12), budgetCalendar{time.UTC, time.Monday}, utc(time.March, 1, 0), utc(time.March, 31, 0).Add(endOfDay)},
+		{"months follow the user's zone", year, budgetPeriodTypeMonthly, utc(time.March, 31, 20), budgetCalendar{jakarta, time.Monday}, utc(time.March, 31, 17), utc(time.April, 30, 17).Add(-time.Second)},
+	}
+	for _, c := range cases {
+		b := c.b
+		b.PeriodType = c.periodType
+		first, last := budgetInstance(b, c.at, c.cal)
+		if !first.Equal(c.first) || !last.Equal(c.last) {
+			t.Errorf("%s: expected %v to %v, got %v to %v", c.name, c.first, c.last, first, last)
+		}
+	}
+}
+
+func TestWeeklyBudgetProgress(t *testing.T) {
+	useTestDB(t)
+	now := time.Now().UTC()
+	today := truncateToDay(now)
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	sunday := today.AddDate(0, 0, -int(today.Weekday()))
+
+	b := Budget{Category: "Groceries", Amount: 100, PeriodType: "Weekly", StartDate: today.AddDate(0, 0, -30), EndDate: today.AddDate(0, 0, 30)}
+	rr := callAuthed(http.MethodPost, "/budgets", b)
+	expectStatus(t, rr, http.StatusCreated)
+	b = decodeBody[Budget](t, rr)
+	if b.PeriodType != budgetPeriodTypeWeekly {
+		t.Fatalf("expected period_type weekly, got %q", b.PeriodType)
+	}
+
+	// One expense this week, whichever day it started on, and one the week
+	// before.
+	for _, e := range []Expense{{Amount: 25, Date: now}, {Amount: 40, Date: today.AddDate(0, 0, -8)}} {
+		e.Category = "Groceries"
+		e.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	progress := func() BudgetProgress {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, fmt.Sprintf("/budgets/%d/progress", b.ID), nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[BudgetProgress](t, rr)
+	}
+	if p := progress(); p.Spent != 25 || p.PeriodType != budgetPeriodTypeWeekly || !p.PeriodStart.Equal(monday) || !p.PeriodEnd.Equal(monday.AddDate(0, 0, 7).Add(-time.Second)) {
+		t.Fatalf("expected this Monday week's spending, got %+v", p)
+	}
+
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{WeekStart: "Sunday"}), http.StatusOK)
+	if p := progress(); p.Spent != 25 || !p.PeriodStart.Equal(sunday) {
+		t.Fatalf("expected this Sunday week's spending, got %+v", p)
+	}
+
+	// A one_off budget still counts the whole window.
+	b.PeriodType = ""
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/budgets/%d", b.ID), b), http.StatusOK)
+	if p := progress(); p.Spent != 65 || p.PeriodType != budgetPeriodTypeOneOff || !p.PeriodStart.Equal(b.StartDate) {
+		t.Fatalf("expected the whole window's spending, got %+v", p)
+	}
+
+	b.PeriodType = "fortnightly"
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/budgets/%d", b.ID), b), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{WeekStart: "saturday"}), http.StatusBadRequest)
+}
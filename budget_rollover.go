@@ -0,0 +1,201 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	budgetPeriodWeekly  = "weekly"
+	budgetPeriodMonthly = "monthly"
+	budgetPeriodYearly  = "yearly"
+)
+
+func (app *App) migrateBudgetRollover() error {
+	columns := []struct{ name, definition string }{
+		{"period", "TEXT"},
+		{"period_type", "TEXT NOT NULL DEFAULT 'one_off'"},
+		{"rollover", "INTEGER NOT NULL DEFAULT 0"},
+		{"carry_over", "INTEGER NOT NULL DEFAULT 0"},
+		{"carried_over_amount", "REAL NOT NULL DEFAULT 0"},
+		{"parent_budget_id", "INTEGER REFERENCES budgets(id) ON DELETE SET NULL"},
+	}
+	for _, c := range columns {
+		if err := app.ensureColumn("budgets", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// At most one budget may roll over from any given parent, which is what
+	// makes rolloverBudgets safe to re-run after a restart.
+	if _, err := app.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_parent_budget_id ON budgets(parent_budget_id)"); err != nil {
+		return fmt.Errorf("create budgets parent index: %w", err)
+	}
+	return nil
+}
+
+// normalizeBudgetPeriod lower-cases the period and checks it against the
+// supported values. Budgets that roll over must have a period.
+func normalizeBudgetPeriod(b *Budget) error {
+	b.Period = strings.ToLower(strings.TrimSpace(b.Period))
+	switch b.Period {
+	case "", budgetPeriodWeekly, budgetPeriodMonthly, budgetPeriodYearly:
+	default:
+		return errors.New("Invalid budget period")
+	}
+	if b.Rollover && b.Period == "" {
+		return errors.New("Rollover requires a period")
+	}
+	if b.CarryOver && !b.Rollover {
+		return errors.New("Carry over requires rollover")
+	}
+	return nil
+}
+
+func addBudgetPeriod(t time.Time, period string) time.Time {
+	switch period {
+	case budgetPeriodWeekly:
+		return t.AddDate(0, 0, 7)
+	case budgetPeriodYearly:
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+// nextBudgetWindow returns the start and end of the period following b. The
+// gap between b's end and the start of its following period is preserved so
+// that e.g. Jan 1 - Jan 31 rolls into Feb 1 - Feb 28.
+func nextBudgetWindow(b Budget) (time.Time, time.Time) {
+	start := addBudgetPeriod(b.StartDate, b.Period)
+	tail := start.Sub(b.EndDate)
+	return start, addBudgetPeriod(start, b.Period).Add(-tail)
+}
+
+// rolloverBudgets creates the next period's budget for every rollover budget
+// that has ended and has no successor yet. Successors roll over themselves,
+// so the loop keeps going until budgets that ended while the server was down
+// have caught up to the current period.
+func (app *App) rolloverBudgets() {
+	now := time.Now().UTC()
+	for {
+		due, err := app.loadDueRolloverBudgets(now)
+		if err != nil {
+			log.Printf("Error querying rollover budgets: %v", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+
+		created := 0
+		for _, b := range due {
+			ok, err := app.rolloverBudget(b)
+			if err != nil {
+				log.Printf("Error rolling over budget %d: %v", b.ID, err)
+				continue
+			}
+			if ok {
+				created++
+			}
+		}
+		if created == 0 {
+			return
+		}
+	}
+}
+
+func (app *App) loadDueRolloverBudgets(now time.Time) ([]Budget, error) {
+	rows, err := app.db.Query(`
+        SELECT id, user_id, category, amount, start_date, end_date, household_id, period, period_type, carry_over, carried_over_amount, account_id
+        FROM budgets b
+        WHERE rollover = 1 AND end_date < ?
+          AND NOT EXISTS (SELECT 1 FROM budgets child WHERE child.parent_budget_id = b.id)`, now.Format(timeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var budgets []Budget
+	for rows.Next() {
+		var b Budget
+		var startStr, endStr string
+		var householdID, accountID sql.NullInt64
+		if err := rows.Scan(&b.ID, &b.UserID, &b.Category, &b.Amount, &startStr, &endStr, &householdID, &b.Period, &b.PeriodType, &b.CarryOver, &b.CarriedOverAmount, &accountID); err != nil {
+			return nil, err
+		}
+		if b.StartDate, err = parseTimestamp(startStr); err != nil {
+			return nil, err
+		}
+		if b.EndDate, err = parseTimestamp(endStr); err != nil {
+			return nil, err
+		}
+		b.HouseholdID = nullIntPtr(householdID)
+		b.AccountID = nullIntPtr(accountID)
+		b.Rollover = true
+		budgets = append(budgets, b)
+	}
+	return budgets, rows.Err()
+}
+
+// rolloverBudget inserts the successor of parent. It reports false when a
+// successor already exists.
+func (app *App) rolloverBudget(parent Budget) (bool, error) {
+	tx, err := app.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	next := Budget{
+		Category:       parent.Category,
+		Amount:         parent.Amount - parent.CarriedOverAmount,
+		HouseholdID:    parent.HouseholdID,
+		AccountID:      parent.AccountID,
+		Period:         parent.Period,
+		PeriodType:     parent.PeriodType,
+		Rollover:       true,
+		CarryOver:      parent.CarryOver,
+		ParentBudgetID: &parent.ID,
+		UserID:         parent.UserID,
+	}
+	next.StartDate, next.EndDate = nextBudgetWindow(parent)
+
+	if parent.CarryOver {
+		spent, err := budgetSpent(tx, parent)
+		if err != nil {
+			return false, err
+		}
+		if unspent := parent.Amount - spent; unspent > 0 {
+			next.CarriedOverAmount = unspent
+			next.Amount += unspent
+		}
+	}
+
+	next.Timestamps = newTimestamps(time.Now())
+	now := next.UpdatedAt.Format(timeFormat)
+	id, err := insertReturningID(tx, `
+        INSERT INTO budgets(category, amount, start_date, end_date, user_id, household_id, period, period_type, rollover, carry_over, carried_over_amount, parent_budget_id, account_id, created_at, updated_at)
+        VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(parent_budget_id) DO NOTHING`,
+		next.Category, next.Amount, next.StartDate.Format(timeFormat), next.EndDate.Format(timeFormat), next.UserID, next.HouseholdID, next.Period, next.PeriodType, next.Rollover, next.CarryOver, next.CarriedOverAmount, parent.ID, next.AccountID, now, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Another run already created the successor.
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	next.ID = id
+
+	if err := recordAudit(tx, next.UserID, auditEntityBudget, next.ID, auditActionCreate, nil, next); err != nil {
+		return false, err
+	}
+	if err := touchUserData(tx, next.UserID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
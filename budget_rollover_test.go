@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNextBudgetWindow(t *testing.T) {
+	b := Budget{
+		StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2025, 1, 31, 23, 59, 59, 0, time.UTC),
+		Period:    budgetPeriodMonthly,
+	}
+	start, end := nextBudgetWindow(b)
+	if !start.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2025, 2, 28, 23, 59, 59, 0, time.UTC)) {
+		t.Fatalf("unexpected monthly window %v - %v", start, end)
+	}
+
+	b.Period = budgetPeriodWeekly
+	b.EndDate = time.Date(2025, 1, 7, 23, 59, 59, 0, time.UTC)
+	start, end = nextBudgetWindow(b)
+	if !start.Equal(time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2025, 1, 14, 23, 59, 59, 0, time.UTC)) {
+		t.Fatalf("unexpected weekly window %v - %v", start, end)
+	}
+}
+
+func TestBudgetRolloverCarriesOverAndIsIdempotent(t *testing.T) {
+	useTestDB(t)
+
+	invalidRR := callAuthed(http.MethodPost, "/budgets", Budget{Category: "Dining", Amount: 100, Rollover: true})
+	expectStatus(t, invalidRR, http.StatusBadRequest)
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	budget := Budget{
+		Category:  "Dining",
+		Amount:    100,
+		StartDate: start,
+		EndDate:   time.Date(2025, 1, 31, 23, 59, 59, 0, time.UTC),
+		Period:    "Monthly",
+		Rollover:  true,
+		CarryOver: true,
+	}
+	createRR := callAuthed(http.MethodPost, "/budgets", budget)
+	expectStatus(t, createRR, http.StatusCreated)
+	parent := decodeBody[Budget](t, createRR)
+
+	spent := Expense{Amount: 60, Category: "Dining", Date: start.AddDate(0, 0, 10), AccountID: testAccount()}
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", spent), http.StatusCreated)
+
+	testApp.rolloverBudgets()
+
+	var childID int
+	var amount, carried float64
+	var childStart time.Time
+	if err := testApp.db.QueryRow("SELECT id, amount, carried_over_amount, start_date FROM budgets WHERE parent_budget_id = ?", parent.ID).Scan(&childID, &amount, &carried, &childStart); err != nil {
+		t.Fatalf("load rolled over budget: %v", err)
+	}
+	if amount != 140 || carried != 40 {
+		t.Fatalf("expected 40 carried into a 140 budget, got amount=%.2f carried=%.2f", amount, carried)
+	}
+	if !childStart.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected successor to start 2025-02-01, got %v", childStart)
+	}
+
+	var grandchildAmount float64
+	if err := testApp.db.QueryRow("SELECT amount FROM budgets WHERE parent_budget_id = ?", childID).Scan(&grandchildAmount); err != nil {
+		t.Fatalf("load second rollover: %v", err)
+	}
+	if grandchildAmount != 240 {
+		t.Fatalf("expected unspent February budget to carry over in full, got %.2f", grandchildAmount)
+	}
+
+	var total, current int
+	now := time.Now().UTC().Format(timeFormat)
+	testApp.db.QueryRow("SELECT COUNT(*) FROM budgets WHERE user_id = ? AND category = 'Dining'", testUserID).Scan(&total)
+	testApp.db.QueryRow("SELECT COUNT(*) FROM budgets WHERE user_id = ? AND category = 'Dining' AND end_date >= ?", testUserID, now).Scan(&current)
+	if current != 1 {
+		t.Fatalf("expected rollover to catch up to exactly one current budget, got %d", current)
+	}
+
+	testApp.rolloverBudgets()
+
+	var again int
+	testApp.db.QueryRow("SELECT COUNT(*) FROM budgets WHERE user_id = ? AND category = 'Dining'", testUserID).Scan(&again)
+	if again != total {
+		t.Fatalf("expected rerun to be a no-op, budgets went from %d to %d", total, again)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Budgets with an empty category are overall budgets: they cap spending
+// across every category. The category is stored and returned as "".
+//
+// A budget with an account_id only counts expenses paid from that account,
+// combined with its category if it has one. An overall budget on an account
+// caps everything spent from it.
+
+// budgetAccountName selects the name of a budget's account in a query on
+// the budgets table.
+const budgetAccountName = "(SELECT name FROM accounts WHERE accounts.id = budgets.account_id)"
+
+func (app *App) migrateBudgetAccounts() error {
+	if err := app.ensureColumn("budgets", "account_id", "INTEGER REFERENCES accounts(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
+	return app.ensureColumn("budgets", "account_removed", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// resolveBudgetAccount checks that b's account, if it has one, is visible
+// to userID and fills in its name. It writes a 400 when it is not.
+func resolveBudgetAccount(w http.ResponseWriter, q rowQuerier, userID int, b *Budget) bool {
+	b.AccountName = nil
+	b.AccountRemoved = false
+	if b.AccountID == nil || *b.AccountID == 0 {
+		b.AccountID = nil
+		return true
+	}
+	a, err := fetchAccount(q, userID, *b.AccountID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Account not found", http.StatusBadRequest)
+		return false
+	} else if err != nil {
+		log.Printf("account fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	b.AccountName = &a.Name
+	return true
+}
+
+// validateBudget fills in missing dates and rejects a budget whose numbers
+// would make its progress meaningless. Without a start_date, the budget
+// starts on the first of end_date's month, or at now when end_date is
+// missing too; without an end_date it ends when it starts. Dates come out
+// in UTC.
+func validateBudget(b *Budget, now time.Time) error {
+	if b.Amount <= 0 {
+		return errors.New("Budget amount must be positive")
+	}
+	switch {
+	case b.StartDate.IsZero() && b.EndDate.IsZero():
+		b.StartDate = now
+	case b.StartDate.IsZero():
+		b.StartDate = time.Date(b.EndDate.Year(), b.EndDate.Month(), 1, 0, 0, 0, 0, b.EndDate.Location())
+	}
+	if b.EndDate.IsZero() {
+		b.EndDate = b.StartDate
+	}
+	b.StartDate, b.EndDate = b.StartDate.UTC(), b.EndDate.UTC()
+	if b.EndDate.Before(b.StartDate) {
+		return errors.New("Budget end_date must not be before start_date")
+	}
+	return nil
+}
+
+var budgetStatuses = []string{"active", "expired", "upcoming"}
+
+// activeAt reports whether t falls within b, both ends included.
+func (b Budget) activeAt(t time.Time) bool {
+	return !t.Before(b.StartDate) && !t.After(b.EndDate)
+}
+
+// budgetListFilter applies the filters of GET /budgets. status is active,
+// expired, or upcoming as of now, matching activeAt; category matches
+// exactly; date_from and date_to keep budgets overlapping those days.
+func (app *App) budgetListFilter(w http.ResponseWriter, userID int, params url.Values, now time.Time) (string, []interface{}, bool) {
+	var clause string
+	var args []interface{}
+
+	status, ok := parseEnumParam(w, params, "status", budgetStatuses...)
+	if !ok {
+		return "", nil, false
+	}
+	stamp := now.UTC().Format(timeFormat)
+	switch status {
+	case "active":
+		clause += " AND start_date <= ? AND end_date >= ?"
+		args = append(args, stamp, stamp)
+	case "expired":
+		clause += " AND end_date < ?"
+		args = append(args, stamp)
+	case "upcoming":
+		clause += " AND start_date > ?"
+		args = append(args, stamp)
+	}
+
+	if category := strings.TrimSpace(params.Get("category")); category != "" {
+		clause += " AND category = ?"
+		args = append(args, category)
+	}
+
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return "", nil, false
+	}
+	from, ok := parseDayParam(w, params.Get("date_from"), "date_from", time.Time{}, loc)
+	if !ok {
+		return "", nil, false
+	}
+	to, ok := parseDayParam(w, params.Get("date_to"), "date_to", time.Time{}, loc)
+	if !ok {
+		return "", nil, false
+	}
+	if !from.IsZero() {
+		clause += " AND end_date >= ?"
+		args = append(args, dayStart(from, loc))
+	}
+	if !to.IsZero() {
+		clause += " AND start_date < ?"
+		args = append(args, dayStart(to.AddDate(0, 0, 1), loc))
+	}
+	return clause, args, true
+}
+
+// BudgetProgress is spending against a budget in the instance of its
+// period_type that PeriodStart and PeriodEnd bound: the whole window for a
+// one_off budget, or the current week or month for a weekly or monthly one.
+type BudgetProgress struct {
+	BudgetID    int       `json:"budget_id"`
+	Category    string    `json:"category"`
+	Overall     bool      `json:"overall"`
+	AccountID   *int      `json:"account_id"`
+	AccountName *string   `json:"account_name"`
+	Label       string    `json:"label"`
+	PeriodType  string    `json:"period_type"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Amount      float64   `json:"amount"`
+	Spent       float64   `json:"spent"`
+	Remaining   float64   `json:"remaining"`
+	PercentUsed float64   `json:"percent_used"`
+}
+
+// overallBudgetOverlaps reports whether another overall budget in the same
+// scope as b (the user's own budgets, or b's household) and on the same
+// account, or on none, overlaps b's window.
+func overallBudgetOverlaps(q rowQuerier, userID int, b Budget) (bool, error) {
+	query := "SELECT EXISTS(SELECT 1 FROM budgets WHERE category = '' AND id != ? AND start_date <= ? AND end_date >= ?"
+	args := []interface{}{b.ID, b.EndDate.Format(timeFormat), b.StartDate.Format(timeFormat)}
+	if b.AccountID != nil {
+		query += " AND account_id = ?"
+		args = append(args, *b.AccountID)
+	} else {
+		query += " AND account_id IS NULL"
+	}
+	if b.HouseholdID != nil {
+		query += " AND household_id = ?)"
+		args = append(args, *b.HouseholdID)
+	} else {
+		query += " AND user_id = ? AND household_id IS NULL)"
+		args = append(args, userID)
+	}
+
+	var exists bool
+	err := q.QueryRow(query, args...).Scan(&exists)
+	return exists, err
+}
+
+// checkOverallBudget normalizes b's category and, for overall budgets,
+// writes a 409 if it would overlap another one.
+func checkOverallBudget(w http.ResponseWriter, q rowQuerier, userID int, b *Budget) bool {
+	b.Category = strings.TrimSpace(b.Category)
+	if b.Category != "" {
+		return true
+	}
+
+	overlaps, err := overallBudgetOverlaps(q, userID, *b)
+	if err != nil {
+		log.Printf("overall budget overlap check error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if overlaps {
+		http.Error(w, "An overall budget already covers this period", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// budgetSpent sums the expenses that count against b: split lines in its
+// category (or every category for overall budgets) between its start and
+// end dates, paid from its account if it has one, and owned by the same
+// user or, for household budgets, recorded against the same household.
+func budgetSpent(q rowQuerier, b Budget) (float64, error) {
+	return budgetSpentBetween(q, b, b.StartDate, b.EndDate)
+}
+
+// budgetSpentBetween is budgetSpent for the part of b's window from start to
+// end, both inclusive.
+func budgetSpentBetween(q rowQuerier, b Budget, start, end time.Time) (float64, error) {
+	query := "SELECT COALESCE(SUM(amount), 0) FROM " + expenseCategoryLines + " WHERE date >= ? AND date <= ?"
+	args := []interface{}{start.Format(timeFormat), end.Format(timeFormat)}
+	if b.Category != "" {
+		query += " AND category = ?"
+		args = append(args, b.Category)
+	}
+	if b.AccountID != nil {
+		query += " AND account_id = ?"
+		args = append(args, *b.AccountID)
+	}
+	if b.HouseholdID != nil {
+		query += " AND household_id = ?"
+		args = append(args, *b.HouseholdID)
+	} else {
+		query += " AND user_id = ?"
+		args = append(args, b.UserID)
+	}
+
+	var spent float64
+	err := q.QueryRow(query, args...).Scan(&spent)
+	return spent, err
+}
+
+func (app *App) getBudgetProgress(w http.ResponseWriter, r *http.Request, userID, id int) {
+	b, err := fetchBudget(app.requestDB(r), userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Budget not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("budget fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	cal, err := loadBudgetCalendar(app.requestDB(r), userID)
+	if err != nil {
+		log.Printf("budget calendar error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	progress, err := budgetProgressAt(app.requestDB(r), b, time.Now(), cal)
+	if err != nil {
+		log.Printf("budget spent error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
+// budgetProgressAt reports spending against the instance of b holding at.
+func budgetProgressAt(q rowQuerier, b Budget, at time.Time, cal budgetCalendar) (BudgetProgress, error) {
+	start, end := budgetInstance(b, at, cal)
+	spent, err := budgetSpentBetween(q, b, start, end)
+	if err != nil {
+		return BudgetProgress{}, err
+	}
+	return newBudgetProgress(b, start, end, spent), nil
+}
+
+func newBudgetProgress(b Budget, start, end time.Time, spent float64) BudgetProgress {
+	progress := BudgetProgress{
+		BudgetID:    b.ID,
+		Category:    b.Category,
+		Overall:     b.Category == "",
+		AccountID:   b.AccountID,
+		AccountName: b.AccountName,
+		Label:       b.Category,
+		PeriodType:  b.PeriodType,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Amount:      b.Amount,
+		Spent:       spent,
+		Remaining:   b.Amount - spent,
+	}
+	if progress.Overall {
+		progress.Label = "Overall"
+	}
+	if b.AccountName != nil {
+		progress.Label += " (" + *b.AccountName + ")"
+	}
+	if b.Amount > 0 {
+		progress.PercentUsed = spent / b.Amount * 100
+	}
+	return progress
+}
+
+// BudgetClone is the optional body of POST /budgets/{id}/clone. Fields left
+// out follow the original: its window shifted forward by shiftBudgetWindow,
+// and its amount.
+type BudgetClone struct {
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	Amount    *float64  `json:"amount"`
+}
+
+// shiftBudgetWindow returns the window that follows start to end and is as
+// long, in start's location. A window of whole calendar months moves by that
+// many months, so June 1 - June 30 becomes July 1 - July 31 and January
+// becomes February whatever its length; the end keeps its time of day. Any
+// other window moves by its length in days.
+func shiftBudgetWindow(start, end time.Time) (time.Time, time.Time) {
+	loc := start.Location()
+	end = end.In(loc)
+	startsMonth := start.Equal(time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, loc))
+	endsMonth := end.AddDate(0, 0, 1).Day() == 1
+	if startsMonth && endsMonth {
+		next := time.Date(end.Year(), end.Month()+1, 1, 0, 0, 0, 0, loc)
+		months := (next.Year()-start.Year())*12 + int(next.Month()-start.Month())
+		last := next.AddDate(0, months, -1)
+		return next, time.Date(last.Year(), last.Month(), last.Day(), end.Hour(), end.Minute(), end.Second(), end.Nanosecond(), loc)
+	}
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	endDay := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(endDay.Sub(startDay).Hours()/24) + 1
+	return start.AddDate(0, 0, days), end.AddDate(0, 0, days)
+}
+
+// cloneBudget serves POST /budgets/{id}/clone: a new budget like the
+// original for the next period. It keeps the category, account, household
+// and period but not rollover, which would give the original two successors
+// once the background job ran, nor any amount carried over into the
+// original.
+func (app *App) cloneBudget(w http.ResponseWriter, r *http.Request, userID, id int) {
+	var override BudgetClone
+	if r.ContentLength != 0 && !decodeJSONBody(w, r, &override) {
+		return
+	}
+	if !app.pinDates(w, userID, &override.StartDate, &override.EndDate) {
+		return
+	}
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	original, err := fetchBudget(tx, userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Budget not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("budget fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	b := Budget{
+		Category:    original.Category,
+		Amount:      original.Amount - original.CarriedOverAmount,
+		HouseholdID: original.HouseholdID,
+		AccountID:   original.AccountID,
+		Period:      original.Period,
+		PeriodType:  original.PeriodType,
+	}
+	b.StartDate, b.EndDate = shiftBudgetWindow(original.StartDate.In(loc), original.EndDate.In(loc))
+	if !override.StartDate.IsZero() {
+		b.StartDate = override.StartDate
+	}
+	if !override.EndDate.IsZero() {
+		b.EndDate = override.EndDate
+	}
+	if override.Amount != nil {
+		b.Amount = *override.Amount
+	}
+	if err := validateBudget(&b, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !resolveBudgetAccount(w, tx, userID, &b) {
+		return
+	}
+	if !checkOverallBudget(w, tx, userID, &b) {
+		return
+	}
+
+	if err := insertBudget(tx, userID, &b); err != nil {
+		log.Printf("budget insert error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondCreated(w, fmt.Sprintf("/budgets/%d", b.ID), b)
+}
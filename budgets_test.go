@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOverallBudget(t *testing.T) {
+	useTestDB(t)
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	createRR := callAuthed(http.MethodPost, "/budgets", Budget{Amount: 200, StartDate: start, EndDate: end})
+	expectStatus(t, createRR, http.StatusCreated)
+	overall := decodeBody[Budget](t, createRR)
+	if overall.Category != "" {
+		t.Fatalf("expected overall budget category to be empty, got %q", overall.Category)
+	}
+
+	overlapping := Budget{Category: "  ", Amount: 50, StartDate: start.AddDate(0, 0, 14), EndDate: end.AddDate(0, 1, 0)}
+	expectStatus(t, callAuthed(http.MethodPost, "/budgets", overlapping), http.StatusConflict)
+
+	categoryBudget := Budget{Category: "Food", Amount: 50, StartDate: start, EndDate: end}
+	expectStatus(t, callAuthed(http.MethodPost, "/budgets", categoryBudget), http.StatusCreated)
+
+	updated := overall
+	updated.Amount = 250
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/budgets/%d", overall.ID), updated), http.StatusOK)
+
+	for _, e := range []Expense{
+		{Amount: 40, Category: "Food", Date: start.AddDate(0, 0, 2), AccountID: testAccount()},
+		{Amount: 60, Category: "Transport", Date: start.AddDate(0, 0, 5), AccountID: testAccount()},
+		{Amount: 999, Category: "Transport", Date: end.AddDate(0, 0, 1), AccountID: testAccount()},
+	} {
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	rr := callAuthed(http.MethodGet, fmt.Sprintf("/budgets/%d/progress", overall.ID), nil)
+	expectStatus(t, rr, http.StatusOK)
+	progress := decodeBody[BudgetProgress](t, rr)
+	if !progress.Overall || progress.Label != "Overall" {
+		t.Fatalf("expected overall budget to be labelled, got %+v", progress)
+	}
+	if progress.Spent != 100 || progress.Remaining != 150 {
+		t.Fatalf("expected 100 spent across categories, got %+v", progress)
+	}
+}
+
+func TestAccountBudget(t *testing.T) {
+	useTestDB(t)
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 3, 31, 23, 59, 59, 0, time.UTC)
+	wallet := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: "GoPay", Type: "e-wallet"}))
+
+	for _, e := range []Expense{
+		{Amount: 30, Category: "Food", Date: start.AddDate(0, 0, 1), AccountID: &wallet.ID},
+		{Amount: 20, Category: "Transport", Date: start.AddDate(0, 0, 2), AccountID: &wallet.ID},
+		{Amount: 70, Category: "Food", Date: start.AddDate(0, 0, 3), AccountID: testAccount()},
+		{Amount: 5, Category: "Food", Date: end.AddDate(0, 0, 1), AccountID: &wallet.ID},
+		{Amount: 10, Date: start.AddDate(0, 0, 4), AccountID: &wallet.ID, Splits: []ExpenseSplit{{Category: "Food", Amount: 6}, {Category: "Fun", Amount: 4}}},
+	} {
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	progress := func(b Budget) BudgetProgress {
+		rr := callAuthed(http.MethodPost, "/budgets", b)
+		expectStatus(t, rr, http.StatusCreated)
+		created := decodeBody[Budget](t, rr)
+		if b.AccountID != nil && (created.AccountName == nil || *created.AccountName != "GoPay") {
+			t.Fatalf("expected the account name on the created budget, got %+v", created)
+		}
+		return decodeBody[BudgetProgress](t, callAuthed(http.MethodGet, fmt.Sprintf("/budgets/%d/progress", created.ID), nil))
+	}
+	cases := []struct {
+		name  string
+		b     Budget
+		spent float64
+		label string
+	}{
+		{"account only", Budget{Amount: 100, AccountID: &wallet.ID}, 60, "Overall (GoPay)"},
+		{"account and category", Budget{Category: "Food", Amount: 100, AccountID: &wallet.ID}, 36, "Food (GoPay)"},
+		{"category only", Budget{Category: "Food", Amount: 200}, 106, "Food"},
+		// An overall budget on an account does not clash with one on none.
+		{"overall", Budget{Amount: 500}, 130, "Overall"},
+	}
+	for _, c := range cases {
+		c.b.StartDate, c.b.EndDate = start, end
+		p := progress(c.b)
+		if p.Spent != c.spent || p.Label != c.label || (c.b.AccountID != nil) != (p.AccountID != nil) {
+			t.Errorf("%s: got %+v, want spent %v label %q", c.name, p, c.spent, c.label)
+		}
+	}
+
+	// Another overall budget on the same account does clash.
+	expectStatus(t, callAuthed(http.MethodPost, "/budgets", Budget{Amount: 50, StartDate: start, EndDate: end, AccountID: &wallet.ID}), http.StatusConflict)
+
+	// Only visible accounts may be used.
+	otherCookie, _ := registerUser(t, "other@example.com", "OtherUserPass123!")
+	otherAccount := decodeBody[Account](t, callAuthedAs(otherCookie, http.MethodPost, "/accounts", Account{Name: "Theirs", Type: "cash"}))
+	expectStatus(t, callAuthed(http.MethodPost, "/budgets", Budget{Category: "Food", Amount: 1, AccountID: &otherAccount.ID}), http.StatusBadRequest)
+
+	// Deleting the account leaves the budget covering every account,
+	// flagged until it is saved again.
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/accounts/%d", wallet.ID), nil), http.StatusNoContent)
+	var flagged []Budget
+	for _, b := range decodeBody[[]Budget](t, callAuthed(http.MethodGet, "/budgets", nil)) {
+		if b.AccountRemoved {
+			flagged = append(flagged, b)
+		}
+	}
+	if len(flagged) != 2 || flagged[0].AccountID != nil || flagged[1].AccountName != nil {
+		t.Fatalf("expected the wallet's two budgets flagged with no account, got %+v", flagged)
+	}
+	food := flagged[0]
+	if food.Category != "Food" {
+		food = flagged[1]
+	}
+	p := decodeBody[BudgetProgress](t, callAuthed(http.MethodGet, fmt.Sprintf("/budgets/%d/progress", food.ID), nil))
+	if p.Spent != 106 {
+		t.Fatalf("expected the flagged Food budget to cover every account, got %v", p.Spent)
+	}
+	saved := decodeBody[Budget](t, callAuthed(http.MethodPut, fmt.Sprintf("/budgets/%d", food.ID), food))
+	if saved.AccountRemoved || decodeBody[Budget](t, callAuthed(http.MethodGet, fmt.Sprintf("/budgets/%d", food.ID), nil)).AccountRemoved {
+		t.Fatal("expected saving the budget to clear the flag")
+	}
+}
+
+func TestBudgetListFilters(t *testing.T) {
+	useTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, b := range []Budget{
+		{Category: "Food", Amount: 100, StartDate: now.AddDate(0, -1, 0), EndDate: now.AddDate(0, 0, 1)},
+		{Category: "Food", Amount: 100, StartDate: now.AddDate(0, -3, 0), EndDate: now.AddDate(0, -2, 0)},
+		{Category: "Rent", Amount: 100, StartDate: now.AddDate(0, 1, 0), EndDate: now.AddDate(0, 2, 0)},
+	} {
+		expectStatus(t, callAuthed(http.MethodPost, "/budgets", b), http.StatusCreated)
+	}
+
+	list := func(query string) []Budget {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, "/budgets"+query, nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[[]Budget](t, rr)
+	}
+	if active := list("?status=active"); len(active) != 1 || !active[0].IsActive || active[0].Category != "Food" {
+		t.Fatalf("expected the running budget, got %+v", active)
+	}
+	if expired := list("?status=expired"); len(expired) != 1 || expired[0].IsActive || !expired[0].EndDate.Before(now) {
+		t.Fatalf("expected the finished budget, got %+v", expired)
+	}
+	if upcoming := list("?status=upcoming&category=Rent"); len(upcoming) != 1 || upcoming[0].IsActive {
+		t.Fatalf("expected the future budget, got %+v", upcoming)
+	}
+	if food := list("?category=Food"); len(food) != 2 {
+		t.Fatalf("expected both food budgets, got %+v", food)
+	}
+	overlap := "?date_from=" + now.AddDate(0, 0, 10).Format("2006-01-02") + "&date_to=" + now.AddDate(0, 1, 5).Format("2006-01-02")
+	if overlapping := list(overlap); len(overlapping) != 1 || overlapping[0].Category != "Rent" {
+		t.Fatalf("expected only the budget overlapping the range, got %+v", overlapping)
+	}
+	if page := list("?limit=2&offset=2"); len(page) != 1 || page[0].Category != "Rent" {
+		t.Fatalf("expected the last budget on the second page, got %+v", page)
+	}
+	expectStatus(t, callAuthed(http.MethodGet, "/budgets?status=current", nil), http.StatusBadRequest)
+
+	// A budget whose end_date is exactly now still counts as active, and one
+	// starting exactly now already does.
+	edge := Budget{StartDate: now.AddDate(0, 0, -7), EndDate: now}
+	if !edge.activeAt(now) || edge.activeAt(now.Add(time.Second)) {
+		t.Fatal("expected end_date to be included in the active window")
+	}
+	if !(Budget{StartDate: now, EndDate: now.AddDate(0, 0, 7)}).activeAt(now) {
+		t.Fatal("expected start_date to be included in the active window")
+	}
+	for status, want := range map[string]int{"active": 1, "expired": 0} {
+		expectStatus(t, callAuthed(http.MethodPost, "/budgets", Budget{Category: "Edge-" + status, Amount: 10, StartDate: edge.StartDate, EndDate: edge.EndDate}), http.StatusCreated)
+		filter, args, ok := testApp.budgetListFilter(httptest.NewRecorder(), testUserID, url.Values{"status": {status}, "category": {"Edge-" + status}}, now)
+		if !ok {
+			t.Fatalf("%s: filter refused", status)
+		}
+		var n int
+		if err := testApp.db.QueryRow("SELECT COUNT(*) FROM budgets WHERE "+householdScope+filter, append([]interface{}{testUserID, testUserID}, args...)...).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("status=%s at end_date: expected %d budgets, got %d", status, want, n)
+		}
+	}
+}
+
+func TestBudgetValidation(t *testing.T) {
+	useTestDB(t)
+
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 6, 30, 23, 59, 59, 0, time.UTC)
+	existing := decodeBody[Budget](t, callAuthed(http.MethodPost, "/budgets", Budget{Category: "Existing", Amount: 10, StartDate: start, EndDate: end}))
+
+	cases := []struct {
+		name   string
+		budget Budget
+		field  string
+	}{
+		{"zero amount", Budget{Amount: 0, StartDate: start, EndDate: end}, "amount"},
+		{"negative amount", Budget{Amount: -5, StartDate: start, EndDate: end}, "amount"},
+		{"end before start", Budget{Amount: 50, StartDate: end, EndDate: start}, "end_date"},
+		{"end a second before start", Budget{Amount: 50, StartDate: start, EndDate: start.Add(-time.Second)}, "end_date"},
+	}
+	for _, tc := range cases {
+		tc.budget.Category = "Food"
+		for method, target := range map[string]string{http.MethodPost: "/budgets", http.MethodPut: fmt.Sprintf("/budgets/%d", existing.ID)} {
+			rr := callAuthed(method, target, tc.budget)
+			expectStatus(t, rr, http.StatusBadRequest)
+			if !strings.Contains(rr.Body.String(), tc.field) {
+				t.Errorf("%s %s: expected the error to name %s, got %q", method, tc.name, tc.field, rr.Body.String())
+			}
+		}
+	}
+
+	defaults := []struct {
+		name               string
+		budget             Budget
+		wantStart, wantEnd time.Time
+	}{
+		{"only end_date starts on the first of its month", Budget{EndDate: end}, start, end},
+		{"only start_date ends when it starts", Budget{StartDate: end}, end, end},
+		{"one-instant window", Budget{StartDate: start, EndDate: start}, start, start},
+	}
+	for i, tc := range defaults {
+		tc.budget.Category = fmt.Sprintf("Default %d", i)
+		tc.budget.Amount = 50
+		created := decodeBody[Budget](t, callAuthed(http.MethodPost, "/budgets", tc.budget))
+		if !created.StartDate.Equal(tc.wantStart) || !created.EndDate.Equal(tc.wantEnd) {
+			t.Errorf("%s: got %v to %v, want %v to %v", tc.name, created.StartDate, created.EndDate, tc.wantStart, tc.wantEnd)
+		}
+		updated := decodeBody[Budget](t, callAuthed(http.MethodPut, fmt.Sprintf("/budgets/%d", created.ID), tc.budget))
+		if !updated.StartDate.Equal(tc.wantStart) || !updated.EndDate.Equal(tc.wantEnd) {
+			t.Errorf("%s on update: got %v to %v, want %v to %v", tc.name, updated.StartDate, updated.EndDate, tc.wantStart, tc.wantEnd)
+		}
+	}
+}
+
+func TestShiftBudgetWindow(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	endOf := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 23, 59, 59, 0, time.UTC) }
+	cases := []struct {
+		name               string
+		start, end         time.Time
+		wantStart, wantEnd time.Time
+	}{
+		{"30-day month into 31-day month", day(2025, 6, 1), endOf(2025, 6, 30), day(2025, 7, 1), endOf(2025, 7, 31)},
+		{"31-day month into 30-day month", day(2025, 3, 1), endOf(2025, 3, 31), day(2025, 4, 1), endOf(2025, 4, 30)},
+		{"January into common February", day(2025, 1, 1), endOf(2025, 1, 31), day(2025, 2, 1), endOf(2025, 2, 28)},
+		{"January into leap February", day(2024, 1, 1), endOf(2024, 1, 31), day(2024, 2, 1), endOf(2024, 2, 29)},
+		{"leap February into March", day(2024, 2, 1), endOf(2024, 2, 29), day(2024, 3, 1), endOf(2024, 3, 31)},
+		{"December into January", day(2025, 12, 1), endOf(2025, 12, 31), day(2026, 1, 1), endOf(2026, 1, 31)},
+		{"date-only month end", day(2025, 6, 1), day(2025, 6, 30), day(2025, 7, 1), day(2025, 7, 31)},
+		{"quarter", day(2025, 1, 1), endOf(2025, 3, 31), day(2025, 4, 1), endOf(2025, 6, 30)},
+		{"week", day(2025, 6, 2), endOf(2025, 6, 8), day(2025, 6, 9), endOf(2025, 6, 15)},
+		{"mid-month window across leap February", day(2024, 2, 15), endOf(2024, 3, 14), day(2024, 3, 15), endOf(2024, 4, 12)},
+		{"single day", day(2025, 2, 28), endOf(2025, 2, 28), day(2025, 3, 1), endOf(2025, 3, 1)},
+		{"not starting on the first", day(2025, 6, 2), endOf(2025, 6, 30), day(2025, 7, 1), endOf(2025, 7, 29)},
+	}
+	for _, tc := range cases {
+		gotStart, gotEnd := shiftBudgetWindow(tc.start, tc.end)
+		if !gotStart.Equal(tc.wantStart) || !gotEnd.Equal(tc.wantEnd) {
+			t.Errorf("%s: got %v to %v, want %v to %v", tc.name, gotStart, gotEnd, tc.wantStart, tc.wantEnd)
+		}
+	}
+
+	// Month boundaries are found in the user's timezone, not UTC.
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	start, end := shiftBudgetWindow(time.Date(2025, 6, 1, 0, 0, 0, 0, jakarta), time.Date(2025, 6, 30, 23, 59, 59, 0, jakarta))
+	if !start.Equal(time.Date(2025, 7, 1, 0, 0, 0, 0, jakarta)) || !end.Equal(time.Date(2025, 7, 31, 23, 59, 59, 0, jakarta)) {
+		t.Errorf("expected July in the same zone, got %v to %v", start, end)
+	}
+}
+
+func TestCloneBudget(t *testing.T) {
+	useTestDB(t)
+
+	june := decodeBody[Budget](t, callAuthed(http.MethodPost, "/budgets", Budget{Category: "Food", Amount: 300, Period: "monthly", StartDate: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 6, 30, 23, 59, 59, 0, time.UTC)}))
+
+	rr := callAuthed(http.MethodPost, fmt.Sprintf("/budgets/%d/clone", june.ID), nil)
+	expectStatus(t, rr, http.StatusCreated)
+	july := decodeBody[Budget](t, rr)
+	if july.ID == june.ID || july.Category != "Food" || july.Amount != 300 || july.Period != "monthly" ||
+		!july.StartDate.Equal(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)) || !july.EndDate.Equal(time.Date(2025, 7, 31, 23, 59, 59, 0, time.UTC)) {
+		t.Fatalf("unexpected clone: %+v", july)
+	}
+
+	rr = callAuthed(http.MethodPost, fmt.Sprintf("/budgets/%d/clone", july.ID), map[string]interface{}{"amount": 350, "end_date": "2025-08-15"})
+	expectStatus(t, rr, http.StatusCreated)
+	august := decodeBody[Budget](t, rr)
+	if august.Amount != 350 || !august.StartDate.Equal(time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)) || !august.EndDate.Equal(time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the overrides applied, got %+v", august)
+	}
+
+	expectStatus(t, callAuthed(http.MethodPost, fmt.Sprintf("/budgets/%d/clone", june.ID), map[string]interface{}{"amount": 0}), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodPost, fmt.Sprintf("/budgets/%d/clone", june.ID), map[string]interface{}{"start_date": "2025-09-01"}), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodPost, "/budgets/999999/clone", nil), http.StatusNotFound)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const maxBulkExpenseIDs = 1000
+
+const (
+	bulkActionDelete      = "delete"
+	bulkActionSetCategory = "set_category"
+	bulkActionSetAccount  = "set_account"
+)
+
+// bulkOperationKinds is the operation each action is recorded as.
+var bulkOperationKinds = map[string]string{
+	bulkActionDelete:      operationBulkDelete,
+	bulkActionSetCategory: operationBulkSetCategory,
+	bulkActionSetAccount:  operationBulkSetAccount,
+}
+
+// BulkExpenseRequest is the body of POST /expenses/bulk. Value is the new
+// category for set_category and the new account ID for set_account; delete
+// takes none.
+type BulkExpenseRequest struct {
+	IDs    []int           `json:"ids"`
+	Action string          `json:"action"`
+	Value  json.RawMessage `json:"value,omitempty"`
+}
+
+// BulkExpenseResult reports what happened to one of the requested IDs:
+// "ok", or "not_found" for an expense that does not exist or is not the
+// user's.
+type BulkExpenseResult struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+// BulkExpenseResponse reports the outcome of a bulk action. OperationID
+// names the operation that undoes it, when anything changed.
+type BulkExpenseResponse struct {
+	Action      string              `json:"action"`
+	Applied     int                 `json:"applied"`
+	Results     []BulkExpenseResult `json:"results"`
+	OperationID int                 `json:"operation_id,omitempty"`
+}
+
+// bulkExpensesHandler serves POST /expenses/bulk. Every listed expense is
+// changed in one transaction, with the same balance, audit and sync
+// bookkeeping as the single-expense endpoints. Missing IDs are reported and
+// skipped, unless atomic=true, when any of them leaves everything unchanged
+// with a 422.
+func (app *App) bulkExpensesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "atomic") {
+		return
+	}
+	atomic, ok := parseBoolParam(w, params, "atomic")
+	if !ok {
+		return
+	}
+
+	var req BulkExpenseRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > maxBulkExpenseIDs {
+		http.Error(w, fmt.Sprintf("ids must list at most %d expenses", maxBulkExpenseIDs), http.StatusBadRequest)
+		return
+	}
+
+	var category string
+	var accountID int
+	switch req.Action {
+	case bulkActionDelete:
+	case bulkActionSetCategory:
+		if json.Unmarshal(req.Value, &category) != nil {
+			http.Error(w, "value must be a category name for set_category", http.StatusBadRequest)
+			return
+		}
+		if err := cleanText(nameField("value", &category)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case bulkActionSetAccount:
+		if json.Unmarshal(req.Value, &accountID) != nil || accountID <= 0 {
+			http.Error(w, "value must be an account ID for set_account", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Invalid action; use one of delete, set_category, set_account", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if req.Action == bulkActionSetAccount {
+		if _, err := fetchAccount(tx, userID, accountID); err == sql.ErrNoRows {
+			http.Error(w, "Account not found", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("account fetch error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp := BulkExpenseResponse{Action: req.Action, Results: make([]BulkExpenseResult, 0, len(req.IDs))}
+	seen := make(map[int]bool, len(req.IDs))
+	undo := operationUndo{Refunded: req.Action == bulkActionDelete}
+	now := time.Now()
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		old, err := fetchExpense(tx, userID, id)
+		if err == sql.ErrNoRows {
+			resp.Results = append(resp.Results, BulkExpenseResult{ID: id, Status: "not_found"})
+			continue
+		} else if err != nil {
+			log.Printf("expense fetch error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		switch req.Action {
+		case bulkActionDelete:
+			var s expenseSnapshot
+			if s, err = snapshotExpense(tx, old); err == nil {
+				undo.Restore = append(undo.Restore, s)
+				err = app.removeExpense(tx, userID, old, now)
+			}
+		case bulkActionSetCategory:
+			e := old
+			e.Category = category
+			undo.Revert = append(undo.Revert, old)
+			err = app.bulkUpdateExpense(tx, userID, old, e, now)
+		case bulkActionSetAccount:
+			e := old
+			e.AccountID = &accountID
+			undo.Revert = append(undo.Revert, old)
+			err = app.bulkUpdateExpense(tx, userID, old, e, now)
+		}
+		if err != nil {
+			log.Printf("bulk %s error for expense %d: %v", req.Action, id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		resp.Results = append(resp.Results, BulkExpenseResult{ID: id, Status: "ok"})
+		resp.Applied++
+	}
+
+	if atomic && resp.Applied < len(resp.Results) {
+		// The deferred rollback undoes the expenses already changed.
+		for i := range resp.Results {
+			if resp.Results[i].Status == "ok" {
+				resp.Results[i].Status = "skipped"
+			}
+		}
+		resp.Applied = 0
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	if resp.Applied > 0 {
+		if resp.OperationID, err = recordOperation(tx, userID, bulkOperationKinds[req.Action], resp.Applied, undo); err != nil {
+			log.Printf("operation log error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// removeExpense deletes old and gives its amount back to its account, for
+// DELETE /expenses/{id} and bulk deletes alike.
+func (app *App) removeExpense(tx txQuerier, userID int, old Expense, now time.Time) error {
+	if err := app.store(tx).DeleteExpense(userID, old.ID); err != nil {
+		return err
+	}
+	if err := app.adjustAccountBalance(tx, userID, old.AccountID, old.Amount, balanceReasonExpense, now.UTC().Format(timeFormat)); err != nil {
+		return err
+	}
+	if err := recordTombstone(tx, userID, auditEntityExpense, old.ID, old.HouseholdID); err != nil {
+		return err
+	}
+	return recordAudit(tx, userID, auditEntityExpense, old.ID, auditActionDelete, old, nil)
+}
+
+// bulkUpdateExpense saves e, a copy of old with its category or account
+// changed, moving the amount between accounts when the account changed.
+func (app *App) bulkUpdateExpense(tx txQuerier, userID int, old, e Expense, now time.Time) error {
+	e.Timestamps = old.Timestamps.touched(now)
+	stamp := e.UpdatedAt.Format(timeFormat)
+	if err := app.store(tx).UpdateExpense(userID, e); err != nil {
+		return err
+	}
+	if err := app.moveAccountAmount(tx, userID, old.AccountID, -old.Amount, e.AccountID, -e.Amount, balanceReasonExpense, stamp); err != nil {
+		return err
+	}
+	return recordAudit(tx, userID, auditEntityExpense, e.ID, auditActionUpdate, old, e)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBulkExpenses(t *testing.T) {
+	useTestDB(t)
+
+	bank := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: "Bank", Type: "bank", Balance: 1000}))
+	card := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: "Card", Type: "credit_card"}))
+	var ids []int
+	for _, amount := range []float64{10, 20, 30, 40} {
+		e := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: amount, Category: "Imported", Date: time.Now().UTC(), AccountID: &bank.ID}))
+		ids = append(ids, e.ID)
+	}
+	otherCookie, _ := registerUser(t, "bulk-other@example.com", "correct horse battery")
+	theirs := decodeBody[Account](t, callAuthedAs(otherCookie, http.MethodPost, "/accounts", Account{Name: "Theirs", Type: "credit_card"}))
+	other := decodeBody[Expense](t, callAuthedAs(otherCookie, http.MethodPost, "/expenses", Expense{Amount: 5, Category: "Theirs", Date: time.Now().UTC(), AccountID: &theirs.ID}))
+
+	balance := func(id int) float64 {
+		t.Helper()
+		return decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", id), nil)).Balance
+	}
+	bulk := func(query string, req BulkExpenseRequest, status int) BulkExpenseResponse {
+		t.Helper()
+		rr := callAuthed(http.MethodPost, "/expenses/bulk"+query, req)
+		expectStatus(t, rr, status)
+		return decodeBody[BulkExpenseResponse](t, rr)
+	}
+
+	resp := bulk("", BulkExpenseRequest{IDs: []int{ids[0], ids[1], other.ID, 999999}, Action: "set_category", Value: []byte(`"Groceries"`)}, http.StatusOK)
+	if resp.Applied != 2 || len(resp.Results) != 4 || resp.Results[0].Status != "ok" || resp.Results[2].Status != "not_found" || resp.Results[3].Status != "not_found" {
+		t.Fatalf("unexpected set_category results: %+v", resp)
+	}
+	if e := decodeBody[Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", ids[1]), nil)); e.Category != "Groceries" {
+		t.Fatalf("expected the category changed, got %q", e.Category)
+	}
+	if e := decodeBody[Expense](t, callAuthedAs(otherCookie, http.MethodGet, fmt.Sprintf("/expenses/%d", other.ID), nil)); e.Category != "Theirs" {
+		t.Fatalf("expected another user's expense untouched, got %q", e.Category)
+	}
+
+	bulk("", BulkExpenseRequest{IDs: []int{ids[2]}, Action: "set_account", Value: []byte(fmt.Sprint(card.ID))}, http.StatusOK)
+	if b, c := balance(bank.ID), balance(card.ID); b != 1000-10-20-40 || c != -30 {
+		t.Fatalf("expected the amount moved between accounts, got bank %v card %v", b, c)
+	}
+
+	// With atomic set, one missing ID leaves everything as it was.
+	resp = bulk("?atomic=true", BulkExpenseRequest{IDs: []int{ids[0], ids[3], 999999}, Action: "delete"}, http.StatusUnprocessableEntity)
+	if resp.Applied != 0 || resp.Results[0].Status != "skipped" || resp.Results[2].Status != "not_found" {
+		t.Fatalf("unexpected atomic results: %+v", resp)
+	}
+	if b := balance(bank.ID); b != 930 {
+		t.Fatalf("expected the atomic failure to roll back, got bank %v", b)
+	}
+
+	resp = bulk("", BulkExpenseRequest{IDs: []int{ids[0], ids[3], ids[0]}, Action: "delete"}, http.StatusOK)
+	if resp.Applied != 2 || len(resp.Results) != 2 {
+		t.Fatalf("expected duplicates to be reported once, got %+v", resp)
+	}
+	expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", ids[3]), nil), http.StatusNotFound)
+	if b := balance(bank.ID); b != 980 {
+		t.Fatalf("expected deleted amounts returned to the account, got bank %v", b)
+	}
+
+	tooMany := make([]int, maxBulkExpenseIDs+1)
+	for _, req := range []BulkExpenseRequest{
+		{IDs: tooMany, Action: "delete"},
+		{Action: "delete"},
+		{IDs: ids, Action: "archive"},
+		{IDs: ids, Action: "set_category", Value: []byte(`12`)},
+		{IDs: ids, Action: "set_account", Value: []byte(`999999`)},
+	} {
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses/bulk", req), http.StatusBadRequest)
+	}
+}
+
+// TestDeleteRefundsLikeBulkDelete deletes one expense through each endpoint
+// from twin accounts, which must end up with the same balance, before and
+// after undoing.
+func TestDeleteRefundsLikeBulkDelete(t *testing.T) {
+	useTestDB(t)
+
+	balance := func(id int) float64 {
+		t.Helper()
+		return decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", id), nil)).Balance
+	}
+	var accounts, expenses []int
+	for _, name := range []string{"Single", "Bulk"} {
+		a := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: name, Type: "bank", Balance: 100}))
+		e := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 30, Category: "Food", Date: time.Now().UTC(), AccountID: &a.ID}))
+		accounts, expenses = append(accounts, a.ID), append(expenses, e.ID)
+	}
+
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/expenses/%d", expenses[0]), nil), http.StatusNoContent)
+	rr := callAuthed(http.MethodPost, "/expenses/bulk", BulkExpenseRequest{IDs: []int{expenses[1]}, Action: "delete"})
+	expectStatus(t, rr, http.StatusOK)
+	bulkOp := decodeBody[BulkExpenseResponse](t, rr).OperationID
+	if single, bulk := balance(accounts[0]), balance(accounts[1]); single != 100 || bulk != 100 {
+		t.Fatalf("expected both deletes to refund the account to 100, got %v and %v", single, bulk)
+	}
+
+	ops := decodeBody[[]Operation](t, callAuthed(http.MethodGet, "/operations", nil))
+	for _, op := range ops {
+		if op.Kind == operationDeleteExpense || op.ID == bulkOp {
+			expectStatus(t, callAuthed(http.MethodPost, fmt.Sprintf("/operations/%d/undo", op.ID), nil), http.StatusOK)
+		}
+	}
+	if single, bulk := balance(accounts[0]), balance(accounts[1]); single != 70 || bulk != 70 {
+		t.Fatalf("expected undoing both to take the amount again, got %v and %v", single, bulk)
+	}
+}
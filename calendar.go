@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The calendar feed lists upcoming recurring expenses as iCalendar events
+// (RFC 5545). Calendar apps subscribe by URL and cannot send the session
+// cookie, so the feed is opened with a calendar token in the query string
+// instead. The token only reads the feed; like session tokens it is stored
+// as a hash, and regenerating or deleting it cuts off every subscription
+// made with the old one.
+
+const (
+	// calendarDays is how far ahead the feed projects occurrences.
+	calendarDays = 90
+	// icsLineLimit is the longest content line, in octets, before it is
+	// folded.
+	icsLineLimit = 75
+
+	calendarTokenPrefix = "cal_"
+	calendarFeedPath    = "/recurring-expenses/calendar.ics"
+)
+
+// CalendarToken is the body of POST /settings/calendar-token. URL is the
+// feed to subscribe to.
+type CalendarToken struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+func (app *App) migrateCalendarTokens() error {
+	if err := app.ensureColumn("users", "calendar_token_hash", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := app.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_calendar_token ON users(calendar_token_hash)"); err != nil {
+		return fmt.Errorf("create users calendar token index: %w", err)
+	}
+	return nil
+}
+
+// createCalendarToken serves POST /settings/calendar-token: it issues a new
+// calendar token, revoking the one before.
+func (app *App) createCalendarToken(w http.ResponseWriter, r *http.Request, userID int) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("calendar token error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	token := calendarTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	if _, err := app.db.Exec("UPDATE users SET calendar_token_hash = ? WHERE id = ?", hashSessionToken(token), userID); err != nil {
+		log.Printf("calendar token update error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	feed := url.URL{Scheme: app.requestScheme(r), Host: r.Host, Path: apiPrefix + calendarFeedPath, RawQuery: url.Values{"token": {token}}.Encode()}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CalendarToken{Token: token, URL: feed.String()})
+}
+
+// deleteCalendarToken serves DELETE /settings/calendar-token, revoking the
+// calendar token so the feed cannot be read until a new one is issued.
+func (app *App) deleteCalendarToken(w http.ResponseWriter, r *http.Request, userID int) {
+	if _, err := app.db.Exec("UPDATE users SET calendar_token_hash = NULL WHERE id = ?", userID); err != nil {
+		log.Printf("calendar token delete error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// calendarFeedHandler serves GET /recurring-expenses/calendar.ics: an
+// all-day event for each occurrence of the user's unpaused recurring
+// expenses due over the next calendarDays days, overdue ones included, on
+// its day in the user's timezone.
+func (app *App) calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing calendar token", http.StatusUnauthorized)
+		return
+	}
+	var userID int
+	err := app.requestDB(r).QueryRow("SELECT id FROM users WHERE calendar_token_hash = ? AND deactivated_at IS NULL", hashSessionToken(token)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid or revoked calendar token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("calendar token lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := loadUserSettings(app.requestDB(r), userID)
+	var loc *time.Location
+	if err == nil {
+		loc, err = loadLocation(settings.Timezone)
+	}
+	if err != nil {
+		log.Printf("calendar settings error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	occurrences, err := projectUpcoming(app.requestDB(r), userID, now.AddDate(0, 0, calendarDays))
+	if err != nil {
+		log.Printf("calendar projection error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="recurring-expenses.ics"`)
+	w.Write([]byte(renderCalendar(occurrences, loc, settings, now)))
+}
+
+// renderCalendar writes occurrences as an iCalendar document. UIDs stay the
+// same from one fetch to the next, so calendar apps update events in place.
+func renderCalendar(occurrences []UpcomingOccurrence, loc *time.Location, settings UserSettings, now time.Time) string {
+	var b strings.Builder
+	line := func(name, value string) { b.WriteString(foldICSLine(name + ":" + value)) }
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//expense-tracker//Recurring expenses//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", "Recurring expenses")
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, o := range occurrences {
+		day := localDay(o.Date, loc)
+		line("BEGIN", "VEVENT")
+		line("UID", fmt.Sprintf("recurring-%d-%s@expense-tracker", o.RecurringExpenseID, day.Format("20060102")))
+		line("DTSTAMP", stamp)
+		line("DTSTART;VALUE=DATE", day.Format("20060102"))
+		line("DTEND;VALUE=DATE", day.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY", escapeICSText(o.Category+": "+formatMoney(o.Amount, settings.Locale, settings.Currency)))
+		if o.Note != "" {
+			line("DESCRIPTION", escapeICSText(o.Note))
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escapeICSText escapes s for a TEXT value: backslashes, semicolons, and
+// commas are backslash-escaped and line breaks become \n.
+func escapeICSText(s string) string {
+	return icsTextEscaper.Replace(s)
+}
+
+// foldICSLine ends a content line with CRLF, first folding it so no line is
+// longer than icsLineLimit octets. Continuation lines start with a space,
+// which counts towards the limit, and a fold never splits a UTF-8 sequence.
+func foldICSLine(s string) string {
+	var b strings.Builder
+	limit := icsLineLimit
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = icsLineLimit - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFoldICSLine(t *testing.T) {
+	if got := foldICSLine("SUMMARY:Rent"); got != "SUMMARY:Rent\r\n" {
+		t.Fatalf("expected a short line to be left alone, got %q", got)
+	}
+	if got := foldICSLine(strings.Repeat("a", icsLineLimit)); got != strings.Repeat("a", icsLineLimit)+"\r\n" {
+		t.Fatalf("expected a line of exactly %d octets to be left alone, got %q", icsLineLimit, got)
+	}
+
+	for _, line := range []string{
+		"DESCRIPTION:" + strings.Repeat("0123456789", 30),
+		"DESCRIPTION:" + strings.Repeat("é", 100),
+		"DESCRIPTION:" + strings.Repeat("x🧾", 60),
+	} {
+		folded := foldICSLine(line)
+		if !strings.HasSuffix(folded, "\r\n") {
+			t.Fatalf("expected the line to end with CRLF: %q", folded)
+		}
+		physical := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+		if len(physical) < 2 {
+			t.Fatalf("expected %q to be folded", line)
+		}
+		for i, p := range physical {
+			if len(p) > icsLineLimit {
+				t.Fatalf("line %d is %d octets: %q", i, len(p), p)
+			}
+			if i > 0 && !strings.HasPrefix(p, " ") {
+				t.Fatalf("continuation line %d does not start with a space: %q", i, p)
+			}
+			if !utf8.ValidString(p) {
+				t.Fatalf("line %d splits a UTF-8 sequence: %q", i, p)
+			}
+		}
+		if unfolded := strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", ""); unfolded != line {
+			t.Fatalf("unfolding gave %q, want %q", unfolded, line)
+		}
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	for in, want := range map[string]string{
+		"Rent":               "Rent",
+		`C:\bills`:           `C:\\bills`,
+		"Gym; monthly, auto": `Gym\; monthly\, auto`,
+		"line one\nline two": `line one\nline two`,
+		"windows\r\nbreak":   `windows\nbreak`,
+	} {
+		if got := escapeICSText(in); got != want {
+			t.Errorf("escapeICSText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	useTestDB(t)
+	feed := func(token string) *httptest.ResponseRecorder {
+		return serve(httptest.NewRequest(http.MethodGet, apiPrefix+"/recurring-expenses/calendar.ics?token="+url.QueryEscape(token), nil))
+	}
+	expectStatus(t, serve(httptest.NewRequest(http.MethodGet, apiPrefix+"/recurring-expenses/calendar.ics", nil)), http.StatusUnauthorized)
+	expectStatus(t, feed("cal_unknown"), http.StatusUnauthorized)
+
+	note := "Family plan, billed weekly; see \\accounts\nfor the card. " + strings.Repeat("Long note. ", 10)
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Truncate(24 * time.Hour)
+	re := decodeBody[RecurringExpense](t, callAuthed(http.MethodPost, "/recurring-expenses", RecurringExpense{Amount: 45, Category: "Streaming", Note: note, Frequency: "weekly", NextDueDate: tomorrow}))
+	paused := decodeBody[RecurringExpense](t, callAuthed(http.MethodPost, "/recurring-expenses", RecurringExpense{Amount: 10, Category: "Gym", Frequency: "weekly", NextDueDate: tomorrow}))
+	paused.Paused = true
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/recurring-expenses/%d", paused.ID), paused), http.StatusOK)
+
+	rr := callAuthed(http.MethodPost, "/settings/calendar-token", nil)
+	expectStatus(t, rr, http.StatusOK)
+	token := decodeBody[CalendarToken](t, rr)
+	if !strings.HasPrefix(token.Token, calendarTokenPrefix) || !strings.HasSuffix(token.URL, "/recurring-expenses/calendar.ics?token="+token.Token) {
+		t.Fatalf("unexpected calendar token: %+v", token)
+	}
+
+	rr = feed(token.Token)
+	expectStatus(t, rr, http.StatusOK)
+	if ct := rr.Header().Get("Content-Type"); ct != "text/calendar; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(body, "END:VCALENDAR\r\n") {
+		t.Fatalf("unexpected calendar: %q", body)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n") {
+		if len(line) > icsLineLimit || strings.Contains(line, "\n") {
+			t.Fatalf("line breaks the content line rules: %q", line)
+		}
+	}
+
+	// Weekly from tomorrow, 13 occurrences fall within 90 days; the paused
+	// one is left out.
+	unfolded := strings.ReplaceAll(body, "\r\n ", "")
+	if n := strings.Count(unfolded, "BEGIN:VEVENT\r\n"); n != 13 {
+		t.Fatalf("expected 13 events, got %d", n)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("UID:recurring-%d-%s@expense-tracker\r\n", re.ID, tomorrow.Format("20060102")),
+		"DTSTART;VALUE=DATE:" + tomorrow.Format("20060102") + "\r\n",
+		"DTEND;VALUE=DATE:" + tomorrow.AddDate(0, 0, 1).Format("20060102") + "\r\n",
+		"SUMMARY:Streaming: 45.00\r\n",
+		`DESCRIPTION:Family plan\, billed weekly\; see \\accounts\nfor the card. Long note.`,
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Fatalf("expected the feed to contain %q:\n%s", want, unfolded)
+		}
+	}
+	if strings.Contains(unfolded, "Gym") {
+		t.Fatal("expected the paused recurring expense to be left out")
+	}
+
+	// Regenerating revokes the old token, and deleting revokes the new one.
+	renewed := decodeBody[CalendarToken](t, callAuthed(http.MethodPost, "/settings/calendar-token", nil))
+	expectStatus(t, feed(token.Token), http.StatusUnauthorized)
+	expectStatus(t, feed(renewed.Token), http.StatusOK)
+	expectStatus(t, callAuthed(http.MethodDelete, "/settings/calendar-token", nil), http.StatusNoContent)
+	expectStatus(t, feed(renewed.Token), http.StatusUnauthorized)
+}
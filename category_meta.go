@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Categories are plain text on each expense, so how a client draws one, its
+// color and icon, is kept apart in category_meta, one row per user and
+// category. Reports listing categories carry it inline as meta, null for a
+// category with none. Rows are not tied to expenses: one can be set before
+// the category is first used, and stays until it is deleted.
+
+// expandMeta adds each category's style to totals_by_category.
+const expandMeta = "meta"
+
+// maxCategoryIconLength caps icon in runes. An emoji can take several, with
+// skin tones and joiners, but a word or sentence should not fit.
+const maxCategoryIconLength = 16
+
+// categoryColorPattern is a hex color as #rrggbb.
+var categoryColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// CategoryStyle is how a category is drawn. Either field may be null.
+type CategoryStyle struct {
+	Color *string `json:"color"`
+	Icon  *string `json:"icon"`
+}
+
+// CategoryMeta is the style stored for one category, the body and response
+// of PUT /categories/meta.
+type CategoryMeta struct {
+	Category string `json:"category"`
+	CategoryStyle
+}
+
+// categoryTotalMeta is a category's entry in totals_by_category with
+// expand=meta.
+type categoryTotalMeta struct {
+	Total float64        `json:"total"`
+	Meta  *CategoryStyle `json:"meta"`
+}
+
+func (app *App) createCategoryMetaTables() error {
+	metaTableStmt := `
+    CREATE TABLE IF NOT EXISTS category_meta (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        category TEXT NOT NULL,
+        color TEXT,
+        icon TEXT,
+        UNIQUE(user_id, category),
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(metaTableStmt)); err != nil {
+		return fmt.Errorf("create category_meta table: %w", err)
+	}
+	return nil
+}
+
+// loadCategoryMeta returns the user's styles by category.
+func loadCategoryMeta(q rowsQuerier, userID int) (map[string]*CategoryStyle, error) {
+	rows, err := q.Query("SELECT category, color, icon FROM category_meta WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("load category meta: %w", err)
+	}
+	defer rows.Close()
+	styles := map[string]*CategoryStyle{}
+	for rows.Next() {
+		var category string
+		var color, icon sql.NullString
+		if err := rows.Scan(&category, &color, &icon); err != nil {
+			return nil, err
+		}
+		styles[category] = &CategoryStyle{Color: nullStringPtr(color), Icon: nullStringPtr(icon)}
+	}
+	return styles, rows.Err()
+}
+
+// attachCategoryMeta fills in the meta of each total.
+func attachCategoryMeta(q rowsQuerier, userID int, totals []CategoryTotal) error {
+	if len(totals) == 0 {
+		return nil
+	}
+	styles, err := loadCategoryMeta(q, userID)
+	if err != nil {
+		return err
+	}
+	for i := range totals {
+		totals[i].Meta = styles[totals[i].Category]
+	}
+	return nil
+}
+
+// getCategoryMeta serves GET /categories/meta: every category the user has
+// styled, by name.
+func (app *App) getCategoryMeta(w http.ResponseWriter, r *http.Request, userID int) {
+	rows, err := app.requestDB(r).Query("SELECT category, color, icon FROM category_meta WHERE user_id = ? ORDER BY category", userID)
+	if err != nil {
+		log.Printf("category meta query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var metas []CategoryMeta
+	for rows.Next() {
+		var m CategoryMeta
+		var color, icon sql.NullString
+		if err := rows.Scan(&m.Category, &color, &icon); err != nil {
+			log.Printf("category meta scan error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		m.Color, m.Icon = nullStringPtr(color), nullStringPtr(icon)
+		metas = append(metas, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("category meta query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSONList(w, metas)
+}
+
+// putCategoryMeta serves PUT /categories/meta, setting the style of one
+// category. Both fields are replaced, so one left out is cleared.
+func (app *App) putCategoryMeta(w http.ResponseWriter, r *http.Request, userID int) {
+	var m CategoryMeta
+	if !decodeJSONBody(w, r, &m) {
+		return
+	}
+	if err := validateCategoryMeta(&m); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err := app.db.Exec(`INSERT INTO category_meta(user_id, category, color, icon) VALUES(?, ?, ?, ?)
+        ON CONFLICT(user_id, category) DO UPDATE SET color = excluded.color, icon = excluded.icon`,
+		userID, m.Category, m.Color, m.Icon)
+	if err != nil {
+		log.Printf("category meta update error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// deleteCategoryMeta serves DELETE /categories/meta?category=, dropping the
+// style of a category, whether or not it is still in use.
+func (app *App) deleteCategoryMeta(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "category") {
+		return
+	}
+	category := params.Get("category")
+	if category == "" {
+		http.Error(w, "category is required", http.StatusBadRequest)
+		return
+	}
+
+	res, err := app.db.Exec("DELETE FROM category_meta WHERE user_id = ? AND category = ?", userID, category)
+	if err != nil {
+		log.Printf("category meta delete error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		log.Printf("category meta delete error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "Category meta not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateCategoryMeta cleans m's text and checks its values. A color is
+// stored in lower case, and an empty color or icon is stored as null.
+func validateCategoryMeta(m *CategoryMeta) error {
+	if err := cleanText(nameField("category", &m.Category), textField{name: "icon", value: m.Icon, max: maxCategoryIconLength}); err != nil {
+		return err
+	}
+	if m.Category == "" {
+		return fmt.Errorf("category is required")
+	}
+	if m.Icon != nil && *m.Icon == "" {
+		m.Icon = nil
+	}
+	if m.Icon != nil && strings.Contains(*m.Icon, " ") {
+		return fmt.Errorf("icon must be a single emoji or symbol")
+	}
+	if m.Color != nil {
+		color := strings.ToLower(strings.TrimSpace(*m.Color))
+		switch {
+		case color == "":
+			m.Color = nil
+		case !categoryColorPattern.MatchString(color):
+			return fmt.Errorf("Invalid color; use a hex color such as #4caf50")
+		default:
+			m.Color = &color
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestCategoryMeta(t *testing.T) {
+	useTestDB(t)
+	for _, e := range []Expense{{Amount: 30, Category: "Food"}, {Amount: 20, Category: "Fuel"}} {
+		e.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	rr := callAuthed(http.MethodPut, "/categories/meta", map[string]interface{}{"category": " Food ", "color": "#4CAF50", "icon": "🍔"})
+	expectStatus(t, rr, http.StatusOK)
+	if got := decodeBody[CategoryMeta](t, rr); got.Category != "Food" || *got.Color != "#4caf50" || *got.Icon != "🍔" {
+		t.Fatalf("unexpected meta: %+v", got)
+	}
+	// A category not used yet can be styled too, and PUT replaces both fields.
+	expectStatus(t, callAuthed(http.MethodPut, "/categories/meta", map[string]interface{}{"category": "Travel", "color": "#000000", "icon": "✈️"}), http.StatusOK)
+	expectStatus(t, callAuthed(http.MethodPut, "/categories/meta", map[string]interface{}{"category": "Travel", "icon": "👨‍👩‍👧‍👦"}), http.StatusOK)
+
+	rr = callAuthed(http.MethodGet, "/categories/meta", nil)
+	expectStatus(t, rr, http.StatusOK)
+	metas := decodeBody[[]CategoryMeta](t, rr)
+	if len(metas) != 2 || metas[0].Category != "Food" || metas[1].Category != "Travel" || metas[1].Color != nil || *metas[1].Icon != "👨‍👩‍👧‍👦" {
+		t.Fatalf("unexpected meta list: %+v", metas)
+	}
+
+	for _, body := range []map[string]interface{}{
+		{"category": "Food", "color": "green"},
+		{"category": "Food", "color": "#4caf5"},
+		{"category": "Food", "icon": "a whole sentence"},
+		{"category": "Food", "icon": "🍔🍔🍔🍔🍔🍔🍔🍔🍔🍔🍔🍔🍔🍔🍔🍔🍔"},
+		{"category": " ", "color": "#ffffff"},
+	} {
+		expectStatus(t, callAuthed(http.MethodPut, "/categories/meta", body), http.StatusBadRequest)
+	}
+
+	// Totals carry the style inline, and null for a category without one.
+	rr = callAuthed(http.MethodGet, "/expenses/aggregates?query=totals_by_category&expand=meta", nil)
+	expectStatus(t, rr, http.StatusOK)
+	var totals map[string]struct {
+		Total float64         `json:"total"`
+		Meta  json.RawMessage `json:"meta"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &totals); err != nil {
+		t.Fatal(err)
+	}
+	if food := totals["Food"]; food.Total != 30 || string(food.Meta) != `{"color":"#4caf50","icon":"🍔"}` {
+		t.Fatalf("unexpected Food total: %+v", food)
+	}
+	if fuel := totals["Fuel"]; fuel.Total != 20 || string(fuel.Meta) != "null" {
+		t.Fatalf("unexpected Fuel total: %+v", fuel)
+	}
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses/aggregates?query=totals_by_month&expand=meta", nil), http.StatusBadRequest)
+
+	rr = callAuthed(http.MethodGet, "/dashboard", nil)
+	expectStatus(t, rr, http.StatusOK)
+	top := decodeBody[Dashboard](t, rr).TopCategories
+	if len(top) != 2 || top[0].Meta == nil || *top[0].Meta.Color != "#4caf50" || top[1].Meta != nil {
+		t.Fatalf("unexpected top categories: %+v", top)
+	}
+
+	// Meta for a category no longer in use can be removed.
+	expectStatus(t, callAuthed(http.MethodDelete, "/categories/meta?category=Travel", nil), http.StatusNoContent)
+	expectStatus(t, callAuthed(http.MethodDelete, "/categories/meta?category=Travel", nil), http.StatusNotFound)
+	expectStatus(t, callAuthed(http.MethodDelete, "/categories/meta", nil), http.StatusBadRequest)
+
+	// Each user has their own.
+	other, _ := registerUser(t, "other@example.com", "OtherUserPass123!")
+	rr = callAuthedAs(other, http.MethodGet, "/categories/meta", nil)
+	expectStatus(t, rr, http.StatusOK)
+	if got := decodeBody[[]CategoryMeta](t, rr); len(got) != 0 {
+		t.Fatalf("expected no meta for another user, got %+v", got)
+	}
+}
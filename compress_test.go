@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gunzip(t *testing.T, body []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("open gzip body: %v", err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read gzip body: %v", err)
+	}
+	return plain
+}
+
+func TestGzipLargeResponses(t *testing.T) {
+	useTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 30; i++ {
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: float64(i + 1), Category: "Groceries", Note: fmt.Sprintf("weekly shop %d", i), Date: now, AccountID: testAccount()}), http.StatusCreated)
+	}
+
+	gzipped := func(target string) *http.Request {
+		req := authedRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+		return req
+	}
+
+	plain := callAuthed(http.MethodGet, "/expenses?limit=30", nil)
+	expectStatus(t, plain, http.StatusOK)
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Fatal("expected no compression without Accept-Encoding")
+	}
+
+	rr := serve(gzipped("/expenses?limit=30"))
+	expectStatus(t, rr, http.StatusOK)
+	if rr.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(rr.Header().Get("Vary"), "Accept-Encoding") {
+		t.Fatalf("expected a gzipped response varying on Accept-Encoding, got headers %v", rr.Header())
+	}
+	if rr.Body.Len() >= plain.Body.Len() {
+		t.Fatalf("expected compression to shrink %d bytes, got %d", plain.Body.Len(), rr.Body.Len())
+	}
+	var expenses []Expense
+	if err := json.Unmarshal(gunzip(t, rr.Body.Bytes()), &expenses); err != nil || len(expenses) != 30 {
+		t.Fatalf("expected 30 expenses in the decoded body, got %d (%v)", len(expenses), err)
+	}
+	if !bytes.Equal(gunzip(t, rr.Body.Bytes()), plain.Body.Bytes()) {
+		t.Fatal("expected the decoded body to match the uncompressed response")
+	}
+
+	// The streamed export flushes part-way and must still decode.
+	export := serve(gzipped("/export"))
+	expectStatus(t, export, http.StatusOK)
+	if export.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected the export to be gzipped")
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(gunzip(t, export.Body.Bytes()), &doc); err != nil || doc["counts"] == nil {
+		t.Fatalf("expected a complete export document, got %v", err)
+	}
+
+	// Small responses are left alone.
+	small := serve(gzipped(fmt.Sprintf("/accounts/%d", testAccountID)))
+	expectStatus(t, small, http.StatusOK)
+	if small.Header().Get("Content-Encoding") != "" {
+		t.Fatal("expected a small response to stay uncompressed")
+	}
+	decodeBody[Account](t, small)
+
+	refused := gzipped("/expenses?limit=30")
+	refused.Header.Set("Accept-Encoding", "gzip;q=0, identity")
+	if rr := serve(refused); rr.Header().Get("Content-Encoding") != "" {
+		t.Fatal("expected gzip;q=0 to disable compression")
+	}
+}
+
+func TestGzipSkipsCompressedContent(t *testing.T) {
+	payload := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, gzipMinSize)
+	handler := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(payload)
+	}))
+	req := authedRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Encoding") != "" || !bytes.Equal(rr.Body.Bytes(), payload) {
+		t.Fatal("expected an image to pass through uncompressed")
+	}
+}
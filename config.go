@@ -0,0 +1,408 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config holds the server settings read at startup. Each field can be set
+// from the environment or overridden by the matching command-line flag.
+type Config struct {
+	// DBDriver is sqlite (the file at DBPath), memory (a throwaway
+	// in-memory database, handy for demos), or postgres (DatabaseURL). When
+	// unset it is postgres if DatabaseURL is set and sqlite otherwise.
+	DBDriver    string
+	DatabaseURL string
+	DBPath      string
+	Port        int
+	SessionTTL  time.Duration
+	BcryptCost  int
+	JobInterval time.Duration
+	// AdminToken enables the /admin routes for requests bearing it.
+	AdminToken string
+	// BackupDir, when set, turns on a snapshot every BackupInterval,
+	// keeping the newest BackupKeep.
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+	// WebDir, when set, serves the web UI in it alongside the API.
+	WebDir string
+	// TLSCert and TLSKey, set together, serve HTTPS on Port. With
+	// HTTPRedirectPort also set, plain HTTP on that port redirects to it.
+	TLSCert          string
+	TLSKey           string
+	HTTPRedirectPort int
+	// TrustedProxies is a comma-separated list of proxy addresses and CIDR
+	// ranges whose forwarding headers are believed.
+	TrustedProxies string
+	// MaxFutureDays is how many days past today, in the user's timezone,
+	// an expense or income may be dated.
+	MaxFutureDays int
+	// MaxExpensesPerUser and MaxAccountsPerUser cap what each user may
+	// store; 0 means no limit.
+	MaxExpensesPerUser int
+	MaxAccountsPerUser int
+	// RateLimit is how many requests a minute each signed-in user may make;
+	// 0 turns limiting off.
+	RateLimit int
+	// QueryTimeout cancels a database read running longer; slow statements,
+	// those over SlowQueryThreshold, are logged. 0 turns either off.
+	QueryTimeout       time.Duration
+	SlowQueryThreshold time.Duration
+	// BalanceEditDeprecatedAt is when setting an account's balance with PUT
+	// was deprecated in favour of POST /accounts/{id}/adjust, and
+	// BalanceEditSunset when such a PUT starts being refused. Only the
+	// sunset can be set, as a date; the deprecation is history.
+	BalanceEditDeprecatedAt time.Time
+	BalanceEditSunset       time.Time
+	// RestoreFrom is only a flag: it restores the SQLite database from a
+	// snapshot and exits instead of serving.
+	RestoreFrom string
+}
+
+const (
+	dbDriverSQLite   = "sqlite"
+	dbDriverMemory   = "memory"
+	dbDriverPostgres = "postgres"
+)
+
+// defaultConfig matches the behaviour from before configuration existed.
+func defaultConfig() Config {
+	return Config{
+		DBPath:      "./expenses.db",
+		Port:        8090,
+		SessionTTL:  24 * time.Hour,
+		BcryptCost:  12,
+		JobInterval: 24 * time.Hour,
+
+		BackupInterval: 24 * time.Hour,
+		BackupKeep:     7,
+
+		MaxFutureDays: 1,
+		RateLimit:     600,
+
+		QueryTimeout:       5 * time.Second,
+		SlowQueryThreshold: 500 * time.Millisecond,
+
+		BalanceEditDeprecatedAt: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC),
+		BalanceEditSunset:       time.Date(2027, 1, 17, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// loadConfig applies environment variables (via getenv) over the defaults,
+// then flags from args over those, and validates the result.
+func loadConfig(args []string, getenv func(string) string) (Config, error) {
+	cfg := defaultConfig()
+
+	if v := getenv("DATABASE_URL"); v != "" {
+		cfg.DatabaseURL = v
+	}
+	if v := getenv("DB_DRIVER"); v != "" {
+		cfg.DBDriver = v
+	}
+	if v := getenv("DB_PATH"); v != "" {
+		cfg.DBPath = v
+	}
+	if v := getenv("PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid PORT %q: %w", v, err)
+		}
+		cfg.Port = port
+	}
+	if v := getenv("SESSION_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SESSION_TTL %q: %w", v, err)
+		}
+		cfg.SessionTTL = ttl
+	}
+	if v := getenv("BCRYPT_COST"); v != "" {
+		cost, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid BCRYPT_COST %q: %w", v, err)
+		}
+		cfg.BcryptCost = cost
+	}
+	if v := getenv("JOB_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid JOB_INTERVAL %q: %w", v, err)
+		}
+		cfg.JobInterval = interval
+	}
+	if v := getenv("TLS_CERT"); v != "" {
+		cfg.TLSCert = v
+	}
+	if v := getenv("TLS_KEY"); v != "" {
+		cfg.TLSKey = v
+	}
+	if v := getenv("HTTP_REDIRECT_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid HTTP_REDIRECT_PORT %q: %w", v, err)
+		}
+		cfg.HTTPRedirectPort = port
+	}
+	if v := getenv("TRUSTED_PROXIES"); v != "" {
+		cfg.TrustedProxies = v
+	}
+	if v := getenv("ADMIN_TOKEN"); v != "" {
+		cfg.AdminToken = v
+	}
+	if v := getenv("BACKUP_DIR"); v != "" {
+		cfg.BackupDir = v
+	}
+	if v := getenv("WEB_DIR"); v != "" {
+		cfg.WebDir = v
+	}
+	if v := getenv("BACKUP_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid BACKUP_INTERVAL %q: %w", v, err)
+		}
+		cfg.BackupInterval = interval
+	}
+	if v := getenv("BACKUP_KEEP"); v != "" {
+		keep, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid BACKUP_KEEP %q: %w", v, err)
+		}
+		cfg.BackupKeep = keep
+	}
+	if v := getenv("MAX_EXPENSES_PER_USER"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid MAX_EXPENSES_PER_USER %q: %w", v, err)
+		}
+		cfg.MaxExpensesPerUser = limit
+	}
+	if v := getenv("MAX_ACCOUNTS_PER_USER"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid MAX_ACCOUNTS_PER_USER %q: %w", v, err)
+		}
+		cfg.MaxAccountsPerUser = limit
+	}
+	if v := getenv("RATE_LIMIT"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT %q: %w", v, err)
+		}
+		cfg.RateLimit = limit
+	}
+	if v := getenv("QUERY_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid QUERY_TIMEOUT %q: %w", v, err)
+		}
+		cfg.QueryTimeout = timeout
+	}
+	if v := getenv("SLOW_QUERY_THRESHOLD"); v != "" {
+		threshold, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SLOW_QUERY_THRESHOLD %q: %w", v, err)
+		}
+		cfg.SlowQueryThreshold = threshold
+	}
+	if v := getenv("MAX_FUTURE_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid MAX_FUTURE_DAYS %q: %w", v, err)
+		}
+		cfg.MaxFutureDays = days
+	}
+	if v := getenv("BALANCE_EDIT_SUNSET"); v != "" {
+		if err := (dateValue{&cfg.BalanceEditSunset}).Set(v); err != nil {
+			return cfg, fmt.Errorf("invalid BALANCE_EDIT_SUNSET %q: %w", v, err)
+		}
+	}
+
+	fs := flag.NewFlagSet("expense-tracker", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&cfg.DBDriver, "db-driver", cfg.DBDriver, "database driver: sqlite, memory, or postgres (DB_DRIVER)")
+	fs.StringVar(&cfg.DatabaseURL, "database-url", cfg.DatabaseURL, "Postgres connection URL (DATABASE_URL)")
+	fs.StringVar(&cfg.DBPath, "db-path", cfg.DBPath, "path to the SQLite database file (DB_PATH)")
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "HTTP listen port (PORT)")
+	fs.DurationVar(&cfg.SessionTTL, "session-ttl", cfg.SessionTTL, "session lifetime (SESSION_TTL)")
+	fs.IntVar(&cfg.BcryptCost, "bcrypt-cost", cfg.BcryptCost, "bcrypt cost for password hashes (BCRYPT_COST)")
+	fs.DurationVar(&cfg.JobInterval, "job-interval", cfg.JobInterval, "interval of the recurring and cleanup jobs (JOB_INTERVAL)")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "TLS certificate file; serves HTTPS together with -tls-key (TLS_CERT)")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "TLS private key file (TLS_KEY)")
+	fs.IntVar(&cfg.HTTPRedirectPort, "http-redirect-port", cfg.HTTPRedirectPort, "port redirecting plain HTTP to HTTPS; disabled when 0 (HTTP_REDIRECT_PORT)")
+	fs.StringVar(&cfg.TrustedProxies, "trusted-proxies", cfg.TrustedProxies, "comma-separated proxy IPs and CIDR ranges whose X-Forwarded-* headers are trusted (TRUSTED_PROXIES)")
+	fs.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "bearer token for the /admin routes; disabled when empty (ADMIN_TOKEN)")
+	fs.StringVar(&cfg.WebDir, "web-dir", cfg.WebDir, "directory of a web UI to serve at /; API only when empty (WEB_DIR)")
+	fs.StringVar(&cfg.BackupDir, "backup-dir", cfg.BackupDir, "directory for scheduled snapshots; disabled when empty (BACKUP_DIR)")
+	fs.DurationVar(&cfg.BackupInterval, "backup-interval", cfg.BackupInterval, "interval between scheduled snapshots (BACKUP_INTERVAL)")
+	fs.IntVar(&cfg.BackupKeep, "backup-keep", cfg.BackupKeep, "number of scheduled snapshots to keep (BACKUP_KEEP)")
+	fs.IntVar(&cfg.MaxExpensesPerUser, "max-expenses-per-user", cfg.MaxExpensesPerUser, "expenses each user may store; unlimited when 0 (MAX_EXPENSES_PER_USER)")
+	fs.IntVar(&cfg.MaxAccountsPerUser, "max-accounts-per-user", cfg.MaxAccountsPerUser, "accounts each user may store; unlimited when 0 (MAX_ACCOUNTS_PER_USER)")
+	fs.IntVar(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "requests a minute each signed-in user may make; unlimited when 0 (RATE_LIMIT)")
+	fs.DurationVar(&cfg.QueryTimeout, "query-timeout", cfg.QueryTimeout, "time a database read may take before it is cancelled; unlimited when 0 (QUERY_TIMEOUT)")
+	fs.DurationVar(&cfg.SlowQueryThreshold, "slow-query-threshold", cfg.SlowQueryThreshold, "statements taking longer are logged; none are when 0 (SLOW_QUERY_THRESHOLD)")
+	fs.IntVar(&cfg.MaxFutureDays, "max-future-days", cfg.MaxFutureDays, "days past today an expense or income may be dated (MAX_FUTURE_DAYS)")
+	fs.Var(dateValue{&cfg.BalanceEditSunset}, "balance-edit-sunset", "date from which PUT /accounts/{id} may no longer change a balance (BALANCE_EDIT_SUNSET)")
+	fs.StringVar(&cfg.RestoreFrom, "restore", "", "restore the SQLite database from this snapshot and exit")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if cfg.DBDriver == "" {
+		cfg.DBDriver = dbDriverSQLite
+		if cfg.DatabaseURL != "" {
+			cfg.DBDriver = dbDriverPostgres
+		}
+	}
+
+	return cfg, cfg.validate()
+}
+
+func (c Config) validate() error {
+	switch c.DBDriver {
+	case dbDriverSQLite:
+		if c.DBPath == "" {
+			return fmt.Errorf("database path must not be empty")
+		}
+	case dbDriverPostgres:
+		if c.DatabaseURL == "" {
+			return fmt.Errorf("the postgres driver needs a database URL")
+		}
+	case dbDriverMemory:
+	default:
+		return fmt.Errorf("unknown database driver %q; use sqlite, memory, or postgres", c.DBDriver)
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("port %d out of range 1-65535", c.Port)
+	}
+	if c.SessionTTL < time.Minute {
+		return fmt.Errorf("session TTL %s is shorter than a minute", c.SessionTTL)
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost %d out of range %d-%d", c.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if c.JobInterval < time.Minute {
+		return fmt.Errorf("job interval %s is shorter than a minute", c.JobInterval)
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("TLS needs both a certificate and a key")
+	}
+	if c.HTTPRedirectPort != 0 {
+		if c.TLSCert == "" {
+			return fmt.Errorf("the HTTP redirect port needs TLS to redirect to")
+		}
+		if c.HTTPRedirectPort < 1 || c.HTTPRedirectPort > 65535 || c.HTTPRedirectPort == c.Port {
+			return fmt.Errorf("HTTP redirect port %d must be in range 1-65535 and differ from port %d", c.HTTPRedirectPort, c.Port)
+		}
+	}
+	if _, err := parseTrustedProxies(c.TrustedProxies); err != nil {
+		return err
+	}
+	if c.BackupInterval < time.Minute {
+		return fmt.Errorf("backup interval %s is shorter than a minute", c.BackupInterval)
+	}
+	if c.BackupKeep < 1 {
+		return fmt.Errorf("backup keep %d must be at least 1", c.BackupKeep)
+	}
+	if c.MaxExpensesPerUser < 0 || c.MaxAccountsPerUser < 0 {
+		return fmt.Errorf("per-user limits must not be negative")
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("rate limit %d must not be negative", c.RateLimit)
+	}
+	if c.QueryTimeout < 0 || c.SlowQueryThreshold < 0 {
+		return fmt.Errorf("query timeout and slow query threshold must not be negative")
+	}
+	if c.MaxFutureDays < 0 {
+		return fmt.Errorf("max future days %d must not be negative", c.MaxFutureDays)
+	}
+	if c.BalanceEditSunset.Before(c.BalanceEditDeprecatedAt) {
+		return fmt.Errorf("balance edit sunset %s is before the deprecation on %s",
+			c.BalanceEditSunset.Format(statsDateFormat), c.BalanceEditDeprecatedAt.Format(statsDateFormat))
+	}
+	if c.WebDir != "" {
+		if err := checkWebDir(c.WebDir); err != nil {
+			return err
+		}
+	}
+	if c.RestoreFrom != "" && c.DBDriver != dbDriverSQLite {
+		return fmt.Errorf("restore needs the sqlite driver")
+	}
+	return nil
+}
+
+// String renders the effective configuration for the startup log, with
+// the database password and admin token redacted.
+func (c Config) String() string {
+	database := "db_driver=" + c.DBDriver
+	switch c.DBDriver {
+	case dbDriverSQLite:
+		database += " db_path=" + c.DBPath
+	case dbDriverPostgres:
+		database += " database_url=" + redactDatabaseURL(c.DatabaseURL)
+	}
+	s := fmt.Sprintf("%s port=%d session_ttl=%s bcrypt_cost=%d job_interval=%s max_future_days=%d rate_limit=%d query_timeout=%s slow_query_threshold=%s",
+		database, c.Port, c.SessionTTL, c.BcryptCost, c.JobInterval, c.MaxFutureDays, c.RateLimit, c.QueryTimeout, c.SlowQueryThreshold)
+	if c.TLSCert != "" {
+		s += fmt.Sprintf(" tls_cert=%s tls_key=%s", c.TLSCert, c.TLSKey)
+		if c.HTTPRedirectPort != 0 {
+			s += fmt.Sprintf(" http_redirect_port=%d", c.HTTPRedirectPort)
+		}
+	}
+	if c.TrustedProxies != "" {
+		s += " trusted_proxies=" + c.TrustedProxies
+	}
+	if c.AdminToken != "" {
+		s += " admin_token=[redacted]"
+	}
+	if c.MaxExpensesPerUser != 0 || c.MaxAccountsPerUser != 0 {
+		s += fmt.Sprintf(" max_expenses_per_user=%d max_accounts_per_user=%d", c.MaxExpensesPerUser, c.MaxAccountsPerUser)
+	}
+	if c.WebDir != "" {
+		s += " web_dir=" + c.WebDir
+	}
+	if c.BackupDir != "" {
+		s += fmt.Sprintf(" backup_dir=%s backup_interval=%s backup_keep=%d", c.BackupDir, c.BackupInterval, c.BackupKeep)
+	}
+	return s
+}
+
+// redactDatabaseURL hides the password of a URL-style DSN. Anything else
+// (such as key=value DSNs, which may carry password=...) is hidden whole.
+func redactDatabaseURL(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "[redacted]"
+	}
+	return u.Redacted()
+}
+
+// dateValue is a flag.Value setting t from a date such as 2027-01-17,
+// midnight UTC.
+type dateValue struct {
+	t *time.Time
+}
+
+func (d dateValue) String() string {
+	if d.t == nil || d.t.IsZero() {
+		return ""
+	}
+	return d.t.Format(statsDateFormat)
+}
+
+func (d dateValue) Set(s string) error {
+	t, err := time.Parse(statsDateFormat, s)
+	if err != nil {
+		return err
+	}
+	*d.t = t
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCreatedMatchesGet(t *testing.T) {
+	useTestDB(t)
+	today := time.Now().UTC().Format(statsDateFormat)
+	note := "  Lunch with the team  "
+
+	for _, create := range []struct {
+		path    string
+		payload interface{}
+	}{
+		// Text the server trims, a date-only day, and a category left to
+		// the rules all come back as stored.
+		{"/expenses", map[string]interface{}{"amount": 12.5, "category": "", "note": note, "payee": " Cafe ", "date": today, "account_id": testAccountID,
+			"splits": []ExpenseSplit{{Category: "Food", Amount: 10}, {Category: "Tips", Amount: 2.5}}}},
+		{"/incomes", map[string]interface{}{"amount": 100, "source": " Salary ", "note": note, "date": today, "account_id": testAccountID}},
+		{"/budgets", map[string]interface{}{"category": "Food", "amount": 300, "period": "monthly", "account_id": testAccountID}},
+		{"/recurring-expenses", map[string]interface{}{"amount": 9.99, "category": "Streaming", "frequency": "Monthly", "next_due_date": today}},
+		{"/accounts", map[string]interface{}{"name": " Wallet ", "type": "cash", "balance": 40}},
+		{"/rules", map[string]interface{}{"match_field": "payee", "match_type": "prefix", "pattern": "Cafe", "category": " Coffee "}},
+	} {
+		rr := callAuthed(http.MethodPost, create.path, create.payload)
+		expectStatus(t, rr, http.StatusCreated)
+		location := rr.Header().Get("Location")
+		var created struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+			t.Fatalf("%s: %v", create.path, err)
+		}
+		if want := fmt.Sprintf("%s%s/%d", apiPrefix, create.path, created.ID); location != want {
+			t.Fatalf("%s: expected Location %q, got %q", create.path, want, location)
+		}
+
+		fetched := callAuthed(http.MethodGet, location, nil)
+		expectStatus(t, fetched, http.StatusOK)
+		if !bytes.Equal(rr.Body.Bytes(), fetched.Body.Bytes()) {
+			t.Fatalf("%s: expected the created body to match GET\ncreated: %s\nfetched: %s", create.path, rr.Body.String(), fetched.Body.String())
+		}
+	}
+}
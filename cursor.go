@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Lists can be paged by cursor instead of offset. A cursor names the last
+// row of the page before, so a page never skips or repeats rows when others
+// are added or removed meanwhile, and the database seeks to it instead of
+// counting past offset rows. Pages are ordered newest first, by date and
+// then id.
+//
+// The cursor is opaque to clients: base64url-encoded JSON carrying a format
+// version and the list it belongs to, so the format can change without old
+// cursors being misread.
+
+// cursorVersion is the format of the cursors issued now. Older versions
+// are refused with a 400, which clients handle by starting over.
+const cursorVersion = 1
+
+// pageCursor is the position after the last row of a page. Type is set for
+// GET /activity, which breaks ties on date by type before id.
+type pageCursor struct {
+	Version int    `json:"v"`
+	List    string `json:"l"`
+	Date    string `json:"d"`
+	Type    string `json:"t,omitempty"`
+	ID      int    `json:"i"`
+}
+
+var errInvalidCursor = errors.New("Invalid cursor; start over without one or with cursor= empty")
+
+func (c pageCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(raw, list string) (pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Version != cursorVersion || c.List != list || c.Date == "" {
+		return pageCursor{}, errInvalidCursor
+	}
+	if _, err := parseTimestamp(c.Date); err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	return c, nil
+}
+
+// cursorPage is how a list request asked to be paged.
+type cursorPage struct {
+	// On is set when the request sent cursor, even empty for the first
+	// page.
+	On    bool
+	After *pageCursor
+	Limit int
+}
+
+// parseCursorPage reads the cursor and limit parameters of a request to
+// list. cursor cannot be combined with offset.
+func parseCursorPage(w http.ResponseWriter, params url.Values, list string) (cursorPage, bool) {
+	if !params.Has("cursor") {
+		return cursorPage{}, true
+	}
+	if params.Has("offset") {
+		http.Error(w, "cursor and offset cannot be combined; use one or the other", http.StatusBadRequest)
+		return cursorPage{}, false
+	}
+	limit, _, ok := parsePagination(w, params)
+	if !ok {
+		return cursorPage{}, false
+	}
+	page := cursorPage{On: true, Limit: limit}
+	if raw := strings.TrimSpace(params.Get("cursor")); raw != "" {
+		c, err := decodeCursor(raw, list)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return cursorPage{}, false
+		}
+		page.After = &c
+	}
+	return page, true
+}
+
+// clause returns the condition and ORDER BY for a page of a table ordered
+// by date and id, and the LIMIT, which asks for one row more than the page
+// so setNextCursor can tell whether another page follows.
+func (p cursorPage) clause() (string, []interface{}) {
+	var clause string
+	var args []interface{}
+	if p.After != nil {
+		clause = " AND (date < ? OR (date = ? AND id < ?))"
+		args = []interface{}{p.After.Date, p.After.Date, p.After.ID}
+	}
+	return clause + " ORDER BY date DESC, id DESC LIMIT ?", append(args, p.Limit+1)
+}
+
+// trimPage drops the extra row a page query asks for and, when there was
+// one, sets X-Next-Cursor to the position of the last row kept. The last
+// page has no X-Next-Cursor.
+func trimPage[T any](w http.ResponseWriter, p cursorPage, items []T, position func(T) pageCursor) []T {
+	if len(items) <= p.Limit {
+		return items
+	}
+	items = items[:p.Limit]
+	next := position(items[len(items)-1])
+	next.Version = cursorVersion
+	w.Header().Set("X-Next-Cursor", next.encode())
+	return items
+}
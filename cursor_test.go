@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// pageAll follows X-Next-Cursor from the first page of target to the last,
+// returning each page.
+func pageAll[T any](t *testing.T, target string) [][]T {
+	t.Helper()
+	var pages [][]T
+	cursor := ""
+	for {
+		rr := callAuthed(http.MethodGet, target+"&cursor="+url.QueryEscape(cursor), nil)
+		expectStatus(t, rr, http.StatusOK)
+		pages = append(pages, decodeBody[[]T](t, rr))
+		if cursor = rr.Header().Get("X-Next-Cursor"); cursor == "" {
+			return pages
+		}
+		if len(pages) > 20 {
+			t.Fatal("cursor pagination does not end")
+		}
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	useTestDB(t)
+	day := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	// Two expenses share each date, so ties are broken by id.
+	var ids []int
+	for i := 0; i < 5; i++ {
+		e := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: float64(i + 1), Category: "Food", Date: day.AddDate(0, 0, i/2), AccountID: testAccount()}))
+		ids = append(ids, e.ID)
+	}
+	want := []int{ids[4], ids[3], ids[2], ids[1], ids[0]}
+
+	pages := pageAll[Expense](t, "/expenses?limit=2")
+	if len(pages) != 3 || len(pages[2]) != 1 {
+		t.Fatalf("expected pages of 2, 2, and 1, got %d pages", len(pages))
+	}
+	var got []int
+	for _, p := range pages {
+		for _, e := range p {
+			got = append(got, e.ID)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected newest first %v, got %v", want, got)
+	}
+
+	// Rows added while paging neither shift nor repeat the rest.
+	rr := callAuthed(http.MethodGet, "/expenses?limit=2&cursor=", nil)
+	next := rr.Header().Get("X-Next-Cursor")
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 9, Category: "Food", Date: day.AddDate(0, 0, 5), AccountID: testAccount()}), http.StatusCreated)
+	rr = callAuthed(http.MethodGet, "/expenses?limit=2&cursor="+next, nil)
+	if page := decodeBody[[]Expense](t, rr); len(page) != 2 || page[0].ID != ids[2] || page[1].ID != ids[1] {
+		t.Fatalf("expected the second page to continue where the first ended, got %+v", page)
+	}
+
+	// Filters apply, and the last page has no next cursor.
+	rr = callAuthed(http.MethodGet, "/expenses?cursor=&amount_max=2", nil)
+	if page := decodeBody[[]Expense](t, rr); len(page) != 2 || rr.Header().Get("X-Next-Cursor") != "" {
+		t.Fatalf("expected one filtered page, got %+v with cursor %q", page, rr.Header().Get("X-Next-Cursor"))
+	}
+
+	// Offset paging is unchanged.
+	if page := decodeBody[[]Expense](t, callAuthed(http.MethodGet, "/expenses?limit=2&offset=4", nil)); len(page) != 2 {
+		t.Fatalf("expected offset paging to keep working, got %+v", page)
+	}
+}
+
+func TestCursorPaginationErrors(t *testing.T) {
+	useTestDB(t)
+	for i := 0; i < 3; i++ {
+		expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 10, Source: "Salary", AccountID: testAccount()}), http.StatusCreated)
+	}
+	incomeCursor := callAuthed(http.MethodGet, "/incomes?limit=1&cursor=", nil).Header().Get("X-Next-Cursor")
+	if incomeCursor == "" {
+		t.Fatal("expected a next cursor")
+	}
+
+	future := base64.RawURLEncoding.EncodeToString([]byte(`{"v":2,"l":"incomes","d":"2024-03-10 12:00:00","i":1}`))
+	for _, target := range []string{
+		"/expenses?cursor=&offset=10",
+		"/expenses?cursor=not-base64!",
+		"/expenses?cursor=" + base64.RawURLEncoding.EncodeToString([]byte("{}")),
+		"/expenses?cursor=" + incomeCursor,
+		"/incomes?cursor=" + future,
+		"/activity?cursor=" + incomeCursor,
+		"/incomes?cursor=&limit=0",
+	} {
+		expectStatus(t, callAuthed(http.MethodGet, target, nil), http.StatusBadRequest)
+	}
+	if page := decodeBody[[]Income](t, callAuthed(http.MethodGet, "/incomes?limit=1&cursor="+incomeCursor, nil)); len(page) != 1 {
+		t.Fatalf("expected the income cursor to work on incomes, got %+v", page)
+	}
+}
+
+func TestActivityCursorPagination(t *testing.T) {
+	useTestDB(t)
+	day := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	// Expenses and incomes on the same dates, so ties cross types.
+	for i := 0; i < 4; i++ {
+		date := day.AddDate(0, 0, i/2)
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 5, Category: "Food", Date: date, AccountID: testAccount()}), http.StatusCreated)
+		expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 50, Source: "Salary", Date: date, AccountID: testAccount()}), http.StatusCreated)
+	}
+
+	all := decodeBody[[]ActivityItem](t, callAuthed(http.MethodGet, "/activity?limit=100", nil))
+	var paged []ActivityItem
+	for _, p := range pageAll[ActivityItem](t, "/activity?limit=3") {
+		paged = append(paged, p...)
+	}
+	if len(all) != 8 || len(paged) != len(all) {
+		t.Fatalf("expected 8 rows both ways, got %d and %d", len(all), len(paged))
+	}
+	for i := range all {
+		if all[i].Type != paged[i].Type || all[i].ID != paged[i].ID {
+			t.Fatalf("row %d: offset gave %s %d, cursor gave %s %d", i, all[i].Type, all[i].ID, paged[i].Type, paged[i].ID)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	dashboardTopCategories = 3
+	dashboardUpcoming      = 5
+	dashboardRecent        = 10
+)
+
+// Dashboard is everything the home screen shows, in one response. Month
+// covers the current calendar month in the user's timezone; like the
+// income-vs-expense report it leaves out opening balances and counts only
+// the user's own transactions. The other sections cover what the matching
+// list endpoints would return.
+type Dashboard struct {
+	GeneratedAt        time.Time            `json:"generated_at"`
+	TotalBalance       float64              `json:"total_balance"`
+	Month              MonthlyReport        `json:"month"`
+	TopCategories      []CategoryTotal      `json:"top_categories"`
+	Budgets            []BudgetProgress     `json:"budgets"`
+	Upcoming           []UpcomingOccurrence `json:"upcoming"`
+	RecentTransactions []ActivityItem       `json:"recent_transactions"`
+}
+
+// CategoryTotal is the spending in one category, with its style from GET
+// /categories/meta, or null meta when it has none.
+type CategoryTotal struct {
+	Category string         `json:"category"`
+	Total    float64        `json:"total"`
+	Meta     *CategoryStyle `json:"meta"`
+}
+
+// runConcurrently runs tasks in parallel and returns their errors joined.
+func runConcurrently(tasks ...func() error) error {
+	errs := make([]error, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = task()
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// dashboardHandler serves GET /dashboard. Each section is a separate query
+// bounded to what it shows, and the sections are loaded concurrently.
+func (app *App) dashboardHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	month := reportPeriods["month"]
+	start := month.start(localDay(now, loc))
+	from, to := dayStart(start, loc), dayStart(month.next(start), loc)
+
+	d := Dashboard{GeneratedAt: now.UTC().Truncate(time.Second)}
+	d.Month.Period = month.label(start)
+	q := app.requestDB(r)
+	err := runConcurrently(
+		func() error {
+			return q.QueryRow("SELECT COALESCE(SUM(balance), 0) FROM accounts WHERE "+householdScope, userID, userID).Scan(&d.TotalBalance)
+		},
+		func() error {
+			return q.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM incomes WHERE user_id = ? AND opening_balance = 0 AND date >= ? AND date < ?", userID, from, to).Scan(&d.Month.Income)
+		},
+		func() error {
+			return q.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM expenses WHERE user_id = ? AND date >= ? AND date < ?", userID, from, to).Scan(&d.Month.Expense)
+		},
+		func() (err error) {
+			d.TopCategories, err = topCategories(q, userID, from, to, dashboardTopCategories)
+			return err
+		},
+		func() (err error) {
+			d.Budgets, err = activeBudgetProgress(q, userID, now.UTC())
+			return err
+		},
+		func() (err error) {
+			d.Upcoming, err = nextOccurrences(q, userID, dashboardUpcoming)
+			return err
+		},
+		func() (err error) {
+			d.RecentTransactions, err = loadActivity(q, userID, transactionTypes, "", nil, dashboardRecent, 0, nil)
+			return err
+		},
+	)
+	if err != nil {
+		log.Printf("dashboard error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	d.TotalBalance = roundCents(d.TotalBalance)
+	d.Month.Income = roundCents(d.Month.Income)
+	d.Month.Expense = roundCents(d.Month.Expense)
+	d.Month.Net = roundCents(d.Month.Income - d.Month.Expense)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// topCategories returns the limit categories with the most spending between
+// from and to, split expenses counting towards each split's category.
+func topCategories(q querier, userID int, from, to string, limit int) ([]CategoryTotal, error) {
+	rows, err := q.Query("SELECT category, SUM(amount) AS total FROM "+expenseCategoryLines+" WHERE user_id = ? AND date >= ? AND date < ? GROUP BY category ORDER BY total DESC, category LIMIT ?",
+		userID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []CategoryTotal{}
+	for rows.Next() {
+		var t CategoryTotal
+		if err := rows.Scan(&t.Category, &t.Total); err != nil {
+			return nil, err
+		}
+		t.Total = roundCents(t.Total)
+		totals = append(totals, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return totals, attachCategoryMeta(q, userID, totals)
+}
+
+// activeBudgetProgress reports spending against every budget running at now,
+// in the instance of its period_type holding now.
+func activeBudgetProgress(q querier, userID int, now time.Time) ([]BudgetProgress, error) {
+	stamp := now.Format(timeFormat)
+	rows, err := q.Query("SELECT id FROM budgets WHERE start_date <= ? AND end_date >= ? AND "+householdScope+" ORDER BY end_date, id", stamp, stamp, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	cal, err := loadBudgetCalendar(q, userID)
+	if err != nil {
+		return nil, err
+	}
+	progress := []BudgetProgress{}
+	for _, id := range ids {
+		b, err := fetchBudget(q, userID, id)
+		if err != nil {
+			return nil, err
+		}
+		p, err := budgetProgressAt(q, b, now, cal)
+		if err != nil {
+			return nil, err
+		}
+		progress = append(progress, p)
+	}
+	return progress, nil
+}
+
+// nextOccurrences returns the next limit occurrences across the user's
+// active recurring expenses. They can only come from the limit schedules
+// due soonest, so only those are loaded and projected.
+func nextOccurrences(q querier, userID, limit int) ([]UpcomingOccurrence, error) {
+	rows, err := q.Query("SELECT id, amount, category, COALESCE(note, ''), frequency, frequency_interval, next_due_date, COALESCE(anchor_day, 0) FROM recurring_expenses WHERE user_id = ? AND paused = 0 ORDER BY next_due_date, id LIMIT ?", userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occurrences := []UpcomingOccurrence{}
+	for rows.Next() {
+		var re RecurringExpense
+		var nextDueDateStr string
+		if err := rows.Scan(&re.ID, &re.Amount, &re.Category, &re.Note, &re.Frequency, &re.Interval, &nextDueDateStr, &re.AnchorDay); err != nil {
+			return nil, err
+		}
+		if re.NextDueDate, err = parseTimestamp(nextDueDateStr); err != nil {
+			return nil, err
+		}
+		due := re.NextDueDate
+		for i := 0; i < limit; i++ {
+			occurrences = append(occurrences, UpcomingOccurrence{
+				RecurringExpenseID: re.ID,
+				Date:               due,
+				Amount:             re.Amount,
+				Category:           re.Category,
+				Note:               re.Note,
+			})
+			due = nextOccurrence(re.Frequency, re.Interval, due, re.AnchorDay)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Date.Before(occurrences[j].Date)
+	})
+	if len(occurrences) > limit {
+		occurrences = occurrences[:limit]
+	}
+	return occurrences, nil
+}
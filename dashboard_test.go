@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	useTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	savings := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Savings", Type: "bank", Balance: 1000}))
+	for _, e := range []Expense{
+		{Amount: 50, Category: "Food"},
+		{Amount: 30, Category: "Transport"},
+		{Amount: 20, Category: "Fun"},
+		{Amount: 10, Category: "Books"},
+		{Amount: 40, Category: "Mixed", Splits: []ExpenseSplit{{Category: "Fun", Amount: 25}, {Category: "Books", Amount: 15}}},
+	} {
+		e.Date = now
+		e.AccountID = &savings.ID
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+	income := decodeBody[Income](t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 500, Source: "Salary", Date: now.Add(time.Second), AccountID: &savings.ID}))
+	expectStatus(t, callAuthed(http.MethodPost, "/budgets", Budget{Category: "Food", Amount: 200, StartDate: now.AddDate(0, 0, -1), EndDate: now.AddDate(0, 0, 1)}), http.StatusCreated)
+	expectStatus(t, callAuthed(http.MethodPost, "/budgets", Budget{Category: "Food", Amount: 200, StartDate: now.AddDate(0, -3, 0), EndDate: now.AddDate(0, -2, 0)}), http.StatusCreated)
+	for _, re := range []RecurringExpense{
+		{Amount: 5, Category: "Coffee", Frequency: "daily", NextDueDate: now.AddDate(0, 0, 1)},
+		{Amount: 100, Category: "Rent", Frequency: "monthly", NextDueDate: now.AddDate(0, 0, 3)},
+	} {
+		expectStatus(t, callAuthed(http.MethodPost, "/recurring-expenses", re), http.StatusCreated)
+	}
+
+	d := decodeBody[Dashboard](t, callAuthed(http.MethodGet, "/dashboard", nil))
+
+	if d.GeneratedAt.IsZero() || d.TotalBalance != 1000-150+500 {
+		t.Fatalf("unexpected header: generated_at %v, total balance %v", d.GeneratedAt, d.TotalBalance)
+	}
+	if d.Month.Period != now.Format("2006-01") || d.Month.Income != 500 || d.Month.Expense != 150 || d.Month.Net != 350 {
+		t.Fatalf("unexpected month: %+v", d.Month)
+	}
+	if len(d.TopCategories) != 3 || d.TopCategories[0] != (CategoryTotal{"Food", 50, nil}) || d.TopCategories[1] != (CategoryTotal{"Fun", 45, nil}) || d.TopCategories[2] != (CategoryTotal{"Transport", 30, nil}) {
+		t.Fatalf("unexpected top categories: %+v", d.TopCategories)
+	}
+	if len(d.Budgets) != 1 || d.Budgets[0].Spent != 50 || d.Budgets[0].PercentUsed != 25 {
+		t.Fatalf("expected only the running budget, got %+v", d.Budgets)
+	}
+
+	// The rent lands among the daily coffees, after the one due the same day.
+	if len(d.Upcoming) != 5 || d.Upcoming[2].Category != "Coffee" || d.Upcoming[3].Category != "Rent" || d.Upcoming[4].Category != "Coffee" {
+		t.Fatalf("unexpected upcoming occurrences: %+v", d.Upcoming)
+	}
+
+	if len(d.RecentTransactions) != 7 {
+		t.Fatalf("expected the five expenses and both incomes, got %+v", d.RecentTransactions)
+	}
+	if first := d.RecentTransactions[0]; first.Type != "income" || first.ID != income.ID || first.Source != "Salary" {
+		t.Fatalf("expected the income first, got %+v", first)
+	}
+	if rest := d.RecentTransactions[1]; rest.Type != "expense" || rest.Category != "Mixed" {
+		t.Fatalf("expected the newest expense next, got %+v", rest)
+	}
+	if last := d.RecentTransactions[6]; last.Type != "income" || last.Source != openingBalanceSource {
+		t.Fatalf("expected the opening balance last, got %+v", last)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The date fields of expenses, incomes, budgets and recurring expenses
+// accept three input forms:
+//
+//	2024-03-31                 a calendar day in the user's timezone
+//	2024-03-31T23:00:00+07:00  RFC 3339, with or without fractional seconds
+//	2024-03-31 16:00:00        the legacy storage format, read as UTC
+//
+// and are always written as RFC 3339 in UTC with whole seconds, which is
+// what is stored. Recurring schedules step through UTC days, so a date-only
+// next_due_date is midnight UTC rather than in the user's timezone.
+
+// dateOnlyZone is the location of times read from a bare YYYY-MM-DD. Such a
+// value names a day rather than an instant until pinDates places it in the
+// user's timezone; left alone it reads as midnight UTC.
+var dateOnlyZone = time.FixedZone("date-only", 0)
+
+// inputTime unmarshals from any of the accepted input forms.
+type inputTime struct{ time.Time }
+
+func (t *inputTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("dates must be strings, got %s", data)
+	}
+	parsed, err := parseInputTime(s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+func parseInputTime(s string) (time.Time, error) {
+	if day, err := time.Parse(statsDateFormat, s); err == nil {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, dateOnlyZone), nil
+	}
+	// RFC3339Nano also parses values without fractional seconds.
+	for _, layout := range []string{time.RFC3339Nano, timeFormat} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD, RFC 3339, or YYYY-MM-DD HH:MM:SS", s)
+}
+
+// outputTime is how a date field is written: UTC, truncated to the second
+// like the stored value.
+func outputTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// pinDates places date-only values in userID's timezone, at midnight. It
+// only looks the timezone up when there is one, and writes a 500 if that
+// fails.
+func (app *App) pinDates(w http.ResponseWriter, userID int, times ...*time.Time) bool {
+	var loc *time.Location
+	for _, t := range times {
+		if t.Location() != dateOnlyZone {
+			continue
+		}
+		if loc == nil {
+			var ok bool
+			if loc, ok = app.userLocation(w, userID); !ok {
+				return false
+			}
+		}
+		*t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+	return true
+}
+
+// decodeStrict decodes data rejecting unknown fields. Types with their own
+// UnmarshalJSON use it because the caller's DisallowUnknownFields does not
+// reach into them.
+func decodeStrict(data []byte, dst interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(dst)
+}
+
+// The methods below swap the date fields for inputTime on the way in and
+// normalize them on the way out, and check the amount with parseAmount.
+// Converting to a local plain type drops the methods, so encoding/json
+// handles everything else as usual.
+
+func (e *Expense) UnmarshalJSON(data []byte) error {
+	type plain Expense
+	aux := struct {
+		*plain
+		Amount json.RawMessage `json:"amount"`
+		Date   *inputTime      `json:"date"`
+	}{plain: (*plain)(e)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	if aux.Date != nil {
+		e.Date = aux.Date.Time
+	}
+	if aux.Amount != nil {
+		amount, err := parseAmount("amount", aux.Amount)
+		if err != nil {
+			return err
+		}
+		e.Amount = amount
+	}
+	return nil
+}
+
+func (e Expense) MarshalJSON() ([]byte, error) {
+	type plain Expense
+	e.Date = outputTime(e.Date)
+	e.Timestamps = e.Timestamps.utc()
+	if e.expanded[expandAccount] {
+		// Written even when nil, which omitempty would leave out.
+		return json.Marshal(struct {
+			plain
+			Account *AccountSummary `json:"account"`
+		}{plain(e), e.Account})
+	}
+	return json.Marshal(plain(e))
+}
+
+func (i *Income) UnmarshalJSON(data []byte) error {
+	type plain Income
+	aux := struct {
+		*plain
+		Amount json.RawMessage `json:"amount"`
+		Date   *inputTime      `json:"date"`
+	}{plain: (*plain)(i)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	if aux.Date != nil {
+		i.Date = aux.Date.Time
+	}
+	if aux.Amount != nil {
+		amount, err := parseAmount("amount", aux.Amount)
+		if err != nil {
+			return err
+		}
+		i.Amount = amount
+	}
+	return nil
+}
+
+func (i Income) MarshalJSON() ([]byte, error) {
+	type plain Income
+	i.Date = outputTime(i.Date)
+	i.Timestamps = i.Timestamps.utc()
+	if i.expanded[expandAccount] {
+		return json.Marshal(struct {
+			plain
+			Account *AccountSummary `json:"account"`
+		}{plain(i), i.Account})
+	}
+	return json.Marshal(plain(i))
+}
+
+func (b *Budget) UnmarshalJSON(data []byte) error {
+	type plain Budget
+	aux := struct {
+		*plain
+		Amount    json.RawMessage `json:"amount"`
+		StartDate *inputTime      `json:"start_date"`
+		EndDate   *inputTime      `json:"end_date"`
+	}{plain: (*plain)(b)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	if aux.StartDate != nil {
+		b.StartDate = aux.StartDate.Time
+	}
+	if aux.EndDate != nil {
+		b.EndDate = aux.EndDate.Time
+	}
+	if aux.Amount != nil {
+		amount, err := parseAmount("amount", aux.Amount)
+		if err != nil {
+			return err
+		}
+		b.Amount = amount
+	}
+	return nil
+}
+
+// is_active is worked out as the budget is written, so it is current however
+// the budget was loaded.
+func (b Budget) MarshalJSON() ([]byte, error) {
+	type plain Budget
+	b.IsActive = b.activeAt(time.Now())
+	b.StartDate = outputTime(b.StartDate)
+	b.EndDate = outputTime(b.EndDate)
+	b.Timestamps = b.Timestamps.utc()
+	return json.Marshal(plain(b))
+}
+
+func (c *BudgetClone) UnmarshalJSON(data []byte) error {
+	type plain BudgetClone
+	aux := struct {
+		*plain
+		Amount    json.RawMessage `json:"amount"`
+		StartDate *inputTime      `json:"start_date"`
+		EndDate   *inputTime      `json:"end_date"`
+	}{plain: (*plain)(c)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	if aux.StartDate != nil {
+		c.StartDate = aux.StartDate.Time
+	}
+	if aux.EndDate != nil {
+		c.EndDate = aux.EndDate.Time
+	}
+	var err error
+	c.Amount, err = parseOptionalAmount("amount", aux.Amount)
+	return err
+}
+
+func (re *RecurringExpense) UnmarshalJSON(data []byte) error {
+	type plain RecurringExpense
+	aux := struct {
+		*plain
+		Amount      json.RawMessage `json:"amount"`
+		NextDueDate *inputTime      `json:"next_due_date"`
+	}{plain: (*plain)(re)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	if aux.NextDueDate != nil {
+		re.NextDueDate = aux.NextDueDate.Time
+	}
+	if aux.Amount != nil {
+		amount, err := parseAmount("amount", aux.Amount)
+		if err != nil {
+			return err
+		}
+		re.Amount = amount
+	}
+	return nil
+}
+
+func (re RecurringExpense) MarshalJSON() ([]byte, error) {
+	type plain RecurringExpense
+	re.NextDueDate = outputTime(re.NextDueDate)
+	if re.LastGeneratedAt != nil {
+		last := outputTime(*re.LastGeneratedAt)
+		re.LastGeneratedAt = &last
+	}
+	re.Timestamps = re.Timestamps.utc()
+	return json.Marshal(plain(re))
+}
+
+const (
+	// earliestTransactionYear is the first year, in the user's timezone, an
+	// expense or income may fall in.
+	earliestTransactionYear = 1970
+	// maxOverdueYears is how far before today a recurring expense may
+	// already be due.
+	maxOverdueYears = 1
+)
+
+const (
+	dateErrorTooEarly = "date_too_early"
+	dateErrorTooLate  = "date_too_far_in_future"
+)
+
+// dateRangeError is the body of a 422 for a date outside the range a field
+// accepts. Date is the value as the server understood it and Day the
+// calendar day that is in the zone it was checked in, so a client can show
+// why a typo was refused; Limit is the nearest day that would be accepted.
+type dateRangeError struct {
+	apiError
+	Field string    `json:"field"`
+	Date  time.Time `json:"date"`
+	Day   string    `json:"day"`
+	Limit string    `json:"limit"`
+}
+
+// checkDateRange writes a 422 and returns false when date, as a calendar
+// day in loc, is before earliest or after latest. A zero bound is not
+// checked.
+func checkDateRange(w http.ResponseWriter, field string, date time.Time, loc *time.Location, earliest, latest time.Time) bool {
+	day := localDay(date, loc)
+	e := dateRangeError{Field: field, Date: outputTime(date), Day: day.Format(statsDateFormat)}
+	switch {
+	case !earliest.IsZero() && day.Before(earliest):
+		e.Code, e.Limit = dateErrorTooEarly, earliest.Format(statsDateFormat)
+		e.Error = fmt.Sprintf("%s %s is before %s", field, e.Day, e.Limit)
+	case !latest.IsZero() && day.After(latest):
+		e.Code, e.Limit = dateErrorTooLate, latest.Format(statsDateFormat)
+		e.Error = fmt.Sprintf("%s %s is after %s", field, e.Day, e.Limit)
+	default:
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(e)
+	return false
+}
+
+// checkTransactionDate refuses an expense or income date before 1970 or
+// more than Config.MaxFutureDays after today, both in userID's timezone, so a typo
+// such as 2205 cannot stretch every report's range.
+func (app *App) checkTransactionDate(w http.ResponseWriter, userID int, date time.Time) bool {
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return false
+	}
+	earliest := time.Date(earliestTransactionYear, 1, 1, 0, 0, 0, 0, time.UTC)
+	latest := localDay(time.Now(), loc).AddDate(0, 0, app.cfg.MaxFutureDays)
+	return checkDateRange(w, "date", date, loc, earliest, latest)
+}
+
+// checkNextDueDate refuses a recurring expense due more than
+// maxOverdueYears ago, which would generate a year's worth of catch-up
+// expenses at once. Any future date is fine. Schedules run on UTC days, so
+// that is where the day is taken.
+func checkNextDueDate(w http.ResponseWriter, date time.Time) bool {
+	earliest := localDay(time.Now(), time.UTC).AddDate(-maxOverdueYears, 0, 0)
+	return checkDateRange(w, "next_due_date", date, time.UTC, earliest, time.Time{})
+}
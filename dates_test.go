@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDateInputs(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, min, sec, nsec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+	}
+	cases := []struct {
+		input    string
+		want     time.Time
+		dateOnly bool
+		err      bool
+	}{
+		{input: `"2024-03-31"`, want: utc(2024, 3, 31, 0, 0, 0, 0), dateOnly: true},
+		{input: `"2024-02-29"`, want: utc(2024, 2, 29, 0, 0, 0, 0), dateOnly: true},
+		{input: `"2024-03-31T16:00:00Z"`, want: utc(2024, 3, 31, 16, 0, 0, 0)},
+		{input: `"2024-03-31T23:00:00+07:00"`, want: utc(2024, 3, 31, 16, 0, 0, 0)},
+		{input: `"2024-03-31T12:00:00-04:00"`, want: utc(2024, 3, 31, 16, 0, 0, 0)},
+		{input: `"2024-03-31T16:00:00.25Z"`, want: utc(2024, 3, 31, 16, 0, 0, 250000000)},
+		{input: `"2024-03-31T16:00:00.123456789+00:00"`, want: utc(2024, 3, 31, 16, 0, 0, 123456789)},
+		{input: `"2024-03-31 16:00:00"`, want: utc(2024, 3, 31, 16, 0, 0, 0)},
+		{input: `"2023-02-29"`, err: true},
+		{input: `"2024-3-31"`, err: true},
+		{input: `"31/03/2024"`, err: true},
+		{input: `"2024-03-31T16:00:00"`, err: true},
+		{input: `"2024-03-31T16:00Z"`, err: true},
+		{input: `"2024-03-31 16:00:00Z"`, err: true},
+		{input: `""`, err: true},
+		{input: `1711900800`, err: true},
+		{input: `true`, err: true},
+	}
+	for _, c := range cases {
+		var e Expense
+		err := json.Unmarshal([]byte(`{"amount": 1, "date": `+c.input+`}`), &e)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", c.input, e.Date)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.input, err)
+			continue
+		}
+		if !e.Date.Equal(c.want) || (e.Date.Location() == dateOnlyZone) != c.dateOnly {
+			t.Errorf("%s: got %v, want %v (date-only %v)", c.input, e.Date, c.want, c.dateOnly)
+		}
+	}
+
+	// A missing or null date is left for the handler to default.
+	for _, body := range []string{`{"amount": 1}`, `{"amount": 1, "date": null}`} {
+		var e Expense
+		if err := json.Unmarshal([]byte(body), &e); err != nil || !e.Date.IsZero() || e.Amount != 1 {
+			t.Errorf("%s: got %+v, %v", body, e, err)
+		}
+	}
+
+	// Replacing the decoding must not loosen it.
+	var e Expense
+	if err := json.Unmarshal([]byte(`{"amount": 1, "when": "2024-03-31"}`), &e); err == nil {
+		t.Error("expected unknown fields to be rejected")
+	}
+}
+
+func TestDateSerialization(t *testing.T) {
+	useTestDB(t)
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Timezone: "Asia/Jakarta"}), http.StatusOK)
+
+	// A date-only value is midnight in the user's zone, 17:00 UTC the day
+	// before in Jakarta; anything else is written back as RFC 3339 UTC.
+	cases := []struct {
+		path, field string
+		body        map[string]interface{}
+		want        map[string]string
+	}{
+		{"/expenses", "date",
+			map[string]interface{}{"amount": 5, "category": "Food", "date": "2024-04-01", "account_id": testAccountID},
+			map[string]string{"date": "2024-03-31T17:00:00Z"}},
+		{"/incomes", "date",
+			map[string]interface{}{"amount": 5, "source": "Salary", "date": "2024-04-01T09:30:00.75+07:00", "account_id": testAccountID},
+			map[string]string{"date": "2024-04-01T02:30:00Z"}},
+		{"/budgets", "start_date",
+			map[string]interface{}{"amount": 100, "category": "Food", "start_date": "2024-04-01", "end_date": "2024-04-30 16:59:59"},
+			map[string]string{"start_date": "2024-03-31T17:00:00Z", "end_date": "2024-04-30T16:59:59Z"}},
+		{"/recurring-expenses", "next_due_date",
+			map[string]interface{}{"amount": 9, "category": "Streaming", "frequency": "monthly", "next_due_date": "2099-04-01"},
+			map[string]string{"next_due_date": "2099-04-01T00:00:00Z"}},
+	}
+	for _, c := range cases {
+		rr := callAuthed(http.MethodPost, c.path, c.body)
+		expectStatus(t, rr, http.StatusCreated)
+		id := decodeBody[struct{ ID int }](t, rr).ID
+
+		responses := map[string]*httptest.ResponseRecorder{
+			"create": rr,
+			"get":    callAuthed(http.MethodGet, fmt.Sprintf("%s/%d", c.path, id), nil),
+		}
+		for name, rr := range responses {
+			got := decodeBody[map[string]interface{}](t, rr)
+			for field, want := range c.want {
+				if got[field] != want {
+					t.Errorf("%s %s: %s = %v, want %s", name, c.path, field, got[field], want)
+				}
+			}
+			for _, field := range []string{"created_at", "updated_at"} {
+				if s, _ := got[field].(string); !strings.HasSuffix(s, "Z") {
+					t.Errorf("%s %s: %s = %v, want RFC 3339 UTC", name, c.path, field, got[field])
+				}
+			}
+		}
+
+		bad := map[string]interface{}{}
+		for k, v := range c.body {
+			bad[k] = v
+		}
+		bad[c.field] = "01/04/2024"
+		expectStatus(t, callAuthed(http.MethodPost, c.path, bad), http.StatusBadRequest)
+	}
+}
+
+func TestTransactionDateRange(t *testing.T) {
+	useTestDB(t)
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Timezone: "Asia/Jakarta"}), http.StatusOK)
+	jakarta, _ := time.LoadLocation("Asia/Jakarta")
+	today := localDay(time.Now(), jakarta)
+	day := func(offset int) string { return today.AddDate(0, 0, offset).Format(statsDateFormat) }
+
+	expense := func(date string) *httptest.ResponseRecorder {
+		return callAuthed(http.MethodPost, "/expenses", map[string]interface{}{"amount": 5, "category": "Food", "date": date, "account_id": testAccountID})
+	}
+	refused := func(rr *httptest.ResponseRecorder, code, day, limit string) {
+		t.Helper()
+		expectStatus(t, rr, http.StatusUnprocessableEntity)
+		e := decodeBody[dateRangeError](t, rr)
+		if e.Code != code || e.Field != "date" || e.Day != day || e.Limit != limit || e.Date.IsZero() {
+			t.Fatalf("expected %s for %s with limit %s, got %+v", code, day, limit, e)
+		}
+	}
+
+	// Tomorrow in the user's timezone is the last day allowed.
+	expectStatus(t, expense(day(1)), http.StatusCreated)
+	refused(expense(day(2)), dateErrorTooLate, day(2), day(1))
+
+	// The day is taken in the user's timezone, not UTC: midnight in Jakarta
+	// two days on is still tomorrow in UTC, but refused.
+	midnight := time.Date(today.Year(), today.Month(), today.Day()+2, 0, 0, 0, 0, jakarta)
+	refused(expense(midnight.UTC().Format(time.RFC3339)), dateErrorTooLate, day(2), day(1))
+	expectStatus(t, expense(midnight.Add(-time.Second).Format(time.RFC3339)), http.StatusCreated)
+
+	// Likewise 1970-01-01 in Jakarta is accepted though it begins in 1969 UTC.
+	rr := expense("1970-01-01")
+	expectStatus(t, rr, http.StatusCreated)
+	if got := decodeBody[Expense](t, rr).Date; !got.Equal(time.Date(1969, 12, 31, 17, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected 1970-01-01 pinned to Jakarta midnight, got %v", got)
+	}
+	refused(expense("1969-12-31"), dateErrorTooEarly, "1969-12-31", "1970-01-01")
+
+	// A typo'd year is echoed back as understood.
+	rr = callAuthed(http.MethodPost, "/incomes", map[string]interface{}{"amount": 5, "source": "Salary", "date": "2205-03-01", "account_id": testAccountID})
+	refused(rr, dateErrorTooLate, "2205-03-01", day(1))
+	if e := decodeBody[dateRangeError](t, rr); !e.Date.Equal(time.Date(2205, 2, 28, 17, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the pinned date echoed, got %v", e.Date)
+	}
+
+	// Updates are held to the same range.
+	created := decodeBody[Income](t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 5, Source: "Salary", AccountID: testAccount()}))
+	rr = callAuthed(http.MethodPut, fmt.Sprintf("/incomes/%d", created.ID), map[string]interface{}{"amount": 5, "source": "Salary", "date": "2205-03-01", "account_id": testAccountID})
+	refused(rr, dateErrorTooLate, "2205-03-01", day(1))
+
+	// The allowance is configurable.
+	testApp.cfg.MaxFutureDays = 0
+	refused(expense(day(1)), dateErrorTooLate, day(1), day(0))
+}
+
+func TestUpdateKeepsOmittedDate(t *testing.T) {
+	useTestDB(t)
+	date := time.Date(2024, time.January, 15, 9, 30, 0, 0, time.UTC)
+	expense := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 12, Category: "Food", Date: date, AccountID: testAccount()}))
+	income := decodeBody[Income](t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 100, Source: "Salary", Date: date, AccountID: testAccount()}))
+
+	// Editing only the note leaves the date where it was, in the response
+	// and in storage.
+	edits := []struct {
+		target  string
+		payload map[string]interface{}
+	}{
+		{fmt.Sprintf("/expenses/%d", expense.ID), map[string]interface{}{"amount": 12, "category": "Food", "note": "Edited"}},
+		{fmt.Sprintf("/incomes/%d", income.ID), map[string]interface{}{"amount": 100, "source": "Salary", "note": "Edited", "date": nil}},
+	}
+	for _, edit := range edits {
+		rr := callAuthed(http.MethodPut, edit.target, edit.payload)
+		expectStatus(t, rr, http.StatusOK)
+		var updated struct {
+			Note string    `json:"note"`
+			Date time.Time `json:"date"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &updated); err != nil {
+			t.Fatal(err)
+		}
+		if updated.Note != "Edited" || !updated.Date.Equal(date) {
+			t.Fatalf("%s: expected the note edited and the date kept at %v, got %+v", edit.target, date, updated)
+		}
+		if err := json.Unmarshal(callAuthed(http.MethodGet, edit.target, nil).Body.Bytes(), &updated); err != nil {
+			t.Fatal(err)
+		}
+		if !updated.Date.Equal(date) {
+			t.Fatalf("%s: expected the stored date kept at %v, got %v", edit.target, date, updated.Date)
+		}
+	}
+
+	// A date that is sent still replaces it.
+	moved := decodeBody[Expense](t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", expense.ID), map[string]interface{}{"amount": 12, "category": "Food", "date": "2024-02-01T00:00:00Z"}))
+	if !moved.Date.Equal(time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the sent date, got %v", moved.Date)
+	}
+}
+
+func TestNextDueDateRange(t *testing.T) {
+	useTestDB(t)
+	today := localDay(time.Now(), time.UTC)
+	recurring := func(due time.Time) *httptest.ResponseRecorder {
+		return callAuthed(http.MethodPost, "/recurring-expenses", RecurringExpense{Amount: 9, Category: "Streaming", Frequency: "yearly", NextDueDate: due})
+	}
+
+	expectStatus(t, recurring(time.Date(2205, 3, 1, 0, 0, 0, 0, time.UTC)), http.StatusCreated)
+	oldest := today.AddDate(-1, 0, 0)
+	created := decodeBody[RecurringExpense](t, recurring(oldest))
+
+	rr := recurring(oldest.Add(-time.Second))
+	expectStatus(t, rr, http.StatusUnprocessableEntity)
+	if e := decodeBody[dateRangeError](t, rr); e.Code != dateErrorTooEarly || e.Field != "next_due_date" || e.Limit != oldest.Format(statsDateFormat) {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+
+	created.NextDueDate = oldest.AddDate(0, 0, -1)
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/recurring-expenses/%d", created.ID), created), http.StatusUnprocessableEntity)
+}
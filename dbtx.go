@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Handlers given a DBTX reach the database only through it, so tests can
+// hand them one that fails on demand and check what a failed begin,
+// statement, or commit does to the response and to the stored data.
+
+// DBTX is the database as handlers use it. sqlDB is the real one.
+type DBTX interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+}
+
+// Tx is a transaction begun through a DBTX; *sql.Tx is one.
+type Tx interface {
+	txQuerier
+	Commit() error
+	Rollback() error
+}
+
+// txQuerier runs statements inside a transaction. Helpers that write as
+// part of a handler's transaction take it rather than *sql.Tx, so they
+// work with any Tx.
+type txQuerier interface {
+	querier
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// sqlDB is the DBTX of a *sql.DB.
+type sqlDB struct {
+	db *sql.DB
+}
+
+func (s sqlDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, query, args...)
+}
+
+func (s sqlDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRowContext(ctx, query, args...)
+}
+
+func (s sqlDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.db.ExecContext(ctx, query, args...)
+}
+
+func (s sqlDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// contextDB is a DBTX as a querier, running its queries under ctx.
+type contextDB struct {
+	db  DBTX
+	ctx context.Context
+}
+
+func (c contextDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+func (c contextDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingDB is the real database except where it is told to fail: BeginTx
+// when failBegin is set, a transaction's statements containing failExec,
+// and Commit, which rolls back instead, when failCommit is set.
+type failingDB struct {
+	sqlDB
+	failBegin  bool
+	failExec   string
+	failCommit bool
+}
+
+func (f failingDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	if f.failBegin {
+		return nil, errInjected
+	}
+	tx, err := f.sqlDB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return failingTx{tx, f}, nil
+}
+
+type failingTx struct {
+	Tx
+	f failingDB
+}
+
+func (t failingTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if t.f.failExec != "" && strings.Contains(query, t.f.failExec) {
+		return nil, errInjected
+	}
+	return t.Tx.Exec(query, args...)
+}
+
+func (t failingTx) Commit() error {
+	if t.f.failCommit {
+		t.Tx.Rollback()
+		return errInjected
+	}
+	return t.Tx.Commit()
+}
+
+// serveWithDB serves req from an App whose handlers reach testApp's
+// database through d.
+func serveWithDB(d failingDB, req *http.Request) *httptest.ResponseRecorder {
+	d.sqlDB = sqlDB{testApp.db}
+	app := NewApp(testApp.db, testApp.cfg)
+	app.dbtx = d
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, req)
+	return rr
+}
+
+// storedState summarizes what the handlers write, to show a failed
+// request left none of it behind.
+func storedState(t *testing.T) string {
+	t.Helper()
+	var expenses, incomes, audits int
+	var expenseTotal, incomeTotal, balance float64
+	err := testApp.db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM expenses), (SELECT COALESCE(SUM(amount), 0) FROM expenses),
+		(SELECT COUNT(*) FROM incomes), (SELECT COALESCE(SUM(amount), 0) FROM incomes),
+		(SELECT COUNT(*) FROM audit_log), (SELECT balance FROM accounts WHERE id = ?)`, testAccountID).
+		Scan(&expenses, &expenseTotal, &incomes, &incomeTotal, &audits, &balance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("expenses=%d/%.2f incomes=%d/%.2f audit=%d balance=%.2f",
+		expenses, expenseTotal, incomes, incomeTotal, audits, balance)
+}
+
+func TestTransactionFailures(t *testing.T) {
+	useTestDB(t)
+	expense := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 20, Category: "Food", AccountID: testAccount()}))
+	income := decodeBody[Income](t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 100, Source: "Salary", AccountID: testAccount()}))
+
+	requests := []struct {
+		name    string
+		method  string
+		target  string
+		payload interface{}
+	}{
+		{"create expense", http.MethodPost, "/expenses", Expense{Amount: 5, Category: "Food", AccountID: testAccount()}},
+		{"update expense", http.MethodPut, fmt.Sprintf("/expenses/%d", expense.ID), Expense{Amount: 35, Category: "Rent", Date: expense.Date, AccountID: testAccount()}},
+		{"delete expense", http.MethodDelete, fmt.Sprintf("/expenses/%d", expense.ID), nil},
+		{"create income", http.MethodPost, "/incomes", Income{Amount: 50, Source: "Bonus", AccountID: testAccount()}},
+		{"update income", http.MethodPut, fmt.Sprintf("/incomes/%d", income.ID), Income{Amount: 150, Source: "Salary", Date: income.Date, AccountID: testAccount()}},
+		{"delete income", http.MethodDelete, fmt.Sprintf("/incomes/%d", income.ID), nil},
+	}
+	failures := []struct {
+		name string
+		db   failingDB
+	}{
+		{"begin", failingDB{failBegin: true}},
+		// The audit entry is written last, after the row and the balance.
+		{"exec", failingDB{failExec: "INSERT INTO audit_log"}},
+		{"commit", failingDB{failCommit: true}},
+	}
+
+	for _, req := range requests {
+		for _, f := range failures {
+			t.Run(req.name+"/"+f.name, func(t *testing.T) {
+				before := storedState(t)
+				rr := serveWithDB(f.db, authedRequest(req.method, req.target, req.payload))
+				expectStatus(t, rr, http.StatusInternalServerError)
+				if strings.Contains(rr.Body.String(), errInjected.Error()) {
+					t.Fatalf("expected the cause to stay out of the response, got %q", rr.Body.String())
+				}
+				if after := storedState(t); after != before {
+					t.Fatalf("expected no partial writes, had %s and now %s", before, after)
+				}
+			})
+		}
+	}
+
+	// The same requests go through once nothing fails.
+	for _, req := range requests {
+		rr := serveWithDB(failingDB{}, authedRequest(req.method, req.target, req.payload))
+		if rr.Code >= 300 {
+			t.Fatalf("%s: unexpected status %d (body: %s)", req.name, rr.Code, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Expenses and incomes can embed related records with ?expand=, a list of
+// names taken like category, so a client showing each expense's account
+// does not have to join it against GET /accounts. Each endpoint accepts its
+// own names and refuses others with 400. An expanded item carries the
+// record even when it would otherwise hold only an ID, and null when there
+// is none, such as an expense not linked to an account.
+
+const expandAccount = "account"
+
+// AccountSummary is an account as ?expand=account embeds it.
+type AccountSummary struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// expandSet is what a request's ?expand= asked for.
+type expandSet map[string]bool
+
+// parseExpand reads ?expand=, writing a 400 for a name not in allowed.
+func parseExpand(w http.ResponseWriter, params url.Values, allowed ...string) (expandSet, bool) {
+	expand := expandSet{}
+	for _, name := range parseListParam(params, "expand") {
+		if !slices.Contains(allowed, name) {
+			http.Error(w, "Invalid expand; use one of "+strings.Join(allowed, ", "), http.StatusBadRequest)
+			return nil, false
+		}
+		expand[name] = true
+	}
+	return expand, true
+}
+
+// expansions are the joins behind each name, in the order their columns
+// follow a query's own. Each LEFT JOINs a subquery whose columns carry the
+// expansion's name, so they cannot clash with the unqualified columns of
+// the table being read. The subquery reads only rows the user can see, so
+// a row linked to someone else's account expands to null.
+var expansions = []struct {
+	name    string
+	columns string
+	join    string
+	args    func(userID int) []interface{}
+	dest    func(*expandedRow) []interface{}
+}{
+	{
+		name:    expandAccount,
+		columns: "account_expand_id, account_expand_name, account_expand_type",
+		join:    " LEFT JOIN (SELECT id AS account_expand_id, name AS account_expand_name, type AS account_expand_type FROM accounts WHERE " + householdScope + ") AS account_expand ON account_expand_id = account_id",
+		args: func(userID int) []interface{} {
+			return []interface{}{userID, userID}
+		},
+		dest: func(row *expandedRow) []interface{} {
+			return []interface{}{&row.accountID, &row.accountName, &row.accountType}
+		},
+	},
+}
+
+// columns is what s adds to the SELECT list of a query, after its own
+// columns.
+func (s expandSet) columns() string {
+	var columns string
+	for _, e := range expansions {
+		if s[e.name] {
+			columns += ", " + e.columns
+		}
+	}
+	return columns
+}
+
+// joins is what s adds to the FROM clause of a query on a table with an
+// account_id column, with the arguments it binds for userID. They come
+// before those of the query's WHERE clause.
+func (s expandSet) joins(userID int) (string, []interface{}) {
+	var joins string
+	var args []interface{}
+	for _, e := range expansions {
+		if s[e.name] {
+			joins += e.join
+			args = append(args, e.args(userID)...)
+		}
+	}
+	return joins, args
+}
+
+// dest returns a query's own scan destinations followed by those of the
+// columns s adds.
+func (s expandSet) dest(row *expandedRow, dest ...interface{}) []interface{} {
+	for _, e := range expansions {
+		if s[e.name] {
+			dest = append(dest, e.dest(row)...)
+		}
+	}
+	return dest
+}
+
+// expandedRow receives the columns an expandSet adds to a row.
+type expandedRow struct {
+	accountID   sql.NullInt64
+	accountName sql.NullString
+	accountType sql.NullString
+}
+
+// account is the row's expanded account, nil when it has none.
+func (row expandedRow) account() *AccountSummary {
+	if !row.accountID.Valid {
+		return nil
+	}
+	return &AccountSummary{ID: int(row.accountID.Int64), Name: row.accountName.String, Type: row.accountType.String}
+}
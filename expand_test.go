@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestExpandAccount(t *testing.T) {
+	useTestDB(t)
+	account := decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", testAccountID), nil))
+	want := AccountSummary{ID: account.ID, Name: account.Name, Type: account.Type}
+
+	linked := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 12, Category: "Food", AccountID: testAccount()}))
+	unlinked := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 8, Category: "Food", AccountID: testAccount()}))
+	// Expenses recorded before accounts were required have none.
+	if _, err := testApp.db.Exec("UPDATE expenses SET account_id = NULL WHERE id = ?", unlinked.ID); err != nil {
+		t.Fatal(err)
+	}
+	income := decodeBody[Income](t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 100, Source: "Salary", AccountID: testAccount()}))
+	// Nor is someone else's account embedded, should a row point at one.
+	cookie, _ := registerUser(t, "stranger@example.com", "AnotherSecurePass1!")
+	foreign := decodeBody[Account](t, callAuthedAs(cookie, http.MethodPost, "/accounts", Account{Name: "Hidden", Type: "bank"}))
+	misfiled := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 3, Category: "Food", AccountID: testAccount()}))
+	if _, err := testApp.db.Exec("UPDATE expenses SET account_id = ? WHERE id = ?", foreign.ID, misfiled.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// accounts returns the account field of each item by ID, with ok false
+	// for items that have none.
+	type embedded struct {
+		account *AccountSummary
+		ok      bool
+	}
+	accounts := func(target string) map[int]embedded {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, target, nil)
+		expectStatus(t, rr, http.StatusOK)
+		var items []map[string]json.RawMessage
+		if err := json.Unmarshal(rr.Body.Bytes(), &items); err != nil {
+			var item map[string]json.RawMessage
+			if err := json.Unmarshal(rr.Body.Bytes(), &item); err != nil {
+				t.Fatalf("decode %s: %v", target, err)
+			}
+			items = append(items, item)
+		}
+		got := map[int]embedded{}
+		for _, item := range items {
+			var id int
+			var e embedded
+			json.Unmarshal(item["id"], &id)
+			if raw, ok := item["account"]; ok {
+				e.ok = true
+				if err := json.Unmarshal(raw, &e.account); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got[id] = e
+		}
+		return got
+	}
+
+	// Filters and cursors work alongside the join.
+	for _, target := range []string{
+		"/expenses?expand=account",
+		"/expenses?expand=account&cursor=&category=Food",
+		fmt.Sprintf("/expenses?expand=account&account_id=%d", testAccountID),
+		fmt.Sprintf("/expenses/%d?expand=account", linked.ID),
+	} {
+		if e := accounts(target)[linked.ID]; e.account == nil || *e.account != want {
+			t.Fatalf("%s: expected %+v for the linked expense, got %+v", target, want, e.account)
+		}
+	}
+	for _, target := range []string{"/expenses?expand=account&account_id=null", fmt.Sprintf("/expenses/%d?expand=account", unlinked.ID)} {
+		if e := accounts(target)[unlinked.ID]; !e.ok || e.account != nil {
+			t.Fatalf("%s: expected null for the unlinked expense, got %+v", target, e)
+		}
+	}
+	for _, target := range []string{"/expenses?expand=account", fmt.Sprintf("/expenses/%d?expand=account", misfiled.ID)} {
+		if e := accounts(target)[misfiled.ID]; !e.ok || e.account != nil {
+			t.Fatalf("%s: expected null for another user's account, got %+v", target, e.account)
+		}
+	}
+	for _, target := range []string{"/incomes?expand=account&strict=true", fmt.Sprintf("/incomes/%d?expand=account", income.ID)} {
+		if e := accounts(target)[income.ID]; e.account == nil || *e.account != want {
+			t.Fatalf("%s: expected %+v for the income, got %+v", target, want, e.account)
+		}
+	}
+
+	// Without expand only account_id is sent.
+	for _, target := range []string{"/expenses", fmt.Sprintf("/expenses/%d", linked.ID), "/incomes", fmt.Sprintf("/incomes/%d", income.ID)} {
+		for id, e := range accounts(target) {
+			if e.ok {
+				t.Fatalf("%s: expected no account for %d without expand", target, id)
+			}
+		}
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses?expand=tags", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("/incomes/%d?expand=account,splits", income.ID), nil), http.StatusBadRequest)
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const exportSchemaVersion = 1
+
+type exportCounts struct {
+	Accounts          int `json:"accounts"`
+	Expenses          int `json:"expenses"`
+	Incomes           int `json:"incomes"`
+	Budgets           int `json:"budgets"`
+	RecurringExpenses int `json:"recurring_expenses"`
+}
+
+// exportDocument mirrors the JSON streamed by exportHandler and is what
+// importHandler accepts.
+type exportDocument struct {
+	SchemaVersion     int                `json:"schema_version"`
+	ExportedAt        time.Time          `json:"exported_at"`
+	Accounts          []Account          `json:"accounts"`
+	Expenses          []Expense          `json:"expenses"`
+	Incomes           []Income           `json:"incomes"`
+	Budgets           []Budget           `json:"budgets"`
+	RecurringExpenses []RecurringExpense `json:"recurring_expenses"`
+	Counts            *exportCounts      `json:"counts"`
+}
+
+type exportCollection struct {
+	name  string
+	query string
+	scan  func(*sql.Rows) (interface{}, error)
+	count *int
+}
+
+func (app *App) exportHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	// A read transaction keeps every collection in the document consistent
+	// with each other even if writes land mid-export.
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var counts exportCounts
+	collections := []exportCollection{
+		{
+			name:  "accounts",
+			query: "SELECT id, name, type, balance, allow_negative, minimum_balance FROM accounts WHERE user_id = ? ORDER BY id",
+			scan:  scanExportAccount,
+			count: &counts.Accounts,
+		},
+		{
+			name:  "expenses",
+			query: "SELECT id, amount, category, COALESCE(note, ''), payee, date, account_id FROM expenses WHERE user_id = ? ORDER BY id",
+			scan:  scanExportExpense,
+			count: &counts.Expenses,
+		},
+		{
+			name:  "incomes",
+			query: "SELECT id, amount, source, COALESCE(note, ''), date, account_id, opening_balance FROM incomes WHERE user_id = ? ORDER BY id",
+			scan:  scanExportIncome,
+			count: &counts.Incomes,
+		},
+		{
+			name:  "budgets",
+			query: "SELECT id, category, amount, start_date, end_date, account_id FROM budgets WHERE user_id = ? ORDER BY id",
+			scan:  scanExportBudget,
+			count: &counts.Budgets,
+		},
+		{
+			name:  "recurring_expenses",
+			query: "SELECT id, amount, category, COALESCE(note, ''), frequency, frequency_interval, next_due_date, COALESCE(anchor_day, 0), paused FROM recurring_expenses WHERE user_id = ? ORDER BY id",
+			scan:  scanExportRecurringExpense,
+			count: &counts.RecurringExpenses,
+		},
+	}
+
+	exportedAt, _ := json.Marshal(time.Now().UTC())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="expense-tracker-export.json"`)
+	fmt.Fprintf(w, `{"schema_version":%d,"exported_at":%s`, exportSchemaVersion, exportedAt)
+
+	// Once streaming has started the status is already 200, so failures can
+	// only be logged; the truncated document will fail to parse client-side.
+	for _, c := range collections {
+		n, err := streamExportCollection(w, tx, c, userID)
+		if err != nil {
+			log.Printf("export %s error: %v", c.name, err)
+			return
+		}
+		*c.count = n
+	}
+
+	countsJSON, err := json.Marshal(counts)
+	if err != nil {
+		log.Printf("export counts encode error: %v", err)
+		return
+	}
+	fmt.Fprintf(w, `,"counts":%s}`, countsJSON)
+}
+
+func streamExportCollection(w http.ResponseWriter, tx *sql.Tx, c exportCollection, userID int) (int, error) {
+	rows, err := tx.Query(c.query, userID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	fmt.Fprintf(w, `,%q:[`, c.name)
+	n := 0
+	for rows.Next() {
+		item, err := c.scan(rows)
+		if err != nil {
+			return n, err
+		}
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return n, err
+		}
+		if n > 0 {
+			w.Write([]byte{','})
+		}
+		w.Write(encoded)
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	w.Write([]byte{']'})
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, nil
+}
+
+func scanExportAccount(rows *sql.Rows) (interface{}, error) {
+	var a Account
+	var allowNegative bool
+	var minimumBalance sql.NullFloat64
+	if err := rows.Scan(&a.ID, &a.Name, &a.Type, &a.Balance, &allowNegative, &minimumBalance); err != nil {
+		return nil, err
+	}
+	// A balance is a running sum of whole-cent amounts that floating point
+	// can leave a hair off; rounding keeps the export importable now that
+	// amounts finer than a cent are refused.
+	a.Balance = roundCents(a.Balance)
+	a.AllowNegative = &allowNegative
+	a.MinimumBalance = nullFloatPtr(minimumBalance)
+	return a, nil
+}
+
+func scanExportExpense(rows *sql.Rows) (interface{}, error) {
+	var e Expense
+	var dateStr string
+	var payee sql.NullString
+	var accountID sql.NullInt64
+	if err := rows.Scan(&e.ID, &e.Amount, &e.Category, &e.Note, &payee, &dateStr, &accountID); err != nil {
+		return nil, err
+	}
+	date, err := parseTimestamp(dateStr)
+	if err != nil {
+		return nil, err
+	}
+	e.Date = date
+	e.Payee = nullStringPtr(payee)
+	if accountID.Valid {
+		id := int(accountID.Int64)
+		e.AccountID = &id
+	}
+	return e, nil
+}
+
+func scanExportIncome(rows *sql.Rows) (interface{}, error) {
+	var i Income
+	var dateStr string
+	var accountID sql.NullInt64
+	if err := rows.Scan(&i.ID, &i.Amount, &i.Source, &i.Note, &dateStr, &accountID, &i.OpeningBalance); err != nil {
+		return nil, err
+	}
+	date, err := parseTimestamp(dateStr)
+	if err != nil {
+		return nil, err
+	}
+	i.Date = date
+	if accountID.Valid {
+		id := int(accountID.Int64)
+		i.AccountID = &id
+	}
+	return i, nil
+}
+
+func scanExportBudget(rows *sql.Rows) (interface{}, error) {
+	var b Budget
+	var startStr, endStr string
+	var accountID sql.NullInt64
+	if err := rows.Scan(&b.ID, &b.Category, &b.Amount, &startStr, &endStr, &accountID); err != nil {
+		return nil, err
+	}
+	b.AccountID = nullIntPtr(accountID)
+	var err error
+	if b.StartDate, err = parseTimestamp(startStr); err != nil {
+		return nil, err
+	}
+	if b.EndDate, err = parseTimestamp(endStr); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func scanExportRecurringExpense(rows *sql.Rows) (interface{}, error) {
+	var re RecurringExpense
+	var nextDueDateStr string
+	if err := rows.Scan(&re.ID, &re.Amount, &re.Category, &re.Note, &re.Frequency, &re.Interval, &nextDueDateStr, &re.AnchorDay, &re.Paused); err != nil {
+		return nil, err
+	}
+	var err error
+	if re.NextDueDate, err = parseTimestamp(nextDueDateStr); err != nil {
+		return nil, err
+	}
+	return re, nil
+}
+
+func (app *App) importHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	var doc exportDocument
+	if !decodeJSONBodyLimit(w, r, &doc, maxImportBody) {
+		return
+	}
+
+	if doc.SchemaVersion != exportSchemaVersion {
+		http.Error(w, fmt.Sprintf("Unsupported schema_version %d", doc.SchemaVersion), http.StatusBadRequest)
+		return
+	}
+
+	counts := exportCounts{
+		Accounts:          len(doc.Accounts),
+		Expenses:          len(doc.Expenses),
+		Incomes:           len(doc.Incomes),
+		Budgets:           len(doc.Budgets),
+		RecurringExpenses: len(doc.RecurringExpenses),
+	}
+	if doc.Counts != nil && *doc.Counts != counts {
+		http.Error(w, "Document counts do not match its contents", http.StatusBadRequest)
+		return
+	}
+
+	// Imported text is held to the same limits as the API, so each item is
+	// cleaned in place before anything is written.
+	textError := func(err error, kind string, id int) bool {
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s on %s %d", err, kind, id), http.StatusBadRequest)
+			return true
+		}
+		return false
+	}
+	for i := range doc.Accounts {
+		if textError(validateAccountText(&doc.Accounts[i]), "account", doc.Accounts[i].ID) {
+			return
+		}
+		// Exports from before types were validated may carry free text.
+		doc.Accounts[i].Type = migratedAccountType(doc.Accounts[i].Type)
+	}
+	for i := range doc.Expenses {
+		if textError(validateExpenseText(&doc.Expenses[i]), "expense", doc.Expenses[i].ID) {
+			return
+		}
+	}
+	for i := range doc.Incomes {
+		if textError(validateIncomeText(&doc.Incomes[i]), "income", doc.Incomes[i].ID) {
+			return
+		}
+	}
+	for i := range doc.Budgets {
+		if textError(validateBudgetText(&doc.Budgets[i]), "budget", doc.Budgets[i].ID) {
+			return
+		}
+	}
+	for i := range doc.RecurringExpenses {
+		if textError(validateRecurringExpenseText(&doc.RecurringExpenses[i]), "recurring expense", doc.RecurringExpenses[i].ID) {
+			return
+		}
+	}
+
+	for _, re := range doc.RecurringExpenses {
+		if !isValidFrequency(re.Frequency) {
+			http.Error(w, fmt.Sprintf("Invalid frequency on recurring expense %d", re.ID), http.StatusBadRequest)
+			return
+		}
+		if _, ok := normalizeInterval(re.Interval); !ok {
+			http.Error(w, fmt.Sprintf("Invalid interval on recurring expense %d", re.ID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	merge := r.URL.Query().Get("merge") == "true"
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if !merge {
+		hasData, err := userHasData(tx, userID)
+		if err != nil {
+			log.Printf("import existing data check error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if hasData {
+			http.Error(w, "Account already contains data; retry with ?merge=true to combine", http.StatusConflict)
+			return
+		}
+	}
+	if !app.checkQuota(w, tx, userID, quotaAccounts, len(doc.Accounts)) || !app.checkQuota(w, tx, userID, quotaExpenses, len(doc.Expenses)) {
+		return
+	}
+
+	// Exported account IDs are remapped so transactions keep pointing at the
+	// right account after import.
+	stamp := newTimestamps(time.Now())
+	now := stamp.UpdatedAt.Format(timeFormat)
+
+	accountIDs := make(map[int]int, len(doc.Accounts))
+	for _, a := range doc.Accounts {
+		a.Timestamps = stamp
+		// Exports from before the flag existed allow negative balances, the
+		// behavior accounts had then.
+		allowNegative := a.AllowNegative == nil || *a.AllowNegative
+		a.AllowNegative = &allowNegative
+		newID, err := insertReturningID(tx, "INSERT INTO accounts(name, type, balance, allow_negative, minimum_balance, user_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?)", a.Name, a.Type, a.Balance, allowNegative, a.MinimumBalance, userID, now, now)
+		if err != nil {
+			log.Printf("import account error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		accountIDs[a.ID] = newID
+		a.ID = newID
+		a.UserID = userID
+		if err := recordBalance(tx, userID, a.ID, a.Balance, balanceReasonOpening, now); err != nil {
+			log.Printf("balance history error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := recordAudit(tx, userID, auditEntityAccount, a.ID, auditActionCreate, nil, a); err != nil {
+			log.Printf("audit log error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Rules are loaded once for the whole document rather than per expense.
+	rules, err := loadRules(tx, userID)
+	if err != nil {
+		log.Printf("category rules query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	remapAccount := func(id *int) (*int, bool) {
+		if id == nil {
+			return nil, true
+		}
+		newID, ok := accountIDs[*id]
+		if !ok {
+			return nil, false
+		}
+		return &newID, true
+	}
+
+	threshold, err := largeExpenseThreshold(tx, userID)
+	if err != nil {
+		log.Printf("user settings lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, e := range doc.Expenses {
+		accountID, ok := remapAccount(e.AccountID)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Expense %d references an account not in the document", e.ID), http.StatusBadRequest)
+			return
+		}
+		e.Payee = normalizePayee(e.Payee)
+		if needsCategory(e.Category) {
+			e.Category = categorize(rules, e.Note, e.Payee)
+		}
+		e.Timestamps = stamp
+		newID, err := insertReturningID(tx, "INSERT INTO expenses(amount, category, note, payee, date, user_id, account_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)", e.Amount, e.Category, e.Note, e.Payee, e.Date.UTC().Format(timeFormat), userID, accountID, now, now)
+		if err != nil {
+			log.Printf("import expense error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		e.ID = newID
+		e.AccountID = accountID
+		e.UserID = userID
+		if err := recordAudit(tx, userID, auditEntityExpense, e.ID, auditActionCreate, nil, e); err != nil {
+			log.Printf("audit log error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := notifyLargeExpense(tx, userID, threshold, e, 0); err != nil {
+			log.Printf("large expense notification error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := queueWebhookEvent(tx, userID, webhookEventExpenseCreated, e); err != nil {
+			log.Printf("webhook event error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for _, i := range doc.Incomes {
+		accountID, ok := remapAccount(i.AccountID)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Income %d references an account not in the document", i.ID), http.StatusBadRequest)
+			return
+		}
+		i.Timestamps = stamp
+		newID, err := insertReturningID(tx, "INSERT INTO incomes(amount, source, note, date, user_id, account_id, opening_balance, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)", i.Amount, i.Source, i.Note, i.Date.UTC().Format(timeFormat), userID, accountID, i.OpeningBalance, now, now)
+		if err != nil {
+			log.Printf("import income error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		i.ID = newID
+		i.AccountID = accountID
+		i.UserID = userID
+		if err := recordAudit(tx, userID, auditEntityIncome, i.ID, auditActionCreate, nil, i); err != nil {
+			log.Printf("audit log error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := queueWebhookEvent(tx, userID, webhookEventIncomeCreated, i); err != nil {
+			log.Printf("webhook event error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for _, b := range doc.Budgets {
+		accountID, ok := remapAccount(b.AccountID)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Budget %d references an account not in the document", b.ID), http.StatusBadRequest)
+			return
+		}
+		b.AccountID = accountID
+		b.AccountName = nil
+		b.AccountRemoved = false
+		b.Timestamps = stamp
+		newID, err := insertReturningID(tx, "INSERT INTO budgets(category, amount, start_date, end_date, user_id, account_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?)", b.Category, b.Amount, b.StartDate.UTC().Format(timeFormat), b.EndDate.UTC().Format(timeFormat), userID, accountID, now, now)
+		if err != nil {
+			log.Printf("import budget error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		b.ID = newID
+		b.UserID = userID
+		if err := recordAudit(tx, userID, auditEntityBudget, b.ID, auditActionCreate, nil, b); err != nil {
+			log.Printf("audit log error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for _, re := range doc.RecurringExpenses {
+		re.Frequency = strings.ToLower(strings.TrimSpace(re.Frequency))
+		re.Interval, _ = normalizeInterval(re.Interval)
+		re.Timestamps = stamp
+		newID, err := insertReturningID(tx, "INSERT INTO recurring_expenses(amount, category, note, frequency, frequency_interval, next_due_date, anchor_day, paused, user_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", re.Amount, re.Category, re.Note, re.Frequency, re.Interval, re.NextDueDate.UTC().Format(timeFormat), re.AnchorDay, re.Paused, userID, now, now)
+		if err != nil {
+			log.Printf("import recurring expense error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		re.ID = newID
+		re.UserID = userID
+		if err := recordAudit(tx, userID, auditEntityRecurringExpense, re.ID, auditActionCreate, nil, re); err != nil {
+			log.Printf("audit log error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	app.wakeWebhookDispatcher()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]exportCounts{"imported": counts})
+}
+
+func userHasData(q rowQuerier, userID int) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM accounts WHERE user_id = ?)
+        OR EXISTS(SELECT 1 FROM expenses WHERE user_id = ?)
+        OR EXISTS(SELECT 1 FROM incomes WHERE user_id = ?)
+        OR EXISTS(SELECT 1 FROM budgets WHERE user_id = ?)
+        OR EXISTS(SELECT 1 FROM recurring_expenses WHERE user_id = ?)`,
+		userID, userID, userID, userID, userID).Scan(&exists)
+	return exists, err
+}
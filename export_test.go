@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	useTestDB(t)
+
+	expense := Expense{Amount: 42, Category: "Books", Note: "Paperback", Date: time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC), AccountID: testAccount()}
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", expense), http.StatusCreated)
+	budget := Budget{Category: "Books", Amount: 100, StartDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}
+	expectStatus(t, callAuthed(http.MethodPost, "/budgets", budget), http.StatusCreated)
+
+	exportRR := callAuthed(http.MethodGet, "/export", nil)
+	expectStatus(t, exportRR, http.StatusOK)
+	doc := decodeBody[exportDocument](t, exportRR)
+
+	if doc.SchemaVersion != exportSchemaVersion {
+		t.Fatalf("expected schema version %d got %d", exportSchemaVersion, doc.SchemaVersion)
+	}
+	if doc.Counts == nil || doc.Counts.Expenses != 1 || doc.Counts.Budgets != 1 || doc.Counts.Accounts != len(doc.Accounts) {
+		t.Fatalf("unexpected export counts: %+v", doc.Counts)
+	}
+	if doc.Expenses[0].AccountID == nil || *doc.Expenses[0].AccountID != testAccountID {
+		t.Fatalf("expected exported expense to reference account %d", testAccountID)
+	}
+
+	conflictRR := callAuthed(http.MethodPost, "/import", doc)
+	expectStatus(t, conflictRR, http.StatusConflict)
+
+	mergeRR := callAuthed(http.MethodPost, "/import?merge=true", doc)
+	expectStatus(t, mergeRR, http.StatusCreated)
+
+	var expenseCount int
+	if err := testApp.db.QueryRow("SELECT COUNT(*) FROM expenses WHERE user_id = ?", testUserID).Scan(&expenseCount); err != nil {
+		t.Fatalf("count expenses: %v", err)
+	}
+	if expenseCount != 2 {
+		t.Fatalf("expected 2 expenses after merge import, got %d", expenseCount)
+	}
+
+	var importedAccountID int
+	if err := testApp.db.QueryRow("SELECT account_id FROM expenses WHERE user_id = ? ORDER BY id DESC LIMIT 1", testUserID).Scan(&importedAccountID); err != nil {
+		t.Fatalf("load imported expense: %v", err)
+	}
+	if importedAccountID == testAccountID {
+		t.Fatalf("expected imported expense to reference the newly imported account")
+	}
+}
+
+func TestImportRejectsMismatchedCounts(t *testing.T) {
+	useTestDB(t)
+
+	doc := exportDocument{
+		SchemaVersion: exportSchemaVersion,
+		Expenses:      []Expense{{Amount: 1, Category: "Misc"}},
+		Counts:        &exportCounts{Expenses: 2},
+	}
+	rr := callAuthed(http.MethodPost, "/import?merge=true", doc)
+	expectStatus(t, rr, http.StatusBadRequest)
+}
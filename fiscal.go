@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// defaultFiscalYearStartMonth starts fiscal years in January, making them
+// calendar years.
+const defaultFiscalYearStartMonth = 1
+
+// fiscalPeriod returns the fiscal year and quarter day falls in, for fiscal
+// years starting on the first of startMonth. A fiscal year is named for the
+// calendar year it starts in, so with an April start 15 March 2025 is in
+// FY2024, quarter 4.
+func fiscalPeriod(day time.Time, startMonth time.Month) (year, quarter int) {
+	year = day.Year()
+	if day.Month() < startMonth {
+		year--
+	}
+	offset := (int(day.Month()) - int(startMonth) + 12) % 12
+	return year, offset/3 + 1
+}
+
+// fiscalReportPeriods are the quarter and year group_by options for fiscal
+// years starting in startMonth, labelled like FY2024-Q1 and FY2024.
+func fiscalReportPeriods(startMonth time.Month) map[string]reportPeriod {
+	return map[string]reportPeriod{
+		"quarter": {
+			start: func(t time.Time) time.Time {
+				year, quarter := fiscalPeriod(t, startMonth)
+				return time.Date(year, startMonth+time.Month(3*(quarter-1)), 1, 0, 0, 0, 0, time.UTC)
+			},
+			next: func(start time.Time) time.Time { return start.AddDate(0, 3, 0) },
+			label: func(start time.Time) string {
+				year, quarter := fiscalPeriod(start, startMonth)
+				return fmt.Sprintf("FY%d-Q%d", year, quarter)
+			},
+		},
+		"year": {
+			start: func(t time.Time) time.Time {
+				year, _ := fiscalPeriod(t, startMonth)
+				return time.Date(year, startMonth, 1, 0, 0, 0, 0, time.UTC)
+			},
+			next: func(start time.Time) time.Time { return start.AddDate(1, 0, 0) },
+			label: func(start time.Time) string {
+				year, _ := fiscalPeriod(start, startMonth)
+				return fmt.Sprintf("FY%d", year)
+			},
+		},
+	}
+}
+
+// fiscalYearStart returns the month userID's fiscal years start in. It
+// writes a 500 if the settings can't be read.
+func (app *App) fiscalYearStart(w http.ResponseWriter, userID int) (time.Month, bool) {
+	settings, err := loadUserSettings(app.db, userID)
+	if err != nil {
+		log.Printf("user fiscal year lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	return time.Month(settings.FiscalYearStartMonth), true
+}
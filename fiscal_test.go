@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFiscalPeriod(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	cases := []struct {
+		day           time.Time
+		start         time.Month
+		year, quarter int
+	}{
+		{day(2024, 1, 1), time.January, 2024, 1},
+		{day(2024, 3, 31), time.January, 2024, 1},
+		{day(2024, 4, 1), time.January, 2024, 2},
+		{day(2024, 12, 31), time.January, 2024, 4},
+		// An April year is named for the year it starts in.
+		{day(2024, 3, 31), time.April, 2023, 4},
+		{day(2024, 4, 1), time.April, 2024, 1},
+		{day(2024, 6, 30), time.April, 2024, 1},
+		{day(2024, 7, 1), time.April, 2024, 2},
+		{day(2025, 1, 1), time.April, 2024, 4},
+		// A July year's quarters straddle the calendar's.
+		{day(2024, 9, 30), time.July, 2024, 1},
+		{day(2024, 12, 1), time.July, 2024, 2},
+		{day(2025, 6, 30), time.July, 2024, 4},
+		// A December year is almost all in the next calendar year.
+		{day(2024, 12, 1), time.December, 2024, 1},
+		{day(2025, 2, 28), time.December, 2024, 1},
+		{day(2025, 3, 1), time.December, 2024, 2},
+		{day(2025, 11, 30), time.December, 2024, 4},
+	}
+	for _, c := range cases {
+		if year, quarter := fiscalPeriod(c.day, c.start); year != c.year || quarter != c.quarter {
+			t.Errorf("fiscalPeriod(%s, %s) = FY%d-Q%d, want FY%d-Q%d", c.day.Format(statsDateFormat), c.start, year, quarter, c.year, c.quarter)
+		}
+	}
+}
+
+func TestFiscalReportPeriods(t *testing.T) {
+	periods := fiscalReportPeriods(time.October)
+	day := time.Date(2025, 2, 14, 0, 0, 0, 0, time.UTC)
+
+	quarter := periods["quarter"]
+	start := quarter.start(day)
+	if want := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC); !start.Equal(want) || quarter.label(start) != "FY2024-Q2" {
+		t.Fatalf("expected FY2024-Q2 from %v, got %s from %v", want, quarter.label(start), start)
+	}
+	if next := quarter.next(start); quarter.label(next) != "FY2024-Q3" {
+		t.Fatalf("expected FY2024-Q3 next, got %s", quarter.label(next))
+	}
+
+	year := periods["year"]
+	start = year.start(day)
+	if want := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC); !start.Equal(want) || year.label(start) != "FY2024" || year.label(year.next(start)) != "FY2025" {
+		t.Fatalf("expected FY2024 from %v, got %s from %v", want, year.label(start), start)
+	}
+}
+
+func TestFiscalReports(t *testing.T) {
+	useTestDB(t)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 12, 0, 0, 0, time.UTC) }
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 300, Source: "Salary", Date: day(2024, 4, 10), AccountID: testAccount()}), http.StatusCreated)
+	for _, e := range []Expense{
+		{Amount: 10, Date: day(2024, 3, 31)},
+		{Amount: 20, Date: day(2024, 4, 1)},
+		{Amount: 40, Date: day(2024, 7, 15)},
+		{Amount: 80, Date: day(2025, 3, 1)},
+	} {
+		e.Category = "Food"
+		e.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	get := func(target string) []MonthlyReport {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, target, nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[[]MonthlyReport](t, rr)
+	}
+	// Without a fiscal_year_start_month, fiscal years are calendar years.
+	if got, want := get("/reports/income-vs-expense?group_by=year&fiscal=true"), []MonthlyReport{
+		{Period: "FY2024", Income: 300, Expense: 70, Net: 230},
+		{Period: "FY2025", Expense: 80, Net: -80},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	settings := decodeBody[UserSettings](t, callAuthed(http.MethodPut, "/settings", UserSettings{FiscalYearStartMonth: 4}))
+	if settings.FiscalYearStartMonth != 4 {
+		t.Fatalf("expected fiscal_year_start_month 4, got %+v", settings)
+	}
+	if got, want := get("/reports/income-vs-expense?group_by=year&fiscal=true"), []MonthlyReport{
+		{Period: "FY2023", Expense: 10, Net: -10},
+		{Period: "FY2024", Income: 300, Expense: 140, Net: 160},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if got, want := get("/reports/income-vs-expense?group_by=quarter&fiscal=true&fill=true&date_from=2024-04-01&date_to=2024-12-31"), []MonthlyReport{
+		{Period: "FY2024-Q1", Income: 300, Expense: 20, Net: 280},
+		{Period: "FY2024-Q2", Expense: 40, Net: -40},
+		{Period: "FY2024-Q3"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	// Calendar grouping is still the default.
+	if got := get("/reports/income-vs-expense?group_by=year"); len(got) != 2 || got[0].Period != "2024" {
+		t.Fatalf("expected calendar years, got %+v", got)
+	}
+
+	rr := callAuthed(http.MethodGet, "/reports/year?year=2024&fiscal=true", nil)
+	expectStatus(t, rr, http.StatusOK)
+	review := decodeBody[YearReview](t, rr)
+	if review.Year != 2024 || review.Period != "FY2024" || review.From != "2024-04-01" || review.To != "2025-03-31" {
+		t.Fatalf("expected April 2024 to March 2025, got %+v", review)
+	}
+	if review.Income != 300 || review.Expense != 140 || review.TopMonth == nil || review.TopMonth.Month != "2025-03" || review.AverageMonthlyExpense != 11.67 {
+		t.Fatalf("unexpected fiscal year totals: %+v", review)
+	}
+	if calendar := decodeBody[YearReview](t, callAuthed(http.MethodGet, "/reports/year?year=2024", nil)); calendar.Period != "2024" || calendar.Expense != 70 || calendar.To != "2024-12-31" {
+		t.Fatalf("expected the calendar year, got %+v", calendar)
+	}
+
+	for _, target := range []string{
+		"/reports/income-vs-expense?group_by=month&fiscal=true",
+		"/reports/income-vs-expense?group_by=week&fiscal=true",
+		"/reports/income-vs-expense?group_by=year&fiscal=maybe",
+		"/reports/year?fiscal=maybe",
+	} {
+		expectStatus(t, callAuthed(http.MethodGet, target, nil), http.StatusBadRequest)
+	}
+	for _, month := range []int{-1, 13} {
+		expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{FiscalYearStartMonth: month}), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// forecastHistoryDays is how many days of past spending the forecast
+// averages.
+const forecastHistoryDays = 60
+
+// Forecast projects the user's balances to the end of the current month in
+// their timezone. ProjectedBalance takes the recurring expenses due by then
+// and the average daily spend for the days left off CurrentBalance; the
+// pessimistic and optimistic balances move the spend by one standard
+// deviation either way.
+type Forecast struct {
+	CurrentBalance     float64             `json:"current_balance"`
+	ProjectedBalance   float64             `json:"projected_balance"`
+	PessimisticBalance float64             `json:"pessimistic_balance"`
+	OptimisticBalance  float64             `json:"optimistic_balance"`
+	Accounts           []AccountForecast   `json:"accounts"`
+	Assumptions        ForecastAssumptions `json:"assumptions"`
+}
+
+// AccountForecast projects one account from the spending charged to it.
+// Recurring expenses are not tied to an account, so they only come off the
+// total.
+type AccountForecast struct {
+	AccountID         int     `json:"account_id"`
+	Name              string  `json:"name"`
+	Balance           float64 `json:"balance"`
+	AverageDailySpend float64 `json:"average_daily_spend"`
+	ProjectedBalance  float64 `json:"projected_balance"`
+}
+
+// ForecastAssumptions is what a Forecast was worked out from.
+type ForecastAssumptions struct {
+	Today    string `json:"today"`
+	MonthEnd string `json:"month_end"`
+	// DaysRemaining counts the days after today up to and including
+	// MonthEnd; today's spending is taken to be recorded already.
+	DaysRemaining int `json:"days_remaining"`
+	HistoryDays   int `json:"history_days"`
+	// AverageDailySpend and DailySpendStdDev cover expenses not generated by
+	// a recurring expense over the HistoryDays days before today, days
+	// without spending included.
+	AverageDailySpend float64 `json:"average_daily_spend"`
+	DailySpendStdDev  float64 `json:"daily_spend_std_dev"`
+	// SpendBand is how far the pessimistic and optimistic balances sit from
+	// the projection: DailySpendStdDev scaled to DaysRemaining days.
+	SpendBand      float64              `json:"spend_band"`
+	RecurringTotal float64              `json:"recurring_total"`
+	Recurring      []UpcomingOccurrence `json:"recurring"`
+}
+
+// forecastInputs is everything a forecast is projected from, gathered so
+// the arithmetic can be checked without a database.
+type forecastInputs struct {
+	accounts []AccountForecast // Balance filled in
+	// accountSpend is the history's discretionary spend per account.
+	accountSpend map[int]float64
+	// dailySpend is the discretionary spend on each day of the history,
+	// zero days included.
+	dailySpend    []float64
+	recurring     []UpcomingOccurrence
+	daysRemaining int
+}
+
+// project works out the forecast. Spending over the days remaining is
+// taken as that many independent days like those in the history, so the
+// band grows with the square root of the days rather than linearly.
+func (in forecastInputs) project() Forecast {
+	f := Forecast{Accounts: []AccountForecast{}}
+	f.Assumptions.DaysRemaining = in.daysRemaining
+	f.Assumptions.HistoryDays = len(in.dailySpend)
+	f.Assumptions.Recurring = in.recurring
+
+	mean, stdDev := meanStdDev(in.dailySpend)
+	days := float64(in.daysRemaining)
+	band := stdDev * math.Sqrt(days)
+	for _, o := range in.recurring {
+		f.Assumptions.RecurringTotal += o.Amount
+	}
+
+	for _, a := range in.accounts {
+		if len(in.dailySpend) > 0 {
+			a.AverageDailySpend = in.accountSpend[a.AccountID] / float64(len(in.dailySpend))
+		}
+		a.ProjectedBalance = roundCents(a.Balance - a.AverageDailySpend*days)
+		a.AverageDailySpend = roundCents(a.AverageDailySpend)
+		f.CurrentBalance += a.Balance
+		f.Accounts = append(f.Accounts, a)
+	}
+
+	projected := f.CurrentBalance - f.Assumptions.RecurringTotal - mean*days
+	f.CurrentBalance = roundCents(f.CurrentBalance)
+	f.ProjectedBalance = roundCents(projected)
+	f.PessimisticBalance = roundCents(projected - band)
+	f.OptimisticBalance = roundCents(projected + band)
+	f.Assumptions.AverageDailySpend = roundCents(mean)
+	f.Assumptions.DailySpendStdDev = roundCents(stdDev)
+	f.Assumptions.SpendBand = roundCents(band)
+	f.Assumptions.RecurringTotal = roundCents(f.Assumptions.RecurringTotal)
+	return f
+}
+
+// meanStdDev returns the mean and population standard deviation of values,
+// zeros when there are none.
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// forecastHandler serves GET /reports/forecast.
+func (app *App) forecastHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	if !checkKnownParams(w, r.URL.Query()) {
+		return
+	}
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	f, err := computeForecast(app.requestDB(r), userID, localDay(time.Now(), loc), loc)
+	if err != nil {
+		log.Printf("forecast error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
+
+// computeForecast gathers the forecast inputs as of today, a calendar day
+// in loc. Balances are those of the accounts GET /accounts lists; spending
+// is the user's own.
+func computeForecast(q querier, userID int, today time.Time, loc *time.Location) (Forecast, error) {
+	month := reportPeriods["month"]
+	monthEnd := month.next(month.start(today)).AddDate(0, 0, -1)
+	historyStart := today.AddDate(0, 0, -forecastHistoryDays)
+	from, to := dayStart(historyStart, loc), dayStart(today, loc)
+	in := forecastInputs{
+		accountSpend:  map[int]float64{},
+		dailySpend:    make([]float64, forecastHistoryDays),
+		daysRemaining: int(monthEnd.Sub(today).Hours() / 24),
+	}
+
+	err := runConcurrently(
+		func() error {
+			rows, err := q.Query("SELECT id, name, balance FROM accounts WHERE "+householdScope+" ORDER BY id", userID, userID)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var a AccountForecast
+				if err := rows.Scan(&a.AccountID, &a.Name, &a.Balance); err != nil {
+					return err
+				}
+				in.accounts = append(in.accounts, a)
+			}
+			return rows.Err()
+		},
+		func() error {
+			rows, err := q.Query("SELECT account_id, SUM(amount) FROM expenses WHERE user_id = ? AND recurring_expense_id IS NULL AND account_id IS NOT NULL AND date >= ? AND date < ? GROUP BY account_id", userID, from, to)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var id int
+				var total float64
+				if err := rows.Scan(&id, &total); err != nil {
+					return err
+				}
+				in.accountSpend[id] = total
+			}
+			return rows.Err()
+		},
+		func() error {
+			days, err := dailyTotals(q, loc, "SELECT date, amount FROM expenses WHERE user_id = ? AND recurring_expense_id IS NULL AND date >= ? AND date < ?", userID, from, to)
+			if err != nil {
+				return err
+			}
+			for i := range in.dailySpend {
+				in.dailySpend[i] = days[historyStart.AddDate(0, 0, i)]
+			}
+			return nil
+		},
+		func() (err error) {
+			// Everything due before the next month begins, overdue
+			// occurrences the processor has yet to create included.
+			end := time.Date(monthEnd.Year(), monthEnd.Month(), monthEnd.Day()+1, 0, 0, 0, 0, loc).UTC()
+			in.recurring, err = projectUpcoming(q, userID, end.Add(-time.Nanosecond))
+			return err
+		},
+	)
+	if err != nil {
+		return Forecast{}, fmt.Errorf("forecast: %w", err)
+	}
+
+	f := in.project()
+	f.Assumptions.Today = today.Format(statsDateFormat)
+	f.Assumptions.MonthEnd = monthEnd.Format(statsDateFormat)
+	return f, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestForecastProjection(t *testing.T) {
+	in := forecastInputs{
+		accounts:      []AccountForecast{{AccountID: 1, Name: "Bank", Balance: 1000}, {AccountID: 2, Name: "Wallet", Balance: 200}},
+		accountSpend:  map[int]float64{1: 60, 2: 20},
+		dailySpend:    []float64{10, 30, 10, 30},
+		recurring:     []UpcomingOccurrence{{RecurringExpenseID: 7, Amount: 100}, {RecurringExpenseID: 8, Amount: 50}},
+		daysRemaining: 9,
+	}
+	f := in.project()
+
+	// Spend averages 20 a day with a standard deviation of 10, so nine days
+	// come to 180 give or take 10 * sqrt(9).
+	if f.CurrentBalance != 1200 || f.ProjectedBalance != 870 || f.PessimisticBalance != 840 || f.OptimisticBalance != 900 {
+		t.Fatalf("unexpected balances: %+v", f)
+	}
+	a := f.Assumptions
+	if a.AverageDailySpend != 20 || a.DailySpendStdDev != 10 || a.SpendBand != 30 || a.RecurringTotal != 150 || a.HistoryDays != 4 || a.DaysRemaining != 9 {
+		t.Fatalf("unexpected assumptions: %+v", a)
+	}
+	want := []AccountForecast{
+		{AccountID: 1, Name: "Bank", Balance: 1000, AverageDailySpend: 15, ProjectedBalance: 865},
+		{AccountID: 2, Name: "Wallet", Balance: 200, AverageDailySpend: 5, ProjectedBalance: 155},
+	}
+	if !reflect.DeepEqual(f.Accounts, want) {
+		t.Fatalf("unexpected account projections: %+v", f.Accounts)
+	}
+
+	empty := forecastInputs{daysRemaining: 5}.project()
+	if empty.ProjectedBalance != 0 || empty.Accounts == nil || empty.Assumptions.SpendBand != 0 {
+		t.Fatalf("expected an empty forecast, got %+v", empty)
+	}
+}
+
+func TestForecastEndpoint(t *testing.T) {
+	useTestDB(t)
+	now := time.Now().UTC()
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 120, Category: "Food", Date: now.AddDate(0, 0, -2), AccountID: testAccount()}), http.StatusCreated)
+	// Older than the history, so not averaged.
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 999, Category: "Food", Date: now.AddDate(0, 0, -90), AccountID: testAccount()}), http.StatusCreated)
+	// Due now, so in the projection however late in the month the test runs.
+	expectStatus(t, callAuthed(http.MethodPost, "/recurring-expenses", RecurringExpense{Amount: 25, Category: "Streaming", Frequency: "yearly", NextDueDate: now}), http.StatusCreated)
+
+	rr := callAuthed(http.MethodGet, "/reports/forecast", nil)
+	expectStatus(t, rr, http.StatusOK)
+	f := decodeBody[Forecast](t, rr)
+	a := f.Assumptions
+	if a.AverageDailySpend != 2 || a.HistoryDays != forecastHistoryDays || a.RecurringTotal != 25 || len(a.Recurring) != 1 {
+		t.Fatalf("unexpected assumptions: %+v", a)
+	}
+	if len(f.Accounts) != 1 || f.Accounts[0].AccountID != testAccountID || f.Accounts[0].AverageDailySpend != 2 {
+		t.Fatalf("unexpected accounts: %+v", f.Accounts)
+	}
+	if want := roundCents(f.CurrentBalance - 25 - 2*float64(a.DaysRemaining)); f.ProjectedBalance != want {
+		t.Fatalf("expected projected balance %v, got %v", want, f.ProjectedBalance)
+	}
+	if f.PessimisticBalance >= f.ProjectedBalance || f.OptimisticBalance <= f.ProjectedBalance {
+		t.Fatalf("expected a band around the projection, got %+v", f)
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/forecast?strict=true&days=5", nil), http.StatusBadRequest)
+}
@@ -3,6 +3,7 @@ module expense-tracker
 go 1.24.2
 
 require (
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.32
 	golang.org/x/crypto v0.42.0
 )
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// healthPath is the liveness probe for load balancers and orchestrators. It
+// sits outside the versioned API, so it needs no session and is never rate
+// limited.
+const healthPath = "/healthz"
+
+type healthStatus struct {
+	Status string `json:"status"`
+}
+
+// withHealthCheck answers healthPath ahead of the API routes, the legacy
+// path mapping, and the web UI.
+func (app *App) withHealthCheck(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAPIError(w, http.StatusMethodNotAllowed, routeErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		app.healthHandler(w, r)
+	})
+}
+
+// healthHandler answers 200 while the database answers a ping and 503 once
+// it doesn't.
+func (app *App) healthHandler(w http.ResponseWriter, r *http.Request) {
+	status, code := healthStatus{Status: "ok"}, http.StatusOK
+	if err := app.db.PingContext(r.Context()); err != nil {
+		log.Printf("health check database error: %v", err)
+		status, code = healthStatus{Status: "unavailable"}, http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	useTestDB(t)
+
+	rr := serve(httptest.NewRequest(http.MethodGet, healthPath, nil))
+	expectStatus(t, rr, http.StatusOK)
+	if got := decodeBody[healthStatus](t, rr); got.Status != "ok" {
+		t.Fatalf("expected status ok, got %+v", got)
+	}
+	if rr.Header().Get("Deprecation") != "" {
+		t.Fatal("expected the health check not to be treated as a legacy API path")
+	}
+	expectStatus(t, serve(httptest.NewRequest(http.MethodHead, healthPath, nil)), http.StatusOK)
+
+	rr = serve(httptest.NewRequest(http.MethodPost, healthPath, nil))
+	expectStatus(t, rr, http.StatusMethodNotAllowed)
+	if got := rr.Header().Get("Allow"); got != "GET, HEAD" {
+		t.Fatalf("expected Allow GET, HEAD, got %q", got)
+	}
+
+	conn, err := openDatabase(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := NewApp(conn, testConfig())
+	conn.Close()
+	rr = httptest.NewRecorder()
+	down.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	expectStatus(t, rr, http.StatusServiceUnavailable)
+	if got := decodeBody[healthStatus](t, rr); got.Status != "unavailable" {
+		t.Fatalf("expected status unavailable, got %+v", got)
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	householdRoleOwner  = "owner"
+	householdRoleMember = "member"
+
+	householdInviteTTL = 7 * 24 * time.Hour
+)
+
+// householdScope restricts a query on a shared table to rows the user owns
+// or rows attached to a household the user belongs to. It takes the user ID
+// twice as arguments.
+const householdScope = "(user_id = ? OR household_id IN (SELECT household_id FROM household_members WHERE user_id = ?))"
+
+type Household struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type HouseholdInvite struct {
+	Token       string    `json:"token"`
+	HouseholdID int       `json:"household_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type acceptInviteRequest struct {
+	Token string `json:"token"`
+}
+
+func (app *App) createHouseholdTables() error {
+	householdTableStmt := `
+    CREATE TABLE IF NOT EXISTS households (
+        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        owner_id INTEGER NOT NULL,
+        created_at DATETIME NOT NULL,
+        FOREIGN KEY(owner_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(householdTableStmt)); err != nil {
+		return fmt.Errorf("create households table: %w", err)
+	}
+
+	memberTableStmt := `
+    CREATE TABLE IF NOT EXISTS household_members (
+        household_id INTEGER NOT NULL,
+        user_id INTEGER NOT NULL,
+        role TEXT NOT NULL,
+        joined_at DATETIME NOT NULL,
+        PRIMARY KEY(household_id, user_id),
+        FOREIGN KEY(household_id) REFERENCES households(id) ON DELETE CASCADE,
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(memberTableStmt)); err != nil {
+		return fmt.Errorf("create household_members table: %w", err)
+	}
+
+	inviteTableStmt := `
+    CREATE TABLE IF NOT EXISTS household_invites (
+        token_hash TEXT NOT NULL PRIMARY KEY,
+        household_id INTEGER NOT NULL,
+        created_by INTEGER NOT NULL,
+        expires_at DATETIME NOT NULL,
+        accepted_at DATETIME,
+        FOREIGN KEY(household_id) REFERENCES households(id) ON DELETE CASCADE,
+        FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(inviteTableStmt)); err != nil {
+		return fmt.Errorf("create household_invites table: %w", err)
+	}
+
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_household_members_user ON household_members(user_id)"); err != nil {
+		return fmt.Errorf("create household_members index: %w", err)
+	}
+
+	tables := []string{"accounts", "expenses", "incomes", "budgets"}
+	for _, table := range tables {
+		if err := app.ensureColumn(table, "household_id", "INTEGER REFERENCES households(id) ON DELETE SET NULL"); err != nil {
+			return err
+		}
+		indexStmt := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_household ON %s(household_id)", table, table)
+		if _, err := app.db.Exec(indexStmt); err != nil {
+			return fmt.Errorf("create %s household index: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// householdRole returns the user's role in the household, or sql.ErrNoRows
+// if they are not a member.
+func householdRole(q rowQuerier, householdID, userID int) (string, error) {
+	var role string
+	err := q.QueryRow("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?", householdID, userID).Scan(&role)
+	return role, err
+}
+
+// requireHouseholdMember rejects the request if householdID is set and the
+// user does not belong to that household. A nil householdID means the record
+// is personal and is always allowed.
+func (app *App) requireHouseholdMember(w http.ResponseWriter, userID int, householdID *int) bool {
+	if householdID == nil {
+		return true
+	}
+
+	_, err := householdRole(app.db, *householdID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not a member of this household", http.StatusForbidden)
+		return false
+	} else if err != nil {
+		log.Printf("household membership lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func (app *App) getHouseholds(w http.ResponseWriter, r *http.Request, userID int) {
+	rows, err := app.requestDB(r).Query(`SELECT h.id, h.name, m.role, h.created_at
+        FROM households h JOIN household_members m ON m.household_id = h.id
+        WHERE m.user_id = ? ORDER BY h.id`, userID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var households []Household
+	for rows.Next() {
+		var h Household
+		var createdAtStr string
+		if err := rows.Scan(&h.ID, &h.Name, &h.Role, &createdAtStr); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		createdAt, err := parseTimestamp(createdAtStr)
+		if err != nil {
+			log.Printf("household created_at parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		h.CreatedAt = createdAt
+		households = append(households, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONList(w, households)
+}
+
+func (app *App) createHousehold(w http.ResponseWriter, r *http.Request, userID int) {
+	var h Household
+	if !decodeJSONBody(w, r, &h) {
+		return
+	}
+
+	h.Name = strings.TrimSpace(h.Name)
+	if h.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	h.CreatedAt = time.Now().UTC()
+	h.Role = householdRoleOwner
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	id, err := insertReturningID(tx, "INSERT INTO households(name, owner_id, created_at) VALUES(?, ?, ?)", h.Name, userID, h.CreatedAt.Format(timeFormat))
+	if err != nil {
+		log.Printf("create household error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.ID = id
+
+	if _, err := tx.Exec("INSERT INTO household_members(household_id, user_id, role, joined_at) VALUES(?, ?, ?, ?)", h.ID, userID, householdRoleOwner, h.CreatedAt.Format(timeFormat)); err != nil {
+		log.Printf("add household owner error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h)
+}
+
+func (app *App) deleteHousehold(w http.ResponseWriter, r *http.Request, userID, id int) {
+	role, err := householdRole(app.db, id, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Household not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("household membership lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if role != householdRoleOwner {
+		http.Error(w, "Only the household owner can delete it", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := tombstoneHouseholdRows(tx, id); err != nil {
+		log.Printf("household tombstone error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Shared records fall back to being personal records of whoever created
+	// them via ON DELETE SET NULL on household_id.
+	if _, err := tx.Exec("DELETE FROM households WHERE id = ? AND owner_id = ?", id, userID); err != nil {
+		log.Printf("delete household error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) createHouseholdInvite(w http.ResponseWriter, r *http.Request, userID, householdID int) {
+	role, err := householdRole(app.db, householdID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Household not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("household membership lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if role != householdRoleOwner {
+		http.Error(w, "Only the household owner can invite members", http.StatusForbidden)
+		return
+	}
+
+	rawToken, tokenHash, err := generateSessionToken()
+	if err != nil {
+		log.Printf("invite token generation error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(householdInviteTTL)
+	if _, err := app.db.Exec("INSERT INTO household_invites(token_hash, household_id, created_by, expires_at) VALUES(?, ?, ?, ?)", tokenHash, householdID, userID, expiresAt.Format(timeFormat)); err != nil {
+		log.Printf("create invite error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(HouseholdInvite{Token: rawToken, HouseholdID: householdID, ExpiresAt: expiresAt})
+}
+
+func (app *App) acceptInviteHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	var req acceptInviteRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	tokenHash := hashSessionToken(req.Token)
+	var householdID int
+	var expiresAtStr string
+	var acceptedAt sql.NullString
+	err = tx.QueryRow("SELECT household_id, expires_at, accepted_at FROM household_invites WHERE token_hash = ?", tokenHash).Scan(&householdID, &expiresAtStr, &acceptedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid invite", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("invite lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt, err := parseTimestamp(expiresAtStr)
+	if err != nil {
+		log.Printf("invite expiry parse error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	if acceptedAt.Valid || now.After(expiresAt) {
+		http.Error(w, "Invite has expired or was already used", http.StatusGone)
+		return
+	}
+
+	// Claiming the invite is what decides between two people accepting it
+	// at once: only one update finds it still unaccepted.
+	res, err := tx.Exec("UPDATE household_invites SET accepted_at = ? WHERE token_hash = ? AND accepted_at IS NULL", now.Format(timeFormat), tokenHash)
+	if err != nil {
+		log.Printf("invite update error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		log.Printf("invite update error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "Invite has expired or was already used", http.StatusGone)
+		return
+	}
+
+	if _, err := tx.Exec("INSERT INTO household_members(household_id, user_id, role, joined_at) VALUES(?, ?, ?, ?) ON CONFLICT DO NOTHING", householdID, userID, householdRoleMember, now.Format(timeFormat)); err != nil {
+		log.Printf("add household member error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var h Household
+	var createdAtStr string
+	err = tx.QueryRow(`SELECT h.id, h.name, m.role, h.created_at
+        FROM households h JOIN household_members m ON m.household_id = h.id
+        WHERE h.id = ? AND m.user_id = ?`, householdID, userID).Scan(&h.ID, &h.Name, &h.Role, &createdAtStr)
+	if err != nil {
+		log.Printf("household lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if h.CreatedAt, err = parseTimestamp(createdAtStr); err != nil {
+		log.Printf("household created_at parse error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h)
+}
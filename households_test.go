@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHouseholdSharing(t *testing.T) {
+	useTestDB(t)
+
+	partnerCookie, _ := registerUser(t, "partner@example.com", "PartnerSecretPass123!")
+
+	createRR := callAuthed(http.MethodPost, "/households", Household{Name: "Home"})
+	expectStatus(t, createRR, http.StatusCreated)
+	household := decodeBody[Household](t, createRR)
+	if household.Role != householdRoleOwner {
+		t.Fatalf("expected creator to be owner, got %s", household.Role)
+	}
+
+	// Non-members cannot attach records to the household.
+	partnerAccount := Account{Name: "Partner Wallet", Type: "Cash", HouseholdID: &household.ID}
+	forbiddenRR := callAuthedAs(partnerCookie, http.MethodPost, "/accounts", partnerAccount)
+	expectStatus(t, forbiddenRR, http.StatusForbidden)
+
+	inviteRR := callAuthed(http.MethodPost, fmt.Sprintf("/households/%d/invites", household.ID), nil)
+	expectStatus(t, inviteRR, http.StatusCreated)
+	invite := decodeBody[HouseholdInvite](t, inviteRR)
+
+	acceptRR := callAuthedAs(partnerCookie, http.MethodPost, "/invites/accept", acceptInviteRequest{Token: invite.Token})
+	expectStatus(t, acceptRR, http.StatusOK)
+	joined := decodeBody[Household](t, acceptRR)
+	if joined.Role != householdRoleMember {
+		t.Fatalf("expected member role, got %s", joined.Role)
+	}
+
+	reuseRR := callAuthedAs(partnerCookie, http.MethodPost, "/invites/accept", acceptInviteRequest{Token: invite.Token})
+	expectStatus(t, reuseRR, http.StatusGone)
+
+	shared := Expense{Amount: 80, Category: "Groceries", Date: time.Now().UTC(), AccountID: testAccount(), HouseholdID: &household.ID}
+	sharedRR := callAuthed(http.MethodPost, "/expenses", shared)
+	expectStatus(t, sharedRR, http.StatusCreated)
+	sharedExpense := decodeBody[Expense](t, sharedRR)
+
+	personal := Expense{Amount: 15, Category: "Hobby", Date: time.Now().UTC(), AccountID: testAccount()}
+	personalRR := callAuthed(http.MethodPost, "/expenses", personal)
+	expectStatus(t, personalRR, http.StatusCreated)
+	personalExpense := decodeBody[Expense](t, personalRR)
+
+	getShared := callAuthedAs(partnerCookie, http.MethodGet, fmt.Sprintf("/expenses/%d", sharedExpense.ID), nil)
+	expectStatus(t, getShared, http.StatusOK)
+
+	getPersonal := callAuthedAs(partnerCookie, http.MethodGet, fmt.Sprintf("/expenses/%d", personalExpense.ID), nil)
+	expectStatus(t, getPersonal, http.StatusNotFound)
+
+	listRR := callAuthedAs(partnerCookie, http.MethodGet, "/expenses", nil)
+	expectStatus(t, listRR, http.StatusOK)
+	if list := decodeBody[[]Expense](t, listRR); len(list) != 1 || list[0].ID != sharedExpense.ID {
+		t.Fatalf("expected partner to see only the shared expense, got %+v", list)
+	}
+
+	memberDeleteRR := callAuthedAs(partnerCookie, http.MethodDelete, fmt.Sprintf("/households/%d", household.ID), nil)
+	expectStatus(t, memberDeleteRR, http.StatusForbidden)
+
+	ownerDeleteRR := callAuthed(http.MethodDelete, fmt.Sprintf("/households/%d", household.ID), nil)
+	expectStatus(t, ownerDeleteRR, http.StatusNoContent)
+
+	afterRR := callAuthedAs(partnerCookie, http.MethodGet, fmt.Sprintf("/expenses/%d", sharedExpense.ID), nil)
+	expectStatus(t, afterRR, http.StatusNotFound)
+}
+
+func TestInviteAcceptedOnce(t *testing.T) {
+	useTestDB(t)
+	household := decodeBody[Household](t, callAuthed(http.MethodPost, "/households", Household{Name: "Home"}))
+	invite := decodeBody[HouseholdInvite](t, callAuthed(http.MethodPost, fmt.Sprintf("/households/%d/invites", household.ID), nil))
+
+	cookies := make([]*http.Cookie, 5)
+	for i := range cookies {
+		cookies[i], _ = registerUser(t, fmt.Sprintf("guest%d@example.com", i), "GuestSecretPass123!")
+	}
+	codes := make([]int, len(cookies))
+	var wg sync.WaitGroup
+	for i, cookie := range cookies {
+		wg.Add(1)
+		go func(i int, cookie *http.Cookie) {
+			defer wg.Done()
+			codes[i] = callAuthedAs(cookie, http.MethodPost, "/invites/accept", acceptInviteRequest{Token: invite.Token}).Code
+		}(i, cookie)
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			accepted++
+		case http.StatusGone:
+		default:
+			t.Fatalf("expected 200 or 410, got codes %v", codes)
+		}
+	}
+	var members int
+	if err := testApp.db.QueryRow("SELECT COUNT(*) FROM household_members WHERE household_id = ?", household.ID).Scan(&members); err != nil {
+		t.Fatal(err)
+	}
+	if accepted != 1 || members != 2 {
+		t.Fatalf("expected the invite to admit one guest, got %d accepted and %d members (codes %v)", accepted, members, codes)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// incomeSourceReportTop is how many sources the monthly matrix of
+// GET /reports/income-sources follows.
+const incomeSourceReportTop = 5
+
+// IncomeSourceReport breaks income down by source over a range of days.
+// Sources are grouped ignoring case and named as the most recent income
+// spelled them. Months is one row per month from the first to the last,
+// holding the totals of the TopSources, the largest sources by total.
+type IncomeSourceReport struct {
+	From       string              `json:"date_from,omitempty"`
+	To         string              `json:"date_to,omitempty"`
+	Total      float64             `json:"total"`
+	Sources    []IncomeSourceTotal `json:"sources"`
+	TopSources []string            `json:"top_sources"`
+	Months     []IncomeSourceMonth `json:"months"`
+	Display    map[string]string   `json:"display,omitempty"`
+}
+
+// IncomeSourceTotal is one source's share of the report. Percent is of the
+// report's total.
+type IncomeSourceTotal struct {
+	Source  string            `json:"source"`
+	Total   float64           `json:"total"`
+	Percent float64           `json:"percent"`
+	Count   int               `json:"count"`
+	Average float64           `json:"average"`
+	Display map[string]string `json:"display,omitempty"`
+}
+
+// IncomeSourceMonth holds each top source's total for one month, zero when
+// nothing came from it.
+type IncomeSourceMonth struct {
+	Month  string             `json:"month"`
+	Totals map[string]float64 `json:"totals"`
+}
+
+// incomeSourcesReportHandler serves GET /reports/income-sources. date_from
+// and date_to are inclusive days in the user's timezone; without them the
+// report covers every income. Opening balances are left out, as in the
+// income-vs-expense report.
+func (app *App) incomeSourcesReportHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "date_from", "date_to", "format") {
+		return
+	}
+	money, ok := app.displayFormatter(w, r, userID)
+	if !ok {
+		return
+	}
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	from, ok := parseDayParam(w, params.Get("date_from"), "date_from", time.Time{}, loc)
+	if !ok {
+		return
+	}
+	to, ok := parseDayParam(w, params.Get("date_to"), "date_to", time.Time{}, loc)
+	if !ok {
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		http.Error(w, "date_to must not be before date_from", http.StatusBadRequest)
+		return
+	}
+
+	report, err := computeIncomeSourceReport(app.requestDB(r), userID, from, to, loc)
+	if errors.Is(err, errTooManyReportBuckets) {
+		http.Error(w, fmt.Sprintf("Range spans more than %d months; narrow it", maxReportBuckets), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("income source report error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if money != nil {
+		report.Display = money.amounts(map[string]float64{"total": report.Total})
+		for i := range report.Sources {
+			s := &report.Sources[i]
+			s.Display = money.amounts(map[string]float64{"total": s.Total, "average": s.Average})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// computeIncomeSourceReport reads the user's incomes oldest first, so the
+// last spelling seen of each source is its most recent. from and to are
+// calendar days in loc, either of them zero for no bound.
+func computeIncomeSourceReport(q rowsQuerier, userID int, from, to time.Time, loc *time.Location) (IncomeSourceReport, error) {
+	report := IncomeSourceReport{Sources: []IncomeSourceTotal{}, TopSources: []string{}, Months: []IncomeSourceMonth{}}
+	query := "SELECT source, date, amount FROM incomes WHERE user_id = ? AND opening_balance = 0"
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		report.From = from.Format(statsDateFormat)
+		query += " AND date >= ?"
+		args = append(args, dayStart(from, loc))
+	}
+	if !to.IsZero() {
+		report.To = to.Format(statsDateFormat)
+		query += " AND date < ?"
+		args = append(args, dayStart(to.AddDate(0, 0, 1), loc))
+	}
+
+	type group struct {
+		IncomeSourceTotal
+		months map[string]float64
+	}
+	month := reportPeriods["month"]
+	groups := map[string]*group{}
+	seen := map[string]bool{}
+	rows, err := q.Query(query+" ORDER BY date, id", args...)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var source, dateStr string
+		var amount float64
+		if err := rows.Scan(&source, &dateStr, &amount); err != nil {
+			return report, err
+		}
+		date, err := parseTimestamp(dateStr)
+		if err != nil {
+			return report, err
+		}
+		key := strings.ToLower(source)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{months: map[string]float64{}}
+			groups[key] = g
+		}
+		g.Source = source
+		g.Total += amount
+		g.Count++
+		start := month.start(localDay(date, loc)).Format(statsDateFormat)
+		g.months[start] += amount
+		seen[start] = true
+		report.Total += amount
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	sorted := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		g.Total = roundCents(g.Total)
+		g.Average = roundCents(g.Total / float64(g.Count))
+		sorted = append(sorted, g)
+	}
+	report.Total = roundCents(report.Total)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Total != sorted[j].Total {
+			return sorted[i].Total > sorted[j].Total
+		}
+		return sorted[i].Source < sorted[j].Source
+	})
+	for _, g := range sorted {
+		if report.Total != 0 {
+			g.Percent = roundCents(g.Total / report.Total * 100)
+		}
+		report.Sources = append(report.Sources, g.IncomeSourceTotal)
+	}
+	top := sorted[:min(len(sorted), incomeSourceReportTop)]
+	for _, g := range top {
+		report.TopSources = append(report.TopSources, g.Source)
+	}
+
+	var starts []string
+	for start := range seen {
+		starts = append(starts, start)
+	}
+	sort.Strings(starts)
+	if len(starts) == 0 && (from.IsZero() || to.IsZero()) {
+		return report, nil
+	}
+	starts, err = fillReportBuckets(month, starts, from, to)
+	if err != nil {
+		return report, err
+	}
+	for _, start := range starts {
+		t, err := time.Parse(statsDateFormat, start)
+		if err != nil {
+			return report, err
+		}
+		row := IncomeSourceMonth{Month: month.label(t), Totals: make(map[string]float64, len(top))}
+		for _, g := range top {
+			row.Totals[g.Source] = roundCents(g.months[start])
+		}
+		report.Months = append(report.Months, row)
+	}
+	return report, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIncomeSourceReport(t *testing.T) {
+	useTestDB(t)
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Timezone: "Asia/Jakarta", Locale: "id-ID", Currency: "IDR"}), http.StatusOK)
+	// An opening balance is not income earned.
+	expectStatus(t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Savings", Type: "bank", Balance: 999}), http.StatusCreated)
+
+	date := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2025, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	incomes := []Income{
+		{Amount: 1000, Source: "salary", Date: date(time.January, 10, 3)},
+		// 20:00 UTC on 31 January is 1 February in Jakarta.
+		{Amount: 1000, Source: "SALARY", Date: date(time.January, 31, 20)},
+		{Amount: 1000, Source: "Salary", Date: date(time.March, 10, 3)},
+		{Amount: 300, Source: "Freelance", Date: date(time.January, 15, 3)},
+		{Amount: 100, Source: "Freelance", Date: date(time.March, 15, 3)},
+		{Amount: 200, Source: "Dividends", Date: date(time.March, 1, 3)},
+		{Amount: 150, Source: "Gifts", Date: date(time.January, 2, 3)},
+		{Amount: 50, Source: "Refund", Date: date(time.February, 2, 3)},
+		{Amount: 20, Source: "Cashback", Date: date(time.February, 3, 3)},
+	}
+	for _, in := range incomes {
+		in.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/incomes", in), http.StatusCreated)
+	}
+
+	get := func(query string) IncomeSourceReport {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, "/reports/income-sources"+query, nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[IncomeSourceReport](t, rr)
+	}
+	report := get("")
+	if report.Total != 3820 || len(report.Sources) != 6 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if got, want := report.Sources[0], (IncomeSourceTotal{Source: "Salary", Total: 3000, Percent: 78.53, Count: 3, Average: 1000}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if got, want := report.Sources[1], (IncomeSourceTotal{Source: "Freelance", Total: 400, Percent: 10.47, Count: 2, Average: 200}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if want := "[Salary Freelance Dividends Gifts Refund]"; fmt.Sprint(report.TopSources) != want {
+		t.Fatalf("expected top sources %s, got %v", want, report.TopSources)
+	}
+	if len(report.Months) != 3 {
+		t.Fatalf("expected January to March, got %+v", report.Months)
+	}
+	if feb := report.Months[1]; feb.Month != "2025-02" || feb.Totals["Salary"] != 1000 || feb.Totals["Freelance"] != 0 || feb.Totals["Refund"] != 50 || len(feb.Totals) != 5 {
+		t.Fatalf("unexpected February: %+v", feb)
+	}
+
+	// A range keeps its months even without income in them, and counts the
+	// day in the user's timezone.
+	report = get("?date_from=2025-02-01&date_to=2025-04-30&format=display")
+	if report.Total != 2370 || report.Sources[0].Source != "Salary" || report.Sources[0].Count != 2 || report.Display["total"] == "" || report.Sources[0].Display["average"] == "" {
+		t.Fatalf("unexpected report for February to April: %+v", report)
+	}
+	if len(report.Months) != 3 || report.Months[2].Month != "2025-04" || report.Months[2].Totals["Salary"] != 0 {
+		t.Fatalf("expected February to April, got %+v", report.Months)
+	}
+
+	if empty := get("?date_from=2024-01-01&date_to=2024-02-29"); empty.Total != 0 || len(empty.Sources) != 0 || len(empty.Months) != 2 {
+		t.Fatalf("unexpected empty report: %+v", empty)
+	}
+	for _, query := range []string{"?date_from=2025-03-01&date_to=2025-02-01", "?date_from=1900-01-01&date_to=2100-01-01", "?format=fancy"} {
+		expectStatus(t, callAuthed(http.MethodGet, "/reports/income-sources"+query, nil), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+// queryIndexes serve the filters the list, report, and background queries
+// use most, on top of the per-table indexes created with each table;
+// account_id is indexed where ensureAccountColumns adds it. The
+// user_id-first pairs let a date range or category be searched within one
+// user's rows instead of scanning all of them.
+var queryIndexes = []struct {
+	name, table, columns string
+}{
+	// Date ranges on lists, reports, and stats.
+	{"idx_expenses_user_date", "expenses", "user_id, date"},
+	{"idx_incomes_user_date", "incomes", "user_id, date"},
+	// Grouping and filtering by category.
+	{"idx_expenses_user_category", "expenses", "user_id, category"},
+	// The recurring processor looks for unpaused schedules that are due.
+	{"idx_recurring_expenses_due", "recurring_expenses", "paused, next_due_date"},
+	// The expired sessions job.
+	{"idx_sessions_expires_at", "sessions", "expires_at"},
+}
+
+// createQueryIndexes adds queryIndexes.
+func (app *App) createQueryIndexes() error {
+	for _, idx := range queryIndexes {
+		stmt := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s(%s)", idx.name, idx.table, idx.columns)
+		if _, err := app.db.Exec(stmt); err != nil {
+			return fmt.Errorf("create %s index: %w", idx.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// queryPlan returns SQLite's EXPLAIN QUERY PLAN for query, one step per
+// line.
+func queryPlan(t *testing.T, query string, args ...interface{}) string {
+	t.Helper()
+	rows, err := testApp.db.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		t.Fatalf("explain %s: %v", query, err)
+	}
+	defer rows.Close()
+	var steps []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		steps = append(steps, detail)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(steps, "\n")
+}
+
+func TestQueryIndexes(t *testing.T) {
+	useTestDB(t)
+	if _, ok := testApp.dialect.(postgresDialect); ok {
+		t.Skip("EXPLAIN QUERY PLAN is SQLite's")
+	}
+	from, to := "2024-01-01 00:00:00", "2024-02-01 00:00:00"
+	for _, c := range []struct {
+		query string
+		args  []interface{}
+		index string
+	}{
+		// GET /expenses?date_from=...&date_to=..., household scope included.
+		{"SELECT id FROM expenses WHERE " + householdScope + " AND date >= ? AND date < ? LIMIT ? OFFSET ?", []interface{}{1, 1, from, to, 50, 0}, "idx_expenses_user_date (user_id=? AND date>? AND date<?)"},
+		{"SELECT id FROM incomes WHERE " + householdScope + " AND date >= ? AND date < ?", []interface{}{1, 1, from, to}, "idx_incomes_user_date (user_id=? AND date>? AND date<?)"},
+		{"SELECT SUM(amount) FROM expenses WHERE user_id = ? AND category = ?", []interface{}{1, "Food"}, "idx_expenses_user_category (user_id=? AND category=?)"},
+		{"SELECT id FROM expenses WHERE account_id = ?", []interface{}{1}, "idx_expenses_account (account_id=?)"},
+		{"SELECT id FROM incomes WHERE account_id = ?", []interface{}{1}, "idx_incomes_account (account_id=?)"},
+		{"SELECT DISTINCT user_id FROM recurring_expenses WHERE next_due_date <= ? AND paused = 0", []interface{}{to}, "idx_recurring_expenses_due (paused=? AND next_due_date<?)"},
+		{"DELETE FROM sessions WHERE expires_at < ?", []interface{}{to}, "idx_sessions_expires_at (expires_at<?)"},
+	} {
+		if plan := queryPlan(t, c.query, c.args...); !strings.Contains(plan, c.index) {
+			t.Errorf("expected %s to search %s, got:\n%s", c.query, c.index, plan)
+		}
+	}
+}
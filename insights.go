@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// topExpensesLimit is how many of the period's largest expenses insights list.
+const topExpensesLimit = 5
+
+// SpendingInsights describes the user's spending in one period. From and To
+// are the inclusive days covered, which stop at today while the period is in
+// progress; ComparedFrom and ComparedTo are the matching days of the
+// previous period used for BiggestIncrease.
+type SpendingInsights struct {
+	Period          string            `json:"period"`
+	From            string            `json:"date_from"`
+	To              string            `json:"date_to"`
+	ComparedFrom    string            `json:"compared_from"`
+	ComparedTo      string            `json:"compared_to"`
+	TopExpenses     []LargestSpend    `json:"top_expenses"`
+	BiggestIncrease *CategoryIncrease `json:"biggest_increase"`
+	TopWeekday      *WeekdaySpend     `json:"top_weekday"`
+	NoSpendDays     NoSpendDays       `json:"no_spend_days"`
+}
+
+// CategoryIncrease is the category whose spending grew the most over the
+// previous period. Split expenses count towards each split's category.
+type CategoryIncrease struct {
+	Category string            `json:"category"`
+	Previous float64           `json:"previous"`
+	Current  float64           `json:"current"`
+	Increase float64           `json:"increase"`
+	Display  map[string]string `json:"display,omitempty"`
+}
+
+type WeekdaySpend struct {
+	Weekday string            `json:"weekday"`
+	Total   float64           `json:"total"`
+	Display map[string]string `json:"display,omitempty"`
+}
+
+type NoSpendDays struct {
+	Count int `json:"count"`
+	Days  int `json:"days"`
+}
+
+// dayWindow is a half-open range of calendar days, [start, end).
+type dayWindow struct {
+	start, end time.Time
+}
+
+func (d dayWindow) days() int {
+	return int(d.end.Sub(d.start).Hours() / 24)
+}
+
+// insightWindows returns the window of the period containing at and the
+// window of the period before it to compare against. A period still in
+// progress is cut off after today, and the comparison then covers the same
+// number of days from the start of the previous period, never running past
+// its end: March 1-31 compares with all of February, March 1-15 with
+// February 1-15. A finished period compares with the whole previous one.
+func insightWindows(period reportPeriod, at, today time.Time) (current, previous dayWindow) {
+	current.start = period.start(at)
+	current.end = period.next(current.start)
+	previous.start = period.start(current.start.AddDate(0, 0, -1))
+	previous.end = current.start
+
+	if tomorrow := today.AddDate(0, 0, 1); tomorrow.Before(current.end) {
+		current.end = tomorrow
+		if end := previous.start.AddDate(0, 0, current.days()); end.Before(previous.end) {
+			previous.end = end
+		}
+	}
+	return current, previous
+}
+
+// insightsHandler serves GET /reports/insights. period is week, month,
+// quarter, or year (default month) and date picks the period by any day in
+// it (default today).
+func (app *App) insightsHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "period", "date", "format") {
+		return
+	}
+	money, ok := app.displayFormatter(w, r, userID)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(params.Get("period"))
+	if name == "" {
+		name = "month"
+	}
+	period, ok := reportPeriods[name]
+	if !ok {
+		http.Error(w, "Invalid period; use week, month, quarter, or year", http.StatusBadRequest)
+		return
+	}
+
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	today := localDay(time.Now(), loc)
+	at, ok := parseDayParam(w, params.Get("date"), "date", today, loc)
+	if !ok {
+		return
+	}
+	if period.start(at).After(today) {
+		http.Error(w, "date must not be in a future period", http.StatusBadRequest)
+		return
+	}
+
+	insights, err := computeInsights(app.requestDB(r), userID, period, at, today, loc)
+	if err != nil {
+		log.Printf("insights error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if money != nil {
+		for i := range insights.TopExpenses {
+			insights.TopExpenses[i].Display = money.amounts(map[string]float64{"amount": insights.TopExpenses[i].Amount})
+		}
+		if inc := insights.BiggestIncrease; inc != nil {
+			inc.Display = money.amounts(map[string]float64{"previous": inc.Previous, "current": inc.Current, "increase": inc.Increase})
+		}
+		if day := insights.TopWeekday; day != nil {
+			day.Display = money.amounts(map[string]float64{"total": day.Total})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(insights)
+}
+
+// computeInsights works on calendar days in loc: at and today are days
+// there, and spending is assigned to weekdays by where it fell there.
+func computeInsights(q querier, userID int, period reportPeriod, at, today time.Time, loc *time.Location) (SpendingInsights, error) {
+	current, previous := insightWindows(period, at, today)
+	insights := SpendingInsights{
+		Period:       period.label(current.start),
+		From:         current.start.Format(statsDateFormat),
+		To:           current.end.AddDate(0, 0, -1).Format(statsDateFormat),
+		ComparedFrom: previous.start.Format(statsDateFormat),
+		ComparedTo:   previous.end.AddDate(0, 0, -1).Format(statsDateFormat),
+	}
+	where := " FROM expenses WHERE user_id = ? AND date >= ? AND date < ?"
+	args := []interface{}{userID, dayStart(current.start, loc), dayStart(current.end, loc)}
+
+	var err error
+	if insights.TopExpenses, err = largestExpenses(q, where, args); err != nil {
+		return insights, err
+	}
+	if insights.BiggestIncrease, err = biggestCategoryIncrease(q, userID, current, previous, loc); err != nil {
+		return insights, err
+	}
+
+	days, err := dailyTotals(q, loc, "SELECT date, amount"+where, args...)
+	if err != nil {
+		return insights, err
+	}
+	var weekdays [7]float64
+	var spent [7]bool
+	for day, total := range days {
+		weekdays[day.Weekday()] += total
+		spent[day.Weekday()] = true
+	}
+	for weekday, total := range weekdays {
+		// Ties go to the earliest weekday, Sunday first.
+		if spent[weekday] && (insights.TopWeekday == nil || roundCents(total) > insights.TopWeekday.Total) {
+			insights.TopWeekday = &WeekdaySpend{Weekday: time.Weekday(weekday).String(), Total: roundCents(total)}
+		}
+	}
+	insights.NoSpendDays = NoSpendDays{Count: current.days() - len(days), Days: current.days()}
+	return insights, nil
+}
+
+func largestExpenses(q rowsQuerier, where string, args []interface{}) ([]LargestSpend, error) {
+	rows, err := q.Query("SELECT id, amount, category, date"+where+" ORDER BY amount DESC, id LIMIT ?", append(append([]interface{}{}, args...), topExpensesLimit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spends := []LargestSpend{}
+	for rows.Next() {
+		var spend LargestSpend
+		var dateStr string
+		if err := rows.Scan(&spend.ID, &spend.Amount, &spend.Category, &dateStr); err != nil {
+			return nil, err
+		}
+		if spend.Date, err = parseTimestamp(dateStr); err != nil {
+			return nil, err
+		}
+		spends = append(spends, spend)
+	}
+	return spends, rows.Err()
+}
+
+// biggestCategoryIncrease compares per-category totals of the two windows
+// and returns the largest rise, or nil when no category grew.
+func biggestCategoryIncrease(q rowsQuerier, userID int, current, previous dayWindow, loc *time.Location) (*CategoryIncrease, error) {
+	totals := func(window dayWindow) (map[string]float64, error) {
+		rows, err := q.Query("SELECT category, SUM(amount) FROM "+expenseCategoryLines+" WHERE user_id = ? AND date >= ? AND date < ? GROUP BY category",
+			userID, dayStart(window.start, loc), dayStart(window.end, loc))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		result := map[string]float64{}
+		for rows.Next() {
+			var category string
+			var total float64
+			if err := rows.Scan(&category, &total); err != nil {
+				return nil, err
+			}
+			result[category] = total
+		}
+		return result, rows.Err()
+	}
+
+	now, err := totals(current)
+	if err != nil {
+		return nil, err
+	}
+	before, err := totals(previous)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *CategoryIncrease
+	for category, total := range now {
+		increase := roundCents(total - before[category])
+		if increase <= 0 {
+			continue
+		}
+		if best == nil || increase > best.Increase || (increase == best.Increase && category < best.Category) {
+			best = &CategoryIncrease{Category: category, Previous: roundCents(before[category]), Current: roundCents(total), Increase: increase}
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInsightWindows(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	later := day(2030, 1, 1)
+
+	cases := []struct {
+		name          string
+		period        string
+		at, today     time.Time
+		current, prev [2]time.Time
+	}{
+		{"finished 31-day month after leap February", "month", day(2024, 3, 10), later,
+			[2]time.Time{day(2024, 3, 1), day(2024, 4, 1)}, [2]time.Time{day(2024, 2, 1), day(2024, 3, 1)}},
+		{"finished February after 31-day January", "month", day(2024, 2, 29), later,
+			[2]time.Time{day(2024, 2, 1), day(2024, 3, 1)}, [2]time.Time{day(2024, 1, 1), day(2024, 2, 1)}},
+		{"month wraps into the previous year", "month", day(2024, 1, 31), later,
+			[2]time.Time{day(2024, 1, 1), day(2024, 2, 1)}, [2]time.Time{day(2023, 12, 1), day(2024, 1, 1)}},
+		{"in progress mid-month compares the same days", "month", day(2024, 3, 15), day(2024, 3, 15),
+			[2]time.Time{day(2024, 3, 1), day(2024, 3, 16)}, [2]time.Time{day(2024, 2, 1), day(2024, 2, 16)}},
+		{"in progress on the 31st is capped at short February", "month", day(2023, 3, 31), day(2023, 3, 31),
+			[2]time.Time{day(2023, 3, 1), day(2023, 4, 1)}, [2]time.Time{day(2023, 2, 1), day(2023, 3, 1)}},
+		{"in progress on the 31st is capped at 30-day April", "month", day(2024, 5, 31), day(2024, 5, 31),
+			[2]time.Time{day(2024, 5, 1), day(2024, 6, 1)}, [2]time.Time{day(2024, 4, 1), day(2024, 5, 1)}},
+		{"in progress on the 30th of a 31-day month", "month", day(2024, 7, 30), day(2024, 7, 30),
+			[2]time.Time{day(2024, 7, 1), day(2024, 7, 31)}, [2]time.Time{day(2024, 6, 1), day(2024, 7, 1)}},
+		{"week starts on Monday", "week", day(2024, 1, 3), later,
+			[2]time.Time{day(2024, 1, 1), day(2024, 1, 8)}, [2]time.Time{day(2023, 12, 25), day(2024, 1, 1)}},
+		{"in progress quarter", "quarter", day(2024, 5, 20), day(2024, 5, 20),
+			[2]time.Time{day(2024, 4, 1), day(2024, 5, 21)}, [2]time.Time{day(2024, 1, 1), day(2024, 2, 20)}},
+	}
+	for _, c := range cases {
+		current, previous := insightWindows(reportPeriods[c.period], c.at, c.today)
+		if !current.start.Equal(c.current[0]) || !current.end.Equal(c.current[1]) {
+			t.Errorf("%s: expected current %v to %v, got %v to %v", c.name, c.current[0], c.current[1], current.start, current.end)
+		}
+		if !previous.start.Equal(c.prev[0]) || !previous.end.Equal(c.prev[1]) {
+			t.Errorf("%s: expected previous %v to %v, got %v to %v", c.name, c.prev[0], c.prev[1], previous.start, previous.end)
+		}
+	}
+}
+
+func TestSpendingInsights(t *testing.T) {
+	useTestDB(t)
+
+	day := func(m time.Month, d int) time.Time { return time.Date(2024, m, d, 12, 0, 0, 0, time.UTC) }
+	for _, e := range []Expense{
+		{Amount: 20, Category: "Food", Date: day(2, 5)},
+		{Amount: 50, Category: "Fun", Date: day(2, 10)},
+		// March 2024: Fridays are the 1st, 8th, 15th, 22nd and 29th.
+		{Amount: 30, Category: "Food", Date: day(3, 1)},
+		{Amount: 45, Category: "Food", Date: day(3, 8)},
+		{Amount: 10, Category: "Fun", Date: day(3, 9)},
+		{Amount: 60, Category: "Rent", Date: day(3, 11)},
+		{Amount: 5, Category: "Food", Date: day(3, 11)},
+		{Amount: 15, Category: "Fun", Date: day(3, 20)},
+		{Amount: 1, Category: "Food", Date: day(4, 1)},
+	} {
+		e.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	rr := callAuthed(http.MethodGet, "/reports/insights?period=month&date=2024-03-15", nil)
+	expectStatus(t, rr, http.StatusOK)
+	insights := decodeBody[SpendingInsights](t, rr)
+
+	if insights.Period != "2024-03" || insights.From != "2024-03-01" || insights.To != "2024-03-31" || insights.ComparedFrom != "2024-02-01" || insights.ComparedTo != "2024-02-29" {
+		t.Fatalf("unexpected windows: %+v", insights)
+	}
+	want := []float64{60, 45, 30, 15, 10}
+	if len(insights.TopExpenses) != len(want) {
+		t.Fatalf("expected %d top expenses, got %+v", len(want), insights.TopExpenses)
+	}
+	for i, amount := range want {
+		if insights.TopExpenses[i].Amount != amount {
+			t.Fatalf("expected top expenses %v, got %+v", want, insights.TopExpenses)
+		}
+	}
+	// Food and Rent both rise by 60; ties go to the first category by name.
+	if got := insights.BiggestIncrease; got == nil || !reflect.DeepEqual(*got, CategoryIncrease{Category: "Food", Previous: 20, Current: 80, Increase: 60}) {
+		t.Fatalf("expected Food to have the biggest increase, got %+v", got)
+	}
+	if got := insights.TopWeekday; got == nil || !reflect.DeepEqual(*got, WeekdaySpend{Weekday: "Friday", Total: 75}) {
+		t.Fatalf("expected Friday as the top weekday, got %+v", got)
+	}
+	if insights.NoSpendDays != (NoSpendDays{Count: 26, Days: 31}) {
+		t.Fatalf("expected 26 of 31 days without spending, got %+v", insights.NoSpendDays)
+	}
+
+	empty := decodeBody[SpendingInsights](t, callAuthed(http.MethodGet, "/reports/insights?date=2023-06-01", nil))
+	if len(empty.TopExpenses) != 0 || empty.BiggestIncrease != nil || empty.TopWeekday != nil || empty.NoSpendDays.Count != 30 {
+		t.Fatalf("expected empty insights for a month without spending, got %+v", empty)
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/insights?period=decade", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/insights?date=soon", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/insights?date="+time.Now().UTC().AddDate(0, 2, 0).Format(statsDateFormat), nil), http.StatusBadRequest)
+}
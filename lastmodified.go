@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// List and report responses carry a Last-Modified date: the last time
+// anything the user can see changed. A client that sends it back in
+// If-Modified-Since gets a bodiless 304 until the next write, so a polling
+// dashboard only downloads data that is new.
+//
+// The date is a per-user counter in user_data_versions, in Unix seconds. It
+// is bumped after every successful write request, before the response is
+// sent, and inside the transactions of background jobs that write on the
+// user's behalf. A household write bumps every member, since they see each
+// other's shared data. HTTP dates have whole-second precision, so a bump
+// within the second of the last one moves the counter a second ahead of the
+// clock rather than reusing a date a client may already hold.
+
+func (app *App) createDataVersionTable() error {
+	stmt := `
+    CREATE TABLE IF NOT EXISTS user_data_versions (
+        user_id INTEGER NOT NULL PRIMARY KEY,
+        modified_at BIGINT NOT NULL,
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(stmt)); err != nil {
+		return fmt.Errorf("create user_data_versions table: %w", err)
+	}
+	return nil
+}
+
+// householdPeers lists the users who share a household with userID.
+func householdPeers(q rowsQuerier, userID int) ([]int, error) {
+	rows, err := q.Query(`
+        SELECT DISTINCT m.user_id FROM household_members m
+        JOIN household_members mine ON mine.household_id = m.household_id
+        WHERE mine.user_id = ? AND m.user_id <> ?`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list household peers: %w", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// touchUserData moves the last-modified date forward for userID, everyone
+// who shares a household with them, and the users in also. Users that no
+// longer exist, such as one who just deleted their account, are skipped.
+func touchUserData(tx txQuerier, userID int, also ...int) error {
+	peers, err := householdPeers(tx, userID)
+	if err != nil {
+		return err
+	}
+	ids := map[int]bool{userID: true}
+	for _, id := range append(peers, also...) {
+		ids[id] = true
+	}
+
+	now := time.Now().Unix()
+	for id := range ids {
+		if _, err := tx.Exec(`
+            INSERT INTO user_data_versions(user_id, modified_at)
+            SELECT id, CAST(? AS BIGINT) FROM users WHERE id = ?
+            ON CONFLICT(user_id) DO UPDATE SET modified_at = CASE
+                WHEN user_data_versions.modified_at >= excluded.modified_at THEN user_data_versions.modified_at + 1
+                ELSE excluded.modified_at END`, now, id); err != nil {
+			return fmt.Errorf("bump last modified: %w", err)
+		}
+	}
+	return nil
+}
+
+// touchUserDataNow runs touchUserData in a transaction of its own.
+func (app *App) touchUserDataNow(userID int, also ...int) error {
+	tx, err := app.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := touchUserData(tx, userID, also...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// userDataModifiedAt returns the last-modified date for userID. A user with
+// no writes since the date was introduced starts from now.
+func (app *App) userDataModifiedAt(userID int) (time.Time, error) {
+	var unix int64
+	err := app.db.QueryRow("SELECT modified_at FROM user_data_versions WHERE user_id = ?", userID).Scan(&unix)
+	if err == sql.ErrNoRows {
+		unix = time.Now().Unix()
+		if _, err = app.db.Exec("INSERT INTO user_data_versions(user_id, modified_at) VALUES(?, ?) ON CONFLICT(user_id) DO NOTHING", userID, unix); err != nil {
+			return time.Time{}, err
+		}
+		err = app.db.QueryRow("SELECT modified_at FROM user_data_versions WHERE user_id = ?", userID).Scan(&unix)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(unix, 0).UTC(), nil
+}
+
+// dataChangeWriter bumps the user's last-modified date when a write request
+// succeeds. Handlers commit before they answer, so the bump lands after the
+// change and before the client can see the response. peers are the user's
+// household peers from before the request, who still need the bump when the
+// request leaves or deletes a household.
+type dataChangeWriter struct {
+	http.ResponseWriter
+	app         *App
+	userID      int
+	peers       []int
+	wroteHeader bool
+}
+
+func (w *dataChangeWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < http.StatusBadRequest {
+			if err := w.app.touchUserDataNow(w.userID, w.peers...); err != nil {
+				log.Printf("last modified bump error: %v", err)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *dataChangeWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *dataChangeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// trackDataChanges wraps w so a successful r that may write bumps userID's
+// last-modified date.
+func (app *App) trackDataChanges(w http.ResponseWriter, r *http.Request, userID int) http.ResponseWriter {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return w
+	}
+	peers, err := householdPeers(app.db, userID)
+	if err != nil {
+		log.Printf("last modified peers error: %v", err)
+	}
+	return &dataChangeWriter{ResponseWriter: w, app: app, userID: userID, peers: peers}
+}
+
+// withLastModified answers a list or report request with 304 Not Modified
+// when nothing has changed since If-Modified-Since, and otherwise sends the
+// Last-Modified date with the response. Reports count from today, so the
+// date is never earlier than the start of the user's day.
+func (app *App) withLastModified(handler authedHandler) authedHandler {
+	return func(w http.ResponseWriter, r *http.Request, userID int) {
+		modified, err := app.userDataModifiedAt(userID)
+		if err != nil {
+			log.Printf("last modified lookup error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		loc, ok := app.userLocation(w, userID)
+		if !ok {
+			return
+		}
+		now := time.Now().In(loc)
+		if today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc); today.After(modified) {
+			modified = today.UTC()
+		}
+
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		handler(w, withDataVersion(r, modified), userID)
+	}
+}
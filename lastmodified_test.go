@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConditionalGet(t *testing.T) {
+	useTestDB(t)
+	conditional := func(cookie *http.Cookie, target, since string) *httptest.ResponseRecorder {
+		req := authedRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			req.Header.Del("Cookie")
+			req.AddCookie(cookie)
+		}
+		if since != "" {
+			req.Header.Set("If-Modified-Since", since)
+		}
+		return serve(req)
+	}
+
+	rr := conditional(nil, "/expenses", "")
+	expectStatus(t, rr, http.StatusOK)
+	modified := rr.Header().Get("Last-Modified")
+	if _, err := http.ParseTime(modified); err != nil {
+		t.Fatalf("expected a Last-Modified date, got %q", modified)
+	}
+	if cc := rr.Header().Get("Cache-Control"); cc != "private, no-cache" {
+		t.Fatalf("unexpected Cache-Control %q", cc)
+	}
+
+	rr = conditional(nil, "/expenses", modified)
+	expectStatus(t, rr, http.StatusNotModified)
+	if rr.Body.Len() != 0 {
+		t.Fatalf("expected no body, got %q", rr.Body.String())
+	}
+	expectStatus(t, conditional(nil, "/dashboard", modified), http.StatusNotModified)
+
+	// Any write, even within the same second, invalidates every list.
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 4, Category: "Coffee", AccountID: testAccount()}), http.StatusCreated)
+	rr = conditional(nil, "/expenses", modified)
+	expectStatus(t, rr, http.StatusOK)
+	if list := decodeBody[[]Expense](t, rr); len(list) != 1 {
+		t.Fatalf("expected the new expense, got %+v", list)
+	}
+	expectStatus(t, conditional(nil, "/dashboard", modified), http.StatusOK)
+	next := rr.Header().Get("Last-Modified")
+	if next == modified {
+		t.Fatalf("expected Last-Modified to move on from %s", modified)
+	}
+	expectStatus(t, conditional(nil, "/expenses", next), http.StatusNotModified)
+
+	// Failed writes and reads leave it alone.
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: -1, Category: "Coffee"}), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/settings", nil), http.StatusOK)
+	expectStatus(t, conditional(nil, "/expenses", next), http.StatusNotModified)
+
+	// Background jobs count as writes.
+	expectStatus(t, callAuthed(http.MethodPost, "/recurring-expenses", RecurringExpense{Amount: 9.99, Category: "Streaming", Frequency: "monthly", NextDueDate: time.Now().UTC().AddDate(0, 0, 1)}), http.StatusCreated)
+	next = conditional(nil, "/expenses", "").Header().Get("Last-Modified")
+	if _, err := testApp.db.Exec("UPDATE recurring_expenses SET next_due_date = ?", time.Now().UTC().Add(-time.Hour).Format(timeFormat)); err != nil {
+		t.Fatal(err)
+	}
+	testApp.processRecurringExpenses()
+	expectStatus(t, conditional(nil, "/expenses", next), http.StatusOK)
+}
+
+func TestConditionalGetHousehold(t *testing.T) {
+	useTestDB(t)
+	partner, _ := registerUser(t, "partner@example.com", "PartnerSecretPass123!")
+	household := decodeBody[Household](t, callAuthed(http.MethodPost, "/households", Household{Name: "Home"}))
+	invite := decodeBody[HouseholdInvite](t, callAuthed(http.MethodPost, fmt.Sprintf("/households/%d/invites", household.ID), nil))
+	expectStatus(t, callAuthedAs(partner, http.MethodPost, "/invites/accept", acceptInviteRequest{Token: invite.Token}), http.StatusOK)
+
+	since := func() string {
+		return callAuthedAs(partner, http.MethodGet, "/expenses", nil).Header().Get("Last-Modified")
+	}
+	changed := func(since string) bool {
+		req := authedRequest(http.MethodGet, "/expenses", nil)
+		req.Header.Del("Cookie")
+		req.AddCookie(partner)
+		req.Header.Set("If-Modified-Since", since)
+		return serve(req).Code == http.StatusOK
+	}
+
+	// A write by one member is news to the others.
+	before := since()
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 80, Category: "Groceries", AccountID: testAccount(), HouseholdID: &household.ID}), http.StatusCreated)
+	if !changed(before) {
+		t.Fatal("expected the partner's lists to change after a shared write")
+	}
+
+	// So is deleting the household, though they are no longer members after.
+	before = since()
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/households/%d", household.ID), nil), http.StatusNoContent)
+	if !changed(before) {
+		t.Fatal("expected the partner's lists to change after the household was deleted")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// After maxFailedLogins consecutive wrong passwords an account is locked for
+// lockoutDuration. The counter and lock live on the users row so they
+// survive restarts; a successful login resets the counter and the lock
+// lifts by itself once it expires.
+const (
+	maxFailedLogins = 10
+	lockoutDuration = 15 * time.Minute
+)
+
+type lockoutError struct {
+	apiError
+	RetryAfter int `json:"retry_after_seconds"`
+}
+
+func (app *App) migrateLoginLockout() error {
+	if err := app.ensureColumn("users", "failed_logins", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return app.ensureColumn("users", "locked_until", "DATETIME")
+}
+
+// writeLockedError answers 423 Locked with the time left, rounded up to
+// whole seconds, in both Retry-After and the JSON body.
+func writeLockedError(w http.ResponseWriter, remaining time.Duration) {
+	seconds := int(math.Ceil(remaining.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeJSONError(w, http.StatusLocked, lockoutError{
+		apiError:   apiError{Error: fmt.Sprintf("Account locked after too many failed logins; try again in %s", (time.Duration(seconds) * time.Second).String()), Code: "account_locked"},
+		RetryAfter: seconds,
+	})
+}
+
+// activeLockout reports how long userID stays locked, or zero if it is not.
+// An expired lock is cleared, together with the failure count, so the user
+// starts over with a full set of attempts.
+func (app *App) activeLockout(userID int, lockedUntil sql.NullString, now time.Time) (time.Duration, error) {
+	if !lockedUntil.Valid {
+		return 0, nil
+	}
+	until, err := parseTimestamp(lockedUntil.String)
+	if err != nil {
+		return 0, err
+	}
+	if remaining := until.Sub(now); remaining > 0 {
+		return remaining, nil
+	}
+	if _, err := app.db.Exec("UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?", userID); err != nil {
+		return 0, err
+	}
+	log.Printf("user %d unlocked; lockout expired", userID)
+	return 0, nil
+}
+
+// recordFailedLogin counts a wrong password for userID, sent from ip, and
+// locks the account when the count reaches maxFailedLogins, returning the
+// new lock's length.
+// The count and lock are set in one statement so concurrent attempts cannot
+// slip past the limit.
+func (app *App) recordFailedLogin(userID int, ip string, now time.Time) (time.Duration, error) {
+	until := now.Add(lockoutDuration)
+	var failures int
+	err := app.db.QueryRow(`UPDATE users SET failed_logins = failed_logins + 1,
+		locked_until = CASE WHEN failed_logins + 1 >= ? THEN ? ELSE locked_until END
+		WHERE id = ? RETURNING failed_logins`,
+		maxFailedLogins, until.Format(timeFormat), userID).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+	if failures < maxFailedLogins {
+		return 0, nil
+	}
+	log.Printf("user %d locked until %s after %d failed logins, the last from %s", userID, until.Format(timeFormat), failures, ip)
+	return lockoutDuration, nil
+}
+
+// unlockUserHandler lifts a lockout before it expires. It is an admin route
+// and takes the user id from the path.
+func (app *App) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || userID <= 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	res, err := app.db.Exec("UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?", userID)
+	if err != nil {
+		log.Printf("unlock user error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("user %d unlocked by admin from %s", userID, app.clientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
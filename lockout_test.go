@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoginLockout(t *testing.T) {
+	useTestDB(t)
+	const email, password = "locked@example.com", "CorrectHorse123!"
+	_, userID := registerUser(t, email, password)
+
+	login := func(pw string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(credentials{Email: email, Password: pw})
+		return serve(httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body)))
+	}
+	fail := func(times int) {
+		t.Helper()
+		for i := 0; i < times; i++ {
+			expectStatus(t, login("wrong password"), http.StatusUnauthorized)
+		}
+	}
+
+	// A successful login resets the count of consecutive failures.
+	fail(maxFailedLogins - 1)
+	expectStatus(t, login(password), http.StatusOK)
+	fail(maxFailedLogins - 1)
+
+	rr := login("wrong password")
+	expectStatus(t, rr, http.StatusLocked)
+	if locked := decodeBody[lockoutError](t, rr); locked.Code != "account_locked" || locked.RetryAfter != int(lockoutDuration.Seconds()) {
+		t.Fatalf("expected a %s lock, got %+v", lockoutDuration, locked)
+	}
+
+	// The right password is refused while the lock lasts.
+	rr = login(password)
+	expectStatus(t, rr, http.StatusLocked)
+	if retry, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || retry <= 0 || retry > int(lockoutDuration.Seconds()) {
+		t.Fatalf("expected Retry-After within the lockout, got %q", rr.Header().Get("Retry-After"))
+	}
+
+	// The lock is stored on the user so it survives a restart.
+	var failures int
+	var lockedUntil string
+	if err := testApp.db.QueryRow("SELECT failed_logins, locked_until FROM users WHERE id = ?", userID).Scan(&failures, &lockedUntil); err != nil {
+		t.Fatalf("read lock: %v", err)
+	}
+	if failures != maxFailedLogins || lockedUntil == "" {
+		t.Fatalf("expected %d failures and a lock, got %d and %q", maxFailedLogins, failures, lockedUntil)
+	}
+
+	// Once the lock expires the user gets a fresh set of attempts.
+	past := time.Now().UTC().Add(-time.Second).Format(timeFormat)
+	if _, err := testApp.db.Exec("UPDATE users SET locked_until = ? WHERE id = ?", past, userID); err != nil {
+		t.Fatalf("expire lock: %v", err)
+	}
+	fail(maxFailedLogins - 1)
+	expectStatus(t, login(password), http.StatusOK)
+}
+
+func TestAdminUnlock(t *testing.T) {
+	useTestDB(t)
+	testApp.cfg.AdminToken = "unlock-secret"
+
+	const email, password = "unlock@example.com", "CorrectHorse123!"
+	_, userID := registerUser(t, email, password)
+	until := time.Now().UTC().Add(lockoutDuration).Format(timeFormat)
+	if _, err := testApp.db.Exec("UPDATE users SET failed_logins = ?, locked_until = ? WHERE id = ?", maxFailedLogins, until, userID); err != nil {
+		t.Fatalf("lock user: %v", err)
+	}
+
+	unlock := func(target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return serve(req)
+	}
+	expectStatus(t, unlock("/admin/users/"+strconv.Itoa(userID)+"/unlock", "wrong"), http.StatusUnauthorized)
+	expectStatus(t, unlock("/admin/users/9999/unlock", "unlock-secret"), http.StatusNotFound)
+	expectStatus(t, unlock("/admin/users/abc/unlock", "unlock-secret"), http.StatusBadRequest)
+	expectStatus(t, unlock("/admin/users/"+strconv.Itoa(userID)+"/unlock", "unlock-secret"), http.StatusNoContent)
+
+	body, _ := json.Marshal(credentials{Email: email, Password: password})
+	expectStatus(t, serve(httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body))), http.StatusOK)
+}
@@ -11,35 +11,61 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/mail"
-	"sort"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
-	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Expense struct {
-	ID        int       `json:"id"`
-	Amount    float64   `json:"amount"`
-	Category  string    `json:"category"`
-	Note      string    `json:"note"`
-	Date      time.Time `json:"date"`
-	AccountID *int      `json:"account_id"` // Optional
-	UserID    int       `json:"-"`
+	ID          int            `json:"id"`
+	Amount      float64        `json:"amount"`
+	Category    string         `json:"category"`
+	Note        string         `json:"note"`
+	Payee       *string        `json:"payee"`
+	Date        time.Time      `json:"date"`
+	AccountID   *int           `json:"account_id"` // Optional
+	HouseholdID *int           `json:"household_id"`
+	Splits      []ExpenseSplit `json:"splits,omitempty"`
+	HasSplits   bool           `json:"has_splits"`
+	// RecurringExpenseID is set on expenses generated by the recurring
+	// processor and is read-only through the API.
+	RecurringExpenseID *int `json:"recurring_expense_id"`
+	// Account is embedded by ?expand=account, as null when the expense has
+	// no account, and left out otherwise.
+	Account *AccountSummary `json:"account,omitempty"`
+	Timestamps
+	UserID   int `json:"-"`
+	expanded expandSet
 }
 
 type Budget struct {
-	ID        int       `json:"id"`
-	Category  string    `json:"category"`
-	Amount    float64   `json:"amount"`
-	StartDate time.Time `json:"start_date"`
-	EndDate   time.Time `json:"end_date"`
-	UserID    int       `json:"-"`
+	ID                int       `json:"id"`
+	Category          string    `json:"category"`
+	Amount            float64   `json:"amount"`
+	StartDate         time.Time `json:"start_date"`
+	EndDate           time.Time `json:"end_date"`
+	HouseholdID       *int      `json:"household_id"`
+	Period            string    `json:"period"`      // "weekly", "monthly", "yearly"; required for rollover
+	PeriodType        string    `json:"period_type"` // "one_off" (default), "weekly", "monthly"; see budget_periods.go
+	Rollover          bool      `json:"rollover"`
+	CarryOver         bool      `json:"carry_over"`
+	CarriedOverAmount float64   `json:"carried_over_amount"` // Set by rollover only
+	ParentBudgetID    *int      `json:"parent_budget_id"`    // Set by rollover only
+	AccountID         *int      `json:"account_id"`          // Optional; limits the budget to expenses from this account
+	AccountName       *string   `json:"account_name"`        // Read-only
+	AccountRemoved    bool      `json:"account_removed"`     // Read-only; set when the budget's account is deleted
+	IsActive          bool      `json:"is_active"`           // Read-only; whether now falls between start_date and end_date
+	Timestamps
+	UserID int `json:"-"`
 }
 
 type RecurringExpense struct {
@@ -48,32 +74,51 @@ type RecurringExpense struct {
 	Category    string    `json:"category"`
 	Note        string    `json:"note"`
 	Frequency   string    `json:"frequency"`
+	Interval    int       `json:"interval"` // Every N frequency units; defaults to 1
 	NextDueDate time.Time `json:"next_due_date"`
-	UserID      int       `json:"-"`
+	AnchorDay   int       `json:"anchor_day"` // Day of month monthly/yearly items fall on; defaults to next_due_date's day
+	Paused      bool      `json:"paused"`
+	// LastGeneratedAt and GeneratedCount are maintained by the processor.
+	LastGeneratedAt *time.Time `json:"last_generated_at"`
+	GeneratedCount  int        `json:"generated_count"`
+	Timestamps
+	UserID int `json:"-"`
 }
 
 type Income struct {
-	ID        int       `json:"id"`
-	Amount    float64   `json:"amount"`
-	Source    string    `json:"source"`
-	Note      string    `json:"note"`
-	Date      time.Time `json:"date"`
-	AccountID *int      `json:"account_id"` // Optional for backward compatibility/flexibility
-	UserID    int       `json:"-"`
+	ID          int       `json:"id"`
+	Amount      float64   `json:"amount"`
+	Source      string    `json:"source"`
+	Note        string    `json:"note"`
+	Date        time.Time `json:"date"`
+	AccountID   *int      `json:"account_id"` // Optional for backward compatibility/flexibility
+	HouseholdID *int      `json:"household_id"`
+	// OpeningBalance marks the entry recorded for an account's starting
+	// balance when it was created. It is read-only through the API.
+	OpeningBalance bool `json:"opening_balance"`
+	// Account is embedded by ?expand=account, as for expenses.
+	Account *AccountSummary `json:"account,omitempty"`
+	Timestamps
+	UserID   int `json:"-"`
+	expanded expandSet
 }
 
 type Account struct {
 	ID      int     `json:"id"`
 	Name    string  `json:"name"`
-	Type    string  `json:"type"` // e.g., "Cash", "Bank", "E-Wallet"
+	Type    string  `json:"type"` // One of accountTypes
 	Balance float64 `json:"balance"`
-	UserID  int     `json:"-"`
-}
-
-type MonthlyReport struct {
-	Month   string  `json:"month"`
-	Income  float64 `json:"income"`
-	Expense float64 `json:"expense"`
+	// AllowNegative lets expenses take the balance below zero. It defaults
+	// to true; a strict account refuses expenses it cannot cover.
+	AllowNegative *bool `json:"allow_negative"`
+	// MinimumBalance, if set, raises a low_balance notification when an
+	// expense takes the balance below it.
+	MinimumBalance *float64 `json:"minimum_balance"`
+	HouseholdID    *int     `json:"household_id"`
+	Timestamps
+	UserID int `json:"-"`
+	// balanceSet is whether a request body included balance.
+	balanceSet bool
 }
 
 type credentials struct {
@@ -87,65 +132,110 @@ type authResponse struct {
 }
 
 const (
-	sessionCookieName   = "session_token"
-	sessionTTL          = 24 * time.Hour
-	sessionRefreshDelta = sessionTTL / 3
-	timeFormat          = "2006-01-02 15:04:05"
-	maxJSONBody         = 1 << 20
-	bcryptCost          = 12
+	sessionCookieName = "session_token"
+	timeFormat        = "2006-01-02 15:04:05"
+	maxJSONBody       = 1 << 20
+	maxImportBody     = 32 << 20
+)
+
+// bcryptCost is set from Config at startup; tests lower it to
+// bcrypt.MinCost.
+var bcryptCost = defaultConfig().BcryptCost
+
+// comparePassword checks a password against its bcrypt hash. It is a
+// variable so tests can observe which code paths pay for a comparison.
+var comparePassword = bcrypt.CompareHashAndPassword
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
 )
 
-var db *sql.DB
+// dummyPasswordHash is compared against when a login names an unknown
+// email, so that path costs as much as a wrong password for a real user
+// and response times do not reveal which emails are registered. It is
+// made on first use, at the configured cost.
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("not the password of any user"), bcryptCost)
+		if err != nil {
+			log.Fatalf("dummy password hash: %v", err)
+		}
+		dummyHash = hash
+	})
+	return dummyHash
+}
 
 func main() {
-	var err error
-	db, err = sql.Open("sqlite3", "./expenses.db")
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("invalid configuration: %v", err)
 	}
-	defer db.Close()
+	log.Printf("Configuration: %s", cfg)
+	bcryptCost = cfg.BcryptCost
+	dummyPasswordHash()
 
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		log.Fatalf("failed to enable foreign keys: %v", err)
+	if cfg.RestoreFrom != "" {
+		if err := restoreSnapshot(cfg.RestoreFrom, cfg.DBPath); err != nil {
+			log.Fatalf("restore failed: %v", err)
+		}
+		log.Printf("Restored %s from %s", cfg.DBPath, cfg.RestoreFrom)
+		return
 	}
 
-	if err := createTables(); err != nil {
-		log.Fatalf("failed to initialize database: %v", err)
+	conn, err := openDatabase(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer conn.Close()
 
-	if err := ensureAccountColumns(); err != nil {
-		log.Fatalf("failed to migrate database (accounts): %v", err)
+	app := NewApp(conn, cfg)
+	if err := app.migrate(); err != nil {
+		log.Fatal(err)
 	}
 
-	http.HandleFunc("/auth/register", registerHandler)
-	http.HandleFunc("/auth/login", loginHandler)
-	http.HandleFunc("/auth/logout", logoutHandler)
-
-	http.HandleFunc("/expenses", withAuth(expensesHandler))
-	http.HandleFunc("/expenses/", withAuth(expenseHandler))
-	http.HandleFunc("/expenses/aggregates", withAuth(aggregatesHandler))
-	http.HandleFunc("/budgets", withAuth(budgetsHandler))
-	http.HandleFunc("/budgets/", withAuth(budgetHandler))
-	http.HandleFunc("/recurring-expenses", withAuth(recurringExpensesHandler))
-	http.HandleFunc("/recurring-expenses/", withAuth(recurringExpenseHandler))
-	http.HandleFunc("/incomes", withAuth(incomesHandler))
-	http.HandleFunc("/incomes/", withAuth(incomeHandler))
-	http.HandleFunc("/reports/income-vs-expense", withAuth(incomeVsExpenseReportHandler))
-	http.HandleFunc("/accounts", withAuth(accountsHandler))
-	http.HandleFunc("/accounts/", withAuth(accountHandler))
-
 	go func() {
-		ticker := time.NewTicker(24 * time.Hour)
+		ticker := time.NewTicker(cfg.JobInterval)
 		defer ticker.Stop()
 		for range ticker.C {
-			processRecurringExpenses()
+			runJob("recurring expenses", app.processRecurringExpenses)
+			runJob("budget rollover", app.rolloverBudgets)
+			runJob("deactivated users", app.purgeDeactivatedUsers)
+			runJob("tombstones", app.purgeTombstones)
+			runJob("expired sessions", app.purgeExpiredSessions)
+			runJob("read notifications", app.pruneReadNotifications)
+			runJob("operations", app.pruneOperations)
+			runJob("webhook log", app.pruneWebhookDeliveries)
 		}
 	}()
+	go app.runWebhookDispatcher()
+
+	if cfg.BackupDir != "" {
+		go func() {
+			ticker := time.NewTicker(cfg.BackupInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runJob("backup", func() { app.runScheduledBackup(cfg.BackupDir, cfg.BackupKeep) })
+			}
+		}()
+	}
 
-	log.Println("Server starting on port 8090...")
-	log.Fatal(http.ListenAndServe(":8090", nil))
+	addr := fmt.Sprintf(":%d", cfg.Port)
+	if cfg.TLSCert != "" {
+		if cfg.HTTPRedirectPort != 0 {
+			go func() {
+				log.Printf("Redirecting HTTP on port %d to HTTPS", cfg.HTTPRedirectPort)
+				log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", cfg.HTTPRedirectPort), httpsRedirect(cfg.Port)))
+			}()
+		}
+		log.Printf("Server starting with TLS on port %d...", cfg.Port)
+		log.Fatal(http.ListenAndServeTLS(addr, cfg.TLSCert, cfg.TLSKey, app))
+	}
+	log.Printf("Server starting on port %d...", cfg.Port)
+	log.Fatal(http.ListenAndServe(addr, app))
 }
-func createTables() error {
+
+func (app *App) createTables() error {
 	userTableStmt := `
     CREATE TABLE IF NOT EXISTS users (
         id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
@@ -154,7 +244,7 @@ func createTables() error {
         created_at DATETIME NOT NULL
     );
     `
-	if _, err := db.Exec(userTableStmt); err != nil {
+	if _, err := app.db.Exec(app.dialect.schema(userTableStmt)); err != nil {
 		return fmt.Errorf("create users table: %w", err)
 	}
 
@@ -168,7 +258,7 @@ func createTables() error {
         FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
     );
     `
-	if _, err := db.Exec(accountTableStmt); err != nil {
+	if _, err := app.db.Exec(app.dialect.schema(accountTableStmt)); err != nil {
 		return fmt.Errorf("create accounts table: %w", err)
 	}
 
@@ -180,7 +270,7 @@ func createTables() error {
         FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
     );
     `
-	if _, err := db.Exec(sessionTableStmt); err != nil {
+	if _, err := app.db.Exec(app.dialect.schema(sessionTableStmt)); err != nil {
 		return fmt.Errorf("create sessions table: %w", err)
 	}
 
@@ -195,7 +285,7 @@ func createTables() error {
         FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
     );
     `
-	if _, err := db.Exec(expenseTableStmt); err != nil {
+	if _, err := app.db.Exec(app.dialect.schema(expenseTableStmt)); err != nil {
 		return fmt.Errorf("create expenses table: %w", err)
 	}
 
@@ -210,7 +300,7 @@ func createTables() error {
         FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
     );
     `
-	if _, err := db.Exec(budgetTableStmt); err != nil {
+	if _, err := app.db.Exec(app.dialect.schema(budgetTableStmt)); err != nil {
 		return fmt.Errorf("create budgets table: %w", err)
 	}
 
@@ -226,7 +316,7 @@ func createTables() error {
         FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
     );
     `
-	if _, err := db.Exec(recurringExpenseTableStmt); err != nil {
+	if _, err := app.db.Exec(app.dialect.schema(recurringExpenseTableStmt)); err != nil {
 		return fmt.Errorf("create recurring_expenses table: %w", err)
 	}
 
@@ -241,102 +331,212 @@ func createTables() error {
         FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
     );
     `
-	if _, err := db.Exec(incomeTableStmt); err != nil {
+	if _, err := app.db.Exec(app.dialect.schema(incomeTableStmt)); err != nil {
 		return fmt.Errorf("create incomes table: %w", err)
 	}
 
-	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)"); err != nil {
+	auditLogTableStmt := `
+    CREATE TABLE IF NOT EXISTS audit_log (
+        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        entity_type TEXT NOT NULL,
+        entity_id INTEGER NOT NULL,
+        action TEXT NOT NULL,
+        old_data TEXT,
+        new_data TEXT,
+        created_at DATETIME NOT NULL,
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(auditLogTableStmt)); err != nil {
+		return fmt.Errorf("create audit_log table: %w", err)
+	}
+
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_audit_log_user_entity ON audit_log(user_id, entity_type, entity_id)"); err != nil {
+		return fmt.Errorf("create audit_log index: %w", err)
+	}
+
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)"); err != nil {
 		return fmt.Errorf("create sessions index: %w", err)
 	}
 
 	tables := []string{"expenses", "budgets", "recurring_expenses", "incomes"}
 	for _, table := range tables {
-		if err := ensureUserScopedTable(table); err != nil {
+		if err := app.ensureUserScopedTable(table); err != nil {
 			return err
 		}
 	}
 
-	return nil
-}
+	if err := app.ensureColumn("users", "deactivated_at", "DATETIME"); err != nil {
+		return err
+	}
 
-func ensureAccountColumns() error {
-	tables := []string{"expenses", "incomes"}
-	for _, table := range tables {
-		rows, err := db.Query(`PRAGMA table_info(` + table + `)`)
-		if err != nil {
-			return fmt.Errorf("inspect %s schema: %w", table, err)
-		}
+	if err := app.migrateLoginLockout(); err != nil {
+		return err
+	}
 
-		hasAccountID := false
-		for rows.Next() {
-			var cid int
-			var name, ctype string
-			var notNull, pk int
-			var dflt sql.NullString
-			if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
-				rows.Close()
-				return fmt.Errorf("scan %s schema: %w", table, err)
-			}
-			if strings.EqualFold(name, "account_id") {
-				hasAccountID = true
-			}
-		}
-		rows.Close()
+	if err := app.migrateQuotas(); err != nil {
+		return err
+	}
 
-		if !hasAccountID {
-			alter := fmt.Sprintf("ALTER TABLE %s ADD COLUMN account_id INTEGER REFERENCES accounts(id) ON DELETE SET NULL", table)
-			if _, err := db.Exec(alter); err != nil {
-				return fmt.Errorf("add account_id to %s: %w", table, err)
-			}
-		}
+	if err := app.migrateCalendarTokens(); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("expenses", "payee", "TEXT"); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("recurring_expenses", "paused", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("recurring_expenses", "anchor_day", "INTEGER"); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("recurring_expenses", "frequency_interval", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("recurring_expenses", "last_generated_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("recurring_expenses", "generated_count", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("expenses", "recurring_expense_id", "INTEGER REFERENCES recurring_expenses(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
+
+	if err := app.createHouseholdTables(); err != nil {
+		return err
+	}
+
+	if err := app.createSettingsTables(); err != nil {
+		return err
+	}
+
+	if err := app.createRuleTables(); err != nil {
+		return err
+	}
+
+	if err := app.createSplitTables(); err != nil {
+		return err
+	}
+
+	if err := app.migrateBudgetRollover(); err != nil {
+		return err
+	}
+
+	if err := app.migrateBudgetAccounts(); err != nil {
+		return err
+	}
+
+	if err := app.migrateTimestamps(); err != nil {
+		return err
+	}
+
+	if err := app.migrateAccountTypes(); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("accounts", "allow_negative", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("accounts", "minimum_balance", "REAL"); err != nil {
+		return err
+	}
+
+	if err := app.ensureColumn("incomes", "opening_balance", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := app.createSyncTables(); err != nil {
+		return err
+	}
+
+	if err := app.createNotificationTables(); err != nil {
+		return err
+	}
+
+	if err := app.createOperationTables(); err != nil {
+		return err
+	}
+
+	if err := app.createWebhookTables(); err != nil {
+		return err
+	}
+
+	if err := app.createBalanceHistoryTables(); err != nil {
+		return err
+	}
+
+	if err := app.createCategoryMetaTables(); err != nil {
+		return err
+	}
+
+	if err := app.createDataVersionTable(); err != nil {
+		return err
 	}
+
+	if err := app.createQueryIndexes(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func ensureUserScopedTable(table string) error {
-	rows, err := db.Query(`PRAGMA table_info(` + table + `)`)
+// ensureColumn adds column to table with the given definition if it is not
+// already present, so schema additions upgrade existing databases in place.
+func (app *App) ensureColumn(table, column, definition string) error {
+	exists, err := app.dialect.hasColumn(app.db, table, column)
 	if err != nil {
 		return fmt.Errorf("inspect %s schema: %w", table, err)
 	}
-	defer rows.Close()
+	if exists {
+		return nil
+	}
 
-	hasUserID := false
-	for rows.Next() {
-		var cid int
-		var name, ctype string
-		var notNull, pk int
-		var dflt sql.NullString
-		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
-			return fmt.Errorf("scan %s schema: %w", table, err)
+	alter := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := app.db.Exec(app.dialect.schema(alter)); err != nil {
+		return fmt.Errorf("add %s to %s: %w", column, table, err)
+	}
+	return nil
+}
+
+func (app *App) ensureAccountColumns() error {
+	tables := []string{"expenses", "incomes"}
+	for _, table := range tables {
+		if err := app.ensureColumn(table, "account_id", "INTEGER REFERENCES accounts(id) ON DELETE SET NULL"); err != nil {
+			return err
 		}
-		if strings.EqualFold(name, "user_id") {
-			hasUserID = true
+		// For account filters, and for clearing account_id when an account
+		// is deleted.
+		indexStmt := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_account ON %s(account_id)", table, table)
+		if _, err := app.db.Exec(indexStmt); err != nil {
+			return fmt.Errorf("create %s account index: %w", table, err)
 		}
 	}
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("iterate %s schema: %w", table, err)
-	}
+	return nil
+}
 
-	if !hasUserID {
-		alter := fmt.Sprintf("ALTER TABLE %s ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0", table)
-		if _, err := db.Exec(alter); err != nil {
-			return fmt.Errorf("add user_id to %s: %w", table, err)
-		}
+func (app *App) ensureUserScopedTable(table string) error {
+	if err := app.ensureColumn(table, "user_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
 	}
 
 	indexStmt := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_user ON %s(user_id)", table, table)
-	if _, err := db.Exec(indexStmt); err != nil {
+	if _, err := app.db.Exec(indexStmt); err != nil {
 		return fmt.Errorf("create %s user index: %w", table, err)
 	}
 
 	return nil
 }
-func registerHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+func (app *App) registerHandler(w http.ResponseWriter, r *http.Request) {
 	var creds credentials
 	if !decodeJSONBody(w, r, &creds) {
 		return
@@ -353,6 +553,8 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The password is hashed before the insert reveals whether the email
+	// is taken, so a conflict takes as long as a successful registration.
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcryptCost)
 	if err != nil {
 		log.Printf("password hashing error: %v", err)
@@ -361,7 +563,7 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	createdAt := time.Now().UTC().Format(timeFormat)
-	res, err := db.Exec("INSERT INTO users(email, password_hash, created_at) VALUES(?, ?, ?)", email, string(passwordHash), createdAt)
+	id, err := insertReturningID(app.db, "INSERT INTO users(email, password_hash, created_at) VALUES(?, ?, ?)", email, string(passwordHash), createdAt)
 	if err != nil {
 		if strings.Contains(strings.ToLower(err.Error()), "unique") {
 			http.Error(w, "Email already registered", http.StatusConflict)
@@ -372,14 +574,7 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		log.Printf("user id fetch error: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	if err := issueSession(w, r, int(id)); err != nil {
+	if err := app.issueSession(w, r, id); err != nil {
 		log.Printf("issue session error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -387,15 +582,10 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(authResponse{ID: int(id), Email: email})
+	json.NewEncoder(w).Encode(authResponse{ID: id, Email: email})
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+func (app *App) loginHandler(w http.ResponseWriter, r *http.Request) {
 	var creds credentials
 	if !decodeJSONBody(w, r, &creds) {
 		return
@@ -414,8 +604,11 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 
 	var userID int
 	var passwordHash string
-	err = db.QueryRow("SELECT id, password_hash FROM users WHERE email = ?", email).Scan(&userID, &passwordHash)
+	var deactivatedAt, lockedUntil sql.NullString
+	var failedLogins int
+	err = app.db.QueryRow("SELECT id, password_hash, deactivated_at, failed_logins, locked_until FROM users WHERE email = ?", email).Scan(&userID, &passwordHash, &deactivatedAt, &failedLogins, &lockedUntil)
 	if err == sql.ErrNoRows {
+		comparePassword(dummyPasswordHash(), []byte(creds.Password))
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	} else if err != nil {
@@ -424,12 +617,57 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(creds.Password)); err != nil {
+	// A locked account is refused before the password is checked, so even
+	// the right password has to wait out the lock.
+	now := time.Now().UTC()
+	remaining, err := app.activeLockout(userID, lockedUntil, now)
+	if err != nil {
+		log.Printf("lockout check error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if remaining > 0 {
+		writeLockedError(w, remaining)
+		return
+	}
+	if lockedUntil.Valid {
+		failedLogins = 0
+	}
+
+	if err := comparePassword([]byte(passwordHash), []byte(creds.Password)); err != nil {
+		locked, err := app.recordFailedLogin(userID, app.clientIP(r), now)
+		if err != nil {
+			log.Printf("record failed login error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if locked > 0 {
+			writeLockedError(w, locked)
+			return
+		}
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	if err := issueSession(w, r, userID); err != nil {
+	if failedLogins > 0 {
+		if _, err := app.db.Exec("UPDATE users SET failed_logins = 0 WHERE id = ?", userID); err != nil {
+			log.Printf("reset failed logins error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Logging in during the deletion grace period cancels the deletion.
+	if deactivatedAt.Valid {
+		if _, err := app.db.Exec("UPDATE users SET deactivated_at = NULL WHERE id = ?", userID); err != nil {
+			log.Printf("user reactivation error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("user %d reactivated; pending deletion cancelled", userID)
+	}
+
+	if err := app.issueSession(w, r, userID); err != nil {
 		log.Printf("issue session error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -439,15 +677,10 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(authResponse{ID: userID, Email: email})
 }
 
-func logoutHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+func (app *App) logoutHandler(w http.ResponseWriter, r *http.Request) {
 	if cookie, err := r.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
 		tokenHash := hashSessionToken(cookie.Value)
-		if _, err := db.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash); err != nil {
+		if _, err := app.db.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash); err != nil {
 			log.Printf("session delete error: %v", err)
 		}
 	}
@@ -458,30 +691,30 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 
 type authedHandler func(http.ResponseWriter, *http.Request, int)
 
-func withAuth(handler authedHandler) http.HandlerFunc {
+func (app *App) withAuth(handler authedHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := authenticateAndRefreshSession(w, r)
-		if !ok {
+		userID, ok := app.authenticateAndRefreshSession(w, r)
+		if !ok || !app.allowRequest(w, userID) {
 			return
 		}
-		handler(w, r, userID)
+		handler(app.trackDataChanges(w, r, userID), r, userID)
 	}
 }
 
-func authenticateAndRefreshSession(w http.ResponseWriter, r *http.Request) (int, bool) {
+func (app *App) authenticateAndRefreshSession(w http.ResponseWriter, r *http.Request) (int, bool) {
 	cookie, err := r.Cookie(sessionCookieName)
 	if err != nil || cookie.Value == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeAuthError(w, authErrorMissingSession, "Unauthorized")
 		return 0, false
 	}
 
 	tokenHash := hashSessionToken(cookie.Value)
 	var userID int
 	var expiresAtStr string
-	err = db.QueryRow("SELECT user_id, expires_at FROM sessions WHERE token_hash = ?", tokenHash).Scan(&userID, &expiresAtStr)
+	err = app.db.QueryRow("SELECT user_id, expires_at FROM sessions WHERE token_hash = ?", tokenHash).Scan(&userID, &expiresAtStr)
 	if err == sql.ErrNoRows {
 		clearSessionCookie(w)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeAuthError(w, authErrorInvalidSession, "Unauthorized")
 		return 0, false
 	} else if err != nil {
 		log.Printf("session lookup error: %v", err)
@@ -498,43 +731,66 @@ func authenticateAndRefreshSession(w http.ResponseWriter, r *http.Request) (int,
 
 	now := time.Now().UTC()
 	if now.After(expiresAt) {
-		_, _ = db.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash)
+		_, _ = app.db.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash)
 		clearSessionCookie(w)
-		http.Error(w, "Session expired", http.StatusUnauthorized)
+		writeAuthError(w, authErrorSessionExpired, "Session expired")
 		return 0, false
 	}
 
-	if expiresAt.Sub(now) < sessionRefreshDelta {
-		newExpiry := now.Add(sessionTTL)
-		if _, err := db.Exec("UPDATE sessions SET expires_at = ? WHERE token_hash = ?", newExpiry.Format(timeFormat), tokenHash); err != nil {
+	// Sessions are extended once less than a third of their lifetime is left.
+	if expiresAt.Sub(now) < app.cfg.SessionTTL/3 {
+		newExpiry := now.Add(app.cfg.SessionTTL)
+		if _, err := app.db.Exec("UPDATE sessions SET expires_at = ? WHERE token_hash = ?", newExpiry.Format(timeFormat), tokenHash); err != nil {
 			log.Printf("session refresh error: %v", err)
 		} else {
-			setSessionCookie(w, r, cookie.Value, newExpiry)
+			app.setSessionCookie(w, r, cookie.Value, newExpiry)
 		}
 	}
 
 	return userID, true
 }
 
-func issueSession(w http.ResponseWriter, r *http.Request, userID int) error {
+// Codes returned in the body of 401 responses so clients can tell an
+// expired session apart from never having logged in.
+const (
+	authErrorMissingSession = "missing_session"
+	authErrorInvalidSession = "invalid_session"
+	authErrorSessionExpired = "session_expired"
+)
+
+// writeAuthError writes a 401 with a JSON body carrying code and a
+// WWW-Authenticate header pointing at the session cookie.
+func writeAuthError(w http.ResponseWriter, code, message string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Cookie realm="expense-tracker", cookie-name=%q, error=%q`, sessionCookieName, code))
+	writeAPIError(w, http.StatusUnauthorized, code, message)
+}
+
+// maxSessionsPerUser caps how many devices a user can be signed in on at
+// once; logging in on another evicts the session closest to expiring,
+// which is the one used least recently.
+const maxSessionsPerUser = 10
+
+func (app *App) issueSession(w http.ResponseWriter, r *http.Request, userID int) error {
 	rawToken, tokenHash, err := generateSessionToken()
 	if err != nil {
 		return err
 	}
 
-	expiresAt := time.Now().UTC().Add(sessionTTL)
+	expiresAt := time.Now().UTC().Add(app.cfg.SessionTTL)
 
-	tx, err := db.Begin()
+	tx, err := app.db.Begin()
 	if err != nil {
 		return err
 	}
 
-	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+	if _, err := tx.Exec("INSERT INTO sessions(token_hash, user_id, expires_at) VALUES(?, ?, ?)", tokenHash, userID, expiresAt.Format(timeFormat)); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	if _, err := tx.Exec("INSERT INTO sessions(token_hash, user_id, expires_at) VALUES(?, ?, ?)", tokenHash, userID, expiresAt.Format(timeFormat)); err != nil {
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ? AND token_hash NOT IN (
+		SELECT token_hash FROM sessions WHERE user_id = ? ORDER BY expires_at DESC, token_hash DESC LIMIT ?)`,
+		userID, userID, maxSessionsPerUser); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -543,11 +799,24 @@ func issueSession(w http.ResponseWriter, r *http.Request, userID int) error {
 		return err
 	}
 
-	setSessionCookie(w, r, rawToken, expiresAt)
+	app.setSessionCookie(w, r, rawToken, expiresAt)
 	return nil
 }
 
-func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
+// purgeExpiredSessions deletes sessions past their expiry. Expired tokens
+// are otherwise only removed when presented, which users who never come
+// back never do.
+func (app *App) purgeExpiredSessions() {
+	res, err := app.db.Exec("DELETE FROM sessions WHERE expires_at < ?", time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		log.Printf("Error purging expired sessions: %v", err)
+		return
+	}
+	n, _ := res.RowsAffected()
+	log.Printf("Purged %d expired sessions", n)
+}
+
+func (app *App) setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
 	cookie := &http.Cookie{
 		Name:     sessionCookieName,
 		Value:    token,
@@ -556,7 +825,7 @@ func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expi
 		MaxAge:   int(time.Until(expires).Seconds()),
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
-		Secure:   r != nil && r.TLS != nil,
+		Secure:   app.requestIsHTTPS(r),
 	}
 	if cookie.MaxAge < 0 {
 		cookie.MaxAge = 0
@@ -590,14 +859,43 @@ func hashSessionToken(token string) string {
 	return hex.EncodeToString(sum[:])
 }
 
+// Codes of the JSON errors decodeJSONBodyLimit answers with.
+const (
+	bodyErrorUnsupportedType = "unsupported_media_type"
+	bodyErrorTooLarge        = "body_too_large"
+)
+
 func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
-	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBody)
+	return decodeJSONBodyLimit(w, r, dst, maxJSONBody)
+}
+
+// decodeJSONBodyLimit decodes a body of at most limit bytes into dst. A body
+// declared as anything but JSON is refused with 415, and one over the limit
+// with 413, both as JSON errors; other problems are a 400.
+func decodeJSONBodyLimit(w http.ResponseWriter, r *http.Request, dst interface{}, limit int64) bool {
 	defer r.Body.Close()
+	if !isJSONContentType(r.Header.Get("Content-Type")) {
+		writeAPIError(w, http.StatusUnsupportedMediaType, bodyErrorUnsupportedType, "Content-Type must be application/json")
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
 
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 
+	tooLarge := func(err error) bool {
+		var maxBytesErr *http.MaxBytesError
+		if !errors.As(err, &maxBytesErr) {
+			return false
+		}
+		writeAPIError(w, http.StatusRequestEntityTooLarge, bodyErrorTooLarge, fmt.Sprintf("Request body must be at most %d bytes", limit))
+		return true
+	}
+
 	if err := decoder.Decode(dst); err != nil {
+		if tooLarge(err) {
+			return false
+		}
 		var syntaxErr *json.SyntaxError
 		if errors.As(err, &syntaxErr) {
 			http.Error(w, fmt.Sprintf("Invalid JSON at byte %d", syntaxErr.Offset), http.StatusBadRequest)
@@ -612,13 +910,46 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) boo
 	}
 
 	if err := decoder.Decode(&struct{}{}); err != io.EOF {
-		http.Error(w, "Request body must only contain a single JSON object", http.StatusBadRequest)
+		if !tooLarge(err) {
+			http.Error(w, "Request body must only contain a single JSON object", http.StatusBadRequest)
+		}
 		return false
 	}
 
 	return true
 }
 
+// isJSONContentType reports whether a Content-Type header declares JSON:
+// application/json or a +json type, with any parameters. A missing header
+// counts, as scripts sending JSON often leave it out.
+func isJSONContentType(header string) bool {
+	if header == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// writeJSONList writes items as a JSON array, [] rather than null when
+// there are none, so clients can always iterate the response.
+func writeJSONList[T any](w http.ResponseWriter, items []T) {
+	if items == nil {
+		items = []T{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// respondCreated writes v as the 201 for a new resource, with a Location
+// header holding where GET finds it: path under apiPrefix, such as
+// "/expenses/12". Callers read v back as GET would, so the body is the same.
+func respondCreated(w http.ResponseWriter, path string, v interface{}) {
+	w.Header().Set("Location", apiPrefix+path)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v)
+}
+
 func sanitizeEmail(email string) (string, error) {
 	trimmed := strings.TrimSpace(strings.ToLower(email))
 	if trimmed == "" {
@@ -645,6 +976,44 @@ func validatePassword(password string) error {
 	return nil
 }
 
+// parseListParam collects every value of name, whether repeated
+// (?category=Food&category=Transport) or comma-separated (?category=Food,Transport),
+// trimmed and with blanks and duplicates dropped.
+func parseListParam(params url.Values, name string) []string {
+	var values []string
+	seen := map[string]bool{}
+	for _, raw := range params[name] {
+		for _, v := range strings.Split(raw, ",") {
+			v = strings.TrimSpace(v)
+			if v == "" || seen[v] {
+				continue
+			}
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// placeholders returns "?, ?, ?" with n markers for an IN clause.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// categoryMatchClause matches expenses whose own category, or any of whose
+// split categories, is one of categories.
+func categoryMatchClause(categories []string) (string, []interface{}) {
+	in := placeholders(len(categories))
+	args := make([]interface{}, 0, 2*len(categories))
+	for _, c := range categories {
+		args = append(args, c)
+	}
+	for _, c := range categories {
+		args = append(args, c)
+	}
+	return "(category IN (" + in + ") OR EXISTS(SELECT 1 FROM expense_splits s WHERE s.expense_id = expenses.id AND s.category IN (" + in + ")))", args
+}
+
 func isValidFrequency(freq string) bool {
 	switch strings.ToLower(strings.TrimSpace(freq)) {
 	case "daily", "weekly", "monthly", "yearly":
@@ -653,83 +1022,47 @@ func isValidFrequency(freq string) bool {
 		return false
 	}
 }
-func expensesHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	switch r.Method {
-	case http.MethodGet:
-		getExpenses(w, r, userID)
-	case http.MethodPost:
-		createExpense(w, r, userID)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
-}
 
-func expenseHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/expenses/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil || id <= 0 {
-		http.Error(w, "Invalid expense ID", http.StatusBadRequest)
+func (app *App) getExpenses(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, append([]string{"date_from", "date_to", "category", "exclude_category", "uncategorized",
+		"amount_min", "amount_max", "amount_near", "amount_tolerance", "q", "account_id", "modified_since", "cursor", "expand"}, pageParamNames...)...) {
 		return
 	}
-
-	switch r.Method {
-	case http.MethodGet:
-		getExpense(w, r, userID, id)
-	case http.MethodPut:
-		updateExpense(w, r, userID, id)
-	case http.MethodDelete:
-		deleteExpense(w, r, userID, id)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	expand, ok := parseExpand(w, params, expandAccount)
+	if !ok {
+		return
 	}
-}
 
-func getExpenses(w http.ResponseWriter, r *http.Request, userID int) {
-	query := "SELECT id, amount, category, note, date FROM expenses WHERE user_id = ?"
-	args := []interface{}{userID}
+	joins, args := expand.joins(userID)
+	query := "SELECT id, amount, category, COALESCE(note, ''), payee, date, account_id, household_id, recurring_expense_id, EXISTS(SELECT 1 FROM expense_splits s WHERE s.expense_id = expenses.id), created_at, updated_at" + expand.columns() + " FROM expenses" + joins + " WHERE " + householdScope
+	args = append(args, userID, userID)
 
-	params := r.URL.Query()
+	filter, ok := app.expenseListFilter(w, params, userID)
+	if !ok {
+		return
+	}
+	query += filter.clause
+	args = append(args, filter.args...)
 
-	if dateFrom := strings.TrimSpace(params.Get("date_from")); dateFrom != "" {
-		query += " AND date >= ?"
-		args = append(args, dateFrom)
+	page, ok := parseCursorPage(w, params, "expenses")
+	if !ok {
+		return
 	}
-	if dateTo := strings.TrimSpace(params.Get("date_to")); dateTo != "" {
-		query += " AND date <= ?"
-		args = append(args, dateTo)
-	}
-	if category := strings.TrimSpace(params.Get("category")); category != "" {
-		query += " AND category = ?"
-		args = append(args, category)
-	}
-	if amountMin := strings.TrimSpace(params.Get("amount_min")); amountMin != "" {
-		query += " AND amount >= ?"
-		args = append(args, amountMin)
-	}
-	if amountMax := strings.TrimSpace(params.Get("amount_max")); amountMax != "" {
-		query += " AND amount <= ?"
-		args = append(args, amountMax)
-	}
-	if q := strings.TrimSpace(params.Get("q")); q != "" {
-		query += " AND note LIKE ?"
-		args = append(args, "%"+q+"%")
-	}
-
-	limit, err := strconv.Atoi(params.Get("limit"))
-	if err != nil || limit <= 0 {
-		limit = 10
-	} else if limit > 100 {
-		limit = 100
-	}
-	offset, err := strconv.Atoi(params.Get("offset"))
-	if err != nil || offset < 0 {
-		offset = 0
+	if page.On {
+		clause, clauseArgs := page.clause()
+		query += clause
+		args = append(args, clauseArgs...)
+	} else {
+		limit, offset, ok := parsePagination(w, params)
+		if !ok {
+			return
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
 	}
 
-	query += " LIMIT ? OFFSET ?"
-	args = append(args, limit, offset)
-
-	rows, err := db.Query(query, args...)
+	rows, err := app.requestDB(r).Query(query, args...)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -740,7 +1073,10 @@ func getExpenses(w http.ResponseWriter, r *http.Request, userID int) {
 	for rows.Next() {
 		var e Expense
 		var dateStr string
-		if err := rows.Scan(&e.ID, &e.Amount, &e.Category, &e.Note, &dateStr); err != nil {
+		var payee, createdAt, updatedAt sql.NullString
+		var accountID, householdID, recurringExpenseID sql.NullInt64
+		var extra expandedRow
+		if err := rows.Scan(expand.dest(&extra, &e.ID, &e.Amount, &e.Category, &e.Note, &payee, &dateStr, &accountID, &householdID, &recurringExpenseID, &e.HasSplits, &createdAt, &updatedAt)...); err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -750,7 +1086,17 @@ func getExpenses(w http.ResponseWriter, r *http.Request, userID int) {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if e.Timestamps, err = parseTimestamps(createdAt, updatedAt); err != nil {
+			log.Printf("expense timestamp parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		e.Date = parsedDate
+		e.Payee = nullStringPtr(payee)
+		e.AccountID = nullIntPtr(accountID)
+		e.HouseholdID = nullIntPtr(householdID)
+		e.RecurringExpenseID = nullIntPtr(recurringExpenseID)
+		e.Account, e.expanded = extra.account(), expand
 		e.UserID = userID
 		expenses = append(expenses, e)
 	}
@@ -760,65 +1106,204 @@ func getExpenses(w http.ResponseWriter, r *http.Request, userID int) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(expenses)
+	if page.On {
+		expenses = trimPage(w, page, expenses, func(e Expense) pageCursor {
+			return pageCursor{List: "expenses", Date: e.Date.Format(timeFormat), ID: e.ID}
+		})
+	}
+	writeJSONList(w, expenses)
+}
+
+// expenseListFilter reads the filters of GET /expenses into the conditions
+// that follow householdScope in its query.
+func (app *App) expenseListFilter(w http.ResponseWriter, params url.Values, userID int) (sqlFilter, bool) {
+	var filter sqlFilter
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return filter, false
+	}
+	dateClause, dateArgs, ok := dateRangeFilter(w, params, loc)
+	if !ok {
+		return filter, false
+	}
+	filter.add(dateClause, dateArgs)
+	if categories := parseListParam(params, "category"); len(categories) > 0 {
+		clause, clauseArgs := categoryMatchClause(categories)
+		filter.and(clause, clauseArgs...)
+	}
+	if excluded := parseListParam(params, "exclude_category"); len(excluded) > 0 {
+		clause, clauseArgs := categoryMatchClause(excluded)
+		filter.and("NOT "+clause, clauseArgs...)
+	}
+	uncategorized, ok := parseBoolParam(w, params, "uncategorized")
+	if !ok {
+		return filter, false
+	}
+	if uncategorized {
+		filter.and(uncategorizedClause, uncategorizedCategory)
+	}
+	amountClause, amountArgs, ok := amountRangeFilter(w, params)
+	if !ok {
+		return filter, false
+	}
+	filter.add(amountClause, amountArgs)
+	nearClause, nearArgs, ok := amountNearFilter(w, params)
+	if !ok {
+		return filter, false
+	}
+	filter.add(nearClause, nearArgs)
+	if q := strings.TrimSpace(params.Get("q")); q != "" {
+		filter.and("LOWER(note) LIKE LOWER(?)", "%"+q+"%")
+	}
+	accountClause, accountArgs, ok := app.parseAccountFilter(w, userID, params)
+	if !ok {
+		return filter, false
+	}
+	filter.add(accountClause, accountArgs)
+	since, ok := parseModifiedSince(w, params)
+	if !ok {
+		return filter, false
+	}
+	if since != "" {
+		filter.and("updated_at >= ?", since)
+	}
+	return filter, true
 }
 
-func createExpense(w http.ResponseWriter, r *http.Request, userID int) {
+func (app *App) createExpense(w http.ResponseWriter, r *http.Request, userID int) {
 	var e Expense
 	if !decodeJSONBody(w, r, &e) {
 		return
 	}
+	if !app.pinDates(w, userID, &e.Date) {
+		return
+	}
+	if err := validateExpenseText(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSplits(e.Amount, e.Splits); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e.Payee = normalizePayee(e.Payee)
+
+	if err := applyCategoryRules(app.requestDB(r), userID, &e); err != nil {
+		log.Printf("category rules error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	if e.Date.IsZero() {
 		e.Date = time.Now().UTC()
 	} else {
 		e.Date = e.Date.UTC()
 	}
+	if !app.checkTransactionDate(w, userID, e.Date) {
+		return
+	}
+
+	accountID, ok := app.resolveAccountID(w, userID, e.AccountID)
+	if !ok {
+		return
+	}
+	e.AccountID = accountID
 
-	if e.AccountID == nil || *e.AccountID == 0 {
-		http.Error(w, "Account is required", http.StatusBadRequest)
+	if !app.requireHouseholdMember(w, userID, e.HouseholdID) {
+		return
+	}
+	if !app.checkQuota(w, app.requestDB(r), userID, quotaExpenses, 1) {
 		return
 	}
 
-	tx, err := db.Begin()
+	tx, err := app.dbtx.BeginTx(r.Context(), nil)
 	if err != nil {
 		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	stmt, err := tx.Prepare("INSERT INTO expenses(amount, category, note, date, user_id, account_id) VALUES(?, ?, ?, ?, ?, ?)")
+	e.Timestamps = newTimestamps(time.Now())
+	now := e.UpdatedAt.Format(timeFormat)
+	id, err := app.store(tx).InsertExpense(userID, e)
 	if err != nil {
 		tx.Rollback()
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(e.Amount, e.Category, e.Note, e.Date.Format(timeFormat), userID, e.AccountID)
-	if err != nil {
+	refused, err := app.debitAccount(tx, userID, e.AccountID, e.Amount, now)
+	if errors.Is(err, errAccountNotFound) {
+		tx.Rollback()
+		http.Error(w, "Account not found", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		tx.Rollback()
+		log.Printf("failed to update account balance: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if refused != nil {
+		tx.Rollback()
+		writeOverdraftError(w, refused)
+		return
+	}
+
+	e.ID = id
+	e.UserID = userID
+	e.RecurringExpenseID = nil
+
+	if err := replaceExpenseSplits(tx, e.ID, e.Splits); err != nil {
+		tx.Rollback()
+		log.Printf("expense splits error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	e.HasSplits = len(e.Splits) > 0
+
+	if err := recordAudit(tx, userID, auditEntityExpense, e.ID, auditActionCreate, nil, e); err != nil {
 		tx.Rollback()
+		log.Printf("audit log error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	id, err := res.LastInsertId()
+	if err := notifyBudgetThresholds(tx, userID, e); err != nil {
+		tx.Rollback()
+		log.Printf("budget notification error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := notifyLowBalance(tx, userID, e); err != nil {
+		tx.Rollback()
+		log.Printf("low balance notification error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	threshold, err := largeExpenseThreshold(tx, userID)
+	if err == nil {
+		err = notifyLargeExpense(tx, userID, threshold, e, 0)
+	}
 	if err != nil {
 		tx.Rollback()
+		log.Printf("large expense notification error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := queueWebhookEvent(tx, userID, webhookEventExpenseCreated, e); err != nil {
+		tx.Rollback()
+		log.Printf("webhook event error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Update Account Balance if linked
-	if e.AccountID != nil {
-		_, err := tx.Exec("UPDATE accounts SET balance = balance - ? WHERE id = ? AND user_id = ?", e.Amount, *e.AccountID, userID)
-		if err != nil {
-			tx.Rollback()
-			log.Printf("failed to update account balance: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+	created, err := fetchExpense(tx, userID, e.ID)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("expense fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -826,143 +1311,277 @@ func createExpense(w http.ResponseWriter, r *http.Request, userID int) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	app.wakeWebhookDispatcher()
 
-	e.ID = int(id)
-	e.UserID = userID
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(e)
+	respondCreated(w, fmt.Sprintf("/expenses/%d", created.ID), created)
 }
 
-func getExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
-	var e Expense
-	var dateStr string
-	err := db.QueryRow("SELECT id, amount, category, note, date FROM expenses WHERE id = ? AND user_id = ?", id, userID).Scan(&e.ID, &e.Amount, &e.Category, &e.Note, &dateStr)
+func (app *App) getExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
+	expand, ok := parseExpand(w, r.URL.Query(), expandAccount)
+	if !ok {
+		return
+	}
+	e, err := fetchExpandedExpense(app.requestDB(r), userID, id, expand)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Expense not found", http.StatusNotFound)
 		return
 	} else if err != nil {
+		log.Printf("expense fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	parsedDate, err := parseTimestamp(dateStr)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+func fetchExpense(q querier, userID, id int) (Expense, error) {
+	return fetchExpandedExpense(q, userID, id, nil)
+}
+
+// fetchExpandedExpense is fetchExpense with what expand asks for embedded.
+func fetchExpandedExpense(q querier, userID, id int, expand expandSet) (Expense, error) {
+	var e Expense
+	var dateStr string
+	var payee, createdAt, updatedAt sql.NullString
+	var accountID, householdID, recurringExpenseID sql.NullInt64
+	var extra expandedRow
+	joins, args := expand.joins(userID)
+	err := q.QueryRow("SELECT id, amount, category, COALESCE(note, ''), payee, date, account_id, household_id, recurring_expense_id, created_at, updated_at"+expand.columns()+" FROM expenses"+joins+" WHERE id = ? AND "+householdScope, append(args, id, userID, userID)...).
+		Scan(expand.dest(&extra, &e.ID, &e.Amount, &e.Category, &e.Note, &payee, &dateStr, &accountID, &householdID, &recurringExpenseID, &createdAt, &updatedAt)...)
 	if err != nil {
-		log.Printf("expense date parse error: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return Expense{}, err
 	}
+	e.Payee = nullStringPtr(payee)
+	e.AccountID = nullIntPtr(accountID)
+	e.HouseholdID = nullIntPtr(householdID)
+	e.RecurringExpenseID = nullIntPtr(recurringExpenseID)
+	e.Account, e.expanded = extra.account(), expand
 
-	e.Date = parsedDate
-	e.UserID = userID
+	e.Date, err = parseTimestamp(dateStr)
+	if err != nil {
+		return Expense{}, fmt.Errorf("parse expense date: %w", err)
+	}
+	e.Timestamps, err = parseTimestamps(createdAt, updatedAt)
+	if err != nil {
+		return Expense{}, fmt.Errorf("parse expense timestamps: %w", err)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(e)
+	e.Splits, err = loadExpenseSplits(q, e.ID)
+	if err != nil {
+		return Expense{}, fmt.Errorf("load expense splits: %w", err)
+	}
+	e.HasSplits = len(e.Splits) > 0
+	e.UserID = userID
+	return e, nil
 }
 
-func updateExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
+func (app *App) updateExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
 	var e Expense
 	if !decodeJSONBody(w, r, &e) {
 		return
 	}
+	if !app.pinDates(w, userID, &e.Date) {
+		return
+	}
+	if err := validateExpenseText(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if e.Date.IsZero() {
-		e.Date = time.Now().UTC()
-	} else {
-		e.Date = e.Date.UTC()
+	if err := validateSplits(e.Amount, e.Splits); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	e.Payee = normalizePayee(e.Payee)
 
-	stmt, err := db.Prepare("UPDATE expenses SET amount = ?, category = ?, note = ?, date = ? WHERE id = ? AND user_id = ?")
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if !app.requireHouseholdMember(w, userID, e.HouseholdID) {
 		return
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(e.Amount, e.Category, e.Note, e.Date.Format(timeFormat), id, userID)
+	// A date left out keeps the stored one, as account_id does, so a
+	// client editing only the note does not move the expense to today.
+	if !e.Date.IsZero() {
+		e.Date = e.Date.UTC()
+		if !app.checkTransactionDate(w, userID, e.Date) {
+			return
+		}
+	}
+
+	tx, err := app.dbtx.BeginTx(r.Context(), nil)
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
+	store := app.store(tx)
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
+	old, err := store.FetchExpense(userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("expense fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Expense not found", http.StatusNotFound)
+	if e.Date.IsZero() {
+		e.Date = old.Date
+	}
+
+	accountID, ok := resolveUpdatedAccount(w, tx, userID, old.AccountID, e.AccountID)
+	if !ok {
 		return
 	}
+	e.AccountID = accountID
 
 	e.ID = id
 	e.UserID = userID
+	e.RecurringExpenseID = old.RecurringExpenseID
+	e.Timestamps = old.Timestamps.touched(time.Now())
+	now := e.UpdatedAt.Format(timeFormat)
+	if err := store.UpdateExpense(userID, e); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.moveAccountAmount(tx, userID, old.AccountID, -old.Amount, e.AccountID, -e.Amount, balanceReasonExpense, now); err != nil {
+		log.Printf("failed to update account balance: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := replaceExpenseSplits(tx, id, e.Splits); err != nil {
+		log.Printf("expense splits error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	e.HasSplits = len(e.Splits) > 0
+
+	if err := recordAudit(tx, userID, auditEntityExpense, id, auditActionUpdate, old, e); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	threshold, err := largeExpenseThreshold(tx, userID)
+	if err == nil {
+		err = notifyLargeExpense(tx, userID, threshold, e, old.Amount)
+	}
+	if err != nil {
+		log.Printf("large expense notification error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(e)
 }
 
-func deleteExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
-	res, err := db.Exec("DELETE FROM expenses WHERE id = ? AND user_id = ?", id, userID)
+func (app *App) deleteExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
+	tx, err := app.dbtx.BeginTx(r.Context(), nil)
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := res.RowsAffected()
+	old, err := app.store(tx).FetchExpense(userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("expense fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	snapshot, err := snapshotExpense(tx, old)
+	if err == nil {
+		_, err = recordOperation(tx, userID, operationDeleteExpense, 1, operationUndo{Restore: []expenseSnapshot{snapshot}, Refunded: true})
+	}
 	if err != nil {
+		log.Printf("operation log error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Expense not found", http.StatusNotFound)
+
+	if err := app.removeExpense(tx, userID, old, time.Now()); err != nil {
+		log.Printf("expense delete error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
-func aggregatesHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	switch r.URL.Query().Get("query") {
+func (app *App) aggregatesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "query", "expand") {
+		return
+	}
+	if params.Has("expand") && params.Get("query") != "totals_by_category" {
+		http.Error(w, "expand applies only to totals_by_category", http.StatusBadRequest)
+		return
+	}
+	switch params.Get("query") {
 	case "totals_by_month":
-		getTotalsByMonth(w, userID)
+		app.getTotalsByMonth(w, app.requestDB(r), userID)
 	case "totals_by_category":
-		getTotalsByCategory(w, userID)
+		expand, ok := parseExpand(w, params, expandMeta)
+		if !ok {
+			return
+		}
+		getTotalsByCategory(w, app.requestDB(r), userID, expand[expandMeta])
+	case "totals_by_payee":
+		getTotalsByPayee(w, app.requestDB(r), userID)
 	default:
-		http.Error(w, "Invalid aggregate query", http.StatusBadRequest)
+		http.Error(w, "Invalid query; use one of totals_by_month, totals_by_category, totals_by_payee", http.StatusBadRequest)
 	}
 }
 
-func getTotalsByMonth(w http.ResponseWriter, userID int) {
-	rows, err := db.Query("SELECT strftime('%Y-%m', date) AS month, SUM(amount) AS total FROM expenses WHERE user_id = ? GROUP BY month ORDER BY month", userID)
+// getTotalsByMonth groups by the month each expense fell in in the user's
+// timezone.
+func (app *App) getTotalsByMonth(w http.ResponseWriter, q rowsQuerier, userID int) {
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	days, err := dailyTotals(q, loc, "SELECT date, amount FROM expenses WHERE user_id = ?", userID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
 	results := map[string]float64{}
-	for rows.Next() {
-		var month string
-		var total float64
-		if err := rows.Scan(&month, &total); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		results[month] = total
+	for day, total := range days {
+		results[day.Format("2006-01")] += total
 	}
-
-	if err := rows.Err(); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	for month, total := range results {
+		results[month] = roundCents(total)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
 }
 
-func getTotalsByCategory(w http.ResponseWriter, userID int) {
-	rows, err := db.Query("SELECT category, SUM(amount) AS total FROM expenses WHERE user_id = ? GROUP BY category ORDER BY category", userID)
+// getTotalsByCategory maps each category to its total, or with withMeta to
+// its total and style.
+func getTotalsByCategory(w http.ResponseWriter, q rowsQuerier, userID int, withMeta bool) {
+	rows, err := q.Query("SELECT category, SUM(amount) AS total FROM "+expenseCategoryLines+" WHERE user_id = ? GROUP BY category ORDER BY category", userID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -984,44 +1603,55 @@ func getTotalsByCategory(w http.ResponseWriter, userID int) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	rows.Close()
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
-}
-
-func budgetsHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	switch r.Method {
-	case http.MethodGet:
-		getBudgets(w, userID)
-	case http.MethodPost:
-		createBudget(w, r, userID)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !withMeta {
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+	styles, err := loadCategoryMeta(q, userID)
+	if err != nil {
+		log.Printf("category meta lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	styled := make(map[string]categoryTotalMeta, len(results))
+	for category, total := range results {
+		styled[category] = categoryTotalMeta{Total: total, Meta: styles[category]}
 	}
+	json.NewEncoder(w).Encode(styled)
 }
 
-func budgetHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/budgets/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil || id <= 0 {
-		http.Error(w, "Invalid budget ID", http.StatusBadRequest)
+func (app *App) getBudgets(w http.ResponseWriter, r *http.Request, userID int) {
+	query := "SELECT id, category, amount, start_date, end_date, household_id, COALESCE(period, ''), period_type, rollover, carry_over, carried_over_amount, parent_budget_id, account_id, " + budgetAccountName + ", account_removed, created_at, updated_at FROM budgets WHERE " + householdScope
+	args := []interface{}{userID, userID}
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, append([]string{"modified_since", "status", "category", "date_from", "date_to"}, pageParamNames...)...) {
 		return
 	}
-
-	switch r.Method {
-	case http.MethodGet:
-		getBudget(w, userID, id)
-	case http.MethodPut:
-		updateBudget(w, r, userID, id)
-	case http.MethodDelete:
-		deleteBudget(w, userID, id)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	since, ok := parseModifiedSince(w, params)
+	if !ok {
+		return
 	}
-}
+	if since != "" {
+		query += " AND updated_at >= ?"
+		args = append(args, since)
+	}
+	filter, filterArgs, ok := app.budgetListFilter(w, userID, params, time.Now())
+	if !ok {
+		return
+	}
+	query += filter
+	args = append(args, filterArgs...)
+	limit, offset, ok := parsePagination(w, params)
+	if !ok {
+		return
+	}
+	query += " ORDER BY start_date, id LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
 
-func getBudgets(w http.ResponseWriter, userID int) {
-	rows, err := db.Query("SELECT id, category, amount, start_date, end_date FROM budgets WHERE user_id = ? ORDER BY start_date", userID)
+	rows, err := app.requestDB(r).Query(query, args...)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -1032,7 +1662,10 @@ func getBudgets(w http.ResponseWriter, userID int) {
 	for rows.Next() {
 		var b Budget
 		var startStr, endStr string
-		if err := rows.Scan(&b.ID, &b.Category, &b.Amount, &startStr, &endStr); err != nil {
+		var createdAt, updatedAt sql.NullString
+		var householdID, parentBudgetID, accountID sql.NullInt64
+		var accountName sql.NullString
+		if err := rows.Scan(&b.ID, &b.Category, &b.Amount, &startStr, &endStr, &householdID, &b.Period, &b.PeriodType, &b.Rollover, &b.CarryOver, &b.CarriedOverAmount, &parentBudgetID, &accountID, &accountName, &b.AccountRemoved, &createdAt, &updatedAt); err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -1048,8 +1681,17 @@ func getBudgets(w http.ResponseWriter, userID int) {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if b.Timestamps, err = parseTimestamps(createdAt, updatedAt); err != nil {
+			log.Printf("budget timestamp parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		b.StartDate = startDate
 		b.EndDate = endDate
+		b.HouseholdID = nullIntPtr(householdID)
+		b.ParentBudgetID = nullIntPtr(parentBudgetID)
+		b.AccountID = nullIntPtr(accountID)
+		b.AccountName = nullStringPtr(accountName)
 		b.UserID = userID
 		budgets = append(budgets, b)
 	}
@@ -1059,186 +1701,310 @@ func getBudgets(w http.ResponseWriter, userID int) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(budgets)
+	writeJSONList(w, budgets)
 }
 
-func createBudget(w http.ResponseWriter, r *http.Request, userID int) {
+func (app *App) createBudget(w http.ResponseWriter, r *http.Request, userID int) {
 	var b Budget
 	if !decodeJSONBody(w, r, &b) {
 		return
 	}
+	if !app.pinDates(w, userID, &b.StartDate, &b.EndDate) {
+		return
+	}
+	if err := validateBudgetText(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if b.StartDate.IsZero() {
-		b.StartDate = time.Now().UTC()
-	} else {
-		b.StartDate = b.StartDate.UTC()
+	if err := normalizeBudgetPeriod(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if b.EndDate.IsZero() {
-		b.EndDate = b.StartDate
-	} else {
-		b.EndDate = b.EndDate.UTC()
+	if err := normalizeBudgetPeriodType(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	stmt, err := db.Prepare("INSERT INTO budgets(category, amount, start_date, end_date, user_id) VALUES(?, ?, ?, ?, ?)")
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if !app.requireHouseholdMember(w, userID, b.HouseholdID) {
 		return
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(b.Category, b.Amount, b.StartDate.Format(timeFormat), b.EndDate.Format(timeFormat), userID)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if err := validateBudget(&b, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	id, err := res.LastInsertId()
+	tx, err := app.db.Begin()
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	b.ID = int(id)
-	b.UserID = userID
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(b)
-}
+	b.CarriedOverAmount = 0
+	b.ParentBudgetID = nil
 
-func getBudget(w http.ResponseWriter, userID, id int) {
-	var b Budget
-	var startStr, endStr string
-	err := db.QueryRow("SELECT id, category, amount, start_date, end_date FROM budgets WHERE id = ? AND user_id = ?", id, userID).Scan(&b.ID, &b.Category, &b.Amount, &startStr, &endStr)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Budget not found", http.StatusNotFound)
+	if !resolveBudgetAccount(w, tx, userID, &b) {
 		return
-	} else if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+	if !checkOverallBudget(w, tx, userID, &b) {
 		return
 	}
 
-	startDate, err := parseTimestamp(startStr)
-	if err != nil {
-		log.Printf("budget start date parse error: %v", err)
+	if err := insertBudget(tx, userID, &b); err != nil {
+		log.Printf("budget insert error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	endDate, err := parseTimestamp(endStr)
-	if err != nil {
-		log.Printf("budget end date parse error: %v", err)
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	b.StartDate = startDate
-	b.EndDate = endDate
+	respondCreated(w, fmt.Sprintf("/budgets/%d", b.ID), b)
+}
+
+// insertBudget stores a new budget created by userID and records it in the
+// audit log.
+func insertBudget(tx txQuerier, userID int, b *Budget) error {
+	b.Timestamps = newTimestamps(time.Now())
+	now := b.UpdatedAt.Format(timeFormat)
+	id, err := insertReturningID(tx, "INSERT INTO budgets(category, amount, start_date, end_date, user_id, household_id, period, period_type, rollover, carry_over, account_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", b.Category, b.Amount, b.StartDate.Format(timeFormat), b.EndDate.Format(timeFormat), userID, b.HouseholdID, b.Period, b.PeriodType, b.Rollover, b.CarryOver, b.AccountID, now, now)
+	if err != nil {
+		return err
+	}
+	b.ID = id
 	b.UserID = userID
+	if err := recordAudit(tx, userID, auditEntityBudget, b.ID, auditActionCreate, nil, *b); err != nil {
+		return err
+	}
+	*b, err = fetchBudget(tx, userID, id)
+	return err
+}
+
+func (app *App) getBudget(w http.ResponseWriter, r *http.Request, userID, id int) {
+	b, err := fetchBudget(app.requestDB(r), userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Budget not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("budget fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(b)
 }
 
-func updateBudget(w http.ResponseWriter, r *http.Request, userID, id int) {
+func fetchBudget(q rowQuerier, userID, id int) (Budget, error) {
+	var b Budget
+	var startStr, endStr string
+	var createdAt, updatedAt sql.NullString
+	var householdID, parentBudgetID, accountID sql.NullInt64
+	var accountName sql.NullString
+	err := q.QueryRow("SELECT id, category, amount, start_date, end_date, household_id, COALESCE(period, ''), period_type, rollover, carry_over, carried_over_amount, parent_budget_id, account_id, "+budgetAccountName+", account_removed, created_at, updated_at FROM budgets WHERE id = ? AND "+householdScope, id, userID, userID).Scan(&b.ID, &b.Category, &b.Amount, &startStr, &endStr, &householdID, &b.Period, &b.PeriodType, &b.Rollover, &b.CarryOver, &b.CarriedOverAmount, &parentBudgetID, &accountID, &accountName, &b.AccountRemoved, &createdAt, &updatedAt)
+	if err != nil {
+		return Budget{}, err
+	}
+	b.HouseholdID = nullIntPtr(householdID)
+	b.ParentBudgetID = nullIntPtr(parentBudgetID)
+	b.AccountID = nullIntPtr(accountID)
+	b.AccountName = nullStringPtr(accountName)
+
+	b.StartDate, err = parseTimestamp(startStr)
+	if err != nil {
+		return Budget{}, fmt.Errorf("parse budget start date: %w", err)
+	}
+	b.EndDate, err = parseTimestamp(endStr)
+	if err != nil {
+		return Budget{}, fmt.Errorf("parse budget end date: %w", err)
+	}
+	b.Timestamps, err = parseTimestamps(createdAt, updatedAt)
+	if err != nil {
+		return Budget{}, fmt.Errorf("parse budget timestamps: %w", err)
+	}
+	b.UserID = userID
+	return b, nil
+}
+
+func (app *App) updateBudget(w http.ResponseWriter, r *http.Request, userID, id int) {
 	var b Budget
 	if !decodeJSONBody(w, r, &b) {
 		return
 	}
+	if !app.pinDates(w, userID, &b.StartDate, &b.EndDate) {
+		return
+	}
+	if err := validateBudgetText(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if b.StartDate.IsZero() {
-		b.StartDate = time.Now().UTC()
-	} else {
-		b.StartDate = b.StartDate.UTC()
+	if err := normalizeBudgetPeriod(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if b.EndDate.IsZero() {
-		b.EndDate = b.StartDate
-	} else {
-		b.EndDate = b.EndDate.UTC()
+	if err := normalizeBudgetPeriodType(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	stmt, err := db.Prepare("UPDATE budgets SET category = ?, amount = ?, start_date = ?, end_date = ? WHERE id = ? AND user_id = ?")
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if !app.requireHouseholdMember(w, userID, b.HouseholdID) {
 		return
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(b.Category, b.Amount, b.StartDate.Format(timeFormat), b.EndDate.Format(timeFormat), id, userID)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if err := validateBudget(&b, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	tx, err := app.db.Begin()
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
+	defer tx.Rollback()
+
+	old, err := fetchBudget(tx, userID, id)
+	if err == sql.ErrNoRows {
 		http.Error(w, "Budget not found", http.StatusNotFound)
 		return
+	} else if err != nil {
+		log.Printf("budget fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	b.ID = id
+	if !resolveBudgetAccount(w, tx, userID, &b) {
+		return
+	}
+	if !checkOverallBudget(w, tx, userID, &b) {
+		return
+	}
+
+	// Saving the budget again acknowledges a removed account.
+	b.Timestamps = old.Timestamps.touched(time.Now())
+	if _, err := tx.Exec("UPDATE budgets SET category = ?, amount = ?, start_date = ?, end_date = ?, household_id = ?, period = ?, period_type = ?, rollover = ?, carry_over = ?, account_id = ?, account_removed = 0, updated_at = ? WHERE id = ? AND "+householdScope, b.Category, b.Amount, b.StartDate.Format(timeFormat), b.EndDate.Format(timeFormat), b.HouseholdID, b.Period, b.PeriodType, b.Rollover, b.CarryOver, b.AccountID, b.UpdatedAt.Format(timeFormat), id, userID, userID); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	b.ID = id
 	b.UserID = userID
+	b.CarriedOverAmount = old.CarriedOverAmount
+	b.ParentBudgetID = old.ParentBudgetID
+
+	if err := recordAudit(tx, userID, auditEntityBudget, id, auditActionUpdate, old, b); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(b)
 }
 
-func deleteBudget(w http.ResponseWriter, userID, id int) {
-	res, err := db.Exec("DELETE FROM budgets WHERE id = ? AND user_id = ?", id, userID)
+func (app *App) deleteBudget(w http.ResponseWriter, r *http.Request, userID, id int) {
+	tx, err := app.db.Begin()
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
+	old, err := fetchBudget(tx, userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Budget not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("budget fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Budget not found", http.StatusNotFound)
+
+	if err := touchDependents(tx, "budgets", "parent_budget_id", id); err != nil {
+		log.Printf("budget successor touch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
-}
-func recurringExpensesHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	switch r.Method {
-	case http.MethodGet:
-		getRecurringExpenses(w, userID)
-	case http.MethodPost:
-		createRecurringExpense(w, r, userID)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if _, err := tx.Exec("DELETE FROM budgets WHERE id = ? AND "+householdScope, id, userID, userID); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
-}
 
-func recurringExpenseHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/recurring-expenses/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil || id <= 0 {
-		http.Error(w, "Invalid recurring expense ID", http.StatusBadRequest)
+	if err := recordTombstone(tx, userID, auditEntityBudget, id, old.HouseholdID); err != nil {
+		log.Printf("tombstone error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	switch r.Method {
-	case http.MethodGet:
-		getRecurringExpense(w, userID, id)
-	case http.MethodPut:
-		updateRecurringExpense(w, r, userID, id)
-	case http.MethodDelete:
-		deleteRecurringExpense(w, userID, id)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if err := recordAudit(tx, userID, auditEntityBudget, id, auditActionDelete, old, nil); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recurringExpenseSorts are the sort keys GET /recurring-expenses takes.
+var recurringExpenseSorts = map[string]string{
+	"next_due_date": "next_due_date",
+	"amount":        "amount",
+	"category":      "LOWER(category)",
+	"created_at":    "created_at",
 }
 
-func getRecurringExpenses(w http.ResponseWriter, userID int) {
-	rows, err := db.Query("SELECT id, amount, category, note, frequency, next_due_date FROM recurring_expenses WHERE user_id = ? ORDER BY next_due_date", userID)
+func (app *App) getRecurringExpenses(w http.ResponseWriter, r *http.Request, userID int) {
+	from := " FROM recurring_expenses WHERE user_id = ?"
+	args := []interface{}{userID}
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, append([]string{"modified_since", "sort"}, pageParamNames...)...) {
+		return
+	}
+	since, ok := parseModifiedSince(w, params)
+	if !ok {
+		return
+	}
+	if since != "" {
+		from += " AND updated_at >= ?"
+		args = append(args, since)
+	}
+	order, ok := parseSortParam(w, params, recurringExpenseSorts, "next_due_date")
+	if !ok {
+		return
+	}
+	limit, offset, ok := parsePaginationDefault(w, params, defaultShortListLimit)
+	if !ok {
+		return
+	}
+	if !writeTotalCount(w, app.requestDB(r), from, args) {
+		return
+	}
+
+	query := "SELECT id, amount, category, COALESCE(note, ''), frequency, frequency_interval, next_due_date, COALESCE(anchor_day, 0), paused, last_generated_at, generated_count, created_at, updated_at" + from + order + " LIMIT ? OFFSET ?"
+	rows, err := app.requestDB(r).Query(query, append(args, limit, offset)...)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -1249,7 +2015,18 @@ func getRecurringExpenses(w http.ResponseWriter, userID int) {
 	for rows.Next() {
 		var re RecurringExpense
 		var nextDueDateStr string
-		if err := rows.Scan(&re.ID, &re.Amount, &re.Category, &re.Note, &re.Frequency, &nextDueDateStr); err != nil {
+		var lastGeneratedAt, createdAt, updatedAt sql.NullString
+		if err := rows.Scan(&re.ID, &re.Amount, &re.Category, &re.Note, &re.Frequency, &re.Interval, &nextDueDateStr, &re.AnchorDay, &re.Paused, &lastGeneratedAt, &re.GeneratedCount, &createdAt, &updatedAt); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if re.LastGeneratedAt, err = nullTimestampPtr(lastGeneratedAt); err != nil {
+			log.Printf("recurring expense last generated parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if re.Timestamps, err = parseTimestamps(createdAt, updatedAt); err != nil {
+			log.Printf("recurring expense timestamp parse error: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -1269,15 +2046,18 @@ func getRecurringExpenses(w http.ResponseWriter, userID int) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(recurringExpenses)
+	writeJSONList(w, recurringExpenses)
 }
 
-func createRecurringExpense(w http.ResponseWriter, r *http.Request, userID int) {
+func (app *App) createRecurringExpense(w http.ResponseWriter, r *http.Request, userID int) {
 	var re RecurringExpense
 	if !decodeJSONBody(w, r, &re) {
 		return
 	}
+	if err := validateRecurringExpenseText(&re); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if !isValidFrequency(re.Frequency) {
 		http.Error(w, "Invalid frequency", http.StatusBadRequest)
@@ -1285,70 +2065,124 @@ func createRecurringExpense(w http.ResponseWriter, r *http.Request, userID int)
 	}
 	re.Frequency = strings.ToLower(strings.TrimSpace(re.Frequency))
 
+	interval, ok := normalizeInterval(re.Interval)
+	if !ok {
+		http.Error(w, "Invalid interval", http.StatusBadRequest)
+		return
+	}
+	re.Interval = interval
+
 	if re.NextDueDate.IsZero() {
 		re.NextDueDate = time.Now().UTC()
 	} else {
 		re.NextDueDate = re.NextDueDate.UTC()
 	}
+	if !checkNextDueDate(w, re.NextDueDate) {
+		return
+	}
+
+	if re.AnchorDay < 0 || re.AnchorDay > 31 {
+		http.Error(w, "Invalid anchor day", http.StatusBadRequest)
+		return
+	}
+	if re.AnchorDay == 0 {
+		re.AnchorDay = re.NextDueDate.Day()
+	}
 
-	stmt, err := db.Prepare("INSERT INTO recurring_expenses(amount, category, note, frequency, next_due_date, user_id) VALUES(?, ?, ?, ?, ?, ?)")
+	tx, err := app.db.Begin()
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	res, err := stmt.Exec(re.Amount, re.Category, re.Note, re.Frequency, re.NextDueDate.Format(timeFormat), userID)
+	re.Timestamps = newTimestamps(time.Now())
+	now := re.UpdatedAt.Format(timeFormat)
+	id, err := insertReturningID(tx, "INSERT INTO recurring_expenses(amount, category, note, frequency, frequency_interval, next_due_date, anchor_day, paused, user_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", re.Amount, re.Category, re.Note, re.Frequency, re.Interval, re.NextDueDate.Format(timeFormat), re.AnchorDay, re.Paused, userID, now, now)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	id, err := res.LastInsertId()
+	re.ID = id
+	re.UserID = userID
+	re.LastGeneratedAt = nil
+	re.GeneratedCount = 0
+
+	if err := recordAudit(tx, userID, auditEntityRecurringExpense, re.ID, auditActionCreate, nil, re); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := fetchRecurringExpense(tx, userID, re.ID)
 	if err != nil {
+		log.Printf("recurring expense fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	re.ID = int(id)
-	re.UserID = userID
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(re)
+	respondCreated(w, fmt.Sprintf("/recurring-expenses/%d", created.ID), created)
 }
 
-func getRecurringExpense(w http.ResponseWriter, userID, id int) {
-	var re RecurringExpense
-	var nextDueDateStr string
-	err := db.QueryRow("SELECT id, amount, category, note, frequency, next_due_date FROM recurring_expenses WHERE id = ? AND user_id = ?", id, userID).Scan(&re.ID, &re.Amount, &re.Category, &re.Note, &re.Frequency, &nextDueDateStr)
+func (app *App) getRecurringExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
+	re, err := fetchRecurringExpense(app.requestDB(r), userID, id)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Recurring expense not found", http.StatusNotFound)
 		return
 	} else if err != nil {
+		log.Printf("recurring expense fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	nextDueDate, err := parseTimestamp(nextDueDateStr)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(re)
+}
+
+func fetchRecurringExpense(q rowQuerier, userID, id int) (RecurringExpense, error) {
+	var re RecurringExpense
+	var nextDueDateStr string
+	var lastGeneratedAt, createdAt, updatedAt sql.NullString
+	err := q.QueryRow("SELECT id, amount, category, COALESCE(note, ''), frequency, frequency_interval, next_due_date, COALESCE(anchor_day, 0), paused, last_generated_at, generated_count, created_at, updated_at FROM recurring_expenses WHERE id = ? AND user_id = ?", id, userID).Scan(&re.ID, &re.Amount, &re.Category, &re.Note, &re.Frequency, &re.Interval, &nextDueDateStr, &re.AnchorDay, &re.Paused, &lastGeneratedAt, &re.GeneratedCount, &createdAt, &updatedAt)
+	if err != nil {
+		return RecurringExpense{}, err
+	}
+
+	re.LastGeneratedAt, err = nullTimestampPtr(lastGeneratedAt)
 	if err != nil {
-		log.Printf("recurring expense due date parse error: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return RecurringExpense{}, fmt.Errorf("parse recurring expense last generated: %w", err)
 	}
 
-	re.NextDueDate = nextDueDate
-	re.UserID = userID
+	re.Timestamps, err = parseTimestamps(createdAt, updatedAt)
+	if err != nil {
+		return RecurringExpense{}, fmt.Errorf("parse recurring expense timestamps: %w", err)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(re)
+	re.NextDueDate, err = parseTimestamp(nextDueDateStr)
+	if err != nil {
+		return RecurringExpense{}, fmt.Errorf("parse recurring expense due date: %w", err)
+	}
+	re.UserID = userID
+	return re, nil
 }
 
-func updateRecurringExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
+func (app *App) updateRecurringExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
 	var re RecurringExpense
 	if !decodeJSONBody(w, r, &re) {
 		return
 	}
+	if err := validateRecurringExpenseText(&re); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if !isValidFrequency(re.Frequency) {
 		http.Error(w, "Invalid frequency", http.StatusBadRequest)
@@ -1356,160 +2190,224 @@ func updateRecurringExpense(w http.ResponseWriter, r *http.Request, userID, id i
 	}
 	re.Frequency = strings.ToLower(strings.TrimSpace(re.Frequency))
 
+	interval, ok := normalizeInterval(re.Interval)
+	if !ok {
+		http.Error(w, "Invalid interval", http.StatusBadRequest)
+		return
+	}
+	re.Interval = interval
+
 	if re.NextDueDate.IsZero() {
 		re.NextDueDate = time.Now().UTC()
 	} else {
 		re.NextDueDate = re.NextDueDate.UTC()
 	}
+	if !checkNextDueDate(w, re.NextDueDate) {
+		return
+	}
 
-	stmt, err := db.Prepare("UPDATE recurring_expenses SET amount = ?, category = ?, note = ?, frequency = ?, next_due_date = ? WHERE id = ? AND user_id = ?")
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if re.AnchorDay < 0 || re.AnchorDay > 31 {
+		http.Error(w, "Invalid anchor day", http.StatusBadRequest)
 		return
 	}
-	defer stmt.Close()
+	if re.AnchorDay == 0 {
+		re.AnchorDay = re.NextDueDate.Day()
+	}
 
-	res, err := stmt.Exec(re.Amount, re.Category, re.Note, re.Frequency, re.NextDueDate.Format(timeFormat), id, userID)
+	tx, err := app.db.Begin()
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
+	old, err := fetchRecurringExpense(tx, userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recurring expense not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("recurring expense fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Recurring expense not found", http.StatusNotFound)
+
+	re.Timestamps = old.Timestamps.touched(time.Now())
+	if _, err := tx.Exec("UPDATE recurring_expenses SET amount = ?, category = ?, note = ?, frequency = ?, frequency_interval = ?, next_due_date = ?, anchor_day = ?, paused = ?, updated_at = ? WHERE id = ? AND user_id = ?", re.Amount, re.Category, re.Note, re.Frequency, re.Interval, re.NextDueDate.Format(timeFormat), re.AnchorDay, re.Paused, re.UpdatedAt.Format(timeFormat), id, userID); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	re.ID = id
 	re.UserID = userID
+	re.LastGeneratedAt = old.LastGeneratedAt
+	re.GeneratedCount = old.GeneratedCount
+
+	if err := recordAudit(tx, userID, auditEntityRecurringExpense, id, auditActionUpdate, old, re); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(re)
 }
 
-func deleteRecurringExpense(w http.ResponseWriter, userID, id int) {
-	res, err := db.Exec("DELETE FROM recurring_expenses WHERE id = ? AND user_id = ?", id, userID)
+// deleteRecurringExpense removes a recurring expense. Expenses it generated
+// are kept and unlinked, unless ?delete_expenses=true asks for them to be
+// deleted along with it.
+func (app *App) deleteRecurringExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
+	tx, err := app.db.Begin()
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
+	old, err := fetchRecurringExpense(tx, userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recurring expense not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("recurring expense fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Recurring expense not found", http.StatusNotFound)
+
+	if r.URL.Query().Get("delete_expenses") == "true" {
+		if err := deleteGeneratedExpenses(tx, userID, id); err != nil {
+			log.Printf("generated expenses delete error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	} else if err := touchDependents(tx, "expenses", "recurring_expense_id", id); err != nil {
+		log.Printf("generated expenses touch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM recurring_expenses WHERE id = ? AND user_id = ?", id, userID); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordTombstone(tx, userID, auditEntityRecurringExpense, id, nil); err != nil {
+		log.Printf("tombstone error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(tx, userID, auditEntityRecurringExpense, id, auditActionDelete, old, nil); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func processRecurringExpenses() {
+// processRecurringExpenses is the background job: it catches up every user
+// with due recurring expenses.
+func (app *App) processRecurringExpenses() {
 	now := time.Now().UTC()
-	rows, err := db.Query("SELECT id, user_id, amount, category, note, frequency, next_due_date FROM recurring_expenses WHERE next_due_date <= ?", now.Format(timeFormat))
+	rows, err := app.db.Query("SELECT DISTINCT user_id FROM recurring_expenses WHERE next_due_date <= ? AND paused = 0", now.Format(timeFormat))
 	if err != nil {
 		log.Printf("Error querying recurring expenses: %v", err)
 		return
 	}
-	defer rows.Close()
 
+	var userIDs []int
 	for rows.Next() {
-		var re RecurringExpense
-		var nextDueDateStr string
-		if err := rows.Scan(&re.ID, &re.UserID, &re.Amount, &re.Category, &re.Note, &re.Frequency, &nextDueDateStr); err != nil {
-			log.Printf("Error scanning recurring expense: %v", err)
-			continue
-		}
-		nextDueDate, err := parseTimestamp(nextDueDateStr)
-		if err != nil {
-			log.Printf("Error parsing recurring expense due date: %v", err)
-			continue
-		}
-		re.NextDueDate = nextDueDate
-
-		tx, err := db.Begin()
-		if err != nil {
-			log.Printf("Error starting transaction for recurring expense %d: %v", re.ID, err)
-			continue
-		}
-
-		if _, err := tx.Exec("INSERT INTO expenses(amount, category, note, date, user_id) VALUES(?, ?, ?, ?, ?)", re.Amount, re.Category, re.Note, re.NextDueDate.Format(timeFormat), re.UserID); err != nil {
-			log.Printf("Error creating expense from recurring expense %d: %v", re.ID, err)
-			tx.Rollback()
-			continue
-		}
-
-		var nextDueDateUpdated time.Time
-		switch strings.ToLower(re.Frequency) {
-		case "daily":
-			nextDueDateUpdated = re.NextDueDate.AddDate(0, 0, 1)
-		case "weekly":
-			nextDueDateUpdated = re.NextDueDate.AddDate(0, 0, 7)
-		case "monthly":
-			nextDueDateUpdated = re.NextDueDate.AddDate(0, 1, 0)
-		case "yearly":
-			nextDueDateUpdated = re.NextDueDate.AddDate(1, 0, 0)
-		default:
-			nextDueDateUpdated = re.NextDueDate.AddDate(0, 0, 1)
-		}
-
-		if _, err := tx.Exec("UPDATE recurring_expenses SET next_due_date = ? WHERE id = ?", nextDueDateUpdated.Format(timeFormat), re.ID); err != nil {
-			log.Printf("Error updating next due date for recurring expense %d: %v", re.ID, err)
-			tx.Rollback()
-			continue
-		}
-
-		if err := tx.Commit(); err != nil {
-			log.Printf("Error committing recurring expense %d transaction: %v", re.ID, err)
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			log.Printf("Error scanning recurring expense user: %v", err)
 			continue
 		}
+		userIDs = append(userIDs, userID)
 	}
-
-	if err := rows.Err(); err != nil {
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
 		log.Printf("Error iterating recurring expenses: %v", err)
+		return
 	}
-}
-func incomesHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	switch r.Method {
-	case http.MethodGet:
-		getIncomes(w, userID)
-	case http.MethodPost:
-		createIncome(w, r, userID)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	for _, userID := range userIDs {
+		if _, err := app.processRecurringExpensesForUser(userID, now); err != nil {
+			log.Printf("Error processing recurring expenses for user %d: %v", userID, err)
+		}
 	}
 }
 
-func incomeHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/incomes/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil || id <= 0 {
-		http.Error(w, "Invalid income ID", http.StatusBadRequest)
+func (app *App) getIncomes(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "date_from", "date_to", "amount_min", "amount_max", "modified_since", "account_id", "cursor", "limit", "expand") {
 		return
 	}
+	expand, ok := parseExpand(w, params, expandAccount)
+	if !ok {
+		return
+	}
+	joins, args := expand.joins(userID)
+	query := "SELECT id, amount, source, COALESCE(note, ''), date, account_id, household_id, opening_balance, created_at, updated_at" + expand.columns() + " FROM incomes" + joins + " WHERE " + householdScope
+	args = append(args, userID, userID)
 
-	switch r.Method {
-	case http.MethodGet:
-		getIncome(w, userID, id)
-	case http.MethodPut:
-		updateIncome(w, r, userID, id)
-	case http.MethodDelete:
-		deleteIncome(w, userID, id)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	dateClause, dateArgs, ok := dateRangeFilter(w, params, loc)
+	if !ok {
+		return
+	}
+	query += dateClause
+	args = append(args, dateArgs...)
+	amountClause, amountArgs, ok := amountRangeFilter(w, params)
+	if !ok {
+		return
+	}
+	query += amountClause
+	args = append(args, amountArgs...)
+	since, ok := parseModifiedSince(w, params)
+	if !ok {
+		return
+	}
+	if since != "" {
+		query += " AND updated_at >= ?"
+		args = append(args, since)
+	}
+	accountClause, accountArgs, ok := app.parseAccountFilter(w, userID, params)
+	if !ok {
+		return
+	}
+	query += accountClause
+	args = append(args, accountArgs...)
+	page, ok := parseCursorPage(w, params, "incomes")
+	if !ok {
+		return
+	}
+	if page.On {
+		clause, clauseArgs := page.clause()
+		query += clause
+		args = append(args, clauseArgs...)
+	} else {
+		query += " ORDER BY date"
 	}
-}
 
-func getIncomes(w http.ResponseWriter, userID int) {
-	rows, err := db.Query("SELECT id, amount, source, note, date FROM incomes WHERE user_id = ? ORDER BY date", userID)
+	rows, err := app.requestDB(r).Query(query, args...)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -1520,7 +2418,10 @@ func getIncomes(w http.ResponseWriter, userID int) {
 	for rows.Next() {
 		var i Income
 		var dateStr string
-		if err := rows.Scan(&i.ID, &i.Amount, &i.Source, &i.Note, &dateStr); err != nil {
+		var createdAt, updatedAt sql.NullString
+		var accountID, householdID sql.NullInt64
+		var extra expandedRow
+		if err := rows.Scan(expand.dest(&extra, &i.ID, &i.Amount, &i.Source, &i.Note, &dateStr, &accountID, &householdID, &i.OpeningBalance, &createdAt, &updatedAt)...); err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -1530,7 +2431,15 @@ func getIncomes(w http.ResponseWriter, userID int) {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if i.Timestamps, err = parseTimestamps(createdAt, updatedAt); err != nil {
+			log.Printf("income timestamp parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		i.Date = parsedDate
+		i.AccountID = nullIntPtr(accountID)
+		i.HouseholdID = nullIntPtr(householdID)
+		i.Account, i.expanded = extra.account(), expand
 		i.UserID = userID
 		incomes = append(incomes, i)
 	}
@@ -1540,65 +2449,92 @@ func getIncomes(w http.ResponseWriter, userID int) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(incomes)
+	if page.On {
+		incomes = trimPage(w, page, incomes, func(i Income) pageCursor {
+			return pageCursor{List: "incomes", Date: i.Date.Format(timeFormat), ID: i.ID}
+		})
+	}
+	writeJSONList(w, incomes)
 }
 
-func createIncome(w http.ResponseWriter, r *http.Request, userID int) {
+func (app *App) createIncome(w http.ResponseWriter, r *http.Request, userID int) {
 	var i Income
 	if !decodeJSONBody(w, r, &i) {
 		return
 	}
+	if !app.pinDates(w, userID, &i.Date) {
+		return
+	}
+	if err := validateIncomeText(&i); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if i.Date.IsZero() {
 		i.Date = time.Now().UTC()
 	} else {
 		i.Date = i.Date.UTC()
 	}
+	if !app.checkTransactionDate(w, userID, i.Date) {
+		return
+	}
+
+	accountID, ok := app.resolveAccountID(w, userID, i.AccountID)
+	if !ok {
+		return
+	}
+	i.AccountID = accountID
 
-	if i.AccountID == nil || *i.AccountID == 0 {
-		http.Error(w, "Account is required", http.StatusBadRequest)
+	if !app.requireHouseholdMember(w, userID, i.HouseholdID) {
 		return
 	}
 
-	tx, err := db.Begin()
+	tx, err := app.dbtx.BeginTx(r.Context(), nil)
 	if err != nil {
 		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	stmt, err := tx.Prepare("INSERT INTO incomes(amount, source, note, date, user_id, account_id) VALUES(?, ?, ?, ?, ?, ?)")
+	i.Timestamps = newTimestamps(time.Now())
+	now := i.UpdatedAt.Format(timeFormat)
+	id, err := insertReturningID(tx, "INSERT INTO incomes(amount, source, note, date, user_id, account_id, household_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)", i.Amount, i.Source, i.Note, i.Date.Format(timeFormat), userID, i.AccountID, i.HouseholdID, now, now)
 	if err != nil {
 		tx.Rollback()
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(i.Amount, i.Source, i.Note, i.Date.Format(timeFormat), userID, i.AccountID)
-	if err != nil {
+	if err := app.adjustAccountBalance(tx, userID, i.AccountID, i.Amount, balanceReasonIncome, now); err != nil {
 		tx.Rollback()
+		log.Printf("failed to update account balance: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	id, err := res.LastInsertId()
-	if err != nil {
+	i.ID = id
+	i.UserID = userID
+	i.OpeningBalance = false
+
+	if err := recordAudit(tx, userID, auditEntityIncome, i.ID, auditActionCreate, nil, i); err != nil {
+		tx.Rollback()
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := queueWebhookEvent(tx, userID, webhookEventIncomeCreated, i); err != nil {
 		tx.Rollback()
+		log.Printf("webhook event error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Update Account Balance if linked
-	if i.AccountID != nil {
-		_, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE id = ? AND user_id = ?", i.Amount, *i.AccountID, userID)
-		if err != nil {
-			tx.Rollback()
-			log.Printf("failed to update account balance: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+	created, err := fetchIncome(tx, userID, i.ID)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("income fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -1606,97 +2542,188 @@ func createIncome(w http.ResponseWriter, r *http.Request, userID int) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	app.wakeWebhookDispatcher()
 
-	i.ID = int(id)
-	i.UserID = userID
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(i)
+	respondCreated(w, fmt.Sprintf("/incomes/%d", created.ID), created)
 }
 
-func getIncome(w http.ResponseWriter, userID, id int) {
-	var i Income
-	var dateStr string
-	err := db.QueryRow("SELECT id, amount, source, note, date FROM incomes WHERE id = ? AND user_id = ?", id, userID).Scan(&i.ID, &i.Amount, &i.Source, &i.Note, &dateStr)
+func (app *App) getIncome(w http.ResponseWriter, r *http.Request, userID, id int) {
+	expand, ok := parseExpand(w, r.URL.Query(), expandAccount)
+	if !ok {
+		return
+	}
+	i, err := fetchExpandedIncome(app.requestDB(r), userID, id, expand)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Income not found", http.StatusNotFound)
 		return
 	} else if err != nil {
+		log.Printf("income fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	parsedDate, err := parseTimestamp(dateStr)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(i)
+}
+
+func fetchIncome(q rowQuerier, userID, id int) (Income, error) {
+	return fetchExpandedIncome(q, userID, id, nil)
+}
+
+// fetchExpandedIncome is fetchIncome with what expand asks for embedded.
+func fetchExpandedIncome(q rowQuerier, userID, id int, expand expandSet) (Income, error) {
+	var i Income
+	var dateStr string
+	var createdAt, updatedAt sql.NullString
+	var accountID, householdID sql.NullInt64
+	var extra expandedRow
+	joins, args := expand.joins(userID)
+	err := q.QueryRow("SELECT id, amount, source, COALESCE(note, ''), date, account_id, household_id, opening_balance, created_at, updated_at"+expand.columns()+" FROM incomes"+joins+" WHERE id = ? AND "+householdScope, append(args, id, userID, userID)...).
+		Scan(expand.dest(&extra, &i.ID, &i.Amount, &i.Source, &i.Note, &dateStr, &accountID, &householdID, &i.OpeningBalance, &createdAt, &updatedAt)...)
 	if err != nil {
-		log.Printf("income date parse error: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return Income{}, err
 	}
+	i.AccountID = nullIntPtr(accountID)
+	i.HouseholdID = nullIntPtr(householdID)
+	i.Account, i.expanded = extra.account(), expand
 
-	i.Date = parsedDate
+	i.Date, err = parseTimestamp(dateStr)
+	if err != nil {
+		return Income{}, fmt.Errorf("parse income date: %w", err)
+	}
+	i.Timestamps, err = parseTimestamps(createdAt, updatedAt)
+	if err != nil {
+		return Income{}, fmt.Errorf("parse income timestamps: %w", err)
+	}
 	i.UserID = userID
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(i)
+	return i, nil
 }
 
-func updateIncome(w http.ResponseWriter, r *http.Request, userID, id int) {
+func (app *App) updateIncome(w http.ResponseWriter, r *http.Request, userID, id int) {
 	var i Income
 	if !decodeJSONBody(w, r, &i) {
 		return
 	}
+	if !app.pinDates(w, userID, &i.Date) {
+		return
+	}
+	if err := validateIncomeText(&i); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if i.Date.IsZero() {
-		i.Date = time.Now().UTC()
-	} else {
+	if !app.requireHouseholdMember(w, userID, i.HouseholdID) {
+		return
+	}
+
+	// A date left out keeps the stored one, as account_id does, so a
+	// client editing only the note does not move the income to today.
+	if !i.Date.IsZero() {
 		i.Date = i.Date.UTC()
+		if !app.checkTransactionDate(w, userID, i.Date) {
+			return
+		}
 	}
 
-	stmt, err := db.Prepare("UPDATE incomes SET amount = ?, source = ?, note = ?, date = ? WHERE id = ? AND user_id = ?")
+	tx, err := app.dbtx.BeginTx(r.Context(), nil)
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	res, err := stmt.Exec(i.Amount, i.Source, i.Note, i.Date.Format(timeFormat), id, userID)
-	if err != nil {
+	old, err := fetchIncome(tx, userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Income not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("income fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if i.Date.IsZero() {
+		i.Date = old.Date
+	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
+	accountID, ok := resolveUpdatedAccount(w, tx, userID, old.AccountID, i.AccountID)
+	if !ok {
+		return
+	}
+	i.AccountID = accountID
+
+	i.Timestamps = old.Timestamps.touched(time.Now())
+	i.OpeningBalance = old.OpeningBalance
+	now := i.UpdatedAt.Format(timeFormat)
+	if _, err := tx.Exec("UPDATE incomes SET amount = ?, source = ?, note = ?, date = ?, account_id = ?, household_id = ?, updated_at = ? WHERE id = ? AND "+householdScope, i.Amount, i.Source, i.Note, i.Date.Format(timeFormat), i.AccountID, i.HouseholdID, now, id, userID, userID); err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Income not found", http.StatusNotFound)
+
+	if err := app.moveAccountAmount(tx, userID, old.AccountID, old.Amount, i.AccountID, i.Amount, balanceReasonIncome, now); err != nil {
+		log.Printf("failed to update account balance: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	i.ID = id
 	i.UserID = userID
 
+	if err := recordAudit(tx, userID, auditEntityIncome, id, auditActionUpdate, old, i); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(i)
 }
 
-func deleteIncome(w http.ResponseWriter, userID, id int) {
-	res, err := db.Exec("DELETE FROM incomes WHERE id = ? AND user_id = ?", id, userID)
+func (app *App) deleteIncome(w http.ResponseWriter, r *http.Request, userID, id int) {
+	tx, err := app.dbtx.BeginTx(r.Context(), nil)
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
+	old, err := fetchIncome(tx, userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Income not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("income fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Income not found", http.StatusNotFound)
+
+	if _, err := tx.Exec("DELETE FROM incomes WHERE id = ? AND "+householdScope, id, userID, userID); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordTombstone(tx, userID, auditEntityIncome, id, old.HouseholdID); err != nil {
+		log.Printf("tombstone error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(tx, userID, auditEntityIncome, id, auditActionDelete, old, nil); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -1705,37 +2732,43 @@ func deleteIncome(w http.ResponseWriter, userID, id int) {
 
 // Account Handlers
 
-func accountsHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	switch r.Method {
-	case http.MethodGet:
-		getAccounts(w, userID)
-	case http.MethodPost:
-		createAccount(w, r, userID)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
+// accountSorts are the sort keys GET /accounts takes.
+var accountSorts = map[string]string{
+	"name":       "LOWER(name)",
+	"type":       "type",
+	"balance":    "balance",
+	"created_at": "created_at",
 }
 
-func accountHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/accounts/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil || id <= 0 {
-		http.Error(w, "Invalid account ID", http.StatusBadRequest)
+func (app *App) getAccounts(w http.ResponseWriter, r *http.Request, userID int) {
+	from := " FROM accounts WHERE " + householdScope
+	args := []interface{}{userID, userID}
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, append([]string{"modified_since", "sort"}, pageParamNames...)...) {
 		return
 	}
-
-	switch r.Method {
-	case http.MethodPut:
-		updateAccount(w, r, userID, id)
-	case http.MethodDelete:
-		deleteAccount(w, userID, id)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	since, ok := parseModifiedSince(w, params)
+	if !ok {
+		return
+	}
+	if since != "" {
+		from += " AND updated_at >= ?"
+		args = append(args, since)
+	}
+	order, ok := parseSortParam(w, params, accountSorts, "name")
+	if !ok {
+		return
+	}
+	limit, offset, ok := parsePaginationDefault(w, params, defaultShortListLimit)
+	if !ok {
+		return
+	}
+	if !writeTotalCount(w, app.requestDB(r), from, args) {
+		return
 	}
-}
 
-func getAccounts(w http.ResponseWriter, userID int) {
-	rows, err := db.Query("SELECT id, name, type, balance FROM accounts WHERE user_id = ?", userID)
+	query := "SELECT id, name, type, balance, allow_negative, minimum_balance, household_id, created_at, updated_at" + from + order + " LIMIT ? OFFSET ?"
+	rows, err := app.requestDB(r).Query(query, append(args, limit, offset)...)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -1745,10 +2778,22 @@ func getAccounts(w http.ResponseWriter, userID int) {
 	var accounts []Account
 	for rows.Next() {
 		var a Account
-		if err := rows.Scan(&a.ID, &a.Name, &a.Type, &a.Balance); err != nil {
+		var allowNegative bool
+		var minimumBalance sql.NullFloat64
+		var createdAt, updatedAt sql.NullString
+		var householdID sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.Name, &a.Type, &a.Balance, &allowNegative, &minimumBalance, &householdID, &createdAt, &updatedAt); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if a.Timestamps, err = parseTimestamps(createdAt, updatedAt); err != nil {
+			log.Printf("account timestamp parse error: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		a.AllowNegative = &allowNegative
+		a.MinimumBalance = nullFloatPtr(minimumBalance)
+		a.HouseholdID = nullIntPtr(householdID)
 		a.UserID = userID
 		accounts = append(accounts, a)
 	}
@@ -1758,162 +2803,410 @@ func getAccounts(w http.ResponseWriter, userID int) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(accounts)
+	writeJSONList(w, accounts)
 }
 
-func createAccount(w http.ResponseWriter, r *http.Request, userID int) {
+func (app *App) createAccount(w http.ResponseWriter, r *http.Request, userID int) {
 	var a Account
 	if !decodeJSONBody(w, r, &a) {
 		return
 	}
+	if err := validateAccountText(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := normalizeAccountType(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	res, err := db.Exec("INSERT INTO accounts(name, type, balance, user_id) VALUES(?, ?, ?, ?)", a.Name, a.Type, a.Balance, userID)
+	if !app.requireHouseholdMember(w, userID, a.HouseholdID) {
+		return
+	}
+	if !app.checkQuota(w, app.db, userID, quotaAccounts, 1) {
+		return
+	}
+
+	tx, err := app.db.Begin()
 	if err != nil {
-		log.Printf("create account error: %v", err)
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	id, err := res.LastInsertId()
+	a.Timestamps = newTimestamps(time.Now())
+	now := a.UpdatedAt.Format(timeFormat)
+	if a.AllowNegative == nil {
+		allow := true
+		a.AllowNegative = &allow
+	}
+	store := app.store(tx)
+	id, err := store.InsertAccount(userID, a)
 	if err != nil {
+		log.Printf("create account error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	a.ID = int(id)
+	a.ID = id
 	a.UserID = userID
 
+	if err := recordBalance(tx, userID, a.ID, a.Balance, balanceReasonOpening, now); err != nil {
+		log.Printf("balance history error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(tx, userID, auditEntityAccount, a.ID, auditActionCreate, nil, a); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("opening_balance") != "false" {
+		if err := recordOpeningBalance(tx, a); err != nil {
+			log.Printf("opening balance error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	created, err := store.FetchAccount(userID, a.ID)
+	if err != nil {
+		log.Printf("account fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	app.wakeWebhookDispatcher()
+
+	respondCreated(w, fmt.Sprintf("/accounts/%d", created.ID), created)
+}
+
+func (app *App) getAccount(w http.ResponseWriter, r *http.Request, userID, id int) {
+	a, err := fetchAccount(app.requestDB(r), userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("account fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(a)
 }
 
-func updateAccount(w http.ResponseWriter, r *http.Request, userID, id int) {
+func (app *App) updateAccount(w http.ResponseWriter, r *http.Request, userID, id int) {
 	var a Account
 	if !decodeJSONBody(w, r, &a) {
 		return
 	}
+	if err := validateAccountText(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := normalizeAccountType(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Note: Updating balance directly matches user input, though implies manual adjustment
-	res, err := db.Exec("UPDATE accounts SET name = ?, type = ?, balance = ? WHERE id = ? AND user_id = ?", a.Name, a.Type, a.Balance, id, userID)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if !app.requireHouseholdMember(w, userID, a.HouseholdID) {
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	tx, err := app.db.Begin()
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
+	defer tx.Rollback()
+	store := app.store(tx)
+
+	old, err := store.FetchAccount(userID, id)
+	if err == sql.ErrNoRows {
 		http.Error(w, "Account not found", http.StatusNotFound)
 		return
+	} else if err != nil {
+		log.Printf("account fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
+	a.Timestamps = old.Timestamps.touched(app.now())
+	if a.AllowNegative == nil {
+		a.AllowNegative = old.AllowNegative
+	}
+	if !a.balanceSet {
+		a.Balance = old.Balance
+	} else if a.Balance != old.Balance && !app.checkBalanceEdit(w, id, a.UpdatedAt) {
+		return
+	}
 	a.ID = id
 	a.UserID = userID
+	if err := store.UpdateAccount(userID, a); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Setting the balance by hand, while that is still allowed, is an
+	// adjustment by the difference.
+	if a.Balance != old.Balance {
+		if err := recordBalance(tx, userID, id, a.Balance-old.Balance, balanceReasonAdjustment, a.UpdatedAt.Format(timeFormat)); err != nil {
+			log.Printf("balance history error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := recordAudit(tx, userID, auditEntityAccount, id, auditActionUpdate, old, a); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(a)
 }
 
-func deleteAccount(w http.ResponseWriter, userID, id int) {
+func (app *App) deleteAccount(w http.ResponseWriter, r *http.Request, userID, id int) {
 	// Optional: Check if used in transactions? For now, we rely on ON DELETE SET NULL for foreign keys if we configured that, but sqlite default might be restricted
 	// Actually, the PRAGMA foreign_keys = ON is set.
 	// But let's just delete. If there are transactions, they might prevent deletion if we had strict constraints, but in ensureAccountColumns we used ON DELETE SET NULL?
 	// Ah, in ensureAccountColumns I used `REFERENCES accounts(id) ON DELETE SET NULL`. So it's safe.
 
-	res, err := db.Exec("DELETE FROM accounts WHERE id = ? AND user_id = ?", id, userID)
+	tx, err := app.db.Begin()
 	if err != nil {
+		log.Printf("tx begin error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
+	store := app.store(tx)
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
+	old, err := store.FetchAccount(userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("account fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Account not found", http.StatusNotFound)
+
+	for _, table := range []string{"expenses", "incomes", "budgets"} {
+		if err := touchDependents(tx, table, "account_id", id); err != nil {
+			log.Printf("account %s touch error: %v", table, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	// The foreign key nulls the budgets' account_id; flag them so the user
+	// sees the budget now covers every account.
+	if _, err := tx.Exec("UPDATE budgets SET account_removed = 1 WHERE account_id = ?", id); err != nil {
+		log.Printf("account budgets flag error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
-}
+	if err := store.DeleteAccount(userID, id); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-func incomeVsExpenseReportHandler(w http.ResponseWriter, r *http.Request, userID int) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if err := recordTombstone(tx, userID, auditEntityAccount, id, old.HouseholdID); err != nil {
+		log.Printf("tombstone error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	incomeRows, err := db.Query("SELECT strftime('%Y-%m', date) AS month, SUM(amount) AS total FROM incomes WHERE user_id = ? GROUP BY month", userID)
-	if err != nil {
+	if err := recordAudit(tx, userID, auditEntityAccount, id, auditActionDelete, old, nil); err != nil {
+		log.Printf("audit log error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	defer incomeRows.Close()
 
-	reports := make(map[string]*MonthlyReport)
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-	for incomeRows.Next() {
-		var month string
-		var total float64
-		if err := incomeRows.Scan(&month, &total); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adjustAccountBalance adds delta to the balance of accountID, if set,
+// bumps the account's updated_at to now, and records the new balance in its
+// history with reason.
+func (app *App) adjustAccountBalance(tx txQuerier, userID int, accountID *int, delta float64, reason, now string) error {
+	if accountID == nil {
+		return nil
+	}
+	if err := app.store(tx).AdjustBalance(userID, *accountID, delta, now); err != nil {
+		return err
+	}
+	return recordBalance(tx, userID, *accountID, delta, reason, now)
+}
+
+// moveAccountAmount replaces a transaction's effect of oldDelta on oldAccount
+// with newDelta on newAccount. Nothing is written when neither changed, and
+// an account that stays the same is adjusted once, by the difference.
+func (app *App) moveAccountAmount(tx txQuerier, userID int, oldAccount *int, oldDelta float64, newAccount *int, newDelta float64, reason, now string) error {
+	if sameAccount(oldAccount, newAccount) {
+		if oldDelta == newDelta {
+			return nil
 		}
-		reports[month] = &MonthlyReport{Month: month, Income: total}
+		return app.adjustAccountBalance(tx, userID, newAccount, newDelta-oldDelta, reason, now)
 	}
+	if err := app.adjustAccountBalance(tx, userID, oldAccount, -oldDelta, reason, now); err != nil {
+		return err
+	}
+	return app.adjustAccountBalance(tx, userID, newAccount, newDelta, reason, now)
+}
 
-	if err := incomeRows.Err(); err != nil {
+func sameAccount(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// resolveUpdatedAccount picks the account for an updated transaction: the
+// current one when the payload leaves account_id out, otherwise the given
+// account, which must be visible to the user. It writes a 400 when it is not.
+func resolveUpdatedAccount(w http.ResponseWriter, q rowQuerier, userID int, current, requested *int) (*int, bool) {
+	if requested == nil || *requested == 0 {
+		return current, true
+	}
+	if sameAccount(current, requested) {
+		return current, true
+	}
+	if _, err := fetchAccount(q, userID, *requested); err == sql.ErrNoRows {
+		http.Error(w, "Account not found", http.StatusBadRequest)
+		return nil, false
+	} else if err != nil {
+		log.Printf("account fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
+	return requested, true
+}
 
-	expenseRows, err := db.Query("SELECT strftime('%Y-%m', date) AS month, SUM(amount) AS total FROM expenses WHERE user_id = ? GROUP BY month", userID)
+func fetchAccount(q rowQuerier, userID, id int) (Account, error) {
+	var a Account
+	var allowNegative bool
+	var minimumBalance sql.NullFloat64
+	var createdAt, updatedAt sql.NullString
+	var householdID sql.NullInt64
+	err := q.QueryRow("SELECT id, name, type, balance, allow_negative, minimum_balance, household_id, created_at, updated_at FROM accounts WHERE id = ? AND "+householdScope, id, userID, userID).Scan(&a.ID, &a.Name, &a.Type, &a.Balance, &allowNegative, &minimumBalance, &householdID, &createdAt, &updatedAt)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return Account{}, err
 	}
-	defer expenseRows.Close()
+	a.Timestamps, err = parseTimestamps(createdAt, updatedAt)
+	if err != nil {
+		return Account{}, fmt.Errorf("parse account timestamps: %w", err)
+	}
+	a.AllowNegative = &allowNegative
+	a.MinimumBalance = nullFloatPtr(minimumBalance)
+	a.HouseholdID = nullIntPtr(householdID)
+	a.UserID = userID
+	return a, nil
+}
 
-	for expenseRows.Next() {
-		var month string
-		var total float64
-		if err := expenseRows.Scan(&month, &total); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		if report, ok := reports[month]; ok {
-			report.Expense = total
-		} else {
-			reports[month] = &MonthlyReport{Month: month, Expense: total}
-		}
+// parseAccountFilter reads ?account_id= for the transaction lists. A numeric
+// ID must name an account the user can see; "null" selects transactions not
+// linked to any account. It returns the clause to append to the WHERE.
+func (app *App) parseAccountFilter(w http.ResponseWriter, userID int, params url.Values) (string, []interface{}, bool) {
+	raw := strings.TrimSpace(params.Get("account_id"))
+	if raw == "" {
+		return "", nil, true
+	}
+	if raw == "null" {
+		return " AND account_id IS NULL", nil, true
 	}
 
-	if err := expenseRows.Err(); err != nil {
+	accountID, err := strconv.Atoi(raw)
+	if err != nil || accountID <= 0 {
+		http.Error(w, "Invalid account_id", http.StatusBadRequest)
+		return "", nil, false
+	}
+	if _, err := fetchAccount(app.db, userID, accountID); err == sql.ErrNoRows {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return "", nil, false
+	} else if err != nil {
+		log.Printf("account fetch error: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return "", nil, false
 	}
+	return " AND account_id = ?", []interface{}{accountID}, true
+}
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx so single-row lookups
+// can run either standalone or inside a handler's transaction.
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// rowsQuerier is the multi-row counterpart of rowQuerier.
+type rowsQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// querier combines rowQuerier and rowsQuerier for lookups that need both.
+type querier interface {
+	rowQuerier
+	rowsQuerier
+}
 
-	var months []string
-	for month := range reports {
-		months = append(months, month)
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
 	}
-	sort.Strings(months)
+	v := int(n.Int64)
+	return &v
+}
 
-	var result []MonthlyReport
-	for _, month := range months {
-		result = append(result, *reports[month])
+func nullTimestampPtr(s sql.NullString) (*time.Time, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	t, err := parseTimestamp(s.String)
+	if err != nil {
+		return nil, err
 	}
+	return &t, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	v := s.String
+	return &v
 }
+
+func nullFloatPtr(n sql.NullFloat64) *float64 {
+	if !n.Valid {
+		return nil
+	}
+	v := n.Float64
+	return &v
+}
+
 func parseTimestamp(value string) (time.Time, error) {
 	layouts := []string{timeFormat, time.RFC3339, time.RFC3339Nano, "2006-01-02"}
 	for _, layout := range layouts {
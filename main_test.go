@@ -8,37 +8,88 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	testSessionCookie *http.Cookie
 	testUserID        int
+	testAccountID     int
 )
 
 func TestMain(m *testing.M) {
-	var err error
-	db, err = sql.Open("sqlite3", "./test.db")
-	if err != nil {
-		panic(err)
-	}
+	bcryptCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
 
-	if err := createTables(); err != nil {
-		panic(err)
-	}
+// testApp is the App tests run against. useTestDB gives each test its own;
+// tests that never touch the database share this one, which has none.
+var testApp = NewApp(nil, Config{})
 
-	if err := seedTestUser(); err != nil {
-		panic(err)
+// useTestDB gives testApp a fresh in-memory database, seeds the test user
+// and account, and restores the previous App when t finishes, so no test
+// can see another's rows. TEST_DB_DRIVER=sqlite uses a file under t.TempDir()
+// instead, and with TEST_DATABASE_URL set it uses that Postgres database,
+// dropping everything in its schema first.
+func useTestDB(t testing.TB) {
+	t.Helper()
+
+	useTestDBConfig(t, testConfig())
+}
+
+// testConfig is the default configuration on the test database:
+// in-memory unless TEST_DB_DRIVER or TEST_DATABASE_URL says otherwise.
+func testConfig() Config {
+	cfg := defaultConfig()
+	cfg.DBDriver, cfg.DBPath = dbDriverMemory, ""
+	if driver := os.Getenv("TEST_DB_DRIVER"); driver != "" {
+		cfg.DBDriver = driver
+	}
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		cfg.DBDriver, cfg.DatabaseURL = dbDriverPostgres, url
 	}
+	return cfg
+}
 
-	exitCode := m.Run()
+// useTestDBConfig is useTestDB for a specific configuration. A sqlite
+// configuration without a path gets a file in the test's temporary
+// directory.
+func useTestDBConfig(t testing.TB, cfg Config) {
+	t.Helper()
 
-	db.Close()
-	os.Remove("./test.db")
+	if cfg.DBDriver == dbDriverSQLite && cfg.DBPath == "" {
+		cfg.DBPath = filepath.Join(t.TempDir(), "test.db")
+	}
+	conn, err := openDatabase(cfg)
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	prev := testApp
+	testApp = NewApp(conn, cfg)
+	t.Cleanup(func() {
+		conn.Close()
+		testApp = prev
+	})
+
+	if cfg.DBDriver == dbDriverPostgres {
+		for _, stmt := range []string{"DROP SCHEMA public CASCADE", "CREATE SCHEMA public"} {
+			if _, err := conn.Exec(stmt); err != nil {
+				t.Fatalf("reset postgres schema: %v", err)
+			}
+		}
+	}
 
-	os.Exit(exitCode)
+	if err := testApp.migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedTestUser(); err != nil {
+		t.Fatalf("seed test user: %v", err)
+	}
 }
 
 func seedTestUser() error {
@@ -54,7 +105,7 @@ func seedTestUser() error {
 
 	req := httptest.NewRequest(http.MethodPost, "/auth/register", bytes.NewReader(body))
 	rr := httptest.NewRecorder()
-	registerHandler(rr, req)
+	testApp.registerHandler(rr, req)
 
 	if rr.Code != http.StatusCreated {
 		return fmt.Errorf("unexpected register status: %d", rr.Code)
@@ -73,21 +124,25 @@ func seedTestUser() error {
 		return fmt.Errorf("session cookie not set")
 	}
 
-	if err := db.QueryRow("SELECT id FROM users WHERE email = ?", strings.ToLower(payload.Email)).Scan(&testUserID); err != nil {
+	if err := testApp.db.QueryRow("SELECT id FROM users WHERE email = ?", strings.ToLower(payload.Email)).Scan(&testUserID); err != nil {
 		return err
 	}
 
-	return nil
-}
-func resetData(t *testing.T) {
-	tables := []string{"expenses", "budgets", "recurring_expenses", "incomes"}
-	for _, table := range tables {
-		if _, err := db.Exec("DELETE FROM "+table+" WHERE user_id = ?", testUserID); err != nil {
-			t.Fatalf("cleanup %s: %v", table, err)
-		}
+	accountID, err := insertReturningID(testApp.db, "INSERT INTO accounts(name, type, balance, user_id) VALUES(?, ?, ?, ?)", "Test Wallet", "cash", 0, testUserID)
+	if err != nil {
+		return err
 	}
+	testAccountID = accountID
+
+	return nil
 }
 
+// testAccount returns a fresh pointer to the seeded account for use in
+// expense and income payloads, which require an account on creation.
+func testAccount() *int {
+	id := testAccountID
+	return &id
+}
 func authedRequest(method, target string, payload interface{}) *http.Request {
 	var reader *bytes.Reader
 	if payload != nil {
@@ -108,15 +163,24 @@ func authedRequest(method, target string, payload interface{}) *http.Request {
 	return req
 }
 
-func performAuthed(handler http.HandlerFunc, method, target string, payload interface{}) *httptest.ResponseRecorder {
-	req := authedRequest(method, target, payload)
+// serve sends req through testApp's production routes, so tests exercise
+// routing, method matching and withAuth exactly as a client would.
+func serve(req *http.Request) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
-	handler.ServeHTTP(rr, req)
+	testApp.ServeHTTP(rr, req)
 	return rr
 }
 
-func callAuthed(handler authedHandler, method, target string, payload interface{}) *httptest.ResponseRecorder {
-	return performAuthed(withAuth(handler), method, target, payload)
+func callAuthed(method, target string, payload interface{}) *httptest.ResponseRecorder {
+	return serve(authedRequest(method, target, payload))
+}
+
+// callAuthedAs is callAuthed for a user other than the seeded test user.
+func callAuthedAs(cookie *http.Cookie, method, target string, payload interface{}) *httptest.ResponseRecorder {
+	req := authedRequest(method, target, payload)
+	req.Header.Del("Cookie")
+	req.AddCookie(cookie)
+	return serve(req)
 }
 
 func decodeBody[T any](t *testing.T, rr *httptest.ResponseRecorder) T {
@@ -133,31 +197,32 @@ func expectStatus(t *testing.T, rr *httptest.ResponseRecorder, want int) {
 	}
 }
 func TestExpenseLifecycle(t *testing.T) {
-	resetData(t)
+	useTestDB(t)
 
 	now := time.Now().UTC().Truncate(time.Second)
 	expense := Expense{
-		Amount:   50.5,
-		Category: "Test",
-		Note:     "Initial expense",
-		Date:     now,
+		Amount:    50.5,
+		Category:  "Test",
+		Note:      "Initial expense",
+		Date:      now,
+		AccountID: testAccount(),
 	}
 
-	createRR := callAuthed(expensesHandler, http.MethodPost, "/expenses", expense)
+	createRR := callAuthed(http.MethodPost, "/expenses", expense)
 	expectStatus(t, createRR, http.StatusCreated)
 	created := decodeBody[Expense](t, createRR)
 	if created.ID == 0 {
 		t.Fatalf("expected expense ID to be set")
 	}
 
-	listRR := callAuthed(expensesHandler, http.MethodGet, "/expenses", nil)
+	listRR := callAuthed(http.MethodGet, "/expenses", nil)
 	expectStatus(t, listRR, http.StatusOK)
 	list := decodeBody[[]Expense](t, listRR)
 	if len(list) != 1 {
 		t.Fatalf("expected 1 expense, got %d", len(list))
 	}
 
-	getRR := callAuthed(expenseHandler, http.MethodGet, fmt.Sprintf("/expenses/%d", created.ID), nil)
+	getRR := callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", created.ID), nil)
 	expectStatus(t, getRR, http.StatusOK)
 	fetched := decodeBody[Expense](t, getRR)
 	if fetched.Amount != expense.Amount {
@@ -171,37 +236,37 @@ func TestExpenseLifecycle(t *testing.T) {
 		Date:     now.Add(24 * time.Hour),
 	}
 
-	updateRR := callAuthed(expenseHandler, http.MethodPut, fmt.Sprintf("/expenses/%d", created.ID), updatedExpense)
+	updateRR := callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", created.ID), updatedExpense)
 	expectStatus(t, updateRR, http.StatusOK)
 	updated := decodeBody[Expense](t, updateRR)
 	if updated.Category != "Updated" {
 		t.Fatalf("expected category Updated got %s", updated.Category)
 	}
 
-	deleteRR := callAuthed(expenseHandler, http.MethodDelete, fmt.Sprintf("/expenses/%d", created.ID), nil)
+	deleteRR := callAuthed(http.MethodDelete, fmt.Sprintf("/expenses/%d", created.ID), nil)
 	expectStatus(t, deleteRR, http.StatusNoContent)
 
-	missingRR := callAuthed(expenseHandler, http.MethodGet, fmt.Sprintf("/expenses/%d", created.ID), nil)
+	missingRR := callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", created.ID), nil)
 	if missingRR.Code != http.StatusNotFound {
 		t.Fatalf("expected 404 after delete, got %d", missingRR.Code)
 	}
 }
 func TestExpenseAggregates(t *testing.T) {
-	resetData(t)
+	useTestDB(t)
 
 	base := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
 	expenses := []Expense{
-		{Amount: 120, Category: "Food", Note: "January food", Date: base},
-		{Amount: 80, Category: "Travel", Note: "February travel", Date: base.AddDate(0, 1, 0)},
-		{Amount: 30, Category: "Food", Note: "January snack", Date: base.Add(48 * time.Hour)},
+		{Amount: 120, Category: "Food", Note: "January food", Date: base, AccountID: testAccount()},
+		{Amount: 80, Category: "Travel", Note: "February travel", Date: base.AddDate(0, 1, 0), AccountID: testAccount()},
+		{Amount: 30, Category: "Food", Note: "January snack", Date: base.Add(48 * time.Hour), AccountID: testAccount()},
 	}
 
 	for _, e := range expenses {
-		rr := callAuthed(expensesHandler, http.MethodPost, "/expenses", e)
+		rr := callAuthed(http.MethodPost, "/expenses", e)
 		expectStatus(t, rr, http.StatusCreated)
 	}
 
-	monthRR := callAuthed(aggregatesHandler, http.MethodGet, "/expenses/aggregates?query=totals_by_month", nil)
+	monthRR := callAuthed(http.MethodGet, "/expenses/aggregates?query=totals_by_month", nil)
 	expectStatus(t, monthRR, http.StatusOK)
 	totalsByMonth := decodeBody[map[string]float64](t, monthRR)
 	if len(totalsByMonth) != 2 {
@@ -211,7 +276,7 @@ func TestExpenseAggregates(t *testing.T) {
 		t.Fatalf("unexpected January total: %.2f", totalsByMonth["2024-01"])
 	}
 
-	categoryRR := callAuthed(aggregatesHandler, http.MethodGet, "/expenses/aggregates?query=totals_by_category", nil)
+	categoryRR := callAuthed(http.MethodGet, "/expenses/aggregates?query=totals_by_category", nil)
 	expectStatus(t, categoryRR, http.StatusOK)
 	totalsByCategory := decodeBody[map[string]float64](t, categoryRR)
 	if len(totalsByCategory) != 2 {
@@ -221,8 +286,48 @@ func TestExpenseAggregates(t *testing.T) {
 		t.Fatalf("unexpected Food total: %.2f", totalsByCategory["Food"])
 	}
 }
+func TestExpenseCategoryFilters(t *testing.T) {
+	useTestDB(t)
+
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i, category := range []string{"Food", "Transport", "Rent", "Food", "Fun"} {
+		e := Expense{Amount: float64(10 * (i + 1)), Category: category, Date: base.AddDate(0, 0, i), AccountID: testAccount()}
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	categoriesOf := func(target string) map[string]int {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, target, nil)
+		expectStatus(t, rr, http.StatusOK)
+		counts := map[string]int{}
+		for _, e := range decodeBody[[]Expense](t, rr) {
+			counts[e.Category]++
+		}
+		return counts
+	}
+
+	cases := []struct {
+		target string
+		want   map[string]int
+	}{
+		{"/expenses?category=", map[string]int{"Food": 2, "Transport": 1, "Rent": 1, "Fun": 1}},
+		{"/expenses?category=Food", map[string]int{"Food": 2}},
+		{"/expenses?category=Food&category=Transport", map[string]int{"Food": 2, "Transport": 1}},
+		{"/expenses?category=Food,%20Transport,,Rent,Food", map[string]int{"Food": 2, "Transport": 1, "Rent": 1}},
+		{"/expenses?exclude_category=Food,Rent", map[string]int{"Transport": 1, "Fun": 1}},
+		{"/expenses?category=Food,Transport&exclude_category=Transport", map[string]int{"Food": 2}},
+		{"/expenses?category=Food,Transport&amount_min=20&date_to=2024-05-03", map[string]int{"Transport": 1}},
+		{"/expenses?category=Food')%20OR%201=1%20--", map[string]int{}},
+	}
+	for _, c := range cases {
+		got := categoriesOf(c.target)
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Fatalf("%s: expected %v, got %v", c.target, c.want, got)
+		}
+	}
+}
 func TestBudgetLifecycle(t *testing.T) {
-	resetData(t)
+	useTestDB(t)
 
 	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
 	budget := Budget{
@@ -232,18 +337,18 @@ func TestBudgetLifecycle(t *testing.T) {
 		EndDate:   start.AddDate(0, 1, 0),
 	}
 
-	createRR := callAuthed(budgetsHandler, http.MethodPost, "/budgets", budget)
+	createRR := callAuthed(http.MethodPost, "/budgets", budget)
 	expectStatus(t, createRR, http.StatusCreated)
 	created := decodeBody[Budget](t, createRR)
 
-	listRR := callAuthed(budgetsHandler, http.MethodGet, "/budgets", nil)
+	listRR := callAuthed(http.MethodGet, "/budgets", nil)
 	expectStatus(t, listRR, http.StatusOK)
 	list := decodeBody[[]Budget](t, listRR)
 	if len(list) != 1 {
 		t.Fatalf("expected 1 budget, got %d", len(list))
 	}
 
-	getRR := callAuthed(budgetHandler, http.MethodGet, fmt.Sprintf("/budgets/%d", created.ID), nil)
+	getRR := callAuthed(http.MethodGet, fmt.Sprintf("/budgets/%d", created.ID), nil)
 	expectStatus(t, getRR, http.StatusOK)
 	fetched := decodeBody[Budget](t, getRR)
 	if fetched.Category != budget.Category {
@@ -257,18 +362,18 @@ func TestBudgetLifecycle(t *testing.T) {
 		EndDate:   budget.EndDate.AddDate(0, 0, 15),
 	}
 
-	updateRR := callAuthed(budgetHandler, http.MethodPut, fmt.Sprintf("/budgets/%d", created.ID), updated)
+	updateRR := callAuthed(http.MethodPut, fmt.Sprintf("/budgets/%d", created.ID), updated)
 	expectStatus(t, updateRR, http.StatusOK)
 	updatedResp := decodeBody[Budget](t, updateRR)
 	if updatedResp.Amount != 250 {
 		t.Fatalf("expected amount 250 got %.2f", updatedResp.Amount)
 	}
 
-	deleteRR := callAuthed(budgetHandler, http.MethodDelete, fmt.Sprintf("/budgets/%d", created.ID), nil)
+	deleteRR := callAuthed(http.MethodDelete, fmt.Sprintf("/budgets/%d", created.ID), nil)
 	expectStatus(t, deleteRR, http.StatusNoContent)
 }
 func TestRecurringExpenseLifecycle(t *testing.T) {
-	resetData(t)
+	useTestDB(t)
 
 	next := time.Now().UTC().Truncate(time.Second)
 	recurring := RecurringExpense{
@@ -279,18 +384,18 @@ func TestRecurringExpenseLifecycle(t *testing.T) {
 		NextDueDate: next,
 	}
 
-	createRR := callAuthed(recurringExpensesHandler, http.MethodPost, "/recurring-expenses", recurring)
+	createRR := callAuthed(http.MethodPost, "/recurring-expenses", recurring)
 	expectStatus(t, createRR, http.StatusCreated)
 	created := decodeBody[RecurringExpense](t, createRR)
 
-	listRR := callAuthed(recurringExpensesHandler, http.MethodGet, "/recurring-expenses", nil)
+	listRR := callAuthed(http.MethodGet, "/recurring-expenses", nil)
 	expectStatus(t, listRR, http.StatusOK)
 	list := decodeBody[[]RecurringExpense](t, listRR)
 	if len(list) != 1 {
 		t.Fatalf("expected 1 recurring expense, got %d", len(list))
 	}
 
-	getRR := callAuthed(recurringExpenseHandler, http.MethodGet, fmt.Sprintf("/recurring-expenses/%d", created.ID), nil)
+	getRR := callAuthed(http.MethodGet, fmt.Sprintf("/recurring-expenses/%d", created.ID), nil)
 	expectStatus(t, getRR, http.StatusOK)
 
 	updated := RecurringExpense{
@@ -301,39 +406,40 @@ func TestRecurringExpenseLifecycle(t *testing.T) {
 		NextDueDate: next.AddDate(0, 1, 0),
 	}
 
-	updateRR := callAuthed(recurringExpenseHandler, http.MethodPut, fmt.Sprintf("/recurring-expenses/%d", created.ID), updated)
+	updateRR := callAuthed(http.MethodPut, fmt.Sprintf("/recurring-expenses/%d", created.ID), updated)
 	expectStatus(t, updateRR, http.StatusOK)
 	updatedResp := decodeBody[RecurringExpense](t, updateRR)
 	if updatedResp.Frequency != "yearly" {
 		t.Fatalf("expected yearly frequency")
 	}
 
-	deleteRR := callAuthed(recurringExpenseHandler, http.MethodDelete, fmt.Sprintf("/recurring-expenses/%d", created.ID), nil)
+	deleteRR := callAuthed(http.MethodDelete, fmt.Sprintf("/recurring-expenses/%d", created.ID), nil)
 	expectStatus(t, deleteRR, http.StatusNoContent)
 }
 func TestIncomeLifecycle(t *testing.T) {
-	resetData(t)
+	useTestDB(t)
 
 	now := time.Now().UTC().Truncate(time.Second)
 	income := Income{
-		Amount: 900,
-		Source: "Salary",
-		Note:   "Monthly salary",
-		Date:   now,
+		Amount:    900,
+		Source:    "Salary",
+		Note:      "Monthly salary",
+		Date:      now,
+		AccountID: testAccount(),
 	}
 
-	createRR := callAuthed(incomesHandler, http.MethodPost, "/incomes", income)
+	createRR := callAuthed(http.MethodPost, "/incomes", income)
 	expectStatus(t, createRR, http.StatusCreated)
 	created := decodeBody[Income](t, createRR)
 
-	listRR := callAuthed(incomesHandler, http.MethodGet, "/incomes", nil)
+	listRR := callAuthed(http.MethodGet, "/incomes", nil)
 	expectStatus(t, listRR, http.StatusOK)
 	list := decodeBody[[]Income](t, listRR)
 	if len(list) != 1 {
 		t.Fatalf("expected 1 income, got %d", len(list))
 	}
 
-	getRR := callAuthed(incomeHandler, http.MethodGet, fmt.Sprintf("/incomes/%d", created.ID), nil)
+	getRR := callAuthed(http.MethodGet, fmt.Sprintf("/incomes/%d", created.ID), nil)
 	expectStatus(t, getRR, http.StatusOK)
 
 	updated := Income{
@@ -343,40 +449,157 @@ func TestIncomeLifecycle(t *testing.T) {
 		Date:   now.AddDate(0, 0, 1),
 	}
 
-	updateRR := callAuthed(incomeHandler, http.MethodPut, fmt.Sprintf("/incomes/%d", created.ID), updated)
+	updateRR := callAuthed(http.MethodPut, fmt.Sprintf("/incomes/%d", created.ID), updated)
 	expectStatus(t, updateRR, http.StatusOK)
 	updatedResp := decodeBody[Income](t, updateRR)
 	if updatedResp.Amount != 950 {
 		t.Fatalf("expected amount 950 got %.2f", updatedResp.Amount)
 	}
 
-	deleteRR := callAuthed(incomeHandler, http.MethodDelete, fmt.Sprintf("/incomes/%d", created.ID), nil)
+	deleteRR := callAuthed(http.MethodDelete, fmt.Sprintf("/incomes/%d", created.ID), nil)
 	expectStatus(t, deleteRR, http.StatusNoContent)
 }
+
+// BenchmarkCreateExpense measures POST /expenses end to end. Run it with
+// TEST_DB_DRIVER=sqlite or TEST_DATABASE_URL to include disk or network
+// round trips.
+func BenchmarkCreateExpense(b *testing.B) {
+	benchmarkCreate(b, "/expenses", func() interface{} {
+		return Expense{Amount: 4.5, Category: "Coffee", Date: time.Now().UTC(), AccountID: testAccount()}
+	})
+}
+
+func BenchmarkCreateIncome(b *testing.B) {
+	benchmarkCreate(b, "/incomes", func() interface{} {
+		return Income{Amount: 900, Source: "Salary", Date: time.Now().UTC(), AccountID: testAccount()}
+	})
+}
+
+// benchmarkCreate posts the body newPayload builds b.N times. The body is
+// built once the test database and its account exist.
+func benchmarkCreate(b *testing.B, target string, newPayload func() interface{}) {
+	cfg := testConfig()
+	cfg.RateLimit = 0
+	useTestDBConfig(b, cfg)
+	payload := newPayload()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if rr := callAuthed(http.MethodPost, target, payload); rr.Code != http.StatusCreated {
+			b.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// BenchmarkExpenseInsert compares preparing the expense INSERT inside each
+// transaction, as createExpense once did, with sending it directly.
+func BenchmarkExpenseInsert(b *testing.B) {
+	useTestDB(b)
+	const query = "INSERT INTO expenses(amount, category, date, user_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?)"
+	now := time.Now().UTC().Format(timeFormat)
+	args := []interface{}{4.5, "Coffee", now, testUserID, now, now}
+	for _, bench := range []struct {
+		name   string
+		insert func(tx *sql.Tx) error
+	}{
+		{"Prepare", func(tx *sql.Tx) error {
+			stmt, err := tx.Prepare(query + " RETURNING id")
+			if err != nil {
+				return err
+			}
+			defer stmt.Close()
+			var id int
+			return stmt.QueryRow(args...).Scan(&id)
+		}},
+		{"Direct", func(tx *sql.Tx) error {
+			_, err := insertReturningID(tx, query, args...)
+			return err
+		}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tx, err := testApp.db.Begin()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := bench.insert(tx); err != nil {
+					tx.Rollback()
+					b.Fatal(err)
+				}
+				if err := tx.Commit(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestEmptyListsAreArrays(t *testing.T) {
+	useTestDB(t)
+	cookie, _ := registerUser(t, "fresh@example.com", "correct horse battery")
+
+	for _, path := range []string{"/expenses", "/incomes", "/budgets", "/recurring-expenses", "/accounts", "/reports/income-vs-expense", "/households", "/audit-log", "/notifications", "/payees", "/rules", "/operations", "/activity"} {
+		rr := callAuthedAs(cookie, http.MethodGet, path, nil)
+		expectStatus(t, rr, http.StatusOK)
+		if body := strings.TrimSpace(rr.Body.String()); body != "[]" {
+			t.Fatalf("expected [] from %s for a fresh user, got %s", path, body)
+		}
+	}
+}
+
+func TestNullNotesReadAsEmpty(t *testing.T) {
+	useTestDB(t)
+
+	now := time.Now().UTC().Format(timeFormat)
+	for _, stmt := range []string{
+		"INSERT INTO expenses(amount, category, note, date, user_id, created_at, updated_at) VALUES(5, 'Misc', NULL, ?, ?, ?, ?)",
+		"INSERT INTO incomes(amount, source, note, date, user_id, created_at, updated_at) VALUES(5, 'Gift', NULL, ?, ?, ?, ?)",
+	} {
+		if _, err := testApp.db.Exec(stmt, now, testUserID, now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := testApp.db.Exec("INSERT INTO recurring_expenses(amount, category, note, frequency, frequency_interval, next_due_date, user_id, created_at, updated_at) VALUES(5, 'Rent', NULL, 'monthly', 1, ?, ?, ?, ?)", now, testUserID, now, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/expenses", "/expenses/1", "/incomes", "/incomes/1", "/recurring-expenses", "/recurring-expenses/1"} {
+		rr := callAuthed(http.MethodGet, path, nil)
+		expectStatus(t, rr, http.StatusOK)
+		if !strings.Contains(rr.Body.String(), `"note":""`) {
+			t.Fatalf("expected %s to read the NULL note as empty, got %s", path, rr.Body.String())
+		}
+	}
+
+	rr := callAuthed(http.MethodPost, "/recurring-expenses/process", nil)
+	expectStatus(t, rr, http.StatusOK)
+	if got := len(decodeBody[RecurringProcessSummary](t, rr).CreatedExpenseIDs); got != 1 {
+		t.Fatalf("expected the NULL-note schedule processed, created %d", got)
+	}
+}
 func TestIncomeVsExpenseReport(t *testing.T) {
-	resetData(t)
+	useTestDB(t)
 
 	base := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
 
 	incomes := []Income{
-		{Amount: 1500, Source: "Salary", Note: "April salary", Date: base},
-		{Amount: 300, Source: "Freelance", Note: "Side gig", Date: base.AddDate(0, 1, 0)},
+		{Amount: 1500, Source: "Salary", Note: "April salary", Date: base, AccountID: testAccount()},
+		{Amount: 300, Source: "Freelance", Note: "Side gig", Date: base.AddDate(0, 1, 0), AccountID: testAccount()},
 	}
 	expenses := []Expense{
-		{Amount: 600, Category: "Rent", Note: "April rent", Date: base.AddDate(0, 0, 2)},
-		{Amount: 200, Category: "Groceries", Note: "May groceries", Date: base.AddDate(0, 1, 5)},
+		{Amount: 600, Category: "Rent", Note: "April rent", Date: base.AddDate(0, 0, 2), AccountID: testAccount()},
+		{Amount: 200, Category: "Groceries", Note: "May groceries", Date: base.AddDate(0, 1, 5), AccountID: testAccount()},
 	}
 
 	for _, income := range incomes {
-		rr := callAuthed(incomesHandler, http.MethodPost, "/incomes", income)
+		rr := callAuthed(http.MethodPost, "/incomes", income)
 		expectStatus(t, rr, http.StatusCreated)
 	}
 	for _, expense := range expenses {
-		rr := callAuthed(expensesHandler, http.MethodPost, "/expenses", expense)
+		rr := callAuthed(http.MethodPost, "/expenses", expense)
 		expectStatus(t, rr, http.StatusCreated)
 	}
 
-	reportRR := callAuthed(incomeVsExpenseReportHandler, http.MethodGet, "/reports/income-vs-expense", nil)
+	reportRR := callAuthed(http.MethodGet, "/reports/income-vs-expense", nil)
 	expectStatus(t, reportRR, http.StatusOK)
 	report := decodeBody[[]MonthlyReport](t, reportRR)
 	if len(report) != 2 {
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// memStore is a Store kept in maps, a test fake that TestStoreConformance
+// holds the SQL store to. A mutex serializes every call. It sees rows the
+// way householdScope does: a user's own and those of households they joined
+// through joinHousehold.
+type memStore struct {
+	mu       sync.Mutex
+	nextID   int
+	expenses map[int]Expense
+	accounts map[int]Account
+	// expenseOwners and accountOwners hold the user who created each row.
+	expenseOwners map[int]int
+	accountOwners map[int]int
+	members       map[int]map[int]bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		expenses:      make(map[int]Expense),
+		accounts:      make(map[int]Account),
+		expenseOwners: make(map[int]int),
+		accountOwners: make(map[int]int),
+		members:       make(map[int]map[int]bool),
+	}
+}
+
+// joinHousehold makes userID a member of householdID.
+func (m *memStore) joinHousehold(householdID, userID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.members[householdID] == nil {
+		m.members[householdID] = make(map[int]bool)
+	}
+	m.members[householdID][userID] = true
+}
+
+// visible reports whether userID sees a row created by owner in
+// householdID.
+func (m *memStore) visible(userID, owner int, householdID *int) bool {
+	if owner == userID {
+		return true
+	}
+	return householdID != nil && m.members[*householdID][userID]
+}
+
+func (m *memStore) FetchExpense(userID, id int) (Expense, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.expenses[id]
+	if !ok || !m.visible(userID, m.expenseOwners[id], e.HouseholdID) {
+		return Expense{}, sql.ErrNoRows
+	}
+	e = copyExpense(e)
+	e.UserID = userID
+	return e, nil
+}
+
+func (m *memStore) InsertExpense(userID int, e Expense) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	e = copyExpense(e)
+	e.ID = m.nextID
+	e.RecurringExpenseID, e.Splits, e.HasSplits = nil, nil, false
+	e.Date, e.Timestamps = storedTime(e.Date), storedTimestamps(e.Timestamps)
+	m.expenses[e.ID] = e
+	m.expenseOwners[e.ID] = userID
+	return e.ID, nil
+}
+
+func (m *memStore) UpdateExpense(userID int, e Expense) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.expenses[e.ID]
+	if !ok || !m.visible(userID, m.expenseOwners[e.ID], old.HouseholdID) {
+		return nil
+	}
+	e = copyExpense(e)
+	e.RecurringExpenseID, e.Splits, e.HasSplits = old.RecurringExpenseID, nil, false
+	e.Date = storedTime(e.Date)
+	e.Timestamps = Timestamps{CreatedAt: old.CreatedAt, UpdatedAt: storedTime(e.UpdatedAt)}
+	m.expenses[e.ID] = e
+	return nil
+}
+
+func (m *memStore) DeleteExpense(userID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.expenses[id]; ok && m.visible(userID, m.expenseOwners[id], e.HouseholdID) {
+		delete(m.expenses, id)
+		delete(m.expenseOwners, id)
+	}
+	return nil
+}
+
+func (m *memStore) FetchAccount(userID, id int) (Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[id]
+	if !ok || !m.visible(userID, m.accountOwners[id], a.HouseholdID) {
+		return Account{}, sql.ErrNoRows
+	}
+	a = copyAccount(a)
+	a.UserID = userID
+	return a, nil
+}
+
+func (m *memStore) InsertAccount(userID int, a Account) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	a = copyAccount(a)
+	a.ID = m.nextID
+	a.Timestamps = storedTimestamps(a.Timestamps)
+	m.accounts[a.ID] = a
+	m.accountOwners[a.ID] = userID
+	return a.ID, nil
+}
+
+func (m *memStore) UpdateAccount(userID int, a Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.accounts[a.ID]
+	if !ok || !m.visible(userID, m.accountOwners[a.ID], old.HouseholdID) {
+		return nil
+	}
+	a = copyAccount(a)
+	a.Timestamps = Timestamps{CreatedAt: old.CreatedAt, UpdatedAt: storedTime(a.UpdatedAt)}
+	m.accounts[a.ID] = a
+	return nil
+}
+
+func (m *memStore) DeleteAccount(userID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[id]
+	if !ok || !m.visible(userID, m.accountOwners[id], a.HouseholdID) {
+		return nil
+	}
+	delete(m.accounts, id)
+	delete(m.accountOwners, id)
+	// As the foreign key's ON DELETE SET NULL does.
+	for eid, e := range m.expenses {
+		if e.AccountID != nil && *e.AccountID == id {
+			e.AccountID = nil
+			m.expenses[eid] = e
+		}
+	}
+	return nil
+}
+
+func (m *memStore) AdjustBalance(userID, id int, delta float64, now string) error {
+	return m.changeBalance(userID, id, delta, now, func(Account) bool { return true })
+}
+
+func (m *memStore) DebitBalance(userID, id int, amount float64, now string) (bool, error) {
+	debited := false
+	err := m.changeBalance(userID, id, -amount, now, func(a Account) bool {
+		debited = *a.AllowNegative || a.Balance-amount > -0.005
+		return debited
+	})
+	return debited, err
+}
+
+// changeBalance adds delta to the account's balance if allow says so.
+func (m *memStore) changeBalance(userID, id int, delta float64, now string, allow func(Account) bool) error {
+	updatedAt, err := time.Parse(timeFormat, now)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[id]
+	if !ok || !m.visible(userID, m.accountOwners[id], a.HouseholdID) || !allow(a) {
+		return nil
+	}
+	a.Balance += delta
+	a.UpdatedAt = updatedAt
+	m.accounts[id] = a
+	return nil
+}
+
+// storedTime is t as it reads back from the database, in UTC to the second.
+func storedTime(t time.Time) time.Time {
+	stored, _ := time.Parse(timeFormat, t.UTC().Format(timeFormat))
+	return stored
+}
+
+func storedTimestamps(ts Timestamps) Timestamps {
+	return Timestamps{CreatedAt: storedTime(ts.CreatedAt), UpdatedAt: storedTime(ts.UpdatedAt)}
+}
+
+// copyExpense copies e's pointer fields, so the stored row and the caller's
+// copy never share them.
+func copyExpense(e Expense) Expense {
+	e.Payee = copyPtr(e.Payee)
+	e.AccountID = copyPtr(e.AccountID)
+	e.HouseholdID = copyPtr(e.HouseholdID)
+	e.RecurringExpenseID = copyPtr(e.RecurringExpenseID)
+	e.Account = nil
+	return e
+}
+
+func copyAccount(a Account) Account {
+	a.AllowNegative = copyPtr(a.AllowNegative)
+	a.MinimumBalance = copyPtr(a.MinimumBalance)
+	a.HouseholdID = copyPtr(a.HouseholdID)
+	return a
+}
+
+func copyPtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// moneyLocale is how a locale writes amounts: the thousands and decimal
+// separators, and where the currency symbol goes.
+type moneyLocale struct {
+	group, decimal string
+	symbolAfter    bool
+	symbolSpace    string
+}
+
+// moneyLocales are the locales a user can pick for displayed amounts.
+var moneyLocales = map[string]moneyLocale{
+	"en-US": {group: ",", decimal: "."},
+	"en-GB": {group: ",", decimal: "."},
+	"id-ID": {group: ".", decimal: ",", symbolSpace: " "},
+	"de-DE": {group: ".", decimal: ",", symbolAfter: true, symbolSpace: " "},
+	"fr-FR": {group: "\u202f", decimal: ",", symbolAfter: true, symbolSpace: "\u00a0"},
+}
+
+const defaultMoneyLocale = "en-US"
+
+// currencyFormat is a currency's symbol and the number of decimals amounts
+// in it are shown with.
+type currencyFormat struct {
+	symbol   string
+	decimals int
+}
+
+var currencyFormats = map[string]currencyFormat{
+	"IDR": {"Rp", 0},
+	"USD": {"$", 2},
+	"EUR": {"€", 2},
+	"GBP": {"£", 2},
+	"JPY": {"¥", 0},
+	"SGD": {"S$", 2},
+	"MYR": {"RM", 2},
+	"AUD": {"A$", 2},
+}
+
+// formatMoney renders amount the way locale writes it, with currency's
+// symbol and decimals. Without a currency the amount gets two decimals and
+// no symbol. Unknown locales fall back to en-US.
+func formatMoney(amount float64, locale, currency string) string {
+	loc, ok := moneyLocales[locale]
+	if !ok {
+		loc = moneyLocales[defaultMoneyLocale]
+	}
+	cur, hasCurrency := currencyFormats[currency]
+	if !hasCurrency {
+		cur.decimals = 2
+	}
+
+	digits := strconv.FormatFloat(math.Abs(amount), 'f', cur.decimals, 64)
+	whole, frac, _ := strings.Cut(digits, ".")
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(loc.group)
+		}
+		b.WriteRune(d)
+	}
+	number := b.String()
+	if frac != "" {
+		number += loc.decimal + frac
+	}
+
+	if hasCurrency {
+		if loc.symbolAfter {
+			number += loc.symbolSpace + cur.symbol
+		} else {
+			number = cur.symbol + loc.symbolSpace + number
+		}
+	}
+	// Compare the rounded digits so an amount that rounds to zero is not
+	// shown as negative.
+	if amount < 0 && strings.Trim(digits, "0.") != "" {
+		number = "-" + number
+	}
+	return number
+}
+
+// moneyFormatter formats amounts for one user's settings.
+type moneyFormatter struct {
+	locale, currency string
+}
+
+func (f *moneyFormatter) format(amount float64) string {
+	return formatMoney(amount, f.locale, f.currency)
+}
+
+// amounts renders named amounts for a response's display field. It returns
+// nil when f is nil, so the field is left out unless format=display was
+// asked for.
+func (f *moneyFormatter) amounts(named map[string]float64) map[string]string {
+	if f == nil {
+		return nil
+	}
+	display := make(map[string]string, len(named))
+	for name, amount := range named {
+		display[name] = f.format(amount)
+	}
+	return display
+}
+
+// displayFormatter reads the ?format parameter of a report endpoint. Reports
+// return raw numbers by default; with format=display they also carry the
+// amounts formatted for the user's locale and currency settings. It returns
+// nil for the default and writes a 400 for an unknown format.
+func (app *App) displayFormatter(w http.ResponseWriter, r *http.Request, userID int) (*moneyFormatter, bool) {
+	switch r.URL.Query().Get("format") {
+	case "":
+		return nil, true
+	case "display":
+	default:
+		http.Error(w, "Invalid format; use display", http.StatusBadRequest)
+		return nil, false
+	}
+	settings, err := loadUserSettings(app.db, userID)
+	if err != nil {
+		log.Printf("user settings lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &moneyFormatter{locale: settings.Locale, currency: settings.Currency}, true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		amount           float64
+		locale, currency string
+		want             string
+	}{
+		{1500000, "id-ID", "IDR", "Rp 1.500.000"},
+		{1500000.75, "id-ID", "IDR", "Rp 1.500.001"},
+		{-25000, "id-ID", "IDR", "-Rp 25.000"},
+		{1234.5, "id-ID", "", "1.234,50"},
+		{1234567.891, "en-US", "USD", "$1,234,567.89"},
+		{999, "en-US", "USD", "$999.00"},
+		{-0.5, "en-US", "USD", "-$0.50"},
+		{-0.001, "en-US", "USD", "$0.00"},
+		{1000, "en-US", "", "1,000.00"},
+		{1234.5, "de-DE", "EUR", "1.234,50 €"},
+		{100, "de-DE", "EUR", "100,00 €"},
+		{-1234567, "de-DE", "EUR", "-1.234.567,00 €"},
+		{1234.5, "fr-FR", "EUR", "1\u202f234,50\u00a0€"},
+		{1234.5, "en-GB", "GBP", "£1,234.50"},
+		{1234, "en-US", "JPY", "¥1,234"},
+		{1234.5, "xx-XX", "", "1,234.50"},
+		{0, "", "", "0.00"},
+	}
+	for _, tt := range tests {
+		if got := formatMoney(tt.amount, tt.locale, tt.currency); got != tt.want {
+			t.Errorf("formatMoney(%v, %q, %q) = %q, want %q", tt.amount, tt.locale, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestReportDisplayFormat(t *testing.T) {
+	useTestDB(t)
+
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Locale: "xx-XX"}), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Currency: "XYZ"}), http.StatusBadRequest)
+	settingsRR := callAuthed(http.MethodPut, "/settings", UserSettings{Locale: "id-ID", Currency: "idr"})
+	expectStatus(t, settingsRR, http.StatusOK)
+	if settings := decodeBody[UserSettings](t, settingsRR); settings.Currency != "IDR" {
+		t.Fatalf("expected currency to be normalized to IDR, got %+v", settings)
+	}
+
+	date := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	callAuthed(http.MethodPost, "/incomes", Income{Amount: 5000000, Source: "Salary", Date: date, AccountID: testAccount()})
+	callAuthed(http.MethodPost, "/expenses", Expense{Amount: 1500000, Category: "Rent", Date: date, AccountID: testAccount()})
+
+	// Raw numbers by default.
+	raw := decodeBody[[]MonthlyReport](t, callAuthed(http.MethodGet, "/reports/income-vs-expense", nil))
+	if len(raw) != 1 || raw[0].Expense != 1500000 || raw[0].Display != nil {
+		t.Fatalf("unexpected default report: %+v", raw)
+	}
+
+	rr := callAuthed(http.MethodGet, "/reports/income-vs-expense?format=display", nil)
+	expectStatus(t, rr, http.StatusOK)
+	display := decodeBody[[]MonthlyReport](t, rr)
+	want := map[string]string{"income": "Rp 5.000.000", "expense": "Rp 1.500.000", "net": "Rp 3.500.000"}
+	if len(display) != 1 || display[0].Expense != 1500000 {
+		t.Fatalf("unexpected display report: %+v", display)
+	}
+	for name, value := range want {
+		if display[0].Display[name] != value {
+			t.Fatalf("expected %s %q, got %+v", name, value, display[0].Display)
+		}
+	}
+
+	stats := decodeBody[ExpenseStats](t, callAuthed(http.MethodGet, "/expenses/stats?date_from=2024-03-01&date_to=2024-03-31&format=display", nil))
+	if stats.Display["total"] != "Rp 1.500.000" || stats.Largest == nil || stats.Largest.Display["amount"] != "Rp 1.500.000" {
+		t.Fatalf("unexpected display stats: %+v", stats)
+	}
+
+	insights := decodeBody[SpendingInsights](t, callAuthed(http.MethodGet, "/reports/insights?period=month&date=2024-03-15&format=display", nil))
+	if len(insights.TopExpenses) != 1 || insights.TopExpenses[0].Display["amount"] != "Rp 1.500.000" {
+		t.Fatalf("unexpected display insights: %+v", insights)
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/income-vs-expense?format=csv", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	notificationBudgetThreshold    = "budget_threshold"
+	notificationRecurringGenerated = "recurring_generated"
+	notificationLowBalance         = "low_balance"
+	notificationLargeExpense       = "large_expense"
+
+	// notificationRetention is how long a notification is kept once read.
+	// Unread ones are kept until they are read.
+	notificationRetention = 30 * 24 * time.Hour
+)
+
+// budgetThresholds are the percentages of a budget that raise a
+// notification when an expense crosses them.
+var budgetThresholds = []float64{80, 100}
+
+// Notification is an entry in a user's feed. Payload depends on Type; every
+// payload names the entity it is about and a link to it under apiPrefix, so
+// clients can open it without knowing each type.
+type Notification struct {
+	ID        int             `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at"`
+}
+
+type notificationTarget struct {
+	EntityType string `json:"entity_type"`
+	EntityID   int    `json:"entity_id"`
+	Link       string `json:"link"`
+}
+
+type budgetThresholdPayload struct {
+	notificationTarget
+	Label       string  `json:"label"`
+	Threshold   float64 `json:"threshold"`
+	Amount      float64 `json:"amount"`
+	Spent       float64 `json:"spent"`
+	PercentUsed float64 `json:"percent_used"`
+	ExpenseID   int     `json:"expense_id"`
+}
+
+type recurringGeneratedPayload struct {
+	notificationTarget
+	Category   string  `json:"category"`
+	Amount     float64 `json:"amount"`
+	ExpenseIDs []int   `json:"expense_ids"`
+}
+
+type lowBalancePayload struct {
+	notificationTarget
+	AccountName string  `json:"account_name"`
+	Balance     float64 `json:"balance"`
+	Threshold   float64 `json:"threshold"`
+	ExpenseID   int     `json:"expense_id"`
+}
+
+type largeExpensePayload struct {
+	notificationTarget
+	Amount    float64 `json:"amount"`
+	Threshold float64 `json:"threshold"`
+}
+
+func (app *App) createNotificationTables() error {
+	stmt := `
+    CREATE TABLE IF NOT EXISTS notifications (
+        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        type TEXT NOT NULL,
+        payload TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        read_at DATETIME,
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(stmt)); err != nil {
+		return fmt.Errorf("create notifications table: %w", err)
+	}
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, read_at)"); err != nil {
+		return fmt.Errorf("create notifications index: %w", err)
+	}
+	return nil
+}
+
+// notify adds a notification for userID inside tx, so it is only sent if
+// the change it reports is committed.
+func notify(tx txQuerier, userID int, kind string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s notification: %w", kind, err)
+	}
+	_, err = tx.Exec("INSERT INTO notifications(user_id, type, payload, created_at) VALUES(?, ?, ?, ?)",
+		userID, kind, string(data), time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		return fmt.Errorf("insert %s notification: %w", kind, err)
+	}
+	return nil
+}
+
+// budgetShare is how much of e counts against b, following the rules of
+// budgetSpent.
+func budgetShare(b Budget, e Expense) float64 {
+	if b.AccountID != nil && (e.AccountID == nil || *e.AccountID != *b.AccountID) {
+		return 0
+	}
+	if b.HouseholdID != nil && (e.HouseholdID == nil || *e.HouseholdID != *b.HouseholdID) {
+		return 0
+	}
+	if b.Category == "" {
+		return e.Amount
+	}
+	if len(e.Splits) == 0 {
+		if e.Category == b.Category {
+			return e.Amount
+		}
+		return 0
+	}
+	var share float64
+	for _, s := range e.Splits {
+		if s.Category == b.Category {
+			share += s.Amount
+		}
+	}
+	return share
+}
+
+// notifyBudgetThresholds runs after e is written in tx and notifies userID
+// of every budget e pushed past one of budgetThresholds. Only the highest
+// threshold crossed is reported. A weekly or monthly budget is measured in
+// the instance e falls in, as its progress is.
+func notifyBudgetThresholds(tx txQuerier, userID int, e Expense) error {
+	date := e.Date.Format(timeFormat)
+	rows, err := tx.Query("SELECT id FROM budgets WHERE amount > 0 AND start_date <= ? AND end_date >= ? AND "+householdScope, date, date, userID, userID)
+	if err != nil {
+		return fmt.Errorf("find budgets: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("find budgets: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("find budgets: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+	cal, err := loadBudgetCalendar(tx, userID)
+	if err != nil {
+		return fmt.Errorf("load budget calendar: %w", err)
+	}
+
+	for _, id := range ids {
+		b, err := fetchBudget(tx, userID, id)
+		if err != nil {
+			return fmt.Errorf("fetch budget %d: %w", id, err)
+		}
+		share := budgetShare(b, e)
+		if share <= 0 {
+			continue
+		}
+		start, end := budgetInstance(b, e.Date, cal)
+		spent, err := budgetSpentBetween(tx, b, start, end)
+		if err != nil {
+			return fmt.Errorf("budget %d spent: %w", id, err)
+		}
+
+		before := (spent - share) / b.Amount * 100
+		after := spent / b.Amount * 100
+		var crossed float64
+		for _, t := range budgetThresholds {
+			if before < t && after >= t {
+				crossed = t
+			}
+		}
+		if crossed == 0 {
+			continue
+		}
+
+		label := b.Category
+		if label == "" {
+			label = "Overall"
+		}
+		if b.AccountName != nil {
+			label += " (" + *b.AccountName + ")"
+		}
+		payload := budgetThresholdPayload{
+			notificationTarget: notificationTarget{
+				EntityType: auditEntityBudget,
+				EntityID:   b.ID,
+				Link:       fmt.Sprintf("%s/budgets/%d/progress", apiPrefix, b.ID),
+			},
+			Label:       label,
+			Threshold:   crossed,
+			Amount:      b.Amount,
+			Spent:       roundCents(spent),
+			PercentUsed: after,
+			ExpenseID:   e.ID,
+		}
+		if err := notify(tx, userID, notificationBudgetThreshold, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyLowBalance runs after e has been debited in tx and notifies userID
+// if it took its account below the account's minimum_balance. Without one,
+// the threshold is zero, except for types that normally run negative, such
+// as credit cards, which are left out. Only the crossing is reported, not
+// every expense while the balance stays below.
+func notifyLowBalance(tx txQuerier, userID int, e Expense) error {
+	if e.AccountID == nil {
+		return nil
+	}
+	var name, kind string
+	var balance float64
+	var minimum sql.NullFloat64
+	err := tx.QueryRow("SELECT name, type, balance, minimum_balance FROM accounts WHERE id = ? AND "+householdScope, *e.AccountID, userID, userID).Scan(&name, &kind, &balance, &minimum)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read account balance: %w", err)
+	}
+	threshold := minimum.Float64
+	if t, ok := lookupAccountType(kind); !minimum.Valid && ok && t.AllowsNegative {
+		return nil
+	}
+	if balance >= threshold || balance+e.Amount < threshold {
+		return nil
+	}
+
+	return notify(tx, userID, notificationLowBalance, lowBalancePayload{
+		notificationTarget: notificationTarget{
+			EntityType: auditEntityAccount,
+			EntityID:   *e.AccountID,
+			Link:       fmt.Sprintf("%s/accounts/%d", apiPrefix, *e.AccountID),
+		},
+		AccountName: name,
+		Balance:     balance,
+		Threshold:   threshold,
+		ExpenseID:   e.ID,
+	})
+}
+
+// largeExpenseThreshold returns userID's threshold_amount setting, or 0
+// when the alert is off.
+func largeExpenseThreshold(q rowQuerier, userID int) (float64, error) {
+	settings, err := loadUserSettings(q, userID)
+	if err != nil || settings.ThresholdAmount == nil {
+		return 0, err
+	}
+	return *settings.ThresholdAmount, nil
+}
+
+// notifyLargeExpense notifies userID when e is above threshold and previous,
+// the amount e had before an update (0 for a new expense), was not, so an
+// expense is reported once however often it is edited.
+func notifyLargeExpense(tx txQuerier, userID int, threshold float64, e Expense, previous float64) error {
+	if threshold <= 0 || e.Amount <= threshold || previous > threshold {
+		return nil
+	}
+	return notify(tx, userID, notificationLargeExpense, largeExpensePayload{
+		notificationTarget: notificationTarget{
+			EntityType: auditEntityExpense,
+			EntityID:   e.ID,
+			Link:       fmt.Sprintf("%s/expenses/%d", apiPrefix, e.ID),
+		},
+		Amount:    e.Amount,
+		Threshold: threshold,
+	})
+}
+
+// notifyRecurringGenerated tells re's owner about the expenses just created
+// from it.
+func notifyRecurringGenerated(tx txQuerier, re RecurringExpense, expenseIDs []int) error {
+	return notify(tx, re.UserID, notificationRecurringGenerated, recurringGeneratedPayload{
+		notificationTarget: notificationTarget{
+			EntityType: auditEntityRecurringExpense,
+			EntityID:   re.ID,
+			Link:       fmt.Sprintf("%s/recurring-expenses/%d/history", apiPrefix, re.ID),
+		},
+		Category:   re.Category,
+		Amount:     re.Amount,
+		ExpenseIDs: expenseIDs,
+	})
+}
+
+// pruneReadNotifications drops notifications read more than
+// notificationRetention ago.
+func (app *App) pruneReadNotifications() {
+	cutoff := time.Now().UTC().Add(-notificationRetention).Format(timeFormat)
+	if _, err := app.db.Exec("DELETE FROM notifications WHERE read_at IS NOT NULL AND read_at < ?", cutoff); err != nil {
+		log.Printf("prune notifications error: %v", err)
+	}
+}
+
+// getNotifications lists the user's notifications, newest first. With
+// ?unread=true only the ones not yet read are returned.
+func (app *App) getNotifications(w http.ResponseWriter, r *http.Request, userID int) {
+	query := "SELECT id, type, payload, created_at, read_at FROM notifications WHERE user_id = ?"
+	args := []interface{}{userID}
+
+	params := r.URL.Query()
+	if raw := params.Get("unread"); raw != "" {
+		unread, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "Invalid unread value", http.StatusBadRequest)
+			return
+		}
+		if unread {
+			query += " AND read_at IS NULL"
+		}
+	}
+
+	limit, offset, ok := parsePagination(w, params)
+	if !ok {
+		return
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := app.requestDB(r).Query(query, args...)
+	if err != nil {
+		log.Printf("notifications query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var payload, createdAt string
+		var readAt sql.NullString
+		if err := rows.Scan(&n.ID, &n.Type, &payload, &createdAt, &readAt); err != nil {
+			log.Printf("notification scan error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		n.Payload = json.RawMessage(payload)
+		if n.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			log.Printf("notification timestamp parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if readAt.Valid {
+			t, err := parseTimestamp(readAt.String)
+			if err != nil {
+				log.Printf("notification timestamp parse error: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			n.ReadAt = &t
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONList(w, notifications)
+}
+
+// markNotificationRead marks one notification read. Marking it again keeps
+// the time it was first read.
+func (app *App) markNotificationRead(w http.ResponseWriter, r *http.Request, userID, id int) {
+	now := time.Now().UTC().Format(timeFormat)
+	res, err := app.db.Exec("UPDATE notifications SET read_at = COALESCE(read_at, ?) WHERE id = ? AND user_id = ?", now, id, userID)
+	if err != nil {
+		log.Printf("mark notification read error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) markAllNotificationsRead(w http.ResponseWriter, r *http.Request, userID int) {
+	now := time.Now().UTC().Format(timeFormat)
+	if _, err := app.db.Exec("UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL", now, userID); err != nil {
+		log.Printf("mark notifications read error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNotifications(t *testing.T) {
+	useTestDB(t)
+
+	now := time.Now().UTC()
+	start := now.AddDate(0, 0, -5).Truncate(time.Second)
+	end := now.AddDate(0, 0, 5).Truncate(time.Second)
+	budget := decodeBody[Budget](t, callAuthed(http.MethodPost, "/budgets", Budget{Category: "Food", Amount: 100, StartDate: start, EndDate: end}))
+	card := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Card", Type: "credit_card"}))
+	wallet := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: "Wallet", Type: "cash", Balance: 50}))
+
+	spend := func(amount float64, category string, accountID *int) {
+		t.Helper()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: amount, Category: category, Date: now, AccountID: accountID}), http.StatusCreated)
+	}
+	feed := func(query string) []Notification {
+		t.Helper()
+		return decodeBody[[]Notification](t, callAuthed(http.MethodGet, "/notifications"+query, nil))
+	}
+
+	spend(70, "Food", &card.ID)
+	if n := len(feed("")); n != 0 {
+		t.Fatalf("expected no notification below 80%%, got %d", n)
+	}
+	spend(15, "Food", &card.ID)
+	spend(5, "Food", &card.ID)
+	spend(20, "Travel", &card.ID)
+	spend(20, "Food", &card.ID)
+
+	// Crossing 80% and then 100% notifies once each; spending that stays
+	// between thresholds or misses the budget does not.
+	notifications := feed("")
+	if len(notifications) != 2 {
+		t.Fatalf("expected two budget notifications, got %+v", notifications)
+	}
+	var over budgetThresholdPayload
+	if err := json.Unmarshal(notifications[0].Payload, &over); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if notifications[0].Type != notificationBudgetThreshold || over.Threshold != 100 || over.Spent != 110 || over.EntityID != budget.ID || over.Label != "Food" {
+		t.Fatalf("unexpected budget notification: %s %s", notifications[0].Type, notifications[0].Payload)
+	}
+	if want := fmt.Sprintf("%s/budgets/%d/progress", apiPrefix, budget.ID); over.Link != want {
+		t.Fatalf("expected link %q, got %q", want, over.Link)
+	}
+
+	spend(60, "Rent", &wallet.ID)
+	spend(5, "Rent", &wallet.ID)
+	low := feed("?unread=true")[0]
+	var lowPayload lowBalancePayload
+	if err := json.Unmarshal(low.Payload, &lowPayload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if low.Type != notificationLowBalance || lowPayload.EntityID != wallet.ID || lowPayload.Balance != -10 {
+		t.Fatalf("unexpected low balance notification: %s %s", low.Type, low.Payload)
+	}
+	if n := len(feed("")); n != 3 {
+		t.Fatalf("expected only the first overdraft to notify, got %d notifications", n)
+	}
+
+	past := now.AddDate(0, 0, -2).Truncate(time.Second)
+	re := decodeBody[RecurringExpense](t, callAuthed(http.MethodPost, "/recurring-expenses", RecurringExpense{Amount: 10, Category: "Gym", Frequency: "monthly", NextDueDate: past}))
+	testApp.processRecurringExpenses()
+	generated := feed("?limit=1")[0]
+	var genPayload recurringGeneratedPayload
+	if err := json.Unmarshal(generated.Payload, &genPayload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if generated.Type != notificationRecurringGenerated || genPayload.EntityID != re.ID || len(genPayload.ExpenseIDs) != 1 {
+		t.Fatalf("unexpected recurring notification: %s %s", generated.Type, generated.Payload)
+	}
+
+	expectStatus(t, callAuthed(http.MethodPost, fmt.Sprintf("/notifications/%d/read", generated.ID), nil), http.StatusNoContent)
+	if unread := feed("?unread=true"); len(unread) != 3 || unread[0].ID == generated.ID {
+		t.Fatalf("expected the read notification left out of the unread feed, got %+v", unread)
+	}
+	if read := feed("?limit=1")[0]; read.ReadAt == nil {
+		t.Fatal("expected read_at to be set")
+	}
+
+	other, _ := registerUser(t, "other@example.com", "AnotherSecurePass123!")
+	expectStatus(t, callAuthedAs(other, http.MethodPost, fmt.Sprintf("/notifications/%d/read", low.ID), nil), http.StatusNotFound)
+
+	expectStatus(t, callAuthed(http.MethodPost, "/notifications/read-all", nil), http.StatusNoContent)
+	if n := len(feed("?unread=true")); n != 0 {
+		t.Fatalf("expected every notification read, got %d unread", n)
+	}
+
+	// Only notifications read longer ago than the retention are pruned.
+	old := time.Now().UTC().Add(-notificationRetention - time.Hour).Format(timeFormat)
+	if _, err := testApp.db.Exec("UPDATE notifications SET read_at = ? WHERE id = ?", old, low.ID); err != nil {
+		t.Fatalf("age notification: %v", err)
+	}
+	testApp.pruneReadNotifications()
+	if n := len(feed("")); n != 3 {
+		t.Fatalf("expected one notification pruned, got %d left", n)
+	}
+}
+
+func TestLargeExpenseAlert(t *testing.T) {
+	useTestDB(t)
+
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{ThresholdAmount: floatPtr(-1)}), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{ThresholdAmount: floatPtr(500)}), http.StatusOK)
+	if got := decodeBody[UserSettings](t, callAuthed(http.MethodGet, "/settings", nil)).ThresholdAmount; got == nil || *got != 500 {
+		t.Fatalf("expected threshold_amount 500, got %v", got)
+	}
+
+	alerts := func() []largeExpensePayload {
+		t.Helper()
+		var payloads []largeExpensePayload
+		for _, n := range decodeBody[[]Notification](t, callAuthed(http.MethodGet, "/notifications?limit=100", nil)) {
+			if n.Type != notificationLargeExpense {
+				continue
+			}
+			var p largeExpensePayload
+			if err := json.Unmarshal(n.Payload, &p); err != nil {
+				t.Fatalf("decode payload: %v", err)
+			}
+			payloads = append(payloads, p)
+		}
+		return payloads
+	}
+	create := func(amount float64) Expense {
+		t.Helper()
+		rr := callAuthed(http.MethodPost, "/expenses", Expense{Amount: amount, Category: "Misc", AccountID: testAccount()})
+		expectStatus(t, rr, http.StatusCreated)
+		return decodeBody[Expense](t, rr)
+	}
+	update := func(e Expense, amount float64) {
+		t.Helper()
+		e.Amount = amount
+		expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", e.ID), e), http.StatusOK)
+	}
+
+	create(500)
+	e := create(600)
+	got := alerts()
+	if len(got) != 1 || got[0].EntityID != e.ID || got[0].Amount != 600 || got[0].Threshold != 500 {
+		t.Fatalf("expected one alert for the 600 expense, got %+v", got)
+	}
+
+	// Edits already above the threshold do not alert again; going back
+	// above it after dropping below does.
+	update(e, 700)
+	update(e, 300)
+	if n := len(alerts()); n != 1 {
+		t.Fatalf("expected no new alerts, got %d", n)
+	}
+	update(e, 800)
+	if n := len(alerts()); n != 2 {
+		t.Fatalf("expected an alert for crossing the threshold again, got %d", n)
+	}
+
+	doc := exportDocument{SchemaVersion: exportSchemaVersion, Expenses: []Expense{{Amount: 900, Category: "Misc"}, {Amount: 5, Category: "Misc"}}}
+	expectStatus(t, callAuthed(http.MethodPost, "/import?merge=true", doc), http.StatusCreated)
+	if got := alerts(); len(got) != 3 || got[0].Amount != 900 {
+		t.Fatalf("expected an alert for the imported expense, got %+v", got)
+	}
+
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{ThresholdAmount: floatPtr(0)}), http.StatusOK)
+	create(10000)
+	if n := len(alerts()); n != 3 {
+		t.Fatalf("expected a threshold of 0 to turn alerts off, got %d", n)
+	}
+}
+
+func TestMinimumBalanceWarning(t *testing.T) {
+	useTestDB(t)
+
+	savings := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: "Savings", Type: "bank", Balance: 1000, MinimumBalance: floatPtr(200)}))
+	if savings.MinimumBalance == nil || *savings.MinimumBalance != 200 {
+		t.Fatalf("expected minimum_balance 200, got %+v", savings)
+	}
+	card := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Card", Type: "credit_card", MinimumBalance: floatPtr(-500)}))
+
+	spend := func(accountID int, amount float64) {
+		t.Helper()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: amount, Category: "Misc", AccountID: intPtr(accountID)}), http.StatusCreated)
+	}
+	warnings := func() []lowBalancePayload {
+		t.Helper()
+		var payloads []lowBalancePayload
+		for _, n := range decodeBody[[]Notification](t, callAuthed(http.MethodGet, "/notifications?limit=100", nil)) {
+			var p lowBalancePayload
+			if err := json.Unmarshal(n.Payload, &p); err != nil {
+				t.Fatalf("decode payload: %v", err)
+			}
+			payloads = append(payloads, p)
+		}
+		return payloads
+	}
+
+	spend(savings.ID, 800)
+	if n := len(warnings()); n != 0 {
+		t.Fatalf("expected no warning at the minimum, got %d", n)
+	}
+	spend(savings.ID, 50)
+	got := warnings()
+	if len(got) != 1 || got[0].EntityID != savings.ID || got[0].AccountName != "Savings" || got[0].Balance != 150 || got[0].Threshold != 200 {
+		t.Fatalf("expected a warning for crossing the minimum, got %+v", got)
+	}
+
+	// Staying below does not warn again; recovering and crossing again does.
+	spend(savings.ID, 20)
+	if n := len(warnings()); n != 1 {
+		t.Fatalf("expected no warning while already below, got %d", n)
+	}
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 500, Source: "Salary", AccountID: intPtr(savings.ID)}), http.StatusCreated)
+	spend(savings.ID, 600)
+	if got := warnings(); len(got) != 2 || got[0].Balance != 30 {
+		t.Fatalf("expected a second warning after recovering, got %+v", got)
+	}
+
+	// A minimum applies to types that normally run negative too.
+	spend(card.ID, 400)
+	spend(card.ID, 200)
+	if got := warnings(); len(got) != 3 || got[0].EntityID != card.ID || got[0].Threshold != -500 {
+		t.Fatalf("expected a warning for the card, got %+v", got)
+	}
+
+	// PUT replaces the minimum; leaving it out clears it.
+	updated := decodeBody[Account](t, callAuthed(http.MethodPut, fmt.Sprintf("/accounts/%d", savings.ID), Account{Name: "Savings", Type: "bank", Balance: 30}))
+	if updated.MinimumBalance != nil {
+		t.Fatalf("expected minimum_balance cleared, got %v", *updated.MinimumBalance)
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
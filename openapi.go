@@ -0,0 +1,582 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The OpenAPI document is generated from apiOperations, which names each
+// route's parameters and Go request and response types; schemas come from
+// those types' JSON tags, so adding a field to a struct documents it.
+// TestOpenAPICoversRoutes keeps apiOperations in step with App.routes, and
+// TestOpenAPIResponsesMatchSchemas checks real responses against the
+// schemas.
+
+// apiSchema is the subset of the OpenAPI 3.0 Schema Object the document
+// uses.
+type apiSchema struct {
+	Ref                  string                `json:"$ref,omitempty"`
+	Type                 string                `json:"type,omitempty"`
+	Format               string                `json:"format,omitempty"`
+	Nullable             bool                  `json:"nullable,omitempty"`
+	Properties           map[string]*apiSchema `json:"properties,omitempty"`
+	Required             []string              `json:"required,omitempty"`
+	Items                *apiSchema            `json:"items,omitempty"`
+	AdditionalProperties *apiSchema            `json:"additionalProperties,omitempty"`
+	AllOf                []*apiSchema          `json:"allOf,omitempty"`
+	OneOf                []*apiSchema          `json:"oneOf,omitempty"`
+	ReadOnly             bool                  `json:"readOnly,omitempty"`
+	Description          string                `json:"description,omitempty"`
+}
+
+type apiAuth int
+
+const (
+	authNone apiAuth = iota
+	authCookie
+	authBearer
+)
+
+type apiParam struct {
+	Name string
+	Type string // "string", "integer", "number" or "boolean"
+}
+
+// apiOperation describes one route. Request and Response are zero values of
+// the Go types read and written; a nil Response means 204 No Content.
+type apiOperation struct {
+	Method, Path string
+	Tag, Summary string
+	Auth         apiAuth
+	Query        []apiParam
+	Request      interface{}
+	Response     interface{}
+	Status       int
+	// ContentType overrides application/json for binary responses.
+	ContentType string
+	// Server overrides apiPrefix as the base for routes outside it.
+	Server string
+}
+
+func strParams(names ...string) []apiParam {
+	params := make([]apiParam, len(names))
+	for i, name := range names {
+		params[i] = apiParam{Name: name, Type: "string"}
+	}
+	return params
+}
+
+var pageParams = []apiParam{{"limit", "integer"}, {"offset", "integer"}}
+
+// strictParams is accepted by the endpoints that check for unknown query
+// parameters.
+var strictParams = []apiParam{{"strict", "boolean"}}
+
+func params(groups ...[]apiParam) []apiParam {
+	var all []apiParam
+	for _, g := range groups {
+		all = append(all, g...)
+	}
+	return all
+}
+
+var apiOperations = []apiOperation{
+	{Method: "POST", Path: "/auth/register", Tag: "Auth", Summary: "Register and start a session", Request: credentials{}, Response: authResponse{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/auth/login", Tag: "Auth", Summary: "Log in and start a session", Request: credentials{}, Response: authResponse{}},
+	{Method: "POST", Path: "/auth/logout", Tag: "Auth", Summary: "End the current session"},
+	{Method: "DELETE", Path: "/auth/account", Tag: "Auth", Summary: "Delete the account after a grace period, or at once", Auth: authCookie, Query: []apiParam{{"immediate", "boolean"}}, Request: deleteUserRequest{}},
+
+	{Method: "GET", Path: "/expenses", Tag: "Expenses", Summary: "List expenses", Auth: authCookie, Query: params(strParams("date_from", "date_to", "category", "exclude_category", "q", "account_id", "modified_since", "cursor", "expand"), []apiParam{{"amount_min", "number"}, {"amount_max", "number"}, {"amount_near", "number"}, {"amount_tolerance", "number"}, {"uncategorized", "boolean"}}, pageParams, strictParams), Response: []Expense{}},
+	{Method: "POST", Path: "/expenses", Tag: "Expenses", Summary: "Create an expense", Auth: authCookie, Request: Expense{}, Response: Expense{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/expenses/bulk", Tag: "Expenses", Summary: "Delete, recategorize, or move many expenses", Auth: authCookie, Query: params([]apiParam{{"atomic", "boolean"}}, strictParams), Request: BulkExpenseRequest{}, Response: BulkExpenseResponse{}},
+	{Method: "GET", Path: "/expenses/aggregates", Tag: "Expenses", Summary: "Totals by month, category, or payee", Auth: authCookie, Query: params(strParams("query", "expand"), strictParams), Response: map[string]float64{}},
+	{Method: "GET", Path: "/expenses/stats", Tag: "Expenses", Summary: "Spending statistics for a date range", Auth: authCookie, Query: strParams("date_from", "date_to", "format"), Response: ExpenseStats{}},
+	{Method: "GET", Path: "/expenses/categories", Tag: "Expenses", Summary: "Categories the user has spent on, by use", Auth: authCookie, Query: params(strParams("q"), pageParams), Response: []CategoryUsage{}},
+	{Method: "GET", Path: "/expenses/{id}", Tag: "Expenses", Summary: "Get an expense", Auth: authCookie, Query: strParams("expand"), Response: Expense{}},
+	{Method: "PUT", Path: "/expenses/{id}", Tag: "Expenses", Summary: "Update an expense", Auth: authCookie, Request: Expense{}, Response: Expense{}},
+	{Method: "DELETE", Path: "/expenses/{id}", Tag: "Expenses", Summary: "Delete an expense", Auth: authCookie},
+	{Method: "GET", Path: "/categories/meta", Tag: "Expenses", Summary: "List category colors and icons", Auth: authCookie, Response: []CategoryMeta{}},
+	{Method: "PUT", Path: "/categories/meta", Tag: "Expenses", Summary: "Set a category's color and icon", Auth: authCookie, Request: CategoryMeta{}, Response: CategoryMeta{}},
+	{Method: "DELETE", Path: "/categories/meta", Tag: "Expenses", Summary: "Remove a category's color and icon", Auth: authCookie, Query: strParams("category")},
+	{Method: "GET", Path: "/payees", Tag: "Expenses", Summary: "Autocomplete payees", Auth: authCookie, Query: params(strParams("q"), pageParams), Response: []PayeeSuggestion{}},
+
+	{Method: "GET", Path: "/budgets", Tag: "Budgets", Summary: "List budgets", Auth: authCookie, Query: params(strParams("modified_since", "status", "category", "date_from", "date_to"), pageParams, strictParams), Response: []Budget{}},
+	{Method: "POST", Path: "/budgets", Tag: "Budgets", Summary: "Create a budget", Auth: authCookie, Request: Budget{}, Response: Budget{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/budgets/{id}", Tag: "Budgets", Summary: "Get a budget", Auth: authCookie, Response: Budget{}},
+	{Method: "PUT", Path: "/budgets/{id}", Tag: "Budgets", Summary: "Update a budget", Auth: authCookie, Request: Budget{}, Response: Budget{}},
+	{Method: "DELETE", Path: "/budgets/{id}", Tag: "Budgets", Summary: "Delete a budget", Auth: authCookie},
+	{Method: "GET", Path: "/budgets/{id}/progress", Tag: "Budgets", Summary: "Spending against a budget", Auth: authCookie, Response: BudgetProgress{}},
+	{Method: "POST", Path: "/budgets/{id}/clone", Tag: "Budgets", Summary: "Copy a budget into the next period", Auth: authCookie, Request: BudgetClone{}, Response: Budget{}, Status: http.StatusCreated},
+
+	{Method: "GET", Path: "/recurring-expenses", Tag: "Recurring expenses", Summary: "List recurring expenses", Auth: authCookie, Query: params(strParams("modified_since", "sort"), pageParams, strictParams), Response: []RecurringExpense{}},
+	{Method: "POST", Path: "/recurring-expenses", Tag: "Recurring expenses", Summary: "Create a recurring expense", Auth: authCookie, Request: RecurringExpense{}, Response: RecurringExpense{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/recurring-expenses/upcoming", Tag: "Recurring expenses", Summary: "Project upcoming occurrences", Auth: authCookie, Query: []apiParam{{"days", "integer"}}, Response: UpcomingRecurringExpenses{}},
+	{Method: "GET", Path: "/recurring-expenses/calendar.ics", Tag: "Recurring expenses", Summary: "Subscribe to upcoming occurrences as an iCalendar feed, with the calendar token in place of the session", Query: strParams("token"), Response: "", ContentType: "text/calendar"},
+	{Method: "POST", Path: "/recurring-expenses/process", Tag: "Recurring expenses", Summary: "Create the expenses that are due now", Auth: authCookie, Response: RecurringProcessSummary{}},
+	{Method: "GET", Path: "/recurring-expenses/{id}", Tag: "Recurring expenses", Summary: "Get a recurring expense", Auth: authCookie, Response: RecurringExpense{}},
+	{Method: "PUT", Path: "/recurring-expenses/{id}", Tag: "Recurring expenses", Summary: "Update a recurring expense", Auth: authCookie, Request: RecurringExpense{}, Response: RecurringExpense{}},
+	{Method: "DELETE", Path: "/recurring-expenses/{id}", Tag: "Recurring expenses", Summary: "Delete a recurring expense", Auth: authCookie, Query: []apiParam{{"delete_expenses", "boolean"}}},
+	{Method: "POST", Path: "/recurring-expenses/{id}/skip", Tag: "Recurring expenses", Summary: "Skip the next occurrence", Auth: authCookie, Response: RecurringExpense{}},
+	{Method: "GET", Path: "/recurring-expenses/{id}/history", Tag: "Recurring expenses", Summary: "List the expenses it generated", Auth: authCookie, Query: pageParams, Response: []Expense{}},
+
+	{Method: "GET", Path: "/incomes", Tag: "Incomes", Summary: "List incomes", Auth: authCookie, Query: params(strParams("date_from", "date_to", "account_id", "modified_since", "cursor", "expand"), []apiParam{{"amount_min", "number"}, {"amount_max", "number"}, {"limit", "integer"}}, strictParams), Response: []Income{}},
+	{Method: "GET", Path: "/incomes/sources", Tag: "Incomes", Summary: "Sources the user has recorded income from, by use", Auth: authCookie, Query: params(strParams("q"), pageParams), Response: []SourceUsage{}},
+	{Method: "POST", Path: "/incomes", Tag: "Incomes", Summary: "Create an income", Auth: authCookie, Request: Income{}, Response: Income{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/incomes/export", Tag: "Incomes", Summary: "Export incomes as CSV or JSON", Auth: authCookie, Query: params(strParams("format", "date_from", "date_to", "account_id"), strictParams), Response: "", ContentType: "text/csv"},
+	{Method: "GET", Path: "/incomes/{id}", Tag: "Incomes", Summary: "Get an income", Auth: authCookie, Query: strParams("expand"), Response: Income{}},
+	{Method: "PUT", Path: "/incomes/{id}", Tag: "Incomes", Summary: "Update an income", Auth: authCookie, Request: Income{}, Response: Income{}},
+	{Method: "DELETE", Path: "/incomes/{id}", Tag: "Incomes", Summary: "Delete an income", Auth: authCookie},
+
+	{Method: "GET", Path: "/reports/income-vs-expense", Tag: "Reports", Summary: "Income against expenses per period", Auth: authCookie, Query: params(strParams("group_by", "date_from", "date_to", "format"), []apiParam{{"fill", "boolean"}, {"include_opening_balances", "boolean"}, {"fiscal", "boolean"}}, strictParams), Response: []MonthlyReport{}},
+	{Method: "GET", Path: "/reports/income-sources", Tag: "Reports", Summary: "Income by source, with the top sources month by month", Auth: authCookie, Query: params(strParams("date_from", "date_to", "format"), strictParams), Response: IncomeSourceReport{}},
+	{Method: "GET", Path: "/reports/hygiene", Tag: "Reports", Summary: "Transactions that need cleaning up", Auth: authCookie, Query: strictParams, Response: HygieneReport{}},
+	{Method: "GET", Path: "/reports/insights", Tag: "Reports", Summary: "Spending insights for a period", Auth: authCookie, Query: params(strParams("period", "date", "format"), strictParams), Response: SpendingInsights{}},
+	{Method: "GET", Path: "/reports/trend", Tag: "Reports", Summary: "Monthly spending with a moving average", Auth: authCookie, Query: params(strParams("category"), []apiParam{{"months", "integer"}}, strictParams), Response: SpendingTrend{}},
+	{Method: "GET", Path: "/reports/savings-rate", Tag: "Reports", Summary: "Monthly net and savings rate", Auth: authCookie, Query: params([]apiParam{{"months", "integer"}}, strictParams), Response: SavingsRateReport{}},
+	{Method: "GET", Path: "/reports/year", Tag: "Reports", Summary: "A calendar or fiscal year in review", Auth: authCookie, Query: params([]apiParam{{"year", "integer"}, {"fiscal", "boolean"}}, strictParams), Response: YearReview{}},
+	{Method: "GET", Path: "/reports/forecast", Tag: "Reports", Summary: "Project balances to the end of the month", Auth: authCookie, Query: strictParams, Response: Forecast{}},
+	{Method: "GET", Path: "/dashboard", Tag: "Reports", Summary: "Everything the home screen shows", Auth: authCookie, Response: Dashboard{}},
+	{Method: "GET", Path: "/activity", Tag: "Reports", Summary: "Expenses and incomes in one list", Auth: authCookie, Query: params(strParams("type", "date_from", "date_to", "account_id", "cursor"), pageParams), Response: []ActivityItem{}},
+	{Method: "GET", Path: "/transactions/export", Tag: "Reports", Summary: "Export expenses and incomes as CSV or JSON", Auth: authCookie, Query: params(strParams("format", "date_from", "date_to", "account_id"), strictParams), Response: "", ContentType: "text/csv"},
+
+	{Method: "GET", Path: "/accounts", Tag: "Accounts", Summary: "List accounts", Auth: authCookie, Query: params(strParams("modified_since", "sort"), pageParams, strictParams), Response: []Account{}},
+	{Method: "POST", Path: "/accounts", Tag: "Accounts", Summary: "Create an account", Auth: authCookie, Query: []apiParam{{"opening_balance", "boolean"}}, Request: Account{}, Response: Account{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/accounts/types", Tag: "Accounts", Summary: "List the allowed account types", Auth: authCookie, Response: []AccountType{}},
+	{Method: "GET", Path: "/accounts/{id}", Tag: "Accounts", Summary: "Get an account", Auth: authCookie, Response: Account{}},
+	{Method: "PUT", Path: "/accounts/{id}", Tag: "Accounts", Summary: "Update an account", Auth: authCookie, Request: Account{}, Response: Account{}},
+	{Method: "DELETE", Path: "/accounts/{id}", Tag: "Accounts", Summary: "Delete an account", Auth: authCookie},
+	{Method: "GET", Path: "/accounts/{id}/history", Tag: "Accounts", Summary: "An account's balance over time", Auth: authCookie, Query: params(strParams("granularity", "date_from", "date_to"), strictParams), Response: BalanceHistory{}},
+	{Method: "POST", Path: "/accounts/{id}/adjust", Tag: "Accounts", Summary: "Adjust an account's balance by hand", Auth: authCookie, Request: AccountAdjustment{}, Response: BalanceAdjustment{}, Status: http.StatusCreated},
+
+	{Method: "GET", Path: "/audit-log", Tag: "Audit log", Summary: "List recorded changes", Auth: authCookie, Query: params(strParams("entity_type", "action"), []apiParam{{"entity_id", "integer"}}, pageParams), Response: []AuditEntry{}},
+
+	{Method: "GET", Path: "/notifications", Tag: "Notifications", Summary: "List your notifications", Auth: authCookie, Query: params([]apiParam{{"unread", "boolean"}}, pageParams), Response: []Notification{}},
+	{Method: "POST", Path: "/notifications/read-all", Tag: "Notifications", Summary: "Mark every notification read", Auth: authCookie},
+	{Method: "POST", Path: "/notifications/{id}/read", Tag: "Notifications", Summary: "Mark a notification read", Auth: authCookie},
+	{Method: "GET", Path: "/operations", Tag: "Operations", Summary: "List your recent destructive operations", Auth: authCookie, Query: params([]apiParam{{"recent", "boolean"}}, pageParams, strictParams), Response: []Operation{}},
+	{Method: "POST", Path: "/operations/{id}/undo", Tag: "Operations", Summary: "Undo an operation", Auth: authCookie, Response: Operation{}},
+
+	{Method: "GET", Path: "/households", Tag: "Households", Summary: "List your households", Auth: authCookie, Response: []Household{}},
+	{Method: "POST", Path: "/households", Tag: "Households", Summary: "Create a household", Auth: authCookie, Request: Household{}, Response: Household{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/households/{id}", Tag: "Households", Summary: "Delete a household (owner only)", Auth: authCookie},
+	{Method: "POST", Path: "/households/{id}/invites", Tag: "Households", Summary: "Create an invite (owner only)", Auth: authCookie, Response: HouseholdInvite{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/invites/accept", Tag: "Households", Summary: "Join a household with an invite", Auth: authCookie, Request: acceptInviteRequest{}, Response: Household{}},
+
+	{Method: "GET", Path: "/rules", Tag: "Rules", Summary: "List category rules", Auth: authCookie, Response: []CategoryRule{}},
+	{Method: "POST", Path: "/rules", Tag: "Rules", Summary: "Create a category rule", Auth: authCookie, Request: CategoryRule{}, Response: CategoryRule{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/rules/apply", Tag: "Rules", Summary: "Categorize existing uncategorized expenses", Auth: authCookie, Query: strParams("date_from", "date_to"), Response: applyRulesResult{}},
+	{Method: "GET", Path: "/rules/{id}", Tag: "Rules", Summary: "Get a category rule", Auth: authCookie, Response: CategoryRule{}},
+	{Method: "PUT", Path: "/rules/{id}", Tag: "Rules", Summary: "Update a category rule", Auth: authCookie, Request: CategoryRule{}, Response: CategoryRule{}},
+	{Method: "DELETE", Path: "/rules/{id}", Tag: "Rules", Summary: "Delete a category rule", Auth: authCookie},
+
+	{Method: "GET", Path: "/webhooks", Tag: "Webhooks", Summary: "List your webhooks", Auth: authCookie, Response: []Webhook{}},
+	{Method: "POST", Path: "/webhooks", Tag: "Webhooks", Summary: "Create a webhook; the response carries its signing secret", Auth: authCookie, Request: Webhook{}, Response: Webhook{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/webhooks/{id}", Tag: "Webhooks", Summary: "Delete a webhook and its delivery log", Auth: authCookie},
+	{Method: "GET", Path: "/webhooks/{id}/deliveries", Tag: "Webhooks", Summary: "List a webhook's deliveries", Auth: authCookie, Query: params(strParams("status"), pageParams, strictParams), Response: []WebhookDelivery{}},
+	{Method: "POST", Path: "/webhooks/{id}/test", Tag: "Webhooks", Summary: "Queue a test event for a webhook", Auth: authCookie, Response: WebhookDelivery{}, Status: http.StatusAccepted},
+
+	{Method: "GET", Path: "/admin/backup", Tag: "Admin", Summary: "Download a database snapshot", Auth: authBearer, Response: []byte{}, ContentType: "application/vnd.sqlite3"},
+	{Method: "POST", Path: "/admin/users/{id}/unlock", Tag: "Admin", Summary: "Lift a login lockout", Auth: authBearer},
+	{Method: "PUT", Path: "/admin/users/{id}/quota-exemption", Tag: "Admin", Summary: "Exempt a user from quotas", Auth: authBearer},
+	{Method: "DELETE", Path: "/admin/users/{id}/quota-exemption", Tag: "Admin", Summary: "Hold a user to quotas again", Auth: authBearer},
+
+	{Method: "GET", Path: "/settings", Tag: "Settings", Summary: "Get your settings", Auth: authCookie, Response: UserSettings{}},
+	{Method: "PUT", Path: "/settings", Tag: "Settings", Summary: "Update your settings", Auth: authCookie, Request: UserSettings{}, Response: UserSettings{}},
+	{Method: "POST", Path: "/settings/calendar-token", Tag: "Settings", Summary: "Issue a calendar feed token, revoking the previous one", Auth: authCookie, Response: CalendarToken{}},
+	{Method: "DELETE", Path: "/settings/calendar-token", Tag: "Settings", Summary: "Revoke the calendar feed token", Auth: authCookie},
+	{Method: "GET", Path: "/limits", Tag: "Settings", Summary: "Your usage against each quota", Auth: authCookie, Response: UserLimits{}},
+	{Method: "GET", Path: "/sync", Tag: "Sync", Summary: "Changes since the last sync", Auth: authCookie, Query: params(strParams("since", "token"), []apiParam{{"limit", "integer"}}), Response: SyncResponse{}},
+	{Method: "GET", Path: "/export", Tag: "Sync", Summary: "Export all your data", Auth: authCookie, Response: exportDocument{}},
+	{Method: "POST", Path: "/import", Tag: "Sync", Summary: "Import an export document", Auth: authCookie, Query: []apiParam{{"merge", "boolean"}}, Request: exportDocument{}, Response: map[string]exportCounts{}, Status: http.StatusCreated},
+
+	{Method: "GET", Path: "/version", Server: "/api", Tag: "Docs", Summary: "API version and build information", Response: versionInfo{}},
+	{Method: "GET", Path: "/openapi.json", Tag: "Docs", Summary: "This document", Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/docs", Tag: "Docs", Summary: "Interactive API reference", Response: "", ContentType: "text/html"},
+}
+
+// apiSpec accumulates component schemas while the document is built.
+type apiSpec struct {
+	components map[string]*apiSchema
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaFor returns the schema of t, registering named structs as
+// components and referring to them.
+func (s *apiSpec) schemaFor(t reflect.Type) *apiSchema {
+	switch {
+	case t == timeType:
+		return &apiSchema{Type: "string", Format: "date-time"}
+	case t == rawType || t.Kind() == reflect.Interface:
+		return &apiSchema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		inner := s.schemaFor(t.Elem())
+		if inner.Ref != "" {
+			// Siblings of $ref are ignored in OpenAPI 3.0, so wrap it.
+			return &apiSchema{AllOf: []*apiSchema{inner}, Nullable: true}
+		}
+		inner.Nullable = true
+		return inner
+	case reflect.String:
+		return &apiSchema{Type: "string"}
+	case reflect.Bool:
+		return &apiSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &apiSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &apiSchema{Type: "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &apiSchema{Type: "string", Format: "binary"}
+		}
+		// encoding/json writes nil slices as null.
+		return &apiSchema{Type: "array", Items: s.schemaFor(t.Elem()), Nullable: true}
+	case reflect.Map:
+		return &apiSchema{Type: "object", AdditionalProperties: s.schemaFor(t.Elem())}
+	case reflect.Struct:
+		name := componentName(t)
+		if _, ok := s.components[name]; !ok {
+			schema := &apiSchema{Type: "object", Properties: map[string]*apiSchema{}}
+			s.components[name] = schema
+			s.addFields(schema, t)
+			sort.Strings(schema.Required)
+		}
+		return &apiSchema{Ref: "#/components/schemas/" + name}
+	}
+	return &apiSchema{}
+}
+
+// readOnlyFields are set by the server and ignored in request bodies.
+var readOnlyFields = map[string]bool{
+	"id": true, "created_at": true, "updated_at": true,
+	"has_splits": true, "recurring_expense_id": true, "opening_balance": true,
+	"account_name": true, "account_removed": true, "is_active": true,
+	"account": true,
+}
+
+// addFields adds t's JSON fields to schema, flattening embedded structs the
+// way encoding/json does. Fields without omitempty or omitzero are always
+// written, so they are listed as required.
+func (s *apiSpec) addFields(schema *apiSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			s.addFields(schema, f.Type)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		prop := s.schemaFor(f.Type)
+		if readOnlyFields[name] {
+			if prop.Ref != "" {
+				prop = &apiSchema{AllOf: []*apiSchema{prop}}
+			}
+			prop.ReadOnly = true
+		}
+		schema.Properties[name] = prop
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+func componentName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// datedPaths are the write endpoints whose date is checked against a range,
+// besides POST /expenses.
+var datedPaths = map[string]bool{
+	"/expenses/{id}":           true,
+	"/incomes":                 true,
+	"/incomes/{id}":            true,
+	"/recurring-expenses":      true,
+	"/recurring-expenses/{id}": true,
+}
+
+// quotaPaths are the endpoints that create rows counted by a quota.
+var quotaPaths = map[string]bool{"/expenses": true, "/accounts": true, "/import": true}
+
+// conditionalPaths are the GET endpoints that send Last-Modified and answer
+// If-Modified-Since.
+var conditionalPaths = map[string]bool{
+	"/expenses": true, "/expenses/aggregates": true, "/expenses/stats": true, "/expenses/categories": true, "/payees": true,
+	"/budgets": true, "/recurring-expenses": true, "/recurring-expenses/upcoming": true, "/incomes": true, "/incomes/sources": true,
+	"/reports/income-vs-expense": true, "/reports/income-sources": true, "/reports/hygiene": true, "/reports/insights": true, "/reports/trend": true, "/reports/savings-rate": true,
+	"/reports/year": true, "/reports/forecast": true, "/dashboard": true, "/activity": true, "/accounts": true,
+}
+
+// errorResponses are the failures every operation can answer with. Handlers
+// report errors as a plain-text message; only authentication, lockout,
+// rate limit, overdraft and routing failures have a JSON body.
+func (s *apiSpec) errorResponses(op apiOperation) map[string]interface{} {
+	text := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content":     map[string]interface{}{"text/plain": map[string]interface{}{"schema": &apiSchema{Type: "string"}}},
+		}
+	}
+	responses := map[string]interface{}{
+		"400": text("The request is malformed or fails validation."),
+		"405": map[string]interface{}{
+			"description": "The path exists but not with this method; Allow lists the methods it takes.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(apiError{}))),
+		},
+		"default": text("Any other error, such as 404 Not Found or 500 Internal Server Error."),
+	}
+	if op.Request != nil {
+		responses["413"] = map[string]interface{}{
+			"description": "The body is larger than the endpoint accepts.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(apiError{}))),
+		}
+		responses["415"] = map[string]interface{}{
+			"description": "The body is declared as something other than JSON.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(apiError{}))),
+		}
+	}
+	switch op.Auth {
+	case authCookie:
+		responses["401"] = map[string]interface{}{
+			"description": "The session cookie is missing, invalid or expired.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(apiError{}))),
+		}
+		responses["429"] = map[string]interface{}{
+			"description": "You have made too many requests; Retry-After says when to try again.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(rateLimitError{}))),
+		}
+	case authBearer:
+		responses["401"] = text("The admin token is missing or wrong.")
+		responses["404"] = text("Admin routes are disabled because no admin token is configured.")
+	}
+	switch {
+	case op.Method == http.MethodPost && op.Path == "/expenses":
+		responses["422"] = map[string]interface{}{
+			"description": "The date is outside the accepted range, or the linked account does not allow a negative balance and cannot cover the amount.",
+			"content": jsonContent(&apiSchema{OneOf: []*apiSchema{
+				s.schemaFor(reflect.TypeOf(dateRangeError{})),
+				s.schemaFor(reflect.TypeOf(overdraftError{})),
+			}}),
+		}
+	case (op.Method == http.MethodPost || op.Method == http.MethodPut) && datedPaths[op.Path]:
+		responses["422"] = map[string]interface{}{
+			"description": "The date is outside the accepted range.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(dateRangeError{}))),
+		}
+	}
+	if op.Method == http.MethodPost && quotaPaths[op.Path] {
+		responses["403"] = map[string]interface{}{
+			"description": "The request would take you over a quota; the body states the limit.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(quotaError{}))),
+		}
+	}
+	if op.Method == http.MethodGet && conditionalPaths[op.Path] {
+		responses["304"] = map[string]interface{}{"description": "Nothing has changed since If-Modified-Since; there is no body."}
+	}
+	if op.Method == http.MethodGet && op.Auth == authCookie {
+		responses["504"] = map[string]interface{}{
+			"description": "A database query ran past the query timeout and was cancelled.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(apiError{}))),
+		}
+	}
+	if op.Path == "/auth/login" {
+		responses["401"] = map[string]interface{}{
+			"description": "The email or password is wrong.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(apiError{}))),
+		}
+		responses["423"] = map[string]interface{}{
+			"description": "The account is locked after too many failed logins; Retry-After says for how long.",
+			"content":     jsonContent(s.schemaFor(reflect.TypeOf(lockoutError{}))),
+		}
+	}
+	return responses
+}
+
+func jsonContent(schema *apiSchema) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// operationObject renders op as an OpenAPI Operation Object.
+func (s *apiSpec) operationObject(op apiOperation) map[string]interface{} {
+	var parameters []map[string]interface{}
+	if strings.Contains(op.Path, "{id}") {
+		parameters = append(parameters, map[string]interface{}{
+			"name": "id", "in": "path", "required": true,
+			"schema": &apiSchema{Type: "integer"},
+		})
+	}
+	for _, p := range op.Query {
+		parameters = append(parameters, map[string]interface{}{
+			"name": p.Name, "in": "query",
+			"schema": &apiSchema{Type: p.Type},
+		})
+	}
+
+	responses := s.errorResponses(op)
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if op.Response == nil {
+		responses["204"] = map[string]interface{}{"description": "No Content"}
+	} else {
+		schema := s.schemaFor(reflect.TypeOf(op.Response))
+		content := jsonContent(schema)
+		if op.ContentType != "" {
+			content = map[string]interface{}{op.ContentType: map[string]interface{}{"schema": schema}}
+		}
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content":     content,
+		}
+	}
+
+	obj := map[string]interface{}{
+		"operationId": operationID(op),
+		"summary":     op.Summary,
+		"tags":        []string{op.Tag},
+		"responses":   responses,
+	}
+	if len(parameters) > 0 {
+		obj["parameters"] = parameters
+	}
+	if op.Server != "" {
+		obj["servers"] = []map[string]string{{"url": op.Server}}
+	}
+	if op.Request != nil {
+		obj["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(s.schemaFor(reflect.TypeOf(op.Request))),
+		}
+	}
+	switch op.Auth {
+	case authNone:
+		obj["security"] = []map[string][]string{}
+	case authBearer:
+		obj["security"] = []map[string][]string{{"bearerAuth": {}}}
+	}
+	return obj
+}
+
+// operationID turns "GET /budgets/{id}/progress" into
+// "get_budgets_id_progress".
+func operationID(op apiOperation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.Split(op.Path, "/") {
+		part = strings.Trim(part, "{}")
+		if part != "" {
+			id += "_" + strings.NewReplacer("-", "_", ".", "_").Replace(part)
+		}
+	}
+	return id
+}
+
+// buildOpenAPI assembles the whole document.
+func buildOpenAPI() map[string]interface{} {
+	s := &apiSpec{components: map[string]*apiSchema{}}
+	paths := map[string]map[string]interface{}{}
+	for _, op := range apiOperations {
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]interface{}{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = s.operationObject(op)
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Expense Tracker API",
+			"version": apiVersion,
+			"description": "The API is also served at the unversioned paths it used before " + apiPrefix + ", " +
+				"which are deprecated and answer with Deprecation and Sunset headers. " +
+				"Fields listed as required are always present in responses; " +
+				"in request bodies, omitted fields take their zero value and read-only fields are ignored. " +
+				"Errors are plain text except where a JSON body is documented.",
+		},
+		"servers": []map[string]string{{"url": apiPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": s.components,
+			"securitySchemes": map[string]interface{}{
+				"cookieAuth": map[string]interface{}{
+					"type": "apiKey", "in": "cookie", "name": sessionCookieName,
+					"description": "Session cookie set by /auth/register and /auth/login.",
+				},
+				"bearerAuth": map[string]interface{}{
+					"type": "http", "scheme": "bearer",
+					"description": "ADMIN_TOKEN, for the /admin routes.",
+				},
+			},
+		},
+		"security": []map[string][]string{{"cookieAuth": {}}},
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		var err error
+		if openAPIJSON, err = json.Marshal(buildOpenAPI()); err != nil {
+			log.Printf("openapi marshal error: %v", err)
+		}
+	})
+	if openAPIJSON == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIJSON)
+}
+
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Expense Tracker API</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+<redoc spec-url="` + apiPrefix + `/openapi.json"></redoc>
+<script src="https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+// docsHandler serves a Redoc page rendering the OpenAPI document. It loosens the
+// default Content-Security-Policy just enough for Redoc's script, styles,
+// fonts and web worker.
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; "+
+		"script-src https://cdn.redoc.ly; style-src 'unsafe-inline' https://fonts.googleapis.com; "+
+		"font-src https://fonts.gstatic.com; img-src 'self' data:; worker-src blob:; "+
+		"connect-src 'self'; frame-ancestors 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
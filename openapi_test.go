@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestOpenAPICoversRoutes fails when a route is registered in App.routes
+// without being described in apiOperations, or the other way round. Routes
+// on the v1 mux are documented relative to apiPrefix, others with their
+// own Server.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	src, err := os.ReadFile("routing.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := map[string]bool{}
+	for _, m := range regexp.MustCompile(`(v1|mux)\.HandleFunc\("([A-Z]+) ([^"]+)"`).FindAllStringSubmatch(string(src), -1) {
+		path := m[3]
+		if m[1] == "v1" {
+			path = apiPrefix + path
+		}
+		registered[m[2]+" "+path] = true
+	}
+	documented := map[string]bool{}
+	for _, op := range apiOperations {
+		server := op.Server
+		if server == "" {
+			server = apiPrefix
+		}
+		key := op.Method + " " + server + op.Path
+		if documented[key] {
+			t.Errorf("%s is documented twice", key)
+		}
+		documented[key] = true
+		if !registered[key] {
+			t.Errorf("%s is documented but not registered", key)
+		}
+	}
+	for key := range registered {
+		if !documented[key] {
+			t.Errorf("%s is registered but missing from apiOperations", key)
+		}
+	}
+}
+
+// TestOpenAPIResponsesMatchSchemas calls the handlers with real data and
+// checks each response body against the schema documented for it.
+func TestOpenAPIResponsesMatchSchemas(t *testing.T) {
+	useTestDB(t)
+	spec := buildOpenAPI()
+	v := specValidator{spec: spec, components: spec["components"].(map[string]interface{})["schemas"].(map[string]*apiSchema)}
+
+	check := func(method, pattern string, rr *httptest.ResponseRecorder) {
+		t.Helper()
+		if rr.Code >= 300 {
+			t.Fatalf("%s %s: status %d (body: %s)", method, pattern, rr.Code, rr.Body.String())
+		}
+		v.check(t, method, pattern, rr)
+	}
+	create := func(pattern string, payload interface{}) int {
+		t.Helper()
+		rr := callAuthed(http.MethodPost, pattern, payload)
+		check(http.MethodPost, pattern, rr)
+		return decodeBody[struct{ ID int }](t, rr).ID
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	payee := "Corner Shop"
+	expenseID := create("/expenses", Expense{Amount: 12.5, Category: "Groceries", Payee: &payee, Date: now, AccountID: testAccount(),
+		Splits: []ExpenseSplit{{Category: "Groceries", Amount: 10}, {Category: "Snacks", Amount: 2.5}}})
+	create("/expenses", Expense{Amount: 4, Date: now.AddDate(0, 0, -1), AccountID: testAccount()})
+	budgetID := create("/budgets", Budget{Category: "Groceries", Amount: 200, StartDate: now.AddDate(0, 0, -7), EndDate: now.AddDate(0, 0, 7)})
+	recurringID := create("/recurring-expenses", RecurringExpense{Amount: 45, Category: "Subscription", Frequency: "monthly", NextDueDate: now})
+	incomeID := create("/incomes", Income{Amount: 1000, Source: "Salary", Date: now, AccountID: testAccount()})
+	ruleID := create("/rules", CategoryRule{MatchField: ruleFieldNote, MatchType: ruleMatchContains, Pattern: "netflix", Category: "Streaming"})
+	householdID := create("/households", Household{Name: "Home"})
+	webhookID := create("/webhooks", Webhook{URL: "https://example.com/hooks/expenses"})
+
+	rr := callAuthed(http.MethodPost, fmt.Sprintf("/households/%d/invites", householdID), nil)
+	check(http.MethodPost, "/households/{id}/invites", rr)
+	invite := decodeBody[HouseholdInvite](t, rr)
+	partnerCookie, _ := registerUser(t, "partner@example.com", "PartnerSecretPass123!")
+	check(http.MethodPost, "/invites/accept", callAuthedAs(partnerCookie, http.MethodPost, "/invites/accept", acceptInviteRequest{Token: invite.Token}))
+
+	check(http.MethodPost, "/recurring-expenses/process", callAuthed(http.MethodPost, "/recurring-expenses/process", nil))
+	check(http.MethodPost, "/rules/apply", callAuthed(http.MethodPost, "/rules/apply", nil))
+	check(http.MethodPost, "/webhooks/{id}/test", callAuthed(http.MethodPost, fmt.Sprintf("/webhooks/%d/test", webhookID), nil))
+	check(http.MethodPut, "/expenses/{id}", callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", expenseID),
+		Expense{Amount: 13, Category: "Groceries", Date: now, AccountID: testAccount()}))
+	check(http.MethodPut, "/settings", callAuthed(http.MethodPut, "/settings", decodeBody[UserSettings](t, callAuthed(http.MethodGet, "/settings", nil))))
+
+	exportRR := callAuthed(http.MethodGet, "/export", nil)
+	check(http.MethodGet, "/export", exportRR)
+	check(http.MethodGet, "/version", serve(httptest.NewRequest(http.MethodGet, "/api/version", nil)))
+
+	ids := map[string]int{
+		"/expenses/": expenseID, "/budgets/": budgetID, "/recurring-expenses/": recurringID,
+		"/incomes/": incomeID, "/rules/": ruleID, "/accounts/": testAccountID,
+		"/webhooks/": webhookID,
+	}
+	queries := map[string]string{
+		"/expenses/aggregates":         "?query=totals_by_category",
+		"/reports/insights":            "?period=month",
+		"/recurring-expenses/upcoming": "?days=60",
+	}
+	for _, op := range apiOperations {
+		if op.Method != http.MethodGet || op.Auth != authCookie || op.Path == "/export" || op.ContentType != "" {
+			continue
+		}
+		target := op.Path
+		for prefix, id := range ids {
+			if strings.HasPrefix(target, prefix+"{id}") {
+				target = strings.Replace(target, "{id}", strconv.Itoa(id), 1)
+			}
+		}
+		check(op.Method, op.Path, callAuthed(op.Method, apiPrefix+target+queries[op.Path], nil))
+	}
+
+	// The error envelopes are documented too.
+	unauthed := httptest.NewRequest(http.MethodGet, apiPrefix+"/expenses", nil)
+	rr = serve(unauthed)
+	expectStatus(t, rr, http.StatusUnauthorized)
+	v.check(t, http.MethodGet, "/expenses", rr)
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	useTestDB(t)
+
+	rr := serve(httptest.NewRequest(http.MethodGet, apiPrefix+"/openapi.json", nil))
+	expectStatus(t, rr, http.StatusOK)
+	doc := decodeBody[map[string]interface{}](t, rr)
+	if doc["openapi"] != "3.0.3" {
+		t.Fatalf("unexpected openapi version: %v", doc["openapi"])
+	}
+	schemes := doc["components"].(map[string]interface{})["securitySchemes"].(map[string]interface{})
+	if _, ok := schemes["cookieAuth"]; !ok {
+		t.Fatalf("cookieAuth scheme missing: %v", schemes)
+	}
+	if _, ok := schemes["bearerAuth"]; !ok {
+		t.Fatalf("bearerAuth scheme missing: %v", schemes)
+	}
+
+	rr = serve(httptest.NewRequest(http.MethodGet, apiPrefix+"/docs", nil))
+	expectStatus(t, rr, http.StatusOK)
+	if !strings.Contains(rr.Body.String(), `spec-url="`+apiPrefix+`/openapi.json"`) {
+		t.Fatalf("docs page does not load the spec: %s", rr.Body.String())
+	}
+	if csp := rr.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src https://cdn.redoc.ly") {
+		t.Fatalf("docs page CSP does not allow Redoc: %q", csp)
+	}
+}
+
+// specValidator checks JSON values against the schemas in a built spec.
+type specValidator struct {
+	spec       map[string]interface{}
+	components map[string]*apiSchema
+}
+
+func (v specValidator) check(t *testing.T, method, pattern string, rr *httptest.ResponseRecorder) {
+	t.Helper()
+	paths := v.spec["paths"].(map[string]map[string]interface{})
+	op, ok := paths[pattern][strings.ToLower(method)].(map[string]interface{})
+	if !ok {
+		t.Fatalf("%s %s is not documented", method, pattern)
+	}
+	responses := op["responses"].(map[string]interface{})
+	response, ok := responses[strconv.Itoa(rr.Code)].(map[string]interface{})
+	if !ok {
+		t.Fatalf("%s %s: status %d is not documented", method, pattern, rr.Code)
+	}
+	content, ok := response["content"].(map[string]interface{})["application/json"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("%s %s: status %d has no JSON body documented", method, pattern, rr.Code)
+	}
+	var body interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: decode response: %v", method, pattern, err)
+	}
+	for _, problem := range v.validate(body, content["schema"].(*apiSchema), "$") {
+		t.Errorf("%s %s: %s", method, pattern, problem)
+	}
+}
+
+// validate returns where value does not match schema. Objects may not have
+// properties the schema does not declare, so undocumented fields are caught.
+func (v specValidator) validate(value interface{}, schema *apiSchema, path string) []string {
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		component, ok := v.components[name]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown schema %s", path, schema.Ref)}
+		}
+		return v.validate(value, component, path)
+	}
+	if value == nil {
+		if schema.Nullable || schema.Type == "" && len(schema.AllOf) == 0 {
+			return nil
+		}
+		return []string{path + ": null is not allowed"}
+	}
+	if len(schema.AllOf) > 0 {
+		var problems []string
+		for _, sub := range schema.AllOf {
+			problems = append(problems, v.validate(value, sub, path)...)
+		}
+		return problems
+	}
+
+	mismatch := []string{fmt.Sprintf("%s: want %s, got %T", path, schema.Type, value)}
+	switch schema.Type {
+	case "":
+		return nil
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return []string{fmt.Sprintf("%s: %q is not a date-time", path, s)}
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return mismatch
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			return mismatch
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		var problems []string
+		for i, item := range items {
+			problems = append(problems, v.validate(item, schema.Items, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return problems
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch
+		}
+		var problems []string
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required %q", path, name))
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			prop := schema.AdditionalProperties
+			if p, ok := schema.Properties[key]; ok {
+				prop = p
+			}
+			if prop == nil {
+				problems = append(problems, fmt.Sprintf("%s: undocumented property %q", path, key))
+				continue
+			}
+			problems = append(problems, v.validate(obj[key], prop, path+"."+key)...)
+		}
+		return problems
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import "fmt"
+
+// openingBalanceSource is the source of the income recorded for a new
+// account's starting balance.
+const openingBalanceSource = "Opening Balance"
+
+// recordOpeningBalance records a's starting balance as an income on it, so
+// the balance is explained by its transactions like any other change. The
+// balance is already set, so the account is not adjusted again; editing the
+// entry later adjusts it like any income. Nothing is recorded for a zero
+// balance.
+func recordOpeningBalance(tx txQuerier, a Account) error {
+	if a.Balance == 0 {
+		return nil
+	}
+	i := Income{
+		Amount:         a.Balance,
+		Source:         openingBalanceSource,
+		Date:           a.CreatedAt,
+		AccountID:      &a.ID,
+		HouseholdID:    a.HouseholdID,
+		OpeningBalance: true,
+		Timestamps:     a.Timestamps,
+		UserID:         a.UserID,
+	}
+	now := a.UpdatedAt.Format(timeFormat)
+	id, err := insertReturningID(tx, "INSERT INTO incomes(amount, source, note, date, user_id, account_id, household_id, opening_balance, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		i.Amount, i.Source, i.Note, i.Date.Format(timeFormat), i.UserID, i.AccountID, i.HouseholdID, true, now, now)
+	if err != nil {
+		return fmt.Errorf("insert opening balance: %w", err)
+	}
+	i.ID = id
+	if err := recordAudit(tx, i.UserID, auditEntityIncome, i.ID, auditActionCreate, nil, i); err != nil {
+		return err
+	}
+	return queueWebhookEvent(tx, i.UserID, webhookEventIncomeCreated, i)
+}
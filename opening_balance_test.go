@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestOpeningBalance(t *testing.T) {
+	useTestDB(t)
+
+	savings := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Savings", Type: "bank", Balance: 5000}))
+	callAuthed(http.MethodPost, "/accounts", Account{Name: "Card", Type: "credit_card", Balance: -200})
+	skipped := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: "Legacy", Type: "cash", Balance: 300}))
+	callAuthed(http.MethodPost, "/accounts", Account{Name: "Empty", Type: "cash"})
+
+	incomes := decodeBody[[]Income](t, callAuthed(http.MethodGet, "/incomes", nil))
+	if len(incomes) != 2 {
+		t.Fatalf("expected opening entries for the two accounts with a balance that did not opt out, got %+v", incomes)
+	}
+	opening := incomes[0]
+	if opening.Amount != 5000 || opening.Source != openingBalanceSource || !opening.OpeningBalance || opening.AccountID == nil || *opening.AccountID != savings.ID {
+		t.Fatalf("unexpected opening entry: %+v", opening)
+	}
+	if incomes[1].Amount != -200 || !incomes[1].OpeningBalance {
+		t.Fatalf("expected a negative opening entry for the card, got %+v", incomes[1])
+	}
+	if n := len(decodeBody[[]Income](t, callAuthed(http.MethodGet, fmt.Sprintf("/incomes?account_id=%d", skipped.ID), nil))); n != 0 {
+		t.Fatalf("expected no opening entry with opening_balance=false, got %d", n)
+	}
+
+	// Recording the entry does not count the balance twice.
+	if got := decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", savings.ID), nil)).Balance; got != 5000 {
+		t.Fatalf("expected the balance to stay 5000, got %v", got)
+	}
+
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 1000, Source: "Salary", AccountID: &savings.ID}), http.StatusCreated)
+	income := func(query string) float64 {
+		var total float64
+		for _, r := range decodeBody[[]MonthlyReport](t, callAuthed(http.MethodGet, "/reports/income-vs-expense"+query, nil)) {
+			total += r.Income
+		}
+		return total
+	}
+	if got := income(""); got != 1000 {
+		t.Fatalf("expected opening balances left out of the report, got income %v", got)
+	}
+	if got := income("?include_opening_balances=true"); got != 5800 {
+		t.Fatalf("expected opening balances included on request, got income %v", got)
+	}
+
+	// The entry is an ordinary income otherwise: clients cannot forge the
+	// flag, and editing keeps it and moves the balance by the difference.
+	forged := decodeBody[Income](t, callAuthed(http.MethodPost, "/incomes", map[string]interface{}{"amount": 1, "source": "Gift", "account_id": savings.ID, "opening_balance": true}))
+	if forged.OpeningBalance {
+		t.Fatal("expected opening_balance to be read-only")
+	}
+	edited := decodeBody[Income](t, callAuthed(http.MethodPut, fmt.Sprintf("/incomes/%d", opening.ID), Income{Amount: 4500, Source: openingBalanceSource, Date: opening.Date}))
+	if !edited.OpeningBalance {
+		t.Fatalf("expected the edited entry to stay an opening balance, got %+v", edited)
+	}
+	if got := decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", savings.ID), nil)).Balance; got != 5501 {
+		t.Fatalf("expected the balance to follow the edited opening entry, got %v", got)
+	}
+}
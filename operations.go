@@ -0,0 +1,349 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	operationDeleteExpense   = "delete_expense"
+	operationBulkDelete      = "bulk_delete"
+	operationBulkSetCategory = "bulk_set_category"
+	operationBulkSetAccount  = "bulk_set_account"
+	operationApplyRules      = "apply_rules"
+
+	// undoWindow is how long an operation can be undone.
+	undoWindow = 15 * time.Minute
+	// operationRetention is how long operations are listed after they can no
+	// longer be undone.
+	operationRetention = 24 * time.Hour
+)
+
+// Operation is a destructive change that can be undone for undoWindow after
+// it was made: deleting an expense, a bulk expense action, or applying
+// category rules. Count is how many expenses it changed.
+type Operation struct {
+	ID        int        `json:"id"`
+	Kind      string     `json:"kind"`
+	Count     int        `json:"count"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UndoneAt  *time.Time `json:"undone_at"`
+	Undoable  bool       `json:"undoable"`
+}
+
+// operationUndo is what an operation stores to reverse itself.
+type operationUndo struct {
+	// Restore lists the expenses the operation deleted.
+	Restore []expenseSnapshot `json:"restore,omitempty"`
+	// Refunded is set when deleting them gave their amounts back to their
+	// accounts, so restoring them takes the amounts again.
+	Refunded bool `json:"refunded,omitempty"`
+	// Revert lists the expenses the operation recategorized or moved, as
+	// they were before.
+	Revert []Expense `json:"revert,omitempty"`
+}
+
+// expenseSnapshot is an expense as it was deleted, with the owner that
+// Expense leaves out of its JSON.
+type expenseSnapshot struct {
+	Expense Expense `json:"expense"`
+	OwnerID int     `json:"owner_id"`
+}
+
+func (app *App) createOperationTables() error {
+	stmt := `
+    CREATE TABLE IF NOT EXISTS operations (
+        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        kind TEXT NOT NULL,
+        expense_count INTEGER NOT NULL,
+        undo TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        undone_at DATETIME,
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(stmt)); err != nil {
+		return fmt.Errorf("create operations table: %w", err)
+	}
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_operations_user ON operations(user_id, created_at)"); err != nil {
+		return fmt.Errorf("create operations index: %w", err)
+	}
+	return nil
+}
+
+// snapshotExpense records e, about to be deleted, for restoreExpense.
+func snapshotExpense(tx txQuerier, e Expense) (expenseSnapshot, error) {
+	s := expenseSnapshot{Expense: e}
+	err := tx.QueryRow("SELECT user_id FROM expenses WHERE id = ?", e.ID).Scan(&s.OwnerID)
+	return s, err
+}
+
+// recordOperation stores an operation made by userID inside tx, so it can
+// only be undone if the change itself is committed. It returns the
+// operation's ID.
+func recordOperation(tx txQuerier, userID int, kind string, count int, undo operationUndo) (int, error) {
+	data, err := json.Marshal(undo)
+	if err != nil {
+		return 0, err
+	}
+	return insertReturningID(tx, "INSERT INTO operations(user_id, kind, expense_count, undo, created_at) VALUES(?, ?, ?, ?, ?)",
+		userID, kind, count, string(data), time.Now().UTC().Format(timeFormat))
+}
+
+func (app *App) pruneOperations() {
+	cutoff := time.Now().UTC().Add(-undoWindow - operationRetention).Format(timeFormat)
+	if _, err := app.db.Exec("DELETE FROM operations WHERE created_at < ?", cutoff); err != nil {
+		log.Printf("prune operations error: %v", err)
+	}
+}
+
+func scanOperation(row interface{ Scan(...interface{}) error }, now time.Time) (Operation, error) {
+	var op Operation
+	var createdAt string
+	var undoneAt sql.NullString
+	if err := row.Scan(&op.ID, &op.Kind, &op.Count, &createdAt, &undoneAt); err != nil {
+		return Operation{}, err
+	}
+	var err error
+	if op.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return Operation{}, err
+	}
+	if undoneAt.Valid {
+		t, err := parseTimestamp(undoneAt.String)
+		if err != nil {
+			return Operation{}, err
+		}
+		op.UndoneAt = &t
+	}
+	op.ExpiresAt = op.CreatedAt.Add(undoWindow)
+	op.Undoable = op.UndoneAt == nil && now.Before(op.ExpiresAt)
+	return op, nil
+}
+
+// getOperations lists the user's operations, newest first. With
+// ?recent=true only the ones that can still be undone are returned.
+func (app *App) getOperations(w http.ResponseWriter, r *http.Request, userID int) {
+	query := "SELECT id, kind, expense_count, created_at, undone_at FROM operations WHERE user_id = ?"
+	args := []interface{}{userID}
+
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, append([]string{"recent"}, pageParamNames...)...) {
+		return
+	}
+	recent, ok := parseBoolParam(w, params, "recent")
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	if recent {
+		query += " AND undone_at IS NULL AND created_at > ?"
+		args = append(args, now.Add(-undoWindow).Format(timeFormat))
+	}
+
+	limit, offset, ok := parsePagination(w, params)
+	if !ok {
+		return
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := app.requestDB(r).Query(query, args...)
+	if err != nil {
+		log.Printf("operations query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	operations := []Operation{}
+	for rows.Next() {
+		op, err := scanOperation(rows, now)
+		if err != nil {
+			log.Printf("operation scan error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		operations = append(operations, op)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONList(w, operations)
+}
+
+// undoOperation reverses an operation in one transaction: deleted expenses
+// come back with their IDs, splits and balance effects, and recategorized or
+// moved ones get their previous category and account back. Expenses deleted
+// since the operation are left deleted. An operation already undone or
+// older than undoWindow is a 410.
+func (app *App) undoOperation(w http.ResponseWriter, r *http.Request, userID, id int) {
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	op, err := scanOperation(tx.QueryRow("SELECT id, kind, expense_count, created_at, undone_at FROM operations WHERE id = ? AND user_id = ?", id, userID), now)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Operation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("operation fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if op.UndoneAt != nil {
+		http.Error(w, "Operation already undone", http.StatusGone)
+		return
+	}
+	if !op.Undoable {
+		http.Error(w, "Operation can no longer be undone", http.StatusGone)
+		return
+	}
+
+	// The undone_at check in the UPDATE keeps two concurrent undos from both
+	// going through.
+	stamp := now.Format(timeFormat)
+	res, err := tx.Exec("UPDATE operations SET undone_at = ? WHERE id = ? AND undone_at IS NULL", stamp, id)
+	if err != nil {
+		log.Printf("operation update error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Operation already undone", http.StatusGone)
+		return
+	}
+
+	var undo operationUndo
+	var data string
+	if err := tx.QueryRow("SELECT undo FROM operations WHERE id = ?", id).Scan(&data); err == nil {
+		err = json.Unmarshal([]byte(data), &undo)
+	}
+	if err != nil {
+		log.Printf("operation undo decode error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, s := range undo.Restore {
+		if err := app.restoreExpense(tx, userID, s, undo.Refunded, now); err != nil {
+			log.Printf("restore expense %d error: %v", s.Expense.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, prev := range undo.Revert {
+		if err := app.revertExpense(tx, userID, prev, now); err != nil {
+			log.Printf("revert expense %d error: %v", prev.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	undoneAt := now.Truncate(time.Second)
+	op.UndoneAt = &undoneAt
+	op.Undoable = false
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(op)
+}
+
+// restoreExpense inserts a deleted expense again under its old ID. Links to
+// an account, household or schedule deleted in the meantime are dropped.
+// The tombstone is removed and updated_at bumped, so syncing clients see the
+// expense again.
+func (app *App) restoreExpense(tx txQuerier, userID int, s expenseSnapshot, refunded bool, now time.Time) error {
+	e := s.Expense
+	var err error
+	if e.AccountID, err = stillExists(tx, "accounts", e.AccountID); err != nil {
+		return err
+	}
+	if e.HouseholdID, err = stillExists(tx, "households", e.HouseholdID); err != nil {
+		return err
+	}
+	if e.RecurringExpenseID, err = stillExists(tx, "recurring_expenses", e.RecurringExpenseID); err != nil {
+		return err
+	}
+
+	e.Timestamps = e.Timestamps.touched(now)
+	stamp := e.UpdatedAt.Format(timeFormat)
+	var createdAt interface{}
+	if !e.CreatedAt.IsZero() {
+		createdAt = e.CreatedAt.UTC().Format(timeFormat)
+	}
+	if _, err := tx.Exec("INSERT INTO expenses(id, amount, category, note, payee, date, user_id, account_id, household_id, recurring_expense_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.ID, e.Amount, e.Category, e.Note, e.Payee, e.Date.UTC().Format(timeFormat), s.OwnerID, e.AccountID, e.HouseholdID, e.RecurringExpenseID, createdAt, stamp); err != nil {
+		return err
+	}
+	if err := replaceExpenseSplits(tx, e.ID, e.Splits); err != nil {
+		return err
+	}
+	if refunded {
+		if err := app.adjustAccountBalance(tx, userID, e.AccountID, -e.Amount, balanceReasonExpense, stamp); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM deleted_records WHERE entity_type = ? AND entity_id = ?", auditEntityExpense, e.ID); err != nil {
+		return err
+	}
+	return recordAudit(tx, userID, auditEntityExpense, e.ID, auditActionCreate, nil, e)
+}
+
+// revertExpense puts back the category and account prev had, moving the
+// amount back to the old account. An expense deleted since, or an account
+// deleted since, is left as it is.
+func (app *App) revertExpense(tx txQuerier, userID int, prev Expense, now time.Time) error {
+	current, err := fetchExpense(tx, userID, prev.ID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	e := current
+	e.Category = prev.Category
+	if prev.AccountID == nil {
+		e.AccountID = nil
+	} else if accountID, err := stillExists(tx, "accounts", prev.AccountID); err != nil {
+		return err
+	} else if accountID != nil {
+		e.AccountID = accountID
+	}
+	if e.Category == current.Category && sameAccount(e.AccountID, current.AccountID) {
+		return nil
+	}
+	return app.bulkUpdateExpense(tx, userID, current, e, now)
+}
+
+// stillExists returns id if the row is still in table, nil otherwise.
+func stillExists(q rowQuerier, table string, id *int) (*int, error) {
+	if id == nil {
+		return nil, nil
+	}
+	var found int
+	err := q.QueryRow("SELECT id FROM "+table+" WHERE id = ?", *id).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUndoOperations(t *testing.T) {
+	useTestDB(t)
+
+	bank := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: "Bank", Type: "bank", Balance: 500}))
+	create := func(e Expense) Expense {
+		t.Helper()
+		e.Date = time.Now().UTC()
+		e.AccountID = &bank.ID
+		rr := callAuthed(http.MethodPost, "/expenses", e)
+		expectStatus(t, rr, http.StatusCreated)
+		return decodeBody[Expense](t, rr)
+	}
+	balance := func() float64 {
+		t.Helper()
+		return decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", bank.ID), nil)).Balance
+	}
+	recent := func() []Operation {
+		t.Helper()
+		return decodeBody[[]Operation](t, callAuthed(http.MethodGet, "/operations?recent=true", nil))
+	}
+	undo := func(id, status int) {
+		t.Helper()
+		expectStatus(t, callAuthed(http.MethodPost, fmt.Sprintf("/operations/%d/undo", id), nil), status)
+	}
+
+	// A single delete comes back with its ID and splits.
+	split := create(Expense{Amount: 50, Category: "Shop", Note: "receipt", Splits: []ExpenseSplit{{Category: "Food", Amount: 30}, {Category: "Home", Amount: 20}}})
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/expenses/%d", split.ID), nil), http.StatusNoContent)
+	ops := recent()
+	if len(ops) != 1 || ops[0].Kind != operationDeleteExpense || ops[0].Count != 1 || !ops[0].Undoable {
+		t.Fatalf("expected the delete to be undoable, got %+v", ops)
+	}
+	undo(ops[0].ID, http.StatusOK)
+	restored := decodeBody[Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", split.ID), nil))
+	if restored.Note != "receipt" || len(restored.Splits) != 2 || *restored.AccountID != bank.ID || !restored.CreatedAt.Equal(split.CreatedAt) {
+		t.Fatalf("expected the expense restored as it was, got %+v", restored)
+	}
+	if balance() != 450 {
+		t.Fatalf("expected a single delete and its undo to leave the balance, got %v", balance())
+	}
+	undo(ops[0].ID, http.StatusGone)
+	if len(recent()) != 0 {
+		t.Fatal("expected an undone operation to drop out of the recent list")
+	}
+
+	// A bulk delete gives the amounts back, and undoing it takes them again.
+	a, b := create(Expense{Amount: 10, Category: "Imported"}), create(Expense{Amount: 20, Category: "Imported"})
+	resp := decodeBody[BulkExpenseResponse](t, callAuthed(http.MethodPost, "/expenses/bulk", BulkExpenseRequest{IDs: []int{a.ID, b.ID}, Action: "delete"}))
+	if balance() != 450 || resp.OperationID == 0 {
+		t.Fatalf("expected the bulk delete refunded and recorded, got balance %v and %+v", balance(), resp)
+	}
+	undo(resp.OperationID, http.StatusOK)
+	if balance() != 420 {
+		t.Fatalf("expected the undo to debit the account again, got %v", balance())
+	}
+	expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", b.ID), nil), http.StatusOK)
+
+	// Recategorizing is reverted.
+	resp = decodeBody[BulkExpenseResponse](t, callAuthed(http.MethodPost, "/expenses/bulk", BulkExpenseRequest{IDs: []int{a.ID, b.ID}, Action: "set_category", Value: []byte(`"Groceries"`)}))
+	undo(resp.OperationID, http.StatusOK)
+	if e := decodeBody[Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", a.ID), nil)); e.Category != "Imported" {
+		t.Fatalf("expected the category reverted, got %q", e.Category)
+	}
+
+	// Applying rules is reverted.
+	expectStatus(t, callAuthed(http.MethodPost, "/rules", CategoryRule{MatchField: "note", MatchType: "contains", Pattern: "coffee", Category: "Cafe"}), http.StatusCreated)
+	coffee := create(Expense{Amount: 4, Note: "coffee"})
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", coffee.ID), Expense{Amount: 4, Category: "Uncategorized", Note: "coffee", Date: coffee.Date}), http.StatusOK)
+	applied := decodeBody[applyRulesResult](t, callAuthed(http.MethodPost, "/rules/apply", nil))
+	if applied.Updated != 1 || applied.OperationID == 0 {
+		t.Fatalf("expected the rule applied and recorded, got %+v", applied)
+	}
+	undo(applied.OperationID, http.StatusOK)
+	if e := decodeBody[Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", coffee.ID), nil)); e.Category != "Uncategorized" {
+		t.Fatalf("expected the rule's change reverted, got %q", e.Category)
+	}
+
+	// Past the window the operation is gone, though still listed.
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/expenses/%d", a.ID), nil), http.StatusNoContent)
+	stale := recent()[0]
+	if _, err := testApp.db.Exec("UPDATE operations SET created_at = ? WHERE id = ?", time.Now().UTC().Add(-undoWindow-time.Minute).Format(timeFormat), stale.ID); err != nil {
+		t.Fatal(err)
+	}
+	undo(stale.ID, http.StatusGone)
+	all := decodeBody[[]Operation](t, callAuthed(http.MethodGet, "/operations", nil))
+	if len(all) != 5 || all[0].ID != stale.ID || all[0].Undoable {
+		t.Fatalf("expected the expired operation listed but not undoable, got %+v", all)
+	}
+	undo(999999, http.StatusNotFound)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// overdraftError is the body of a 422 for an expense that would take a
+// strict account below zero. Shortfall is how much more the account would
+// need to cover it.
+type overdraftError struct {
+	apiError
+	AccountID int     `json:"account_id"`
+	Balance   float64 `json:"balance"`
+	Shortfall float64 `json:"shortfall"`
+}
+
+func writeOverdraftError(w http.ResponseWriter, e *overdraftError) {
+	writeJSONError(w, http.StatusUnprocessableEntity, e)
+}
+
+// errAccountNotFound is returned by debitAccount for an account the user
+// cannot see, such as one deleted since the request was checked.
+var errAccountNotFound = errors.New("account not found")
+
+// debitAccount takes amount from the balance of accountID, if set, like
+// adjustAccountBalance with -amount, unless the account disallows a negative
+// balance and amount is more than it holds. Then nothing is written and the
+// refusal is returned instead. An account the user cannot see is
+// errAccountNotFound.
+//
+// The check is part of the store's DebitBalance, so two expenses racing for
+// the same balance cannot both pass it.
+func (app *App) debitAccount(tx txQuerier, userID int, accountID *int, amount float64, now string) (*overdraftError, error) {
+	if accountID == nil {
+		return nil, nil
+	}
+	store := app.store(tx)
+	if debited, err := store.DebitBalance(userID, *accountID, amount, now); err != nil {
+		return nil, err
+	} else if debited {
+		return nil, recordBalance(tx, userID, *accountID, -amount, balanceReasonExpense, now)
+	}
+
+	account, err := store.FetchAccount(userID, *accountID)
+	if err == sql.ErrNoRows {
+		return nil, errAccountNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	shortfall := roundCents(amount - account.Balance)
+	return &overdraftError{
+		apiError:  apiError{Error: fmt.Sprintf("Insufficient funds: the account is %.2f short", shortfall), Code: "insufficient_funds"},
+		AccountID: *accountID,
+		Balance:   account.Balance,
+		Shortfall: shortfall,
+	}, nil
+}
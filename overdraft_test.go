@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOverdraftProtection(t *testing.T) {
+	useTestDB(t)
+
+	strict := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Savings", Type: "bank", Balance: 100, AllowNegative: boolPtr(false)}))
+	card := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Visa", Type: "credit_card"}))
+	if card.AllowNegative == nil || !*card.AllowNegative {
+		t.Fatalf("expected accounts to allow negative balances by default, got %+v", card)
+	}
+
+	spend := func(accountID int, amount float64) *httptest.ResponseRecorder {
+		return callAuthed(http.MethodPost, "/expenses", Expense{Amount: amount, Category: "Misc", Date: time.Now().UTC(), AccountID: intPtr(accountID)})
+	}
+	balance := func(id int) float64 {
+		return decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", id), nil)).Balance
+	}
+
+	expectStatus(t, spend(strict.ID, 60), http.StatusCreated)
+	rr := spend(strict.ID, 50)
+	expectStatus(t, rr, http.StatusUnprocessableEntity)
+	refused := decodeBody[overdraftError](t, rr)
+	if refused.Code != "insufficient_funds" || refused.AccountID != strict.ID || refused.Balance != 40 || refused.Shortfall != 10 {
+		t.Fatalf("unexpected refusal: %+v", refused)
+	}
+	if got := balance(strict.ID); got != 40 {
+		t.Fatalf("expected the refused expense to leave the balance at 40, got %v", got)
+	}
+	if n := len(decodeBody[[]Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses?account_id=%d", strict.ID), nil))); n != 1 {
+		t.Fatalf("expected the refused expense not to be stored, got %d expenses", n)
+	}
+
+	// Spending the balance exactly is allowed, float noise included.
+	expectStatus(t, spend(strict.ID, 39.9), http.StatusCreated)
+	expectStatus(t, spend(strict.ID, 0.1), http.StatusCreated)
+
+	expectStatus(t, spend(card.ID, 250), http.StatusCreated)
+	if got := balance(card.ID); got != -250 {
+		t.Fatalf("expected the card to go negative, got %v", got)
+	}
+
+	// Updates keep the flag unless it is sent.
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/accounts/%d", strict.ID), Account{Name: "Savings", Type: "bank", Balance: 5}), http.StatusOK)
+	expectStatus(t, spend(strict.ID, 6), http.StatusUnprocessableEntity)
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/accounts/%d", strict.ID), Account{Name: "Savings", Type: "bank", Balance: 5, AllowNegative: boolPtr(true)}), http.StatusOK)
+	expectStatus(t, spend(strict.ID, 6), http.StatusCreated)
+}
+
+func TestOverdraftConcurrentExpenses(t *testing.T) {
+	useTestDB(t)
+
+	strict := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Wallet", Type: "cash", Balance: 100, AllowNegative: boolPtr(false)}))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = callAuthed(http.MethodPost, "/expenses", Expense{Amount: 30, Category: "Misc", AccountID: intPtr(strict.ID)}).Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, code := range codes {
+		if code == http.StatusCreated {
+			created++
+		}
+	}
+	a := decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", strict.ID), nil))
+	if created != 3 || a.Balance != 10 {
+		t.Fatalf("expected exactly 3 expenses to fit in 100, got %d created and balance %v (codes %v)", created, a.Balance, codes)
+	}
+}
+
+func TestDebitAccountNotFound(t *testing.T) {
+	useTestDB(t)
+	cookie, _ := registerUser(t, "other@example.com", "AnotherSecurePass1!")
+	foreign := decodeBody[Account](t, callAuthedAs(cookie, http.MethodPost, "/accounts", Account{Name: "Wallet", Type: "cash", Balance: 50}))
+
+	for _, id := range []int{foreign.ID, foreign.ID + 1000} {
+		tx, err := testApp.db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		refused, err := testApp.debitAccount(tx, testUserID, intPtr(id), 10, time.Now().UTC().Format(timeFormat))
+		tx.Rollback()
+		if !errors.Is(err, errAccountNotFound) || refused != nil {
+			t.Fatalf("account %d: expected errAccountNotFound, got %+v, %v", id, refused, err)
+		}
+	}
+	if got := decodeBody[Account](t, callAuthedAs(cookie, http.MethodGet, fmt.Sprintf("/accounts/%d", foreign.ID), nil)).Balance; got != 50 {
+		t.Fatalf("expected the other user's balance to stay 50, got %v", got)
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Query parameters are checked before they are used: a value that does not
+// parse is a 400 naming the parameter, not a filter quietly ignored or a
+// default quietly applied. A request with strict=true also has parameters
+// its endpoint does not know rejected, so a typo such as ?categroy= is not
+// mistaken for no filter at all.
+
+const (
+	defaultPageLimit = 10
+	// defaultShortListLimit is the page size of lists most users keep
+	// short, such as accounts, so one page usually holds all of them.
+	defaultShortListLimit = 50
+	maxPageLimit          = 100
+)
+
+var pageParamNames = []string{"limit", "offset"}
+
+// checkKnownParams writes a 400 naming the first parameter not in known, or
+// strict itself, when the request sets strict=true.
+func checkKnownParams(w http.ResponseWriter, params url.Values, known ...string) bool {
+	strict, ok := parseBoolParam(w, params, "strict")
+	if !ok || !strict {
+		return ok
+	}
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		if name != "strict" && !slices.Contains(known, name) {
+			http.Error(w, fmt.Sprintf("Unknown query parameter %q", name), http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// parseBoolParam reads an optional true/false parameter, false when absent.
+func parseBoolParam(w http.ResponseWriter, params url.Values, name string) (bool, bool) {
+	raw := strings.TrimSpace(params.Get(name))
+	if raw == "" {
+		return false, true
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		http.Error(w, "Invalid "+name+"; use true or false", http.StatusBadRequest)
+		return false, false
+	}
+	return v, true
+}
+
+// parseFloatParam reads an optional number parameter, nil when absent.
+func parseFloatParam(w http.ResponseWriter, params url.Values, name string) (*float64, bool) {
+	raw := strings.TrimSpace(params.Get(name))
+	if raw == "" {
+		return nil, true
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		http.Error(w, "Invalid "+name+"; use a number", http.StatusBadRequest)
+		return nil, false
+	}
+	return &v, true
+}
+
+// parseIntParam reads an optional whole number from 1 to limit, def when
+// absent.
+func parseIntParam(w http.ResponseWriter, params url.Values, name string, def, limit int) (int, bool) {
+	raw := strings.TrimSpace(params.Get(name))
+	if raw == "" {
+		return def, true
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 || v > limit {
+		http.Error(w, fmt.Sprintf("Invalid %s; use a whole number from 1 to %d", name, limit), http.StatusBadRequest)
+		return 0, false
+	}
+	return v, true
+}
+
+// parseEnumParam reads an optional parameter that must be one of allowed,
+// "" when absent.
+func parseEnumParam(w http.ResponseWriter, params url.Values, name string, allowed ...string) (string, bool) {
+	raw := strings.TrimSpace(params.Get(name))
+	if raw == "" || slices.Contains(allowed, raw) {
+		return raw, true
+	}
+	http.Error(w, "Invalid "+name+"; use one of "+strings.Join(allowed, ", "), http.StatusBadRequest)
+	return "", false
+}
+
+// parsePagination reads limit (default defaultPageLimit, capped at
+// maxPageLimit) and offset (default 0).
+func parsePagination(w http.ResponseWriter, params url.Values) (limit, offset int, ok bool) {
+	return parsePaginationDefault(w, params, defaultPageLimit)
+}
+
+// parsePaginationDefault is parsePagination with another default limit.
+func parsePaginationDefault(w http.ResponseWriter, params url.Values, defaultLimit int) (limit, offset int, ok bool) {
+	limit, offset = defaultLimit, 0
+	if raw := strings.TrimSpace(params.Get("limit")); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			http.Error(w, "Invalid limit; use a positive whole number", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		limit = min(v, maxPageLimit)
+	}
+	if raw := strings.TrimSpace(params.Get("offset")); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			http.Error(w, "Invalid offset; use zero or a positive whole number", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		offset = v
+	}
+	return limit, offset, true
+}
+
+// parseSortParam reads the sort parameter, a key of columns with an
+// optional leading "-" for descending order, and returns the ORDER BY
+// clause for it, or for def when absent. id breaks ties so pages are
+// stable.
+func parseSortParam(w http.ResponseWriter, params url.Values, columns map[string]string, def string) (string, bool) {
+	raw := strings.TrimSpace(params.Get("sort"))
+	if raw == "" {
+		raw = def
+	}
+	key, desc := strings.CutPrefix(raw, "-")
+	column, ok := columns[key]
+	if !ok {
+		http.Error(w, "Invalid sort; use one of "+strings.Join(slices.Sorted(maps.Keys(columns)), ", ")+", optionally prefixed with -", http.StatusBadRequest)
+		return "", false
+	}
+	if desc {
+		return " ORDER BY " + column + " DESC, id DESC", true
+	}
+	return " ORDER BY " + column + ", id", true
+}
+
+// writeTotalCount sets X-Total-Count to the number of rows matching from, a
+// FROM clause with its conditions, so clients paging through a list know
+// when they have it all. It writes a 500 on failure.
+func writeTotalCount(w http.ResponseWriter, q rowQuerier, from string, args []interface{}) bool {
+	var total int
+	if err := q.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		log.Printf("total count query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	return true
+}
+
+// amountRangeFilter applies the amount_min and amount_max parameters of a
+// list request.
+func amountRangeFilter(w http.ResponseWriter, params url.Values) (string, []interface{}, bool) {
+	var clause string
+	var args []interface{}
+	for _, bound := range []struct{ param, cond string }{{"amount_min", " AND amount >= ?"}, {"amount_max", " AND amount <= ?"}} {
+		v, ok := parseFloatParam(w, params, bound.param)
+		if !ok {
+			return "", nil, false
+		}
+		if v != nil {
+			clause += bound.cond
+			args = append(args, *v)
+		}
+	}
+	return clause, args, true
+}
+
+// defaultAmountTolerance is how far either side of amount_near an amount
+// may be, as a fraction of amount_near, when amount_tolerance is not given.
+const defaultAmountTolerance = 0.005
+
+// amountSlack widens amount_near's bounds by a tenth of a cent, so float
+// error in them cannot drop an amount that lies right on one. Amounts are
+// whole cents, so it never lets in one that lies outside.
+const amountSlack = 0.001
+
+// amountNearFilter applies amount_near, matching amounts within
+// amount_tolerance of it, 0.5% of amount_near by default.
+func amountNearFilter(w http.ResponseWriter, params url.Values) (string, []interface{}, bool) {
+	near, ok := parseFloatParam(w, params, "amount_near")
+	if !ok {
+		return "", nil, false
+	}
+	tolerance, ok := parseFloatParam(w, params, "amount_tolerance")
+	if !ok {
+		return "", nil, false
+	}
+	if tolerance != nil && *tolerance < 0 {
+		http.Error(w, "Invalid amount_tolerance; use zero or a positive number", http.StatusBadRequest)
+		return "", nil, false
+	}
+	if near == nil {
+		if tolerance != nil {
+			http.Error(w, "Invalid amount_tolerance; it needs amount_near", http.StatusBadRequest)
+			return "", nil, false
+		}
+		return "", nil, true
+	}
+	within := math.Abs(*near) * defaultAmountTolerance
+	if tolerance != nil {
+		within = *tolerance
+	}
+	return " AND amount BETWEEN ? AND ?", []interface{}{*near - within - amountSlack, *near + within + amountSlack}, true
+}
+
+// sqlFilter collects the conditions a list request's parameters add to the
+// WHERE clause of its query, with their arguments in placeholder order.
+type sqlFilter struct {
+	clause string
+	args   []interface{}
+}
+
+// and adds cond, whose placeholders take args.
+func (f *sqlFilter) and(cond string, args ...interface{}) {
+	f.clause += " AND " + cond
+	f.args = append(f.args, args...)
+}
+
+// add adds a clause from one of the filter helpers, such as
+// amountRangeFilter, which starts with its own " AND".
+func (f *sqlFilter) add(clause string, args []interface{}) {
+	f.clause += clause
+	f.args = append(f.args, args...)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryParamValidation(t *testing.T) {
+	useTestDB(t)
+
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 25, Category: "Food", Date: time.Now().UTC(), AccountID: testAccount()}), http.StatusCreated)
+
+	for target, param := range map[string]string{
+		"/expenses?amount_min=abc":                                       "amount_min",
+		"/expenses?amount_max=NaN":                                       "amount_max",
+		"/expenses?limit=abc":                                            "limit",
+		"/expenses?limit=0":                                              "limit",
+		"/expenses?offset=-1":                                            "offset",
+		"/expenses?uncategorized=yes":                                    "uncategorized",
+		"/expenses?date_from=yesterday":                                  "date_from",
+		"/incomes?amount_min=1e":                                         "amount_min",
+		"/reports/income-vs-expense?fill=maybe":                          "fill",
+		"/reports/income-vs-expense?group_by=day":                        "group_by",
+		"/expenses/aggregates?query=totals_by_day":                       "query",
+		"/audit-log?limit=ten":                                           "limit",
+		"/expenses?categroy=Food&strict=true":                            "categroy",
+		"/incomes?amount=5&strict=1":                                     "amount",
+		"/reports/insights?periods=week&strict=true":                     "periods",
+		"/reports/hygiene?verbose=true&strict=true":                      "verbose",
+		"/expenses/aggregates?query=totals_by_month&extra=1&strict=true": "extra",
+		"/expenses?strict=sometimes":                                     "strict",
+		"/expenses?amount_near=about45":                                  "amount_near",
+		"/expenses?amount_near=45&amount_tolerance=-1":                   "amount_tolerance",
+		"/expenses?amount_tolerance=2":                                   "amount_tolerance",
+	} {
+		rr := callAuthed(http.MethodGet, target, nil)
+		expectStatus(t, rr, http.StatusBadRequest)
+		if !strings.Contains(rr.Body.String(), param) {
+			t.Errorf("%s: expected the error to name %s, got %q", target, param, rr.Body.String())
+		}
+	}
+
+	// Valid values still work, unknown parameters are ignored unless strict
+	// is set, and limits over the maximum are capped rather than refused.
+	for _, target := range []string{
+		"/expenses?amount_min=10.5&amount_max=100&uncategorized=false&limit=500&offset=0",
+		"/expenses?categroy=Food",
+		"/expenses?category=Food&strict=true",
+		"/reports/income-vs-expense?fill=true&strict=true",
+	} {
+		expectStatus(t, callAuthed(http.MethodGet, target, nil), http.StatusOK)
+	}
+	if n := len(decodeBody[[]Expense](t, callAuthed(http.MethodGet, "/expenses?amount_min=25&amount_max=25", nil))); n != 1 {
+		t.Fatalf("expected amount bounds to be inclusive, got %d expenses", n)
+	}
+}
+
+func TestExpenseListFilter(t *testing.T) {
+	useTestDB(t)
+	food, foodArgs := categoryMatchClause([]string{"Food"})
+	for _, tc := range []struct {
+		query  string
+		clause string
+		args   []interface{}
+	}{
+		{"", "", nil},
+		{"q=lunch", " AND LOWER(note) LIKE LOWER(?)", []interface{}{"%lunch%"}},
+		{"amount_near=45&amount_tolerance=2", " AND amount BETWEEN ? AND ?", []interface{}{43 - amountSlack, 47 + amountSlack}},
+		{"amount_near=200", " AND amount BETWEEN ? AND ?", []interface{}{199 - amountSlack, 201 + amountSlack}},
+		// Conditions come in a fixed order whatever the order of the
+		// parameters, with their arguments in step.
+		{"q=lunch&amount_near=45&amount_tolerance=0&category=Food&amount_min=40",
+			" AND " + food + " AND amount >= ? AND amount BETWEEN ? AND ? AND LOWER(note) LIKE LOWER(?)",
+			append(append([]interface{}{}, foodArgs...), 40.0, 45-amountSlack, 45+amountSlack, "%lunch%")},
+		{"exclude_category=Food&uncategorized=true", " AND NOT " + food + " AND " + uncategorizedClause, append(append([]interface{}{}, foodArgs...), uncategorizedCategory)},
+	} {
+		params, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		filter, ok := testApp.expenseListFilter(rr, params, testUserID)
+		if !ok {
+			t.Fatalf("%s: unexpected error %q", tc.query, rr.Body.String())
+		}
+		if filter.clause != tc.clause || !reflect.DeepEqual(filter.args, tc.args) {
+			t.Errorf("%s: got %q %v, want %q %v", tc.query, filter.clause, filter.args, tc.clause, tc.args)
+		}
+		if strings.Count(filter.clause, "?") != len(filter.args) {
+			t.Errorf("%s: %d placeholders for %d arguments", tc.query, strings.Count(filter.clause, "?"), len(filter.args))
+		}
+	}
+}
+
+func TestAmountNear(t *testing.T) {
+	useTestDB(t)
+	for _, e := range []Expense{
+		{Amount: 42.99, Category: "Food"},
+		{Amount: 43, Category: "Food"},
+		{Amount: 45.2, Category: "Food"},
+		{Amount: 45, Category: "Travel"},
+		{Amount: 47, Category: "Food", Date: time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)},
+		{Amount: 47.01, Category: "Food"},
+		{Amount: 10.3, Category: "Food"},
+	} {
+		e.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+	// amounts lists the amounts target returns, smallest first.
+	amounts := func(target string) string {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, target, nil)
+		expectStatus(t, rr, http.StatusOK)
+		var got []float64
+		for _, e := range decodeBody[[]Expense](t, rr) {
+			got = append(got, e.Amount)
+		}
+		slices.Sort(got)
+		return fmt.Sprint(got)
+	}
+
+	for target, want := range map[string]string{
+		"/expenses?amount_near=45&amount_tolerance=2&limit=100":                               "[43 45 45.2 47]",
+		"/expenses?amount_near=45&amount_tolerance=2&category=Food&limit=100":                 "[43 45.2 47]",
+		"/expenses?amount_near=45&amount_tolerance=2&date_from=2024-01-01&date_to=2024-01-31": "[47]",
+		// 0.5% of 45.2 is 0.226.
+		"/expenses?amount_near=45.2":                          "[45 45.2]",
+		"/expenses?amount_near=45.2&amount_tolerance=0":       "[45.2]",
+		"/expenses?amount_near=10.2&amount_tolerance=0.1":     "[10.3]",
+		"/expenses?amount_near=45&amount_tolerance=2&cursor=": "[43 45 45.2 47]",
+	} {
+		if got := amounts(target); got != want {
+			t.Errorf("%s: got %s, want %s", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type PayeeSuggestion struct {
+	Payee string `json:"payee"`
+	Count int    `json:"count"`
+}
+
+// normalizePayee trims the payee and maps blank values to nil so "no payee"
+// is always stored as NULL.
+func normalizePayee(payee *string) *string {
+	if payee == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*payee)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// payeesHandler serves autocomplete suggestions: distinct payees the user
+// has recorded, matched and grouped case-insensitively and ranked by how
+// often they were used.
+func (app *App) payeesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	limit, offset, ok := parsePagination(w, params)
+	if !ok {
+		return
+	}
+	q := strings.ToLower(strings.TrimSpace(params.Get("q")))
+
+	rows, err := app.requestDB(r).Query(`
+        SELECT MIN(payee), COUNT(*) AS uses
+        FROM expenses
+        WHERE `+householdScope+` AND payee IS NOT NULL AND LOWER(payee) LIKE ?
+        GROUP BY LOWER(payee)
+        ORDER BY uses DESC, LOWER(payee)
+        LIMIT ? OFFSET ?`, userID, userID, "%"+q+"%", limit, offset)
+	if err != nil {
+		log.Printf("payee query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	suggestions := []PayeeSuggestion{}
+	for rows.Next() {
+		var s PayeeSuggestion
+		if err := rows.Scan(&s.Payee, &s.Count); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONList(w, suggestions)
+}
+
+func getTotalsByPayee(w http.ResponseWriter, q rowsQuerier, userID int) {
+	rows, err := q.Query("SELECT MIN(payee), SUM(amount) AS total FROM expenses WHERE user_id = ? AND payee IS NOT NULL GROUP BY LOWER(payee) ORDER BY LOWER(payee)", userID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	results := map[string]float64{}
+	for rows.Next() {
+		var payee string
+		var total float64
+		if err := rows.Scan(&payee, &total); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		results[payee] = total
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
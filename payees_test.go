@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func strPtr(v string) *string {
+	return &v
+}
+
+func TestPayeeAutocompleteAndTotals(t *testing.T) {
+	useTestDB(t)
+
+	payees := []string{"Starbucks", "  starbucks ", "STARBUCKS", "Star Market", "Costco"}
+	for _, payee := range payees {
+		e := Expense{Amount: 5, Category: "Food", Payee: strPtr(payee), Date: time.Now().UTC(), AccountID: testAccount()}
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+	blank := Expense{Amount: 1, Category: "Food", Payee: strPtr("   "), Date: time.Now().UTC(), AccountID: testAccount()}
+	createRR := callAuthed(http.MethodPost, "/expenses", blank)
+	expectStatus(t, createRR, http.StatusCreated)
+	if created := decodeBody[Expense](t, createRR); created.Payee != nil {
+		t.Fatalf("expected blank payee to be stored as null, got %q", *created.Payee)
+	}
+
+	rr := callAuthed(http.MethodGet, "/payees?q=STAR", nil)
+	expectStatus(t, rr, http.StatusOK)
+	suggestions := decodeBody[[]PayeeSuggestion](t, rr)
+	if len(suggestions) != 2 {
+		t.Fatalf("expected 2 suggestions, got %+v", suggestions)
+	}
+	if suggestions[0].Count != 3 || suggestions[1].Payee != "Star Market" {
+		t.Fatalf("expected suggestions ranked by frequency, got %+v", suggestions)
+	}
+
+	totalsRR := callAuthed(http.MethodGet, "/expenses/aggregates?query=totals_by_payee", nil)
+	expectStatus(t, totalsRR, http.StatusOK)
+	totals := decodeBody[map[string]float64](t, totalsRR)
+	if len(totals) != 3 || totals["Costco"] != 5 {
+		t.Fatalf("unexpected payee totals: %v", totals)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Every statement goes through a wrapper around the database driver, so
+// whichever code path runs it:
+//
+//   - a read (SELECT or WITH) still running after Config.QueryTimeout is
+//     cancelled and fails with errQueryTimeout;
+//   - a statement that spent longer than Config.SlowQueryThreshold in the
+//     database
+//     is logged with its SQL text and duration. The text is the query as
+//     written, with ? placeholders; arguments are never logged.
+//
+// A request whose query timed out is answered with a JSON 504 instead of
+// the handler's 500, as long as the query ran under the request's context,
+// as the queries of requestDB do.
+
+// The limits belong to the connections openDatabase makes for a Config,
+// so each App's database keeps its own.
+
+// queryLimits are Config.QueryTimeout and Config.SlowQueryThreshold; 0
+// turns either off.
+type queryLimits struct {
+	timeout       time.Duration
+	slowThreshold time.Duration
+}
+
+func (c Config) queryLimits() queryLimits {
+	return queryLimits{timeout: c.QueryTimeout, slowThreshold: c.SlowQueryThreshold}
+}
+
+// slowQueryLogLimit caps how many slow or timed-out queries are logged a
+// minute, so a struggling database does not flood the log as well; the
+// rest are only counted.
+const slowQueryLogLimit = 10
+
+// maxLoggedQueryLength is where logged SQL text is cut off.
+const maxLoggedQueryLength = 500
+
+var errQueryTimeout = errors.New("query timed out")
+
+// sqliteDriver is the SQLite driver openDatabase puts under the timing
+// wrapper. It is a variable so tests can put a driver of their own there.
+var sqliteDriver driver.Driver = &sqlite3.SQLiteDriver{}
+
+// requestDB is the app's database running its queries under r's context:
+// one that times out turns the request's 500 into a 504, and one still
+// running when the client goes away is cancelled.
+func (app *App) requestDB(r *http.Request) querier {
+	return contextDB{app.dbtx, r.Context()}
+}
+
+type queryTimeoutKey struct{}
+
+// withQueryTimeouts answers a request with a JSON 504 when one of its
+// queries ran into its timeout and the handler gave up with a 500.
+func withQueryTimeouts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timedOut := new(atomic.Bool)
+		tw := &queryTimeoutWriter{ResponseWriter: w, timedOut: timedOut}
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), queryTimeoutKey{}, timedOut)))
+	})
+}
+
+// queryTimeoutWriter swaps a 500 for the 504 once a query has timed out,
+// dropping the handler's own error body.
+type queryTimeoutWriter struct {
+	http.ResponseWriter
+	timedOut *atomic.Bool
+	replaced bool
+}
+
+func (w *queryTimeoutWriter) WriteHeader(status int) {
+	if status != http.StatusInternalServerError || !w.timedOut.Load() {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.replaced = true
+	w.Header().Del("Content-Length")
+	writeAPIError(w.ResponseWriter, http.StatusGatewayTimeout, "query_timeout", "The database took too long to answer; try again or narrow the request")
+}
+
+func (w *queryTimeoutWriter) Write(p []byte) (int, error) {
+	if w.replaced {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *queryTimeoutWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *queryTimeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// queryLog logs slow and timed-out queries, at most slowQueryLogLimit a
+// minute. Those over the limit are counted and the count is logged when
+// the next minute starts.
+type queryLog struct {
+	mu         sync.Mutex
+	window     time.Time
+	logged     int
+	suppressed int
+	now        func() time.Time
+	logf       func(format string, args ...interface{})
+}
+
+func newQueryLog() *queryLog {
+	return &queryLog{now: time.Now, logf: log.Printf}
+}
+
+var slowQueries = newQueryLog()
+
+func (l *queryLog) log(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.window) >= time.Minute {
+		if l.suppressed > 0 {
+			l.logf("%d more slow queries were not logged", l.suppressed)
+		}
+		l.window, l.logged, l.suppressed = now, 0, 0
+	}
+	if l.logged >= slowQueryLogLimit {
+		l.suppressed++
+		return
+	}
+	l.logged++
+	l.logf(format, args...)
+}
+
+// loggedQuery is query on one line and cut to maxLoggedQueryLength.
+func loggedQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxLoggedQueryLength {
+		query = query[:maxLoggedQueryLength] + "..."
+	}
+	return query
+}
+
+func isReadQuery(query string) bool {
+	query = strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(query, "SELECT") || strings.HasPrefix(query, "WITH")
+}
+
+// timedQuery is one statement being run and the time it has spent in the
+// driver so far; for a query, until its rows are closed. A read gets a
+// context of its own, cancelled once that time reaches the timeout. Only
+// time in the driver counts, so a large export streamed to a slow client
+// is not cut off.
+type timedQuery struct {
+	query    string
+	limits   queryLimits
+	parent   context.Context
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	spent    time.Duration
+	timedOut bool
+	done     bool
+}
+
+func startQuery(ctx context.Context, query string, limits queryLimits) *timedQuery {
+	t := &timedQuery{query: query, limits: limits, parent: ctx, ctx: ctx}
+	if limits.timeout > 0 && isReadQuery(query) {
+		t.ctx, t.cancel = context.WithCancelCause(ctx)
+	}
+	return t
+}
+
+// run makes one call into the driver for the query, cancelling it if the
+// call takes the query past its timeout.
+func (t *timedQuery) run(call func() error) error {
+	if t.cancel != nil {
+		timer := time.AfterFunc(t.limits.timeout-t.spent, func() { t.cancel(errQueryTimeout) })
+		defer timer.Stop()
+	}
+	start := time.Now()
+	err := call()
+	t.spent += time.Since(start)
+	return t.check(err)
+}
+
+// check turns an error caused by the query's deadline into errQueryTimeout,
+// marking the request it ran for.
+func (t *timedQuery) check(err error) error {
+	if err == nil || err == io.EOF || err == driver.ErrSkip {
+		return err
+	}
+	if context.Cause(t.ctx) != errQueryTimeout || t.parent.Err() != nil {
+		return err
+	}
+	t.timedOut = true
+	if timedOut, ok := t.parent.Value(queryTimeoutKey{}).(*atomic.Bool); ok {
+		timedOut.Store(true)
+	}
+	return fmt.Errorf("%w after %s", errQueryTimeout, t.limits.timeout)
+}
+
+// finish releases the query's context and logs the query if it timed out
+// or was slow.
+func (t *timedQuery) finish() {
+	if t.done {
+		return
+	}
+	t.done = true
+	if t.cancel != nil {
+		t.cancel(nil)
+	}
+	switch {
+	case t.timedOut:
+		slowQueries.log("query timed out after %s: %s", t.limits.timeout, loggedQuery(t.query))
+	case t.limits.slowThreshold > 0 && t.spent >= t.limits.slowThreshold:
+		slowQueries.log("slow query (%s): %s", t.spent.Round(time.Microsecond), loggedQuery(t.query))
+	}
+}
+
+// timedConnector opens connections to name through driver with timeouts
+// and slow query logging.
+type timedConnector struct {
+	driver driver.Driver
+	name   string
+	limits queryLimits
+}
+
+func (c timedConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.name)
+	if err != nil {
+		return nil, err
+	}
+	return timedConn{conn, c.limits}, nil
+}
+
+func (c timedConnector) Driver() driver.Driver { return c.driver }
+
+type timedConn struct {
+	driver.Conn
+	limits queryLimits
+}
+
+func (c timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return timedQueryRows(ctx, query, c.limits, func(ctx context.Context) (driver.Rows, error) {
+		return q.QueryContext(ctx, query, args)
+	})
+}
+
+func (c timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return timedExec(ctx, query, c.limits, func(ctx context.Context) (driver.Result, error) {
+		return e.ExecContext(ctx, query, args)
+	})
+}
+
+func (c timedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return timedStmt{stmt, query, c.limits}, nil
+}
+
+func (c timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c timedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return v.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c timedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c timedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c timedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+type timedStmt struct {
+	driver.Stmt
+	query  string
+	limits queryLimits
+}
+
+func (s timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return timedQueryRows(ctx, s.query, s.limits, func(ctx context.Context) (driver.Rows, error) {
+		if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+			return q.QueryContext(ctx, args)
+		}
+		values, err := namedValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Stmt.Query(values)
+	})
+}
+
+func (s timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return timedExec(ctx, s.query, s.limits, func(ctx context.Context) (driver.Result, error) {
+		if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+			return e.ExecContext(ctx, args)
+		}
+		values, err := namedValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Stmt.Exec(values)
+	})
+}
+
+// namedValues is args for a statement that only takes positional values.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("named arguments are not supported")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+func timedQueryRows(ctx context.Context, query string, limits queryLimits, run func(context.Context) (driver.Rows, error)) (driver.Rows, error) {
+	t := startQuery(ctx, query, limits)
+	var rows driver.Rows
+	err := t.run(func() (err error) {
+		rows, err = run(t.ctx)
+		return err
+	})
+	if err != nil {
+		t.finish()
+		return nil, err
+	}
+	return &timedRows{Rows: rows, query: t}, nil
+}
+
+func timedExec(ctx context.Context, query string, limits queryLimits, run func(context.Context) (driver.Result, error)) (driver.Result, error) {
+	t := startQuery(ctx, query, limits)
+	var res driver.Result
+	err := t.run(func() (err error) {
+		res, err = run(t.ctx)
+		return err
+	})
+	t.finish()
+	return res, err
+}
+
+// timedRows is a query's rows, which SQLite produces as they are read, so
+// the query's time runs until they are closed.
+type timedRows struct {
+	driver.Rows
+	query *timedQuery
+}
+
+func (r *timedRows) Next(dest []driver.Value) error {
+	return r.query.run(func() error { return r.Rows.Next(dest) })
+}
+
+func (r *timedRows) Close() error {
+	err := r.query.run(r.Rows.Close)
+	r.query.finish()
+	return err
+}
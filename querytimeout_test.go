@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// slowDriver makes queries containing slowQueryMatch take slowQueryDelay,
+// ending early when their context does, as a database busy with them would.
+type slowDriver struct {
+	driver.Driver
+}
+
+var (
+	slowQueryMatch string
+	slowQueryDelay time.Duration
+)
+
+func (d slowDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return slowConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type slowConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c slowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if slowQueryMatch != "" && strings.Contains(query, slowQueryMatch) {
+		select {
+		case <-time.After(slowQueryDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return c.SQLiteConn.QueryContext(ctx, query, args)
+}
+
+// useSlowTestDB is useTestDB on an in-memory database behind slowDriver,
+// with queries timing out and logged as slow as cfg says, capturing what
+// the slow query log writes.
+func useSlowTestDB(t *testing.T, cfg Config) *[]string {
+	t.Helper()
+	prevLog := slowQueries
+	var logged []string
+	slowQueries = newQueryLog()
+	slowQueries.logf = func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	t.Cleanup(func() {
+		slowQueries = prevLog
+		slowQueryMatch, slowQueryDelay = "", 0
+	})
+	defer func(d driver.Driver) { sqliteDriver = d }(sqliteDriver)
+	sqliteDriver = slowDriver{&sqlite3.SQLiteDriver{}}
+	cfg.DBDriver, cfg.DBPath = dbDriverMemory, ""
+	useTestDBConfig(t, cfg)
+	return &logged
+}
+
+func TestQueryTimeout(t *testing.T) {
+	cfg := testConfig()
+	cfg.QueryTimeout = 50 * time.Millisecond
+	logged := useSlowTestDB(t, cfg)
+	for i := 0; i < 3; i++ {
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 10, Category: "Food", AccountID: testAccount()}), http.StatusCreated)
+	}
+	slowQueryMatch, slowQueryDelay = "FROM expenses WHERE", time.Second
+
+	start := time.Now()
+	rr := callAuthed(http.MethodGet, "/expenses?q=lunch", nil)
+	expectStatus(t, rr, http.StatusGatewayTimeout)
+	if body := decodeBody[apiError](t, rr); body.Code != "query_timeout" {
+		t.Fatalf("expected a query_timeout error, got %+v", body)
+	}
+	if elapsed := time.Since(start); elapsed >= slowQueryDelay {
+		t.Fatalf("expected the query to be cancelled at the timeout, took %s", elapsed)
+	}
+	if len(*logged) != 1 || !strings.HasPrefix((*logged)[0], "query timed out after 50ms: SELECT id, amount") {
+		t.Fatalf("expected the timed-out query to be logged, got %q", *logged)
+	}
+
+	// Only time spent in the database counts, so rows read slowly do not
+	// time out.
+	slowQueryMatch = ""
+	rows, err := testApp.db.Query("SELECT id FROM expenses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+		time.Sleep(30 * time.Millisecond)
+	}
+	if err := rows.Err(); err != nil || n != 3 {
+		t.Fatalf("expected all 3 rows to be read, got %d and %v", n, err)
+	}
+	rows.Close()
+
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses", nil), http.StatusOK)
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	cfg := testConfig()
+	cfg.SlowQueryThreshold = 20 * time.Millisecond
+	logged := useSlowTestDB(t, cfg)
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 10, Category: "Food", Note: "lunch", AccountID: testAccount()}), http.StatusCreated)
+	*logged = nil
+	slowQueryMatch, slowQueryDelay = "FROM expenses WHERE", 30*time.Millisecond
+
+	rr := callAuthed(http.MethodGet, "/expenses?q=lunch", nil)
+	if page := decodeBody[[]Expense](t, rr); len(page) != 1 {
+		t.Fatalf("expected the slow query to still answer, got %+v", page)
+	}
+	if len(*logged) != 1 {
+		t.Fatalf("expected one slow query to be logged, got %q", *logged)
+	}
+	// The text is logged without the arguments.
+	if line := (*logged)[0]; !strings.HasPrefix(line, "slow query (") || !strings.Contains(line, "LIKE LOWER(?)") || strings.Contains(line, "lunch") {
+		t.Fatalf("expected the parameterized SQL, got %q", line)
+	}
+}
+
+func TestSlowQueryLogRateLimit(t *testing.T) {
+	l := newQueryLog()
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	var logged []string
+	l.logf = func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+
+	for i := 0; i < slowQueryLogLimit+5; i++ {
+		l.log("slow query %d", i)
+	}
+	if len(logged) != slowQueryLogLimit {
+		t.Fatalf("expected %d lines in the first minute, got %d", slowQueryLogLimit, len(logged))
+	}
+	now = now.Add(time.Minute)
+	l.log("slow query again")
+	if got := logged[slowQueryLogLimit:]; len(got) != 2 || got[0] != "5 more slow queries were not logged" || got[1] != "slow query again" {
+		t.Fatalf("expected the skipped count and then the next query, got %q", got)
+	}
+}
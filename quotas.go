@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Quotas cap how many expenses and accounts each user may store, so one
+// user cannot fill a shared server. A limit of 0, the default, means no
+// limit. Users an admin has exempted are never limited.
+//
+// Usage is counted with COUNT(*) over the user_id index at the moment of
+// each create. Two creates racing for the last slot may both pass; the
+// quotas are guardrails, not accounting.
+
+const (
+	quotaExpenses = "expenses"
+	quotaAccounts = "accounts"
+
+	quotaErrorExceeded = "quota_exceeded"
+)
+
+// quotaLimit is the limit on resource, 0 for none.
+func (app *App) quotaLimit(resource string) int {
+	switch resource {
+	case quotaExpenses:
+		return app.cfg.MaxExpensesPerUser
+	case quotaAccounts:
+		return app.cfg.MaxAccountsPerUser
+	}
+	return 0
+}
+
+type quotaError struct {
+	apiError
+	Resource string `json:"resource"`
+	Limit    int    `json:"limit"`
+	Used     int    `json:"used"`
+}
+
+// QuotaUsage is how much of one quota a user has used. Limit and Remaining
+// are null when the user is not limited.
+type QuotaUsage struct {
+	Used      int  `json:"used"`
+	Limit     *int `json:"limit"`
+	Remaining *int `json:"remaining"`
+}
+
+// UserLimits is the body of GET /limits.
+type UserLimits struct {
+	Exempt   bool       `json:"exempt"`
+	Expenses QuotaUsage `json:"expenses"`
+	Accounts QuotaUsage `json:"accounts"`
+}
+
+func (app *App) migrateQuotas() error {
+	return app.ensureColumn("users", "quota_exempt", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// checkQuota writes a 403 stating the limit and returns false when adding
+// more of resource would take userID over its quota. The count is read
+// through q so an import sees its own transaction.
+func (app *App) checkQuota(w http.ResponseWriter, q rowQuerier, userID int, resource string, adding int) bool {
+	limit := app.quotaLimit(resource)
+	if limit == 0 {
+		return true
+	}
+	var exempt bool
+	var used int
+	err := q.QueryRow("SELECT quota_exempt, (SELECT COUNT(*) FROM "+resource+" WHERE user_id = ?) FROM users WHERE id = ?", userID, userID).Scan(&exempt, &used)
+	if err != nil {
+		log.Printf("%s quota check error: %v", resource, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if exempt || used+adding <= limit {
+		return true
+	}
+	writeJSONError(w, http.StatusForbidden, quotaError{
+		apiError: apiError{Error: fmt.Sprintf("At most %d %s are allowed per user; %d are in use", limit, resource, used), Code: quotaErrorExceeded},
+		Resource: resource,
+		Limit:    limit,
+		Used:     used,
+	})
+	return false
+}
+
+// limitsHandler serves GET /limits: the user's usage against each quota,
+// so clients can warn before a create is refused.
+func (app *App) limitsHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	var limits UserLimits
+	err := app.requestDB(r).QueryRow("SELECT quota_exempt, (SELECT COUNT(*) FROM expenses WHERE user_id = ?), (SELECT COUNT(*) FROM accounts WHERE user_id = ?) FROM users WHERE id = ?", userID, userID, userID).
+		Scan(&limits.Exempt, &limits.Expenses.Used, &limits.Accounts.Used)
+	if err != nil {
+		log.Printf("limits query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for resource, usage := range map[string]*QuotaUsage{quotaExpenses: &limits.Expenses, quotaAccounts: &limits.Accounts} {
+		if limit := app.quotaLimit(resource); limit > 0 && !limits.Exempt {
+			remaining := max(limit-usage.Used, 0)
+			usage.Limit, usage.Remaining = &limit, &remaining
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+// quotaExemptionHandler serves the admin routes that exempt a user from
+// quotas (PUT) and lift the exemption (DELETE).
+func (app *App) quotaExemptionHandler(exempt bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || userID <= 0 {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		res, err := app.db.Exec("UPDATE users SET quota_exempt = ? WHERE id = ?", exempt, userID)
+		if err != nil {
+			log.Printf("quota exemption error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("user %d quota exemption set to %t by admin from %s", userID, exempt, app.clientIP(r))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQuotas(t *testing.T) {
+	useTestDB(t)
+	// Unlimited by default.
+	limits := decodeBody[UserLimits](t, callAuthed(http.MethodGet, "/limits", nil))
+	if limits.Exempt || limits.Expenses.Limit != nil || limits.Accounts.Limit != nil || limits.Accounts.Used != 1 {
+		t.Fatalf("expected no limits by default, got %+v", limits)
+	}
+
+	testApp.cfg.MaxExpensesPerUser, testApp.cfg.MaxAccountsPerUser = 2, 2
+	expense := Expense{Amount: 5, Category: "Food", AccountID: testAccount()}
+	for i := 0; i < 2; i++ {
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", expense), http.StatusCreated)
+	}
+	rr := callAuthed(http.MethodPost, "/expenses", expense)
+	expectStatus(t, rr, http.StatusForbidden)
+	if e := decodeBody[quotaError](t, rr); e.Code != quotaErrorExceeded || e.Resource != quotaExpenses || e.Limit != 2 || e.Used != 2 {
+		t.Fatalf("unexpected quota error: %+v", e)
+	}
+
+	expectStatus(t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Savings", Type: "bank"}), http.StatusCreated)
+	expectStatus(t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Card", Type: "credit_card"}), http.StatusForbidden)
+
+	limits = decodeBody[UserLimits](t, callAuthed(http.MethodGet, "/limits", nil))
+	if limits.Expenses.Used != 2 || *limits.Expenses.Limit != 2 || *limits.Expenses.Remaining != 0 || limits.Accounts.Used != 2 || *limits.Accounts.Remaining != 0 {
+		t.Fatalf("unexpected usage: %+v", limits)
+	}
+
+	// An import counts everything it would add.
+	doc := exportDocument{SchemaVersion: exportSchemaVersion, Expenses: []Expense{{Amount: 1, Category: "Food", Date: expense.Date}}}
+	expectStatus(t, callAuthed(http.MethodPost, "/import?merge=true", doc), http.StatusForbidden)
+
+	// Other users have their own count.
+	cookie, _ := registerUser(t, "quota@example.com", "QuotaUserPass123!")
+	expectStatus(t, callAuthedAs(cookie, http.MethodPost, "/accounts", Account{Name: "Wallet", Type: "cash"}), http.StatusCreated)
+
+	// An admin can exempt a user, and take the exemption back.
+	testApp.cfg.AdminToken = "quota-secret"
+	admin := func(method string, userID int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, fmt.Sprintf("/admin/users/%d/quota-exemption", userID), nil)
+		req.Header.Set("Authorization", "Bearer "+testApp.cfg.AdminToken)
+		return serve(req)
+	}
+	expectStatus(t, admin(http.MethodPut, 9999), http.StatusNotFound)
+	expectStatus(t, admin(http.MethodPut, testUserID), http.StatusNoContent)
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", expense), http.StatusCreated)
+	limits = decodeBody[UserLimits](t, callAuthed(http.MethodGet, "/limits", nil))
+	if !limits.Exempt || limits.Expenses.Used != 3 || limits.Expenses.Limit != nil {
+		t.Fatalf("expected an exempt user unlimited, got %+v", limits)
+	}
+	expectStatus(t, admin(http.MethodDelete, testUserID), http.StatusNoContent)
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", expense), http.StatusForbidden)
+}
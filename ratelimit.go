@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Authenticated requests are rate limited per user with a token bucket
+// holding Config.RateLimit tokens and refilling at that many a minute, so
+// a client can burst up to the limit and then keeps going at the refill
+// rate. The buckets live in memory: a restart forgets them, and each
+// server process counts on its own.
+
+// rateLimitSweepInterval is how often buckets idle long enough to be full
+// again are dropped.
+const rateLimitSweepInterval = time.Minute
+
+type rateLimitError struct {
+	apiError
+	RetryAfter int `json:"retry_after_seconds"`
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[int]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[int]*tokenBucket{}, now: time.Now}
+}
+
+// rateLimitState is a bucket as reported to the client after a request.
+type rateLimitState struct {
+	allowed   bool
+	remaining int
+	// reset is how long until the bucket is full again; retryAfter, for a
+	// refused request, until the next token.
+	reset, retryAfter time.Duration
+}
+
+// take spends a token from userID's bucket of size limit if it has one.
+func (l *rateLimiter) take(userID, limit int) rateLimitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	perSecond := float64(limit) / 60
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now, limit, perSecond)
+	}
+
+	b, ok := l.buckets[userID]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit), updated: now}
+		l.buckets[userID] = b
+	}
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+	b.updated = now
+
+	var state rateLimitState
+	if b.tokens >= 1 {
+		b.tokens--
+		state.allowed = true
+	} else {
+		state.retryAfter = secondsDuration((1 - b.tokens) / perSecond)
+	}
+	state.remaining = int(b.tokens)
+	state.reset = secondsDuration((float64(limit) - b.tokens) / perSecond)
+	return state
+}
+
+// sweep drops the buckets that have refilled completely, which are no
+// different from a new one.
+func (l *rateLimiter) sweep(now time.Time, limit int, perSecond float64) {
+	for userID, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*perSecond >= float64(limit) {
+			delete(l.buckets, userID)
+		}
+	}
+	l.lastSweep = now
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// allowRequest applies the rate limit for userID, setting the
+// X-RateLimit-Limit, X-RateLimit-Remaining, and X-RateLimit-Reset (seconds
+// until the bucket is full) headers. When the bucket is empty it answers
+// 429 with Retry-After and returns false.
+func (app *App) allowRequest(w http.ResponseWriter, userID int) bool {
+	limit := app.cfg.RateLimit
+	if limit <= 0 {
+		return true
+	}
+	state := app.rateLimiter.take(userID, limit)
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(state.remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(state.reset.Seconds()))))
+	if state.allowed {
+		return true
+	}
+	seconds := int(math.Ceil(state.retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeJSONError(w, http.StatusTooManyRequests, rateLimitError{
+		apiError:   apiError{Error: fmt.Sprintf("Rate limit of %d requests a minute exceeded; try again in %ds", limit, seconds), Code: "rate_limited"},
+		RetryAfter: seconds,
+	})
+	return false
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	useTestDB(t)
+	testApp.cfg.RateLimit = 3
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	testApp.rateLimiter.now = func() time.Time { return now }
+
+	expectHeaders := func(rr *httptest.ResponseRecorder, remaining, reset string) {
+		t.Helper()
+		got := [3]string{rr.Header().Get("X-RateLimit-Limit"), rr.Header().Get("X-RateLimit-Remaining"), rr.Header().Get("X-RateLimit-Reset")}
+		if want := [3]string{"3", remaining, reset}; got != want {
+			t.Fatalf("unexpected rate limit headers: got %v want %v", got, want)
+		}
+	}
+
+	// A token comes back every 20 seconds.
+	for _, want := range []struct{ remaining, reset string }{{"2", "20"}, {"1", "40"}, {"0", "60"}} {
+		rr := callAuthed(http.MethodGet, "/accounts", nil)
+		expectStatus(t, rr, http.StatusOK)
+		expectHeaders(rr, want.remaining, want.reset)
+	}
+	rr := callAuthed(http.MethodGet, "/accounts", nil)
+	expectStatus(t, rr, http.StatusTooManyRequests)
+	expectHeaders(rr, "0", "60")
+	if got := rr.Header().Get("Retry-After"); got != "20" {
+		t.Fatalf("expected Retry-After 20, got %q", got)
+	}
+	if e := decodeBody[rateLimitError](t, rr); e.Code != "rate_limited" || e.RetryAfter != 20 {
+		t.Fatalf("unexpected rate limit error: %+v", e)
+	}
+
+	// Part way to the next token the wait shrinks.
+	now = now.Add(15 * time.Second)
+	rr = callAuthed(http.MethodGet, "/accounts", nil)
+	expectStatus(t, rr, http.StatusTooManyRequests)
+	expectHeaders(rr, "0", "45")
+	if got := rr.Header().Get("Retry-After"); got != "5" {
+		t.Fatalf("expected Retry-After 5, got %q", got)
+	}
+
+	// The health check is never limited, even with a session cookie.
+	rr = serve(authedRequest(http.MethodGet, healthPath, nil))
+	expectStatus(t, rr, http.StatusOK)
+	if got := rr.Header().Get("X-RateLimit-Limit"); got != "" {
+		t.Fatalf("expected no rate limit headers on the health check, got %q", got)
+	}
+
+	now = now.Add(5 * time.Second)
+	rr = callAuthed(http.MethodGet, "/accounts", nil)
+	expectStatus(t, rr, http.StatusOK)
+	expectHeaders(rr, "0", "60")
+
+	// Other users have their own bucket.
+	cookie, _ := registerUser(t, "ratelimit@example.com", "RateLimitPass123!")
+	rr = callAuthedAs(cookie, http.MethodGet, "/accounts", nil)
+	expectStatus(t, rr, http.StatusOK)
+	expectHeaders(rr, "2", "20")
+
+	// Once the reset has passed the full allowance is back.
+	now = now.Add(time.Minute)
+	rr = callAuthed(http.MethodGet, "/accounts", nil)
+	expectStatus(t, rr, http.StatusOK)
+	expectHeaders(rr, "2", "20")
+
+	// Routes without a session are not limited.
+	rr = serve(httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	expectStatus(t, rr, http.StatusOK)
+	if got := rr.Header().Get("X-RateLimit-Limit"); got != "" {
+		t.Fatalf("expected no rate limit headers without a session, got %q", got)
+	}
+
+	testApp.cfg.RateLimit = 0
+	rr = callAuthed(http.MethodGet, "/accounts", nil)
+	expectStatus(t, rr, http.StatusOK)
+	if got := rr.Header().Get("X-RateLimit-Limit"); got != "" {
+		t.Fatalf("expected no rate limit headers when limiting is off, got %q", got)
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+	l.take(1, 60)
+	now = now.Add(30 * time.Second)
+	for i := 0; i < 50; i++ {
+		l.take(2, 60)
+	}
+
+	// A minute on, user 1 has refilled and is dropped; user 2 has not.
+	now = now.Add(40 * time.Second)
+	l.take(3, 60)
+	if _, ok := l.buckets[1]; ok {
+		t.Fatal("expected the full bucket to be swept")
+	}
+	if _, ok := l.buckets[2]; !ok {
+		t.Fatal("expected the draining bucket to be kept")
+	}
+}
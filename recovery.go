@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// maxRequestIDLength bounds a client-supplied X-Request-ID.
+const maxRequestIDLength = 64
+
+type requestIDKey struct{}
+
+// withRequestID tags each request with an ID, echoed in the X-Request-ID
+// response header and logged with anything that goes wrong serving it. An
+// ID sent by the client or a proxy is kept when it is short and plain;
+// otherwise a new one is generated.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID is the ID withRequestID gave r, or "-" outside it.
+func requestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+type panicError struct {
+	apiError
+	RequestID string `json:"request_id"`
+}
+
+// withRecovery turns a panicking handler into a logged stack trace and a
+// JSON 500 carrying the request ID, instead of the empty reply net/http
+// would give. If the handler had already started its response, the status
+// cannot change, so the connection is aborted to show the body is cut short.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			id := requestID(r)
+			log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, id, rec, debug.Stack())
+			if rw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Del("Content-Disposition")
+			writeJSONError(w, http.StatusInternalServerError, panicError{apiError: apiError{Error: "Internal server error", Code: "internal_error"}, RequestID: id})
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recoveryWriter records whether the response has started.
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoveryWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoveryWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *recoveryWriter) Flush() {
+	w.wroteHeader = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *recoveryWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// runJob runs one background job, logging a panic instead of letting it
+// take down the ticker loop and with it every later run.
+func runJob(name string, job func()) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("panic in %s job: %v\n%s", name, rec, debug.Stack())
+		}
+	}()
+	job()
+}
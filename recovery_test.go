@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoveryReturnsJSON500(t *testing.T) {
+	panicking := withRequestID(withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="x.csv"`)
+		var m map[string]int
+		m["boom"]++
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	rr := httptest.NewRecorder()
+	panicking.ServeHTTP(rr, req)
+	expectStatus(t, rr, http.StatusInternalServerError)
+	body := decodeBody[panicError](t, rr)
+	if body.RequestID != "req-123" || rr.Header().Get("X-Request-ID") != "req-123" || body.Error == "" || body.Code != "internal_error" {
+		t.Fatalf("expected a JSON error carrying the request ID, got %+v", body)
+	}
+	if rr.Header().Get("Content-Disposition") != "" {
+		t.Fatal("expected the handler's download header dropped")
+	}
+
+	// A forged or oversized ID is replaced.
+	req = httptest.NewRequest(http.MethodGet, "/boom", nil)
+	req.Header.Set("X-Request-ID", "bad id\r\n")
+	rr = httptest.NewRecorder()
+	panicking.ServeHTTP(rr, req)
+	if id := decodeBody[panicError](t, rr).RequestID; id == "bad id\r\n" || !validRequestID(id) {
+		t.Fatalf("expected a generated request ID, got %q", id)
+	}
+
+	// Once the response has started the connection is aborted instead.
+	started := withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("late")
+	}))
+	func() {
+		defer func() {
+			if rec := recover(); rec != http.ErrAbortHandler {
+				t.Fatalf("expected ErrAbortHandler, got %v", rec)
+			}
+		}()
+		started.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/late", nil))
+	}()
+
+	// The router carries a request ID on every response.
+	useTestDB(t)
+	if id := callAuthed(http.MethodGet, "/expenses", nil).Header().Get("X-Request-ID"); id == "" {
+		t.Fatal("expected X-Request-ID on routed responses")
+	}
+}
+
+func TestRunJobSurvivesPanic(t *testing.T) {
+	ran := 0
+	for i := 0; i < 2; i++ {
+		runJob("test", func() {
+			ran++
+			panic("job failed")
+		})
+	}
+	if ran != 2 {
+		t.Fatalf("expected the job to run again after panicking, ran %d times", ran)
+	}
+}
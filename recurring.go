@@ -0,0 +1,464 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUpcomingDays = 30
+	maxUpcomingDays     = 366
+	maxInterval         = 36
+)
+
+type UpcomingOccurrence struct {
+	RecurringExpenseID int       `json:"recurring_expense_id"`
+	Date               time.Time `json:"date"`
+	Amount             float64   `json:"amount"`
+	Category           string    `json:"category"`
+	Note               string    `json:"note"`
+}
+
+type UpcomingRecurringExpenses struct {
+	From        time.Time            `json:"from"`
+	To          time.Time            `json:"to"`
+	Occurrences []UpcomingOccurrence `json:"occurrences"`
+	Total       float64              `json:"total"`
+}
+
+// normalizeInterval defaults a missing interval to 1 and reports whether
+// the result is within the supported range.
+func normalizeInterval(interval int) (int, bool) {
+	if interval == 0 {
+		interval = 1
+	}
+	return interval, interval >= 1 && interval <= maxInterval
+}
+
+// nextOccurrence returns the due date that follows t for a schedule of
+// every interval freq units, e.g. ("weekly", 2) for biweekly. Unknown
+// frequencies advance daily and an interval below 1 counts as 1. Monthly
+// and yearly steps land on anchorDay clamped to the target month's length,
+// so an item anchored on the 31st goes Jan 31 -> Feb 28 -> Mar 31 rather
+// than losing its day after the first short month. An anchorDay of 0 uses
+// t's day.
+func nextOccurrence(freq string, interval int, t time.Time, anchorDay int) time.Time {
+	if interval < 1 {
+		interval = 1
+	}
+	if anchorDay <= 0 {
+		anchorDay = t.Day()
+	}
+	switch strings.ToLower(freq) {
+	case "daily":
+		return t.AddDate(0, 0, interval)
+	case "weekly":
+		return t.AddDate(0, 0, 7*interval)
+	case "monthly":
+		return addMonthsAnchored(t, interval, anchorDay)
+	case "yearly":
+		return addMonthsAnchored(t, 12*interval, anchorDay)
+	default:
+		return t.AddDate(0, 0, interval)
+	}
+}
+
+// addMonthsAnchored moves t forward by months and places it on anchorDay,
+// or on the last day of the target month if that month is shorter.
+func addMonthsAnchored(t time.Time, months, anchorDay int) time.Time {
+	firstOfTarget := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := anchorDay
+	if last := daysInMonth(firstOfTarget); day > last {
+		day = last
+	}
+	return firstOfTarget.AddDate(0, 0, day-1)
+}
+
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+// projectOccurrences lists the due dates of re up to and including end,
+// starting from its current next_due_date. Overdue occurrences the
+// processor has not picked up yet are included.
+func projectOccurrences(re RecurringExpense, end time.Time) []time.Time {
+	var dates []time.Time
+	for due := re.NextDueDate; !due.After(end); due = nextOccurrence(re.Frequency, re.Interval, due, re.AnchorDay) {
+		dates = append(dates, due)
+	}
+	return dates
+}
+
+// upcomingRecurringExpensesHandler projects recurring expenses over the next
+// ?days=N days without touching their stored schedule.
+func (app *App) upcomingRecurringExpensesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "days") {
+		return
+	}
+	days, ok := parseIntParam(w, params, "days", defaultUpcomingDays, maxUpcomingDays)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	result := UpcomingRecurringExpenses{From: now, To: now.AddDate(0, 0, days)}
+
+	occurrences, err := projectUpcoming(app.requestDB(r), userID, result.To)
+	if err != nil {
+		log.Printf("upcoming recurring expenses query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	result.Occurrences = occurrences
+	for _, o := range occurrences {
+		result.Total += o.Amount
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// projectUpcoming lists every occurrence of the user's active recurring
+// expenses due by end, soonest first, without touching their stored
+// schedule.
+func projectUpcoming(q rowsQuerier, userID int, end time.Time) ([]UpcomingOccurrence, error) {
+	rows, err := q.Query("SELECT id, amount, category, COALESCE(note, ''), frequency, frequency_interval, next_due_date, COALESCE(anchor_day, 0) FROM recurring_expenses WHERE user_id = ? AND paused = 0 AND next_due_date <= ?", userID, end.Format(timeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occurrences := []UpcomingOccurrence{}
+	for rows.Next() {
+		var re RecurringExpense
+		var nextDueDateStr string
+		if err := rows.Scan(&re.ID, &re.Amount, &re.Category, &re.Note, &re.Frequency, &re.Interval, &nextDueDateStr, &re.AnchorDay); err != nil {
+			return nil, err
+		}
+		if re.NextDueDate, err = parseTimestamp(nextDueDateStr); err != nil {
+			return nil, err
+		}
+		for _, date := range projectOccurrences(re, end) {
+			occurrences = append(occurrences, UpcomingOccurrence{
+				RecurringExpenseID: re.ID,
+				Date:               date,
+				Amount:             re.Amount,
+				Category:           re.Category,
+				Note:               re.Note,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Date.Before(occurrences[j].Date)
+	})
+	return occurrences, nil
+}
+
+// skipRecurringExpense advances next_due_date by one interval without
+// creating an expense for the skipped occurrence.
+func (app *App) skipRecurringExpense(w http.ResponseWriter, r *http.Request, userID, id int) {
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	old, err := fetchRecurringExpense(tx, userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recurring expense not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("recurring expense fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if old.Paused {
+		http.Error(w, "Recurring expense is paused", http.StatusConflict)
+		return
+	}
+
+	re := old
+	re.NextDueDate = nextOccurrence(re.Frequency, old.Interval, old.NextDueDate, old.AnchorDay)
+	re.Timestamps = old.Timestamps.touched(time.Now())
+
+	if _, err := tx.Exec("UPDATE recurring_expenses SET next_due_date = ?, updated_at = ? WHERE id = ? AND user_id = ?", re.NextDueDate.Format(timeFormat), re.UpdatedAt.Format(timeFormat), id, userID); err != nil {
+		log.Printf("recurring expense skip error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(tx, userID, auditEntityRecurringExpense, id, auditActionUpdate, old, re); err != nil {
+		log.Printf("audit log error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(re)
+}
+
+// getRecurringExpenseHistory lists the expenses the processor generated from
+// a recurring expense, newest first.
+func (app *App) getRecurringExpenseHistory(w http.ResponseWriter, r *http.Request, userID, id int) {
+	if _, err := fetchRecurringExpense(app.requestDB(r), userID, id); err == sql.ErrNoRows {
+		http.Error(w, "Recurring expense not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("recurring expense fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	limit, offset, ok := parsePagination(w, r.URL.Query())
+	if !ok {
+		return
+	}
+	expenses, err := loadGeneratedExpenses(app.requestDB(r), userID, id, limit, offset)
+	if err != nil {
+		log.Printf("recurring expense history error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONList(w, expenses)
+}
+
+// loadGeneratedExpenses returns expenses linked to a recurring expense. A
+// negative limit returns all of them.
+func loadGeneratedExpenses(q rowsQuerier, userID, recurringExpenseID, limit, offset int) ([]Expense, error) {
+	rows, err := q.Query("SELECT id, amount, category, COALESCE(note, ''), date FROM expenses WHERE recurring_expense_id = ? AND user_id = ? ORDER BY date DESC, id DESC LIMIT ? OFFSET ?", recurringExpenseID, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expenses := []Expense{}
+	for rows.Next() {
+		var e Expense
+		var dateStr string
+		if err := rows.Scan(&e.ID, &e.Amount, &e.Category, &e.Note, &dateStr); err != nil {
+			return nil, err
+		}
+		if e.Date, err = parseTimestamp(dateStr); err != nil {
+			return nil, err
+		}
+		e.RecurringExpenseID = &recurringExpenseID
+		e.UserID = userID
+		expenses = append(expenses, e)
+	}
+	return expenses, rows.Err()
+}
+
+// deleteGeneratedExpenses deletes every expense generated from a recurring
+// expense, recording an audit entry for each.
+func deleteGeneratedExpenses(tx txQuerier, userID, recurringExpenseID int) error {
+	expenses, err := loadGeneratedExpenses(tx, userID, recurringExpenseID, -1, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range expenses {
+		if _, err := tx.Exec("DELETE FROM expenses WHERE id = ?", e.ID); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, userID, auditEntityExpense, e.ID, auditActionDelete, e, nil); err != nil {
+			return err
+		}
+		if err := recordTombstone(tx, userID, auditEntityExpense, e.ID, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxCatchUpOccurrences bounds how many expenses one recurring item can
+// generate in a single run, e.g. a daily item after a very long downtime.
+const maxCatchUpOccurrences = 1000
+
+type RecurringProcessSummary struct {
+	Processed         int   `json:"processed"`
+	CreatedExpenseIDs []int `json:"created_expense_ids"`
+}
+
+func (app *App) processRecurringExpensesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	summary, err := app.processRecurringExpensesForUser(userID, time.Now().UTC())
+	if err != nil {
+		log.Printf("recurring process error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// processRecurringExpensesForUser generates an expense for every occurrence
+// of the user's unpaused recurring expenses due by now, advancing each item
+// past now, in one transaction. If it fails, nothing is generated and the
+// items stay due.
+func (app *App) processRecurringExpensesForUser(userID int, now time.Time) (RecurringProcessSummary, error) {
+	lock, _ := app.recurringLocks.LoadOrStore(userID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	summary := RecurringProcessSummary{CreatedExpenseIDs: []int{}}
+
+	due, err := app.loadDueRecurringExpenses(userID, now)
+	if err != nil {
+		return summary, err
+	}
+
+	if len(due) == 0 {
+		return summary, nil
+	}
+	generated, err := app.generateRecurringOccurrences(userID, due, now)
+	if err != nil {
+		return summary, err
+	}
+	for _, re := range due {
+		if ids := generated[re.ID]; len(ids) > 0 {
+			summary.Processed++
+			summary.CreatedExpenseIDs = append(summary.CreatedExpenseIDs, ids...)
+		}
+	}
+	return summary, nil
+}
+
+// loadDueRecurringExpenses reads the user's unpaused recurring expenses due
+// by now. The rows are fully read before any are processed so the read does
+// not hold SQLite's lock while the batch commits.
+func (app *App) loadDueRecurringExpenses(userID int, now time.Time) ([]RecurringExpense, error) {
+	rows, err := app.db.Query("SELECT id, user_id, amount, category, COALESCE(note, ''), frequency, frequency_interval, next_due_date, COALESCE(anchor_day, 0) FROM recurring_expenses WHERE user_id = ? AND next_due_date <= ? AND paused = 0", userID, now.Format(timeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []RecurringExpense
+	for rows.Next() {
+		var re RecurringExpense
+		var nextDueDateStr string
+		if err := rows.Scan(&re.ID, &re.UserID, &re.Amount, &re.Category, &re.Note, &re.Frequency, &re.Interval, &nextDueDateStr, &re.AnchorDay); err != nil {
+			return nil, err
+		}
+		if re.NextDueDate, err = parseTimestamp(nextDueDateStr); err != nil {
+			return nil, err
+		}
+		due = append(due, re)
+	}
+	return due, rows.Err()
+}
+
+// generateRecurringOccurrences creates the expenses for every occurrence
+// of the user's due items by now, all in one transaction, and returns their
+// IDs by recurring expense. The insert and the advance of next_due_date are
+// prepared once and reused for every item. An item is only generated if
+// next_due_date still holds the value it was loaded with, so one processed
+// concurrently produces nothing instead of duplicates. Any error rolls back
+// the whole batch, leaving every item due for the next run.
+func (app *App) generateRecurringOccurrences(userID int, due []RecurringExpense, now time.Time) (map[int][]int, error) {
+	tx, err := app.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare("INSERT INTO expenses(amount, category, note, date, user_id, recurring_expense_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?) RETURNING id")
+	if err != nil {
+		return nil, fmt.Errorf("prepare expense insert: %w", err)
+	}
+	defer insert.Close()
+	advance, err := tx.Prepare("UPDATE recurring_expenses SET next_due_date = ?, last_generated_at = ?, generated_count = generated_count + ?, updated_at = ? WHERE id = ? AND next_due_date = ?")
+	if err != nil {
+		return nil, fmt.Errorf("prepare next due date update: %w", err)
+	}
+	defer advance.Close()
+	hooks, err := subscribedWebhooks(tx, userID, webhookEventExpenseCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	// now is the schedule cutoff; the rows' timestamps record the wall clock.
+	stamp := time.Now().UTC().Format(timeFormat)
+	generated := map[int][]int{}
+	for _, re := range due {
+		var dates []time.Time
+		next := re.NextDueDate
+		for !next.After(now) && len(dates) < maxCatchUpOccurrences {
+			dates = append(dates, next)
+			next = nextOccurrence(re.Frequency, re.Interval, next, re.AnchorDay)
+		}
+
+		// Claim the item before generating anything for it.
+		res, err := advance.Exec(next.Format(timeFormat), now.Format(timeFormat), len(dates), stamp, re.ID, re.NextDueDate.Format(timeFormat))
+		if err != nil {
+			return nil, fmt.Errorf("advance recurring expense %d: %w", re.ID, err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			// Already advanced by someone else.
+			continue
+		}
+
+		ids := make([]int, 0, len(dates))
+		for _, date := range dates {
+			var id int
+			if err := insert.QueryRow(re.Amount, re.Category, re.Note, date.Format(timeFormat), re.UserID, re.ID, stamp, stamp).Scan(&id); err != nil {
+				return nil, fmt.Errorf("create expense for recurring expense %d: %w", re.ID, err)
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if err := notifyRecurringGenerated(tx, re, ids); err != nil {
+			return nil, err
+		}
+		if len(hooks) > 0 {
+			for _, id := range ids {
+				e, err := fetchExpense(tx, re.UserID, id)
+				if err != nil {
+					return nil, fmt.Errorf("fetch expense %d: %w", id, err)
+				}
+				if err := queueWebhookDeliveries(tx, hooks, webhookEventExpenseCreated, e); err != nil {
+					return nil, err
+				}
+			}
+		}
+		generated[re.ID] = ids
+	}
+	if len(generated) == 0 {
+		return generated, nil
+	}
+	if err := touchUserData(tx, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	app.wakeWebhookDispatcher()
+	return generated, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Aggregates and reports scan every transaction in range, which gets slow
+// with years of history, and clients ask for the same ones again and again.
+// withReportCache keeps their responses in memory, per user and query, along
+// with the Last-Modified date they were computed at. Any write moves that
+// date on (see lastmodified.go), so an entry is only ever served for the
+// data it was computed from; the TTL covers reports that also depend on the
+// clock, such as forecasts.
+
+const (
+	reportCacheTTL = time.Minute
+	// reportCacheSize bounds the entries kept across all users.
+	reportCacheSize = 1024
+)
+
+// dataVersionKey carries the Last-Modified date withLastModified computed
+// for the request.
+type dataVersionKey struct{}
+
+type reportCacheKey struct {
+	userID int
+	path   string
+	query  string
+}
+
+type reportCacheEntry struct {
+	version  time.Time
+	storedAt time.Time
+	header   http.Header
+	body     []byte
+}
+
+type reportCacheStore struct {
+	mu      sync.Mutex
+	entries map[reportCacheKey]reportCacheEntry
+	now     func() time.Time
+
+	hits, misses atomic.Int64
+}
+
+func newReportCache() *reportCacheStore {
+	return &reportCacheStore{entries: map[reportCacheKey]reportCacheEntry{}, now: time.Now}
+}
+
+// get returns the entry for key if it was computed at version and is still
+// fresh.
+func (c *reportCacheStore) get(key reportCacheKey, version time.Time) (reportCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if ok && (!e.version.Equal(version) || c.now().Sub(e.storedAt) >= reportCacheTTL) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return e, ok
+}
+
+// put stores e under key, making room by dropping expired entries and then
+// the oldest.
+func (c *reportCacheStore) put(key reportCacheKey, e reportCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.storedAt = c.now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= reportCacheSize {
+		var oldest reportCacheKey
+		var oldestAt time.Time
+		for k, old := range c.entries {
+			if e.storedAt.Sub(old.storedAt) >= reportCacheTTL {
+				delete(c.entries, k)
+			} else if oldestAt.IsZero() || old.storedAt.Before(oldestAt) {
+				oldest, oldestAt = k, old.storedAt
+			}
+		}
+		if len(c.entries) >= reportCacheSize {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[key] = e
+}
+
+// cacheWriter holds a response back so it can be cached before it is sent.
+type cacheWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *cacheWriter) Header() http.Header { return w.header }
+
+func (w *cacheWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *cacheWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// withReportCache serves a report from app.reportCache when it has one
+// computed from the current data, and otherwise caches a successful
+// response. It goes inside withLastModified, which supplies the data's
+// version.
+func (app *App) withReportCache(handler authedHandler) authedHandler {
+	return func(w http.ResponseWriter, r *http.Request, userID int) {
+		version, ok := r.Context().Value(dataVersionKey{}).(time.Time)
+		if !ok {
+			handler(w, r, userID)
+			return
+		}
+		key := reportCacheKey{userID: userID, path: r.URL.Path, query: r.URL.Query().Encode()}
+		if e, ok := app.reportCache.get(key, version); ok {
+			writeCachedReport(w, e.header, http.StatusOK, e.body)
+			return
+		}
+
+		buf := &cacheWriter{header: http.Header{}}
+		handler(buf, r, userID)
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+		if buf.status == http.StatusOK {
+			app.reportCache.put(key, reportCacheEntry{version: version, header: buf.header.Clone(), body: bytes.Clone(buf.body.Bytes())})
+		}
+		writeCachedReport(w, buf.header, buf.status, buf.body.Bytes())
+	}
+}
+
+func writeCachedReport(w http.ResponseWriter, header http.Header, status int, body []byte) {
+	for name, values := range header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// withDataVersion records the Last-Modified date for withReportCache.
+func withDataVersion(r *http.Request, version time.Time) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), dataVersionKey{}, version))
+}
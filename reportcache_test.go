@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReportCache(t *testing.T) {
+	useTestDB(t)
+	stats := func() ExpenseStats {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, "/expenses/stats", nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[ExpenseStats](t, rr)
+	}
+
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 10, Category: "Food", AccountID: testAccount()}), http.StatusCreated)
+	if s := stats(); s.Count != 1 {
+		t.Fatalf("expected one expense, got %+v", s)
+	}
+	if s := stats(); s.Count != 1 || testApp.reportCache.hits.Load() != 1 || testApp.reportCache.misses.Load() != 1 {
+		t.Fatalf("expected the second read to be a hit, got %+v with %d hits and %d misses", s, testApp.reportCache.hits.Load(), testApp.reportCache.misses.Load())
+	}
+
+	// A write straight after a cached read shows up on the next read.
+	created := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 5, Category: "Food", AccountID: testAccount()}))
+	if s := stats(); s.Count != 2 || s.Total != 15 {
+		t.Fatalf("expected the new expense in the stats, got %+v", s)
+	}
+	created.Amount = 7
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", created.ID), created), http.StatusOK)
+	if s := stats(); s.Total != 17 {
+		t.Fatalf("expected the update in the stats, got %+v", s)
+	}
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/expenses/%d", created.ID), nil), http.StatusNoContent)
+	if s := stats(); s.Count != 1 || s.Total != 10 {
+		t.Fatalf("expected the delete in the stats, got %+v", s)
+	}
+
+	// Entries are per user and per query.
+	other, _ := registerUser(t, "other@example.com", "OtherSecretPass123!")
+	rr := callAuthedAs(other, http.MethodGet, "/expenses/stats", nil)
+	if s := decodeBody[ExpenseStats](t, rr); s.Count != 0 {
+		t.Fatalf("expected another user's stats to be their own, got %+v", s)
+	}
+	rr = callAuthed(http.MethodGet, "/expenses/stats?date_from=2020-01-01&date_to=2020-01-31", nil)
+	if s := decodeBody[ExpenseStats](t, rr); s.Count != 0 {
+		t.Fatalf("expected the date range to be applied, got %+v", s)
+	}
+
+	// Errors are not cached.
+	misses := testApp.reportCache.misses.Load()
+	for i := 0; i < 2; i++ {
+		expectStatus(t, callAuthed(http.MethodGet, "/expenses/aggregates?query=unknown", nil), http.StatusBadRequest)
+	}
+	if n := testApp.reportCache.misses.Load() - misses; n != 2 {
+		t.Fatalf("expected both bad requests to miss, got %d misses", n)
+	}
+}
+
+func TestReportCacheExpiry(t *testing.T) {
+	c := newReportCache()
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	version := now.Add(-time.Hour)
+	key := reportCacheKey{userID: 1, path: "/expenses/stats"}
+
+	c.put(key, reportCacheEntry{version: version, body: []byte("{}")})
+	if _, ok := c.get(key, version); !ok {
+		t.Fatal("expected a hit")
+	}
+	if _, ok := c.get(key, version.Add(time.Second)); ok {
+		t.Fatal("expected a newer data version to miss")
+	}
+
+	c.put(key, reportCacheEntry{version: version, body: []byte("{}")})
+	now = now.Add(reportCacheTTL)
+	if _, ok := c.get(key, version); ok {
+		t.Fatal("expected the entry to expire after the TTL")
+	}
+
+	for i := 0; i < reportCacheSize+10; i++ {
+		now = now.Add(time.Millisecond)
+		c.put(reportCacheKey{userID: i}, reportCacheEntry{version: version})
+	}
+	if len(c.entries) != reportCacheSize {
+		t.Fatalf("expected the cache to stay at %d entries, got %d", reportCacheSize, len(c.entries))
+	}
+	if _, ok := c.entries[reportCacheKey{userID: 0}]; ok {
+		t.Fatal("expected the oldest entry to be evicted")
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MonthlyReport is one bucket of the income-vs-expense report. Month is
+// only filled in for group_by=month, where it equals Period, so clients
+// written before grouping was configurable keep working.
+type MonthlyReport struct {
+	Period  string  `json:"period"`
+	Month   string  `json:"month,omitempty"`
+	Income  float64 `json:"income"`
+	Expense float64 `json:"expense"`
+	Net     float64 `json:"net"`
+	// Display holds the amounts formatted for the user's locale when the
+	// report is requested with format=display.
+	Display map[string]string `json:"display,omitempty"`
+}
+
+// hygieneSampleSize caps the IDs listed per hygiene bucket.
+const hygieneSampleSize = 10
+
+// HygieneBucket counts rows with one data problem. SampleIDs holds up to
+// hygieneSampleSize of them, newest first, and Link is the list request
+// that returns all of them.
+type HygieneBucket struct {
+	Count     int    `json:"count"`
+	SampleIDs []int  `json:"sample_ids"`
+	Link      string `json:"link"`
+}
+
+type HygieneReport struct {
+	UncategorizedExpenses HygieneBucket `json:"uncategorized_expenses"`
+	UnlinkedExpenses      HygieneBucket `json:"unlinked_expenses"`
+	UnlinkedIncomes       HygieneBucket `json:"unlinked_incomes"`
+	FutureExpenses        HygieneBucket `json:"future_expenses"`
+	FutureIncomes         HygieneBucket `json:"future_incomes"`
+	ZeroAmountExpenses    HygieneBucket `json:"zero_amount_expenses"`
+	ZeroAmountIncomes     HygieneBucket `json:"zero_amount_incomes"`
+}
+
+// maxReportBuckets bounds how many buckets fill=true may produce.
+const maxReportBuckets = 1000
+
+var errTooManyReportBuckets = errors.New("too many report buckets")
+
+// reportPeriod describes one group_by option. start maps a calendar day to
+// the first day of its period; label renders that first day for the
+// response and next steps to the following period.
+type reportPeriod struct {
+	start func(t time.Time) time.Time
+	next  func(start time.Time) time.Time
+	label func(start time.Time) string
+}
+
+var reportPeriods = map[string]reportPeriod{
+	"week": {
+		start: func(t time.Time) time.Time {
+			t = truncateToDay(t)
+			return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+		},
+		next: func(start time.Time) time.Time { return start.AddDate(0, 0, 7) },
+		label: func(start time.Time) string {
+			year, week := start.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		},
+	},
+	"month": {
+		start: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		},
+		next:  func(start time.Time) time.Time { return start.AddDate(0, 1, 0) },
+		label: func(start time.Time) string { return start.Format("2006-01") },
+	},
+	"quarter": {
+		start: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+		},
+		next: func(start time.Time) time.Time { return start.AddDate(0, 3, 0) },
+		label: func(start time.Time) string {
+			return fmt.Sprintf("%d-Q%d", start.Year(), (int(start.Month())+2)/3)
+		},
+	},
+	"year": {
+		start: func(t time.Time) time.Time {
+			return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		},
+		next:  func(start time.Time) time.Time { return start.AddDate(1, 0, 0) },
+		label: func(start time.Time) string { return start.Format("2006") },
+	},
+}
+
+// incomeVsExpenseReportHandler totals incomes and expenses per period
+// (?group_by=week|month|quarter|year, default month), optionally limited to
+// the inclusive date_from/date_to days. With fill=true every period in the
+// range (or between the first and last with data) is returned, zeroed where
+// nothing was recorded. fiscal=true groups quarters and years by the user's
+// fiscal year instead of the calendar one.
+func (app *App) incomeVsExpenseReportHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "group_by", "date_from", "date_to", "fill", "include_opening_balances", "fiscal", "format") {
+		return
+	}
+	fiscal, ok := parseBoolParam(w, params, "fiscal")
+	if !ok {
+		return
+	}
+	fill, ok := parseBoolParam(w, params, "fill")
+	if !ok {
+		return
+	}
+	includeOpening, ok := parseBoolParam(w, params, "include_opening_balances")
+	if !ok {
+		return
+	}
+	money, ok := app.displayFormatter(w, r, userID)
+	if !ok {
+		return
+	}
+
+	groupBy := strings.TrimSpace(params.Get("group_by"))
+	if groupBy == "" {
+		groupBy = "month"
+	}
+	period, ok := reportPeriods[groupBy]
+	if !ok {
+		http.Error(w, "Invalid group_by; use week, month, quarter, or year", http.StatusBadRequest)
+		return
+	}
+	if fiscal {
+		startMonth, ok := app.fiscalYearStart(w, userID)
+		if !ok {
+			return
+		}
+		if period, ok = fiscalReportPeriods(startMonth)[groupBy]; !ok {
+			http.Error(w, "fiscal=true needs group_by quarter or year", http.StatusBadRequest)
+			return
+		}
+	}
+
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	from, ok := parseDayParam(w, params.Get("date_from"), "date_from", time.Time{}, loc)
+	if !ok {
+		return
+	}
+	to, ok := parseDayParam(w, params.Get("date_to"), "date_to", time.Time{}, loc)
+	if !ok {
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		http.Error(w, "date_to must not be before date_from", http.StatusBadRequest)
+		return
+	}
+
+	filter := " WHERE user_id = ?"
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		filter += " AND date >= ?"
+		args = append(args, dayStart(from, loc))
+	}
+	if !to.IsZero() {
+		filter += " AND date < ?"
+		args = append(args, dayStart(to.AddDate(0, 0, 1), loc))
+	}
+
+	// Opening balances are money the user already had, not income earned
+	// in the period, so they are left out unless asked for.
+	incomeFilter := filter
+	if !includeOpening {
+		incomeFilter += " AND opening_balance = 0"
+	}
+
+	reports := make(map[string]*MonthlyReport)
+	for _, source := range []struct {
+		table, filter string
+		add           func(*MonthlyReport, float64)
+	}{
+		{"incomes", incomeFilter, func(m *MonthlyReport, total float64) { m.Income = total }},
+		{"expenses", filter, func(m *MonthlyReport, total float64) { m.Expense = total }},
+	} {
+		days, err := dailyTotals(app.requestDB(r), loc, "SELECT date, amount FROM "+source.table+source.filter, args...)
+		if err != nil {
+			log.Printf("income vs expense %s query error: %v", source.table, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		sumReportBuckets(period, days, reports, source.add)
+	}
+
+	var starts []string
+	for start := range reports {
+		starts = append(starts, start)
+	}
+	sort.Strings(starts)
+
+	if fill && (len(starts) > 0 || (!from.IsZero() && !to.IsZero())) {
+		filled, err := fillReportBuckets(period, starts, from, to)
+		if errors.Is(err, errTooManyReportBuckets) {
+			http.Error(w, fmt.Sprintf("Range spans more than %d periods; narrow it or use a coarser group_by", maxReportBuckets), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("income vs expense fill error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, start := range filled {
+			if _, ok := reports[start]; !ok {
+				reports[start] = &MonthlyReport{}
+			}
+		}
+		starts = filled
+	}
+
+	var result []MonthlyReport
+	for _, start := range starts {
+		report := *reports[start]
+		t, err := time.Parse(statsDateFormat, start)
+		if err != nil {
+			log.Printf("income vs expense bucket parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		report.Period = period.label(t)
+		if groupBy == "month" {
+			report.Month = report.Period
+		}
+		report.Net = roundCents(report.Income - report.Expense)
+		report.Display = money.amounts(map[string]float64{"income": report.Income, "expense": report.Expense, "net": report.Net})
+		result = append(result, report)
+	}
+
+	writeJSONList(w, result)
+}
+
+// fillReportBuckets lists the start of every period from the one containing
+// from (or the first with data) through the one containing to (or the last
+// with data), as YYYY-MM-DD keys in order.
+func fillReportBuckets(period reportPeriod, starts []string, from, to time.Time) ([]string, error) {
+	first, last := from, to
+	if first.IsZero() {
+		t, err := time.Parse(statsDateFormat, starts[0])
+		if err != nil {
+			return nil, err
+		}
+		first = t
+	}
+	if last.IsZero() {
+		t, err := time.Parse(statsDateFormat, starts[len(starts)-1])
+		if err != nil {
+			return nil, err
+		}
+		last = t
+	}
+
+	var filled []string
+	for t := period.start(first); !t.After(last); t = period.next(t) {
+		if len(filled) == maxReportBuckets {
+			return nil, errTooManyReportBuckets
+		}
+		filled = append(filled, t.Format(statsDateFormat))
+	}
+	return filled, nil
+}
+
+// hygieneReportHandler serves GET /reports/hygiene: counts and sample IDs
+// of the transactions the user sees, including their households', that
+// likely need cleaning up, so each count matches what its link lists.
+// Future-dated means dated tomorrow or later in the user's timezone.
+func (app *App) hygieneReportHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	if !checkKnownParams(w, r.URL.Query()) {
+		return
+	}
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	tomorrow := localDay(time.Now(), loc).AddDate(0, 0, 1)
+
+	var report HygieneReport
+	checks := []struct {
+		bucket *HygieneBucket
+		table  string
+		where  string
+		args   []interface{}
+		link   string
+	}{
+		{&report.UncategorizedExpenses, "expenses", uncategorizedClause, []interface{}{uncategorizedCategory}, apiPrefix + "/expenses?uncategorized=true"},
+		{&report.UnlinkedExpenses, "expenses", "account_id IS NULL", nil, apiPrefix + "/expenses?account_id=null"},
+		{&report.UnlinkedIncomes, "incomes", "account_id IS NULL", nil, apiPrefix + "/incomes?account_id=null"},
+		{&report.FutureExpenses, "expenses", "date >= ?", []interface{}{dayStart(tomorrow, loc)}, apiPrefix + "/expenses?date_from=" + tomorrow.Format(statsDateFormat)},
+		{&report.FutureIncomes, "incomes", "date >= ?", []interface{}{dayStart(tomorrow, loc)}, apiPrefix + "/incomes?date_from=" + tomorrow.Format(statsDateFormat)},
+		{&report.ZeroAmountExpenses, "expenses", "amount = 0", nil, apiPrefix + "/expenses?amount_min=0&amount_max=0"},
+		{&report.ZeroAmountIncomes, "incomes", "amount = 0", nil, apiPrefix + "/incomes?amount_min=0&amount_max=0"},
+	}
+	for _, c := range checks {
+		bucket, err := loadHygieneBucket(app.requestDB(r), c.table, c.where, append([]interface{}{userID, userID}, c.args...))
+		if err != nil {
+			log.Printf("hygiene %s query error: %v", c.table, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		bucket.Link = c.link
+		*c.bucket = bucket
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func loadHygieneBucket(q querier, table, where string, args []interface{}) (HygieneBucket, error) {
+	bucket := HygieneBucket{SampleIDs: []int{}}
+	filter := " FROM " + table + " WHERE " + householdScope + " AND " + where
+	if err := q.QueryRow("SELECT COUNT(*)"+filter, args...).Scan(&bucket.Count); err != nil {
+		return bucket, err
+	}
+	if bucket.Count == 0 {
+		return bucket, nil
+	}
+
+	rows, err := q.Query("SELECT id"+filter+" ORDER BY id DESC LIMIT ?", append(args, hygieneSampleSize)...)
+	if err != nil {
+		return bucket, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return bucket, err
+		}
+		bucket.SampleIDs = append(bucket.SampleIDs, id)
+	}
+	return bucket, rows.Err()
+}
+
+// sumReportBuckets totals days per period and records each total with add,
+// creating the bucket if the other table had no rows for it.
+func sumReportBuckets(period reportPeriod, days map[time.Time]float64, reports map[string]*MonthlyReport, add func(*MonthlyReport, float64)) {
+	totals := map[string]float64{}
+	for day, total := range days {
+		totals[period.start(day).Format(statsDateFormat)] += total
+	}
+	for bucket, total := range totals {
+		report, ok := reports[bucket]
+		if !ok {
+			report = &MonthlyReport{}
+			reports[bucket] = report
+		}
+		add(report, roundCents(total))
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncomeVsExpenseReportGrouping(t *testing.T) {
+	useTestDB(t)
+
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 15, 0, 0, 0, time.UTC) }
+	incomes := []Income{
+		{Amount: 100, Source: "Salary", Date: day(2024, 1, 1), AccountID: testAccount()},
+		{Amount: 50, Source: "Refund", Date: day(2024, 4, 15), AccountID: testAccount()},
+	}
+	expenses := []Expense{
+		{Amount: 10, Category: "Party", Date: day(2023, 12, 31), AccountID: testAccount()},
+		{Amount: 30, Category: "Food", Date: day(2024, 1, 7), AccountID: testAccount()},
+		{Amount: 20, Category: "Food", Date: day(2024, 1, 8), AccountID: testAccount()},
+	}
+	for _, i := range incomes {
+		expectStatus(t, callAuthed(http.MethodPost, "/incomes", i), http.StatusCreated)
+	}
+	for _, e := range expenses {
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	cases := []struct {
+		target string
+		want   []MonthlyReport
+	}{
+		{"/reports/income-vs-expense", []MonthlyReport{
+			{Period: "2023-12", Month: "2023-12", Expense: 10, Net: -10},
+			{Period: "2024-01", Month: "2024-01", Income: 100, Expense: 50, Net: 50},
+			{Period: "2024-04", Month: "2024-04", Income: 50, Net: 50},
+		}},
+		{"/reports/income-vs-expense?group_by=week", []MonthlyReport{
+			{Period: "2023-W52", Expense: 10, Net: -10},
+			{Period: "2024-W01", Income: 100, Expense: 30, Net: 70},
+			{Period: "2024-W02", Expense: 20, Net: -20},
+			{Period: "2024-W16", Income: 50, Net: 50},
+		}},
+		{"/reports/income-vs-expense?group_by=quarter", []MonthlyReport{
+			{Period: "2023-Q4", Expense: 10, Net: -10},
+			{Period: "2024-Q1", Income: 100, Expense: 50, Net: 50},
+			{Period: "2024-Q2", Income: 50, Net: 50},
+		}},
+		{"/reports/income-vs-expense?group_by=year&date_from=2024-01-01&date_to=2024-01-07", []MonthlyReport{
+			{Period: "2024", Income: 100, Expense: 30, Net: 70},
+		}},
+	}
+	for _, c := range cases {
+		rr := callAuthed(http.MethodGet, c.target, nil)
+		expectStatus(t, rr, http.StatusOK)
+		got := decodeBody[[]MonthlyReport](t, rr)
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: expected %d buckets, got %+v", c.target, len(c.want), got)
+		}
+		for i := range got {
+			if !reflect.DeepEqual(got[i], c.want[i]) {
+				t.Fatalf("%s: bucket %d: expected %+v, got %+v", c.target, i, c.want[i], got[i])
+			}
+		}
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/income-vs-expense?group_by=fortnight", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/income-vs-expense?date_from=later", nil), http.StatusBadRequest)
+}
+
+func TestIncomeVsExpenseReportFill(t *testing.T) {
+	useTestDB(t)
+
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 300, Source: "Salary", Date: time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC), AccountID: testAccount()}), http.StatusCreated)
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 80, Category: "Rent", Date: time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), AccountID: testAccount()}), http.StatusCreated)
+
+	periodsOf := func(target string) []string {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, target, nil)
+		expectStatus(t, rr, http.StatusOK)
+		var periods []string
+		for _, b := range decodeBody[[]MonthlyReport](t, rr) {
+			periods = append(periods, b.Period)
+			if (b.Period == "2024-02" || b.Period == "2024-03") && (b.Income != 0 || b.Expense != 0 || b.Net != 0) {
+				t.Fatalf("expected filled bucket %s to be zero, got %+v", b.Period, b)
+			}
+		}
+		return periods
+	}
+
+	if got := periodsOf("/reports/income-vs-expense"); len(got) != 2 {
+		t.Fatalf("expected gaps without fill, got %v", got)
+	}
+
+	cases := []struct {
+		target string
+		want   string
+	}{
+		{"/reports/income-vs-expense?fill=true", "[2024-01 2024-02 2024-03 2024-04]"},
+		{"/reports/income-vs-expense?fill=true&date_from=2023-12-15&date_to=2024-05-01", "[2023-12 2024-01 2024-02 2024-03 2024-04 2024-05]"},
+		{"/reports/income-vs-expense?fill=true&group_by=quarter", "[2024-Q1 2024-Q2]"},
+		{"/reports/income-vs-expense?fill=true&group_by=week&date_from=2024-01-20&date_to=2024-02-05", "[2024-W03 2024-W04 2024-W05 2024-W06]"},
+		{"/reports/income-vs-expense?fill=true&date_from=2025-01-01&date_to=2025-02-28", "[2025-01 2025-02]"},
+	}
+	for _, c := range cases {
+		if got := fmt.Sprint(periodsOf(c.target)); got != c.want {
+			t.Fatalf("%s: expected %s, got %s", c.target, c.want, got)
+		}
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/income-vs-expense?fill=true&group_by=week&date_from=2000-01-01&date_to=2030-01-01", nil), http.StatusBadRequest)
+}
+
+func TestHygieneReport(t *testing.T) {
+	useTestDB(t)
+
+	now := time.Now().UTC()
+	// Tomorrow, the furthest ahead a transaction may be dated by default.
+	future := now.AddDate(0, 0, 1)
+	// Transactions need an account, so unlinked ones come from deleting it.
+	closing := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Old Card", Type: "credit_card"}))
+	post := func(e Expense) int {
+		t.Helper()
+		return decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", e)).ID
+	}
+
+	post(Expense{Amount: 5, Category: "Food", Date: now, AccountID: testAccount()})
+	uncategorized := post(Expense{Amount: 5, Date: now, AccountID: testAccount()})
+	blank := post(Expense{Amount: 5, Category: "Food", Date: now, AccountID: testAccount()})
+	if _, err := testApp.db.Exec("UPDATE expenses SET category = '' WHERE id = ?", blank); err != nil {
+		t.Fatalf("blank category: %v", err)
+	}
+	unlinked := post(Expense{Amount: 5, Category: "Food", Date: now, AccountID: &closing.ID})
+	upcoming := post(Expense{Amount: 5, Category: "Rent", Date: future, AccountID: testAccount()})
+	zero := post(Expense{Amount: 0, Category: "Food", Date: now, AccountID: testAccount()})
+
+	unlinkedIncome := decodeBody[Income](t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 10, Source: "Gift", Date: future, AccountID: &closing.ID})).ID
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 10, Source: "Salary", Date: now, AccountID: testAccount()}), http.StatusCreated)
+
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/accounts/%d", closing.ID), nil), http.StatusNoContent)
+
+	// Another user's messy data must not leak into the report.
+	_, otherID := registerUser(t, "other@example.com", "OtherUserPass123!")
+	if _, err := testApp.db.Exec("INSERT INTO expenses(amount, category, note, date, user_id) VALUES(?, ?, ?, ?, ?)", 0, "", "", future.Format(timeFormat), otherID); err != nil {
+		t.Fatalf("seed other user: %v", err)
+	}
+
+	// A household member's shared expense is counted, as it is listed.
+	partnerCookie, _ := registerUser(t, "partner@example.com", "PartnerSecretPass123!")
+	household := decodeBody[Household](t, callAuthed(http.MethodPost, "/households", Household{Name: "Home"}))
+	invite := decodeBody[HouseholdInvite](t, callAuthed(http.MethodPost, fmt.Sprintf("/households/%d/invites", household.ID), nil))
+	expectStatus(t, callAuthedAs(partnerCookie, http.MethodPost, "/invites/accept", acceptInviteRequest{Token: invite.Token}), http.StatusOK)
+	partnerAccount := decodeBody[Account](t, callAuthedAs(partnerCookie, http.MethodPost, "/accounts", Account{Name: "Partner Wallet", Type: "cash"}))
+	shared := decodeBody[Expense](t, callAuthedAs(partnerCookie, http.MethodPost, "/expenses", Expense{Amount: 0, Category: "Food", Date: now, AccountID: &partnerAccount.ID, HouseholdID: &household.ID})).ID
+
+	rr := callAuthed(http.MethodGet, "/reports/hygiene", nil)
+	expectStatus(t, rr, http.StatusOK)
+	report := decodeBody[HygieneReport](t, rr)
+
+	cases := []struct {
+		name   string
+		bucket HygieneBucket
+		want   []int
+	}{
+		{"uncategorized expenses", report.UncategorizedExpenses, []int{blank, uncategorized}},
+		{"unlinked expenses", report.UnlinkedExpenses, []int{unlinked}},
+		{"unlinked incomes", report.UnlinkedIncomes, []int{unlinkedIncome}},
+		{"future expenses", report.FutureExpenses, []int{upcoming}},
+		{"future incomes", report.FutureIncomes, []int{unlinkedIncome}},
+		{"zero-amount expenses", report.ZeroAmountExpenses, []int{shared, zero}},
+		{"zero-amount incomes", report.ZeroAmountIncomes, []int{}},
+	}
+	for _, c := range cases {
+		if c.bucket.Count != len(c.want) || fmt.Sprint(c.bucket.SampleIDs) != fmt.Sprint(c.want) {
+			t.Fatalf("%s: expected IDs %v, got count %d IDs %v", c.name, c.want, c.bucket.Count, c.bucket.SampleIDs)
+		}
+
+		// The drill-down link lists exactly the rows that were counted.
+		var listed []int
+		if strings.HasPrefix(c.bucket.Link, apiPrefix+"/incomes") {
+			for _, i := range decodeBody[[]Income](t, callAuthed(http.MethodGet, c.bucket.Link, nil)) {
+				listed = append(listed, i.ID)
+			}
+		} else {
+			for _, e := range decodeBody[[]Expense](t, callAuthed(http.MethodGet, c.bucket.Link, nil)) {
+				listed = append(listed, e.ID)
+			}
+		}
+		if len(listed) != c.bucket.Count {
+			t.Fatalf("%s: expected %s to list %d rows, got %v", c.name, c.bucket.Link, c.bucket.Count, listed)
+		}
+	}
+}
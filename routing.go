@@ -0,0 +1,233 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// resourceHandler is an authedHandler for routes carrying an {id} wildcard.
+type resourceHandler func(http.ResponseWriter, *http.Request, int, int)
+
+// routes registers every route with a method-specific pattern. The mux
+// answers 405 (with an Allow header) for known paths hit with the wrong
+// method and 404 for anything it does not recognise, both as JSON through
+// withRouteErrors. API routes are
+// registered on their own mux mounted at apiPrefix; withLegacyPaths maps the
+// old unversioned paths onto it. With cfg.WebDir set, withWebUI serves the
+// web UI from the paths the API leaves free. withHealthCheck answers
+// healthPath before any of them.
+func (app *App) routes() http.Handler {
+	v1 := http.NewServeMux()
+
+	v1.HandleFunc("POST /auth/register", app.registerHandler)
+	v1.HandleFunc("POST /auth/login", app.loginHandler)
+	v1.HandleFunc("POST /auth/logout", app.logoutHandler)
+	v1.HandleFunc("DELETE /auth/account", app.withAuth(app.deleteUser))
+
+	v1.HandleFunc("GET /expenses", app.withAuth(app.withLastModified(app.getExpenses)))
+	v1.HandleFunc("POST /expenses", app.withAuth(app.createExpense))
+	v1.HandleFunc("GET /expenses/aggregates", app.withAuth(app.withLastModified(app.withReportCache(app.aggregatesHandler))))
+	v1.HandleFunc("GET /expenses/stats", app.withAuth(app.withLastModified(app.withReportCache(app.expenseStatsHandler))))
+	v1.HandleFunc("GET /expenses/categories", app.withAuth(app.withLastModified(app.expenseCategoriesHandler)))
+	v1.HandleFunc("POST /expenses/bulk", app.withAuth(app.bulkExpensesHandler))
+	v1.HandleFunc("GET /expenses/{id}", app.withAuth(withID("expense", app.getExpense)))
+	v1.HandleFunc("PUT /expenses/{id}", app.withAuth(withID("expense", app.updateExpense)))
+	v1.HandleFunc("DELETE /expenses/{id}", app.withAuth(withID("expense", app.deleteExpense)))
+	v1.HandleFunc("GET /categories/meta", app.withAuth(app.getCategoryMeta))
+	v1.HandleFunc("PUT /categories/meta", app.withAuth(app.putCategoryMeta))
+	v1.HandleFunc("DELETE /categories/meta", app.withAuth(app.deleteCategoryMeta))
+	v1.HandleFunc("GET /payees", app.withAuth(app.withLastModified(app.payeesHandler)))
+
+	v1.HandleFunc("GET /budgets", app.withAuth(app.withLastModified(app.getBudgets)))
+	v1.HandleFunc("POST /budgets", app.withAuth(app.createBudget))
+	v1.HandleFunc("GET /budgets/{id}", app.withAuth(withID("budget", app.getBudget)))
+	v1.HandleFunc("PUT /budgets/{id}", app.withAuth(withID("budget", app.updateBudget)))
+	v1.HandleFunc("DELETE /budgets/{id}", app.withAuth(withID("budget", app.deleteBudget)))
+	v1.HandleFunc("GET /budgets/{id}/progress", app.withAuth(withID("budget", app.getBudgetProgress)))
+	v1.HandleFunc("POST /budgets/{id}/clone", app.withAuth(withID("budget", app.cloneBudget)))
+
+	v1.HandleFunc("GET /recurring-expenses", app.withAuth(app.withLastModified(app.getRecurringExpenses)))
+	v1.HandleFunc("POST /recurring-expenses", app.withAuth(app.createRecurringExpense))
+	v1.HandleFunc("GET /recurring-expenses/upcoming", app.withAuth(app.withLastModified(app.upcomingRecurringExpensesHandler)))
+	v1.HandleFunc("GET /recurring-expenses/calendar.ics", app.calendarFeedHandler)
+	v1.HandleFunc("POST /recurring-expenses/process", app.withAuth(app.processRecurringExpensesHandler))
+	v1.HandleFunc("GET /recurring-expenses/{id}", app.withAuth(withID("recurring expense", app.getRecurringExpense)))
+	v1.HandleFunc("PUT /recurring-expenses/{id}", app.withAuth(withID("recurring expense", app.updateRecurringExpense)))
+	v1.HandleFunc("DELETE /recurring-expenses/{id}", app.withAuth(withID("recurring expense", app.deleteRecurringExpense)))
+	v1.HandleFunc("POST /recurring-expenses/{id}/skip", app.withAuth(withID("recurring expense", app.skipRecurringExpense)))
+	v1.HandleFunc("GET /recurring-expenses/{id}/history", app.withAuth(withID("recurring expense", app.getRecurringExpenseHistory)))
+
+	v1.HandleFunc("GET /incomes", app.withAuth(app.withLastModified(app.getIncomes)))
+	v1.HandleFunc("POST /incomes", app.withAuth(app.createIncome))
+	v1.HandleFunc("GET /incomes/export", app.withAuth(app.incomesExportHandler))
+	v1.HandleFunc("GET /incomes/sources", app.withAuth(app.withLastModified(app.incomeSourcesHandler)))
+	v1.HandleFunc("GET /incomes/{id}", app.withAuth(withID("income", app.getIncome)))
+	v1.HandleFunc("PUT /incomes/{id}", app.withAuth(withID("income", app.updateIncome)))
+	v1.HandleFunc("DELETE /incomes/{id}", app.withAuth(withID("income", app.deleteIncome)))
+	v1.HandleFunc("GET /reports/income-vs-expense", app.withAuth(app.withLastModified(app.withReportCache(app.incomeVsExpenseReportHandler))))
+	v1.HandleFunc("GET /reports/income-sources", app.withAuth(app.withLastModified(app.withReportCache(app.incomeSourcesReportHandler))))
+	v1.HandleFunc("GET /reports/hygiene", app.withAuth(app.withLastModified(app.withReportCache(app.hygieneReportHandler))))
+	v1.HandleFunc("GET /reports/insights", app.withAuth(app.withLastModified(app.withReportCache(app.insightsHandler))))
+	v1.HandleFunc("GET /reports/trend", app.withAuth(app.withLastModified(app.withReportCache(app.trendHandler))))
+	v1.HandleFunc("GET /reports/savings-rate", app.withAuth(app.withLastModified(app.withReportCache(app.savingsRateHandler))))
+	v1.HandleFunc("GET /reports/year", app.withAuth(app.withLastModified(app.withReportCache(app.yearReviewHandler))))
+	v1.HandleFunc("GET /reports/forecast", app.withAuth(app.withLastModified(app.withReportCache(app.forecastHandler))))
+	v1.HandleFunc("GET /dashboard", app.withAuth(app.withLastModified(app.withReportCache(app.dashboardHandler))))
+	v1.HandleFunc("GET /activity", app.withAuth(app.withLastModified(app.activityHandler)))
+	v1.HandleFunc("GET /transactions/export", app.withAuth(app.transactionsExportHandler))
+
+	v1.HandleFunc("GET /accounts", app.withAuth(app.withLastModified(app.getAccounts)))
+	v1.HandleFunc("POST /accounts", app.withAuth(app.createAccount))
+	v1.HandleFunc("GET /accounts/types", app.withAuth(accountTypesHandler))
+	v1.HandleFunc("GET /accounts/{id}", app.withAuth(withID("account", app.getAccount)))
+	v1.HandleFunc("PUT /accounts/{id}", app.withAuth(withID("account", app.updateAccount)))
+	v1.HandleFunc("DELETE /accounts/{id}", app.withAuth(withID("account", app.deleteAccount)))
+	v1.HandleFunc("GET /accounts/{id}/history", app.withAuth(withID("account", app.balanceHistoryHandler)))
+	v1.HandleFunc("POST /accounts/{id}/adjust", app.withAuth(withID("account", app.adjustAccountHandler)))
+
+	v1.HandleFunc("GET /audit-log", app.withAuth(app.auditLogHandler))
+
+	v1.HandleFunc("GET /notifications", app.withAuth(app.getNotifications))
+	v1.HandleFunc("POST /notifications/read-all", app.withAuth(app.markAllNotificationsRead))
+	v1.HandleFunc("POST /notifications/{id}/read", app.withAuth(withID("notification", app.markNotificationRead)))
+	v1.HandleFunc("GET /operations", app.withAuth(app.getOperations))
+	v1.HandleFunc("POST /operations/{id}/undo", app.withAuth(withID("operation", app.undoOperation)))
+
+	v1.HandleFunc("GET /households", app.withAuth(app.getHouseholds))
+	v1.HandleFunc("POST /households", app.withAuth(app.createHousehold))
+	v1.HandleFunc("DELETE /households/{id}", app.withAuth(withID("household", app.deleteHousehold)))
+	v1.HandleFunc("POST /households/{id}/invites", app.withAuth(withID("household", app.createHouseholdInvite)))
+	v1.HandleFunc("POST /invites/accept", app.withAuth(app.acceptInviteHandler))
+
+	v1.HandleFunc("GET /rules", app.withAuth(app.getRules))
+	v1.HandleFunc("POST /rules", app.withAuth(app.createRule))
+	v1.HandleFunc("POST /rules/apply", app.withAuth(app.applyRulesHandler))
+	v1.HandleFunc("GET /rules/{id}", app.withAuth(withID("rule", app.getRule)))
+	v1.HandleFunc("PUT /rules/{id}", app.withAuth(withID("rule", app.updateRule)))
+	v1.HandleFunc("DELETE /rules/{id}", app.withAuth(withID("rule", app.deleteRule)))
+
+	v1.HandleFunc("GET /admin/backup", app.withAdminToken(app.backupHandler))
+	v1.HandleFunc("POST /admin/users/{id}/unlock", app.withAdminToken(app.unlockUserHandler))
+	v1.HandleFunc("PUT /admin/users/{id}/quota-exemption", app.withAdminToken(app.quotaExemptionHandler(true)))
+	v1.HandleFunc("DELETE /admin/users/{id}/quota-exemption", app.withAdminToken(app.quotaExemptionHandler(false)))
+
+	v1.HandleFunc("GET /webhooks", app.withAuth(app.getWebhooks))
+	v1.HandleFunc("POST /webhooks", app.withAuth(app.createWebhook))
+	v1.HandleFunc("DELETE /webhooks/{id}", app.withAuth(withID("webhook", app.deleteWebhook)))
+	v1.HandleFunc("GET /webhooks/{id}/deliveries", app.withAuth(withID("webhook", app.getWebhookDeliveries)))
+	v1.HandleFunc("POST /webhooks/{id}/test", app.withAuth(withID("webhook", app.testWebhook)))
+
+	v1.HandleFunc("GET /settings", app.withAuth(app.getSettings))
+	v1.HandleFunc("PUT /settings", app.withAuth(app.updateSettings))
+	v1.HandleFunc("POST /settings/calendar-token", app.withAuth(app.createCalendarToken))
+	v1.HandleFunc("DELETE /settings/calendar-token", app.withAuth(app.deleteCalendarToken))
+	v1.HandleFunc("GET /limits", app.withAuth(app.limitsHandler))
+	v1.HandleFunc("GET /sync", app.withAuth(app.syncHandler))
+	v1.HandleFunc("GET /export", app.withAuth(app.exportHandler))
+	v1.HandleFunc("POST /import", app.withAuth(app.importHandler))
+
+	v1.HandleFunc("GET /openapi.json", openAPIHandler)
+	v1.HandleFunc("GET /docs", docsHandler)
+
+	mux := http.NewServeMux()
+	mux.Handle(apiPrefix+"/", http.StripPrefix(apiPrefix, withRouteErrors(v1)))
+	mux.HandleFunc("GET /api/version", versionHandler)
+
+	handler := withLegacyPaths(trimTrailingSlash(withRouteErrors(mux)))
+	if app.cfg.WebDir != "" {
+		handler = withWebUI(app.cfg.WebDir, v1, handler)
+	}
+	return withRequestID(app.withSecurityHeaders(withGzip(withRecovery(withQueryTimeouts(app.withHealthCheck(handler))))))
+}
+
+// Codes in the body of the 404 and 405 responses the router gives for
+// requests that match no route.
+const (
+	routeErrorNotFound         = "route_not_found"
+	routeErrorMethodNotAllowed = "method_not_allowed"
+)
+
+// withRouteErrors answers requests mux has no route for with a JSON body
+// instead of its plain-text page: 404 with route_not_found for an unknown
+// path, and 405 with method_not_allowed, keeping the mux's Allow header,
+// for a known path with the wrong method. Anything else, including the
+// handlers' own 404s, passes through untouched.
+func withRouteErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		// Without a pattern h is the mux's own error handler; run it
+		// against a scratch writer to learn which error it is.
+		scratch := &scratchWriter{header: http.Header{}}
+		h.ServeHTTP(scratch, r)
+		switch scratch.status {
+		case http.StatusNotFound:
+			writeAPIError(w, http.StatusNotFound, routeErrorNotFound, "Route not found")
+		case http.StatusMethodNotAllowed:
+			w.Header().Set("Allow", scratch.header.Get("Allow"))
+			writeAPIError(w, http.StatusMethodNotAllowed, routeErrorMethodNotAllowed, "Method not allowed")
+		default:
+			mux.ServeHTTP(w, r)
+		}
+	})
+}
+
+// scratchWriter records a response without sending it.
+type scratchWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *scratchWriter) Header() http.Header { return w.header }
+
+func (w *scratchWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *scratchWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(p), nil
+}
+
+// withID parses the {id} path value. A segment that is not a number is a
+// sub-path with no route of its own, such as /expenses/export, so it gets
+// the router's 404 rather than falling through as a malformed ID; a number
+// that is not positive is a 400 naming resource.
+func withID(resource string, handler resourceHandler) authedHandler {
+	return func(w http.ResponseWriter, r *http.Request, userID int) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, routeErrorNotFound, "Route not found")
+			return
+		}
+		if id <= 0 {
+			http.Error(w, "Invalid "+resource+" ID", http.StatusBadRequest)
+			return
+		}
+		handler(w, r, userID, id)
+	}
+}
+
+// trimTrailingSlash lets /expenses/12/ reach the same route as /expenses/12.
+func trimTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) > 1 && strings.HasSuffix(r.URL.Path, "/") {
+			u := *r.URL
+			u.Path = strings.TrimRight(u.Path, "/")
+			if u.Path == "" {
+				u.Path = "/"
+			}
+			u.RawPath = strings.TrimRight(u.RawPath, "/")
+			r2 := r.Clone(r.Context())
+			r2.URL = &u
+			r = r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouterPatterns(t *testing.T) {
+	useTestDB(t)
+
+	rr := callAuthed(http.MethodPost, "/expenses", Expense{Amount: 3, Category: "Snacks", Date: time.Now().UTC(), AccountID: testAccount()})
+	expectStatus(t, rr, http.StatusCreated)
+	created := decodeBody[Expense](t, rr)
+
+	expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d/", created.ID), nil), http.StatusOK)
+	expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d/anything", created.ID), nil), http.StatusNotFound)
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses/abc", nil), http.StatusNotFound)
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses/0", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/incomes/1/unknown", nil), http.StatusNotFound)
+	expectStatus(t, callAuthed(http.MethodGet, "/budgets/abc/progress", nil), http.StatusNotFound)
+
+	// Literal segments win over {id}.
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses/aggregates?query=totals_by_month", nil), http.StatusOK)
+	expectStatus(t, callAuthed(http.MethodGet, "/recurring-expenses/upcoming/", nil), http.StatusOK)
+
+	patch := callAuthed(http.MethodPatch, fmt.Sprintf("/expenses/%d", created.ID), nil)
+	expectStatus(t, patch, http.StatusMethodNotAllowed)
+	if allow := patch.Header().Get("Allow"); !strings.Contains(allow, http.MethodPut) || !strings.Contains(allow, http.MethodDelete) {
+		t.Fatalf("expected Allow header to list PUT and DELETE, got %q", allow)
+	}
+	if body := decodeBody[apiError](t, patch); body.Code != routeErrorMethodNotAllowed {
+		t.Fatalf("expected a JSON method_not_allowed body, got %+v", body)
+	}
+
+	// Unknown paths get the JSON envelope, versioned or not; a handler's own
+	// 404 keeps its message.
+	for _, target := range []string{"/expense", apiPrefix + "/expense", "/api/v2/expenses", fmt.Sprintf("/expenses/%d/anything", created.ID)} {
+		rr := callAuthed(http.MethodGet, target, nil)
+		expectStatus(t, rr, http.StatusNotFound)
+		if body := decodeBody[apiError](t, rr); body.Code != routeErrorNotFound || rr.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("expected a JSON route_not_found from %s, got %+v", target, body)
+		}
+	}
+	missing := callAuthed(http.MethodGet, "/expenses/999999", nil)
+	expectStatus(t, missing, http.StatusNotFound)
+	if !strings.HasPrefix(missing.Body.String(), "Expense not found") {
+		t.Fatalf("expected the handler's own 404, got %q", missing.Body.String())
+	}
+
+	accountRR := callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", testAccountID), nil)
+	expectStatus(t, accountRR, http.StatusOK)
+	if account := decodeBody[Account](t, accountRR); account.ID != testAccountID {
+		t.Fatalf("expected account %d, got %+v", testAccountID, account)
+	}
+}
+
+func TestExpenseSubPaths(t *testing.T) {
+	useTestDB(t)
+	created := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 3, Category: "Snacks", AccountID: testAccount()}))
+
+	// Named sub-resources reach their own handlers, not the ID parse.
+	for _, route := range []struct {
+		method, target string
+		payload        interface{}
+	}{
+		{http.MethodGet, "/expenses/aggregates?query=totals_by_category", nil},
+		{http.MethodGet, "/expenses/stats", nil},
+		{http.MethodGet, "/expenses/categories", nil},
+		{http.MethodPost, "/expenses/bulk", BulkExpenseRequest{IDs: []int{created.ID}, Action: bulkActionSetCategory, Value: json.RawMessage(`"Snacks"`)}},
+		{http.MethodGet, "/incomes/export", nil},
+		{http.MethodGet, "/incomes/sources", nil},
+		{http.MethodGet, fmt.Sprintf("/expenses/%d", created.ID), nil},
+		{http.MethodGet, fmt.Sprintf("/expenses/%d/", created.ID), nil},
+	} {
+		rr := callAuthed(route.method, route.target, route.payload)
+		expectStatus(t, rr, http.StatusOK)
+	}
+
+	// Anything else under /expenses is an unknown route, whichever method,
+	// rather than an invalid expense ID.
+	for _, segment := range []string{"export", "import", "batch", "trash", "abc", "12abc", "1.5", "%20"} {
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			rr := callAuthed(method, "/expenses/"+segment, nil)
+			expectStatus(t, rr, http.StatusNotFound)
+			if body := decodeBody[apiError](t, rr); body.Code != routeErrorNotFound {
+				t.Fatalf("%s /expenses/%s: expected route_not_found, got %+v", method, segment, body)
+			}
+		}
+	}
+	expectStatus(t, callAuthed(http.MethodGet, "/incomes/import", nil), http.StatusNotFound)
+
+	// A number that cannot be an ID is still a bad request.
+	for _, segment := range []string{"0", "-5"} {
+		rr := callAuthed(http.MethodGet, "/expenses/"+segment, nil)
+		expectStatus(t, rr, http.StatusBadRequest)
+		if !strings.HasPrefix(rr.Body.String(), "Invalid expense ID") {
+			t.Fatalf("/expenses/%s: expected Invalid expense ID, got %q", segment, rr.Body.String())
+		}
+	}
+}
+
+func TestRouterRequiresAuth(t *testing.T) {
+	for _, route := range []struct{ method, target string }{
+		{http.MethodGet, "/expenses"},
+		{http.MethodGet, "/expenses/1"},
+		{http.MethodPost, "/budgets"},
+		{http.MethodGet, "/accounts/1"},
+		{http.MethodPost, "/households/1/invites"},
+		{http.MethodDelete, "/auth/account"},
+	} {
+		rr := serve(httptest.NewRequest(route.method, route.target, nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a session: got %d want 401", route.method, route.target, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"time"
+)
+
+const (
+	uncategorizedCategory = "Uncategorized"
+
+	ruleFieldNote  = "note"
+	ruleFieldPayee = "payee"
+
+	ruleMatchContains = "contains"
+	ruleMatchPrefix   = "prefix"
+	ruleMatchRegex    = "regex"
+
+	// RE2 matches in linear time, so the caps below bound the work done per
+	// expense rather than guard against backtracking.
+	maxRulePatternLength = 200
+	maxRuleInputLength   = 1024
+	maxRuleProgramSize   = 2000
+	maxRulesPerUser      = 500
+)
+
+// CategoryRule assigns Category to expenses whose MatchField matches Pattern.
+// Rules are tried highest Priority first (ties by ID) and the first match
+// wins. contains and prefix compare case-insensitively; regex patterns are
+// used as written, so prefix them with (?i) to ignore case.
+type CategoryRule struct {
+	ID         int    `json:"id"`
+	MatchField string `json:"match_field"`
+	MatchType  string `json:"match_type"`
+	Pattern    string `json:"pattern"`
+	Category   string `json:"category"`
+	Priority   int    `json:"priority"`
+}
+
+// compiledRule is a CategoryRule ready to evaluate.
+type compiledRule struct {
+	CategoryRule
+	re *regexp.Regexp
+}
+
+// applyRulesResult reports how many expenses changed category and, when
+// any did, the operation that undoes it.
+type applyRulesResult struct {
+	Updated     int `json:"updated"`
+	OperationID int `json:"operation_id,omitempty"`
+}
+
+func (app *App) createRuleTables() error {
+	ruleTableStmt := `
+    CREATE TABLE IF NOT EXISTS category_rules (
+        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        match_field TEXT NOT NULL,
+        match_type TEXT NOT NULL,
+        pattern TEXT NOT NULL,
+        category TEXT NOT NULL,
+        priority INTEGER NOT NULL DEFAULT 0,
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(ruleTableStmt)); err != nil {
+		return fmt.Errorf("create category_rules table: %w", err)
+	}
+
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_category_rules_user ON category_rules(user_id, priority)"); err != nil {
+		return fmt.Errorf("create category_rules index: %w", err)
+	}
+	return nil
+}
+
+// compileRule validates rule and prepares it for matching.
+func compileRule(rule CategoryRule) (compiledRule, error) {
+	c := compiledRule{CategoryRule: rule}
+	if rule.MatchField != ruleFieldNote && rule.MatchField != ruleFieldPayee {
+		return c, fmt.Errorf("match_field must be %q or %q", ruleFieldNote, ruleFieldPayee)
+	}
+	if strings.TrimSpace(rule.Category) == "" {
+		return c, fmt.Errorf("category is required")
+	}
+	if rule.Pattern == "" {
+		return c, fmt.Errorf("pattern is required")
+	}
+	if len(rule.Pattern) > maxRulePatternLength {
+		return c, fmt.Errorf("pattern must be at most %d characters", maxRulePatternLength)
+	}
+
+	switch rule.MatchType {
+	case ruleMatchContains, ruleMatchPrefix:
+		c.Pattern = strings.ToLower(rule.Pattern)
+	case ruleMatchRegex:
+		re, err := compileRuleRegex(rule.Pattern)
+		if err != nil {
+			return c, err
+		}
+		c.re = re
+	default:
+		return c, fmt.Errorf("match_type must be %q, %q or %q", ruleMatchContains, ruleMatchPrefix, ruleMatchRegex)
+	}
+	return c, nil
+}
+
+// compileRuleRegex compiles pattern, rejecting those whose program is large
+// enough (big repetition counts over alternations) to make matching each
+// expense expensive even though it stays linear.
+func compileRuleRegex(pattern string) (*regexp.Regexp, error) {
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	if len(prog.Inst) > maxRuleProgramSize {
+		return nil, fmt.Errorf("regex is too complex")
+	}
+	return regexp.Compile(pattern)
+}
+
+// matches reports whether the rule applies to an expense with the given note
+// and payee. Only the first maxRuleInputLength bytes of the field are read.
+func (c compiledRule) matches(note string, payee *string) bool {
+	value := note
+	if c.MatchField == ruleFieldPayee {
+		if payee == nil {
+			return false
+		}
+		value = *payee
+	}
+	if len(value) > maxRuleInputLength {
+		value = value[:maxRuleInputLength]
+	}
+
+	switch c.MatchType {
+	case ruleMatchContains:
+		return strings.Contains(strings.ToLower(value), c.Pattern)
+	case ruleMatchPrefix:
+		return strings.HasPrefix(strings.ToLower(value), c.Pattern)
+	case ruleMatchRegex:
+		return c.re.MatchString(value)
+	}
+	return false
+}
+
+// uncategorizedClause is the SQL form of needsCategory. It takes
+// uncategorizedCategory as its argument.
+const uncategorizedClause = "(TRIM(category) = '' OR LOWER(TRIM(category)) = LOWER(?))"
+
+// needsCategory reports whether category should be filled in by rules.
+func needsCategory(category string) bool {
+	category = strings.TrimSpace(category)
+	return category == "" || strings.EqualFold(category, uncategorizedCategory)
+}
+
+// categorize returns the category of the first rule matching the expense, or
+// uncategorizedCategory when none does.
+func categorize(rules []compiledRule, note string, payee *string) string {
+	for _, rule := range rules {
+		if rule.matches(note, payee) {
+			return rule.Category
+		}
+	}
+	return uncategorizedCategory
+}
+
+// loadRules returns the user's rules compiled and in evaluation order.
+func loadRules(q rowsQuerier, userID int) ([]compiledRule, error) {
+	rows, err := q.Query("SELECT id, match_field, match_type, pattern, category, priority FROM category_rules WHERE user_id = ? ORDER BY priority DESC, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []compiledRule
+	for rows.Next() {
+		var rule CategoryRule
+		if err := rows.Scan(&rule.ID, &rule.MatchField, &rule.MatchType, &rule.Pattern, &rule.Category, &rule.Priority); err != nil {
+			return nil, err
+		}
+		c, err := compileRule(rule)
+		if err != nil {
+			// Rules are validated on write; skip any that no longer compile
+			// rather than failing every expense creation.
+			log.Printf("category rule %d skipped: %v", rule.ID, err)
+			continue
+		}
+		rules = append(rules, c)
+	}
+	return rules, rows.Err()
+}
+
+// applyCategoryRules fills in e.Category from the user's rules when it is
+// blank or uncategorizedCategory.
+func applyCategoryRules(q rowsQuerier, userID int, e *Expense) error {
+	if !needsCategory(e.Category) {
+		return nil
+	}
+	rules, err := loadRules(q, userID)
+	if err != nil {
+		return err
+	}
+	e.Category = categorize(rules, e.Note, e.Payee)
+	return nil
+}
+
+func (app *App) getRules(w http.ResponseWriter, r *http.Request, userID int) {
+	rules, err := loadRules(app.requestDB(r), userID)
+	if err != nil {
+		log.Printf("category rules query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]CategoryRule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, rule.CategoryRule)
+	}
+
+	writeJSONList(w, result)
+}
+
+func (app *App) createRule(w http.ResponseWriter, r *http.Request, userID int) {
+	var rule CategoryRule
+	if !decodeJSONBody(w, r, &rule) {
+		return
+	}
+	rule.Category = strings.TrimSpace(rule.Category)
+	if _, err := compileRule(rule); err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	if err := app.db.QueryRow("SELECT COUNT(*) FROM category_rules WHERE user_id = ?", userID).Scan(&count); err != nil {
+		log.Printf("category rules count error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxRulesPerUser {
+		http.Error(w, fmt.Sprintf("At most %d rules are allowed", maxRulesPerUser), http.StatusBadRequest)
+		return
+	}
+
+	id, err := insertReturningID(app.db, "INSERT INTO category_rules(user_id, match_field, match_type, pattern, category, priority) VALUES(?, ?, ?, ?, ?, ?)",
+		userID, rule.MatchField, rule.MatchType, rule.Pattern, rule.Category, rule.Priority)
+	if err != nil {
+		log.Printf("create category rule error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	created, err := fetchRule(app.db, userID, id)
+	if err != nil {
+		log.Printf("category rule fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondCreated(w, fmt.Sprintf("/rules/%d", id), created)
+}
+
+func (app *App) getRule(w http.ResponseWriter, r *http.Request, userID, id int) {
+	rule, err := fetchRule(app.requestDB(r), userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("category rule fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func fetchRule(q rowQuerier, userID, id int) (CategoryRule, error) {
+	var rule CategoryRule
+	err := q.QueryRow("SELECT id, match_field, match_type, pattern, category, priority FROM category_rules WHERE id = ? AND user_id = ?", id, userID).Scan(&rule.ID, &rule.MatchField, &rule.MatchType, &rule.Pattern, &rule.Category, &rule.Priority)
+	return rule, err
+}
+
+func (app *App) updateRule(w http.ResponseWriter, r *http.Request, userID, id int) {
+	var rule CategoryRule
+	if !decodeJSONBody(w, r, &rule) {
+		return
+	}
+	rule.Category = strings.TrimSpace(rule.Category)
+	if _, err := compileRule(rule); err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := app.db.Exec("UPDATE category_rules SET match_field = ?, match_type = ?, pattern = ?, category = ?, priority = ? WHERE id = ? AND user_id = ?",
+		rule.MatchField, rule.MatchType, rule.Pattern, rule.Category, rule.Priority, id, userID)
+	if err != nil {
+		log.Printf("update category rule error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	rule.ID = id
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (app *App) deleteRule(w http.ResponseWriter, r *http.Request, userID, id int) {
+	res, err := app.db.Exec("DELETE FROM category_rules WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Printf("delete category rule error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyRulesHandler re-runs the user's rules over their uncategorized
+// expenses, optionally limited to date_from/date_to, and reports how many
+// changed category. Each change is audited and bumps updated_at.
+func (app *App) applyRulesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	query := "SELECT id FROM expenses WHERE user_id = ? AND " + uncategorizedClause
+	args := []interface{}{userID, uncategorizedCategory}
+
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	dateClause, dateArgs, ok := dateRangeFilter(w, r.URL.Query(), loc)
+	if !ok {
+		return
+	}
+	query += dateClause
+	args = append(args, dateArgs...)
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	rules, err := loadRules(tx, userID)
+	if err != nil {
+		log.Printf("category rules query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ids, err := uncategorizedExpenseIDs(tx, query, args...)
+	if err != nil {
+		log.Printf("uncategorized expense query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var result applyRulesResult
+	var undo operationUndo
+	now := time.Now()
+	for _, id := range ids {
+		old, err := fetchExpense(tx, userID, id)
+		if err != nil {
+			log.Printf("expense fetch error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		category := categorize(rules, old.Note, old.Payee)
+		if category == old.Category {
+			continue
+		}
+
+		e := old
+		e.Category = category
+		e.Timestamps = old.Timestamps.touched(now)
+		if _, err := tx.Exec("UPDATE expenses SET category = ?, updated_at = ? WHERE id = ?", e.Category, e.UpdatedAt.Format(timeFormat), id); err != nil {
+			log.Printf("expense recategorize error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := recordAudit(tx, userID, auditEntityExpense, id, auditActionUpdate, old, e); err != nil {
+			log.Printf("audit log error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		undo.Revert = append(undo.Revert, old)
+		result.Updated++
+	}
+
+	if result.Updated > 0 {
+		if result.OperationID, err = recordOperation(tx, userID, operationApplyRules, result.Updated, undo); err != nil {
+			log.Printf("operation log error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// uncategorizedExpenseIDs collects the matching IDs up front so the rows are
+// closed before the transaction starts writing.
+func uncategorizedExpenseIDs(q rowsQuerier, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCategoryRulesOnCreateAndImport(t *testing.T) {
+	useTestDB(t)
+
+	rules := []CategoryRule{
+		{MatchField: ruleFieldPayee, MatchType: ruleMatchPrefix, Pattern: "STARBUCKS", Category: "Coffee"},
+		{MatchField: ruleFieldNote, MatchType: ruleMatchContains, Pattern: "uber", Category: "Transport"},
+		{MatchField: ruleFieldNote, MatchType: ruleMatchRegex, Pattern: `(?i)uber\s+eats`, Category: "Takeaway", Priority: 10},
+	}
+	for _, rule := range rules {
+		expectStatus(t, callAuthed(http.MethodPost, "/rules", rule), http.StatusCreated)
+	}
+
+	listed := decodeBody[[]CategoryRule](t, callAuthed(http.MethodGet, "/rules", nil))
+	if len(listed) != 3 || listed[0].Category != "Takeaway" {
+		t.Fatalf("expected rules ordered by priority, got %+v", listed)
+	}
+
+	now := time.Now().UTC()
+	cases := []struct {
+		expense Expense
+		want    string
+	}{
+		{Expense{Amount: 4, Payee: strPtr("Starbucks #123"), Date: now, AccountID: testAccount()}, "Coffee"},
+		{Expense{Amount: 9, Category: "uncategorized", Note: "Uber Eats dinner", Date: now, AccountID: testAccount()}, "Takeaway"},
+		{Expense{Amount: 12, Note: "UBER trip", Date: now, AccountID: testAccount()}, "Transport"},
+		{Expense{Amount: 3, Note: "Bakery", Date: now, AccountID: testAccount()}, uncategorizedCategory},
+		{Expense{Amount: 5, Category: "Gifts", Note: "uber voucher", Date: now, AccountID: testAccount()}, "Gifts"},
+	}
+	for _, c := range cases {
+		created := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", c.expense))
+		if created.Category != c.want {
+			t.Fatalf("expected %+v to be categorized %q, got %q", c.expense, c.want, created.Category)
+		}
+	}
+
+	doc := exportDocument{
+		SchemaVersion: exportSchemaVersion,
+		Expenses:      []Expense{{Amount: 2, Category: uncategorizedCategory, Payee: strPtr("starbucks reserve"), Date: now}},
+	}
+	expectStatus(t, callAuthed(http.MethodPost, "/import?merge=true", doc), http.StatusCreated)
+	var imported string
+	if err := testApp.db.QueryRow("SELECT category FROM expenses WHERE user_id = ? ORDER BY id DESC LIMIT 1", testUserID).Scan(&imported); err != nil {
+		t.Fatalf("load imported expense: %v", err)
+	}
+	if imported != "Coffee" {
+		t.Fatalf("expected imported expense to be categorized by rules, got %q", imported)
+	}
+}
+
+func TestApplyRulesRetroactively(t *testing.T) {
+	useTestDB(t)
+
+	old := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC)
+	var ids []int
+	for _, e := range []Expense{
+		{Amount: 1, Note: "Netflix", Date: old, AccountID: testAccount()},
+		{Amount: 2, Note: "Netflix", Date: recent, AccountID: testAccount()},
+		{Amount: 3, Note: "Hardware store", Date: recent, AccountID: testAccount()},
+		{Amount: 4, Category: "Shows", Note: "Netflix", Date: recent, AccountID: testAccount()},
+	} {
+		ids = append(ids, decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", e)).ID)
+	}
+
+	rule := CategoryRule{MatchField: ruleFieldNote, MatchType: ruleMatchContains, Pattern: "netflix", Category: "Streaming"}
+	expectStatus(t, callAuthed(http.MethodPost, "/rules", rule), http.StatusCreated)
+
+	rr := callAuthed(http.MethodPost, "/rules/apply?date_from=2024-03-01", nil)
+	expectStatus(t, rr, http.StatusOK)
+	if result := decodeBody[applyRulesResult](t, rr); result.Updated != 1 {
+		t.Fatalf("expected 1 expense recategorized, got %d", result.Updated)
+	}
+
+	want := []string{uncategorizedCategory, "Streaming", uncategorizedCategory, "Shows"}
+	for i, id := range ids {
+		e := decodeBody[Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", id), nil))
+		if e.Category != want[i] {
+			t.Fatalf("expense %d: expected category %q, got %q", id, want[i], e.Category)
+		}
+	}
+
+	entries := decodeBody[[]AuditEntry](t, callAuthed(http.MethodGet, fmt.Sprintf("/audit-log?entity_type=expense&entity_id=%d&action=update", ids[1]), nil))
+	if len(entries) != 1 {
+		t.Fatalf("expected the recategorization to be audited, got %d entries", len(entries))
+	}
+
+	if result := decodeBody[applyRulesResult](t, callAuthed(http.MethodPost, "/rules/apply", nil)); result.Updated != 1 {
+		t.Fatalf("expected the older expense to be picked up without a date filter, got %d", result.Updated)
+	}
+	expectStatus(t, callAuthed(http.MethodPost, "/rules/apply?date_from=someday", nil), http.StatusBadRequest)
+}
+
+func TestRuleValidation(t *testing.T) {
+	useTestDB(t)
+
+	invalid := []CategoryRule{
+		{MatchField: "amount", MatchType: ruleMatchContains, Pattern: "x", Category: "X"},
+		{MatchField: ruleFieldNote, MatchType: "fuzzy", Pattern: "x", Category: "X"},
+		{MatchField: ruleFieldNote, MatchType: ruleMatchContains, Pattern: "", Category: "X"},
+		{MatchField: ruleFieldNote, MatchType: ruleMatchContains, Pattern: "x", Category: "  "},
+		{MatchField: ruleFieldNote, MatchType: ruleMatchRegex, Pattern: "(unclosed", Category: "X"},
+		{MatchField: ruleFieldNote, MatchType: ruleMatchRegex, Pattern: "((a{1,100}){1,100}){1,100}", Category: "X"},
+		{MatchField: ruleFieldNote, MatchType: ruleMatchRegex, Pattern: "(foo|bar){1,400}", Category: "X"},
+		{MatchField: ruleFieldNote, MatchType: ruleMatchRegex, Pattern: strings.Repeat("a", maxRulePatternLength+1), Category: "X"},
+	}
+	for _, rule := range invalid {
+		expectStatus(t, callAuthed(http.MethodPost, "/rules", rule), http.StatusBadRequest)
+	}
+
+	rule := decodeBody[CategoryRule](t, callAuthed(http.MethodPost, "/rules", CategoryRule{MatchField: ruleFieldNote, MatchType: ruleMatchContains, Pattern: "gym", Category: "Health"}))
+	rule.Pattern = "(bad"
+	rule.MatchType = ruleMatchRegex
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/rules/%d", rule.ID), rule), http.StatusBadRequest)
+
+	rule.Pattern = "^gym"
+	updated := decodeBody[CategoryRule](t, callAuthed(http.MethodPut, fmt.Sprintf("/rules/%d", rule.ID), rule))
+	if updated.Pattern != "^gym" {
+		t.Fatalf("expected rule update to stick, got %+v", updated)
+	}
+
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/rules/%d", rule.ID), nil), http.StatusNoContent)
+	expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("/rules/%d", rule.ID), nil), http.StatusNotFound)
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/rules/%d", rule.ID), nil), http.StatusNotFound)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSavingsRateMonths = 12
+	maxSavingsRateMonths     = 120
+)
+
+// SavingsRateReport is income against spending for each of the last Months
+// months, oldest first. AverageRate is the mean of the months' savings
+// rates, leaving out those without income, and null when every month is.
+type SavingsRateReport struct {
+	Months      int                `json:"months"`
+	Points      []SavingsRateMonth `json:"points"`
+	AverageRate *float64           `json:"average_rate"`
+}
+
+// SavingsRateMonth is one month of a SavingsRateReport. SavingsRate is the
+// percentage of income not spent, negative when spending was higher, and
+// null without income to divide by.
+type SavingsRateMonth struct {
+	Month       string   `json:"month"`
+	Income      float64  `json:"income"`
+	Expense     float64  `json:"expense"`
+	Net         float64  `json:"net"`
+	SavingsRate *float64 `json:"savings_rate"`
+}
+
+// averageSavingsRate is the mean of the non-nil rates, or nil if there are
+// none.
+func averageSavingsRate(points []SavingsRateMonth) *float64 {
+	var sum float64
+	var n int
+	for _, p := range points {
+		if p.SavingsRate != nil {
+			sum += *p.SavingsRate
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	average := roundCents(sum / float64(n))
+	return &average
+}
+
+// savingsRateHandler serves GET /reports/savings-rate. months (default 12)
+// is how many months to cover, ending with the current month in the user's
+// timezone; months without data are zeros. Opening balances are left out,
+// as in the income-vs-expense report.
+func (app *App) savingsRateHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "months") {
+		return
+	}
+	months := defaultSavingsRateMonths
+	if raw := strings.TrimSpace(params.Get("months")); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 || v > maxSavingsRateMonths {
+			http.Error(w, "Invalid months; use a whole number from 1 to "+strconv.Itoa(maxSavingsRateMonths), http.StatusBadRequest)
+			return
+		}
+		months = v
+	}
+
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	month := reportPeriods["month"]
+	end := month.next(month.start(localDay(time.Now(), loc)))
+	start := end.AddDate(0, -months, 0)
+	from, to := dayStart(start, loc), dayStart(end, loc)
+
+	q := app.requestDB(r)
+	incomes, err := dailyTotals(q, loc, "SELECT date, amount FROM incomes WHERE user_id = ? AND opening_balance = 0 AND date >= ? AND date < ?", userID, from, to)
+	if err != nil {
+		log.Printf("savings rate income query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	expenses, err := dailyTotals(q, loc, "SELECT date, amount FROM expenses WHERE user_id = ? AND date >= ? AND date < ?", userID, from, to)
+	if err != nil {
+		log.Printf("savings rate expense query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	income, expense := map[time.Time]float64{}, map[time.Time]float64{}
+	for day, total := range incomes {
+		income[month.start(day)] += total
+	}
+	for day, total := range expenses {
+		expense[month.start(day)] += total
+	}
+
+	report := SavingsRateReport{Months: months, Points: make([]SavingsRateMonth, 0, months)}
+	for t := start; t.Before(end); t = month.next(t) {
+		p := SavingsRateMonth{Month: month.label(t), Income: roundCents(income[t]), Expense: roundCents(expense[t])}
+		p.Net = roundCents(p.Income - p.Expense)
+		if p.Income > 0 {
+			rate := savingsRate(p.Income, p.Expense)
+			p.SavingsRate = &rate
+		}
+		report.Points = append(report.Points, p)
+	}
+	report.AverageRate = averageSavingsRate(report.Points)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
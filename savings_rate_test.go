@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSavingsRateReport(t *testing.T) {
+	useTestDB(t)
+	now := time.Now().UTC()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 12, 0, 0, 0, time.UTC)
+	lastMonth := thisMonth.AddDate(0, -1, 0)
+	expectStatus(t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Savings", Type: "bank", Balance: 5000}), http.StatusCreated)
+	for _, in := range []Income{{Amount: 1000, Source: "Salary", Date: thisMonth}, {Amount: 500, Source: "Bonus", Date: thisMonth.AddDate(0, -4, 0)}} {
+		in.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/incomes", in), http.StatusCreated)
+	}
+	for _, e := range []Expense{{Amount: 250, Date: thisMonth}, {Amount: 100, Date: lastMonth}} {
+		e.Category = "Food"
+		e.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	rr := callAuthed(http.MethodGet, "/reports/savings-rate?months=3", nil)
+	expectStatus(t, rr, http.StatusOK)
+	report := decodeBody[SavingsRateReport](t, rr)
+	if report.Months != 3 || len(report.Points) != 3 {
+		t.Fatalf("expected 3 months, got %+v", report)
+	}
+	// Two months ago has no data, and last month spending without income.
+	empty, spent, current := report.Points[0], report.Points[1], report.Points[2]
+	if empty.Month != thisMonth.AddDate(0, -2, 0).Format("2006-01") || empty.Income != 0 || empty.Expense != 0 || empty.Net != 0 || empty.SavingsRate != nil {
+		t.Fatalf("expected an empty month, got %+v", empty)
+	}
+	if spent.Expense != 100 || spent.Net != -100 || spent.SavingsRate != nil {
+		t.Fatalf("expected no rate without income, got %+v", spent)
+	}
+	// The opening balance is not income.
+	if current.Month != thisMonth.Format("2006-01") || current.Income != 1000 || current.Net != 750 || current.SavingsRate == nil || *current.SavingsRate != 75 {
+		t.Fatalf("unexpected current month: %+v", current)
+	}
+	if report.AverageRate == nil || *report.AverageRate != 75 {
+		t.Fatalf("expected an average of 75, got %v", report.AverageRate)
+	}
+
+	// Further back, a month spending nothing saves all of it.
+	rr = callAuthed(http.MethodGet, "/reports/savings-rate?months=5", nil)
+	expectStatus(t, rr, http.StatusOK)
+	if report := decodeBody[SavingsRateReport](t, rr); *report.Points[0].SavingsRate != 100 || *report.AverageRate != 87.5 {
+		t.Fatalf("expected rates of 100 and 75 averaging 87.5, got %+v", report)
+	}
+
+	for _, months := range []string{"0", "121", "twelve"} {
+		expectStatus(t, callAuthed(http.MethodGet, "/reports/savings-rate?months="+months, nil), http.StatusBadRequest)
+	}
+}
+
+func TestAverageSavingsRate(t *testing.T) {
+	rate := func(v float64) *float64 { return &v }
+	if got := averageSavingsRate([]SavingsRateMonth{{}, {}}); got != nil {
+		t.Fatalf("expected no average without income, got %v", *got)
+	}
+	if got := averageSavingsRate([]SavingsRateMonth{{SavingsRate: rate(-50)}, {}, {SavingsRate: rate(20)}}); got == nil || *got != -15 {
+		t.Fatalf("expected -15, got %v", got)
+	}
+}
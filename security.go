@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// App.trustedProxies lists the addresses whose X-Forwarded-For, X-Real-IP
+// and X-Forwarded-Proto headers are believed. Anyone else could forge them,
+// so for other peers they are ignored.
+
+// parseTrustedProxies reads a comma-separated list of IP addresses and CIDR
+// ranges.
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func (app *App) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerAddr is the address of the connection's other end.
+func peerAddr(r *http.Request) netip.Addr {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr.Unmap()
+}
+
+// clientIP is the address of the client behind any trusted proxies. From a
+// trusted proxy, X-Forwarded-For is read right to left, skipping further
+// trusted proxies, so addresses a client prepended itself are never used;
+// X-Real-IP is the fallback. Otherwise it is the peer address.
+func (app *App) clientIP(r *http.Request) string {
+	peer := peerAddr(r)
+	if !peer.IsValid() {
+		return r.RemoteAddr
+	}
+	if !app.isTrustedProxy(peer) {
+		return peer.String()
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if !app.isTrustedProxy(addr) || i == 0 {
+			return addr.Unmap().String()
+		}
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return peer.String()
+}
+
+// requestScheme is "https" when the client reached us over HTTPS, directly
+// or through a trusted proxy that says so in X-Forwarded-Proto, and "http"
+// otherwise.
+func (app *App) requestScheme(r *http.Request) string {
+	if r == nil {
+		return "http"
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	if app.isTrustedProxy(peerAddr(r)) {
+		// Proxies in a chain append, so the first value is what the
+		// client used.
+		proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+		if strings.EqualFold(strings.TrimSpace(proto), "https") {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+func (app *App) requestIsHTTPS(r *http.Request) bool { return app.requestScheme(r) == "https" }
+
+// withSecurityHeaders sets the headers every response should carry. The API
+// only serves JSON and downloads, so the Content-Security-Policy allows
+// nothing. HSTS is only sent over HTTPS, where browsers honour it.
+func (app *App) withSecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		if app.requestIsHTTPS(r) {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpsRedirect sends every request to the same path on the HTTPS port.
+// 308 keeps the method and body, so a POST is not turned into a GET.
+func httpsRedirect(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	useTestDB(t)
+
+	for _, rr := range []*httptest.ResponseRecorder{
+		callAuthed(http.MethodGet, "/expenses", nil),
+		serve(httptest.NewRequest(http.MethodGet, "/expenses", nil)),
+		serve(httptest.NewRequest(http.MethodGet, "/no-such-route", nil)),
+	} {
+		for header, want := range map[string]string{
+			"X-Content-Type-Options":  "nosniff",
+			"X-Frame-Options":         "DENY",
+			"Referrer-Policy":         "no-referrer",
+			"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'",
+		} {
+			if got := rr.Header().Get(header); got != want {
+				t.Fatalf("expected %s: %s on a %d response, got %q", header, want, rr.Code, got)
+			}
+		}
+		if hsts := rr.Header().Get("Strict-Transport-Security"); hsts != "" {
+			t.Fatalf("expected no HSTS over plain HTTP, got %q", hsts)
+		}
+	}
+
+	hsts := func(configure func(*http.Request)) string {
+		req := authedRequest(http.MethodGet, "/expenses", nil)
+		configure(req)
+		return serve(req).Header().Get("Strict-Transport-Security")
+	}
+	if got := hsts(func(r *http.Request) { r.TLS = &tls.ConnectionState{} }); got == "" {
+		t.Fatal("expected HSTS over TLS")
+	}
+	forwarded := func(r *http.Request) { r.Header.Set("X-Forwarded-Proto", "https") }
+	testApp.trustedProxies = nil
+	if got := hsts(forwarded); got != "" {
+		t.Fatalf("expected X-Forwarded-Proto to be ignored unless trusted, got HSTS %q", got)
+	}
+	testApp.trustedProxies = mustParseProxies(t, "192.0.2.0/24")
+	if got := hsts(forwarded); got == "" {
+		t.Fatal("expected HSTS behind a trusted TLS proxy")
+	}
+}
+
+func TestSessionCookieSecureBehindProxy(t *testing.T) {
+	useTestDB(t)
+
+	login := func(forwardedProto string) *http.Cookie {
+		t.Helper()
+		body, _ := json.Marshal(credentials{Email: "tester@example.com", Password: "VerySecurePass123!"})
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body))
+		if forwardedProto != "" {
+			req.Header.Set("X-Forwarded-Proto", forwardedProto)
+		}
+		rr := serve(req)
+		expectStatus(t, rr, http.StatusOK)
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == sessionCookieName {
+				return c
+			}
+		}
+		t.Fatal("no session cookie set")
+		return nil
+	}
+
+	testApp.trustedProxies = nil
+	if login("https").Secure {
+		t.Fatal("expected an untrusted X-Forwarded-Proto not to mark the cookie Secure")
+	}
+	// httptest requests come from 192.0.2.1.
+	testApp.trustedProxies = mustParseProxies(t, "192.0.2.1")
+	if !login("https").Secure {
+		t.Fatal("expected the cookie to be Secure behind a trusted TLS proxy")
+	}
+	if login("http").Secure {
+		t.Fatal("expected plain HTTP through the proxy to leave the cookie without Secure")
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	cases := []struct {
+		host, target string
+		port         int
+		want         string
+	}{
+		{"example.com", "/expenses?page=2", 443, "https://example.com/expenses?page=2"},
+		{"example.com:80", "/auth/login", 443, "https://example.com/auth/login"},
+		{"example.com:8080", "/", 8443, "https://example.com:8443/"},
+		{"[::1]:80", "/accounts", 443, "https://[::1]/accounts"},
+		{"[::1]", "/accounts", 8443, "https://[::1]:8443/accounts"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, c.target, nil)
+		req.Host = c.host
+		rr := httptest.NewRecorder()
+		httpsRedirect(c.port).ServeHTTP(rr, req)
+		expectStatus(t, rr, http.StatusPermanentRedirect)
+		if got := rr.Header().Get("Location"); got != c.want {
+			t.Errorf("redirect for %s%s: got %q, want %q", c.host, c.target, got, c.want)
+		}
+	}
+}
+
+func mustParseProxies(t *testing.T, list string) []netip.Prefix {
+	t.Helper()
+	prefixes, err := parseTrustedProxies(list)
+	if err != nil {
+		t.Fatalf("parse trusted proxies %q: %v", list, err)
+	}
+	return prefixes
+}
+
+func TestClientIPAndScheme(t *testing.T) {
+	cases := []struct {
+		name              string
+		trusted           string
+		remote            string
+		headers           map[string]string
+		wantIP, wantProto string
+	}{
+		{"direct client", "", "203.0.113.7:5000", nil, "203.0.113.7", "http"},
+		{"spoofed headers without trusted proxies", "", "203.0.113.7:5000",
+			map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4", "X-Forwarded-Proto": "https"}, "203.0.113.7", "http"},
+		{"spoofed headers from an untrusted peer", "127.0.0.1", "203.0.113.7:5000",
+			map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https"}, "203.0.113.7", "http"},
+		{"trusted proxy", "127.0.0.1", "127.0.0.1:41000",
+			map[string]string{"X-Forwarded-For": "198.51.100.4", "X-Forwarded-Proto": "https"}, "198.51.100.4", "https"},
+		{"client-prepended address is skipped", "127.0.0.1", "127.0.0.1:41000",
+			map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.4"}, "198.51.100.4", "http"},
+		{"chain of trusted proxies", "127.0.0.1,10.0.0.0/8", "127.0.0.1:41000",
+			map[string]string{"X-Forwarded-For": "198.51.100.4, 10.1.2.3", "X-Forwarded-Proto": "https, http"}, "198.51.100.4", "https"},
+		{"X-Real-IP fallback", "::1", "[::1]:41000",
+			map[string]string{"X-Real-IP": "2001:db8::5"}, "2001:db8::5", "http"},
+		{"trusted proxy without headers", "127.0.0.1", "127.0.0.1:41000", nil, "127.0.0.1", "http"},
+	}
+	for _, c := range cases {
+		app := &App{trustedProxies: mustParseProxies(t, c.trusted)}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		if got := app.clientIP(req); got != c.wantIP {
+			t.Errorf("%s: client IP %q, want %q", c.name, got, c.wantIP)
+		}
+		if got := app.requestScheme(req); got != c.wantProto {
+			t.Errorf("%s: scheme %q, want %q", c.name, got, c.wantProto)
+		}
+	}
+}
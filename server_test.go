@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testClient talks to a real httptest.Server over HTTP, carrying its own
+// session cookie in a jar the way a browser would.
+type testClient struct {
+	t      *testing.T
+	server *httptest.Server
+	http   *http.Client
+}
+
+// newTestServer starts the full router against a fresh database.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	useTestDB(t)
+	srv := httptest.NewServer(testApp)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server) *testClient {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookie jar: %v", err)
+	}
+	return &testClient{t: t, server: srv, http: &http.Client{Jar: jar}}
+}
+
+// do sends payload as JSON (when non-nil) and returns the status and body.
+func (c *testClient) do(method, path string, payload interface{}) (int, []byte) {
+	c.t.Helper()
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			c.t.Fatalf("encode %s %s: %v", method, path, err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server.URL+path, body)
+	if err != nil {
+		c.t.Fatalf("build %s %s: %v", method, path, err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("read %s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, data
+}
+
+// expect is do that fails the test unless the status matches, decoding the
+// body into out when out is non-nil.
+func (c *testClient) expect(want int, method, path string, payload, out interface{}) {
+	c.t.Helper()
+	status, body := c.do(method, path, payload)
+	if status != want {
+		c.t.Fatalf("%s %s: got %d want %d (body: %s)", method, path, status, want, body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(body, out); err != nil {
+			c.t.Fatalf("decode %s %s: %v (body: %s)", method, path, err, body)
+		}
+	}
+}
+
+// signUp registers email and logs in again, leaving the session in the jar.
+func (c *testClient) signUp(email, password string) {
+	c.t.Helper()
+	creds := credentials{Email: email, Password: password}
+	c.expect(http.StatusCreated, http.MethodPost, "/auth/register", creds, nil)
+	c.expect(http.StatusOK, http.MethodPost, "/auth/login", creds, nil)
+}
+
+func TestServerSessionLifecycle(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	c.expect(http.StatusUnauthorized, http.MethodGet, "/expenses", nil, nil)
+
+	c.signUp("session@example.com", "SessionSecretPass123!")
+	var expenses []Expense
+	c.expect(http.StatusOK, http.MethodGet, "/expenses", nil, &expenses)
+	if len(expenses) != 0 {
+		t.Fatalf("expected a new user to start with no expenses, got %d", len(expenses))
+	}
+
+	c.expect(http.StatusNoContent, http.MethodPost, "/auth/logout", nil, nil)
+	c.expect(http.StatusUnauthorized, http.MethodGet, "/expenses", nil, nil)
+}
+
+func TestServerUserIsolation(t *testing.T) {
+	srv := newTestServer(t)
+	alice := newTestClient(t, srv)
+	alice.signUp("alice@example.com", "AliceSecretPass123!")
+	bob := newTestClient(t, srv)
+	bob.signUp("bob@example.com", "BobSecretPass123!")
+
+	var account Account
+	alice.expect(http.StatusCreated, http.MethodPost, "/accounts", Account{Name: "Alice Wallet", Type: "Cash"}, &account)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var expense Expense
+	alice.expect(http.StatusCreated, http.MethodPost, "/expenses", Expense{Amount: 42, Category: "Private", Date: now, AccountID: &account.ID}, &expense)
+	var income Income
+	alice.expect(http.StatusCreated, http.MethodPost, "/incomes", Income{Amount: 100, Source: "Salary", Date: now, AccountID: &account.ID}, &income)
+	var budget Budget
+	alice.expect(http.StatusCreated, http.MethodPost, "/budgets", Budget{Category: "Private", Amount: 50, StartDate: now, EndDate: now.AddDate(0, 1, 0)}, &budget)
+	var recurring RecurringExpense
+	alice.expect(http.StatusCreated, http.MethodPost, "/recurring-expenses", RecurringExpense{Amount: 9, Category: "Private", Frequency: "monthly", NextDueDate: now.AddDate(0, 0, 7)}, &recurring)
+
+	owned := []string{
+		fmt.Sprintf("/expenses/%d", expense.ID),
+		fmt.Sprintf("/incomes/%d", income.ID),
+		fmt.Sprintf("/budgets/%d", budget.ID),
+		fmt.Sprintf("/recurring-expenses/%d", recurring.ID),
+		fmt.Sprintf("/accounts/%d", account.ID),
+	}
+	for _, path := range owned {
+		bob.expect(http.StatusNotFound, http.MethodGet, path, nil, nil)
+		bob.expect(http.StatusNotFound, http.MethodDelete, path, nil, nil)
+	}
+	bob.expect(http.StatusNotFound, http.MethodPut, owned[0], Expense{Amount: 1, Category: "Hijacked", Date: now}, nil)
+	bob.expect(http.StatusNotFound, http.MethodGet, fmt.Sprintf("/budgets/%d/progress", budget.ID), nil, nil)
+	bob.expect(http.StatusNotFound, http.MethodGet, fmt.Sprintf("/recurring-expenses/%d/history", recurring.ID), nil, nil)
+
+	var bobExpenses []Expense
+	bob.expect(http.StatusOK, http.MethodGet, "/expenses", nil, &bobExpenses)
+	if len(bobExpenses) != 0 {
+		t.Fatalf("expected bob to see no expenses, got %+v", bobExpenses)
+	}
+	var bobTotals map[string]float64
+	bob.expect(http.StatusOK, http.MethodGet, "/expenses/aggregates?query=totals_by_category", nil, &bobTotals)
+	if len(bobTotals) != 0 {
+		t.Fatalf("expected bob's totals to be empty, got %v", bobTotals)
+	}
+
+	// Bob's attempts left everything in place for Alice.
+	for _, path := range owned {
+		alice.expect(http.StatusOK, http.MethodGet, path, nil, nil)
+	}
+	var fetched Expense
+	alice.expect(http.StatusOK, http.MethodGet, owned[0], nil, &fetched)
+	if fetched.Category != "Private" || fetched.Amount != 42 {
+		t.Fatalf("expected alice's expense to be untouched, got %+v", fetched)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// UserSettings holds per-user preferences. Locale and Currency only change
+// how amounts are shown by reports requested with format=display; empty
+// means en-US grouping with no currency symbol. Timezone is an IANA zone
+// name used to read date-only inputs and group reports; empty means UTC.
+// ThresholdAmount raises a large_expense notification for any single
+// expense above it; nil or 0 turns the alert off. WeekStart is the day
+// weekly budgets start on, one of weekStarts. FiscalYearStartMonth, 1 to
+// 12, is the month fiscal years start in for reports asked for fiscal=true;
+// 0 means January.
+type UserSettings struct {
+	DefaultAccountID     *int     `json:"default_account_id"`
+	Locale               string   `json:"locale"`
+	Currency             string   `json:"currency"`
+	Timezone             string   `json:"timezone"`
+	ThresholdAmount      *float64 `json:"threshold_amount"`
+	WeekStart            string   `json:"week_start"`
+	FiscalYearStartMonth int      `json:"fiscal_year_start_month"`
+}
+
+// weekStarts are the days a week may start on. Weeks start on Monday, as
+// ISO weeks do, unless the user picks Sunday.
+var weekStarts = map[string]time.Weekday{
+	"monday": time.Monday,
+	"sunday": time.Sunday,
+}
+
+const defaultWeekStart = "monday"
+
+func (app *App) createSettingsTables() error {
+	settingsTableStmt := `
+    CREATE TABLE IF NOT EXISTS user_settings (
+        user_id INTEGER NOT NULL PRIMARY KEY,
+        default_account_id INTEGER,
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY(default_account_id) REFERENCES accounts(id) ON DELETE SET NULL
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(settingsTableStmt)); err != nil {
+		return fmt.Errorf("create user_settings table: %w", err)
+	}
+	if err := app.ensureColumn("user_settings", "locale", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := app.ensureColumn("user_settings", "currency", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := app.ensureColumn("user_settings", "timezone", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := app.ensureColumn("user_settings", "threshold_amount", "REAL"); err != nil {
+		return err
+	}
+	if err := app.ensureColumn("user_settings", "week_start", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	return app.ensureColumn("user_settings", "fiscal_year_start_month", fmt.Sprintf("INTEGER NOT NULL DEFAULT %d", defaultFiscalYearStartMonth))
+}
+
+// loadUserSettings returns the user's settings, or the defaults if the user
+// has never saved any.
+func loadUserSettings(q rowQuerier, userID int) (UserSettings, error) {
+	settings := UserSettings{WeekStart: defaultWeekStart, FiscalYearStartMonth: defaultFiscalYearStartMonth}
+	var defaultAccountID sql.NullInt64
+	var threshold sql.NullFloat64
+	err := q.QueryRow("SELECT default_account_id, locale, currency, timezone, threshold_amount, week_start, fiscal_year_start_month FROM user_settings WHERE user_id = ?", userID).
+		Scan(&defaultAccountID, &settings.Locale, &settings.Currency, &settings.Timezone, &threshold, &settings.WeekStart, &settings.FiscalYearStartMonth)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	} else if err != nil {
+		return settings, err
+	}
+	settings.DefaultAccountID = nullIntPtr(defaultAccountID)
+	settings.ThresholdAmount = nullFloatPtr(threshold)
+	if settings.WeekStart == "" {
+		settings.WeekStart = defaultWeekStart
+	}
+	return settings, nil
+}
+
+// resolveAccountID returns accountID if one was supplied, otherwise the
+// user's default account. It writes a 400 when neither is available, or
+// when the supplied account is not one the user can see.
+func (app *App) resolveAccountID(w http.ResponseWriter, userID int, accountID *int) (*int, bool) {
+	if accountID != nil && *accountID != 0 {
+		if _, err := fetchAccount(app.db, userID, *accountID); err == sql.ErrNoRows {
+			http.Error(w, "Account not found", http.StatusBadRequest)
+			return nil, false
+		} else if err != nil {
+			log.Printf("account fetch error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil, false
+		}
+		return accountID, true
+	}
+
+	settings, err := loadUserSettings(app.db, userID)
+	if err != nil {
+		log.Printf("user settings lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if settings.DefaultAccountID == nil {
+		http.Error(w, "Account is required", http.StatusBadRequest)
+		return nil, false
+	}
+	return settings.DefaultAccountID, true
+}
+
+func (app *App) getSettings(w http.ResponseWriter, r *http.Request, userID int) {
+	settings, err := loadUserSettings(app.requestDB(r), userID)
+	if err != nil {
+		log.Printf("user settings lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func (app *App) updateSettings(w http.ResponseWriter, r *http.Request, userID int) {
+	var settings UserSettings
+	if !decodeJSONBody(w, r, &settings) {
+		return
+	}
+
+	settings.Currency = strings.ToUpper(strings.TrimSpace(settings.Currency))
+	if _, ok := moneyLocales[settings.Locale]; settings.Locale != "" && !ok {
+		http.Error(w, "Unsupported locale; use one of "+strings.Join(slices.Sorted(maps.Keys(moneyLocales)), ", "), http.StatusBadRequest)
+		return
+	}
+	if _, ok := currencyFormats[settings.Currency]; settings.Currency != "" && !ok {
+		http.Error(w, "Unsupported currency; use one of "+strings.Join(slices.Sorted(maps.Keys(currencyFormats)), ", "), http.StatusBadRequest)
+		return
+	}
+	settings.Timezone = strings.TrimSpace(settings.Timezone)
+	if _, err := loadLocation(settings.Timezone); err != nil {
+		http.Error(w, "Unknown timezone; use an IANA name such as Asia/Jakarta", http.StatusBadRequest)
+		return
+	}
+
+	settings.WeekStart = strings.ToLower(strings.TrimSpace(settings.WeekStart))
+	if settings.WeekStart == "" {
+		settings.WeekStart = defaultWeekStart
+	}
+	if _, ok := weekStarts[settings.WeekStart]; !ok {
+		http.Error(w, "Invalid week_start; use monday or sunday", http.StatusBadRequest)
+		return
+	}
+
+	if settings.FiscalYearStartMonth == 0 {
+		settings.FiscalYearStartMonth = defaultFiscalYearStartMonth
+	}
+	if settings.FiscalYearStartMonth < 1 || settings.FiscalYearStartMonth > 12 {
+		http.Error(w, "Invalid fiscal_year_start_month; use a month from 1 to 12", http.StatusBadRequest)
+		return
+	}
+
+	if settings.ThresholdAmount != nil && *settings.ThresholdAmount < 0 {
+		http.Error(w, "threshold_amount must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if settings.DefaultAccountID != nil {
+		if _, err := fetchAccount(app.db, userID, *settings.DefaultAccountID); err == sql.ErrNoRows {
+			http.Error(w, "Default account not found", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("account fetch error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_, err := app.db.Exec(`INSERT INTO user_settings(user_id, default_account_id, locale, currency, timezone, threshold_amount, week_start, fiscal_year_start_month) VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(user_id) DO UPDATE SET default_account_id = excluded.default_account_id,
+            locale = excluded.locale, currency = excluded.currency, timezone = excluded.timezone,
+            threshold_amount = excluded.threshold_amount, week_start = excluded.week_start,
+            fiscal_year_start_month = excluded.fiscal_year_start_month`,
+		userID, settings.DefaultAccountID, settings.Locale, settings.Currency, settings.Timezone, settings.ThresholdAmount, settings.WeekStart, settings.FiscalYearStartMonth)
+	if err != nil {
+		log.Printf("user settings update error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
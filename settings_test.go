@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDefaultAccountFallback(t *testing.T) {
+	useTestDB(t)
+
+	accountRR := callAuthed(http.MethodPost, "/accounts", Account{Name: "Quick Entry", Type: "Cash", Balance: 100})
+	expectStatus(t, accountRR, http.StatusCreated)
+	account := decodeBody[Account](t, accountRR)
+
+	missingRR := callAuthed(http.MethodPut, "/settings", UserSettings{DefaultAccountID: intPtr(account.ID + 1000)})
+	expectStatus(t, missingRR, http.StatusBadRequest)
+
+	settingsRR := callAuthed(http.MethodPut, "/settings", UserSettings{DefaultAccountID: &account.ID})
+	expectStatus(t, settingsRR, http.StatusOK)
+
+	expense := Expense{Amount: 30, Category: "Coffee", Date: time.Now().UTC()}
+	createRR := callAuthed(http.MethodPost, "/expenses", expense)
+	expectStatus(t, createRR, http.StatusCreated)
+	created := decodeBody[Expense](t, createRR)
+	if created.AccountID == nil || *created.AccountID != account.ID {
+		t.Fatalf("expected expense to fall back to default account %d, got %v", account.ID, created.AccountID)
+	}
+
+	var balance float64
+	testApp.db.QueryRow("SELECT balance FROM accounts WHERE id = ?", account.ID).Scan(&balance)
+	if balance != 70 {
+		t.Fatalf("expected default account balance 70, got %.2f", balance)
+	}
+
+	deleteRR := callAuthed(http.MethodDelete, fmt.Sprintf("/accounts/%d", account.ID), nil)
+	expectStatus(t, deleteRR, http.StatusNoContent)
+
+	getRR := callAuthed(http.MethodGet, "/settings", nil)
+	expectStatus(t, getRR, http.StatusOK)
+	if settings := decodeBody[UserSettings](t, getRR); settings.DefaultAccountID != nil {
+		t.Fatalf("expected default account to be cleared, got %d", *settings.DefaultAccountID)
+	}
+
+	incomeRR := callAuthed(http.MethodPost, "/incomes", Income{Amount: 10, Source: "Gift", Date: time.Now().UTC()})
+	expectStatus(t, incomeRR, http.StatusBadRequest)
+}
+
+func TestExplicitAccountMustBeVisible(t *testing.T) {
+	useTestDB(t)
+	strict := false
+	foreign := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Strict", Type: "cash", Balance: 5, AllowNegative: &strict}))
+	cookie, intruderID := registerUser(t, "intruder@example.com", "IntruderPass123!")
+
+	for _, accountID := range []int{foreign.ID, testAccountID, foreign.ID + 1000} {
+		for target, payload := range map[string]interface{}{
+			"/expenses": Expense{Amount: 50, Category: "Food", Date: time.Now().UTC(), AccountID: intPtr(accountID)},
+			"/incomes":  Income{Amount: 50, Source: "Gift", Date: time.Now().UTC(), AccountID: intPtr(accountID)},
+		} {
+			rr := callAuthedAs(cookie, http.MethodPost, target, payload)
+			expectStatus(t, rr, http.StatusBadRequest)
+			if body := rr.Body.String(); body != "Account not found\n" {
+				t.Fatalf("expected Account not found for POST %s with account %d, got %q", target, accountID, body)
+			}
+		}
+	}
+
+	var count int
+	testApp.db.QueryRow("SELECT (SELECT COUNT(*) FROM expenses WHERE user_id = ?) + (SELECT COUNT(*) FROM incomes WHERE user_id = ?)", intruderID, intruderID).Scan(&count)
+	if count != 0 {
+		t.Fatalf("expected nothing stored for the intruder, got %d rows", count)
+	}
+	if a := decodeBody[Account](t, callAuthed(http.MethodGet, fmt.Sprintf("/accounts/%d", foreign.ID), nil)); a.Balance != 5 {
+		t.Fatalf("expected the strict account untouched, got %v", a.Balance)
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
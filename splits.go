@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// splitAmountTolerance absorbs float rounding when comparing the sum of
+// split amounts against the parent expense.
+const splitAmountTolerance = 0.005
+
+// expenseCategoryLines expands every expense into one row per category it
+// was spent on: split expenses yield a row per split, everything else a
+// single row at the parent's category. Category reports select from it in
+// place of the expenses table.
+const expenseCategoryLines = `(
+    SELECT e.id AS expense_id, e.user_id AS user_id, e.household_id AS household_id,
+        e.account_id AS account_id,
+        COALESCE(s.category, e.category) AS category,
+        COALESCE(s.amount, e.amount) AS amount,
+        e.date AS date
+    FROM expenses e
+    LEFT JOIN expense_splits s ON s.expense_id = e.id
+) AS lines`
+
+type ExpenseSplit struct {
+	ID       int     `json:"id"`
+	Category string  `json:"category"`
+	Amount   float64 `json:"amount"`
+	Note     string  `json:"note"`
+}
+
+func (app *App) createSplitTables() error {
+	splitsTableStmt := `
+    CREATE TABLE IF NOT EXISTS expense_splits (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        expense_id INTEGER NOT NULL,
+        category TEXT NOT NULL,
+        amount REAL NOT NULL,
+        note TEXT,
+        FOREIGN KEY(expense_id) REFERENCES expenses(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(splitsTableStmt)); err != nil {
+		return fmt.Errorf("create expense_splits table: %w", err)
+	}
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_expense_splits_expense ON expense_splits(expense_id)"); err != nil {
+		return fmt.Errorf("create expense_splits index: %w", err)
+	}
+	return nil
+}
+
+// validateSplits checks that every split has a category and a positive
+// amount, and that together they add up to the parent amount. An empty
+// slice is valid and means the expense is not split.
+func validateSplits(amount float64, splits []ExpenseSplit) error {
+	if len(splits) == 0 {
+		return nil
+	}
+
+	var total float64
+	for i := range splits {
+		splits[i].Category = strings.TrimSpace(splits[i].Category)
+		if splits[i].Category == "" {
+			return errors.New("Split category is required")
+		}
+		if splits[i].Amount <= 0 {
+			return errors.New("Split amount must be positive")
+		}
+		total += splits[i].Amount
+	}
+
+	if math.Abs(total-amount) > splitAmountTolerance {
+		return errors.New("Splits must sum to the expense amount")
+	}
+	return nil
+}
+
+// replaceExpenseSplits swaps the stored splits of an expense for splits,
+// filling in the new IDs.
+func replaceExpenseSplits(tx txQuerier, expenseID int, splits []ExpenseSplit) error {
+	if _, err := tx.Exec("DELETE FROM expense_splits WHERE expense_id = ?", expenseID); err != nil {
+		return fmt.Errorf("delete expense splits: %w", err)
+	}
+
+	for i := range splits {
+		id, err := insertReturningID(tx, "INSERT INTO expense_splits(expense_id, category, amount, note) VALUES(?, ?, ?, ?)", expenseID, splits[i].Category, splits[i].Amount, splits[i].Note)
+		if err != nil {
+			return fmt.Errorf("insert expense split: %w", err)
+		}
+		splits[i].ID = id
+	}
+	return nil
+}
+
+func loadExpenseSplits(q rowsQuerier, expenseID int) ([]ExpenseSplit, error) {
+	rows, err := q.Query("SELECT id, category, amount, COALESCE(note, '') FROM expense_splits WHERE expense_id = ? ORDER BY id", expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var splits []ExpenseSplit
+	for rows.Next() {
+		var s ExpenseSplit
+		if err := rows.Scan(&s.ID, &s.Category, &s.Amount, &s.Note); err != nil {
+			return nil, err
+		}
+		splits = append(splits, s)
+	}
+	return splits, rows.Err()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExpenseSplits(t *testing.T) {
+	useTestDB(t)
+
+	mismatched := Expense{
+		Amount:    50,
+		Category:  "Supermarket",
+		Date:      time.Now().UTC(),
+		AccountID: testAccount(),
+		Splits: []ExpenseSplit{
+			{Category: "Groceries", Amount: 30},
+			{Category: "Household", Amount: 10},
+		},
+	}
+	badRR := callAuthed(http.MethodPost, "/expenses", mismatched)
+	expectStatus(t, badRR, http.StatusBadRequest)
+
+	split := mismatched
+	split.Splits = []ExpenseSplit{
+		{Category: "Groceries", Amount: 35, Note: "Food"},
+		{Category: "Household", Amount: 15},
+	}
+	createRR := callAuthed(http.MethodPost, "/expenses", split)
+	expectStatus(t, createRR, http.StatusCreated)
+	created := decodeBody[Expense](t, createRR)
+
+	plain := Expense{Amount: 20, Category: "Groceries", Date: time.Now().UTC(), AccountID: testAccount()}
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", plain), http.StatusCreated)
+
+	getRR := callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", created.ID), nil)
+	expectStatus(t, getRR, http.StatusOK)
+	fetched := decodeBody[Expense](t, getRR)
+	if len(fetched.Splits) != 2 || fetched.Splits[0].Category != "Groceries" || fetched.Splits[0].Note != "Food" {
+		t.Fatalf("expected splits to be returned, got %+v", fetched.Splits)
+	}
+
+	listRR := callAuthed(http.MethodGet, "/expenses?category=Household", nil)
+	expectStatus(t, listRR, http.StatusOK)
+	listed := decodeBody[[]Expense](t, listRR)
+	if len(listed) != 1 || listed[0].ID != created.ID || !listed[0].HasSplits {
+		t.Fatalf("expected split expense flagged in list, got %+v", listed)
+	}
+
+	totalsRR := callAuthed(http.MethodGet, "/expenses/aggregates?query=totals_by_category", nil)
+	expectStatus(t, totalsRR, http.StatusOK)
+	totals := decodeBody[map[string]float64](t, totalsRR)
+	if totals["Groceries"] != 55 || totals["Household"] != 15 || totals["Supermarket"] != 0 {
+		t.Fatalf("expected split categories in totals, got %v", totals)
+	}
+
+	unsplit := created
+	unsplit.Splits = nil
+	updateRR := callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", created.ID), unsplit)
+	expectStatus(t, updateRR, http.StatusOK)
+
+	var remaining int
+	testApp.db.QueryRow("SELECT COUNT(*) FROM expense_splits WHERE expense_id = ?", created.ID).Scan(&remaining)
+	if remaining != 0 {
+		t.Fatalf("expected update without splits to clear them, found %d", remaining)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const statsDateFormat = "2006-01-02"
+
+// ExpenseStats summarises the user's expenses between From and To, both
+// inclusive calendar days. ProjectedMonthEnd is only set when the range is
+// the current month.
+type ExpenseStats struct {
+	From              string        `json:"date_from"`
+	To                string        `json:"date_to"`
+	Count             int           `json:"count"`
+	Total             float64       `json:"total"`
+	Average           float64       `json:"average"`
+	Median            float64       `json:"median"`
+	Largest           *LargestSpend `json:"largest"`
+	Days              int           `json:"days"`
+	DailyAverage      float64       `json:"daily_average"`
+	ProjectedMonthEnd *float64      `json:"projected_month_end"`
+	// Display is filled in with format=display, as for MonthlyReport.
+	Display map[string]string `json:"display,omitempty"`
+}
+
+type LargestSpend struct {
+	ID       int               `json:"id"`
+	Amount   float64           `json:"amount"`
+	Category string            `json:"category"`
+	Date     time.Time         `json:"date"`
+	Display  map[string]string `json:"display,omitempty"`
+}
+
+// expenseStatsHandler serves GET /expenses/stats. date_from defaults to the
+// first of the current month and date_to to today, so a bare request
+// reports month-to-date spending with a month-end projection.
+func (app *App) expenseStatsHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	today := localDay(time.Now(), loc)
+	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	money, ok := app.displayFormatter(w, r, userID)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+	from, ok := parseDayParam(w, params.Get("date_from"), "date_from", monthStart, loc)
+	if !ok {
+		return
+	}
+	to, ok := parseDayParam(w, params.Get("date_to"), "date_to", today, loc)
+	if !ok {
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "date_to must not be before date_from", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := computeExpenseStats(app.requestDB(r), userID, from, to, today, loc)
+	if err != nil {
+		log.Printf("expense stats error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if money != nil {
+		amounts := map[string]float64{"total": stats.Total, "average": stats.Average, "median": stats.Median, "daily_average": stats.DailyAverage}
+		if stats.ProjectedMonthEnd != nil {
+			amounts["projected_month_end"] = *stats.ProjectedMonthEnd
+		}
+		stats.Display = money.amounts(amounts)
+		if stats.Largest != nil {
+			stats.Largest.Display = money.amounts(map[string]float64{"amount": stats.Largest.Amount})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// parseDayParam reads a date parameter as a calendar day, falling back to
+// def when it is absent. A full timestamp counts as the day it falls on in
+// loc. It writes a 400 when the value does not parse.
+func parseDayParam(w http.ResponseWriter, raw, name string, def time.Time, loc *time.Location) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return def, true
+	}
+	if day, err := time.Parse(statsDateFormat, raw); err == nil {
+		return day, true
+	}
+	t, err := parseTimestamp(raw)
+	if err != nil {
+		http.Error(w, "Invalid "+name, http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return localDay(t, loc), true
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return localDay(t, time.UTC)
+}
+
+// computeExpenseStats aggregates in SQL so only the one or two middle rows
+// are read for the median, however many expenses fall in the range. from,
+// to and today are calendar days in loc.
+func computeExpenseStats(q querier, userID int, from, to, today time.Time, loc *time.Location) (ExpenseStats, error) {
+	stats := ExpenseStats{From: from.Format(statsDateFormat), To: to.Format(statsDateFormat)}
+	where := " FROM expenses WHERE user_id = ? AND date >= ? AND date < ?"
+	args := []interface{}{userID, dayStart(from, loc), dayStart(to.AddDate(0, 0, 1), loc)}
+
+	if err := q.QueryRow("SELECT COUNT(*), COALESCE(SUM(amount), 0)"+where, args...).Scan(&stats.Count, &stats.Total); err != nil {
+		return stats, err
+	}
+
+	// The burn rate is measured over the days elapsed so far when the range
+	// runs into the future.
+	end := to
+	if !from.After(today) && end.After(today) {
+		end = today
+	}
+	stats.Days = int(end.Sub(from).Hours()/24) + 1
+
+	if stats.Count > 0 {
+		stats.Average = roundCents(stats.Total / float64(stats.Count))
+
+		median, err := medianAmount(q, where, args, stats.Count)
+		if err != nil {
+			return stats, err
+		}
+		stats.Median = roundCents(median)
+
+		var largest LargestSpend
+		var dateStr string
+		if err := q.QueryRow("SELECT id, amount, category, date"+where+" ORDER BY amount DESC, id LIMIT 1", args...).Scan(&largest.ID, &largest.Amount, &largest.Category, &dateStr); err != nil {
+			return stats, err
+		}
+		if largest.Date, err = parseTimestamp(dateStr); err != nil {
+			return stats, err
+		}
+		stats.Largest = &largest
+	}
+	stats.DailyAverage = roundCents(stats.Total / float64(stats.Days))
+
+	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	monthEnd := monthStart.AddDate(0, 1, -1)
+	if from.Equal(monthStart) && !to.Before(today) && !to.After(monthEnd) {
+		projected := roundCents(stats.Total / float64(stats.Days) * float64(daysInMonth(today)))
+		stats.ProjectedMonthEnd = &projected
+	}
+	return stats, nil
+}
+
+// medianAmount reads the middle one (odd count) or two (even count) amounts
+// in order and averages them.
+func medianAmount(q rowsQuerier, where string, args []interface{}, count int) (float64, error) {
+	limit := 2 - count%2
+	offset := (count - 1) / 2
+	rows, err := q.Query("SELECT amount"+where+" ORDER BY amount LIMIT ? OFFSET ?", append(append([]interface{}{}, args...), limit, offset)...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var sum float64
+	n := 0
+	for rows.Next() {
+		var amount float64
+		if err := rows.Scan(&amount); err != nil {
+			return 0, err
+		}
+		sum += amount
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return sum / float64(n), nil
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
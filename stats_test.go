@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExpenseStatsForRange(t *testing.T) {
+	useTestDB(t)
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var largestID int
+	for i, amount := range []float64{10, 40, 20, 100, 30} {
+		e := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: amount, Category: "Misc", Date: base.AddDate(0, 0, i*2), AccountID: testAccount()}))
+		if amount == 100 {
+			largestID = e.ID
+		}
+	}
+	// Outside the range on both sides.
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 999, Category: "Misc", Date: base.AddDate(0, 0, -1), AccountID: testAccount()}), http.StatusCreated)
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 999, Category: "Misc", Date: base.AddDate(0, 0, 10), AccountID: testAccount()}), http.StatusCreated)
+
+	rr := callAuthed(http.MethodGet, "/expenses/stats?date_from=2024-03-01&date_to=2024-03-10", nil)
+	expectStatus(t, rr, http.StatusOK)
+	stats := decodeBody[ExpenseStats](t, rr)
+	if stats.Count != 5 || stats.Total != 200 || stats.Average != 40 || stats.Median != 30 {
+		t.Fatalf("unexpected totals: %+v", stats)
+	}
+	if stats.Largest == nil || stats.Largest.ID != largestID || stats.Largest.Amount != 100 {
+		t.Fatalf("expected largest expense %d, got %+v", largestID, stats.Largest)
+	}
+	if stats.Days != 10 || stats.DailyAverage != 20 {
+		t.Fatalf("expected 20/day over 10 days, got %.2f over %d", stats.DailyAverage, stats.Days)
+	}
+	if stats.ProjectedMonthEnd != nil {
+		t.Fatalf("expected no projection for a past range, got %v", *stats.ProjectedMonthEnd)
+	}
+
+	even := decodeBody[ExpenseStats](t, callAuthed(http.MethodGet, "/expenses/stats?date_from=2024-03-01&date_to=2024-03-07", nil))
+	if even.Count != 4 || even.Median != 30 {
+		t.Fatalf("expected the median of 10, 20, 40, 100 to be 30, got %+v", even)
+	}
+
+	empty := decodeBody[ExpenseStats](t, callAuthed(http.MethodGet, "/expenses/stats?date_from=2023-01-01&date_to=2023-01-31", nil))
+	if empty.Count != 0 || empty.Total != 0 || empty.Largest != nil || empty.Days != 31 {
+		t.Fatalf("unexpected stats for an empty range: %+v", empty)
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses/stats?date_from=soon", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses/stats?date_from=2024-03-10&date_to=2024-03-01", nil), http.StatusBadRequest)
+}
+
+func TestExpenseStatsProjectsCurrentMonth(t *testing.T) {
+	useTestDB(t)
+
+	today := truncateToDay(time.Now())
+	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 50, Category: "Misc", Date: monthStart, AccountID: testAccount()}), http.StatusCreated)
+
+	stats := decodeBody[ExpenseStats](t, callAuthed(http.MethodGet, "/expenses/stats", nil))
+	elapsed := today.Day()
+	if stats.From != monthStart.Format(statsDateFormat) || stats.Days != elapsed {
+		t.Fatalf("expected month-to-date defaults, got %+v", stats)
+	}
+	want := roundCents(50 / float64(elapsed) * float64(daysInMonth(today)))
+	if stats.ProjectedMonthEnd == nil || *stats.ProjectedMonthEnd != want {
+		t.Fatalf("expected projection %.2f, got %v", want, stats.ProjectedMonthEnd)
+	}
+}
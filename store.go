@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/lib/pq"
+)
+
+// sqlDialect covers the SQL that differs between the supported databases.
+// Queries are written once with ? placeholders and SQLite column types; the
+// Postgres driver rewrites placeholders, and everything else that differs
+// goes through the dialect in use, App.dialect.
+type sqlDialect interface {
+	// schema adapts a CREATE TABLE or ADD COLUMN statement written with
+	// SQLite column types.
+	schema(stmt string) string
+	hasColumn(q rowsQuerier, table, column string) (bool, error)
+	// least yields the smaller of two values.
+	least(a, b string) string
+}
+
+// memoryDatabases numbers in-memory databases so each open gets its own.
+var memoryDatabases atomic.Int64
+
+// openDatabase connects to the database cfg.DBDriver selects, timing its
+// statements out and logging slow ones as cfg says.
+func openDatabase(cfg Config) (*sql.DB, error) {
+	limits := cfg.queryLimits()
+	switch cfg.DBDriver {
+	case dbDriverPostgres:
+		return sql.OpenDB(timedConnector{rebindDriver{pq.Driver{}}, cfg.DatabaseURL, limits}), nil
+	case dbDriverMemory:
+		// A private in-memory SQLite database that is gone once its
+		// connection closes. Shared-cache connections fail with "table is
+		// locked" instead of waiting for each other, so a single connection
+		// serializes access. It runs the same SQL as the file-backed store,
+		// so the two behave alike.
+		name := fmt.Sprintf("file:expense-tracker-%d?mode=memory&cache=shared&_foreign_keys=on", memoryDatabases.Add(1))
+		conn := sql.OpenDB(timedConnector{sqliteDriver, name, limits})
+		conn.SetMaxOpenConns(1)
+		return conn, nil
+	}
+	// Foreign keys are enabled through the DSN so every pooled connection
+	// enforces them; a one-off PRAGMA only affects a single connection.
+	return sql.OpenDB(timedConnector{sqliteDriver, cfg.DBPath + "?_foreign_keys=on", limits}), nil
+}
+
+// insertReturningID runs an INSERT and returns the id of the new row. It
+// returns sql.ErrNoRows when an ON CONFLICT clause skipped the insert.
+func insertReturningID(q rowQuerier, query string, args ...interface{}) (int, error) {
+	var id int
+	err := q.QueryRow(query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) schema(stmt string) string { return stmt }
+
+func (sqliteDialect) hasColumn(q rowsQuerier, table, column string) (bool, error) {
+	rows, err := q.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid int
+		var name, ctype string
+		var notNull, pk int
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if strings.EqualFold(name, column) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func (sqliteDialect) least(a, b string) string { return "MIN(" + a + ", " + b + ")" }
+
+// postgresDialect keeps the SQLite storage model: timestamps stay in TEXT
+// columns in timeFormat, so string comparisons on them behave the same, and
+// flags stay INTEGER 0/1.
+type postgresDialect struct{}
+
+var postgresTypes = strings.NewReplacer(
+	"INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+	"DATETIME", "TEXT",
+	"REAL", "DOUBLE PRECISION",
+)
+
+func (postgresDialect) schema(stmt string) string { return postgresTypes.Replace(stmt) }
+
+func (postgresDialect) hasColumn(q rowsQuerier, table, column string) (bool, error) {
+	rows, err := q.Query("SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?", table, strings.ToLower(column))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	found := rows.Next()
+	return found, rows.Err()
+}
+
+func (postgresDialect) least(a, b string) string { return "LEAST(" + a + ", " + b + ")" }
+
+// rebind numbers the ? placeholders in query, leaving quoted strings and
+// identifiers alone.
+func rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// rebindDriver wraps lib/pq so the ? placeholders used throughout the code
+// become $1, $2, ... and Go bools are stored as 0/1 like in SQLite.
+type rebindDriver struct {
+	driver.Driver
+}
+
+func (d rebindDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return rebindConn{conn}, nil
+}
+
+type rebindConn struct {
+	driver.Conn
+}
+
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, rebind(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return nil, fmt.Errorf("postgres driver does not support BeginTx")
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c rebindConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := nv.Value.(bool); ok {
+		nv.Value = int64(0)
+		if v {
+			nv.Value = int64(1)
+		}
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (c rebindConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c rebindConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c rebindConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	cases := map[string]string{
+		"SELECT id FROM expenses WHERE user_id = ? AND date >= ?":    "SELECT id FROM expenses WHERE user_id = $1 AND date >= $2",
+		"SELECT '?' AS q, note FROM expenses WHERE note = ?":         "SELECT '?' AS q, note FROM expenses WHERE note = $1",
+		`SELECT "odd?name" FROM t WHERE a = ? AND b = 'it''s?' OR ?`: `SELECT "odd?name" FROM t WHERE a = $1 AND b = 'it''s?' OR $2`,
+		"DELETE FROM sessions": "DELETE FROM sessions",
+	}
+	for in, want := range cases {
+		if got := rebind(in); got != want {
+			t.Errorf("rebind(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPostgresSchema(t *testing.T) {
+	stmt := postgresDialect{}.schema(`CREATE TABLE IF NOT EXISTS expenses (
+        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        amount REAL NOT NULL,
+        date DATETIME NOT NULL,
+        user_id INTEGER NOT NULL
+    )`)
+	for _, want := range []string{"id SERIAL PRIMARY KEY", "amount DOUBLE PRECISION NOT NULL", "date TEXT NOT NULL", "user_id INTEGER NOT NULL"} {
+		if !strings.Contains(stmt, want) {
+			t.Fatalf("expected %q in translated schema:\n%s", want, stmt)
+		}
+	}
+	if alter := (postgresDialect{}).schema("ALTER TABLE users ADD COLUMN deactivated_at DATETIME"); alter != "ALTER TABLE users ADD COLUMN deactivated_at TEXT" {
+		t.Fatalf("unexpected translated column: %s", alter)
+	}
+}
+
+// TestDatabaseDriversAgree runs a few server tests against both the
+// in-memory and the file-backed SQLite database, whatever TEST_DB_DRIVER
+// says, so the two cannot drift apart. Run the whole suite with
+// TEST_DB_DRIVER=sqlite for full coverage of the file database.
+func TestDatabaseDriversAgree(t *testing.T) {
+	if os.Getenv("TEST_DATABASE_URL") != "" {
+		t.Skip("running against Postgres")
+	}
+	suite := map[string]func(*testing.T){
+		"UserIsolation":    TestServerUserIsolation,
+		"SessionLifecycle": TestServerSessionLifecycle,
+		"BalanceUpdates":   TestAccountIDRoundTripsThroughUpdates,
+		"AccountFilter":    TestAccountFilterOnTransactionLists,
+		"ReportGrouping":   TestIncomeVsExpenseReportGrouping,
+	}
+	for _, driver := range []string{dbDriverMemory, dbDriverSQLite} {
+		t.Run(driver, func(t *testing.T) {
+			t.Setenv("TEST_DB_DRIVER", driver)
+			for name, test := range suite {
+				t.Run(name, test)
+			}
+		})
+	}
+}
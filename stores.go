@@ -0,0 +1,107 @@
+package main
+
+// ExpenseStore keeps expense rows. It sees only the expenses of userID and
+// of the households userID belongs to: fetching one it can't see returns
+// sql.ErrNoRows, and writes leave it alone. Splits, audit entries and the
+// rest of what a handler writes next to the row are kept by their own
+// helpers.
+type ExpenseStore interface {
+	FetchExpense(userID, id int) (Expense, error)
+	// InsertExpense stores e for userID and returns its id. e.Timestamps
+	// must be set.
+	InsertExpense(userID int, e Expense) (int, error)
+	// UpdateExpense overwrites the expense with e's ID, keeping its
+	// created_at and recurring_expense_id.
+	UpdateExpense(userID int, e Expense) error
+	DeleteExpense(userID, id int) error
+}
+
+// AccountStore keeps accounts and their balances, seen as ExpenseStore sees
+// expenses. Balance changes take the time they happen at as formatted with
+// timeFormat, which becomes the account's updated_at.
+type AccountStore interface {
+	FetchAccount(userID, id int) (Account, error)
+	// InsertAccount stores a for userID and returns its id. a.Timestamps
+	// and a.AllowNegative must be set.
+	InsertAccount(userID int, a Account) (int, error)
+	UpdateAccount(userID int, a Account) error
+	DeleteAccount(userID, id int) error
+	AdjustBalance(userID, id int, delta float64, now string) error
+	// DebitBalance takes amount from the account unless that would leave a
+	// strict account below zero, and reports whether it did. Half a cent of
+	// slack keeps float noise from refusing an exact match.
+	DebitBalance(userID, id int, amount float64, now string) (bool, error)
+}
+
+// Store is what the expense and account handlers keep their rows in.
+type Store interface {
+	ExpenseStore
+	AccountStore
+}
+
+// sqlStore is the Store over the SQLite or Postgres database. Its
+// statements run through q, so they are part of the caller's transaction.
+type sqlStore struct {
+	q txQuerier
+}
+
+func newSQLStore(q txQuerier) Store {
+	return sqlStore{q}
+}
+
+func (s sqlStore) FetchExpense(userID, id int) (Expense, error) {
+	return fetchExpense(s.q, userID, id)
+}
+
+func (s sqlStore) InsertExpense(userID int, e Expense) (int, error) {
+	return insertReturningID(s.q, "INSERT INTO expenses(amount, category, note, payee, date, user_id, account_id, household_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.Amount, e.Category, e.Note, e.Payee, e.Date.UTC().Format(timeFormat), userID, e.AccountID, e.HouseholdID, e.CreatedAt.UTC().Format(timeFormat), e.UpdatedAt.UTC().Format(timeFormat))
+}
+
+func (s sqlStore) UpdateExpense(userID int, e Expense) error {
+	_, err := s.q.Exec("UPDATE expenses SET amount = ?, category = ?, note = ?, payee = ?, date = ?, account_id = ?, household_id = ?, updated_at = ? WHERE id = ? AND "+householdScope,
+		e.Amount, e.Category, e.Note, e.Payee, e.Date.UTC().Format(timeFormat), e.AccountID, e.HouseholdID, e.UpdatedAt.UTC().Format(timeFormat), e.ID, userID, userID)
+	return err
+}
+
+func (s sqlStore) DeleteExpense(userID, id int) error {
+	_, err := s.q.Exec("DELETE FROM expenses WHERE id = ? AND "+householdScope, id, userID, userID)
+	return err
+}
+
+func (s sqlStore) FetchAccount(userID, id int) (Account, error) {
+	return fetchAccount(s.q, userID, id)
+}
+
+func (s sqlStore) InsertAccount(userID int, a Account) (int, error) {
+	return insertReturningID(s.q, "INSERT INTO accounts(name, type, balance, allow_negative, minimum_balance, user_id, household_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		a.Name, a.Type, a.Balance, *a.AllowNegative, a.MinimumBalance, userID, a.HouseholdID, a.CreatedAt.UTC().Format(timeFormat), a.UpdatedAt.UTC().Format(timeFormat))
+}
+
+func (s sqlStore) UpdateAccount(userID int, a Account) error {
+	_, err := s.q.Exec("UPDATE accounts SET name = ?, type = ?, balance = ?, allow_negative = ?, minimum_balance = ?, household_id = ?, updated_at = ? WHERE id = ? AND "+householdScope,
+		a.Name, a.Type, a.Balance, *a.AllowNegative, a.MinimumBalance, a.HouseholdID, a.UpdatedAt.UTC().Format(timeFormat), a.ID, userID, userID)
+	return err
+}
+
+func (s sqlStore) DeleteAccount(userID, id int) error {
+	_, err := s.q.Exec("DELETE FROM accounts WHERE id = ? AND "+householdScope, id, userID, userID)
+	return err
+}
+
+func (s sqlStore) AdjustBalance(userID, id int, delta float64, now string) error {
+	_, err := s.q.Exec("UPDATE accounts SET balance = balance + ?, updated_at = ? WHERE id = ? AND "+householdScope, delta, now, id, userID, userID)
+	return err
+}
+
+func (s sqlStore) DebitBalance(userID, id int, amount float64, now string) (bool, error) {
+	// The check and the update are one statement, so concurrent expenses
+	// cannot overdraw the account between them.
+	res, err := s.q.Exec("UPDATE accounts SET balance = balance - ?, updated_at = ? WHERE id = ? AND (allow_negative = 1 OR balance - ? > -0.005) AND "+householdScope,
+		amount, now, id, amount, userID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
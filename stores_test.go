@@ -0,0 +1,270 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// storeFixture is a Store with two users in it and a way to put them in a
+// household together.
+type storeFixture struct {
+	store        Store
+	owner, other int
+	household    func(t *testing.T, members ...int) int
+}
+
+// TestStoreConformance runs the same checks against the in-memory Store and
+// the SQL one, on whichever database the suite uses, so they keep behaving
+// alike.
+func TestStoreConformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testStore(t, func(t *testing.T) storeFixture {
+			m := newMemStore()
+			next := 0
+			return storeFixture{store: m, owner: 1, other: 2, household: func(t *testing.T, members ...int) int {
+				next++
+				for _, userID := range members {
+					m.joinHousehold(next, userID)
+				}
+				return next
+			}}
+		})
+	})
+	t.Run(testConfig().DBDriver, func(t *testing.T) {
+		testStore(t, func(t *testing.T) storeFixture {
+			useTestDB(t)
+			_, other := registerUser(t, "other@example.com", "AnotherSecurePass1!")
+			db := testApp.db
+			return storeFixture{store: sqlStore{db}, owner: testUserID, other: other, household: func(t *testing.T, members ...int) int {
+				t.Helper()
+				now := time.Now().UTC().Format(timeFormat)
+				id, err := insertReturningID(db, "INSERT INTO households(name, owner_id, created_at) VALUES(?, ?, ?)", "Home", members[0], now)
+				if err != nil {
+					t.Fatalf("create household: %v", err)
+				}
+				for _, userID := range members {
+					if _, err := db.Exec("INSERT INTO household_members(household_id, user_id, role, joined_at) VALUES(?, ?, ?, ?)", id, userID, householdRoleMember, now); err != nil {
+						t.Fatalf("join household: %v", err)
+					}
+				}
+				return id
+			}}
+		})
+	})
+}
+
+// recordingStore is a Store that notes each write before passing it on.
+type recordingStore struct {
+	Store
+	calls *[]string
+}
+
+func (s recordingStore) InsertExpense(userID int, e Expense) (int, error) {
+	*s.calls = append(*s.calls, "InsertExpense")
+	return s.Store.InsertExpense(userID, e)
+}
+
+func (s recordingStore) DeleteExpense(userID, id int) error {
+	*s.calls = append(*s.calls, "DeleteExpense")
+	return s.Store.DeleteExpense(userID, id)
+}
+
+func (s recordingStore) DebitBalance(userID, id int, amount float64, now string) (bool, error) {
+	*s.calls = append(*s.calls, "DebitBalance")
+	return s.Store.DebitBalance(userID, id, amount, now)
+}
+
+func (s recordingStore) AdjustBalance(userID, id int, delta float64, now string) error {
+	*s.calls = append(*s.calls, "AdjustBalance")
+	return s.Store.AdjustBalance(userID, id, delta, now)
+}
+
+// TestAppStore checks that the handlers keep their rows in the Store the
+// App was given.
+func TestAppStore(t *testing.T) {
+	useTestDB(t)
+	var calls []string
+	testApp.store = func(q txQuerier) Store { return recordingStore{newSQLStore(q), &calls} }
+
+	e := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 4, Category: "Food", AccountID: testAccount()}))
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/expenses/%d", e.ID), nil), http.StatusNoContent)
+
+	if want := []string{"InsertExpense", "DebitBalance", "DeleteExpense", "AdjustBalance"}; !slices.Equal(calls, want) {
+		t.Fatalf("expected %v, got %v", want, calls)
+	}
+}
+
+func testStore(t *testing.T, setup func(*testing.T) storeFixture) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	stamp := func(t time.Time) string { return t.Format(timeFormat) }
+	newAccount := func(t *testing.T, f storeFixture, balance float64, allowNegative bool) int {
+		t.Helper()
+		id, err := f.store.InsertAccount(f.owner, Account{Name: "Wallet", Type: "cash", Balance: balance, AllowNegative: &allowNegative, Timestamps: newTimestamps(created)})
+		if err != nil {
+			t.Fatalf("insert account: %v", err)
+		}
+		return id
+	}
+	balance := func(t *testing.T, f storeFixture, id int) float64 {
+		t.Helper()
+		a, err := f.store.FetchAccount(f.owner, id)
+		if err != nil {
+			t.Fatalf("fetch account: %v", err)
+		}
+		return a.Balance
+	}
+
+	t.Run("ExpenseRoundTrip", func(t *testing.T) {
+		f := setup(t)
+		accountID := newAccount(t, f, 100, true)
+		payee := "Bakery"
+		id, err := f.store.InsertExpense(f.owner, Expense{Amount: 12.5, Category: "Food", Note: "bread", Payee: &payee, Date: created, AccountID: &accountID, Timestamps: newTimestamps(created)})
+		if err != nil {
+			t.Fatalf("insert expense: %v", err)
+		}
+		e, err := f.store.FetchExpense(f.owner, id)
+		if err != nil {
+			t.Fatalf("fetch expense: %v", err)
+		}
+		if e.ID != id || e.UserID != f.owner || e.Amount != 12.5 || e.Category != "Food" || e.Note != "bread" || e.Payee == nil || *e.Payee != payee ||
+			!e.Date.Equal(created) || e.AccountID == nil || *e.AccountID != accountID || e.HouseholdID != nil || !e.CreatedAt.Equal(created) {
+			t.Fatalf("unexpected expense: %+v", e)
+		}
+
+		updated := created.Add(time.Hour)
+		e.Amount, e.Category, e.Payee, e.AccountID = 20, "Groceries", nil, nil
+		e.Timestamps = e.Timestamps.touched(updated)
+		if err := f.store.UpdateExpense(f.owner, e); err != nil {
+			t.Fatalf("update expense: %v", err)
+		}
+		e, err = f.store.FetchExpense(f.owner, id)
+		if err != nil {
+			t.Fatalf("fetch updated expense: %v", err)
+		}
+		if e.Amount != 20 || e.Category != "Groceries" || e.Payee != nil || e.AccountID != nil || !e.CreatedAt.Equal(created) || !e.UpdatedAt.Equal(updated) {
+			t.Fatalf("unexpected updated expense: %+v", e)
+		}
+
+		if err := f.store.DeleteExpense(f.owner, id); err != nil {
+			t.Fatalf("delete expense: %v", err)
+		}
+		if _, err := f.store.FetchExpense(f.owner, id); err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows after delete, got %v", err)
+		}
+	})
+
+	t.Run("UserScoping", func(t *testing.T) {
+		f := setup(t)
+		accountID := newAccount(t, f, 100, true)
+		id, err := f.store.InsertExpense(f.owner, Expense{Amount: 5, Category: "Food", Date: created, Timestamps: newTimestamps(created)})
+		if err != nil {
+			t.Fatalf("insert expense: %v", err)
+		}
+
+		if _, err := f.store.FetchExpense(f.other, id); err != sql.ErrNoRows {
+			t.Fatalf("expected another user's expense to be hidden, got %v", err)
+		}
+		if _, err := f.store.FetchAccount(f.other, accountID); err != sql.ErrNoRows {
+			t.Fatalf("expected another user's account to be hidden, got %v", err)
+		}
+		if err := f.store.UpdateExpense(f.other, Expense{ID: id, Amount: 99, Category: "Stolen", Date: created, Timestamps: newTimestamps(created)}); err != nil {
+			t.Fatalf("update expense: %v", err)
+		}
+		if err := f.store.AdjustBalance(f.other, accountID, -100, stamp(created)); err != nil {
+			t.Fatalf("adjust balance: %v", err)
+		}
+		if err := f.store.DeleteExpense(f.other, id); err != nil {
+			t.Fatalf("delete expense: %v", err)
+		}
+		if err := f.store.DeleteAccount(f.other, accountID); err != nil {
+			t.Fatalf("delete account: %v", err)
+		}
+		if e, err := f.store.FetchExpense(f.owner, id); err != nil || e.Amount != 5 || e.Category != "Food" {
+			t.Fatalf("expected another user's writes to be ignored, got %+v, %v", e, err)
+		}
+		if got := balance(t, f, accountID); got != 100 {
+			t.Fatalf("expected balance 100, got %v", got)
+		}
+
+		household := f.household(t, f.owner, f.other)
+		e, _ := f.store.FetchExpense(f.owner, id)
+		e.HouseholdID = &household
+		if err := f.store.UpdateExpense(f.owner, e); err != nil {
+			t.Fatalf("share expense: %v", err)
+		}
+		shared, err := f.store.FetchExpense(f.other, id)
+		if err != nil || shared.UserID != f.other || shared.HouseholdID == nil || *shared.HouseholdID != household {
+			t.Fatalf("expected a household member to see the expense, got %+v, %v", shared, err)
+		}
+	})
+
+	t.Run("BalanceUpdates", func(t *testing.T) {
+		f := setup(t)
+		later := stamp(created.Add(time.Minute))
+		lenient := newAccount(t, f, 10, true)
+		strict := newAccount(t, f, 10, false)
+
+		if err := f.store.AdjustBalance(f.owner, lenient, 2.5, later); err != nil {
+			t.Fatalf("adjust balance: %v", err)
+		}
+		if got := balance(t, f, lenient); got != 12.5 {
+			t.Fatalf("expected balance 12.5, got %v", got)
+		}
+		if a, _ := f.store.FetchAccount(f.owner, lenient); a.UpdatedAt.Format(timeFormat) != later || !a.CreatedAt.Equal(created) {
+			t.Fatalf("expected updated_at %s, got %+v", later, a.Timestamps)
+		}
+		if debited, err := f.store.DebitBalance(f.owner, lenient, 20, later); err != nil || !debited {
+			t.Fatalf("expected a lenient account to go negative, got %v, %v", debited, err)
+		}
+		if got := balance(t, f, lenient); got != -7.5 {
+			t.Fatalf("expected balance -7.5, got %v", got)
+		}
+
+		if debited, err := f.store.DebitBalance(f.owner, strict, 10.01, later); err != nil || debited {
+			t.Fatalf("expected a strict account to refuse, got %v, %v", debited, err)
+		}
+		if debited, err := f.store.DebitBalance(f.owner, strict, 10, later); err != nil || !debited {
+			t.Fatalf("expected a strict account to cover its balance, got %v, %v", debited, err)
+		}
+		if got := balance(t, f, strict); got != 0 {
+			t.Fatalf("expected balance 0, got %v", got)
+		}
+		if debited, err := f.store.DebitBalance(f.other, lenient, 1, later); err != nil || debited {
+			t.Fatalf("expected another user's account not to be debited, got %v, %v", debited, err)
+		}
+	})
+
+	t.Run("AccountUpdateAndDelete", func(t *testing.T) {
+		f := setup(t)
+		accountID := newAccount(t, f, 10, true)
+		a, _ := f.store.FetchAccount(f.owner, accountID)
+		strict, minimum := false, 5.0
+		a.Name, a.Balance, a.AllowNegative, a.MinimumBalance = "Savings", 40, &strict, &minimum
+		a.Timestamps = a.Timestamps.touched(created.Add(time.Hour))
+		if err := f.store.UpdateAccount(f.owner, a); err != nil {
+			t.Fatalf("update account: %v", err)
+		}
+		a, err := f.store.FetchAccount(f.owner, accountID)
+		if err != nil || a.Name != "Savings" || a.Balance != 40 || a.AllowNegative == nil || *a.AllowNegative || a.MinimumBalance == nil || *a.MinimumBalance != 5 || !a.CreatedAt.Equal(created) {
+			t.Fatalf("unexpected updated account: %+v, %v", a, err)
+		}
+
+		id, err := f.store.InsertExpense(f.owner, Expense{Amount: 5, Category: "Food", Date: created, AccountID: &accountID, Timestamps: newTimestamps(created)})
+		if err != nil {
+			t.Fatalf("insert expense: %v", err)
+		}
+		if err := f.store.DeleteAccount(f.owner, accountID); err != nil {
+			t.Fatalf("delete account: %v", err)
+		}
+		if _, err := f.store.FetchAccount(f.owner, accountID); err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows after delete, got %v", err)
+		}
+		if e, err := f.store.FetchExpense(f.owner, id); err != nil || e.AccountID != nil {
+			t.Fatalf("expected the expense to lose its account, got %+v, %v", e, err)
+		}
+	})
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSyncPageSize = 500
+	maxSyncPageSize     = 2000
+	// tombstoneRetention is how long deletions are remembered. Clients whose
+	// cursor is older than this must resync from scratch.
+	tombstoneRetention = 90 * 24 * time.Hour
+)
+
+// Tombstone reports a row deleted since the client's cursor.
+type Tombstone struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   int       `json:"entity_id"`
+	DeletedAt  time.Time `json:"deleted_at"`
+}
+
+type SyncResponse struct {
+	Accounts          []Account          `json:"accounts"`
+	Budgets           []Budget           `json:"budgets"`
+	RecurringExpenses []RecurringExpense `json:"recurring_expenses"`
+	Expenses          []Expense          `json:"expenses"`
+	Incomes           []Income           `json:"incomes"`
+	Deleted           []Tombstone        `json:"deleted"`
+	// Cursor is the since value for the next sync, once HasMore is false.
+	Cursor    time.Time `json:"cursor"`
+	HasMore   bool      `json:"has_more"`
+	NextToken string    `json:"next_token,omitempty"`
+}
+
+// syncToken is the continuation state handed to clients between pages: the
+// window being synced and the position reached within it.
+type syncToken struct {
+	Since   string `json:"s"`
+	Until   string `json:"u"`
+	Stream  int    `json:"st"`
+	AfterTS string `json:"t"`
+	AfterID int    `json:"i"`
+}
+
+// syncStream is one table walked in (timestamp, id) order. add loads the
+// full row and appends it to the response.
+type syncStream struct {
+	table      string
+	tsColumn   string
+	shared     bool // household-scoped rather than owner-only
+	tombstones bool
+	add        func(q querier, resp *SyncResponse, userID, id int) error
+}
+
+var syncStreams = []syncStream{
+	{table: "accounts", tsColumn: "updated_at", shared: true, add: func(q querier, resp *SyncResponse, userID, id int) error {
+		a, err := fetchAccount(q, userID, id)
+		if err == nil {
+			resp.Accounts = append(resp.Accounts, a)
+		}
+		return err
+	}},
+	{table: "budgets", tsColumn: "updated_at", shared: true, add: func(q querier, resp *SyncResponse, userID, id int) error {
+		b, err := fetchBudget(q, userID, id)
+		if err == nil {
+			resp.Budgets = append(resp.Budgets, b)
+		}
+		return err
+	}},
+	{table: "recurring_expenses", tsColumn: "updated_at", add: func(q querier, resp *SyncResponse, userID, id int) error {
+		re, err := fetchRecurringExpense(q, userID, id)
+		if err == nil {
+			resp.RecurringExpenses = append(resp.RecurringExpenses, re)
+		}
+		return err
+	}},
+	{table: "expenses", tsColumn: "updated_at", shared: true, add: func(q querier, resp *SyncResponse, userID, id int) error {
+		e, err := fetchExpense(q, userID, id)
+		if err == nil {
+			resp.Expenses = append(resp.Expenses, e)
+		}
+		return err
+	}},
+	{table: "incomes", tsColumn: "updated_at", shared: true, add: func(q querier, resp *SyncResponse, userID, id int) error {
+		i, err := fetchIncome(q, userID, id)
+		if err == nil {
+			resp.Incomes = append(resp.Incomes, i)
+		}
+		return err
+	}},
+	{table: "deleted_records", tsColumn: "deleted_at", shared: true, tombstones: true, add: func(q querier, resp *SyncResponse, userID, id int) error {
+		var t Tombstone
+		var deletedAt string
+		if err := q.QueryRow("SELECT entity_type, entity_id, deleted_at FROM deleted_records WHERE id = ?", id).Scan(&t.EntityType, &t.EntityID, &deletedAt); err != nil {
+			return err
+		}
+		var err error
+		if t.DeletedAt, err = parseTimestamp(deletedAt); err != nil {
+			return err
+		}
+		resp.Deleted = append(resp.Deleted, t)
+		return nil
+	}},
+}
+
+func (app *App) createSyncTables() error {
+	stmt := `
+    CREATE TABLE IF NOT EXISTS deleted_records (
+        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        household_id INTEGER,
+        entity_type TEXT NOT NULL,
+        entity_id INTEGER NOT NULL,
+        deleted_at DATETIME NOT NULL,
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(stmt)); err != nil {
+		return fmt.Errorf("create deleted_records table: %w", err)
+	}
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_deleted_records_user ON deleted_records(user_id, deleted_at)"); err != nil {
+		return fmt.Errorf("create deleted_records index: %w", err)
+	}
+	return nil
+}
+
+// recordTombstone remembers that a row was deleted so /sync can report it.
+// householdID is the row's household, making the deletion visible to every
+// member rather than only the user who deleted it.
+func recordTombstone(tx txQuerier, userID int, entityType string, entityID int, householdID *int) error {
+	_, err := tx.Exec("INSERT INTO deleted_records(user_id, household_id, entity_type, entity_id, deleted_at) VALUES(?, ?, ?, ?, ?)",
+		userID, householdID, entityType, entityID, time.Now().UTC().Format(timeFormat))
+	return err
+}
+
+// touchDependents bumps updated_at on rows of table whose column references
+// id, ahead of a delete that nulls that column via ON DELETE SET NULL, so
+// sync clients pick up the change.
+func touchDependents(tx txQuerier, table, column string, id int) error {
+	_, err := tx.Exec(fmt.Sprintf("UPDATE %s SET updated_at = ? WHERE %s = ?", table, column), time.Now().UTC().Format(timeFormat), id)
+	return err
+}
+
+// tombstoneHouseholdRows runs before a household is deleted. Its shared rows
+// drop out of every member's scope except their creator's, so each other
+// member gets a tombstone, and the rows themselves are touched because their
+// household_id is about to be nulled.
+func tombstoneHouseholdRows(tx txQuerier, householdID int) error {
+	now := time.Now().UTC().Format(timeFormat)
+	for _, t := range []struct{ table, entityType string }{
+		{"accounts", auditEntityAccount},
+		{"budgets", auditEntityBudget},
+		{"expenses", auditEntityExpense},
+		{"incomes", auditEntityIncome},
+	} {
+		insert := fmt.Sprintf(`INSERT INTO deleted_records(user_id, entity_type, entity_id, deleted_at)
+            SELECT m.user_id, ?, r.id, ? FROM %s r JOIN household_members m ON m.household_id = r.household_id
+            WHERE r.household_id = ? AND m.user_id != r.user_id`, t.table)
+		if _, err := tx.Exec(insert, t.entityType, now, householdID); err != nil {
+			return fmt.Errorf("tombstone household %s: %w", t.table, err)
+		}
+		if err := touchDependents(tx, t.table, "household_id", householdID); err != nil {
+			return fmt.Errorf("touch household %s: %w", t.table, err)
+		}
+	}
+	return nil
+}
+
+// purgeTombstones drops deletions older than tombstoneRetention.
+func (app *App) purgeTombstones() {
+	cutoff := time.Now().UTC().Add(-tombstoneRetention).Format(timeFormat)
+	if _, err := app.db.Exec("DELETE FROM deleted_records WHERE deleted_at < ?", cutoff); err != nil {
+		log.Printf("purge tombstones error: %v", err)
+	}
+}
+
+func encodeSyncToken(tok syncToken) string {
+	data, _ := json.Marshal(tok)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSyncToken(raw string) (syncToken, error) {
+	var tok syncToken
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return tok, err
+	}
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return tok, err
+	}
+	if tok.Until == "" || tok.Stream < 0 || tok.Stream > len(syncStreams) {
+		return tok, fmt.Errorf("malformed sync token")
+	}
+	return tok, nil
+}
+
+// syncHandler returns everything changed in [since, now] across the synced
+// resources, plus deletions. Omitting since returns a full snapshot without
+// deletions. Large deltas are split into pages: follow next_token until
+// has_more is false, then keep cursor for the next sync. Rows changed in the
+// same second as a cursor may be sent twice, so clients should upsert.
+func (app *App) syncHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+
+	limit := defaultSyncPageSize
+	if raw := strings.TrimSpace(params.Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSyncPageSize)
+	}
+
+	var tok syncToken
+	if raw := strings.TrimSpace(params.Get("token")); raw != "" {
+		var err error
+		if tok, err = decodeSyncToken(raw); err != nil {
+			http.Error(w, "Invalid sync token", http.StatusBadRequest)
+			return
+		}
+	} else {
+		now := time.Now().UTC()
+		tok.Until = now.Format(timeFormat)
+		if rawSince := strings.TrimSpace(params.Get("since")); rawSince != "" {
+			since, err := parseTimestamp(rawSince)
+			if err != nil {
+				http.Error(w, "Invalid since", http.StatusBadRequest)
+				return
+			}
+			if since.Before(now.Add(-tombstoneRetention)) {
+				http.Error(w, "Cursor too old; resync without since", http.StatusGone)
+				return
+			}
+			tok.Since = since.Format(timeFormat)
+		}
+	}
+
+	until, err := parseTimestamp(tok.Until)
+	if err != nil {
+		http.Error(w, "Invalid sync token", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	resp := SyncResponse{
+		Accounts:          []Account{},
+		Budgets:           []Budget{},
+		RecurringExpenses: []RecurringExpense{},
+		Expenses:          []Expense{},
+		Incomes:           []Income{},
+		Deleted:           []Tombstone{},
+		Cursor:            until,
+	}
+
+	remaining := limit
+	for tok.Stream < len(syncStreams) && remaining > 0 {
+		s := syncStreams[tok.Stream]
+		if s.tombstones && tok.Since == "" {
+			tok.Stream++
+			continue
+		}
+
+		n, err := syncStreamPage(tx, s, &tok, &resp, userID, remaining)
+		if err != nil {
+			log.Printf("sync %s error: %v", s.table, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		remaining -= n
+		if remaining > 0 {
+			tok.Stream++
+			tok.AfterTS, tok.AfterID = "", 0
+		}
+	}
+
+	if tok.Stream < len(syncStreams) {
+		resp.HasMore = true
+		resp.NextToken = encodeSyncToken(tok)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// syncStreamPage appends up to limit rows of s after tok's position to resp,
+// advancing tok past them, and reports how many rows it read.
+func syncStreamPage(q querier, s syncStream, tok *syncToken, resp *SyncResponse, userID, limit int) (int, error) {
+	scope, args := "user_id = ?", []interface{}{userID}
+	if s.shared {
+		scope, args = householdScope, []interface{}{userID, userID}
+	}
+	query := fmt.Sprintf("SELECT id, %[2]s FROM %[1]s WHERE %[3]s AND %[2]s >= ? AND %[2]s <= ? AND (%[2]s > ? OR (%[2]s = ? AND id > ?)) ORDER BY %[2]s, id LIMIT ?", s.table, s.tsColumn, scope)
+	args = append(args, tok.Since, tok.Until, tok.AfterTS, tok.AfterTS, tok.AfterID, limit)
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	type position struct {
+		id int
+		ts string
+	}
+	var page []position
+	for rows.Next() {
+		var p position
+		if err := rows.Scan(&p.id, &p.ts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ts, err := parseTimestamp(p.ts)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		p.ts = ts.Format(timeFormat)
+		page = append(page, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range page {
+		if err := s.add(q, resp, userID, p.id); err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		tok.AfterTS, tok.AfterID = p.ts, p.id
+	}
+	return len(page), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// backdateAll moves every synced row's updated_at two days back so later
+// changes stand out without the test having to sleep across seconds. It
+// returns a since value that falls between the two.
+func backdateAll(t *testing.T) string {
+	t.Helper()
+	now := time.Now().UTC()
+	old := now.AddDate(0, 0, -2).Format(timeFormat)
+	for _, tt := range timestampedTables {
+		if _, err := testApp.db.Exec("UPDATE "+tt.table+" SET updated_at = ?", old); err != nil {
+			t.Fatalf("backdate %s: %v", tt.table, err)
+		}
+	}
+	return url.QueryEscape(now.AddDate(0, 0, -1).Format(time.RFC3339))
+}
+
+func TestSyncFullAndDelta(t *testing.T) {
+	useTestDB(t)
+
+	now := time.Now().UTC()
+	keep := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 5, Category: "Keep", Date: now, AccountID: testAccount()}))
+	edit := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 7, Category: "Edit", Date: now, AccountID: testAccount()}))
+	gone := decodeBody[Income](t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 9, Source: "Gone", Date: now, AccountID: testAccount()}))
+
+	rr := callAuthed(http.MethodGet, "/sync", nil)
+	expectStatus(t, rr, http.StatusOK)
+	full := decodeBody[SyncResponse](t, rr)
+	if len(full.Expenses) != 2 || len(full.Incomes) != 1 || len(full.Deleted) != 0 || full.HasMore {
+		t.Fatalf("unexpected full sync: %+v", full)
+	}
+	if full.Cursor.IsZero() {
+		t.Fatalf("expected a cursor on every response")
+	}
+
+	since := backdateAll(t)
+
+	edit.Amount = 8
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", edit.ID), edit), http.StatusOK)
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/incomes/%d", gone.ID), nil), http.StatusNoContent)
+	budget := decodeBody[Budget](t, callAuthed(http.MethodPost, "/budgets", Budget{Category: "Fun", Amount: 20, StartDate: now, EndDate: now.AddDate(0, 1, 0)}))
+
+	delta := decodeBody[SyncResponse](t, callAuthed(http.MethodGet, "/sync?since="+since, nil))
+	if len(delta.Expenses) != 1 || delta.Expenses[0].ID != edit.ID || delta.Expenses[0].Amount != 8 {
+		t.Fatalf("expected only the edited expense, got %+v", delta.Expenses)
+	}
+	if len(delta.Budgets) != 1 || delta.Budgets[0].ID != budget.ID {
+		t.Fatalf("expected the new budget, got %+v", delta.Budgets)
+	}
+	if len(delta.Incomes) != 0 {
+		t.Fatalf("expected deleted income to be absent from incomes, got %+v", delta.Incomes)
+	}
+	if len(delta.Deleted) != 1 || delta.Deleted[0].EntityType != auditEntityIncome || delta.Deleted[0].EntityID != gone.ID {
+		t.Fatalf("expected a tombstone for the income, got %+v", delta.Deleted)
+	}
+	// The untouched expense was last written before the cutoff.
+	for _, e := range delta.Expenses {
+		if e.ID == keep.ID {
+			t.Fatalf("untouched expense %d was resent", keep.ID)
+		}
+	}
+}
+
+func TestSyncPagination(t *testing.T) {
+	useTestDB(t)
+
+	since := url.QueryEscape(time.Now().UTC().Add(-time.Hour).Format(time.RFC3339))
+	want := map[int]bool{}
+	for i := 0; i < 5; i++ {
+		e := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: float64(i + 1), Category: "Paged", Date: time.Now().UTC(), AccountID: testAccount()}))
+		want[e.ID] = true
+	}
+
+	seen := map[int]bool{}
+	var cursor time.Time
+	target := "/sync?limit=2&since=" + since
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("pagination did not terminate")
+		}
+		page := decodeBody[SyncResponse](t, callAuthed(http.MethodGet, target, nil))
+		if n := len(page.Expenses) + len(page.Accounts) + len(page.Incomes) + len(page.Budgets) + len(page.RecurringExpenses) + len(page.Deleted); n > 2 {
+			t.Fatalf("page exceeded limit with %d items", n)
+		}
+		if pages > 0 && !page.Cursor.Equal(cursor) {
+			t.Fatalf("cursor changed mid-sync: %v then %v", cursor, page.Cursor)
+		}
+		cursor = page.Cursor
+		for _, e := range page.Expenses {
+			if seen[e.ID] {
+				t.Fatalf("expense %d sent twice within one sync", e.ID)
+			}
+			seen[e.ID] = true
+		}
+		if !page.HasMore {
+			break
+		}
+		target = "/sync?limit=2&token=" + url.QueryEscape(page.NextToken)
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("expected %d expenses across pages, got %d", len(want), len(seen))
+	}
+}
+
+func TestSyncRejectsBadInput(t *testing.T) {
+	useTestDB(t)
+
+	expectStatus(t, callAuthed(http.MethodGet, "/sync?since=soon", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/sync?token=not-a-token", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/sync?limit=0", nil), http.StatusBadRequest)
+
+	stale := time.Now().UTC().Add(-tombstoneRetention - time.Hour).Format(time.RFC3339)
+	expectStatus(t, callAuthed(http.MethodGet, "/sync?since="+url.QueryEscape(stale), nil), http.StatusGone)
+}
+
+func TestSyncReportsHouseholdRowsLostOnDelete(t *testing.T) {
+	useTestDB(t)
+
+	partnerCookie, _ := registerUser(t, "sync-partner@example.com", "SyncPartnerPass123!")
+	household := decodeBody[Household](t, callAuthed(http.MethodPost, "/households", Household{Name: "Flat"}))
+	invite := decodeBody[HouseholdInvite](t, callAuthed(http.MethodPost, fmt.Sprintf("/households/%d/invites", household.ID), nil))
+	expectStatus(t, callAuthedAs(partnerCookie, http.MethodPost, "/invites/accept", acceptInviteRequest{Token: invite.Token}), http.StatusOK)
+
+	shared := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 30, Category: "Rent", Date: time.Now().UTC(), AccountID: testAccount(), HouseholdID: &household.ID}))
+	since := backdateAll(t)
+
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/households/%d", household.ID), nil), http.StatusNoContent)
+
+	partnerDelta := decodeBody[SyncResponse](t, callAuthedAs(partnerCookie, http.MethodGet, "/sync?since="+since, nil))
+	if len(partnerDelta.Deleted) != 1 || partnerDelta.Deleted[0].EntityID != shared.ID {
+		t.Fatalf("expected partner to be told the shared expense is gone, got %+v", partnerDelta.Deleted)
+	}
+
+	ownerDelta := decodeBody[SyncResponse](t, callAuthed(http.MethodGet, "/sync?since="+since, nil))
+	if len(ownerDelta.Deleted) != 0 || len(ownerDelta.Expenses) != 1 || ownerDelta.Expenses[0].HouseholdID != nil {
+		t.Fatalf("expected owner to receive the now-personal expense, got %+v", ownerDelta)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Timestamps is embedded in every domain resource. Handlers set both fields
+// on insert and bump UpdatedAt on every write; rows that predate the columns
+// are backfilled by migrateTimestamps.
+type Timestamps struct {
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// utc is ts as it is written in responses.
+func (ts Timestamps) utc() Timestamps {
+	return Timestamps{CreatedAt: outputTime(ts.CreatedAt), UpdatedAt: outputTime(ts.UpdatedAt)}
+}
+
+// timestampedTables lists the tables carrying created_at/updated_at, the
+// audit entity type their history is logged under, and the column (if any)
+// that best approximates creation time when the audit log has nothing.
+var timestampedTables = []struct {
+	table       string
+	auditEntity string
+	dateColumn  string
+}{
+	{"expenses", auditEntityExpense, "date"},
+	{"incomes", auditEntityIncome, "date"},
+	{"budgets", auditEntityBudget, ""},
+	{"recurring_expenses", auditEntityRecurringExpense, ""},
+	{"accounts", auditEntityAccount, ""},
+}
+
+// migrateTimestamps adds created_at/updated_at and backfills rows that lack
+// them: created_at from the first audit entry, else the transaction date
+// (capped at now), else now; updated_at from the latest audit entry, else
+// created_at.
+func (app *App) migrateTimestamps() error {
+	now := time.Now().UTC().Format(timeFormat)
+	for _, t := range timestampedTables {
+		if err := app.ensureColumn(t.table, "created_at", "DATETIME"); err != nil {
+			return err
+		}
+		if err := app.ensureColumn(t.table, "updated_at", "DATETIME"); err != nil {
+			return err
+		}
+
+		auditSub := func(agg string) string {
+			return fmt.Sprintf("(SELECT %s(a.created_at) FROM audit_log a WHERE a.entity_type = ? AND a.entity_id = %s.id)", agg, t.table)
+		}
+		createdFrom := auditSub("MIN")
+		args := []interface{}{t.auditEntity}
+		if t.dateColumn != "" {
+			createdFrom += ", " + app.dialect.least(t.dateColumn, "?")
+			args = append(args, now)
+		}
+		args = append(args, now)
+		backfillCreated := fmt.Sprintf("UPDATE %s SET created_at = COALESCE(%s, ?) WHERE created_at IS NULL", t.table, createdFrom)
+		if _, err := app.db.Exec(backfillCreated, args...); err != nil {
+			return fmt.Errorf("backfill %s created_at: %w", t.table, err)
+		}
+
+		backfillUpdated := fmt.Sprintf("UPDATE %s SET updated_at = COALESCE(%s, created_at) WHERE updated_at IS NULL", t.table, auditSub("MAX"))
+		if _, err := app.db.Exec(backfillUpdated, t.auditEntity); err != nil {
+			return fmt.Errorf("backfill %s updated_at: %w", t.table, err)
+		}
+
+		indexStmt := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_user_updated ON %s(user_id, updated_at)", t.table, t.table)
+		if _, err := app.db.Exec(indexStmt); err != nil {
+			return fmt.Errorf("create %s updated_at index: %w", t.table, err)
+		}
+	}
+	return nil
+}
+
+// newTimestamps returns the timestamps for a row created at now, at the
+// one-second precision they are stored with.
+func newTimestamps(now time.Time) Timestamps {
+	now = now.UTC().Truncate(time.Second)
+	return Timestamps{CreatedAt: now, UpdatedAt: now}
+}
+
+// touched returns ts with UpdatedAt moved to now, for rows being modified.
+func (ts Timestamps) touched(now time.Time) Timestamps {
+	ts.UpdatedAt = now.UTC().Truncate(time.Second)
+	return ts
+}
+
+// parseTimestamps converts created_at/updated_at scanned as strings. NULLs
+// (rows written outside the handlers since the last backfill) stay zero.
+func parseTimestamps(created, updated sql.NullString) (Timestamps, error) {
+	var ts Timestamps
+	if created.Valid {
+		t, err := parseTimestamp(created.String)
+		if err != nil {
+			return Timestamps{}, err
+		}
+		ts.CreatedAt = t
+	}
+	if updated.Valid {
+		t, err := parseTimestamp(updated.String)
+		if err != nil {
+			return Timestamps{}, err
+		}
+		ts.UpdatedAt = t
+	}
+	return ts, nil
+}
+
+// parseModifiedSince reads ?modified_since= for list endpoints. It returns
+// the cutoff in timeFormat (or "" when absent) for comparing against
+// updated_at, and writes a 400 when the value does not parse.
+func parseModifiedSince(w http.ResponseWriter, params url.Values) (string, bool) {
+	raw := strings.TrimSpace(params.Get("modified_since"))
+	if raw == "" {
+		return "", true
+	}
+	since, err := parseTimestamp(raw)
+	if err != nil {
+		http.Error(w, "Invalid modified_since", http.StatusBadRequest)
+		return "", false
+	}
+	return since.Format(timeFormat), true
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimestampsSetOnCreateAndUpdate(t *testing.T) {
+	useTestDB(t)
+
+	before := time.Now().UTC().Truncate(time.Second)
+	rr := callAuthed(http.MethodPost, "/expenses", Expense{Amount: 12, Category: "Books", Date: before, AccountID: testAccount()})
+	expectStatus(t, rr, http.StatusCreated)
+	created := decodeBody[Expense](t, rr)
+	if created.CreatedAt.Before(before) || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("expected fresh timestamps, got %+v", created.Timestamps)
+	}
+
+	// Backdate the row so the update is observable without sleeping.
+	old := "2020-01-01 00:00:00"
+	if _, err := testApp.db.Exec("UPDATE expenses SET created_at = ?, updated_at = ? WHERE id = ?", old, old, created.ID); err != nil {
+		t.Fatalf("backdate expense: %v", err)
+	}
+
+	created.Amount = 15
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", created.ID), created), http.StatusOK)
+
+	fetched := decodeBody[Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", created.ID), nil))
+	if !fetched.CreatedAt.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected created_at to survive the update, got %v", fetched.CreatedAt)
+	}
+	if fetched.UpdatedAt.Before(before) {
+		t.Fatalf("expected updated_at to move forward, got %v", fetched.UpdatedAt)
+	}
+
+	accounts := decodeBody[[]Account](t, callAuthed(http.MethodGet, "/accounts", nil))
+	if len(accounts) != 1 || accounts[0].UpdatedAt.Before(before) {
+		t.Fatalf("expected the linked account's balance change to bump updated_at, got %+v", accounts)
+	}
+}
+
+func TestModifiedSinceFilter(t *testing.T) {
+	useTestDB(t)
+
+	for _, category := range []string{"Stale", "Fresh"} {
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 1, Category: category, Date: time.Now().UTC(), AccountID: testAccount()}), http.StatusCreated)
+		expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 1, Source: category, Date: time.Now().UTC(), AccountID: testAccount()}), http.StatusCreated)
+	}
+	if _, err := testApp.db.Exec("UPDATE expenses SET updated_at = '2020-06-01 00:00:00' WHERE category = 'Stale'"); err != nil {
+		t.Fatalf("backdate expense: %v", err)
+	}
+	if _, err := testApp.db.Exec("UPDATE incomes SET updated_at = '2020-06-01 00:00:00' WHERE source = 'Stale'"); err != nil {
+		t.Fatalf("backdate income: %v", err)
+	}
+
+	expenses := decodeBody[[]Expense](t, callAuthed(http.MethodGet, "/expenses?modified_since=2021-01-01T00:00:00Z", nil))
+	if len(expenses) != 1 || expenses[0].Category != "Fresh" {
+		t.Fatalf("expected only the fresh expense, got %+v", expenses)
+	}
+	incomes := decodeBody[[]Income](t, callAuthed(http.MethodGet, "/incomes?modified_since=2021-01-01", nil))
+	if len(incomes) != 1 || incomes[0].Source != "Fresh" {
+		t.Fatalf("expected only the fresh income, got %+v", incomes)
+	}
+
+	all := decodeBody[[]Expense](t, callAuthed(http.MethodGet, "/expenses?modified_since=2020-06-01T00:00:00Z", nil))
+	if len(all) != 2 {
+		t.Fatalf("expected modified_since to be inclusive, got %d expenses", len(all))
+	}
+
+	for _, path := range []string{"/expenses", "/incomes", "/budgets", "/recurring-expenses", "/accounts"} {
+		expectStatus(t, callAuthed(http.MethodGet, path+"?modified_since=yesterday", nil), http.StatusBadRequest)
+	}
+}
+
+func TestMigrateTimestampsBackfills(t *testing.T) {
+	useTestDB(t)
+
+	res, err := testApp.db.Exec("INSERT INTO expenses(amount, category, note, date, user_id) VALUES(?, ?, ?, ?, ?)", 3, "Legacy", "", "2019-03-04 10:00:00", testUserID)
+	if err != nil {
+		t.Fatalf("insert legacy expense: %v", err)
+	}
+	legacyID, _ := res.LastInsertId()
+
+	res, err = testApp.db.Exec("INSERT INTO budgets(category, amount, start_date, end_date, user_id) VALUES(?, ?, ?, ?, ?)", "Legacy", 10, "2019-01-01 00:00:00", "2019-01-31 00:00:00", testUserID)
+	if err != nil {
+		t.Fatalf("insert legacy budget: %v", err)
+	}
+	budgetID, _ := res.LastInsertId()
+	for _, at := range []string{"2019-01-02 08:00:00", "2019-01-20 09:30:00"} {
+		if _, err := testApp.db.Exec("INSERT INTO audit_log(user_id, entity_type, entity_id, action, created_at) VALUES(?, ?, ?, ?, ?)", testUserID, auditEntityBudget, budgetID, auditActionUpdate, at); err != nil {
+			t.Fatalf("insert audit entry: %v", err)
+		}
+	}
+
+	if err := testApp.migrateTimestamps(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	expense := decodeBody[Expense](t, callAuthed(http.MethodGet, fmt.Sprintf("/expenses/%d", legacyID), nil))
+	want := time.Date(2019, 3, 4, 10, 0, 0, 0, time.UTC)
+	if !expense.CreatedAt.Equal(want) || !expense.UpdatedAt.Equal(want) {
+		t.Fatalf("expected expense timestamps backfilled from its date, got %+v", expense.Timestamps)
+	}
+
+	budget := decodeBody[Budget](t, callAuthed(http.MethodGet, fmt.Sprintf("/budgets/%d", budgetID), nil))
+	if !budget.CreatedAt.Equal(time.Date(2019, 1, 2, 8, 0, 0, 0, time.UTC)) || !budget.UpdatedAt.Equal(time.Date(2019, 1, 20, 9, 30, 0, 0, time.UTC)) {
+		t.Fatalf("expected budget timestamps backfilled from the audit log, got %+v", budget.Timestamps)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	// The zone database is embedded so timezone settings work on hosts
+	// without one, such as minimal containers.
+	_ "time/tzdata"
+)
+
+// Dates are stored in UTC. A user's timezone setting only changes how they
+// are read and grouped: a bare YYYY-MM-DD is that calendar day in the
+// user's zone, and reports group by the day each transaction fell on there.
+//
+// Calendar days are passed around as midnight UTC on that date, the form
+// parseDayParam returns and reportPeriods works with; dayStart turns one
+// back into the instant it begins in a zone.
+
+var locations sync.Map // zone name -> *time.Location
+
+// loadLocation resolves an IANA zone name, with "" meaning UTC.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	// "Local" would be the server's zone, not one the user chose.
+	if name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// userLocation returns the zone userID's dates are read and grouped in. It
+// writes a 500 when the settings cannot be loaded.
+func (app *App) userLocation(w http.ResponseWriter, userID int) (*time.Location, bool) {
+	settings, err := loadUserSettings(app.db, userID)
+	if err == nil {
+		var loc *time.Location
+		if loc, err = loadLocation(settings.Timezone); err == nil {
+			return loc, true
+		}
+	}
+	log.Printf("user timezone lookup error: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+	return nil, false
+}
+
+// localDay is the calendar day t falls on in loc.
+func localDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// dayStart is the instant day begins in loc, formatted for comparison with
+// stored dates.
+func dayStart(day time.Time, loc *time.Location) string {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc).UTC().Format(timeFormat)
+}
+
+// dateBound turns a date_from (upper false) or date_to (upper true) value
+// into a condition on the date column. A bare YYYY-MM-DD covers that whole
+// day in loc, so date_to includes it; a full timestamp is used as is.
+func dateBound(raw string, loc *time.Location, upper bool) (string, string, error) {
+	if day, err := time.Parse(statsDateFormat, raw); err == nil {
+		if upper {
+			return " AND date < ?", dayStart(day.AddDate(0, 0, 1), loc), nil
+		}
+		return " AND date >= ?", dayStart(day, loc), nil
+	}
+	t, err := parseTimestamp(raw)
+	if err != nil {
+		return "", "", err
+	}
+	if upper {
+		return " AND date <= ?", t.Format(timeFormat), nil
+	}
+	return " AND date >= ?", t.Format(timeFormat), nil
+}
+
+// dateRangeFilter applies the date_from and date_to parameters of a list
+// request. It writes a 400 when either does not parse.
+func dateRangeFilter(w http.ResponseWriter, params url.Values, loc *time.Location) (string, []interface{}, bool) {
+	var clause string
+	var args []interface{}
+	for _, bound := range []struct {
+		param string
+		upper bool
+	}{{"date_from", false}, {"date_to", true}} {
+		raw := strings.TrimSpace(params.Get(bound.param))
+		if raw == "" {
+			continue
+		}
+		cond, value, err := dateBound(raw, loc, bound.upper)
+		if err != nil {
+			http.Error(w, "Invalid "+bound.param, http.StatusBadRequest)
+			return "", nil, false
+		}
+		clause += cond
+		args = append(args, value)
+	}
+	return clause, args, true
+}
+
+// dailyTotals sums amount per calendar day in loc. query must select date
+// and amount, in that order.
+func dailyTotals(q rowsQuerier, loc *time.Location, query string, args ...interface{}) (map[time.Time]float64, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := map[time.Time]float64{}
+	for rows.Next() {
+		var dateStr string
+		var amount float64
+		if err := rows.Scan(&dateStr, &amount); err != nil {
+			return nil, err
+		}
+		date, err := parseTimestamp(dateStr)
+		if err != nil {
+			return nil, err
+		}
+		totals[localDay(date, loc)] += amount
+	}
+	return totals, rows.Err()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimezoneMonthBoundary(t *testing.T) {
+	useTestDB(t)
+
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	// 00:30 on 1 April in Jakarta is still 31 March in UTC.
+	early := time.Date(2024, 4, 1, 0, 30, 0, 0, jakarta)
+	late := time.Date(2024, 3, 31, 23, 0, 0, 0, jakarta)
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 40, Category: "Food", Date: early, AccountID: testAccount()}), http.StatusCreated)
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 25, Category: "Food", Date: late, AccountID: testAccount()}), http.StatusCreated)
+
+	months := func() map[string]float64 {
+		reports := decodeBody[[]MonthlyReport](t, callAuthed(http.MethodGet, "/reports/income-vs-expense", nil))
+		got := map[string]float64{}
+		for _, r := range reports {
+			got[r.Period] = r.Expense
+		}
+		return got
+	}
+	if got := months(); len(got) != 1 || got["2024-03"] != 65 {
+		t.Fatalf("expected both expenses in March in UTC, got %v", got)
+	}
+
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Timezone: "Mars/Olympus_Mons"}), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Timezone: "Local"}), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Timezone: "Asia/Jakarta"}), http.StatusOK)
+
+	if got := months(); len(got) != 2 || got["2024-03"] != 25 || got["2024-04"] != 40 {
+		t.Fatalf("expected the early expense in April in Asia/Jakarta, got %v", got)
+	}
+	totals := decodeBody[map[string]float64](t, callAuthed(http.MethodGet, "/expenses/aggregates?query=totals_by_month", nil))
+	if totals["2024-03"] != 25 || totals["2024-04"] != 40 {
+		t.Fatalf("unexpected monthly totals: %v", totals)
+	}
+
+	// Date-only inputs are whole days in the user's zone.
+	april := decodeBody[[]Expense](t, callAuthed(http.MethodGet, "/expenses?date_from=2024-04-01", nil))
+	if len(april) != 1 || april[0].Amount != 40 {
+		t.Fatalf("expected only the April expense, got %+v", april)
+	}
+	march := decodeBody[[]Expense](t, callAuthed(http.MethodGet, "/expenses?date_to=2024-03-31", nil))
+	if len(march) != 1 || march[0].Amount != 25 {
+		t.Fatalf("expected only the March expense, got %+v", march)
+	}
+	expectStatus(t, callAuthed(http.MethodGet, "/expenses?date_from=soon", nil), http.StatusBadRequest)
+
+	stats := decodeBody[ExpenseStats](t, callAuthed(http.MethodGet, "/expenses/stats?date_from=2024-04-01&date_to=2024-04-30", nil))
+	if stats.Count != 1 || stats.Total != 40 {
+		t.Fatalf("unexpected April stats: %+v", stats)
+	}
+
+	insights := decodeBody[SpendingInsights](t, callAuthed(http.MethodGet, "/reports/insights?period=month&date=2024-04-15", nil))
+	if insights.TopWeekday == nil || insights.TopWeekday.Weekday != "Monday" || insights.NoSpendDays.Count != 29 {
+		t.Fatalf("expected one spending day, a Monday in Jakarta, got %+v", insights)
+	}
+}
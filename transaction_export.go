@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+
+	// exportFlushRows is how many rows are written between flushes.
+	exportFlushRows = 500
+)
+
+// The columns of GET /incomes/export and GET /transactions/export, in the
+// order they are written. Scripts and spreadsheets read them by position,
+// so new columns only ever go on the end.
+var (
+	incomeExportColumns      = []string{"id", "date", "amount", "source", "note", "account_id"}
+	transactionExportColumns = []string{"type", "id", "date", "amount", "category", "source", "note", "account_id"}
+)
+
+// exportValue is column of item as written to JSON: numbers stay numbers
+// and a missing account is null.
+func exportValue(item ActivityItem, column string) interface{} {
+	switch column {
+	case "type":
+		return item.Type
+	case "id":
+		return item.ID
+	case "date":
+		return outputTime(item.Date).Format(time.RFC3339)
+	case "amount":
+		return item.Amount
+	case "category":
+		return item.Category
+	case "source":
+		return item.Source
+	case "note":
+		return item.Note
+	case "account_id":
+		return item.AccountID
+	}
+	return nil
+}
+
+// exportField is column of item as written to CSV. Amounts are plain
+// decimals with no grouping or currency, whatever the user's locale.
+func exportField(item ActivityItem, column string) string {
+	switch v := exportValue(item, column).(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case *int:
+		if v == nil {
+			return ""
+		}
+		return strconv.Itoa(*v)
+	}
+	return ""
+}
+
+// incomesExportHandler serves GET /incomes/export.
+func (app *App) incomesExportHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	app.streamTransactionExport(w, r, userID, []string{activityTypeIncome}, incomeExportColumns, "incomes")
+}
+
+// transactionsExportHandler serves GET /transactions/export: expenses and
+// incomes together, told apart by the type column.
+func (app *App) transactionsExportHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	app.streamTransactionExport(w, r, userID, transactionTypes, transactionExportColumns, "transactions")
+}
+
+// streamTransactionExport writes the user's rows of the given types, oldest
+// first, as CSV (the default) or a JSON array, one row at a time so memory
+// stays flat however long the history. date_from, date_to, and account_id
+// filter as on the list endpoints.
+func (app *App) streamTransactionExport(w http.ResponseWriter, r *http.Request, userID int, types, columns []string, name string) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "format", "date_from", "date_to", "account_id") {
+		return
+	}
+	format, ok := parseEnumParam(w, params, "format", exportFormatCSV, exportFormatJSON)
+	if !ok {
+		return
+	}
+	if format == "" {
+		format = exportFormatCSV
+	}
+
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	filter, filterArgs, ok := dateRangeFilter(w, params, loc)
+	if !ok {
+		return
+	}
+	accountClause, accountArgs, ok := app.parseAccountFilter(w, userID, params)
+	if !ok {
+		return
+	}
+	filter += accountClause
+	filterArgs = append(filterArgs, accountArgs...)
+
+	var selects []string
+	var args []interface{}
+	for _, t := range types {
+		selects = append(selects, activitySources[t]+filter)
+		args = append(append(args, userID, userID), filterArgs...)
+	}
+	query := "SELECT * FROM (" + strings.Join(selects, " UNION ALL ") + ") AS activity ORDER BY date, type, id"
+	rows, err := app.requestDB(r).Query(query, args...)
+	if err != nil {
+		log.Printf("%s export query error: %v", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var write func(ActivityItem) error
+	var finish func() error
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	if format == exportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		record := make([]string, len(columns))
+		write = func(item ActivityItem) error {
+			for i, c := range columns {
+				record[i] = exportField(item, c)
+			}
+			return cw.Write(record)
+		}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		flushResponse := flush
+		flush = func() {
+			cw.Flush()
+			flushResponse()
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		w.Write([]byte{'['})
+		n := 0
+		write = func(item ActivityItem) error {
+			// Objects are written field by field so keys keep column order.
+			var b strings.Builder
+			if n > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('{')
+			for i, c := range columns {
+				value, err := json.Marshal(exportValue(item, c))
+				if err != nil {
+					return err
+				}
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				b.WriteString(strconv.Quote(c) + ":")
+				b.Write(value)
+			}
+			b.WriteByte('}')
+			n++
+			_, err := w.Write([]byte(b.String()))
+			return err
+		}
+		finish = func() error {
+			_, err := w.Write([]byte{']'})
+			return err
+		}
+	}
+
+	// As with GET /export, once rows are streaming the status is already
+	// 200, so failures can only be logged and the file is left truncated.
+	for n := 1; rows.Next(); n++ {
+		item, err := scanActivityItem(rows)
+		if err != nil {
+			log.Printf("%s export scan error: %v", name, err)
+			return
+		}
+		if err := write(item); err != nil {
+			log.Printf("%s export write error: %v", name, err)
+			return
+		}
+		if n%exportFlushRows == 0 {
+			flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("%s export rows error: %v", name, err)
+		return
+	}
+	if err := finish(); err != nil {
+		log.Printf("%s export write error: %v", name, err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransactionExports(t *testing.T) {
+	useTestDB(t)
+
+	wallet := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts?opening_balance=false", Account{Name: "Wallet", Type: "cash"}))
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Locale: "de-DE", Currency: "EUR"}), http.StatusOK)
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 9, 0, 0, 0, time.UTC) }
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 1234.5, Source: "Salary", Note: "June, paid", Date: day(3), AccountID: &wallet.ID}), http.StatusCreated)
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 12.25, Category: "Food", Date: day(2), AccountID: testAccount()}), http.StatusCreated)
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 50, Source: "Gift", Date: day(1), AccountID: testAccount()}), http.StatusCreated)
+
+	records := func(path string) [][]string {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, path, nil)
+		expectStatus(t, rr, http.StatusOK)
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+			t.Fatalf("expected CSV from %s, got %q", path, ct)
+		}
+		all, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return all
+	}
+
+	incomes := records("/incomes/export")
+	want := [][]string{
+		incomeExportColumns,
+		{"2", "2024-06-01T09:00:00Z", "50", "Gift", "", fmt.Sprint(testAccountID)},
+		{"1", "2024-06-03T09:00:00Z", "1234.5", "Salary", "June, paid", fmt.Sprint(wallet.ID)},
+	}
+	if !reflect.DeepEqual(incomes, want) {
+		t.Fatalf("unexpected income export:\n got %q\nwant %q", incomes, want)
+	}
+
+	all := records("/transactions/export")
+	if len(all) != 4 || !reflect.DeepEqual(all[0], transactionExportColumns) {
+		t.Fatalf("unexpected transaction export: %q", all)
+	}
+	if got := []string{all[1][0], all[2][0], all[3][0]}; !reflect.DeepEqual(got, []string{"income", "expense", "income"}) {
+		t.Fatalf("expected rows oldest first across both types, got %q", got)
+	}
+	if all[2][3] != "12.25" || all[2][4] != "Food" || all[2][5] != "" {
+		t.Fatalf("unexpected expense row: %q", all[2])
+	}
+
+	if filtered := records(fmt.Sprintf("/transactions/export?account_id=%d", wallet.ID)); len(filtered) != 2 || filtered[1][5] != "Salary" {
+		t.Fatalf("expected the account filter applied, got %q", filtered)
+	}
+	if filtered := records("/transactions/export?date_from=2024-06-02&date_to=2024-06-02"); len(filtered) != 2 || filtered[1][0] != "expense" {
+		t.Fatalf("expected the date filter applied, got %q", filtered)
+	}
+
+	rr := callAuthed(http.MethodGet, "/transactions/export?format=json", nil)
+	expectStatus(t, rr, http.StatusOK)
+	if !strings.HasPrefix(rr.Body.String(), `[{"type":"income","id":2,"date":"2024-06-01T09:00:00Z","amount":50,"category":"","source":"Gift","note":"","account_id":`+fmt.Sprint(testAccountID)+`}`) {
+		t.Fatalf("unexpected JSON export: %s", rr.Body.String())
+	}
+	if rows := decodeBody[[]map[string]interface{}](t, rr); len(rows) != 3 {
+		t.Fatalf("expected 3 JSON rows, got %d", len(rows))
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/incomes/export?format=xlsx", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTrendMonths = 12
+	maxTrendMonths     = 120
+	// trendWindow is how many months each moving average covers.
+	trendWindow = 3
+)
+
+// SpendingTrend is spending per month over the last Months months, oldest
+// first, for one category or, with Category empty, for everything.
+type SpendingTrend struct {
+	Category string       `json:"category,omitempty"`
+	Months   int          `json:"months"`
+	Points   []TrendPoint `json:"points"`
+}
+
+// TrendPoint is one month of a trend. MovingAverage averages Total with the
+// trendWindow-1 months before it, including those before the trend starts.
+type TrendPoint struct {
+	Month         string  `json:"month"`
+	Total         float64 `json:"total"`
+	MovingAverage float64 `json:"moving_average"`
+}
+
+// movingAverages returns, for each of totals, the mean of it and the
+// window-1 values before it. The first few values have fewer before them
+// and are averaged over what there is.
+func movingAverages(totals []float64, window int) []float64 {
+	averages := make([]float64, len(totals))
+	sum := 0.0
+	for i, total := range totals {
+		sum += total
+		if i >= window {
+			sum -= totals[i-window]
+		}
+		averages[i] = roundCents(sum / float64(min(i+1, window)))
+	}
+	return averages
+}
+
+// trendHandler serves GET /reports/trend. category limits it to spending in
+// one category, split expenses counting towards each split's category;
+// months (default 12) is how many months to cover, ending with the current
+// month in the user's timezone. Months without spending are zero.
+func (app *App) trendHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "category", "months") {
+		return
+	}
+	months := defaultTrendMonths
+	if raw := strings.TrimSpace(params.Get("months")); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 || v > maxTrendMonths {
+			http.Error(w, "Invalid months; use a whole number from 1 to "+strconv.Itoa(maxTrendMonths), http.StatusBadRequest)
+			return
+		}
+		months = v
+	}
+	category := strings.TrimSpace(params.Get("category"))
+
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	month := reportPeriods["month"]
+	end := month.next(month.start(localDay(time.Now(), loc)))
+	// The months before the first point are fetched too so its moving
+	// average covers a full window.
+	start := end.AddDate(0, -(months + trendWindow - 1), 0)
+
+	query := "SELECT date, amount FROM expenses WHERE user_id = ? AND date >= ? AND date < ?"
+	args := []interface{}{userID, dayStart(start, loc), dayStart(end, loc)}
+	if category != "" {
+		query = "SELECT date, amount FROM " + expenseCategoryLines + " WHERE user_id = ? AND date >= ? AND date < ? AND category = ?"
+		args = append(args, category)
+	}
+	days, err := dailyTotals(app.requestDB(r), loc, query, args...)
+	if err != nil {
+		log.Printf("trend query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	byMonth := map[time.Time]float64{}
+	for day, total := range days {
+		byMonth[month.start(day)] += total
+	}
+	var starts []time.Time
+	var totals []float64
+	for t := start; t.Before(end); t = month.next(t) {
+		starts = append(starts, t)
+		totals = append(totals, roundCents(byMonth[t]))
+	}
+	averages := movingAverages(totals, trendWindow)
+
+	trend := SpendingTrend{Category: category, Months: months, Points: make([]TrendPoint, 0, months)}
+	for i := len(starts) - months; i < len(starts); i++ {
+		trend.Points = append(trend.Points, TrendPoint{Month: month.label(starts[i]), Total: totals[i], MovingAverage: averages[i]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trend)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMovingAverages(t *testing.T) {
+	cases := []struct {
+		name   string
+		totals []float64
+		window int
+		want   []float64
+	}{
+		{"empty", nil, 3, []float64{}},
+		{"partial windows at the start", []float64{30, 60, 90, 0}, 3, []float64{30, 45, 60, 50}},
+		{"zeros drag the average down", []float64{90, 0, 0, 0}, 3, []float64{90, 45, 30, 0}},
+		{"window of one is the totals", []float64{1, 2, 3}, 1, []float64{1, 2, 3}},
+		{"rounded to cents", []float64{10, 10, 10.01}, 3, []float64{10, 10, 10}},
+	}
+	for _, c := range cases {
+		if got := movingAverages(c.totals, c.window); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSpendingTrend(t *testing.T) {
+	useTestDB(t)
+
+	thisMonth := time.Now().UTC()
+	thisMonth = time.Date(thisMonth.Year(), thisMonth.Month(), 10, 12, 0, 0, 0, time.UTC)
+	for _, e := range []Expense{
+		{Amount: 90, Category: "Groceries", Date: thisMonth.AddDate(0, -3, 0)},
+		{Amount: 30, Category: "Groceries", Date: thisMonth.AddDate(0, -1, 0)},
+		{Amount: 50, Category: "Fuel", Date: thisMonth},
+		{Amount: 40, Category: "Shop", Date: thisMonth, Splits: []ExpenseSplit{{Category: "Groceries", Amount: 15}, {Category: "Home", Amount: 25}}},
+	} {
+		e.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+
+	trend := func(query string) SpendingTrend {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, "/reports/trend"+query, nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[SpendingTrend](t, rr)
+	}
+
+	// The month three back is outside the trend but still in the first
+	// point's average.
+	groceries := trend("?category=Groceries&months=3")
+	want := []TrendPoint{
+		{Month: thisMonth.AddDate(0, -2, 0).Format("2006-01"), Total: 0, MovingAverage: 30},
+		{Month: thisMonth.AddDate(0, -1, 0).Format("2006-01"), Total: 30, MovingAverage: 40},
+		{Month: thisMonth.Format("2006-01"), Total: 15, MovingAverage: 15},
+	}
+	if groceries.Category != "Groceries" || !reflect.DeepEqual(groceries.Points, want) {
+		t.Fatalf("unexpected groceries trend: %+v", groceries)
+	}
+
+	all := trend("")
+	if len(all.Points) != defaultTrendMonths || all.Points[defaultTrendMonths-1].Total != 90 {
+		t.Fatalf("expected 12 months of total spending ending with 90, got %+v", all.Points)
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/trend?months=0", nil), http.StatusBadRequest)
+	expectStatus(t, callAuthed(http.MethodGet, "/reports/trend?months=121", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Usage is how often a category or source was used and when it last was.
+type Usage struct {
+	Count    int       `json:"count"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+type CategoryUsage struct {
+	Category string `json:"category"`
+	Usage
+}
+
+type SourceUsage struct {
+	Source string `json:"source"`
+	Usage
+}
+
+// expenseCategoriesHandler lists the categories the user has spent on, for
+// pickers and typeahead. A split expense counts once at each of its splits'
+// categories, as in the category reports, and values are grouped exactly as
+// the category filter matches them.
+func (app *App) expenseCategoriesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	usages, ok := app.listUsage(w, r, userID, "SELECT category, COUNT(DISTINCT expense_id) AS uses, MAX(date) FROM "+expenseCategoryLines+" WHERE user_id = ? AND LOWER(category) LIKE ? GROUP BY category ORDER BY uses DESC, category LIMIT ? OFFSET ?")
+	if !ok {
+		return
+	}
+	categories := make([]CategoryUsage, len(usages))
+	for i, u := range usages {
+		categories[i] = CategoryUsage{Category: u.name, Usage: u.Usage}
+	}
+	writeJSONList(w, categories)
+}
+
+// incomeSourcesHandler lists the sources the user has recorded income from.
+func (app *App) incomeSourcesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	usages, ok := app.listUsage(w, r, userID, "SELECT source, COUNT(*) AS uses, MAX(date) FROM incomes WHERE user_id = ? AND LOWER(source) LIKE ? GROUP BY source ORDER BY uses DESC, source LIMIT ? OFFSET ?")
+	if !ok {
+		return
+	}
+	sources := make([]SourceUsage, len(usages))
+	for i, u := range usages {
+		sources[i] = SourceUsage{Source: u.name, Usage: u.Usage}
+	}
+	writeJSONList(w, sources)
+}
+
+type namedUsage struct {
+	name string
+	Usage
+}
+
+// listUsage runs query, which selects a name, its count and its latest date
+// and takes the user ID, a LIKE pattern and the page, with the ?q= prefix
+// matched case-insensitively and the page read from the request.
+func (app *App) listUsage(w http.ResponseWriter, r *http.Request, userID int, query string) ([]namedUsage, bool) {
+	params := r.URL.Query()
+	limit, offset, ok := parsePagination(w, params)
+	if !ok {
+		return nil, false
+	}
+	q := strings.ToLower(strings.TrimSpace(params.Get("q")))
+
+	rows, err := app.requestDB(r).Query(query, userID, q+"%", limit, offset)
+	if err != nil {
+		log.Printf("usage query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	defer rows.Close()
+
+	usages := []namedUsage{}
+	for rows.Next() {
+		var u namedUsage
+		var lastUsed string
+		if err := rows.Scan(&u.name, &u.Count, &lastUsed); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil, false
+		}
+		if u.LastUsed, err = parseTimestamp(lastUsed); err != nil {
+			log.Printf("usage date parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil, false
+		}
+		u.LastUsed = outputTime(u.LastUsed)
+		usages = append(usages, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return usages, true
+}
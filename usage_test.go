@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCategoryAndSourceUsage(t *testing.T) {
+	useTestDB(t)
+	day := func(d int) time.Time { return time.Date(2025, time.March, d, 12, 0, 0, 0, time.UTC) }
+	expenses := []Expense{
+		{Amount: 5, Category: "Groceries", Date: day(1)},
+		{Amount: 7, Category: "Groceries", Date: day(9)},
+		{Amount: 3, Category: "Gifts", Date: day(4)},
+		{Amount: 2, Category: "Fuel", Date: day(2)},
+		// Counts once at each split's category, not at its own.
+		{Amount: 10, Category: "Shopping", Date: day(6), Splits: []ExpenseSplit{{Category: "Gifts", Amount: 6}, {Category: "Groceries", Amount: 4}}},
+	}
+	for _, e := range expenses {
+		e.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+	for _, in := range []Income{{Amount: 100, Source: "Salary", Date: day(1)}, {Amount: 100, Source: "Salary", Date: day(31)}, {Amount: 20, Source: "Refund", Date: day(5)}} {
+		in.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/incomes", in), http.StatusCreated)
+	}
+	other, _ := registerUser(t, "other@example.com", "OtherUserPass123!")
+	theirs := decodeBody[Account](t, callAuthedAs(other, http.MethodPost, "/accounts", Account{Name: "Theirs", Type: "cash"}))
+	expectStatus(t, callAuthedAs(other, http.MethodPost, "/expenses", Expense{Amount: 1, Category: "Gadgets", AccountID: &theirs.ID}), http.StatusCreated)
+
+	categories := func(target string) []CategoryUsage {
+		t.Helper()
+		rr := callAuthed(http.MethodGet, target, nil)
+		expectStatus(t, rr, http.StatusOK)
+		return decodeBody[[]CategoryUsage](t, rr)
+	}
+	got := categories("/expenses/categories")
+	want := []CategoryUsage{
+		{"Groceries", Usage{3, day(9)}},
+		{"Gifts", Usage{2, day(6)}},
+		{"Fuel", Usage{1, day(2)}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	for i := range want {
+		if got[i].Category != want[i].Category || got[i].Count != want[i].Count || !got[i].LastUsed.Equal(want[i].LastUsed) {
+			t.Fatalf("expected %+v, got %+v", want, got)
+		}
+	}
+
+	// q is a case-insensitive prefix, and ties are broken by name.
+	if got := categories("/expenses/categories?q=g"); len(got) != 2 || got[0].Category != "Groceries" || got[1].Category != "Gifts" {
+		t.Fatalf("expected the G categories, got %+v", got)
+	}
+	if got := categories("/expenses/categories?q=ROC"); len(got) != 0 {
+		t.Fatalf("expected q to match only at the start, got %+v", got)
+	}
+	if got := categories("/expenses/categories?limit=1&offset=1"); len(got) != 1 || got[0].Category != "Gifts" {
+		t.Fatalf("expected the second category alone, got %+v", got)
+	}
+
+	rr := callAuthed(http.MethodGet, "/incomes/sources?q=s", nil)
+	expectStatus(t, rr, http.StatusOK)
+	sources := decodeBody[[]SourceUsage](t, rr)
+	if len(sources) != 1 || sources[0].Source != "Salary" || sources[0].Count != 2 || !sources[0].LastUsed.Equal(day(31)) {
+		t.Fatalf("unexpected sources: %+v", sources)
+	}
+
+	expectStatus(t, callAuthed(http.MethodGet, "/incomes/sources?limit=0", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+)
+
+// accountDeletionGracePeriod is how long a deactivated user can log back in
+// to cancel deletion before purgeDeactivatedUsers removes them for good.
+const accountDeletionGracePeriod = 7 * 24 * time.Hour
+
+type deleteUserRequest struct {
+	Password string `json:"password"`
+}
+
+// deleteUser deactivates the authenticated user, starting the grace period,
+// or removes them outright when ?immediate=true is given. Either way every
+// session is revoked. Owned data is removed by ON DELETE CASCADE once the
+// user row itself is deleted.
+func (app *App) deleteUser(w http.ResponseWriter, r *http.Request, userID int) {
+	var req deleteUserRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	if req.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	immediate, ok := parseBoolParam(w, r.URL.Query(), "immediate")
+	if !ok {
+		return
+	}
+
+	var passwordHash string
+	var lockedUntil sql.NullString
+	err := app.db.QueryRow("SELECT password_hash, locked_until FROM users WHERE id = ?", userID).Scan(&passwordHash, &lockedUntil)
+	if err == sql.ErrNoRows {
+		writeAuthError(w, authErrorInvalidSession, "Unauthorized")
+		return
+	} else if err != nil {
+		log.Printf("user lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The password is guarded as on login, so a stolen session cannot be
+	// used to guess it here without running into the lockout.
+	now := time.Now().UTC()
+	remaining, err := app.activeLockout(userID, lockedUntil, now)
+	if err != nil {
+		log.Printf("lockout check error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if remaining > 0 {
+		writeLockedError(w, remaining)
+		return
+	}
+
+	if err := comparePassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		locked, err := app.recordFailedLogin(userID, app.clientIP(r), now)
+		if err != nil {
+			log.Printf("record failed login error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if locked > 0 {
+			writeLockedError(w, locked)
+			return
+		}
+		http.Error(w, "Invalid password", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		log.Printf("tx begin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if immediate {
+		_, err = tx.Exec("DELETE FROM users WHERE id = ?", userID)
+	} else {
+		_, err = tx.Exec("UPDATE users SET deactivated_at = ?, failed_logins = 0 WHERE id = ?", now.Format(timeFormat), userID)
+	}
+	if err != nil {
+		log.Printf("user delete error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		log.Printf("session delete error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("tx commit error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if immediate {
+		log.Printf("user %d deleted", userID)
+	} else {
+		log.Printf("user %d deactivated; scheduled for deletion", userID)
+	}
+
+	clearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeDeactivatedUsers permanently deletes users whose grace period has
+// elapsed.
+func (app *App) purgeDeactivatedUsers() {
+	cutoff := time.Now().UTC().Add(-accountDeletionGracePeriod)
+	res, err := app.db.Exec("DELETE FROM users WHERE deactivated_at IS NOT NULL AND deactivated_at <= ?", cutoff.Format(timeFormat))
+	if err != nil {
+		log.Printf("Error purging deactivated users: %v", err)
+		return
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		log.Printf("Purged %d deactivated users", n)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// registerUser creates an additional user and returns its session cookie and ID.
+func registerUser(t *testing.T, email, password string) (*http.Cookie, int) {
+	t.Helper()
+
+	body, _ := json.Marshal(credentials{Email: email, Password: password})
+	rr := httptest.NewRecorder()
+	testApp.registerHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/register", bytes.NewReader(body)))
+	expectStatus(t, rr, http.StatusCreated)
+
+	resp := decodeBody[authResponse](t, rr)
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			return c, resp.ID
+		}
+	}
+	t.Fatalf("session cookie not set for %s", email)
+	return nil, 0
+}
+
+func deleteUserRequestWith(t *testing.T, cookie *http.Cookie, target, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	return callAuthedAs(cookie, http.MethodDelete, target, deleteUserRequest{Password: password})
+}
+
+func TestDeleteUserGracePeriod(t *testing.T) {
+	useTestDB(t)
+
+	const email, password = "leaving@example.com", "LeavingSoonPass123!"
+	cookie, userID := registerUser(t, email, password)
+
+	wrongRR := deleteUserRequestWith(t, cookie, "/auth/account", "not-the-password")
+	expectStatus(t, wrongRR, http.StatusForbidden)
+
+	okRR := deleteUserRequestWith(t, cookie, "/auth/account", password)
+	expectStatus(t, okRR, http.StatusNoContent)
+
+	var deactivatedAt sql.NullString
+	if err := testApp.db.QueryRow("SELECT deactivated_at FROM users WHERE id = ?", userID).Scan(&deactivatedAt); err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if !deactivatedAt.Valid {
+		t.Fatalf("expected user to be deactivated")
+	}
+
+	var sessions int
+	testApp.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = ?", userID).Scan(&sessions)
+	if sessions != 0 {
+		t.Fatalf("expected sessions to be revoked, found %d", sessions)
+	}
+
+	body, _ := json.Marshal(credentials{Email: email, Password: password})
+	loginRR := httptest.NewRecorder()
+	testApp.loginHandler(loginRR, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body)))
+	expectStatus(t, loginRR, http.StatusOK)
+
+	if err := testApp.db.QueryRow("SELECT deactivated_at FROM users WHERE id = ?", userID).Scan(&deactivatedAt); err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if deactivatedAt.Valid {
+		t.Fatalf("expected login to cancel pending deletion")
+	}
+}
+
+func TestDeleteUserImmediateCascades(t *testing.T) {
+	useTestDB(t)
+
+	const password = "GoingNowPass123!"
+	cookie, userID := registerUser(t, "gone@example.com", password)
+
+	if _, err := testApp.db.Exec("INSERT INTO expenses(amount, category, note, date, user_id) VALUES(?, ?, ?, ?, ?)", 5, "Misc", "", time.Now().UTC().Format(timeFormat), userID); err != nil {
+		t.Fatalf("seed expense: %v", err)
+	}
+
+	rr := deleteUserRequestWith(t, cookie, "/auth/account?immediate=true", password)
+	expectStatus(t, rr, http.StatusNoContent)
+
+	var users, expenses int
+	testApp.db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&users)
+	testApp.db.QueryRow("SELECT COUNT(*) FROM expenses WHERE user_id = ?", userID).Scan(&expenses)
+	if users != 0 || expenses != 0 {
+		t.Fatalf("expected user and owned data removed, got users=%d expenses=%d", users, expenses)
+	}
+}
+
+func TestDeleteUserPasswordLockout(t *testing.T) {
+	useTestDB(t)
+
+	const password = "StayingPutPass123!"
+	cookie, userID := registerUser(t, "careful@example.com", password)
+
+	expectStatus(t, deleteUserRequestWith(t, cookie, "/auth/account?immediate=yes", password), http.StatusBadRequest)
+
+	// Wrong passwords count toward the same lockout as failed logins.
+	for i := 0; i < maxFailedLogins-1; i++ {
+		expectStatus(t, deleteUserRequestWith(t, cookie, "/auth/account", "not-the-password"), http.StatusForbidden)
+	}
+	expectStatus(t, deleteUserRequestWith(t, cookie, "/auth/account", "not-the-password"), http.StatusLocked)
+	expectStatus(t, deleteUserRequestWith(t, cookie, "/auth/account?immediate=true", password), http.StatusLocked)
+
+	var users int
+	var deactivatedAt sql.NullString
+	if err := testApp.db.QueryRow("SELECT COUNT(*), MAX(deactivated_at) FROM users WHERE id = ?", userID).Scan(&users, &deactivatedAt); err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if users != 1 || deactivatedAt.Valid {
+		t.Fatalf("expected the locked user to be kept, got users=%d deactivated_at=%v", users, deactivatedAt)
+	}
+}
+
+func TestPurgeDeactivatedUsers(t *testing.T) {
+	useTestDB(t)
+
+	_, userID := registerUser(t, "expired@example.com", "ExpiredGracePass123!")
+
+	past := time.Now().UTC().Add(-accountDeletionGracePeriod - time.Hour).Format(timeFormat)
+	if _, err := testApp.db.Exec("UPDATE users SET deactivated_at = ? WHERE id = ?", past, userID); err != nil {
+		t.Fatalf("deactivate user: %v", err)
+	}
+
+	testApp.purgeDeactivatedUsers()
+
+	var users int
+	testApp.db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&users)
+	if users != 0 {
+		t.Fatalf("expected purged user to be gone")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Free-text fields are capped in runes, not bytes, so the limit is the same
+// for every script.
+const (
+	maxNoteLength = 1000
+	maxNameLength = 100
+)
+
+// textField is a free-text field of a request body, cleaned and checked by
+// cleanText.
+type textField struct {
+	name      string
+	value     *string
+	max       int
+	multiline bool
+}
+
+// noteField is a note: long, and allowed to keep line breaks and tabs.
+func noteField(name string, value *string) textField {
+	return textField{name: name, value: value, max: maxNoteLength, multiline: true}
+}
+
+// nameField is a short single-line label such as a category or source.
+func nameField(name string, value *string) textField {
+	return textField{name: name, value: value, max: maxNameLength}
+}
+
+// cleanText trims each field and strips control characters from it, then
+// rejects the first one over its limit with an error naming the field. Nil
+// values are skipped, for optional fields.
+func cleanText(fields ...textField) error {
+	for _, f := range fields {
+		if f.value == nil {
+			continue
+		}
+		*f.value = strings.TrimSpace(strings.Map(func(r rune) rune {
+			if f.multiline && (r == '\n' || r == '\t') {
+				return r
+			}
+			if unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, *f.value))
+		if utf8.RuneCountInString(*f.value) > f.max {
+			return fmt.Errorf("%s must be %d characters or fewer", f.name, f.max)
+		}
+	}
+	return nil
+}
+
+func validateExpenseText(e *Expense) error {
+	fields := []textField{nameField("category", &e.Category), noteField("note", &e.Note), nameField("payee", e.Payee)}
+	for i := range e.Splits {
+		fields = append(fields,
+			nameField(fmt.Sprintf("splits[%d].category", i), &e.Splits[i].Category),
+			noteField(fmt.Sprintf("splits[%d].note", i), &e.Splits[i].Note))
+	}
+	return cleanText(fields...)
+}
+
+func validateIncomeText(i *Income) error {
+	return cleanText(nameField("source", &i.Source), noteField("note", &i.Note))
+}
+
+func validateBudgetText(b *Budget) error {
+	return cleanText(nameField("category", &b.Category))
+}
+
+func validateRecurringExpenseText(re *RecurringExpense) error {
+	return cleanText(nameField("category", &re.Category), noteField("note", &re.Note))
+}
+
+func validateAccountText(a *Account) error {
+	return cleanText(nameField("name", &a.Name), nameField("type", &a.Type))
+}
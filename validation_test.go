@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCleanText(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+		field          func(string, *string) textField
+		err            bool
+	}{
+		{"trims", "  Groceries \n", "Groceries", nameField, false},
+		{"strips controls", "Gro\x00cer\x1bies\u0085", "Groceries", nameField, false},
+		{"names drop line breaks", "Eating\nout", "Eatingout", nameField, false},
+		{"notes keep line breaks", "milk\n\teggs\r\n", "milk\n\teggs", noteField, false},
+		{"name at limit", strings.Repeat("a", maxNameLength), strings.Repeat("a", maxNameLength), nameField, false},
+		{"name over limit", strings.Repeat("a", maxNameLength+1), "", nameField, true},
+		// 100 three-byte runes are 300 bytes but within the limit.
+		{"counts runes", strings.Repeat("日", maxNameLength), strings.Repeat("日", maxNameLength), nameField, false},
+		{"multilingual note over limit", strings.Repeat("é", maxNoteLength+1), "", noteField, true},
+		{"limit applies after trimming", " " + strings.Repeat("a", maxNameLength) + " ", strings.Repeat("a", maxNameLength), nameField, false},
+	}
+	for _, c := range cases {
+		value := c.in
+		err := cleanText(c.field("field", &value))
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.name)
+			}
+			continue
+		}
+		if err != nil || value != c.want {
+			t.Errorf("%s: got %q, %v; want %q", c.name, value, err, c.want)
+		}
+	}
+
+	if err := cleanText(nameField("payee", nil)); err != nil {
+		t.Errorf("nil field: %v", err)
+	}
+}
+
+func TestTextLimits(t *testing.T) {
+	useTestDB(t)
+
+	long := strings.Repeat("x", maxNameLength+1)
+	longNote := strings.Repeat("x", maxNoteLength+1)
+	cases := []struct {
+		path string
+		body interface{}
+		want string
+	}{
+		{"/expenses", Expense{Amount: 1, Category: long}, "category must be 100 characters or fewer"},
+		{"/expenses", Expense{Amount: 1, Note: longNote}, "note must be 1000 characters or fewer"},
+		{"/expenses", Expense{Amount: 1, Payee: &long}, "payee must be 100 characters or fewer"},
+		{"/expenses", Expense{Amount: 2, Splits: []ExpenseSplit{{Category: "Food", Amount: 1}, {Category: "Fun", Amount: 1, Note: longNote}}}, "splits[1].note must be 1000 characters or fewer"},
+		{"/incomes", Income{Amount: 1, Source: long}, "source must be 100 characters or fewer"},
+		{"/incomes", Income{Amount: 1, Source: "Salary", Note: longNote}, "note must be 1000 characters or fewer"},
+		{"/budgets", Budget{Amount: 1, Category: long}, "category must be 100 characters or fewer"},
+		{"/recurring-expenses", RecurringExpense{Amount: 1, Frequency: "monthly", Category: long}, "category must be 100 characters or fewer"},
+		{"/recurring-expenses", RecurringExpense{Amount: 1, Frequency: "monthly", Note: longNote}, "note must be 1000 characters or fewer"},
+		{"/accounts", Account{Name: long, Type: "Cash"}, "name must be 100 characters or fewer"},
+		{"/accounts", Account{Name: "Wallet", Type: long}, "type must be 100 characters or fewer"},
+	}
+	for _, c := range cases {
+		rr := callAuthed(http.MethodPost, c.path, c.body)
+		expectStatus(t, rr, http.StatusBadRequest)
+		if got := strings.TrimSpace(rr.Body.String()); got != c.want {
+			t.Errorf("POST %s: got %q, want %q", c.path, got, c.want)
+		}
+	}
+
+	// Accepted values come back cleaned.
+	rr := callAuthed(http.MethodPost, "/expenses", Expense{Amount: 3, Category: " Café\u0007 ", Note: "line one\nline two\x00", AccountID: testAccount()})
+	expectStatus(t, rr, http.StatusCreated)
+	e := decodeBody[Expense](t, rr)
+	if e.Category != "Café" || e.Note != "line one\nline two" {
+		t.Fatalf("expected cleaned text, got %q / %q", e.Category, e.Note)
+	}
+	expectStatus(t, callAuthed(http.MethodPut, fmt.Sprintf("/expenses/%d", e.ID), Expense{Amount: 3, Category: long}), http.StatusBadRequest)
+
+	// Imports are held to the same limits.
+	doc := exportDocument{SchemaVersion: exportSchemaVersion, Incomes: []Income{{ID: 7, Amount: 1, Source: long}}}
+	rr = callAuthed(http.MethodPost, "/import?merge=true", doc)
+	expectStatus(t, rr, http.StatusBadRequest)
+	if got := strings.TrimSpace(rr.Body.String()); got != "source must be 100 characters or fewer on income 7" {
+		t.Fatalf("unexpected import error: %q", got)
+	}
+}
+
+func TestRequestBodyChecks(t *testing.T) {
+	const limit = 64
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]string
+		if decodeJSONBodyLimit(w, r, &v, limit) {
+			fmt.Fprint(w, v["note"])
+		}
+	})
+	post := func(body, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rr := httptest.NewRecorder()
+		echo.ServeHTTP(rr, req)
+		return rr
+	}
+	// note pads a body to exactly n bytes.
+	note := func(n int) string {
+		return `{"note":"` + strings.Repeat("x", n-len(`{"note":""}`)) + `"}`
+	}
+
+	if rr := post(note(limit), "application/json"); rr.Code != http.StatusOK || len(rr.Body.String()) != limit-len(`{"note":""}`) {
+		t.Fatalf("expected a body exactly at the limit accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+	for _, contentType := range []string{"", "application/json; charset=utf-8", "application/merge-patch+json"} {
+		expectStatus(t, post(note(10+len(`{"note":""}`)), contentType), http.StatusOK)
+	}
+
+	rr := post(note(limit+1), "application/json")
+	expectStatus(t, rr, http.StatusRequestEntityTooLarge)
+	if e := decodeBody[apiError](t, rr); e.Code != bodyErrorTooLarge || !strings.Contains(e.Error, "64 bytes") {
+		t.Fatalf("unexpected 413 body: %+v", e)
+	}
+	// Trailing bytes past the limit after a complete object trip it too.
+	expectStatus(t, post(note(limit)+strings.Repeat(" ", 10), "application/json"), http.StatusRequestEntityTooLarge)
+
+	for _, contentType := range []string{"application/x-www-form-urlencoded", "text/plain", "multipart/form-data; boundary=x", "application/json-ish", "not a type"} {
+		rr := post("note=x", contentType)
+		expectStatus(t, rr, http.StatusUnsupportedMediaType)
+		if e := decodeBody[apiError](t, rr); e.Code != bodyErrorUnsupportedType {
+			t.Fatalf("unexpected 415 body for %q: %+v", contentType, e)
+		}
+	}
+
+	// The real endpoints answer the same way.
+	useTestDB(t)
+	req := authedRequest(http.MethodPost, "/expenses", Expense{Amount: 5, Category: "Food", AccountID: testAccount()})
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	expectStatus(t, serve(req), http.StatusUnsupportedMediaType)
+	big := `{"amount": 5, "category": "Food", "note": "` + strings.Repeat("x", maxJSONBody) + `"}`
+	req = httptest.NewRequest(http.MethodPost, "/expenses", strings.NewReader(big))
+	req.AddCookie(testSessionCookie)
+	req.Header.Set("Content-Type", "application/json")
+	expectStatus(t, serve(req), http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersion is the current API version, served under apiPrefix.
+const (
+	apiVersion = "v1"
+	apiPrefix  = "/api/" + apiVersion
+)
+
+// The unversioned paths the API used to be served at still work, but answer
+// with Deprecation and Sunset headers until legacySunset, after which they
+// may be removed.
+var (
+	legacyDeprecatedAt = time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, 4, 16, 0, 0, 0, 0, time.UTC)
+)
+
+// version is the release this binary was built from; set it with
+// -ldflags "-X main.version=1.2.3".
+var version = "dev"
+
+// withLegacyPaths serves requests for the old unversioned paths, such as
+// /expenses/12, from their /api/v1 equivalent by rewriting the path, so
+// every handler is registered once. The response says the path is
+// deprecated (RFC 9745), when it goes away (RFC 8594), and where it moved.
+func withLegacyPaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		u := *r.URL
+		u.Path = apiPrefix + u.Path
+		if u.RawPath != "" {
+			u.RawPath = apiPrefix + u.RawPath
+		}
+		h := w.Header()
+		h.Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecatedAt.Unix(), 10))
+		h.Set("Sunset", legacySunset.Format(http.TimeFormat))
+		h.Set("Link", "<"+u.EscapedPath()+`>; rel="successor-version"`)
+		r2 := r.Clone(r.Context())
+		r2.URL = &u
+		next.ServeHTTP(w, r2)
+	})
+}
+
+type versionInfo struct {
+	APIVersion string     `json:"api_version"`
+	Version    string     `json:"version"`
+	GoVersion  string     `json:"go_version"`
+	Commit     string     `json:"commit,omitempty"`
+	CommitTime *time.Time `json:"commit_time,omitempty"`
+	Modified   bool       `json:"modified"`
+}
+
+// buildVersionInfo reads the VCS details the go tool stamps into binaries
+// built from a checkout.
+func buildVersionInfo() versionInfo {
+	info := versionInfo{APIVersion: apiVersion, Version: version}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = bi.GoVersion
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.time":
+			if t, err := time.Parse(time.RFC3339, s.Value); err == nil {
+				info.CommitTime = &t
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildVersionInfo())
+}
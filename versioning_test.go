@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLegacyPathAliases(t *testing.T) {
+	useTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	created := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 8, Category: "Lunch", Date: now, AccountID: testAccount()}))
+	callAuthed(http.MethodPost, apiPrefix+"/incomes", Income{Amount: 50, Source: "Gift", Date: now, AccountID: testAccount()})
+
+	for _, path := range []string{
+		"/expenses",
+		fmt.Sprintf("/expenses/%d", created.ID),
+		"/expenses/aggregates?query=totals_by_category",
+		"/incomes",
+		"/accounts",
+		"/reports/income-vs-expense",
+	} {
+		legacy := callAuthed(http.MethodGet, path, nil)
+		current := callAuthed(http.MethodGet, apiPrefix+path, nil)
+		expectStatus(t, legacy, http.StatusOK)
+		expectStatus(t, current, http.StatusOK)
+		if legacy.Body.String() != current.Body.String() {
+			t.Fatalf("%s: bodies differ:\nlegacy:  %s\ncurrent: %s", path, legacy.Body.String(), current.Body.String())
+		}
+
+		if got := legacy.Header().Get("Deprecation"); got != fmt.Sprintf("@%d", legacyDeprecatedAt.Unix()) {
+			t.Fatalf("%s: unexpected Deprecation header %q", path, got)
+		}
+		if got := legacy.Header().Get("Sunset"); got != legacySunset.Format(http.TimeFormat) {
+			t.Fatalf("%s: unexpected Sunset header %q", path, got)
+		}
+		successor := apiPrefix + strings.Split(path, "?")[0]
+		if got := legacy.Header().Get("Link"); got != "<"+successor+`>; rel="successor-version"` {
+			t.Fatalf("%s: unexpected Link header %q", path, got)
+		}
+		for _, h := range []string{"Deprecation", "Sunset", "Link"} {
+			if got := current.Header().Get(h); got != "" {
+				t.Fatalf("%s: versioned path sent %s: %q", path, h, got)
+			}
+		}
+	}
+
+	// Routing behaves the same under both forms.
+	expectStatus(t, callAuthed(http.MethodPatch, apiPrefix+"/expenses", nil), http.StatusMethodNotAllowed)
+	expectStatus(t, callAuthed(http.MethodGet, apiPrefix+"/expenses/abc", nil), http.StatusNotFound)
+	expectStatus(t, callAuthed(http.MethodGet, apiPrefix+"/expenses/", nil), http.StatusOK)
+	expectStatus(t, callAuthed(http.MethodGet, "/api/v2/expenses", nil), http.StatusNotFound)
+	expectStatus(t, serve(httptest.NewRequest(http.MethodGet, apiPrefix+"/expenses", nil)), http.StatusUnauthorized)
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	useTestDB(t)
+
+	rr := serve(httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	expectStatus(t, rr, http.StatusOK)
+	info := decodeBody[versionInfo](t, rr)
+	if info.APIVersion != apiVersion || info.Version == "" || !strings.HasPrefix(info.GoVersion, "go") {
+		t.Fatalf("unexpected version info: %+v", info)
+	}
+	if rr.Header().Get("Deprecation") != "" {
+		t.Fatal("version endpoint should not be treated as a legacy path")
+	}
+}
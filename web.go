@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// webCSP replaces the API's Content-Security-Policy on UI files so the
+// page can load its own scripts, styles, and images and call the API.
+const webCSP = "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'"
+
+// isHashedAsset reports whether name carries a content hash, such as
+// app.3f2a9c1b.js or index-B7d2Xk9q.css, the way bundlers name files: a
+// last dot- or dash-separated part of the stem at least eight letters and
+// digits long, with a digit in it. Such files never change, so they can be
+// cached for good.
+func isHashedAsset(name string) bool {
+	base := path.Base(name)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	i := strings.LastIndexAny(stem, ".-")
+	if i < 0 {
+		return false
+	}
+	hash := stem[i+1:]
+	if len(hash) < 8 || !strings.ContainsAny(hash, "0123456789") {
+		return false
+	}
+	for _, c := range hash {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// withWebUI serves the web UI in dir for GET and HEAD requests outside
+// /api that no API route answers, so the UI never shadows the old
+// unversioned API paths. A path naming a file serves that file; any other
+// path from a browser (Accept: text/html) gets index.html, so the UI can
+// route on the client; the rest fall through to next and its JSON 404.
+// Directories are never listed, and dotfiles are never served.
+func withWebUI(dir string, api *http.ServeMux, next http.Handler) http.Handler {
+	root := http.Dir(dir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+			r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") || isAPIPath(api, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name := path.Clean("/" + r.URL.Path)
+		if name == "/" {
+			name = "/index.html"
+		}
+		if serveWebFile(w, r, root, name) {
+			return
+		}
+		if strings.Contains(r.Header.Get("Accept"), "text/html") && serveWebFile(w, r, root, "/index.html") {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAPIPath reports whether the legacy API path r names has a route on api,
+// with any method.
+func isAPIPath(api *http.ServeMux, r *http.Request) bool {
+	probe := r.Clone(r.Context())
+	probe.URL.Path = strings.TrimSuffix(r.URL.Path, "/")
+	probe.URL.RawPath = ""
+	h, pattern := api.Handler(probe)
+	if pattern != "" {
+		return true
+	}
+	scratch := &scratchWriter{header: http.Header{}}
+	h.ServeHTTP(scratch, probe)
+	return scratch.status == http.StatusMethodNotAllowed
+}
+
+// serveWebFile serves the regular file name under root and reports whether
+// there was one. A directory counts only through its index.html.
+func serveWebFile(w http.ResponseWriter, r *http.Request, root http.FileSystem, name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+	f, err := root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		index, err := root.Open(path.Join(name, "index.html"))
+		if err != nil {
+			return false
+		}
+		defer index.Close()
+		if info, err = index.Stat(); err != nil || info.IsDir() {
+			return false
+		}
+		f, name = index, path.Join(name, "index.html")
+	}
+	if !info.Mode().IsRegular() {
+		return false
+	}
+
+	h := w.Header()
+	h.Set("Content-Security-Policy", webCSP)
+	if isHashedAsset(name) {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		// Revalidated on every use against Last-Modified, so a deploy
+		// shows up at once.
+		h.Set("Cache-Control", "no-cache")
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+	return true
+}
+
+// checkWebDir reports why dir cannot be served as the web UI.
+func checkWebDir(dir string) error {
+	info, err := os.Stat(filepath.Join(dir, "index.html"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return errors.New("web directory " + dir + " has no index.html")
+	}
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("web directory " + dir + " has no index.html file")
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebUI(t *testing.T) {
+	useTestDB(t)
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":             "<!doctype html><title>Expenses</title>",
+		"robots.txt":             "User-agent: *",
+		"assets/app.3f2a9c1b.js": "console.log('app')",
+		"assets/logo.svg":        "<svg/>",
+		"guide/index.html":       "<p>guide</p>",
+		"empty/readme-notes.txt": "not an index",
+		".env":                   "SECRET=1",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := testApp.cfg
+	cfg.WebDir = dir
+	router := NewApp(testApp.db, cfg)
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	const browser = "text/html,application/xhtml+xml,*/*;q=0.8"
+	expectBody := func(rr *httptest.ResponseRecorder, want, cache string) {
+		t.Helper()
+		expectStatus(t, rr, http.StatusOK)
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Fatalf("expected body with %q, got %q", want, rr.Body.String())
+		}
+		if got := rr.Header().Get("Cache-Control"); got != cache {
+			t.Fatalf("expected Cache-Control %q, got %q", cache, got)
+		}
+		if got := rr.Header().Get("Content-Security-Policy"); got != webCSP {
+			t.Fatalf("expected the UI policy, got %q", got)
+		}
+	}
+	const revalidate, immutable = "no-cache", "public, max-age=31536000, immutable"
+
+	expectBody(get("/", ""), "<title>Expenses</title>", revalidate)
+	expectBody(get("/robots.txt", ""), "User-agent", revalidate)
+	expectBody(get("/assets/app.3f2a9c1b.js", ""), "console.log", immutable)
+	expectBody(get("/assets/logo.svg", ""), "<svg/>", revalidate)
+	expectBody(get("/guide/", ""), "guide", revalidate)
+
+	// Unknown paths fall back to index.html for browsers only.
+	expectBody(get("/settings/profile", browser), "<title>Expenses</title>", revalidate)
+	rr := get("/settings/profile", "application/json")
+	expectStatus(t, rr, http.StatusNotFound)
+	if e := decodeBody[apiError](t, rr); e.Code != routeErrorNotFound {
+		t.Fatalf("expected the JSON 404, got %+v", e)
+	}
+
+	// No directory listings and no dotfiles.
+	expectStatus(t, get("/empty", ""), http.StatusNotFound)
+	expectBody(get("/empty", browser), "<title>Expenses</title>", revalidate)
+	expectStatus(t, get("/.env", ""), http.StatusNotFound)
+	if rr := get("/.env", browser); strings.Contains(rr.Body.String(), "SECRET") {
+		t.Fatal("expected the dotfile not to be served")
+	}
+
+	// API routes win, with any method and on their old unversioned paths.
+	for _, target := range []string{"/expenses", "/expenses/12", "/expenses/", apiPrefix + "/expenses", "/recurring-expenses/upcoming"} {
+		rr := get(target, browser)
+		expectStatus(t, rr, http.StatusUnauthorized)
+		if _, ok := decodeBody[map[string]interface{}](t, rr)["code"]; !ok {
+			t.Fatalf("%s: expected the API's JSON error, got %s", target, rr.Body.String())
+		}
+	}
+	expectStatus(t, get("/auth/login", browser), http.StatusMethodNotAllowed)
+	if rr := get("/docs", browser); rr.Header().Get("Content-Security-Policy") == webCSP {
+		t.Fatal("expected /docs to be the API reference")
+	}
+	post := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, post)
+	expectStatus(t, rr, http.StatusTemporaryRedirect)
+
+	// Conditional requests are answered from the file's modification time.
+	modified := get("/", "").Header().Get("Last-Modified")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-Modified-Since", modified)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	expectStatus(t, rr, http.StatusNotModified)
+	if _, err := time.Parse(http.TimeFormat, modified); err != nil {
+		t.Fatalf("expected a Last-Modified date, got %q", modified)
+	}
+
+	// Without a web directory / redirects to the API as before.
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", browser)
+	rr = httptest.NewRecorder()
+	NewApp(testApp.db, testApp.cfg).ServeHTTP(rr, req)
+	expectStatus(t, rr, http.StatusTemporaryRedirect)
+}
+
+func TestIsHashedAsset(t *testing.T) {
+	for name, want := range map[string]bool{
+		"/assets/app.3f2a9c1b.js":     true,
+		"/assets/index-B7d2Xk9q.css":  true,
+		"/assets/chunk.0123456789.js": true,
+		"/index.html":                 false,
+		"/recurring-expenses.ics":     false,
+		"/assets/app.js":              false,
+		"/assets/app.3f2a9c.js":       false,
+	} {
+		if got := isHashedAsset(name); got != want {
+			t.Errorf("isHashedAsset(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestCheckWebDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkWebDir(dir); err == nil {
+		t.Fatal("expected a directory without index.html to be refused")
+	}
+	if err := checkWebDir(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected a missing directory to be refused")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<!doctype html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWebDir(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhooks push every transaction a user creates to a URL of theirs. Events
+// are queued as rows of webhook_deliveries in the same transaction as the
+// change they report, so a rolled back change never sends one, and a
+// background dispatcher posts them once committed. Delivery is at least
+// once: a failed post is retried with exponential backoff, and a receiver
+// that crashes after accepting one may see it again, so receivers should
+// deduplicate on X-Webhook-Delivery.
+
+const (
+	webhookEventExpenseCreated = "expense.created"
+	webhookEventIncomeCreated  = "income.created"
+	// webhookEventTest is only sent by POST /webhooks/{id}/test and cannot be
+	// subscribed to.
+	webhookEventTest = "webhook.test"
+
+	webhookStatusPending   = "pending"
+	webhookStatusDelivered = "delivered"
+	webhookStatusFailed    = "failed"
+
+	maxWebhooksPerUser  = 10
+	maxWebhookURLLength = 2048
+
+	// webhookMaxAttempts is how many times a delivery is tried before it is
+	// marked failed. The wait after the nth failure is webhookRetryBase
+	// doubled n-1 times, so the last try comes about an hour after the first.
+	webhookMaxAttempts = 8
+	webhookRetryBase   = 30 * time.Second
+	// webhookPollInterval is how often the dispatcher looks for retries that
+	// have come due; new events wake it straight away.
+	webhookPollInterval = 15 * time.Second
+	webhookTimeout      = 10 * time.Second
+	webhookBatchSize    = 100
+	// webhookRetention is how long finished deliveries stay in the log.
+	webhookRetention = 30 * 24 * time.Hour
+	// maxWebhookErrorLength caps the response excerpt kept for a failure.
+	maxWebhookErrorLength = 500
+)
+
+// webhookEvents are the events a webhook can subscribe to.
+var webhookEvents = []string{webhookEventExpenseCreated, webhookEventIncomeCreated}
+
+// Webhook is a URL the user's events are posted to. Secret signs each
+// delivery; it is only returned when the webhook is created.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event queued for one webhook. NextAttemptAt is
+// null once it has been delivered or has failed for good.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status"`
+	Error          string          `json:"error,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// webhookPayload is the body posted for every event. Data is the full
+// resource as the API returns it.
+type webhookPayload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type webhookTestData struct {
+	WebhookID int `json:"webhook_id"`
+}
+
+func (app *App) createWebhookTables() error {
+	webhookTableStmt := `
+    CREATE TABLE IF NOT EXISTS webhooks (
+        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        url TEXT NOT NULL,
+        events TEXT NOT NULL,
+        secret TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(webhookTableStmt)); err != nil {
+		return fmt.Errorf("create webhooks table: %w", err)
+	}
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_webhooks_user ON webhooks(user_id)"); err != nil {
+		return fmt.Errorf("create webhooks index: %w", err)
+	}
+
+	deliveryTableStmt := `
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        webhook_id INTEGER NOT NULL,
+        event TEXT NOT NULL,
+        payload TEXT NOT NULL,
+        status TEXT NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        response_status INTEGER,
+        error TEXT,
+        created_at DATETIME NOT NULL,
+        last_attempt_at DATETIME,
+        next_attempt_at DATETIME,
+        delivered_at DATETIME,
+        FOREIGN KEY(webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+    );
+    `
+	if _, err := app.db.Exec(app.dialect.schema(deliveryTableStmt)); err != nil {
+		return fmt.Errorf("create webhook_deliveries table: %w", err)
+	}
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id)"); err != nil {
+		return fmt.Errorf("create webhook_deliveries index: %w", err)
+	}
+	if _, err := app.db.Exec("CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)"); err != nil {
+		return fmt.Errorf("create webhook_deliveries due index: %w", err)
+	}
+	return nil
+}
+
+// queueWebhookEvent queues event, with data as its payload, for each of
+// userID's webhooks subscribed to it. It runs inside tx, so the deliveries
+// only exist if the change they report is committed; call
+// wakeWebhookDispatcher after the commit to send them straight away.
+func queueWebhookEvent(tx txQuerier, userID int, event string, data interface{}) error {
+	ids, err := subscribedWebhooks(tx, userID, event)
+	if err != nil {
+		return err
+	}
+	return queueWebhookDeliveries(tx, ids, event, data)
+}
+
+// subscribedWebhooks returns the IDs of userID's webhooks subscribed to
+// event.
+func subscribedWebhooks(tx txQuerier, userID int, event string) ([]int, error) {
+	rows, err := tx.Query("SELECT id, events FROM webhooks WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("find webhooks: %w", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		var events string
+		if err := rows.Scan(&id, &events); err != nil {
+			return nil, fmt.Errorf("find webhooks: %w", err)
+		}
+		for _, e := range strings.Split(events, ",") {
+			if e == event {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("find webhooks: %w", err)
+	}
+	return ids, nil
+}
+
+// queueWebhookDeliveries is queueWebhookEvent for webhooks already looked
+// up with subscribedWebhooks.
+func queueWebhookDeliveries(tx txQuerier, webhookIDs []int, event string, data interface{}) error {
+	if len(webhookIDs) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	body, err := json.Marshal(webhookPayload{Event: event, CreatedAt: now.Truncate(time.Second), Data: data})
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", event, err)
+	}
+	stamp := now.Format(timeFormat)
+	for _, id := range webhookIDs {
+		if _, err := tx.Exec("INSERT INTO webhook_deliveries(webhook_id, event, payload, status, created_at, next_attempt_at) VALUES(?, ?, ?, ?, ?, ?)",
+			id, event, string(body), webhookStatusPending, stamp, stamp); err != nil {
+			return fmt.Errorf("queue %s event: %w", event, err)
+		}
+	}
+	return nil
+}
+
+// wakeWebhookDispatcher tells the dispatcher there may be new deliveries.
+// It never blocks.
+func (app *App) wakeWebhookDispatcher() {
+	select {
+	case app.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// runWebhookDispatcher sends due deliveries whenever it is woken and every
+// webhookPollInterval. It runs for the life of the server.
+func (app *App) runWebhookDispatcher() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-app.webhookWake:
+		case <-ticker.C:
+		}
+		runJob("webhook deliveries", app.deliverDueWebhooks)
+	}
+}
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+type dueDelivery struct {
+	id       int
+	event    string
+	payload  string
+	attempts int
+	url      string
+	secret   string
+}
+
+// deliverDueWebhooks tries every pending delivery whose next attempt has
+// come, in batches, until none are left.
+func (app *App) deliverDueWebhooks() {
+	for {
+		due, err := app.loadDueDeliveries()
+		if err != nil {
+			log.Printf("webhook deliveries query error: %v", err)
+			return
+		}
+		for _, d := range due {
+			app.attemptDelivery(d)
+		}
+		if len(due) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+func (app *App) loadDueDeliveries() ([]dueDelivery, error) {
+	rows, err := app.db.Query("SELECT d.id, d.event, d.payload, d.attempts, w.url, w.secret FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id WHERE d.status = ? AND d.next_attempt_at <= ? ORDER BY d.id LIMIT ?",
+		webhookStatusPending, time.Now().UTC().Format(timeFormat), webhookBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.id, &d.event, &d.payload, &d.attempts, &d.url, &d.secret); err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// signWebhook is the X-Webhook-Signature of body sent at timestamp: the
+// hex HMAC-SHA256, keyed with the webhook's secret, of the timestamp, a
+// dot, and the body.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// attemptDelivery posts d once and records the outcome. Any 2xx response
+// counts as delivered.
+func (app *App) attemptDelivery(d dueDelivery) {
+	now := time.Now().UTC()
+	attempts := d.attempts + 1
+	responseStatus, failure := postWebhook(d, now)
+
+	stamp := now.Format(timeFormat)
+	var err error
+	switch {
+	case failure == "":
+		_, err = app.db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = ?, response_status = ?, error = NULL, last_attempt_at = ?, next_attempt_at = NULL, delivered_at = ? WHERE id = ?",
+			webhookStatusDelivered, attempts, responseStatus, stamp, stamp, d.id)
+	case attempts >= webhookMaxAttempts:
+		_, err = app.db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = ?, response_status = ?, error = ?, last_attempt_at = ?, next_attempt_at = NULL WHERE id = ?",
+			webhookStatusFailed, attempts, responseStatus, failure, stamp, d.id)
+		log.Printf("webhook delivery %d failed after %d attempts: %s", d.id, attempts, failure)
+	default:
+		next := now.Add(webhookRetryBase << (attempts - 1)).Format(timeFormat)
+		_, err = app.db.Exec("UPDATE webhook_deliveries SET attempts = ?, response_status = ?, error = ?, last_attempt_at = ?, next_attempt_at = ? WHERE id = ?",
+			attempts, responseStatus, failure, stamp, next, d.id)
+	}
+	if err != nil {
+		log.Printf("webhook delivery %d update error: %v", d.id, err)
+	}
+}
+
+// postWebhook sends d and returns the response status, if there was a
+// response, and why it failed, empty if it did not.
+func postWebhook(d dueDelivery, now time.Time) (*int, string) {
+	body := []byte(d.payload)
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err.Error()
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "expense-tracker-webhooks")
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(d.id))
+	req.Header.Set("X-Webhook-Event", d.event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", signWebhook(d.secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return nil, truncateWebhookError(err.Error())
+	}
+	defer resp.Body.Close()
+	status := resp.StatusCode
+	if status >= 200 && status < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookErrorLength))
+		return &status, ""
+	}
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorLength))
+	return &status, truncateWebhookError(strings.TrimSpace(resp.Status + ": " + string(excerpt)))
+}
+
+func truncateWebhookError(s string) string {
+	if len(s) > maxWebhookErrorLength {
+		return s[:maxWebhookErrorLength]
+	}
+	return s
+}
+
+// pruneWebhookDeliveries drops delivered and failed deliveries older than
+// webhookRetention. Pending ones are kept until they finish.
+func (app *App) pruneWebhookDeliveries() {
+	cutoff := time.Now().UTC().Add(-webhookRetention).Format(timeFormat)
+	if _, err := app.db.Exec("DELETE FROM webhook_deliveries WHERE status <> ? AND created_at < ?", webhookStatusPending, cutoff); err != nil {
+		log.Printf("prune webhook deliveries error: %v", err)
+	}
+}
+
+// validateWebhook checks the URL and events of a new webhook, defaulting
+// the events to all of them.
+func validateWebhook(hook *Webhook) error {
+	hook.URL = strings.TrimSpace(hook.URL)
+	if len(hook.URL) > maxWebhookURLLength {
+		return fmt.Errorf("url must be at most %d characters", maxWebhookURLLength)
+	}
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if len(hook.Events) == 0 {
+		hook.Events = webhookEvents
+		return nil
+	}
+	seen := map[string]bool{}
+	var events []string
+	for _, e := range hook.Events {
+		known := false
+		for _, k := range webhookEvents {
+			known = known || e == k
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q; use %s", e, strings.Join(webhookEvents, ", "))
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	hook.Events = events
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+func (app *App) getWebhooks(w http.ResponseWriter, r *http.Request, userID int) {
+	rows, err := app.requestDB(r).Query("SELECT id, url, events, created_at FROM webhooks WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		log.Printf("webhooks query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		var hook Webhook
+		var events, createdAt string
+		if err := rows.Scan(&hook.ID, &hook.URL, &events, &createdAt); err != nil {
+			log.Printf("webhook scan error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		hook.Events = strings.Split(events, ",")
+		if hook.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			log.Printf("webhook timestamp parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONList(w, hooks)
+}
+
+func (app *App) createWebhook(w http.ResponseWriter, r *http.Request, userID int) {
+	var hook Webhook
+	if !decodeJSONBody(w, r, &hook) {
+		return
+	}
+	if err := validateWebhook(&hook); err != nil {
+		http.Error(w, "Invalid webhook: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	if err := app.db.QueryRow("SELECT COUNT(*) FROM webhooks WHERE user_id = ?", userID).Scan(&count); err != nil {
+		log.Printf("webhooks count error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxWebhooksPerUser {
+		http.Error(w, fmt.Sprintf("At most %d webhooks are allowed", maxWebhooksPerUser), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		log.Printf("webhook secret error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	hook.Secret = secret
+	hook.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	hook.ID, err = insertReturningID(app.db, "INSERT INTO webhooks(user_id, url, events, secret, created_at) VALUES(?, ?, ?, ?, ?)",
+		userID, hook.URL, strings.Join(hook.Events, ","), hook.Secret, hook.CreatedAt.Format(timeFormat))
+	if err != nil {
+		log.Printf("create webhook error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// deleteWebhook removes a webhook along with its delivery log; deliveries
+// still pending are never sent.
+func (app *App) deleteWebhook(w http.ResponseWriter, r *http.Request, userID, id int) {
+	res, err := app.db.Exec("DELETE FROM webhooks WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Printf("delete webhook error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownsWebhook writes a 404 and returns false unless webhook id is userID's.
+func (app *App) ownsWebhook(w http.ResponseWriter, userID, id int) bool {
+	var exists int
+	err := app.db.QueryRow("SELECT 1 FROM webhooks WHERE id = ? AND user_id = ?", id, userID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		log.Printf("webhook lookup error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+const webhookDeliveryColumns = "id, webhook_id, event, status, attempts, response_status, error, payload, created_at, last_attempt_at, next_attempt_at, delivered_at"
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var responseStatus sql.NullInt64
+	var failure sql.NullString
+	var payload, createdAt string
+	var lastAttemptAt, nextAttemptAt, deliveredAt sql.NullString
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Status, &d.Attempts, &responseStatus, &failure, &payload, &createdAt, &lastAttemptAt, &nextAttemptAt, &deliveredAt); err != nil {
+		return d, err
+	}
+	d.ResponseStatus = nullIntPtr(responseStatus)
+	d.Error = failure.String
+	d.Payload = json.RawMessage(payload)
+	var err error
+	if d.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return d, err
+	}
+	for _, t := range []struct {
+		raw sql.NullString
+		dst **time.Time
+	}{{lastAttemptAt, &d.LastAttemptAt}, {nextAttemptAt, &d.NextAttemptAt}, {deliveredAt, &d.DeliveredAt}} {
+		if !t.raw.Valid {
+			continue
+		}
+		parsed, err := parseTimestamp(t.raw.String)
+		if err != nil {
+			return d, err
+		}
+		*t.dst = &parsed
+	}
+	return d, nil
+}
+
+// getWebhookDeliveries serves GET /webhooks/{id}/deliveries, newest first.
+// status narrows it to pending, delivered, or failed deliveries.
+func (app *App) getWebhookDeliveries(w http.ResponseWriter, r *http.Request, userID, id int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "status", "limit", "offset") {
+		return
+	}
+	if !app.ownsWebhook(w, userID, id) {
+		return
+	}
+	query := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries WHERE webhook_id = ?"
+	args := []interface{}{id}
+	if status := params.Get("status"); status != "" {
+		if status != webhookStatusPending && status != webhookStatusDelivered && status != webhookStatusFailed {
+			http.Error(w, "Invalid status; use pending, delivered, or failed", http.StatusBadRequest)
+			return
+		}
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	limit, offset, ok := parsePagination(w, params)
+	if !ok {
+		return
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := app.requestDB(r).Query(query, args...)
+	if err != nil {
+		log.Printf("webhook deliveries query error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			log.Printf("webhook delivery scan error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONList(w, deliveries)
+}
+
+// testWebhook serves POST /webhooks/{id}/test: it queues a webhook.test
+// event for that webhook alone and returns the pending delivery, which
+// GET /webhooks/{id}/deliveries then follows like any other.
+func (app *App) testWebhook(w http.ResponseWriter, r *http.Request, userID, id int) {
+	if !app.ownsWebhook(w, userID, id) {
+		return
+	}
+	now := time.Now().UTC()
+	body, err := json.Marshal(webhookPayload{Event: webhookEventTest, CreatedAt: now.Truncate(time.Second), Data: webhookTestData{WebhookID: id}})
+	if err != nil {
+		log.Printf("webhook test encode error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	stamp := now.Format(timeFormat)
+	deliveryID, err := insertReturningID(app.db, "INSERT INTO webhook_deliveries(webhook_id, event, payload, status, created_at, next_attempt_at) VALUES(?, ?, ?, ?, ?, ?)",
+		id, webhookEventTest, string(body), webhookStatusPending, stamp, stamp)
+	if err != nil {
+		log.Printf("webhook test queue error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	app.wakeWebhookDispatcher()
+
+	d, err := scanWebhookDelivery(app.db.QueryRow("SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = ?", deliveryID))
+	if err != nil {
+		log.Printf("webhook delivery fetch error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(d)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records what is posted to it and answers with the next
+// of its statuses, then 200.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rec *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.requests = append(rec.requests, r)
+	rec.bodies = append(rec.bodies, body)
+	status := http.StatusOK
+	if len(rec.statuses) > 0 {
+		status, rec.statuses = rec.statuses[0], rec.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rec *webhookReceiver) count() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.requests)
+}
+
+func webhookDeliveries(t *testing.T, webhookID int, query string) []WebhookDelivery {
+	t.Helper()
+	rr := callAuthed(http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries%s", webhookID, query), nil)
+	expectStatus(t, rr, http.StatusOK)
+	return decodeBody[[]WebhookDelivery](t, rr)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	useTestDB(t)
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	rr := callAuthed(http.MethodPost, "/webhooks", Webhook{URL: server.URL + "/hook", Events: []string{webhookEventExpenseCreated}})
+	expectStatus(t, rr, http.StatusCreated)
+	hook := decodeBody[Webhook](t, rr)
+	if !strings.HasPrefix(hook.Secret, "whsec_") || len(hook.Events) != 1 {
+		t.Fatalf("unexpected webhook: %+v", hook)
+	}
+	listed := decodeBody[[]Webhook](t, callAuthed(http.MethodGet, "/webhooks", nil))
+	if len(listed) != 1 || listed[0].Secret != "" {
+		t.Fatalf("expected the secret to be left out of the list, got %+v", listed)
+	}
+
+	expense := decodeBody[Expense](t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 12.5, Category: "Food", AccountID: testAccount()}))
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 100, Source: "Salary", AccountID: testAccount()}), http.StatusCreated)
+	pending := webhookDeliveries(t, hook.ID, "")
+	if len(pending) != 1 || pending[0].Status != webhookStatusPending || pending[0].Attempts != 0 {
+		t.Fatalf("expected one pending delivery for the subscribed event, got %+v", pending)
+	}
+
+	testApp.deliverDueWebhooks()
+	if receiver.count() != 1 {
+		t.Fatalf("expected one post, got %d", receiver.count())
+	}
+	req, body := receiver.requests[0], receiver.bodies[0]
+	if req.Header.Get("X-Webhook-Event") != webhookEventExpenseCreated || req.Header.Get("X-Webhook-Delivery") != fmt.Sprint(pending[0].ID) {
+		t.Fatalf("unexpected headers: %v", req.Header)
+	}
+	if want := signWebhook(hook.Secret, req.Header.Get("X-Webhook-Timestamp"), body); req.Header.Get("X-Webhook-Signature") != want {
+		t.Fatalf("signature %q does not match %q", req.Header.Get("X-Webhook-Signature"), want)
+	}
+	var payload struct {
+		Event string
+		Data  Expense
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Event != webhookEventExpenseCreated || payload.Data.ID != expense.ID || payload.Data.Amount != 12.5 || payload.Data.Category != "Food" {
+		t.Fatalf("unexpected payload: %s", body)
+	}
+
+	delivered := webhookDeliveries(t, hook.ID, "?status=delivered")
+	if len(delivered) != 1 || delivered[0].Attempts != 1 || delivered[0].ResponseStatus == nil || *delivered[0].ResponseStatus != 200 ||
+		delivered[0].DeliveredAt == nil || delivered[0].NextAttemptAt != nil {
+		t.Fatalf("unexpected delivery log: %+v", delivered)
+	}
+
+	// A create that is rolled back queues nothing.
+	strict := decodeBody[Account](t, callAuthed(http.MethodPost, "/accounts", Account{Name: "Savings", Type: "bank", AllowNegative: boolPtr(false)}))
+	expectStatus(t, callAuthed(http.MethodPost, "/expenses", Expense{Amount: 5, Category: "Food", AccountID: intPtr(strict.ID)}), http.StatusUnprocessableEntity)
+	if n := len(webhookDeliveries(t, hook.ID, "")); n != 1 {
+		t.Fatalf("expected no delivery for the refused expense, got %d deliveries", n)
+	}
+
+	// Expenses generated by recurring expenses are sent too.
+	expectStatus(t, callAuthed(http.MethodPost, "/recurring-expenses", RecurringExpense{Amount: 9.99, Category: "Streaming", Frequency: "monthly", NextDueDate: time.Now().UTC().Add(-time.Hour)}), http.StatusCreated)
+	expectStatus(t, callAuthed(http.MethodPost, "/recurring-expenses/process", nil), http.StatusOK)
+	if d := webhookDeliveries(t, hook.ID, "?status=pending"); len(d) != 1 || !strings.Contains(string(d[0].Payload), `"Streaming"`) {
+		t.Fatalf("expected a delivery for the generated expense, got %+v", d)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	useTestDB(t)
+	receiver := &webhookReceiver{statuses: []int{http.StatusInternalServerError}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	hook := decodeBody[Webhook](t, callAuthed(http.MethodPost, "/webhooks", Webhook{URL: server.URL}))
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 100, Source: "Salary", AccountID: testAccount()}), http.StatusCreated)
+
+	before := time.Now().UTC().Truncate(time.Second)
+	testApp.deliverDueWebhooks()
+	d := webhookDeliveries(t, hook.ID, "")[0]
+	if d.Status != webhookStatusPending || d.Attempts != 1 || *d.ResponseStatus != 500 || !strings.Contains(d.Error, "500") {
+		t.Fatalf("expected a failed attempt to stay pending, got %+v", d)
+	}
+	if wait := d.NextAttemptAt.Sub(before); wait < webhookRetryBase || wait > webhookRetryBase+2*time.Second {
+		t.Fatalf("expected the retry %s later, got %s", webhookRetryBase, wait)
+	}
+
+	// Not due yet.
+	testApp.deliverDueWebhooks()
+	if receiver.count() != 1 {
+		t.Fatalf("expected no retry before next_attempt_at, got %d posts", receiver.count())
+	}
+
+	if _, err := testApp.db.Exec("UPDATE webhook_deliveries SET next_attempt_at = ?", before.Add(-time.Minute).Format(timeFormat)); err != nil {
+		t.Fatal(err)
+	}
+	testApp.deliverDueWebhooks()
+	if d := webhookDeliveries(t, hook.ID, "")[0]; d.Status != webhookStatusDelivered || d.Attempts != 2 || d.Error != "" {
+		t.Fatalf("expected the retry to be delivered, got %+v", d)
+	}
+
+	// The backoff doubles and the last attempt gives up.
+	receiver.statuses = []int{503, 503}
+	expectStatus(t, callAuthed(http.MethodPost, "/webhooks/"+fmt.Sprint(hook.ID)+"/test", nil), http.StatusAccepted)
+	if _, err := testApp.db.Exec("UPDATE webhook_deliveries SET attempts = 2 WHERE status = ?", webhookStatusPending); err != nil {
+		t.Fatal(err)
+	}
+	before = time.Now().UTC().Truncate(time.Second)
+	testApp.deliverDueWebhooks()
+	d = webhookDeliveries(t, hook.ID, "?status=pending")[0]
+	if wait := d.NextAttemptAt.Sub(before); wait < 4*webhookRetryBase || wait > 4*webhookRetryBase+2*time.Second {
+		t.Fatalf("expected the fourth retry %s later, got %s", 4*webhookRetryBase, wait)
+	}
+	if _, err := testApp.db.Exec("UPDATE webhook_deliveries SET attempts = ?, next_attempt_at = ? WHERE id = ?", webhookMaxAttempts-1, before.Format(timeFormat), d.ID); err != nil {
+		t.Fatal(err)
+	}
+	testApp.deliverDueWebhooks()
+	failed := webhookDeliveries(t, hook.ID, "?status=failed")
+	if len(failed) != 1 || failed[0].Attempts != webhookMaxAttempts || failed[0].NextAttemptAt != nil {
+		t.Fatalf("expected the delivery to fail for good, got %+v", failed)
+	}
+}
+
+func TestWebhookTestEndpoint(t *testing.T) {
+	useTestDB(t)
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	hook := decodeBody[Webhook](t, callAuthed(http.MethodPost, "/webhooks", Webhook{URL: server.URL}))
+	rr := callAuthed(http.MethodPost, fmt.Sprintf("/webhooks/%d/test", hook.ID), nil)
+	expectStatus(t, rr, http.StatusAccepted)
+	if d := decodeBody[WebhookDelivery](t, rr); d.Event != webhookEventTest || d.Status != webhookStatusPending || d.WebhookID != hook.ID {
+		t.Fatalf("unexpected test delivery: %+v", d)
+	}
+	testApp.deliverDueWebhooks()
+	if receiver.count() != 1 || receiver.requests[0].Header.Get("X-Webhook-Event") != webhookEventTest {
+		t.Fatalf("expected the test event to be posted, got %d posts", receiver.count())
+	}
+
+	// Webhooks are private to their owner.
+	cookie, _ := registerUser(t, "hooks@example.com", "WebhookUserPass123!")
+	expectStatus(t, callAuthedAs(cookie, http.MethodPost, fmt.Sprintf("/webhooks/%d/test", hook.ID), nil), http.StatusNotFound)
+	expectStatus(t, callAuthedAs(cookie, http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", hook.ID), nil), http.StatusNotFound)
+	expectStatus(t, callAuthedAs(cookie, http.MethodDelete, fmt.Sprintf("/webhooks/%d", hook.ID), nil), http.StatusNotFound)
+
+	expectStatus(t, callAuthed(http.MethodDelete, fmt.Sprintf("/webhooks/%d", hook.ID), nil), http.StatusNoContent)
+	expectStatus(t, callAuthed(http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", hook.ID), nil), http.StatusNotFound)
+}
+
+func TestValidateWebhook(t *testing.T) {
+	for _, hook := range []Webhook{
+		{URL: "example.com/hook"},
+		{URL: "ftp://example.com/hook"},
+		{URL: "https:///hook"},
+		{URL: "https://example.com/hook", Events: []string{"expense.deleted"}},
+		{URL: "https://example.com/hook", Events: []string{webhookEventTest}},
+	} {
+		if err := validateWebhook(&hook); err == nil {
+			t.Errorf("expected %+v to be rejected", hook)
+		}
+	}
+
+	hook := Webhook{URL: " https://example.com/hook ", Events: []string{webhookEventIncomeCreated, webhookEventIncomeCreated}}
+	if err := validateWebhook(&hook); err != nil || hook.URL != "https://example.com/hook" || len(hook.Events) != 1 {
+		t.Fatalf("unexpected result %+v, %v", hook, err)
+	}
+	hook = Webhook{URL: "http://localhost:8080/hook"}
+	if err := validateWebhook(&hook); err != nil || len(hook.Events) != len(webhookEvents) {
+		t.Fatalf("expected every event by default, got %+v, %v", hook, err)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// yearReviewTopCategories is how many categories the year in review lists.
+const yearReviewTopCategories = 5
+
+var yearPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// YearReview sums up one calendar or fiscal year in the user's timezone,
+// from the inclusive days From to To. Like the income-vs-expense report it
+// leaves out opening balances and counts only the user's own transactions.
+// A year without data is all zeros, with BiggestExpense and TopMonth null.
+type YearReview struct {
+	Year             int             `json:"year"`
+	Period           string          `json:"period"`
+	From             string          `json:"date_from"`
+	To               string          `json:"date_to"`
+	Income           float64         `json:"income"`
+	Expense          float64         `json:"expense"`
+	Net              float64         `json:"net"`
+	SavingsRate      float64         `json:"savings_rate"`
+	TopCategories    []CategoryTotal `json:"top_categories"`
+	BiggestExpense   *LargestSpend   `json:"biggest_expense"`
+	TopMonth         *MonthSpend     `json:"top_month"`
+	TransactionCount int             `json:"transaction_count"`
+	// AverageMonthlyExpense divides Expense over the months of the year
+	// elapsed so far, so a year in progress is not diluted by months to come.
+	AverageMonthlyExpense float64 `json:"average_monthly_expense"`
+}
+
+type MonthSpend struct {
+	Month string  `json:"month"`
+	Total float64 `json:"total"`
+}
+
+// savingsRate is the percentage of income left after expenses, 0 without
+// income.
+func savingsRate(income, expense float64) float64 {
+	if income <= 0 {
+		return 0
+	}
+	return roundCents((income - expense) / income * 100)
+}
+
+// yearReviewHandler serves GET /reports/year. year defaults to the current
+// one in the user's timezone. With fiscal=true it is the user's fiscal year
+// named year, which starts that year in their fiscal_year_start_month.
+func (app *App) yearReviewHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	params := r.URL.Query()
+	if !checkKnownParams(w, params, "year", "fiscal") {
+		return
+	}
+	fiscal, ok := parseBoolParam(w, params, "fiscal")
+	if !ok {
+		return
+	}
+	loc, ok := app.userLocation(w, userID)
+	if !ok {
+		return
+	}
+	period := reportPeriods["year"]
+	if fiscal {
+		startMonth, ok := app.fiscalYearStart(w, userID)
+		if !ok {
+			return
+		}
+		period = fiscalReportPeriods(startMonth)["year"]
+	}
+	today := localDay(time.Now(), loc)
+	start := period.start(today)
+	if raw := strings.TrimSpace(params.Get("year")); raw != "" {
+		if !yearPattern.MatchString(raw) {
+			http.Error(w, "Invalid year; use a four-digit year such as 2024", http.StatusBadRequest)
+			return
+		}
+		year, _ := strconv.Atoi(raw)
+		start = time.Date(year, start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	review, err := computeYearReview(app.requestDB(r), userID, period, start, today, loc)
+	if err != nil {
+		log.Printf("year review error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// computeYearReview runs only aggregate queries, so the work done in Go is
+// the same for a year of ten expenses or ten thousand. Monthly totals come
+// from one pass with a SUM per month, bounded by where each month starts in
+// loc. start is the first day of the year, as period, the calendar or a
+// fiscal year, would start it.
+func computeYearReview(q querier, userID int, period reportPeriod, start, today time.Time, loc *time.Location) (YearReview, error) {
+	end := period.next(start)
+	review := YearReview{
+		Year:          start.Year(),
+		Period:        period.label(start),
+		From:          start.Format(statsDateFormat),
+		To:            end.AddDate(0, 0, -1).Format(statsDateFormat),
+		TopCategories: []CategoryTotal{},
+	}
+	month := reportPeriods["month"]
+	from, to := dayStart(start, loc), dayStart(end, loc)
+
+	var sums []string
+	var monthArgs []interface{}
+	for m := start; m.Before(end); m = month.next(m) {
+		sums = append(sums, "COALESCE(SUM(CASE WHEN date >= ? AND date < ? THEN amount END), 0)")
+		monthArgs = append(monthArgs, dayStart(m, loc), dayStart(month.next(m), loc))
+	}
+	monthly := make([]float64, len(sums))
+	dest := []interface{}{&review.TransactionCount, &review.Expense}
+	for i := range monthly {
+		dest = append(dest, &monthly[i])
+	}
+	var incomeCount int
+	err := runConcurrently(
+		func() error {
+			query := "SELECT COUNT(*), COALESCE(SUM(amount), 0), " + strings.Join(sums, ", ") + " FROM expenses WHERE user_id = ? AND date >= ? AND date < ?"
+			return q.QueryRow(query, append(monthArgs, userID, from, to)...).Scan(dest...)
+		},
+		func() error {
+			return q.QueryRow("SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM incomes WHERE user_id = ? AND opening_balance = 0 AND date >= ? AND date < ?", userID, from, to).Scan(&incomeCount, &review.Income)
+		},
+		func() (err error) {
+			review.TopCategories, err = topCategories(q, userID, from, to, yearReviewTopCategories)
+			return err
+		},
+		func() error {
+			var largest LargestSpend
+			var dateStr string
+			err := q.QueryRow("SELECT id, amount, category, date FROM expenses WHERE user_id = ? AND date >= ? AND date < ? ORDER BY amount DESC, id LIMIT 1", userID, from, to).
+				Scan(&largest.ID, &largest.Amount, &largest.Category, &dateStr)
+			if err == sql.ErrNoRows {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if largest.Date, err = parseTimestamp(dateStr); err != nil {
+				return err
+			}
+			review.BiggestExpense = &largest
+			return nil
+		},
+	)
+	if err != nil {
+		return review, fmt.Errorf("year %s: %w", review.Period, err)
+	}
+
+	review.TransactionCount += incomeCount
+	review.Income = roundCents(review.Income)
+	review.Expense = roundCents(review.Expense)
+	review.Net = roundCents(review.Income - review.Expense)
+	review.SavingsRate = savingsRate(review.Income, review.Expense)
+	for i, total := range monthly {
+		// Ties go to the earlier month.
+		if total > 0 && (review.TopMonth == nil || roundCents(total) > review.TopMonth.Total) {
+			review.TopMonth = &MonthSpend{Month: month.label(start.AddDate(0, i, 0)), Total: roundCents(total)}
+		}
+	}
+	months := len(monthly)
+	if !today.Before(start) && today.Before(end) {
+		months = (today.Year()-start.Year())*12 + int(today.Month()-start.Month()) + 1
+	}
+	review.AverageMonthlyExpense = roundCents(review.Expense / float64(months))
+	return review, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestYearReview(t *testing.T) {
+	useTestDB(t)
+	expectStatus(t, callAuthed(http.MethodPut, "/settings", UserSettings{Timezone: "Asia/Jakarta"}), http.StatusOK)
+
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, jakarta) }
+	for _, e := range []Expense{
+		{Amount: 100, Category: "Rent", Date: at(2023, 3, 1, 9)},
+		{Amount: 40, Category: "Food", Date: at(2023, 3, 20, 9)},
+		{Amount: 120, Category: "Travel", Date: at(2023, 7, 4, 9)},
+		{Amount: 20, Category: "Shop", Date: at(2023, 12, 31, 23), Splits: []ExpenseSplit{{Category: "Food", Amount: 5}, {Category: "Gifts", Amount: 15}}},
+		// New Year's Day in Jakarta, though still 2023 in UTC.
+		{Amount: 999, Category: "Party", Date: at(2024, 1, 1, 3)},
+	} {
+		e.AccountID = testAccount()
+		expectStatus(t, callAuthed(http.MethodPost, "/expenses", e), http.StatusCreated)
+	}
+	expectStatus(t, callAuthed(http.MethodPost, "/incomes", Income{Amount: 400, Source: "Salary", Date: at(2023, 6, 1, 9), AccountID: testAccount()}), http.StatusCreated)
+
+	rr := callAuthed(http.MethodGet, "/reports/year?year=2023", nil)
+	expectStatus(t, rr, http.StatusOK)
+	review := decodeBody[YearReview](t, rr)
+	if review.Income != 400 || review.Expense != 280 || review.Net != 120 || review.SavingsRate != 30 || review.TransactionCount != 5 {
+		t.Fatalf("unexpected totals: %+v", review)
+	}
+	wantTop := []CategoryTotal{{"Travel", 120, nil}, {"Rent", 100, nil}, {"Food", 45, nil}, {"Gifts", 15, nil}}
+	if !reflect.DeepEqual(review.TopCategories, wantTop) {
+		t.Fatalf("unexpected top categories: %+v", review.TopCategories)
+	}
+	if review.BiggestExpense == nil || review.BiggestExpense.Amount != 120 || review.TopMonth == nil || *review.TopMonth != (MonthSpend{Month: "2023-03", Total: 140}) {
+		t.Fatalf("unexpected biggest expense or month: %+v %+v", review.BiggestExpense, review.TopMonth)
+	}
+	if review.AverageMonthlyExpense != 23.33 {
+		t.Fatalf("expected 280 over 12 months, got %v", review.AverageMonthlyExpense)
+	}
+
+	empty := decodeBody[YearReview](t, callAuthed(http.MethodGet, "/reports/year?year=1999", nil))
+	if empty.Year != 1999 || empty.Expense != 0 || empty.BiggestExpense != nil || empty.TopMonth != nil || len(empty.TopCategories) != 0 || empty.TopCategories == nil {
+		t.Fatalf("expected an empty year to be zeros, got %+v", empty)
+	}
+
+	for _, year := range []string{"23", "2023.5", "abcd", "-2023"} {
+		expectStatus(t, callAuthed(http.MethodGet, "/reports/year?year="+year, nil), http.StatusBadRequest)
+	}
+}
+
+func TestSavingsRate(t *testing.T) {
+	for _, c := range []struct{ income, expense, want float64 }{
+		{1000, 750, 25},
+		{1000, 1500, -50},
+		{0, 100, 0},
+		{3, 1, 66.67},
+	} {
+		if got := savingsRate(c.income, c.expense); got != c.want {
+			t.Errorf("savingsRate(%v, %v) = %v, want %v", c.income, c.expense, got, c.want)
+		}
+	}
+}